@@ -0,0 +1,375 @@
+// Package alerts evaluates tenant-defined alert rules against the metrics of
+// each analysis.
+package alerts
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"sort"
+	"sync"
+	"time"
+
+	"analyticsai/ai-service/analytics"
+	"analyticsai/ai-service/analytics/aggregator"
+	"analyticsai/ai-service/notify"
+)
+
+// ErrNotFound is returned for rules that don't exist for the tenant.
+var ErrNotFound = errors.New("not found")
+
+// Metrics rules can be written against.
+const (
+	MetricRequests           = "requests"
+	MetricErrorRate          = "error_rate"   // percent
+	MetricAvgDuration        = "avg_duration" // ms
+	MetricP95Duration        = "p95_duration" // ms
+	MetricSlowEndpoints      = "slow_endpoints"
+	MetricIssues             = "issues"
+	MetricHighSeverityIssues = "high_severity_issues" // high or critical
+	MetricAnomalies          = "anomalies"
+)
+
+var metrics = []string{
+	MetricRequests, MetricErrorRate, MetricAvgDuration, MetricP95Duration,
+	MetricSlowEndpoints, MetricIssues, MetricHighSeverityIssues, MetricAnomalies,
+}
+
+var (
+	operators  = []string{">", ">=", "<", "<="}
+	severities = []string{"low", "medium", "high", "critical"}
+)
+
+// Rule notifies Channel when Metric of an analysis compares to Threshold
+// with Operator.
+type Rule struct {
+	ID              string         `json:"id"`
+	Tenant          string         `json:"tenant"`
+	Name            string         `json:"name"`
+	Metric          string         `json:"metric"`
+	Operator        string         `json:"operator"` // ">", ">=", "<" or "<=", default ">"
+	Threshold       float64        `json:"threshold"`
+	Severity        string         `json:"severity"`       // low, medium, high or critical, default medium
+	Kind            string         `json:"kind,omitempty"` // "logs" or "performance"; empty matches both
+	Channel         notify.Channel `json:"channel"`
+	CooldownMinutes int            `json:"cooldown_minutes,omitempty"` // minimum time between notifications
+	Disabled        bool           `json:"disabled,omitempty"`
+	CreatedAt       time.Time      `json:"created_at"`
+	UpdatedAt       time.Time      `json:"updated_at"`
+	LastTriggered   *time.Time     `json:"last_triggered_at,omitempty"`
+}
+
+func contains(values []string, s string) bool {
+	for _, v := range values {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
+
+// Validate checks the user-supplied fields of the rule, filling in the
+// default operator and severity.
+func (r *Rule) Validate() error {
+	if r.Name == "" {
+		return fmt.Errorf("name is required")
+	}
+	if !contains(metrics, r.Metric) {
+		return fmt.Errorf("unknown metric %q", r.Metric)
+	}
+	if r.Operator == "" {
+		r.Operator = ">"
+	}
+	if !contains(operators, r.Operator) {
+		return fmt.Errorf("operator must be one of >, >=, < or <=")
+	}
+	if r.Severity == "" {
+		r.Severity = "medium"
+	}
+	if !contains(severities, r.Severity) {
+		return fmt.Errorf("severity must be low, medium, high or critical")
+	}
+	if r.Kind != "" && r.Kind != "logs" && r.Kind != "performance" {
+		return fmt.Errorf("kind must be logs or performance")
+	}
+	if r.CooldownMinutes < 0 {
+		return fmt.Errorf("cooldown_minutes must not be negative")
+	}
+	return r.Channel.Validate()
+}
+
+// Values returns the rule metrics of an analysis.
+func Values(snapshot *aggregator.MetricsSnapshot, issues []analytics.Issue, anomalies []aggregator.Anomaly) map[string]float64 {
+	high := 0
+	for _, issue := range issues {
+		if issue.Severity == "high" || issue.Severity == "critical" {
+			high++
+		}
+	}
+	return map[string]float64{
+		MetricRequests:           float64(snapshot.Requests),
+		MetricErrorRate:          snapshot.ErrorRate,
+		MetricAvgDuration:        float64(snapshot.AvgDuration),
+		MetricP95Duration:        float64(snapshot.P95Duration),
+		MetricSlowEndpoints:      float64(snapshot.SlowEndpoints),
+		MetricIssues:             float64(len(issues)),
+		MetricHighSeverityIssues: float64(high),
+		MetricAnomalies:          float64(len(anomalies)),
+	}
+}
+
+// Matches reports whether value breaches the rule.
+func (r *Rule) Matches(value float64) bool {
+	switch r.Operator {
+	case ">=":
+		return value >= r.Threshold
+	case "<":
+		return value < r.Threshold
+	case "<=":
+		return value <= r.Threshold
+	}
+	return value > r.Threshold
+}
+
+// Registry holds alert rules, optionally backed by a JSON file.
+type Registry struct {
+	mu       sync.Mutex
+	path     string
+	rules    map[string]*Rule
+	notifier *notify.Notifier
+}
+
+// NewRegistry loads rules from path. An empty path or a missing file yields
+// an empty registry; changes are written back when path is set. Rules'
+// channels are checked against notifier, which delivers their alerts.
+func NewRegistry(path string, notifier *notify.Notifier) (*Registry, error) {
+	r := &Registry{path: path, rules: make(map[string]*Rule), notifier: notifier}
+	if path == "" {
+		return r, nil
+	}
+
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return r, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("error reading alert rules file: %v", err)
+	}
+	var rules []*Rule
+	if err := json.Unmarshal(data, &rules); err != nil {
+		return nil, fmt.Errorf("error parsing alert rules file: %v", err)
+	}
+	for _, rule := range rules {
+		r.rules[rule.ID] = rule
+	}
+	return r, nil
+}
+
+func (r *Registry) save() error {
+	if r.path == "" {
+		return nil
+	}
+	rules := make([]*Rule, 0, len(r.rules))
+	for _, rule := range r.rules {
+		rules = append(rules, rule)
+	}
+	sort.Slice(rules, func(i, j int) bool { return rules[i].ID < rules[j].ID })
+	data, err := json.MarshalIndent(rules, "", "  ")
+	if err != nil {
+		return fmt.Errorf("error marshaling alert rules: %v", err)
+	}
+	if err := os.WriteFile(r.path, data, 0644); err != nil {
+		return fmt.Errorf("error writing alert rules file: %v", err)
+	}
+	return nil
+}
+
+// validate checks rule and that its tenant may deliver to its channel.
+func (r *Registry) validate(rule *Rule) error {
+	if err := rule.Validate(); err != nil {
+		return err
+	}
+	return r.notifier.Check(rule.Channel, rule.Tenant)
+}
+
+func newID() (string, error) {
+	b := make([]byte, 8)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
+
+// Add validates rule, assigns its ID and stores it.
+func (r *Registry) Add(rule Rule) (Rule, error) {
+	if err := r.validate(&rule); err != nil {
+		return Rule{}, err
+	}
+	id, err := newID()
+	if err != nil {
+		return Rule{}, fmt.Errorf("error generating rule id: %v", err)
+	}
+	now := time.Now().UTC()
+	rule.ID = id
+	rule.CreatedAt, rule.UpdatedAt = now, now
+	rule.LastTriggered = nil
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.rules[id] = &rule
+	if err := r.save(); err != nil {
+		delete(r.rules, id)
+		return Rule{}, err
+	}
+	return rule, nil
+}
+
+// Update replaces the tenant's rule id with rule, keeping its ID, creation
+// and last trigger times.
+func (r *Registry) Update(tenant, id string, rule Rule) (Rule, error) {
+	rule.Tenant = tenant
+	if err := r.validate(&rule); err != nil {
+		return Rule{}, err
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	old, ok := r.rules[id]
+	if !ok || old.Tenant != tenant {
+		return Rule{}, ErrNotFound
+	}
+	rule.ID = id
+	rule.CreatedAt, rule.LastTriggered = old.CreatedAt, old.LastTriggered
+	rule.UpdatedAt = time.Now().UTC()
+	r.rules[id] = &rule
+	if err := r.save(); err != nil {
+		r.rules[id] = old
+		return Rule{}, err
+	}
+	return rule, nil
+}
+
+// List returns the tenant's rules ordered by name.
+func (r *Registry) List(tenant string) []Rule {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	rules := []Rule{}
+	for _, rule := range r.rules {
+		if rule.Tenant == tenant {
+			rules = append(rules, *rule)
+		}
+	}
+	sort.Slice(rules, func(i, j int) bool {
+		if rules[i].Name != rules[j].Name {
+			return rules[i].Name < rules[j].Name
+		}
+		return rules[i].ID < rules[j].ID
+	})
+	return rules
+}
+
+// Get returns the tenant's rule id.
+func (r *Registry) Get(tenant, id string) (Rule, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	rule, ok := r.rules[id]
+	if !ok || rule.Tenant != tenant {
+		return Rule{}, ErrNotFound
+	}
+	return *rule, nil
+}
+
+// Delete removes the tenant's rule id.
+func (r *Registry) Delete(tenant, id string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	rule, ok := r.rules[id]
+	if !ok || rule.Tenant != tenant {
+		return ErrNotFound
+	}
+	delete(r.rules, id)
+	return r.save()
+}
+
+// DeleteTenant removes every rule of tenant and returns their IDs.
+func (r *Registry) DeleteTenant(tenant string) ([]string, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	ids := []string{}
+	for id, rule := range r.rules {
+		if rule.Tenant == tenant {
+			ids = append(ids, id)
+			delete(r.rules, id)
+		}
+	}
+	sort.Strings(ids)
+	return ids, r.save()
+}
+
+// Triggered is a rule an analysis breached.
+type Triggered struct {
+	RuleID    string         `json:"rule_id"`
+	Name      string         `json:"name"`
+	Metric    string         `json:"metric"`
+	Operator  string         `json:"operator"`
+	Threshold float64        `json:"threshold"`
+	Value     float64        `json:"value"`
+	Severity  string         `json:"severity"`
+	Notified  bool           `json:"notified"`        // false while the rule is cooling down
+	Error     string         `json:"error,omitempty"` // notification delivery failure
+	Channel   notify.Channel `json:"-"`
+}
+
+// Evaluate returns the tenant's enabled rules for kind that values breach.
+// Rules outside their cooldown are marked notified and their last trigger
+// time is recorded; the caller delivers the notifications.
+func (r *Registry) Evaluate(tenant, kind string, values map[string]float64) []Triggered {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	now := time.Now().UTC()
+	triggered := []Triggered{}
+	changed := false
+	for _, rule := range r.rules {
+		if rule.Tenant != tenant || rule.Disabled || (rule.Kind != "" && rule.Kind != kind) {
+			continue
+		}
+		value, ok := values[rule.Metric]
+		if !ok || !rule.Matches(value) {
+			continue
+		}
+		t := Triggered{
+			RuleID:    rule.ID,
+			Name:      rule.Name,
+			Metric:    rule.Metric,
+			Operator:  rule.Operator,
+			Threshold: rule.Threshold,
+			Value:     value,
+			Severity:  rule.Severity,
+			Channel:   rule.Channel,
+		}
+		cooldown := time.Duration(rule.CooldownMinutes) * time.Minute
+		if rule.LastTriggered == nil || now.Sub(*rule.LastTriggered) >= cooldown {
+			t.Notified = true
+			rule.LastTriggered = &now
+			changed = true
+		}
+		triggered = append(triggered, t)
+	}
+	if changed {
+		if err := r.save(); err != nil {
+			// Notifications still go out; only the cooldown bookkeeping is lost.
+			log.Printf("Error saving alert rules: %v", err)
+		}
+	}
+	sort.Slice(triggered, func(i, j int) bool {
+		if triggered[i].Name != triggered[j].Name {
+			return triggered[i].Name < triggered[j].Name
+		}
+		return triggered[i].RuleID < triggered[j].RuleID
+	})
+	return triggered
+}
@@ -0,0 +1,17 @@
+// Package aggregator computes the deterministic statistics the analyses are
+// built on: time series, status and latency breakdowns, Apdex and SLOs,
+// sessions, traffic classes, error clusters and the other per-dimension
+// aggregates. It sits between the parser and the analysis layer, makes no
+// model calls and keeps no state, so its results are cheap to recompute
+// and safe to share.
+package aggregator
+
+import "analyticsai/ai-service/analytics/parser"
+
+// LogEntry is the log entry type of the parser layer, aliased so the
+// aggregates read naturally.
+type LogEntry = parser.LogEntry
+
+// ErrInvalidInput is the parser layer's error for bad caller input; the
+// aggregates wrap it for invalid options such as unknown dimensions.
+var ErrInvalidInput = parser.ErrInvalidInput
@@ -0,0 +1,153 @@
+package aggregator
+
+import (
+	"math"
+	"sort"
+	"time"
+)
+
+const (
+	// DefaultAnomalyThreshold is the z-score above which a bucket is flagged.
+	DefaultAnomalyThreshold = 3.0
+
+	ewmaAlpha        = 0.3 // weight of the newest bucket in the moving baseline
+	ewmaWarmup       = 3   // buckets used to seed the baseline before flagging
+	minAnomalyPoints = 5   // series shorter than this are not scored
+	minBucketSample  = 3   // requests a bucket needs before its rates are scored
+	maxAnomalies     = 50
+)
+
+// anomalyIntervals are the candidate bucket widths tried, in order, when the
+// caller doesn't pick an interval.
+var anomalyIntervals = []time.Duration{
+	time.Minute, 5 * time.Minute, 15 * time.Minute, time.Hour, 6 * time.Hour, 24 * time.Hour,
+}
+
+type Anomaly struct {
+	Path     string  `json:"path"` // "*" for all traffic
+	Metric   string  `json:"metric"`
+	Start    string  `json:"start"`
+	End      string  `json:"end"`
+	Value    float64 `json:"value"`
+	Expected float64 `json:"expected"`
+	ZScore   float64 `json:"z_score"`
+	Severity string  `json:"severity"`
+}
+
+// AutoInterval picks the smallest candidate interval that keeps the series
+// under 200 buckets, or 0 if no entry has a parseable timestamp.
+func AutoInterval(logs []LogEntry) time.Duration {
+	start, end, ok := TimeRange(logs)
+	if !ok {
+		return 0
+	}
+	span := end.Sub(start)
+	for _, interval := range anomalyIntervals {
+		if span/interval <= 200 {
+			return interval
+		}
+	}
+	return anomalyIntervals[len(anomalyIntervals)-1]
+}
+
+// DetectAnomalies flags upward spikes in traffic, error rate and p95 latency
+// per path and overall. Each bucket is scored against an exponentially
+// weighted moving mean and variance of the buckets before it; flagged
+// buckets are kept out of the baseline. A zero interval is chosen
+// automatically from the time range covered.
+func DetectAnomalies(logs []LogEntry, interval time.Duration, threshold float64) []Anomaly {
+	if threshold <= 0 {
+		threshold = DefaultAnomalyThreshold
+	}
+	if interval <= 0 {
+		if interval = AutoInterval(logs); interval == 0 {
+			return nil
+		}
+	}
+
+	byPath := make(map[string][]LogEntry)
+	for _, log := range logs {
+		byPath[log.Path] = append(byPath[log.Path], log)
+	}
+	if len(byPath) > 1 {
+		byPath["*"] = logs
+	}
+
+	var anomalies []Anomaly
+	for path, entries := range byPath {
+		series, err := BuildTimeSeries(entries, interval)
+		if err != nil || len(series.Buckets) < minAnomalyPoints {
+			continue
+		}
+
+		metrics := []struct {
+			name    string
+			value   func(TimeBucket) float64
+			floor   float64
+			sampled bool
+		}{
+			{"traffic", func(b TimeBucket) float64 { return float64(b.Requests) }, 1, false},
+			{"error_rate", func(b TimeBucket) float64 { return b.ErrorRate }, 1, true},
+			{"latency_p95", func(b TimeBucket) float64 { return float64(b.P95Duration) }, 10, true},
+		}
+		for _, m := range metrics {
+			var mean, variance float64
+			seen := 0
+			for _, b := range series.Buckets {
+				if m.sampled && b.Requests < minBucketSample {
+					continue
+				}
+				x := m.value(b)
+				if seen == 0 {
+					mean = x
+					seen++
+					continue
+				}
+
+				if seen >= ewmaWarmup {
+					// Floor the deviation so a perfectly flat baseline doesn't
+					// turn every small wobble into an infinite z-score.
+					std := math.Max(math.Sqrt(variance), math.Max(m.floor, 0.1*math.Abs(mean)))
+					if z := (x - mean) / std; z >= threshold {
+						start, _ := time.Parse(time.RFC3339, b.Start)
+						anomalies = append(anomalies, Anomaly{
+							Path:     path,
+							Metric:   m.name,
+							Start:    b.Start,
+							End:      start.Add(interval).Format(time.RFC3339),
+							Value:    round2(x),
+							Expected: round2(mean),
+							ZScore:   round2(z),
+							Severity: anomalySeverity(z, threshold),
+						})
+						continue
+					}
+				}
+
+				diff := x - mean
+				incr := ewmaAlpha * diff
+				mean += incr
+				variance = (1 - ewmaAlpha) * (variance + diff*incr)
+				seen++
+			}
+		}
+	}
+
+	sort.Slice(anomalies, func(i, j int) bool {
+		if anomalies[i].ZScore != anomalies[j].ZScore {
+			return anomalies[i].ZScore > anomalies[j].ZScore
+		}
+		return anomalies[i].Start < anomalies[j].Start
+	})
+	if len(anomalies) > maxAnomalies {
+		anomalies = anomalies[:maxAnomalies]
+	}
+	return anomalies
+}
+
+func anomalySeverity(z, threshold float64) string {
+	if z >= 2*threshold {
+		return "high"
+	}
+	return "medium"
+}
@@ -0,0 +1,93 @@
+package aggregator
+
+import (
+	"fmt"
+	"math"
+	"sort"
+)
+
+// DefaultApdexThreshold is the satisfied threshold T (in ms) used when the
+// caller doesn't provide one. Tolerating defaults to 4T, per the Apdex spec.
+const DefaultApdexThreshold int64 = 500
+
+type ApdexScore struct {
+	Path       string  `json:"path,omitempty"`
+	Score      float64 `json:"score"`
+	Satisfied  int     `json:"satisfied"`
+	Tolerating int     `json:"tolerating"`
+	Frustrated int     `json:"frustrated"`
+	Total      int     `json:"total"`
+}
+
+type ApdexReport struct {
+	SatisfiedThreshold  int64        `json:"satisfied_threshold"`
+	ToleratingThreshold int64        `json:"tolerating_threshold"`
+	Overall             ApdexScore   `json:"overall"`
+	Endpoints           []ApdexScore `json:"endpoints"`
+}
+
+// ApdexThresholds resolves the satisfied/tolerating thresholds, applying the
+// defaults and checking that tolerating is above satisfied.
+func ApdexThresholds(satisfied, tolerating int64) (int64, int64, error) {
+	if satisfied <= 0 {
+		satisfied = DefaultApdexThreshold
+	}
+	if tolerating <= 0 {
+		tolerating = 4 * satisfied
+	}
+	if tolerating <= satisfied {
+		return 0, 0, fmt.Errorf("tolerating threshold (%dms) must be greater than satisfied threshold (%dms)", tolerating, satisfied)
+	}
+	return satisfied, tolerating, nil
+}
+
+func (a *ApdexScore) add(log LogEntry, satisfied, tolerating int64) {
+	a.Total++
+	switch {
+	case log.Status >= 500 || log.Duration > tolerating:
+		// Server errors always count as frustrated, regardless of speed.
+		a.Frustrated++
+	case log.Duration > satisfied:
+		a.Tolerating++
+	default:
+		a.Satisfied++
+	}
+}
+
+func (a *ApdexScore) finalize() {
+	if a.Total == 0 {
+		return
+	}
+	score := (float64(a.Satisfied) + float64(a.Tolerating)/2) / float64(a.Total)
+	a.Score = math.Round(score*100) / 100
+}
+
+// ComputeApdex scores every path and the log set as a whole. Thresholds must
+// already be resolved through ApdexThresholds.
+func ComputeApdex(logs []LogEntry, satisfied, tolerating int64) *ApdexReport {
+	report := &ApdexReport{
+		SatisfiedThreshold:  satisfied,
+		ToleratingThreshold: tolerating,
+	}
+
+	byPath := make(map[string]*ApdexScore)
+	for _, log := range logs {
+		score, ok := byPath[log.Path]
+		if !ok {
+			score = &ApdexScore{Path: log.Path}
+			byPath[log.Path] = score
+		}
+		score.add(log, satisfied, tolerating)
+		report.Overall.add(log, satisfied, tolerating)
+	}
+
+	report.Overall.finalize()
+	for _, score := range byPath {
+		score.finalize()
+		report.Endpoints = append(report.Endpoints, *score)
+	}
+	sort.Slice(report.Endpoints, func(i, j int) bool {
+		return report.Endpoints[i].Path < report.Endpoints[j].Path
+	})
+	return report
+}
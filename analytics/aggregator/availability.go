@@ -0,0 +1,295 @@
+package aggregator
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"time"
+
+	"analyticsai/ai-service/analytics/parser"
+)
+
+const (
+	DefaultTimeoutMs           = 30000
+	DefaultDownThreshold       = 0.5
+	defaultAvailabilityBucket  = time.Minute
+	maxDowntimeWindowEndpoints = 5
+)
+
+var timeoutPattern = regexp.MustCompile(`(?i)(\btime[d ]?out\b|\btimeout\b|deadline exceeded)`)
+
+// AvailabilityOptions controls ComputeAvailability.
+type AvailabilityOptions struct {
+	Interval      time.Duration // downtime resolution, defaults to 1m
+	TimeoutMs     int64         // requests at least this slow count as timeouts, defaults to DefaultTimeoutMs
+	DownThreshold float64       // failed share at which a bucket is down, defaults to DefaultDownThreshold
+	Target        float64       // SLA in percent, optional
+}
+
+// AvailabilityStats measures availability by request and by time.
+type AvailabilityStats struct {
+	Requests     int     `json:"requests"`
+	Failed       int     `json:"failed"`
+	ServerErrors int     `json:"server_errors"`
+	Timeouts     int     `json:"timeouts"`
+	Availability float64 `json:"availability"` // percent of requests that succeeded
+
+	// Uptime is the percent of the log time range outside downtime; it is
+	// absent when the logs carry no timestamps.
+	Uptime          *float64 `json:"uptime,omitempty"`
+	DowntimeSeconds float64  `json:"downtime_seconds"`
+	TargetMet       *bool    `json:"target_met,omitempty"`
+}
+
+type EndpointAvailability struct {
+	Path string `json:"path"`
+	AvailabilityStats
+}
+
+type ServiceAvailability struct {
+	Service string `json:"service"`
+	AvailabilityStats
+}
+
+// DowntimeWindow is a run of consecutive down buckets.
+type DowntimeWindow struct {
+	Start     string   `json:"start"`
+	End       string   `json:"end"`
+	Seconds   float64  `json:"duration_seconds"`
+	Requests  int      `json:"requests"`
+	Failed    int      `json:"failed"`
+	Endpoints []string `json:"endpoints"` // endpoints with the most failures in the window
+}
+
+type AvailabilityReport struct {
+	Start         string                 `json:"start,omitempty"`
+	End           string                 `json:"end,omitempty"`
+	Interval      string                 `json:"interval"`
+	TimeoutMs     int64                  `json:"timeout_ms"`
+	DownThreshold float64                `json:"down_threshold"`
+	Target        float64                `json:"target,omitempty"`
+	Overall       AvailabilityStats      `json:"overall"`
+	Endpoints     []EndpointAvailability `json:"endpoints"`
+	Services      []ServiceAvailability  `json:"services,omitempty"` // set when entries name their service
+	Downtime      []DowntimeWindow       `json:"downtime_windows"`
+}
+
+// failureCause classifies a request as a timeout, a server error, or
+// neither. Timeouts are 408, 499 and 504 responses, requests that took at
+// least timeoutMs, and messages that mention one.
+func failureCause(log LogEntry, timeoutMs int64) string {
+	switch {
+	case log.Status == 408 || log.Status == 499 || log.Status == 504,
+		log.Duration >= timeoutMs,
+		timeoutPattern.MatchString(log.Message):
+		return "timeout"
+	case log.Status >= 500:
+		return "server_error"
+	}
+	return ""
+}
+
+type availabilityCounter struct {
+	stats   AvailabilityStats
+	buckets map[int64]*sliCounter // good/total per bucket start
+}
+
+func (a *availabilityCounter) add(cause string, bucket int64, timed bool) {
+	a.stats.Requests++
+	switch cause {
+	case "timeout":
+		a.stats.Timeouts++
+	case "server_error":
+		a.stats.ServerErrors++
+	}
+	if cause != "" {
+		a.stats.Failed++
+	}
+	if !timed {
+		return
+	}
+	c, ok := a.buckets[bucket]
+	if !ok {
+		c = &sliCounter{}
+		a.buckets[bucket] = c
+	}
+	c.total++
+	if cause == "" {
+		c.good++
+	}
+}
+
+func isDown(c *sliCounter, threshold float64) bool {
+	failed := c.total - c.good
+	return failed > 0 && float64(failed)/float64(c.total) >= threshold
+}
+
+// finish fills in the percentages of a. span is the length of the log time
+// range, zero without timestamps.
+func (a *availabilityCounter) finish(opts AvailabilityOptions, span time.Duration) {
+	a.stats.Availability = 100
+	if a.stats.Requests > 0 {
+		a.stats.Availability = round2(float64(a.stats.Requests-a.stats.Failed) / float64(a.stats.Requests) * 100)
+	}
+	measured := a.stats.Availability
+	if span > 0 {
+		down := 0
+		for _, c := range a.buckets {
+			if isDown(c, opts.DownThreshold) {
+				down++
+			}
+		}
+		downtime := time.Duration(down) * opts.Interval
+		a.stats.DowntimeSeconds = downtime.Seconds()
+		uptime := round2((1 - downtime.Seconds()/span.Seconds()) * 100)
+		a.stats.Uptime = &uptime
+		measured = uptime
+	}
+	if opts.Target > 0 {
+		met := measured >= opts.Target
+		a.stats.TargetMet = &met
+	}
+}
+
+// ComputeAvailability measures availability overall and per endpoint. A
+// request fails when it times out or returns 5xx. Over time, the log range
+// is split into buckets of opts.Interval, and a bucket is down when at
+// least opts.DownThreshold of its requests failed; buckets without traffic
+// count as up. Targets are checked against uptime,
+// or against request availability when the logs carry no timestamps.
+func ComputeAvailability(logs []LogEntry, opts AvailabilityOptions) (*AvailabilityReport, error) {
+	if opts.Interval <= 0 {
+		opts.Interval = defaultAvailabilityBucket
+	}
+	if opts.TimeoutMs <= 0 {
+		opts.TimeoutMs = DefaultTimeoutMs
+	}
+	if opts.DownThreshold == 0 {
+		opts.DownThreshold = DefaultDownThreshold
+	}
+	if opts.Interval < time.Second {
+		return nil, fmt.Errorf("%w: interval must be at least 1s", ErrInvalidInput)
+	}
+	if opts.DownThreshold < 0 || opts.DownThreshold > 1 {
+		return nil, fmt.Errorf("%w: down_threshold must be between 0 and 1", ErrInvalidInput)
+	}
+	if opts.Target < 0 || opts.Target >= 100 {
+		return nil, fmt.Errorf("%w: target must be between 0 and 100 (exclusive)", ErrInvalidInput)
+	}
+
+	report := &AvailabilityReport{
+		Interval:      FormatInterval(opts.Interval),
+		TimeoutMs:     opts.TimeoutMs,
+		DownThreshold: opts.DownThreshold,
+		Target:        opts.Target,
+		Endpoints:     []EndpointAvailability{},
+		Downtime:      []DowntimeWindow{},
+	}
+	var span time.Duration
+	start, end, hasTime := TimeRange(logs)
+	if hasTime {
+		report.Start, report.End = start.Format(time.RFC3339), end.Format(time.RFC3339)
+		// The range covers every bucket with traffic, so downtime never
+		// exceeds it.
+		span = bucketStart(end, opts.Interval).Add(opts.Interval).Sub(bucketStart(start, opts.Interval))
+	}
+
+	overall := &availabilityCounter{buckets: make(map[int64]*sliCounter)}
+	byPath := make(map[string]*availabilityCounter)
+	byService := make(map[string]*availabilityCounter)
+	hasServices := HasServices(logs)
+	// failures per bucket and endpoint, to name the endpoints of a window
+	bucketFailures := make(map[int64]map[string]int)
+	for _, log := range logs {
+		cause := failureCause(log, opts.TimeoutMs)
+		t, timed := parser.ParseTimestamp(log.Timestamp)
+		var bucket int64
+		if timed {
+			bucket = bucketStart(t, opts.Interval).Unix()
+		}
+		overall.add(cause, bucket, timed)
+		ep, ok := byPath[log.Path]
+		if !ok {
+			ep = &availabilityCounter{buckets: make(map[int64]*sliCounter)}
+			byPath[log.Path] = ep
+		}
+		ep.add(cause, bucket, timed)
+		if hasServices {
+			service := dimensionValue(log, ServiceDimension)
+			counter, ok := byService[service]
+			if !ok {
+				counter = &availabilityCounter{buckets: make(map[int64]*sliCounter)}
+				byService[service] = counter
+			}
+			counter.add(cause, bucket, timed)
+		}
+		if cause != "" && timed {
+			if bucketFailures[bucket] == nil {
+				bucketFailures[bucket] = make(map[string]int)
+			}
+			bucketFailures[bucket][log.Path]++
+		}
+	}
+
+	overall.finish(opts, span)
+	report.Overall = overall.stats
+	for path, ep := range byPath {
+		ep.finish(opts, span)
+		report.Endpoints = append(report.Endpoints, EndpointAvailability{Path: path, AvailabilityStats: ep.stats})
+	}
+	sort.Slice(report.Endpoints, func(i, j int) bool {
+		a, b := report.Endpoints[i], report.Endpoints[j]
+		if a.Availability != b.Availability {
+			return a.Availability < b.Availability
+		}
+		if a.Requests != b.Requests {
+			return a.Requests > b.Requests
+		}
+		return a.Path < b.Path
+	})
+
+	for service, counter := range byService {
+		counter.finish(opts, span)
+		report.Services = append(report.Services, ServiceAvailability{Service: service, AvailabilityStats: counter.stats})
+	}
+	sort.Slice(report.Services, func(i, j int) bool {
+		a, b := report.Services[i], report.Services[j]
+		if a.Availability != b.Availability {
+			return a.Availability < b.Availability
+		}
+		return a.Service < b.Service
+	})
+
+	var down []int64
+	for bucket, c := range overall.buckets {
+		if isDown(c, opts.DownThreshold) {
+			down = append(down, bucket)
+		}
+	}
+	sort.Slice(down, func(i, j int) bool { return down[i] < down[j] })
+	step := int64(opts.Interval / time.Second)
+	for i := 0; i < len(down); {
+		j := i
+		for j+1 < len(down) && down[j+1]-down[j] == step {
+			j++
+		}
+		window := DowntimeWindow{
+			Start:   time.Unix(down[i], 0).In(start.Location()).Format(time.RFC3339),
+			End:     time.Unix(down[j], 0).In(start.Location()).Add(opts.Interval).Format(time.RFC3339),
+			Seconds: (time.Duration(j-i+1) * opts.Interval).Seconds(),
+		}
+		failures := make(map[string]int)
+		for _, bucket := range down[i : j+1] {
+			c := overall.buckets[bucket]
+			window.Requests += c.total
+			window.Failed += c.total - c.good
+			for path, n := range bucketFailures[bucket] {
+				failures[path] += n
+			}
+		}
+		window.Endpoints = topKeys(failures, maxDowntimeWindowEndpoints)
+		report.Downtime = append(report.Downtime, window)
+		i = j + 1
+	}
+	return report, nil
+}
@@ -0,0 +1,105 @@
+package aggregator
+
+import "fmt"
+
+// RegressionThresholds decide when an endpoint counts as regressed: when
+// its error rate rises by more than ErrorRate percentage points or its p95
+// latency by more than Latency percent (and at least 10ms), even if the
+// other metric improved.
+type RegressionThresholds struct {
+	ErrorRate float64 `json:"error_rate"`
+	Latency   float64 `json:"latency"`
+}
+
+var DefaultRegressionThresholds = RegressionThresholds{ErrorRate: 1, Latency: 10}
+
+// WithDefaults fills unset thresholds from DefaultRegressionThresholds.
+func (t RegressionThresholds) WithDefaults() RegressionThresholds {
+	if t.ErrorRate <= 0 {
+		t.ErrorRate = DefaultRegressionThresholds.ErrorRate
+	}
+	if t.Latency <= 0 {
+		t.Latency = DefaultRegressionThresholds.Latency
+	}
+	return t
+}
+
+// Validate rejects negative thresholds.
+func (t RegressionThresholds) Validate() error {
+	if t.ErrorRate < 0 || t.Latency < 0 {
+		return fmt.Errorf("%w: regression thresholds must not be negative", ErrInvalidInput)
+	}
+	return nil
+}
+
+func (t RegressionThresholds) classify(before, after DimensionStats) string {
+	errorDir := direction(after.ErrorRate-before.ErrorRate, t.ErrorRate)
+	latencyTolerance := float64(before.P95Duration) * t.Latency / 100
+	if latencyTolerance < 10 {
+		latencyTolerance = 10
+	}
+	latencyDir := direction(float64(after.P95Duration-before.P95Duration), latencyTolerance)
+	switch {
+	case errorDir == TrendRegressing || latencyDir == TrendRegressing:
+		return TrendRegressing
+	case errorDir == TrendImproving || latencyDir == TrendImproving:
+		return TrendImproving
+	}
+	return TrendStable
+}
+
+// BaselineComparison compares an analysis with a named baseline analysis.
+type BaselineComparison struct {
+	Baseline           string               `json:"baseline"`
+	BaselineAnalysisID string               `json:"baseline_analysis_id"`
+	Thresholds         RegressionThresholds `json:"thresholds"`
+	ErrorRateChange    float64              `json:"error_rate_change"` // percentage points
+	P95Change          int64                `json:"p95_duration_change"`
+	Regressed          bool                 `json:"regressed"`
+	Regressions        []EndpointDelta      `json:"regressions"` // endpoints that degraded beyond the thresholds
+}
+
+// CompareToBaseline flags the endpoints of current that degraded beyond the
+// thresholds relative to baseline. Only endpoints present in both snapshots
+// (the busiest paths of each) are compared.
+func CompareToBaseline(name, analysisID string, baseline, current *MetricsSnapshot, t RegressionThresholds) *BaselineComparison {
+	t = t.WithDefaults()
+	comparison := &BaselineComparison{
+		Baseline:           name,
+		BaselineAnalysisID: analysisID,
+		Thresholds:         t,
+		ErrorRateChange:    round2(current.ErrorRate - baseline.ErrorRate),
+		P95Change:          current.P95Duration - baseline.P95Duration,
+		Regressions:        []EndpointDelta{},
+	}
+	overall := func(m *MetricsSnapshot) DimensionStats {
+		return DimensionStats{ErrorRate: m.ErrorRate, P95Duration: m.P95Duration}
+	}
+	comparison.Regressed = t.classify(overall(baseline), overall(current)) == TrendRegressing
+
+	before := make(map[string]DimensionStats, len(baseline.Endpoints))
+	for _, e := range baseline.Endpoints {
+		before[e.Value] = e
+	}
+	for _, a := range current.Endpoints {
+		b, ok := before[a.Value]
+		if !ok || t.classify(b, a) != TrendRegressing {
+			continue
+		}
+		a := a
+		comparison.Regressions = append(comparison.Regressions, EndpointDelta{
+			Path:            a.Value,
+			Before:          &b,
+			After:           &a,
+			TrafficChange:   percentChange(b.Requests, a.Requests),
+			ErrorRateChange: round2(a.ErrorRate - b.ErrorRate),
+			AvgChange:       a.AvgDuration - b.AvgDuration,
+			P95Change:       a.P95Duration - b.P95Duration,
+			Status:          TrendRegressing,
+		})
+	}
+	if len(comparison.Regressions) > 0 {
+		comparison.Regressed = true
+	}
+	return comparison
+}
@@ -0,0 +1,190 @@
+package aggregator
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"analyticsai/ai-service/analytics/parser"
+)
+
+// Traffic classes assigned by ClassifyTraffic.
+const (
+	TrafficHuman   = "human"
+	TrafficBot     = "bot"
+	TrafficCrawler = "crawler"
+	TrafficUnknown = "unknown"
+)
+
+// botVelocity is the per-minute request rate from one client above which
+// its traffic is treated as automated regardless of user agent.
+const botVelocity = 60
+
+// knownCrawlers maps user-agent fragments to crawler names.
+var knownCrawlers = []struct{ fragment, name string }{
+	{"googlebot", "Googlebot"}, {"bingbot", "Bingbot"}, {"yandex", "YandexBot"},
+	{"baiduspider", "Baiduspider"}, {"duckduckbot", "DuckDuckBot"}, {"slurp", "Yahoo Slurp"},
+	{"applebot", "Applebot"}, {"facebookexternalhit", "Facebook"}, {"twitterbot", "Twitterbot"},
+	{"linkedinbot", "LinkedInBot"}, {"ahrefsbot", "AhrefsBot"}, {"semrushbot", "SemrushBot"},
+	{"mj12bot", "MJ12bot"}, {"petalbot", "PetalBot"}, {"gptbot", "GPTBot"}, {"ccbot", "CCBot"},
+}
+
+var genericBotFragments = []string{"bot", "crawler", "spider", "scraper", "headless", "phantomjs"}
+
+type PathTraffic struct {
+	Path        string  `json:"path"`
+	Requests    int     `json:"requests"`
+	BotRequests int     `json:"bot_requests"` // bots and crawlers
+	BotShare    float64 `json:"bot_share"`    // percent
+}
+
+type TrafficClassification struct {
+	Counts       map[string]int     `json:"counts"`
+	Shares       map[string]float64 `json:"shares"` // percent
+	Crawlers     map[string]int     `json:"crawlers"`
+	TopPaths     []PathTraffic      `json:"top_paths"`
+	PopularPages []PathTraffic      `json:"popular_pages,omitempty"`
+}
+
+// classifyAgent classifies a request by user agent alone, returning the
+// class and, for known crawlers, the crawler name.
+func classifyAgent(ua string) (string, string) {
+	lower := strings.ToLower(ua)
+	for _, c := range knownCrawlers {
+		if strings.Contains(lower, c.fragment) {
+			return TrafficCrawler, c.name
+		}
+	}
+	if matchesAny(lower, scannerAgents) != "" || matchesAny(lower, scriptAgents) != "" ||
+		matchesAny(lower, genericBotFragments) != "" {
+		return TrafficBot, ""
+	}
+	return TrafficHuman, ""
+}
+
+// ClassifyEntries labels each entry as human, bot, crawler or unknown using
+// its user agent and, for clients exceeding botVelocity requests per
+// minute, its request pattern. The result is parallel to logs; crawler
+// names are returned alongside.
+func ClassifyEntries(logs []LogEntry) ([]string, []string) {
+	perMinute := make(map[string]int)
+	for _, log := range logs {
+		if ip := ClientIP(log); ip != "" {
+			if t, ok := parser.ParseTimestamp(log.Timestamp); ok {
+				perMinute[fmt.Sprintf("%s|%d", ip, t.Truncate(time.Minute).Unix())]++
+			}
+		}
+	}
+	fast := make(map[string]bool)
+	for key, n := range perMinute {
+		if n > botVelocity {
+			fast[key[:strings.LastIndexByte(key, '|')]] = true
+		}
+	}
+
+	classes := make([]string, len(logs))
+	names := make([]string, len(logs))
+	for i, log := range logs {
+		ua, ip := UserAgent(log), ClientIP(log)
+		switch {
+		case ua != "":
+			classes[i], names[i] = classifyAgent(ua)
+			if classes[i] == TrafficHuman && fast[ip] {
+				classes[i] = TrafficBot
+			}
+		case ip != "":
+			// A client that sends no user agent at all is not a browser.
+			classes[i] = TrafficBot
+		default:
+			classes[i] = TrafficUnknown
+		}
+	}
+	return classes, names
+}
+
+// IsAutomated reports whether a class from ClassifyEntries is bot or
+// crawler traffic.
+func IsAutomated(class string) bool {
+	return class == TrafficBot || class == TrafficCrawler
+}
+
+// ClassifyTraffic summarizes human, bot and crawler traffic overall and for
+// the busiest paths.
+func ClassifyTraffic(logs []LogEntry) *TrafficClassification {
+	classes, names := ClassifyEntries(logs)
+	return SummarizeTraffic(logs, classes, names)
+}
+
+// SummarizeTraffic is ClassifyTraffic for entries already classified by
+// ClassifyEntries.
+func SummarizeTraffic(logs []LogEntry, classes, names []string) *TrafficClassification {
+	tc := &TrafficClassification{
+		Counts:   map[string]int{TrafficHuman: 0, TrafficBot: 0, TrafficCrawler: 0, TrafficUnknown: 0},
+		Shares:   make(map[string]float64),
+		Crawlers: make(map[string]int),
+	}
+
+	byPath := make(map[string]*PathTraffic)
+	for i, log := range logs {
+		tc.Counts[classes[i]]++
+		if names[i] != "" {
+			tc.Crawlers[names[i]]++
+		}
+		p, ok := byPath[log.Path]
+		if !ok {
+			p = &PathTraffic{Path: log.Path}
+			byPath[log.Path] = p
+		}
+		p.Requests++
+		if IsAutomated(classes[i]) {
+			p.BotRequests++
+		}
+	}
+	for class, n := range tc.Counts {
+		if len(logs) > 0 {
+			tc.Shares[class] = round2(float64(n) / float64(len(logs)) * 100)
+		}
+	}
+
+	for _, p := range byPath {
+		p.BotShare = round2(float64(p.BotRequests) / float64(p.Requests) * 100)
+		tc.TopPaths = append(tc.TopPaths, *p)
+	}
+	sort.Slice(tc.TopPaths, func(i, j int) bool {
+		if tc.TopPaths[i].Requests != tc.TopPaths[j].Requests {
+			return tc.TopPaths[i].Requests > tc.TopPaths[j].Requests
+		}
+		return tc.TopPaths[i].Path < tc.TopPaths[j].Path
+	})
+	if len(tc.TopPaths) > 10 {
+		tc.TopPaths = tc.TopPaths[:10]
+	}
+	return tc
+}
+
+// BotShareFor looks up bot traffic for the given paths, e.g. the popular
+// pages named by the model. Paths absent from the logs are skipped.
+func BotShareFor(logs []LogEntry, classes []string, paths []string) []PathTraffic {
+	byPath := make(map[string]*PathTraffic)
+	for i, log := range logs {
+		p, ok := byPath[log.Path]
+		if !ok {
+			p = &PathTraffic{Path: log.Path}
+			byPath[log.Path] = p
+		}
+		p.Requests++
+		if IsAutomated(classes[i]) {
+			p.BotRequests++
+		}
+	}
+
+	out := []PathTraffic{}
+	for _, path := range paths {
+		if p, ok := byPath[path]; ok {
+			p.BotShare = round2(float64(p.BotRequests) / float64(p.Requests) * 100)
+			out = append(out, *p)
+		}
+	}
+	return out
+}
@@ -0,0 +1,299 @@
+package aggregator
+
+import (
+	"math"
+	"sort"
+	"strconv"
+	"time"
+
+	"analyticsai/ai-service/analytics/parser"
+)
+
+const (
+	DefaultCapacityLatencyMs  = 1000 // p95 latency at which a service counts as saturated
+	DefaultTargetUtilization  = 0.7  // share of the saturation throughput to plan for
+	minCapacityBucketRequests = 5    // buckets with less traffic are left out of the fits
+	minCapacityBuckets        = 5
+	minLoadLatencyCorrelation = 0.3
+	capacityHorizonDays       = 7 // a trend reaching saturation sooner calls for scaling out
+)
+
+// Capacity actions.
+const (
+	CapacityScaleOut = "scale_out"
+	CapacityScaleIn  = "scale_in"
+	CapacityOK       = "ok"
+	CapacityUnknown  = "unknown" // no load-latency relationship to extrapolate from
+)
+
+// instanceKeys are the metadata fields that identify the instance serving
+// a request. Distinct values per bucket count the instances running.
+var instanceKeys = []string{"instance", "instance_id", "pod", "host", "hostname"}
+
+// CapacityOptions controls ComputeCapacity.
+type CapacityOptions struct {
+	Interval          time.Duration // bucket width, chosen automatically when zero
+	GroupBy           GroupBy       // defaults to metadata.service when entries carry it
+	LatencyTargetMs   int64         // defaults to DefaultCapacityLatencyMs
+	TargetUtilization float64       // defaults to DefaultTargetUtilization
+	Instances         int           // instance count when the logs don't record one
+}
+
+// ServiceCapacity is the estimated capacity of one service.
+type ServiceCapacity struct {
+	Service   string  `json:"service"`
+	Buckets   int     `json:"buckets"` // buckets with enough traffic to fit
+	PeakRPS   float64 `json:"peak_rps"`
+	AvgRPS    float64 `json:"avg_rps"`
+	PeakP95   int64   `json:"peak_p95_ms"` // p95 latency in the busiest bucket
+	MaxP95    int64   `json:"max_p95_ms"`
+	Instances int     `json:"instances,omitempty"` // in the busiest bucket
+
+	// LatencySlope is how much p95 latency grows per request per second
+	// (per instance when instances are known), from a least-squares fit;
+	// Correlation is the fit's Pearson coefficient.
+	LatencySlope float64 `json:"latency_ms_per_rps"`
+	Correlation  float64 `json:"correlation"`
+
+	SaturationRPS            *float64 `json:"saturation_rps,omitempty"`
+	SaturationRPSPerInstance *float64 `json:"saturation_rps_per_instance,omitempty"`
+	Utilization              *float64 `json:"utilization_percent,omitempty"` // peak as a share of saturation
+	Headroom                 *float64 `json:"headroom_percent,omitempty"`    // growth the peak can take before saturating
+
+	TrendRPSPerDay       float64  `json:"trend_rps_per_day"`
+	DaysToSaturation     *float64 `json:"days_to_saturation,omitempty"`
+	RecommendedInstances int      `json:"recommended_instances,omitempty"`
+	Action               string   `json:"action"`
+}
+
+// CapacityReport estimates headroom per service from how latency responds
+// to load.
+type CapacityReport struct {
+	Interval          string            `json:"interval,omitempty"`
+	GroupBy           string            `json:"group_by,omitempty"`
+	LatencyTargetMs   int64             `json:"latency_target_ms"`
+	TargetUtilization float64           `json:"target_utilization"`
+	Services          []ServiceCapacity `json:"services"`
+	Summary           string            `json:"summary"`
+	Recommendations   []string          `json:"recommendations"`
+}
+
+type capacityBucket struct {
+	start     time.Time
+	durations []int64
+	instances map[string]bool
+	count     int // largest instance_count metadata value seen
+}
+
+// bucketInstances returns the instances serving a bucket: the recorded
+// instance_count, the distinct instance IDs, or fallback.
+func (b *capacityBucket) bucketInstances(fallback int) int {
+	if b.count > 0 {
+		return b.count
+	}
+	if len(b.instances) > 0 {
+		return len(b.instances)
+	}
+	return fallback
+}
+
+// linearFit returns the least-squares line y = a + b*x.
+func linearFit(x, y []float64) (a, b float64) {
+	n := float64(len(x))
+	var sumX, sumY, sumXY, sumXX float64
+	for i := range x {
+		sumX += x[i]
+		sumY += y[i]
+		sumXY += x[i] * y[i]
+		sumXX += x[i] * x[i]
+	}
+	denominator := n*sumXX - sumX*sumX
+	if n == 0 || denominator == 0 {
+		return sumY / math.Max(n, 1), 0
+	}
+	b = (n*sumXY - sumX*sumY) / denominator
+	return (sumY - b*sumX) / n, b
+}
+
+// ComputeCapacity buckets each service's traffic, fits p95 latency against
+// throughput, and extrapolates the throughput at which p95 reaches the
+// latency target. Entries without a parseable timestamp are ignored.
+func ComputeCapacity(logs []LogEntry, opts CapacityOptions) *CapacityReport {
+	if opts.LatencyTargetMs <= 0 {
+		opts.LatencyTargetMs = DefaultCapacityLatencyMs
+	}
+	if opts.TargetUtilization <= 0 || opts.TargetUtilization > 1 {
+		opts.TargetUtilization = DefaultTargetUtilization
+	}
+	if opts.Interval <= 0 {
+		opts.Interval = AutoInterval(logs)
+	}
+	groupBy := opts.GroupBy
+	if groupBy == nil {
+		for _, log := range logs {
+			if FieldValue(log, ServiceDimension) != "" {
+				groupBy = GroupBy{ServiceDimension}
+				break
+			}
+		}
+	}
+
+	report := &CapacityReport{
+		LatencyTargetMs:   opts.LatencyTargetMs,
+		TargetUtilization: opts.TargetUtilization,
+		Services:          []ServiceCapacity{},
+		Recommendations:   []string{},
+	}
+	if groupBy != nil {
+		report.GroupBy = groupBy.String()
+	}
+	if opts.Interval <= 0 {
+		return report
+	}
+	report.Interval = FormatInterval(opts.Interval)
+
+	byService := make(map[string]map[int64]*capacityBucket)
+	for _, log := range logs {
+		t, ok := parser.ParseTimestamp(log.Timestamp)
+		if !ok {
+			continue
+		}
+		service := "all"
+		if groupBy != nil {
+			service = groupBy.Key(log)
+		}
+		buckets, ok := byService[service]
+		if !ok {
+			buckets = make(map[int64]*capacityBucket)
+			byService[service] = buckets
+		}
+		start := bucketStart(t, opts.Interval)
+		b, ok := buckets[start.Unix()]
+		if !ok {
+			b = &capacityBucket{start: start, instances: make(map[string]bool)}
+			buckets[start.Unix()] = b
+		}
+		b.durations = append(b.durations, log.Duration)
+		if n, err := strconv.Atoi(log.Metadata["instance_count"]); err == nil && n > b.count {
+			b.count = n
+		}
+		for _, key := range instanceKeys {
+			if id := log.Metadata[key]; id != "" {
+				b.instances[id] = true
+				break
+			}
+		}
+	}
+
+	for service, buckets := range byService {
+		report.Services = append(report.Services, serviceCapacity(service, buckets, opts))
+	}
+	sort.Slice(report.Services, func(i, j int) bool {
+		if report.Services[i].PeakRPS != report.Services[j].PeakRPS {
+			return report.Services[i].PeakRPS > report.Services[j].PeakRPS
+		}
+		return report.Services[i].Service < report.Services[j].Service
+	})
+	return report
+}
+
+func serviceCapacity(service string, buckets map[int64]*capacityBucket, opts CapacityOptions) ServiceCapacity {
+	seconds := opts.Interval.Seconds()
+	sorted := make([]*capacityBucket, 0, len(buckets))
+	for _, b := range buckets {
+		if len(b.durations) >= minCapacityBucketRequests {
+			sorted = append(sorted, b)
+		}
+	}
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i].start.Before(sorted[j].start) })
+
+	sc := ServiceCapacity{Service: service, Buckets: len(sorted), Action: CapacityUnknown}
+	if len(sorted) == 0 {
+		return sc
+	}
+
+	var load, p95s, days, rates []float64
+	perInstance := true
+	var peak *capacityBucket
+	var totalRPS float64
+	for _, b := range sorted {
+		SortDurations(b.durations)
+		p95 := Percentile(b.durations, 95)
+		rps := float64(len(b.durations)) / seconds
+		instances := b.bucketInstances(opts.Instances)
+		if instances == 0 {
+			perInstance = false
+		}
+		if peak == nil || len(b.durations) > len(peak.durations) {
+			peak, sc.PeakRPS, sc.PeakP95, sc.Instances = b, rps, p95, instances
+		}
+		if p95 > sc.MaxP95 {
+			sc.MaxP95 = p95
+		}
+		totalRPS += rps
+		load = append(load, rps)
+		rates = append(rates, rps)
+		p95s = append(p95s, float64(p95))
+		days = append(days, b.start.Sub(sorted[0].start).Hours()/24)
+	}
+	if perInstance {
+		for i, b := range sorted {
+			load[i] /= float64(b.bucketInstances(opts.Instances))
+		}
+	} else {
+		sc.Instances = 0
+	}
+	sc.AvgRPS = round2(totalRPS / float64(len(sorted)))
+	if _, trend := linearFit(days, rates); days[len(days)-1] > 0 {
+		sc.TrendRPSPerDay = round2(trend)
+	}
+
+	intercept, slope := linearFit(load, p95s)
+	sc.LatencySlope = round2(slope)
+	sc.Correlation = round2(pearson(load, p95s, 0))
+	overTarget := sc.PeakP95 > opts.LatencyTargetMs
+	if len(sorted) < minCapacityBuckets || slope <= 0 || sc.Correlation < minLoadLatencyCorrelation {
+		if overTarget {
+			sc.Action = CapacityScaleOut
+		}
+		sc.PeakRPS = round2(sc.PeakRPS)
+		return sc
+	}
+
+	saturation := (float64(opts.LatencyTargetMs) - intercept) / slope
+	if saturation < 0 {
+		saturation = 0
+	}
+	if perInstance {
+		perInstanceRPS := round2(saturation)
+		sc.SaturationRPSPerInstance = &perInstanceRPS
+		saturation *= float64(sc.Instances)
+		if perInstanceRPS > 0 {
+			planned := perInstanceRPS * opts.TargetUtilization
+			sc.RecommendedInstances = int(math.Max(1, math.Ceil(sc.PeakRPS/planned)))
+		}
+	}
+	saturationRPS := round2(saturation)
+	sc.SaturationRPS = &saturationRPS
+	if saturation > 0 {
+		utilization := round2(sc.PeakRPS / saturation * 100)
+		headroom := round2((saturation/sc.PeakRPS - 1) * 100)
+		sc.Utilization, sc.Headroom = &utilization, &headroom
+		if sc.TrendRPSPerDay > 0 && saturation > sc.PeakRPS {
+			daysLeft := round2((saturation - sc.PeakRPS) / sc.TrendRPSPerDay)
+			sc.DaysToSaturation = &daysLeft
+		}
+	}
+
+	switch {
+	case overTarget || saturation == 0 || sc.PeakRPS > saturation*opts.TargetUtilization ||
+		sc.DaysToSaturation != nil && *sc.DaysToSaturation < capacityHorizonDays:
+		sc.Action = CapacityScaleOut
+	case sc.PeakRPS < saturation*opts.TargetUtilization/2 && (!perInstance || sc.RecommendedInstances < sc.Instances):
+		sc.Action = CapacityScaleIn
+	default:
+		sc.Action = CapacityOK
+	}
+	sc.PeakRPS = round2(sc.PeakRPS)
+	return sc
+}
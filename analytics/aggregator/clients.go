@@ -0,0 +1,212 @@
+package aggregator
+
+import (
+	"bytes"
+	"fmt"
+	"math"
+	"net"
+	"sort"
+	"time"
+
+	"analyticsai/ai-service/analytics/parser"
+)
+
+const (
+	// BlockScore and RateLimitScore are the threat scores at which a client
+	// is recommended for blocking or rate limiting.
+	BlockScore     = 70.0
+	RateLimitScore = 40.0
+
+	// rarePathShare is the share of overall traffic below which a path
+	// counts as rarely requested.
+	rarePathShare = 0.01
+
+	cloudArmorRangesPerRule = 10 // Cloud Armor's limit on srcIpRanges per rule
+	cloudArmorBasePriority  = 1000
+)
+
+type ClientScore struct {
+	IP             string   `json:"ip"`
+	Score          float64  `json:"score"`
+	Requests       int      `json:"requests"`
+	ErrorRatio     float64  `json:"error_ratio"`
+	RarePathRatio  float64  `json:"rare_path_ratio"`
+	PeakPerMinute  int      `json:"peak_requests_per_minute"`
+	ThreatTypes    []string `json:"threat_types,omitempty"`
+	Recommendation string   `json:"recommendation"` // block, rate_limit or none
+}
+
+type CloudArmorRule struct {
+	Priority    int                    `json:"priority"`
+	Action      string                 `json:"action"`
+	Description string                 `json:"description"`
+	Match       map[string]interface{} `json:"match"`
+}
+
+// ScoreClients rates every client IP found in Metadata from 0 to 100:
+// up to 40 points for its error ratio, 30 for the share of its distinct
+// paths that are rarely requested by anyone (probing), and 30 for request
+// velocity relative to the median client. Clients matched by the threat
+// detectors get an extra 20 points for high or critical findings.
+func ScoreClients(logs []LogEntry) []ClientScore {
+	type clientData struct {
+		requests, errors int
+		paths            map[string]bool
+		perMinute        map[int64]int
+	}
+
+	pathCounts := make(map[string]int)
+	clients := make(map[string]*clientData)
+	for _, log := range logs {
+		pathCounts[log.Path]++
+		ip := ClientIP(log)
+		if ip == "" {
+			continue
+		}
+		c, ok := clients[ip]
+		if !ok {
+			c = &clientData{paths: make(map[string]bool), perMinute: make(map[int64]int)}
+			clients[ip] = c
+		}
+		c.requests++
+		c.paths[log.Path] = true
+		if log.Status >= 400 {
+			c.errors++
+		}
+		if t, ok := parser.ParseTimestamp(log.Timestamp); ok {
+			c.perMinute[t.Truncate(time.Minute).Unix()]++
+		}
+	}
+	if len(clients) == 0 {
+		return []ClientScore{}
+	}
+
+	threatTypes := make(map[string]map[string]bool)
+	for _, threat := range DetectThreats(logs, 0) {
+		if threat.ClientIP == "" || severityRank[threat.Severity] < severityRank["high"] {
+			continue
+		}
+		if threatTypes[threat.ClientIP] == nil {
+			threatTypes[threat.ClientIP] = make(map[string]bool)
+		}
+		threatTypes[threat.ClientIP][threat.Type] = true
+	}
+
+	peaks := make(map[string]int, len(clients))
+	var allPeaks []int64
+	for ip, c := range clients {
+		for _, n := range c.perMinute {
+			if n > peaks[ip] {
+				peaks[ip] = n
+			}
+		}
+		allPeaks = append(allPeaks, int64(peaks[ip]))
+	}
+	SortDurations(allPeaks)
+	medianPeak := math.Max(1, float64(Percentile(allPeaks, 50)))
+
+	rareThreshold := rarePathShare * float64(len(logs))
+	scores := make([]ClientScore, 0, len(clients))
+	for ip, c := range clients {
+		rare := 0
+		for path := range c.paths {
+			if float64(pathCounts[path]) <= math.Max(rareThreshold, 1) {
+				rare++
+			}
+		}
+
+		score := ClientScore{
+			IP:            ip,
+			Requests:      c.requests,
+			ErrorRatio:    round2(float64(c.errors) / float64(c.requests)),
+			RarePathRatio: round2(float64(rare) / float64(len(c.paths))),
+			PeakPerMinute: peaks[ip],
+		}
+
+		velocity := 0.0
+		if ratio := float64(peaks[ip]) / medianPeak; ratio > 1 {
+			// 10x the median client's peak earns the full velocity score.
+			velocity = math.Min(1, math.Log10(ratio))
+		}
+		total := 40*score.ErrorRatio + 30*score.RarePathRatio + 30*velocity
+		for kind := range threatTypes[ip] {
+			score.ThreatTypes = append(score.ThreatTypes, kind)
+		}
+		sort.Strings(score.ThreatTypes)
+		if len(score.ThreatTypes) > 0 {
+			total += 20
+		}
+		score.Score = round2(math.Min(100, total))
+
+		switch {
+		case score.Score >= BlockScore:
+			score.Recommendation = "block"
+		case score.Score >= RateLimitScore:
+			score.Recommendation = "rate_limit"
+		default:
+			score.Recommendation = "none"
+		}
+		scores = append(scores, score)
+	}
+
+	sort.Slice(scores, func(i, j int) bool {
+		if scores[i].Score != scores[j].Score {
+			return scores[i].Score > scores[j].Score
+		}
+		return scores[i].IP < scores[j].IP
+	})
+	return scores
+}
+
+// blockedIPs returns the valid IPs of clients scoring at least minScore.
+func blockedIPs(scores []ClientScore, minScore float64) []string {
+	var ips []string
+	for _, s := range scores {
+		if s.Score >= minScore && net.ParseIP(s.IP) != nil {
+			ips = append(ips, s.IP)
+		}
+	}
+	return ips
+}
+
+// NginxDenyList renders clients scoring at least minScore as nginx deny
+// directives, suitable for an include file.
+func NginxDenyList(scores []ClientScore, minScore float64) []byte {
+	var buf bytes.Buffer
+	buf.WriteString(fmt.Sprintf("# Generated deny list: clients with threat score >= %.0f\n", minScore))
+	for _, ip := range blockedIPs(scores, minScore) {
+		buf.WriteString(fmt.Sprintf("deny %s;\n", ip))
+	}
+	return buf.Bytes()
+}
+
+// CloudArmorRules renders clients scoring at least minScore as Cloud Armor
+// security policy deny rules.
+func CloudArmorRules(scores []ClientScore, minScore float64) []CloudArmorRule {
+	ips := blockedIPs(scores, minScore)
+	rules := []CloudArmorRule{}
+	for i := 0; i < len(ips); i += cloudArmorRangesPerRule {
+		end := i + cloudArmorRangesPerRule
+		if end > len(ips) {
+			end = len(ips)
+		}
+		var ranges []string
+		for _, ip := range ips[i:end] {
+			if net.ParseIP(ip).To4() != nil {
+				ranges = append(ranges, ip+"/32")
+			} else {
+				ranges = append(ranges, ip+"/128")
+			}
+		}
+		rules = append(rules, CloudArmorRule{
+			Priority:    cloudArmorBasePriority + len(rules),
+			Action:      "deny(403)",
+			Description: fmt.Sprintf("Clients with threat score >= %.0f", minScore),
+			Match: map[string]interface{}{
+				"versionedExpr": "SRC_IPS_V1",
+				"config":        map[string]interface{}{"srcIpRanges": ranges},
+			},
+		})
+	}
+	return rules
+}
@@ -0,0 +1,113 @@
+package aggregator
+
+import "sort"
+
+// Endpoint statuses in a comparison, in addition to the trend directions.
+const (
+	EndpointAdded   = "added"
+	EndpointRemoved = "removed"
+)
+
+type CompareRequest struct {
+	Before []LogEntry `json:"before"`
+	After  []LogEntry `json:"after"`
+}
+
+// EndpointDelta compares one path between the two log sets. Before or
+// After is nil when the path only appears in the other set.
+type EndpointDelta struct {
+	Path            string          `json:"path"`
+	Before          *DimensionStats `json:"before,omitempty"`
+	After           *DimensionStats `json:"after,omitempty"`
+	TrafficChange   float64         `json:"traffic_change"`    // percent
+	ErrorRateChange float64         `json:"error_rate_change"` // percentage points
+	AvgChange       int64           `json:"avg_duration_change"`
+	P95Change       int64           `json:"p95_duration_change"`
+	Status          string          `json:"status"` // improving, regressing, stable, added or removed
+}
+
+type ComparisonReport struct {
+	Before      *MetricsSnapshot `json:"before"`
+	After       *MetricsSnapshot `json:"after"`
+	Endpoints   []EndpointDelta  `json:"endpoints"`
+	Regressions int              `json:"regressions"`
+	Verdict     string           `json:"verdict"`
+	Explanation string           `json:"explanation"`
+	Concerns    []string         `json:"concerns"`
+}
+
+// percentChange returns the change from before to after in percent of
+// before, or 0 if before is 0.
+func percentChange(before, after int) float64 {
+	if before == 0 {
+		return 0
+	}
+	return round2(float64(after-before) / float64(before) * 100)
+}
+
+// CompareLogs computes per-endpoint deltas between two log sets, ordered
+// with regressions first, then by traffic in the after set.
+func CompareLogs(before, after []LogEntry) *ComparisonReport {
+	report := &ComparisonReport{
+		Before:    Snapshot(before, 0),
+		After:     Snapshot(after, 0),
+		Endpoints: []EndpointDelta{},
+		Concerns:  []string{},
+	}
+	// The snapshots only keep the busiest paths; compare them all.
+	report.Before.Endpoints, report.After.Endpoints = nil, nil
+
+	beforeStats := make(map[string]DimensionStats)
+	for _, s := range GroupStats(before, nil) {
+		beforeStats[s.Value] = s
+	}
+	seen := make(map[string]bool)
+	for _, a := range GroupStats(after, nil) {
+		a := a
+		seen[a.Value] = true
+		delta := EndpointDelta{Path: a.Value, After: &a, Status: EndpointAdded}
+		if b, ok := beforeStats[a.Value]; ok {
+			delta.Before = &b
+			delta.TrafficChange = percentChange(b.Requests, a.Requests)
+			delta.ErrorRateChange = round2(a.ErrorRate - b.ErrorRate)
+			delta.AvgChange = a.AvgDuration - b.AvgDuration
+			delta.P95Change = a.P95Duration - b.P95Duration
+			delta.Status = endpointDirection(b, a)
+		}
+		report.Endpoints = append(report.Endpoints, delta)
+	}
+	for path, b := range beforeStats {
+		if !seen[path] {
+			b := b
+			report.Endpoints = append(report.Endpoints, EndpointDelta{
+				Path:          path,
+				Before:        &b,
+				TrafficChange: -100,
+				Status:        EndpointRemoved,
+			})
+		}
+	}
+
+	requests := func(d EndpointDelta) int {
+		if d.After != nil {
+			return d.After.Requests
+		}
+		return 0
+	}
+	sort.SliceStable(report.Endpoints, func(i, j int) bool {
+		a, b := report.Endpoints[i], report.Endpoints[j]
+		if (a.Status == TrendRegressing) != (b.Status == TrendRegressing) {
+			return a.Status == TrendRegressing
+		}
+		if requests(a) != requests(b) {
+			return requests(a) > requests(b)
+		}
+		return a.Path < b.Path
+	})
+	for _, d := range report.Endpoints {
+		if d.Status == TrendRegressing {
+			report.Regressions++
+		}
+	}
+	return report
+}
@@ -0,0 +1,99 @@
+package aggregator
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"analyticsai/ai-service/analytics/parser"
+)
+
+// DedupMode selects how duplicate log entries are detected.
+type DedupMode string
+
+const (
+	DedupOff   DedupMode = "off"
+	DedupExact DedupMode = "exact" // identical timestamp, path and message
+	DedupFuzzy DedupMode = "fuzzy" // same path, status and masked message within a time window
+)
+
+// DefaultDedupWindow is how close in time fuzzy duplicates must be.
+const DefaultDedupWindow = time.Second
+
+// repeatCountKey is the Metadata key recording how many entries a kept
+// entry stands for after deduplication.
+const repeatCountKey = "repeat_count"
+
+// Deduplicate removes duplicate entries, keeping the first of each set and
+// recording the set size in its "repeat_count" metadata. Exact mode drops
+// entries with the same timestamp, path and message, as produced by shippers
+// retransmitting a batch. Fuzzy mode also collapses entries whose messages
+// differ only in IDs, numbers and quoted values, for the same path and
+// status, when they fall within window of the first one. It returns the
+// kept entries and the number removed.
+func Deduplicate(logs []LogEntry, mode DedupMode, window time.Duration) ([]LogEntry, int, error) {
+	switch mode {
+	case "", DedupOff:
+		return logs, 0, nil
+	case DedupExact, DedupFuzzy:
+	default:
+		return nil, 0, fmt.Errorf("%w: unknown dedup mode %q", ErrInvalidInput, mode)
+	}
+	if window <= 0 {
+		window = DefaultDedupWindow
+	}
+
+	type group struct {
+		index int // into kept
+		first time.Time
+	}
+	groups := make(map[string]*group)
+	counts := make(map[int]int)
+	kept := make([]LogEntry, 0, len(logs))
+
+	for _, log := range logs {
+		var key string
+		t, timed := parser.ParseTimestamp(log.Timestamp)
+		if mode == DedupExact {
+			key = log.Timestamp + "\x00" + log.Path + "\x00" + log.Message
+		} else {
+			key = log.Path + "\x00" + strconv.Itoa(log.Status) + "\x00" + strings.Join(MessageTokens(log.Message), " ")
+			if !timed {
+				key += "\x00" + log.Timestamp
+			}
+		}
+
+		if g, ok := groups[key]; ok {
+			// Untimed fuzzy keys include the raw timestamp, so they only
+			// match entries logged at the same instant.
+			duplicate := mode == DedupExact || !timed
+			if !duplicate {
+				d := t.Sub(g.first)
+				duplicate = d >= 0 && d <= window
+			}
+			if duplicate {
+				counts[g.index]++
+				continue
+			}
+		}
+
+		groups[key] = &group{index: len(kept), first: t}
+		counts[len(kept)] = 1
+		kept = append(kept, log)
+	}
+
+	for i, n := range counts {
+		if n < 2 {
+			continue
+		}
+		// Copy the metadata so entries sharing a map aren't all annotated.
+		metadata := make(map[string]string, len(kept[i].Metadata)+1)
+		for k, v := range kept[i].Metadata {
+			metadata[k] = v
+		}
+		metadata[repeatCountKey] = strconv.Itoa(n)
+		kept[i].Metadata = metadata
+	}
+	return kept, len(logs) - len(kept), nil
+}
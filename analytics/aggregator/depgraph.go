@@ -0,0 +1,413 @@
+package aggregator
+
+import (
+	"bytes"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"analyticsai/ai-service/analytics/parser"
+)
+
+const (
+	maxGraphNodes    = 200
+	maxGraphHotspots = 5
+	hotspotErrorRate = 1 // percent of errors that makes a depended-on node a hotspot
+)
+
+// Dependency graph node kinds.
+const (
+	NodeService = "service" // entries name their service in metadata.service
+	NodePath    = "path"    // otherwise, the first segment of the path
+)
+
+// Sources an edge of a dependency graph is inferred from.
+const (
+	EdgeMetadata         = "metadata"          // upstream/downstream metadata fields
+	EdgePath             = "path"              // a path segment names another service
+	EdgeErrorCorrelation = "error_correlation" // the dependency's errors lead the caller's
+)
+
+// Metadata keys naming the caller and the callee of the request an entry
+// logs, besides its own service.
+var (
+	upstreamKeys   = []string{"upstream", "upstream_service", "caller"}
+	downstreamKeys = []string{"downstream", "downstream_service", "callee", "peer_service"}
+)
+
+type GraphNode struct {
+	ID           string  `json:"id"`
+	Requests     int     `json:"requests"`
+	Errors       int     `json:"errors"`
+	ErrorRate    float64 `json:"error_rate"` // percent
+	AvgDuration  int64   `json:"avg_duration"`
+	P95Duration  int64   `json:"p95_duration"`
+	Callers      int     `json:"callers"`      // nodes calling it directly
+	Dependencies int     `json:"dependencies"` // nodes it calls directly
+	Dependents   int     `json:"dependents"`   // nodes depending on it directly or transitively
+	Fragility    float64 `json:"fragility"`    // error rate weighted by dependents
+}
+
+// GraphEdge is a dependency of From on To.
+type GraphEdge struct {
+	From        string   `json:"from"`
+	To          string   `json:"to"`
+	Sources     []string `json:"sources"`
+	Calls       int      `json:"calls"` // entries logging the call, zero when only correlated
+	Errors      int      `json:"errors"`
+	ErrorRate   float64  `json:"error_rate"`                  // percent
+	Correlation float64  `json:"error_correlation,omitempty"` // Pearson coefficient of To's errors leading From's
+	Lag         string   `json:"lag,omitempty"`               // by how much To's errors lead, empty when simultaneous
+}
+
+type DependencyGraph struct {
+	NodeKind string      `json:"node_kind"`
+	Interval string      `json:"interval,omitempty"` // bucket width of the error correlation
+	Nodes    []GraphNode `json:"nodes"`
+	Edges    []GraphEdge `json:"edges"`
+	Hotspots []string    `json:"hotspots"` // most fragile depended-on nodes, worst first
+}
+
+// HotspotAssessment is the model's view of a fragile node.
+type HotspotAssessment struct {
+	Node           string `json:"node"`
+	Risk           string `json:"risk"`
+	Reason         string `json:"reason"`
+	Recommendation string `json:"recommendation"`
+}
+
+type DependencyReport struct {
+	Graph       *DependencyGraph    `json:"graph"`
+	Summary     string              `json:"summary"`
+	Assessments []HotspotAssessment `json:"hotspot_assessments"`
+}
+
+// graphNodeID returns the node of the entry in a graph of kind.
+func graphNodeID(log LogEntry, kind string) string {
+	if kind == NodeService {
+		return dimensionValue(log, ServiceDimension)
+	}
+	path, _, _ := strings.Cut(log.Path, "?")
+	segment, _, _ := strings.Cut(strings.TrimPrefix(path, "/"), "/")
+	return "/" + segment
+}
+
+// BuildDependencyGraph infers which services depend on which from logs:
+// from upstream and downstream metadata fields, from path segments naming
+// another service, and from errors of one service that tend to precede
+// errors of another by one to maxCorrelationLag buckets of interval
+// (chosen automatically when zero). Without metadata.service, nodes are
+// the first segments of paths and only metadata and correlation edges are
+// inferred.
+func BuildDependencyGraph(logs []LogEntry, interval time.Duration) *DependencyGraph {
+	kind := NodePath
+	if HasServices(logs) {
+		kind = NodeService
+	}
+	graph := &DependencyGraph{NodeKind: kind, Nodes: []GraphNode{}, Edges: []GraphEdge{}, Hotspots: []string{}}
+
+	type nodeData struct {
+		errors    int
+		durations []int64
+	}
+	nodes := make(map[string]*nodeData)
+	node := func(id string) *nodeData {
+		n, ok := nodes[id]
+		if !ok {
+			n = &nodeData{}
+			nodes[id] = n
+		}
+		return n
+	}
+	edges := make(map[[2]string]*GraphEdge)
+	addEdge := func(from, to, source string) *GraphEdge {
+		e, ok := edges[[2]string{from, to}]
+		if !ok {
+			e = &GraphEdge{From: from, To: to}
+			edges[[2]string{from, to}] = e
+			node(from)
+			node(to)
+		}
+		if !containsString(e.Sources, source) {
+			e.Sources = append(e.Sources, source)
+		}
+		return e
+	}
+
+	for _, log := range logs {
+		n := node(graphNodeID(log, kind))
+		n.durations = append(n.durations, log.Duration)
+		if isErrorEntry(log) {
+			n.errors++
+		}
+	}
+	services := make(map[string]string) // lower-cased name -> service
+	if kind == NodeService {
+		for id := range nodes {
+			if id != missingDimensionValue {
+				services[strings.ToLower(id)] = id
+			}
+		}
+	}
+
+	for _, log := range logs {
+		id := graphNodeID(log, kind)
+		called := make(map[[2]string]string)
+		for _, key := range upstreamKeys {
+			if peer := strings.TrimSpace(log.Metadata[key]); peer != "" && peer != id {
+				called[[2]string{peer, id}] = EdgeMetadata
+			}
+		}
+		for _, key := range downstreamKeys {
+			if peer := strings.TrimSpace(log.Metadata[key]); peer != "" && peer != id {
+				called[[2]string{id, peer}] = EdgeMetadata
+			}
+		}
+		if kind == NodeService && id != missingDimensionValue {
+			path, _, _ := strings.Cut(log.Path, "?")
+			for _, segment := range strings.Split(path, "/") {
+				if peer, ok := services[strings.ToLower(segment)]; ok && peer != id {
+					if _, ok := called[[2]string{id, peer}]; !ok {
+						called[[2]string{id, peer}] = EdgePath
+					}
+				}
+			}
+		}
+		for pair, source := range called {
+			e := addEdge(pair[0], pair[1], source)
+			e.Calls++
+			if isErrorEntry(log) {
+				e.Errors++
+			}
+		}
+	}
+
+	if interval <= 0 {
+		interval = AutoInterval(logs)
+	}
+	if interval > 0 {
+		graph.Interval = FormatInterval(interval)
+		correlateNodeErrors(logs, kind, interval, edges, addEdge)
+	}
+
+	ids := make([]string, 0, len(nodes))
+	for id := range nodes {
+		ids = append(ids, id)
+	}
+	sort.Slice(ids, func(i, j int) bool {
+		if len(nodes[ids[i]].durations) != len(nodes[ids[j]].durations) {
+			return len(nodes[ids[i]].durations) > len(nodes[ids[j]].durations)
+		}
+		return ids[i] < ids[j]
+	})
+	if len(ids) > maxGraphNodes {
+		ids = ids[:maxGraphNodes]
+	}
+	kept := make(map[string]bool, len(ids))
+	for _, id := range ids {
+		kept[id] = true
+	}
+
+	callers := make(map[string][]string) // node -> nodes calling it
+	for _, e := range edges {
+		if !kept[e.From] || !kept[e.To] {
+			continue
+		}
+		if e.Calls > 0 {
+			e.ErrorRate = round2(float64(e.Errors) / float64(e.Calls) * 100)
+		}
+		sort.Strings(e.Sources)
+		graph.Edges = append(graph.Edges, *e)
+		callers[e.To] = append(callers[e.To], e.From)
+	}
+	sort.Slice(graph.Edges, func(i, j int) bool {
+		a, b := graph.Edges[i], graph.Edges[j]
+		if a.Calls != b.Calls {
+			return a.Calls > b.Calls
+		}
+		if a.From != b.From {
+			return a.From < b.From
+		}
+		return a.To < b.To
+	})
+
+	for _, id := range ids {
+		n := nodes[id]
+		gn := GraphNode{ID: id, Requests: len(n.durations), Errors: n.errors, Callers: len(callers[id])}
+		if gn.Requests > 0 {
+			var total int64
+			for _, d := range n.durations {
+				total += d
+			}
+			SortDurations(n.durations)
+			gn.ErrorRate = round2(float64(n.errors) / float64(gn.Requests) * 100)
+			gn.AvgDuration = total / int64(gn.Requests)
+			gn.P95Duration = Percentile(n.durations, 95)
+		}
+		for _, e := range graph.Edges {
+			if e.From == id {
+				gn.Dependencies++
+			}
+		}
+		gn.Dependents = countDependents(id, callers)
+		gn.Fragility = round2(gn.ErrorRate * float64(1+gn.Dependents))
+		graph.Nodes = append(graph.Nodes, gn)
+	}
+
+	hotspots := make([]GraphNode, 0, len(graph.Nodes))
+	for _, n := range graph.Nodes {
+		if n.Dependents > 0 && n.ErrorRate >= hotspotErrorRate {
+			hotspots = append(hotspots, n)
+		}
+	}
+	sort.SliceStable(hotspots, func(i, j int) bool {
+		return hotspots[i].Fragility > hotspots[j].Fragility
+	})
+	for i, n := range hotspots {
+		if i == maxGraphHotspots {
+			break
+		}
+		graph.Hotspots = append(graph.Hotspots, n.ID)
+	}
+	return graph
+}
+
+// correlateNodeErrors compares the error counts of the busiest nodes per
+// bucket of interval. A node whose errors follow another's is taken to
+// depend on it: existing edges are annotated with the correlation, and
+// pairs with no edge in either direction gain one when the errors lag.
+func correlateNodeErrors(logs []LogEntry, kind string, interval time.Duration, edges map[[2]string]*GraphEdge, addEdge func(from, to, source string) *GraphEdge) {
+	start, end, ok := TimeRange(logs)
+	if !ok {
+		return
+	}
+	first := bucketStart(start, interval)
+	bins := int(end.Sub(first)/interval) + 1
+	if bins > maxCorrelationBins {
+		return
+	}
+
+	requests := make(map[string]int)
+	errors := make(map[string][]float64)
+	for _, log := range logs {
+		t, ok := parser.ParseTimestamp(log.Timestamp)
+		if !ok {
+			continue
+		}
+		id := graphNodeID(log, kind)
+		requests[id]++
+		if errors[id] == nil {
+			errors[id] = make([]float64, bins)
+		}
+		if isErrorEntry(log) {
+			errors[id][int(t.Sub(first)/interval)]++
+		}
+	}
+	ids := make([]string, 0, len(requests))
+	for id := range requests {
+		if activeBuckets(errors[id]) >= minSignalActivity {
+			ids = append(ids, id)
+		}
+	}
+	sort.Slice(ids, func(i, j int) bool {
+		if requests[ids[i]] != requests[ids[j]] {
+			return requests[ids[i]] > requests[ids[j]]
+		}
+		return ids[i] < ids[j]
+	})
+	if len(ids) > maxCorrelationPaths {
+		ids = ids[:maxCorrelationPaths]
+	}
+
+	for _, caller := range ids {
+		for _, dependency := range ids {
+			if caller == dependency {
+				continue
+			}
+			bestLag, best := -1, 0.0
+			for lag := 0; lag <= maxCorrelationLag; lag++ {
+				if r := pearson(errors[dependency], errors[caller], lag); r > best {
+					bestLag, best = lag, r
+				}
+			}
+			if bestLag < 0 || best < minCorrelation {
+				continue
+			}
+			e, ok := edges[[2]string{caller, dependency}]
+			if !ok {
+				// Simultaneous errors have no direction, and errors can't
+				// flow against a known call.
+				if _, reverse := edges[[2]string{dependency, caller}]; reverse || bestLag == 0 {
+					continue
+				}
+			}
+			if bestLag > 0 {
+				e = addEdge(caller, dependency, EdgeErrorCorrelation)
+				e.Lag = FormatInterval(time.Duration(bestLag) * interval)
+			}
+			e.Correlation = round2(best)
+		}
+	}
+}
+
+// countDependents returns the number of nodes that reach id through
+// callers.
+func countDependents(id string, callers map[string][]string) int {
+	seen := map[string]bool{id: true}
+	queue := []string{id}
+	for len(queue) > 0 {
+		next := queue[0]
+		queue = queue[1:]
+		for _, caller := range callers[next] {
+			if !seen[caller] {
+				seen[caller] = true
+				queue = append(queue, caller)
+			}
+		}
+	}
+	return len(seen) - 1
+}
+
+// dotEscaper escapes node IDs and labels inside double-quoted DOT strings.
+var dotEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+
+// DOT renders the graph in Graphviz's DOT language. Hotspots are drawn in
+// red and edges inferred only from error correlation are dashed.
+func (g *DependencyGraph) DOT() []byte {
+	hotspots := make(map[string]bool, len(g.Hotspots))
+	for _, id := range g.Hotspots {
+		hotspots[id] = true
+	}
+
+	var b bytes.Buffer
+	b.WriteString("digraph dependencies {\n\trankdir=LR;\n\tnode [shape=box, style=rounded];\n")
+	for _, n := range g.Nodes {
+		label := n.ID
+		if n.Requests > 0 {
+			label += fmt.Sprintf("\n%d requests, %.1f%% errors", n.Requests, n.ErrorRate)
+		}
+		attrs := ""
+		if hotspots[n.ID] {
+			attrs = ", color=red, penwidth=2"
+		}
+		fmt.Fprintf(&b, "\t\"%s\" [label=\"%s\"%s];\n", dotEscaper.Replace(n.ID), dotEscaper.Replace(label), attrs)
+	}
+	for _, e := range g.Edges {
+		var label []string
+		if e.Calls > 0 {
+			label = append(label, fmt.Sprintf("%d calls, %.1f%% errors", e.Calls, e.ErrorRate))
+		}
+		if e.Correlation > 0 {
+			label = append(label, fmt.Sprintf("r=%.2f, lag %s", e.Correlation, e.Lag))
+		}
+		attrs := ""
+		if e.Calls == 0 {
+			attrs = ", style=dashed"
+		}
+		fmt.Fprintf(&b, "\t\"%s\" -> \"%s\" [label=\"%s\"%s];\n",
+			dotEscaper.Replace(e.From), dotEscaper.Replace(e.To), dotEscaper.Replace(strings.Join(label, "\n")), attrs)
+	}
+	b.WriteString("}\n")
+	return b.Bytes()
+}
@@ -0,0 +1,192 @@
+package aggregator
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+
+	"analyticsai/ai-service/analytics/parser"
+)
+
+const (
+	// clusterSimilarity is the fraction of matching tokens two templates of
+	// the same length need to be merged into one cluster.
+	clusterSimilarity  = 0.7
+	maxClusterExamples = 3
+)
+
+var (
+	uuidPattern   = regexp.MustCompile(`^[0-9a-fA-F]{8}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{12}$`)
+	hexPattern    = regexp.MustCompile(`^(0x)?[0-9a-fA-F]{8,}$`)
+	ipPattern     = regexp.MustCompile(`^\d{1,3}(\.\d{1,3}){3}(:\d+)?$`)
+	digitsPattern = regexp.MustCompile(`\d`)
+)
+
+type ErrorCluster struct {
+	ID            string   `json:"id"`
+	Template      string   `json:"template"`
+	Count         int      `json:"count"`
+	FirstSeen     string   `json:"first_seen,omitempty"`
+	LastSeen      string   `json:"last_seen,omitempty"`
+	Paths         []string `json:"paths"`
+	Examples      []string `json:"examples"`
+	ProbableCause string   `json:"probable_cause"`
+}
+
+type ErrorClusterReport struct {
+	TotalErrors int            `json:"total_errors"`
+	Clusters    []ErrorCluster `json:"clusters"`
+}
+
+// isErrorEntry reports whether a log entry represents an error.
+func isErrorEntry(log LogEntry) bool {
+	switch strings.ToLower(log.Level) {
+	case "error", "fatal", "critical":
+		return true
+	}
+	return log.Status >= 500
+}
+
+// maskToken replaces variable parts of a message token (IDs, numbers,
+// addresses, quoted values) with a wildcard.
+func maskToken(token string) string {
+	trimmed := strings.Trim(token, `.,;:()[]{}'"`)
+	switch {
+	case trimmed == "":
+		return token
+	case uuidPattern.MatchString(trimmed),
+		hexPattern.MatchString(trimmed) && digitsPattern.MatchString(trimmed),
+		ipPattern.MatchString(trimmed),
+		strings.HasPrefix(token, `"`) || strings.HasPrefix(token, `'`),
+		digitsPattern.MatchString(trimmed):
+		return "<*>"
+	}
+	return token
+}
+
+// MessageTokens splits a message into tokens with variable parts masked.
+func MessageTokens(message string) []string {
+	tokens := strings.Fields(message)
+	for i, token := range tokens {
+		tokens[i] = maskToken(token)
+	}
+	return tokens
+}
+
+// tokenSimilarity is the fraction of positions where two equal-length
+// token lists agree.
+func tokenSimilarity(a, b []string) float64 {
+	if len(a) != len(b) || len(a) == 0 {
+		return 0
+	}
+	same := 0
+	for i := range a {
+		if a[i] == b[i] {
+			same++
+		}
+	}
+	return float64(same) / float64(len(a))
+}
+
+type clusterBuilder struct {
+	tokens   []string
+	count    int
+	first    time.Time
+	last     time.Time
+	paths    map[string]int
+	examples []string
+}
+
+// ClusterErrors groups error entries by message template. Messages are
+// masked into templates, and templates of the same length that mostly
+// agree are merged, with disagreeing positions becoming wildcards.
+func ClusterErrors(logs []LogEntry) *ErrorClusterReport {
+	report := &ErrorClusterReport{}
+	var builders []*clusterBuilder
+
+	for _, log := range logs {
+		if !isErrorEntry(log) {
+			continue
+		}
+		report.TotalErrors++
+
+		tokens := MessageTokens(log.Message)
+		var match *clusterBuilder
+		for _, b := range builders {
+			if tokenSimilarity(b.tokens, tokens) >= clusterSimilarity || (len(tokens) == 0 && len(b.tokens) == 0) {
+				match = b
+				break
+			}
+		}
+		if match == nil {
+			match = &clusterBuilder{tokens: tokens, paths: make(map[string]int)}
+			builders = append(builders, match)
+		} else {
+			for i := range match.tokens {
+				if match.tokens[i] != tokens[i] {
+					match.tokens[i] = "<*>"
+				}
+			}
+		}
+
+		match.count++
+		match.paths[log.Path]++
+		if t, ok := parser.ParseTimestamp(log.Timestamp); ok {
+			if match.first.IsZero() || t.Before(match.first) {
+				match.first = t
+			}
+			if match.last.IsZero() || t.After(match.last) {
+				match.last = t
+			}
+		}
+		if len(match.examples) < maxClusterExamples && !containsString(match.examples, log.Message) {
+			match.examples = append(match.examples, log.Message)
+		}
+	}
+
+	sort.SliceStable(builders, func(i, j int) bool { return builders[i].count > builders[j].count })
+	for i, b := range builders {
+		cluster := ErrorCluster{
+			ID:       fmt.Sprintf("c%d", i+1),
+			Template: strings.Join(b.tokens, " "),
+			Count:    b.count,
+			Paths:    topKeys(b.paths, 5),
+			Examples: b.examples,
+		}
+		if !b.first.IsZero() {
+			cluster.FirstSeen = b.first.Format(time.RFC3339)
+			cluster.LastSeen = b.last.Format(time.RFC3339)
+		}
+		report.Clusters = append(report.Clusters, cluster)
+	}
+	return report
+}
+
+func containsString(values []string, s string) bool {
+	for _, v := range values {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
+
+// topKeys returns up to n keys with the highest counts, ties broken by key.
+func topKeys(counts map[string]int, n int) []string {
+	keys := make([]string, 0, len(counts))
+	for k := range counts {
+		keys = append(keys, k)
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		if counts[keys[i]] != counts[keys[j]] {
+			return counts[keys[i]] > counts[keys[j]]
+		}
+		return keys[i] < keys[j]
+	})
+	if len(keys) > n {
+		keys = keys[:n]
+	}
+	return keys
+}
@@ -0,0 +1,212 @@
+package aggregator
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"time"
+)
+
+const (
+	DefaultForecastDays       = 7
+	MaxForecastDays           = 30
+	DefaultForecastConfidence = 0.95
+	defaultForecastInterval   = time.Hour
+	maxForecastPeaks          = 5
+	forecastFitRounds         = 10
+)
+
+// Seasons a forecast can follow.
+const (
+	SeasonDaily  = "daily"
+	SeasonWeekly = "weekly"
+)
+
+// forecastZ maps the supported confidence levels to normal quantiles.
+var forecastZ = map[float64]float64{0.8: 1.2816, 0.9: 1.6449, 0.95: 1.96, 0.99: 2.5758}
+
+// ForecastOptions controls ForecastTraffic.
+type ForecastOptions struct {
+	Interval   time.Duration  // bucket width, defaults to 1h; must divide a day
+	Days       int            // days to project, defaults to DefaultForecastDays
+	Confidence float64        // band coverage: 0.8, 0.9, 0.95 (default) or 0.99
+	Location   *time.Location // zone the timestamps are in, for the prompt
+}
+
+// ForecastPoint is the projected traffic of one future bucket.
+type ForecastPoint struct {
+	Start    string  `json:"start"`
+	Requests float64 `json:"requests"`
+	Lower    float64 `json:"lower"`
+	Upper    float64 `json:"upper"`
+}
+
+// DailyForecast totals the projection per day.
+type DailyForecast struct {
+	Date      string  `json:"date"`
+	Requests  float64 `json:"requests"`
+	Lower     float64 `json:"lower"`
+	Upper     float64 `json:"upper"`
+	PeakStart string  `json:"peak_start"`
+	PeakValue float64 `json:"peak_requests"`
+}
+
+// ForecastReport projects bucketed request counts with a seasonal model.
+type ForecastReport struct {
+	Interval    string          `json:"interval"`
+	Season      string          `json:"season"`
+	Days        int             `json:"days"`
+	Confidence  float64         `json:"confidence"`
+	History     int             `json:"history_buckets"`
+	TrendPerDay float64         `json:"trend_requests_per_day"` // change in requests per bucket per day
+	MAPE        *float64        `json:"mape_percent,omitempty"` // in-sample error of the fit
+	Points      []ForecastPoint `json:"points"`
+	Daily       []DailyForecast `json:"daily"`
+	Peaks       []ForecastPoint `json:"peaks"` // busiest projected buckets
+	Commentary  string          `json:"commentary"`
+}
+
+// FitForecast fits trend plus seasonal profile to the request counts of
+// logs and projects them. The season is weekly with at least two weeks of
+// history and daily with at least two days; shorter histories are rejected.
+//
+// The model is additive: a least-squares linear trend, a seasonal index per
+// position in the season (the mean detrended count, centered on zero),
+// fitted alternately until they settle, and normally
+// distributed noise estimated from the residuals. Bands widen with the
+// square root of the number of seasons ahead.
+func FitForecast(logs []LogEntry, opts ForecastOptions) (*ForecastReport, error) {
+	if opts.Interval <= 0 {
+		opts.Interval = defaultForecastInterval
+	}
+	if opts.Days <= 0 {
+		opts.Days = DefaultForecastDays
+	}
+	if opts.Confidence == 0 {
+		opts.Confidence = DefaultForecastConfidence
+	}
+	z, ok := forecastZ[opts.Confidence]
+	if !ok {
+		return nil, fmt.Errorf("%w: confidence must be 0.8, 0.9, 0.95 or 0.99", ErrInvalidInput)
+	}
+	if opts.Days > MaxForecastDays {
+		return nil, fmt.Errorf("%w: days must be at most %d", ErrInvalidInput, MaxForecastDays)
+	}
+	day := 24 * time.Hour
+	if opts.Interval > day/2 || day%opts.Interval != 0 {
+		return nil, fmt.Errorf("%w: interval must divide a day into at least two buckets", ErrInvalidInput)
+	}
+
+	series, err := BuildTimeSeries(logs, opts.Interval)
+	if err != nil {
+		return nil, err
+	}
+	n := len(series.Buckets)
+	perDay := int(day / opts.Interval)
+	report := &ForecastReport{
+		Interval:   series.Interval,
+		Days:       opts.Days,
+		Confidence: opts.Confidence,
+		History:    n,
+		Points:     []ForecastPoint{},
+		Daily:      []DailyForecast{},
+		Peaks:      []ForecastPoint{},
+	}
+	period := perDay
+	switch {
+	case n >= 14*perDay:
+		report.Season, period = SeasonWeekly, 7*perDay
+	case n >= 2*perDay:
+		report.Season = SeasonDaily
+	default:
+		return nil, fmt.Errorf("%w: forecasting needs at least two days of timestamped logs, got %d %s buckets", ErrInvalidInput, n, series.Interval)
+	}
+
+	x := make([]float64, n)
+	y := make([]float64, n)
+	for i, b := range series.Buckets {
+		x[i], y[i] = float64(i), float64(b.Requests)
+	}
+	// Trend and season are fitted alternately, since a trend fitted to the
+	// raw counts picks up part of the seasonal shape.
+	var intercept, slope float64
+	seasonal := make([]float64, period)
+	deseasonalized := make([]float64, n)
+	for round := 0; round < forecastFitRounds; round++ {
+		for i := range y {
+			deseasonalized[i] = y[i] - seasonal[i%period]
+		}
+		intercept, slope = linearFit(x, deseasonalized)
+
+		sums := make([]float64, period)
+		counts := make([]int, period)
+		var total float64
+		for i := range y {
+			sums[i%period] += y[i] - (intercept + slope*x[i])
+			counts[i%period]++
+		}
+		for k := range seasonal {
+			seasonal[k] = sums[k] / float64(counts[k])
+			total += seasonal[k]
+		}
+		for k := range seasonal {
+			seasonal[k] -= total / float64(period)
+		}
+	}
+	report.TrendPerDay = round2(slope * float64(perDay))
+
+	var squared, absPct float64
+	pctCount := 0
+	for i := range y {
+		fitted := intercept + slope*x[i] + seasonal[i%period]
+		squared += (y[i] - fitted) * (y[i] - fitted)
+		if y[i] > 0 {
+			absPct += math.Abs(y[i]-fitted) / y[i]
+			pctCount++
+		}
+	}
+	sigma := math.Sqrt(squared / float64(n))
+	if pctCount > 0 {
+		mape := round2(absPct / float64(pctCount) * 100)
+		report.MAPE = &mape
+	}
+
+	last, err := time.Parse(time.RFC3339, series.Buckets[n-1].Start)
+	if err != nil {
+		return nil, err
+	}
+	var daily *DailyForecast
+	for h := 1; h <= opts.Days*perDay; h++ {
+		i := n - 1 + h
+		start := last.Add(time.Duration(h) * opts.Interval)
+		value := math.Max(0, intercept+slope*float64(i)+seasonal[i%period])
+		band := z * sigma * math.Sqrt(1+float64(h)/float64(period))
+		point := ForecastPoint{
+			Start:    start.Format(time.RFC3339),
+			Requests: round2(value),
+			Lower:    round2(math.Max(0, value-band)),
+			Upper:    round2(value + band),
+		}
+		report.Points = append(report.Points, point)
+
+		date := start.Format("2006-01-02")
+		if daily == nil || daily.Date != date {
+			report.Daily = append(report.Daily, DailyForecast{Date: date})
+			daily = &report.Daily[len(report.Daily)-1]
+		}
+		daily.Requests = round2(daily.Requests + point.Requests)
+		daily.Lower = round2(daily.Lower + point.Lower)
+		daily.Upper = round2(daily.Upper + point.Upper)
+		if point.Requests > daily.PeakValue || daily.PeakStart == "" {
+			daily.PeakStart, daily.PeakValue = point.Start, point.Requests
+		}
+	}
+
+	peaks := append([]ForecastPoint{}, report.Points...)
+	sort.SliceStable(peaks, func(i, j int) bool { return peaks[i].Requests > peaks[j].Requests })
+	if len(peaks) > maxForecastPeaks {
+		peaks = peaks[:maxForecastPeaks]
+	}
+	report.Peaks = peaks
+	return report, nil
+}
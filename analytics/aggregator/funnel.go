@@ -0,0 +1,104 @@
+package aggregator
+
+import "strings"
+
+const exitDestination = "(exit)"
+
+type FunnelRequest struct {
+	Steps      []string   `json:"steps"` // paths in order; a trailing * matches by prefix
+	SessionGap string     `json:"session_gap,omitempty"`
+	Logs       []LogEntry `json:"logs"`
+}
+
+type FunnelStep struct {
+	Step                int            `json:"step"`
+	Path                string         `json:"path"`
+	Sessions            int            `json:"sessions"`
+	ConversionFromPrev  float64        `json:"conversion_from_previous"` // percent
+	ConversionFromStart float64        `json:"conversion_from_start"`    // percent
+	DropOffs            int            `json:"drop_offs"`                // sessions that reached this step but not the next
+	DropOffRate         float64        `json:"drop_off_rate"`            // percent
+	DropOffDestinations map[string]int `json:"drop_off_destinations,omitempty"`
+}
+
+type FunnelReport struct {
+	Sessions    int          `json:"sessions"`
+	Steps       []FunnelStep `json:"steps"`
+	OverallRate float64      `json:"overall_conversion"` // percent
+	BiggestLeak int          `json:"biggest_leak_step,omitempty"`
+	Hypotheses  []string     `json:"hypotheses"`
+}
+
+func matchesStep(step, path string) bool {
+	if prefix, ok := strings.CutSuffix(step, "*"); ok {
+		return strings.HasPrefix(path, prefix)
+	}
+	return step == path
+}
+
+// ComputeFunnel counts how far each session progresses through steps,
+// which must be visited in order but not necessarily consecutively.
+func ComputeFunnel(sessions []Session, steps []string) *FunnelReport {
+	report := &FunnelReport{Sessions: len(sessions), Hypotheses: []string{}}
+	reached := make([]int, len(steps))
+	destinations := make([]map[string]int, len(steps))
+
+	for _, s := range sessions {
+		step, lastIdx := 0, -1
+		for i, page := range s.Pages {
+			if step < len(steps) && matchesStep(steps[step], page) {
+				reached[step]++
+				step++
+				lastIdx = i
+			}
+		}
+		// Record where sessions that stalled went after their last step.
+		if step > 0 && step < len(steps) {
+			dest := exitDestination
+			if lastIdx+1 < len(s.Pages) {
+				dest = s.Pages[lastIdx+1]
+			}
+			if destinations[step-1] == nil {
+				destinations[step-1] = make(map[string]int)
+			}
+			destinations[step-1][dest]++
+		}
+	}
+
+	worst := -1.0
+	for i, path := range steps {
+		fs := FunnelStep{Step: i + 1, Path: path, Sessions: reached[i]}
+		if i == 0 {
+			if len(sessions) > 0 {
+				fs.ConversionFromPrev = round2(float64(reached[0]) / float64(len(sessions)) * 100)
+			}
+		} else if reached[i-1] > 0 {
+			fs.ConversionFromPrev = round2(float64(reached[i]) / float64(reached[i-1]) * 100)
+		}
+		if reached[0] > 0 {
+			fs.ConversionFromStart = round2(float64(reached[i]) / float64(reached[0]) * 100)
+		}
+		if i+1 < len(steps) {
+			fs.DropOffs = reached[i] - reached[i+1]
+			if reached[i] > 0 {
+				fs.DropOffRate = round2(float64(fs.DropOffs) / float64(reached[i]) * 100)
+			}
+			if fs.DropOffs > 0 && fs.DropOffRate > worst {
+				worst = fs.DropOffRate
+				report.BiggestLeak = i + 1
+			}
+			top := make(map[string]int)
+			for _, dest := range topKeys(destinations[i], 5) {
+				top[dest] = destinations[i][dest]
+			}
+			if len(top) > 0 {
+				fs.DropOffDestinations = top
+			}
+		}
+		report.Steps = append(report.Steps, fs)
+	}
+	if len(steps) > 0 {
+		report.OverallRate = report.Steps[len(steps)-1].ConversionFromStart
+	}
+	return report
+}
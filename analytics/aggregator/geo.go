@@ -0,0 +1,56 @@
+package aggregator
+
+import (
+	"net"
+
+	"analyticsai/ai-service/geoip"
+)
+
+// Metadata keys written by EnrichGeo.
+const (
+	MetaCountry = "geo_country"
+	MetaRegion  = "geo_region"
+)
+
+// GeoLocator resolves client IPs to locations, e.g. a *geoip.Reader.
+type GeoLocator interface {
+	Lookup(ip net.IP) (geoip.Location, bool)
+}
+
+type GeoBreakdown struct {
+	Countries []DimensionStats `json:"countries"`
+	Regions   []DimensionStats `json:"regions"`
+}
+
+// EnrichGeo adds geo_country (ISO code) and geo_region (country-subdivision
+// code) Metadata fields for entries with a resolvable client IP, reporting
+// whether any entry was located. Like EnrichUserAgents, it writes to a copy
+// of each located entry's Metadata.
+func EnrichGeo(logs []LogEntry, geo GeoLocator) bool {
+	found := false
+	for i := range logs {
+		ip := net.ParseIP(ClientIP(logs[i]))
+		if ip == nil {
+			continue
+		}
+		loc, ok := geo.Lookup(ip)
+		if !ok {
+			continue
+		}
+		found = true
+		logs[i].Metadata = cloneMetadata(logs[i].Metadata, 2)
+		logs[i].Metadata[MetaCountry] = loc.CountryCode
+		if loc.RegionCode != "" {
+			logs[i].Metadata[MetaRegion] = loc.CountryCode + "-" + loc.RegionCode
+		}
+	}
+	return found
+}
+
+// BreakdownGeo aggregates traffic by the fields EnrichGeo set.
+func BreakdownGeo(logs []LogEntry) *GeoBreakdown {
+	by := func(key string) []DimensionStats {
+		return aggregateBy(logs, func(_ int, log LogEntry) string { return log.Metadata[key] })
+	}
+	return &GeoBreakdown{Countries: by(MetaCountry), Regions: by(MetaRegion)}
+}
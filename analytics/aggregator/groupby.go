@@ -0,0 +1,126 @@
+package aggregator
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+
+	"analyticsai/ai-service/analytics/parser"
+)
+
+// Dimensions accepted by ParseGroupBy. Metadata keys are addressed as
+// "metadata.<key>".
+const (
+	DimensionPath        = "path"
+	DimensionMethod      = "method"
+	DimensionStatus      = "status"
+	DimensionStatusClass = "status_class"
+	DimensionLevel       = "level"
+
+	metadataDimensionPrefix = parser.MetadataPrefix
+	missingDimensionValue   = "(none)"
+)
+
+// GroupBy lists the dimensions whose values, joined by spaces, form the
+// aggregation key of a log entry. An empty GroupBy groups by path.
+type GroupBy []string
+
+// ParseGroupBy parses a comma-separated dimension list such as
+// "method,path" or "metadata.service".
+func ParseGroupBy(raw string) (GroupBy, error) {
+	if strings.TrimSpace(raw) == "" {
+		return nil, nil
+	}
+	var dims GroupBy
+	for _, dim := range strings.Split(raw, ",") {
+		dim = strings.TrimSpace(dim)
+		switch {
+		case dim == DimensionPath, dim == DimensionMethod, dim == DimensionStatus,
+			dim == DimensionStatusClass, dim == DimensionLevel:
+		case strings.HasPrefix(dim, metadataDimensionPrefix) && len(dim) > len(metadataDimensionPrefix):
+		default:
+			return nil, fmt.Errorf("%w: unknown group_by dimension %q", ErrInvalidInput, dim)
+		}
+		dims = append(dims, dim)
+	}
+	return dims, nil
+}
+
+// IsPath reports whether g groups by path alone, the default.
+func (g GroupBy) IsPath() bool {
+	return len(g) == 0 || (len(g) == 1 && g[0] == DimensionPath)
+}
+
+// String returns the dimensions as accepted by ParseGroupBy.
+func (g GroupBy) String() string {
+	if len(g) == 0 {
+		return DimensionPath
+	}
+	return strings.Join(g, ",")
+}
+
+// Key returns the aggregation key of log. Missing metadata values are
+// reported as "(none)" so that such entries still form a group.
+func (g GroupBy) Key(log LogEntry) string {
+	if g.IsPath() {
+		return log.Path
+	}
+	parts := make([]string, len(g))
+	for i, dim := range g {
+		parts[i] = dimensionValue(log, dim)
+	}
+	return strings.Join(parts, " ")
+}
+
+func dimensionValue(log LogEntry, dim string) string {
+	if v := FieldValue(log, dim); v != "" {
+		return v
+	}
+	return missingDimensionValue
+}
+
+// FieldValue returns the value of dimension dim for log, or "" if unset.
+func FieldValue(log LogEntry, dim string) string {
+	switch dim {
+	case DimensionPath:
+		return log.Path
+	case DimensionMethod:
+		return strings.ToUpper(log.Method)
+	case DimensionStatus:
+		return strconv.Itoa(log.Status)
+	case DimensionStatusClass:
+		return statusClass(log.Status)
+	case DimensionLevel:
+		return strings.ToLower(log.Level)
+	default:
+		return strings.TrimSpace(log.Metadata[strings.TrimPrefix(dim, metadataDimensionPrefix)])
+	}
+}
+
+// MetadataColumn returns the GroupBy dimension addressing metadata key.
+func MetadataColumn(key string) string {
+	return metadataDimensionPrefix + key
+}
+
+// MetadataKeys returns the sorted union of the metadata keys of logs.
+func MetadataKeys(logs []LogEntry) []string {
+	seen := make(map[string]bool)
+	keys := []string{}
+	for _, log := range logs {
+		for key := range log.Metadata {
+			if key != "" && !seen[key] {
+				seen[key] = true
+				keys = append(keys, key)
+			}
+		}
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// GroupStats aggregates logs by the dimensions in g, ordered by request
+// count.
+func GroupStats(logs []LogEntry, g GroupBy) []DimensionStats {
+	return aggregateBy(logs, func(_ int, log LogEntry) string { return g.Key(log) })
+}
@@ -0,0 +1,86 @@
+package aggregator
+
+import (
+	"sort"
+	"time"
+
+	"analyticsai/ai-service/analytics/parser"
+)
+
+// heatmapDays lists weekdays in row order (Monday first).
+var heatmapDays = []string{"Monday", "Tuesday", "Wednesday", "Thursday", "Friday", "Saturday", "Sunday"}
+
+type HeatmapWindow struct {
+	Day       string  `json:"day"`
+	Hour      int     `json:"hour"`
+	Requests  int     `json:"requests"`
+	ErrorRate float64 `json:"error_rate"`
+}
+
+type Heatmap struct {
+	Days            []string        `json:"days"`
+	Timezone        string          `json:"timezone"`
+	Requests        [7][24]int      `json:"requests"`    // [day][hour]
+	ErrorRates      [7][24]float64  `json:"error_rates"` // percent, [day][hour]
+	PeakWindows     []HeatmapWindow `json:"peak_windows"`
+	QuietestWindows []HeatmapWindow `json:"quietest_windows"`
+	Skipped         int             `json:"skipped_entries,omitempty"`
+	Commentary      []string        `json:"commentary"`
+}
+
+// heatmapRow maps Go's Sunday-first weekday to a Monday-first row.
+func heatmapRow(day time.Weekday) int {
+	return (int(day) + 6) % 7
+}
+
+// BuildHeatmap counts requests and error rates per weekday and hour of day
+// in loc (UTC when nil).
+func BuildHeatmap(logs []LogEntry, loc *time.Location) *Heatmap {
+	if loc == nil {
+		loc = time.UTC
+	}
+	heatmap := &Heatmap{Days: heatmapDays, Timezone: loc.String()}
+
+	var errors [7][24]int
+	for _, log := range logs {
+		t, ok := parser.ParseTimestamp(log.Timestamp)
+		if !ok {
+			heatmap.Skipped++
+			continue
+		}
+		t = t.In(loc)
+		day, hour := heatmapRow(t.Weekday()), t.Hour()
+		heatmap.Requests[day][hour]++
+		if log.Status >= 400 {
+			errors[day][hour]++
+		}
+	}
+
+	var windows []HeatmapWindow
+	for day := range heatmap.Requests {
+		for hour, requests := range heatmap.Requests[day] {
+			if requests > 0 {
+				heatmap.ErrorRates[day][hour] = round2(float64(errors[day][hour]) / float64(requests) * 100)
+			}
+			windows = append(windows, HeatmapWindow{
+				Day:       heatmapDays[day],
+				Hour:      hour,
+				Requests:  requests,
+				ErrorRate: heatmap.ErrorRates[day][hour],
+			})
+		}
+	}
+
+	// Stable sorts keep ties in calendar order.
+	sort.SliceStable(windows, func(i, j int) bool { return windows[i].Requests > windows[j].Requests })
+	for _, w := range windows {
+		if len(heatmap.PeakWindows) == 5 || w.Requests == 0 {
+			break
+		}
+		heatmap.PeakWindows = append(heatmap.PeakWindows, w)
+	}
+	sort.SliceStable(windows, func(i, j int) bool { return windows[i].Requests < windows[j].Requests })
+	heatmap.QuietestWindows = windows[:5]
+
+	return heatmap
+}
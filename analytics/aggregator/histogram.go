@@ -0,0 +1,88 @@
+package aggregator
+
+import (
+	"fmt"
+	"sort"
+)
+
+// DefaultLatencyBuckets are the bucket upper bounds (in ms) used when the
+// caller doesn't supply any. The last bucket is always open-ended.
+var DefaultLatencyBuckets = []int64{100, 500, 1000}
+
+type HistogramBucket struct {
+	Label string `json:"label"`
+	Min   int64  `json:"min"`
+	Max   int64  `json:"max,omitempty"` // omitted for the open-ended last bucket
+	Count int    `json:"count"`
+}
+
+type LatencyHistogram struct {
+	Path    string            `json:"path"`
+	Total   int               `json:"total"`
+	Buckets []HistogramBucket `json:"buckets"`
+}
+
+// MaxBuckets is the most bucket bounds a histogram takes.
+const MaxBuckets = 50
+
+// ValidateBuckets checks that there are at most MaxBuckets bucket bounds
+// and that they are positive and strictly increasing.
+func ValidateBuckets(bounds []int64) error {
+	if len(bounds) > MaxBuckets {
+		return fmt.Errorf("at most %d bucket bounds are allowed, got %d", MaxBuckets, len(bounds))
+	}
+	for i, b := range bounds {
+		if b <= 0 {
+			return fmt.Errorf("bucket bound must be positive, got %d", b)
+		}
+		if i > 0 && b == bounds[i-1] {
+			return fmt.Errorf("duplicate bucket bound %d", b)
+		}
+		if i > 0 && b < bounds[i-1] {
+			return fmt.Errorf("bucket bounds must be increasing, got %d after %d", b, bounds[i-1])
+		}
+	}
+	return nil
+}
+
+func newBuckets(bounds []int64) []HistogramBucket {
+	buckets := make([]HistogramBucket, 0, len(bounds)+1)
+	var lower int64
+	for _, upper := range bounds {
+		label := fmt.Sprintf("%d-%dms", lower, upper)
+		if lower == 0 {
+			label = fmt.Sprintf("<%dms", upper)
+		}
+		buckets = append(buckets, HistogramBucket{Label: label, Min: lower, Max: upper})
+		lower = upper
+	}
+	return append(buckets, HistogramBucket{Label: fmt.Sprintf(">=%dms", lower), Min: lower})
+}
+
+// BuildLatencyHistograms counts request durations per path into the given
+// buckets. Each bucket covers [Min, Max).
+func BuildLatencyHistograms(logs []LogEntry, bounds []int64) []LatencyHistogram {
+	if len(bounds) == 0 {
+		bounds = DefaultLatencyBuckets
+	}
+
+	byPath := make(map[string]*LatencyHistogram)
+	for _, log := range logs {
+		hist, ok := byPath[log.Path]
+		if !ok {
+			hist = &LatencyHistogram{Path: log.Path, Buckets: newBuckets(bounds)}
+			byPath[log.Path] = hist
+		}
+		hist.Total++
+
+		idx := sort.Search(len(bounds), func(i int) bool { return log.Duration < bounds[i] })
+		hist.Buckets[idx].Count++
+	}
+
+	histograms := make([]LatencyHistogram, 0, len(byPath))
+	for _, hist := range byPath {
+		histograms = append(histograms, *hist)
+	}
+	sort.Slice(histograms, func(i, j int) bool { return histograms[i].Path < histograms[j].Path })
+	return histograms
+}
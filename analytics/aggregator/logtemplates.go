@@ -0,0 +1,198 @@
+package aggregator
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"analyticsai/ai-service/analytics/parser"
+)
+
+// Parameters of the Drain parse tree templates are mined with.
+const (
+	drainDepth       = 4   // levels of the tree: token count, then drainDepth-2 leading tokens
+	drainSimilarity  = 0.5 // share of a template's constant tokens a message must match
+	drainMaxChildren = 100 // children per inner node, further tokens share a wildcard branch
+
+	maxTemplateExamples = 3
+)
+
+type LogTemplate struct {
+	ID        string         `json:"id"`
+	Template  string         `json:"template"` // "<*>" marks variable tokens
+	Count     int            `json:"count"`
+	Share     float64        `json:"share"`  // percent of entries with a message
+	Levels    map[string]int `json:"levels"` // entries per level
+	FirstSeen string         `json:"first_seen,omitempty"`
+	LastSeen  string         `json:"last_seen,omitempty"`
+	Examples  []string       `json:"examples"`
+}
+
+type TemplateReport struct {
+	TotalEntries   int            `json:"total_entries"`
+	WithoutMessage int            `json:"without_message"`
+	Levels         map[string]int `json:"levels"` // entries per level, "(none)" when unset
+	TemplateCount  int            `json:"template_count"`
+	Templates      []LogTemplate  `json:"templates"` // most frequent first
+}
+
+type drainNode struct {
+	children map[string]*drainNode
+	groups   []*templateGroup // set on leaves
+}
+
+type templateGroup struct {
+	tokens   []string
+	count    int
+	levels   map[string]int
+	first    time.Time
+	last     time.Time
+	examples []string
+}
+
+// drainKey returns the branch a token takes in the tree: tokens holding
+// digits are likely parameters, so they share the wildcard branch.
+func drainKey(token string) string {
+	if token == "<*>" || digitsPattern.MatchString(token) {
+		return "<*>"
+	}
+	return token
+}
+
+// leaf descends the tree along the token count and leading tokens of a
+// message, creating nodes as needed.
+func (n *drainNode) leaf(tokens []string) *drainNode {
+	node := n.child(strconv.Itoa(len(tokens)))
+	for i := 0; i < drainDepth-2 && i < len(tokens); i++ {
+		key := drainKey(tokens[i])
+		if _, ok := node.children[key]; !ok && len(node.children) >= drainMaxChildren {
+			key = "<*>"
+		}
+		node = node.child(key)
+	}
+	return node
+}
+
+func (n *drainNode) child(key string) *drainNode {
+	if n.children == nil {
+		n.children = make(map[string]*drainNode)
+	}
+	c, ok := n.children[key]
+	if !ok {
+		c = &drainNode{}
+		n.children[key] = c
+	}
+	return c
+}
+
+// templateSimilarity is the share of positions where a message matches a
+// template's constant token, and the number of wildcards the template has.
+func templateSimilarity(template, tokens []string) (float64, int) {
+	same, wildcards := 0, 0
+	for i, t := range template {
+		if t == "<*>" {
+			wildcards++
+		} else if t == tokens[i] {
+			same++
+		}
+	}
+	return float64(same) / float64(len(template)), wildcards
+}
+
+// match returns the leaf's group most similar to tokens, or nil when none
+// reaches drainSimilarity. Ties go to the template with more wildcards.
+func (n *drainNode) match(tokens []string) *templateGroup {
+	var best *templateGroup
+	bestSim, bestWildcards := -1.0, -1
+	for _, g := range n.groups {
+		sim, wildcards := templateSimilarity(g.tokens, tokens)
+		if sim > bestSim || (sim == bestSim && wildcards > bestWildcards) {
+			best, bestSim, bestWildcards = g, sim, wildcards
+		}
+	}
+	if best == nil || bestSim < drainSimilarity {
+		return nil
+	}
+	return best
+}
+
+// levelKey normalizes an entry's level for counting.
+func levelKey(log LogEntry) string {
+	if level := strings.ToLower(strings.TrimSpace(log.Level)); level != "" {
+		return level
+	}
+	return missingDimensionValue
+}
+
+// MineTemplates collapses log messages into parameterized templates with
+// the Drain algorithm: messages are masked as for error clustering, routed
+// through a fixed-depth tree by token count and leading tokens, and merged
+// into the most similar template of their leaf, with disagreeing tokens
+// becoming wildcards. The result is deterministic for a given order of
+// logs. Entries without a message count towards the level distribution
+// only.
+func MineTemplates(logs []LogEntry) *TemplateReport {
+	report := &TemplateReport{TotalEntries: len(logs), Levels: make(map[string]int), Templates: []LogTemplate{}}
+	root := &drainNode{}
+	var groups []*templateGroup
+
+	for _, log := range logs {
+		level := levelKey(log)
+		report.Levels[level]++
+		if strings.TrimSpace(log.Message) == "" {
+			report.WithoutMessage++
+			continue
+		}
+
+		tokens := MessageTokens(log.Message)
+		leaf := root.leaf(tokens)
+		g := leaf.match(tokens)
+		if g == nil {
+			g = &templateGroup{tokens: tokens, levels: make(map[string]int)}
+			leaf.groups = append(leaf.groups, g)
+			groups = append(groups, g)
+		} else {
+			for i := range g.tokens {
+				if g.tokens[i] != tokens[i] {
+					g.tokens[i] = "<*>"
+				}
+			}
+		}
+
+		g.count++
+		g.levels[level]++
+		if t, ok := parser.ParseTimestamp(log.Timestamp); ok {
+			if g.first.IsZero() || t.Before(g.first) {
+				g.first = t
+			}
+			if g.last.IsZero() || t.After(g.last) {
+				g.last = t
+			}
+		}
+		if len(g.examples) < maxTemplateExamples && !containsString(g.examples, log.Message) {
+			g.examples = append(g.examples, log.Message)
+		}
+	}
+
+	sort.SliceStable(groups, func(i, j int) bool { return groups[i].count > groups[j].count })
+	messages := report.TotalEntries - report.WithoutMessage
+	for i, g := range groups {
+		template := LogTemplate{
+			ID:       fmt.Sprintf("t%d", i+1),
+			Template: strings.Join(g.tokens, " "),
+			Count:    g.count,
+			Share:    round2(float64(g.count) / float64(messages) * 100),
+			Levels:   g.levels,
+			Examples: g.examples,
+		}
+		if !g.first.IsZero() {
+			template.FirstSeen = g.first.Format(time.RFC3339)
+			template.LastSeen = g.last.Format(time.RFC3339)
+		}
+		report.Templates = append(report.Templates, template)
+	}
+	report.TemplateCount = len(report.Templates)
+	return report
+}
@@ -0,0 +1,34 @@
+package aggregator
+
+import "strings"
+
+// Metadata keys commonly used by log shippers, checked in order.
+var (
+	clientIPKeys  = []string{"client_ip", "ip", "remote_addr", "remote_ip", "x_forwarded_for"}
+	userAgentKeys = []string{"user_agent", "userAgent", "ua", "http_user_agent"}
+)
+
+// MetadataValue returns the first non-empty Metadata value among keys.
+func MetadataValue(log LogEntry, keys ...string) string {
+	for _, key := range keys {
+		if v := strings.TrimSpace(log.Metadata[key]); v != "" {
+			return v
+		}
+	}
+	return ""
+}
+
+// ClientIP returns the originating client address recorded in Metadata.
+// For forwarded-for chains the first (client-most) address is used.
+func ClientIP(log LogEntry) string {
+	ip := MetadataValue(log, clientIPKeys...)
+	if i := strings.IndexByte(ip, ','); i >= 0 {
+		ip = strings.TrimSpace(ip[:i])
+	}
+	return ip
+}
+
+// UserAgent returns the user agent recorded in Metadata.
+func UserAgent(log LogEntry) string {
+	return MetadataValue(log, userAgentKeys...)
+}
@@ -0,0 +1,110 @@
+package aggregator
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// Placeholders substituted for high-cardinality path segments.
+const (
+	idPlaceholder   = ":id"
+	uuidPlaceholder = ":uuid"
+	hashPlaceholder = ":hash"
+)
+
+var (
+	numericSegment = regexp.MustCompile(`^\d+$`)
+	hashSegment    = regexp.MustCompile(`^[0-9a-fA-F]{16,}$`)
+)
+
+// PathNormalizer collapses variable path segments so that requests for the
+// same route aggregate together.
+type PathNormalizer struct {
+	patterns    [][]string
+	collapseIDs bool
+}
+
+// NewPathNormalizer builds a normalizer. Patterns are routes such as
+// "/users/:name/settings" or "/static/*": a ":name" segment matches any
+// single segment and a trailing "*" matches the rest of the path. Matching
+// paths are replaced by the first matching pattern; others have numeric,
+// UUID and long hex segments collapsed when collapseIDs is set.
+func NewPathNormalizer(patterns []string, collapseIDs bool) (*PathNormalizer, error) {
+	n := &PathNormalizer{collapseIDs: collapseIDs}
+	for _, p := range patterns {
+		p = strings.TrimSpace(p)
+		if !strings.HasPrefix(p, "/") {
+			return nil, fmt.Errorf("%w: path pattern %q must start with /", ErrInvalidInput, p)
+		}
+		segments := strings.Split(strings.Trim(p, "/"), "/")
+		for i, s := range segments {
+			if s == "*" && i != len(segments)-1 {
+				return nil, fmt.Errorf("%w: * is only allowed at the end of path pattern %q", ErrInvalidInput, p)
+			}
+		}
+		n.patterns = append(n.patterns, segments)
+	}
+	return n, nil
+}
+
+func matchPattern(pattern, segments []string) bool {
+	for i, p := range pattern {
+		if p == "*" {
+			return true
+		}
+		if i >= len(segments) {
+			return false
+		}
+		if !strings.HasPrefix(p, ":") && p != segments[i] {
+			return false
+		}
+	}
+	return len(pattern) == len(segments)
+}
+
+// Normalize returns the route template for path. Any query string is kept
+// unchanged.
+func (n *PathNormalizer) Normalize(path string) string {
+	route, query, hasQuery := strings.Cut(path, "?")
+	segments := strings.Split(strings.Trim(route, "/"), "/")
+
+	normalized := ""
+	for _, pattern := range n.patterns {
+		if matchPattern(pattern, segments) {
+			normalized = "/" + strings.Join(pattern, "/")
+			break
+		}
+	}
+
+	if normalized == "" && n.collapseIDs {
+		changed := false
+		for i, s := range segments {
+			switch {
+			case numericSegment.MatchString(s):
+				segments[i] = idPlaceholder
+			case uuidPattern.MatchString(s):
+				segments[i] = uuidPlaceholder
+			case hashSegment.MatchString(s) && digitsPattern.MatchString(s):
+				segments[i] = hashPlaceholder
+			default:
+				continue
+			}
+			changed = true
+		}
+		if changed {
+			normalized = "/" + strings.Join(segments, "/")
+			if strings.HasSuffix(route, "/") && len(route) > 1 {
+				normalized += "/"
+			}
+		}
+	}
+
+	if normalized == "" {
+		return path
+	}
+	if hasQuery {
+		return normalized + "?" + query
+	}
+	return normalized
+}
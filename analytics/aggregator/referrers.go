@@ -0,0 +1,133 @@
+package aggregator
+
+import (
+	"net/url"
+	"strings"
+)
+
+// Traffic sources assigned by ClassifyReferrer.
+const (
+	SourceDirect   = "direct"
+	SourceSearch   = "search"
+	SourceSocial   = "social"
+	SourceInternal = "internal"
+	SourceReferral = "referral"
+)
+
+var (
+	referrerKeys = []string{"referrer", "referer", "http_referer", "http_referrer"}
+	hostKeys     = []string{"host", "hostname", "server_name"}
+
+	searchDomains = []string{"google.", "bing.", "duckduckgo.", "yahoo.", "baidu.", "yandex.", "ecosia.", "naver.", "search.brave.com"}
+	socialDomains = []string{"facebook.", "fb.me", "t.co", "twitter.", "x.com", "linkedin.", "lnkd.in", "instagram.", "reddit.", "youtube.", "pinterest.", "tiktok.", "threads.net"}
+)
+
+type ReferrerBreakdown struct {
+	Sources      []DimensionStats `json:"sources"`
+	TopReferrers []DimensionStats `json:"top_referrers"` // by external referring host
+}
+
+// Referrer returns the referring URL recorded in Metadata.
+func Referrer(log LogEntry) string {
+	return MetadataValue(log, referrerKeys...)
+}
+
+// Host returns the server host name recorded in Metadata.
+func Host(log LogEntry) string {
+	return MetadataValue(log, hostKeys...)
+}
+
+// hostMatches reports whether host belongs to one of domains. Entries
+// ending in "." match any TLD (google. matches google.co.uk); others must
+// match exactly or as a parent domain.
+func hostMatches(host string, domains []string) bool {
+	for _, d := range domains {
+		if strings.HasSuffix(d, ".") {
+			if strings.HasPrefix(host, d) || strings.Contains(host, "."+d) {
+				return true
+			}
+		} else if host == d || strings.HasSuffix(host, "."+d) {
+			return true
+		}
+	}
+	return false
+}
+
+// referrerHost returns the lowercased host of a referrer URL without a
+// leading "www.".
+func referrerHost(ref string) string {
+	u, err := url.Parse(ref)
+	if err != nil {
+		return ""
+	}
+	return strings.TrimPrefix(strings.ToLower(u.Hostname()), "www.")
+}
+
+// ClassifyReferrer assigns the traffic source of a request. Referrers
+// whose host is one of internalHosts, or the entry's own host metadata,
+// are internal navigation.
+func ClassifyReferrer(log LogEntry, internalHosts []string) string {
+	ref := Referrer(log)
+	if ref == "" || ref == "-" {
+		return SourceDirect
+	}
+	host := referrerHost(ref)
+	if host == "" {
+		// Relative referrers only come from our own pages.
+		return SourceInternal
+	}
+
+	own := strings.TrimPrefix(strings.ToLower(Host(log)), "www.")
+	if host == own {
+		return SourceInternal
+	}
+	for _, h := range internalHosts {
+		if host == strings.TrimPrefix(strings.ToLower(h), "www.") {
+			return SourceInternal
+		}
+	}
+
+	switch {
+	case hostMatches(host, searchDomains):
+		return SourceSearch
+	case hostMatches(host, socialDomains):
+		return SourceSocial
+	}
+	return SourceReferral
+}
+
+// BreakdownReferrers aggregates traffic by source and by external referring
+// host. It returns nil when no entry carries a referrer field.
+func BreakdownReferrers(logs []LogEntry, internalHosts []string) *ReferrerBreakdown {
+	found := false
+	for _, log := range logs {
+		for _, key := range referrerKeys {
+			if _, ok := log.Metadata[key]; ok {
+				found = true
+			}
+		}
+	}
+	if !found {
+		return nil
+	}
+
+	sources := make([]string, len(logs))
+	for i, log := range logs {
+		sources[i] = ClassifyReferrer(log, internalHosts)
+	}
+
+	top := aggregateBy(logs, func(i int, log LogEntry) string {
+		if sources[i] == SourceDirect || sources[i] == SourceInternal {
+			return ""
+		}
+		return referrerHost(Referrer(log))
+	})
+	if len(top) > 10 {
+		top = top[:10]
+	}
+
+	return &ReferrerBreakdown{
+		Sources:      aggregateBy(logs, func(i int, _ LogEntry) string { return sources[i] }),
+		TopReferrers: top,
+	}
+}
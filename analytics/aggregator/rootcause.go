@@ -0,0 +1,248 @@
+package aggregator
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"time"
+
+	"analyticsai/ai-service/analytics/parser"
+)
+
+const (
+	maxCorrelationLag   = 3   // buckets a leading signal may precede its follower by
+	minCorrelation      = 0.7 // Pearson coefficient needed to report a pair
+	minSignalActivity   = 2   // buckets a signal must be non-zero in to be considered
+	maxCorrelationPaths = 30  // busiest paths compared pairwise
+	maxCorrelations     = 25
+	maxCorrelationBins  = 2000
+)
+
+type Correlation struct {
+	ID             string   `json:"id"`
+	Leader         string   `json:"leader"`
+	LeaderMetric   string   `json:"leader_metric"`
+	Follower       string   `json:"follower"`
+	FollowerMetric string   `json:"follower_metric"`
+	Lag            string   `json:"lag"`
+	Coefficient    float64  `json:"coefficient"`
+	Evidence       []string `json:"evidence"`
+}
+
+type Hypothesis struct {
+	Chain       []string `json:"chain"`
+	Explanation string   `json:"explanation"`
+	Confidence  string   `json:"confidence"`
+	Evidence    []string `json:"evidence"` // correlation IDs
+}
+
+type RootCauseReport struct {
+	Interval     string        `json:"interval"`
+	Correlations []Correlation `json:"correlations"`
+	Hypotheses   []Hypothesis  `json:"hypotheses"`
+}
+
+type signal struct {
+	path, metric string
+	values       []float64
+}
+
+// alignedSignals buckets every path onto a shared timeline and returns an
+// error-count and a p95-latency signal for each of the busiest paths.
+func alignedSignals(logs []LogEntry, interval time.Duration) ([]time.Time, []signal) {
+	start, end, ok := TimeRange(logs)
+	if !ok {
+		return nil, nil
+	}
+	first := bucketStart(start, interval)
+	bins := int(end.Sub(first)/interval) + 1
+	if bins > maxCorrelationBins {
+		return nil, nil
+	}
+
+	type pathData struct {
+		requests  int
+		errors    []float64
+		durations [][]int64
+	}
+	byPath := make(map[string]*pathData)
+	for _, log := range logs {
+		t, ok := parser.ParseTimestamp(log.Timestamp)
+		if !ok {
+			continue
+		}
+		p, ok := byPath[log.Path]
+		if !ok {
+			p = &pathData{errors: make([]float64, bins), durations: make([][]int64, bins)}
+			byPath[log.Path] = p
+		}
+		i := int(t.Sub(first) / interval)
+		p.requests++
+		p.durations[i] = append(p.durations[i], log.Duration)
+		if isErrorEntry(log) {
+			p.errors[i]++
+		}
+	}
+
+	paths := make([]string, 0, len(byPath))
+	for path := range byPath {
+		paths = append(paths, path)
+	}
+	sort.Slice(paths, func(i, j int) bool {
+		if byPath[paths[i]].requests != byPath[paths[j]].requests {
+			return byPath[paths[i]].requests > byPath[paths[j]].requests
+		}
+		return paths[i] < paths[j]
+	})
+	if len(paths) > maxCorrelationPaths {
+		paths = paths[:maxCorrelationPaths]
+	}
+
+	var signals []signal
+	for _, path := range paths {
+		p := byPath[path]
+		latency := make([]float64, bins)
+		for i, durations := range p.durations {
+			SortDurations(durations)
+			latency[i] = float64(Percentile(durations, 95))
+		}
+		signals = append(signals,
+			signal{path: path, metric: "errors", values: p.errors},
+			signal{path: path, metric: "latency_p95", values: latency})
+	}
+
+	times := make([]time.Time, bins)
+	for i := range times {
+		times[i] = first.Add(time.Duration(i) * interval)
+	}
+	return times, signals
+}
+
+// pearson computes the correlation coefficient of a[i] and b[i+lag].
+func pearson(a, b []float64, lag int) float64 {
+	n := len(a) - lag
+	if n < 3 {
+		return 0
+	}
+	var sumA, sumB float64
+	for i := 0; i < n; i++ {
+		sumA += a[i]
+		sumB += b[i+lag]
+	}
+	meanA, meanB := sumA/float64(n), sumB/float64(n)
+
+	var cov, varA, varB float64
+	for i := 0; i < n; i++ {
+		da, db := a[i]-meanA, b[i+lag]-meanB
+		cov += da * db
+		varA += da * da
+		varB += db * db
+	}
+	if varA == 0 || varB == 0 {
+		return 0
+	}
+	return cov / math.Sqrt(varA*varB)
+}
+
+func activeBuckets(values []float64) int {
+	n := 0
+	for _, v := range values {
+		if v > 0 {
+			n++
+		}
+	}
+	return n
+}
+
+// spikes returns the bucket indexes where a signal exceeds its mean by more
+// than one standard deviation.
+func spikes(values []float64) map[int]bool {
+	var sum, sq float64
+	for _, v := range values {
+		sum += v
+	}
+	mean := sum / float64(len(values))
+	for _, v := range values {
+		sq += (v - mean) * (v - mean)
+	}
+	std := math.Sqrt(sq / float64(len(values)))
+
+	out := make(map[int]bool)
+	for i, v := range values {
+		if v > mean+std {
+			out[i] = true
+		}
+	}
+	return out
+}
+
+// FindCorrelations looks for pairs of signals where one tends to spike at
+// the same time as, or up to maxCorrelationLag buckets before, the other.
+func FindCorrelations(logs []LogEntry, interval time.Duration) []Correlation {
+	if interval <= 0 {
+		if interval = AutoInterval(logs); interval == 0 {
+			return nil
+		}
+	}
+	times, signals := alignedSignals(logs, interval)
+
+	var correlations []Correlation
+	for i, leader := range signals {
+		if activeBuckets(leader.values) < minSignalActivity {
+			continue
+		}
+		for j, follower := range signals {
+			if i == j || activeBuckets(follower.values) < minSignalActivity {
+				continue
+			}
+
+			bestLag, best := -1, 0.0
+			for lag := 0; lag <= maxCorrelationLag; lag++ {
+				// Same-bucket pairs have no direction; keep one ordering.
+				if lag == 0 && j < i {
+					continue
+				}
+				if r := pearson(leader.values, follower.values, lag); r > best {
+					bestLag, best = lag, r
+				}
+			}
+			if bestLag < 0 || best < minCorrelation {
+				continue
+			}
+
+			leaderSpikes, followerSpikes := spikes(leader.values), spikes(follower.values)
+			var evidence []string
+			for t := range times {
+				if leaderSpikes[t] && t+bestLag < len(times) && followerSpikes[t+bestLag] {
+					evidence = append(evidence, fmt.Sprintf("%s %s %.0f at %s, %s %s %.0f at %s",
+						leader.path, leader.metric, leader.values[t], times[t].Format(time.RFC3339),
+						follower.path, follower.metric, follower.values[t+bestLag], times[t+bestLag].Format(time.RFC3339)))
+				}
+			}
+			if len(evidence) == 0 {
+				continue
+			}
+
+			correlations = append(correlations, Correlation{
+				Leader:         leader.path,
+				LeaderMetric:   leader.metric,
+				Follower:       follower.path,
+				FollowerMetric: follower.metric,
+				Lag:            FormatInterval(time.Duration(bestLag) * interval),
+				Coefficient:    round2(best),
+				Evidence:       evidence,
+			})
+		}
+	}
+
+	sort.SliceStable(correlations, func(i, j int) bool {
+		return correlations[i].Coefficient > correlations[j].Coefficient
+	})
+	if len(correlations) > maxCorrelations {
+		correlations = correlations[:maxCorrelations]
+	}
+	for i := range correlations {
+		correlations[i].ID = fmt.Sprintf("r%d", i+1)
+	}
+	return correlations
+}
@@ -0,0 +1,143 @@
+package aggregator
+
+import (
+	"math/rand"
+	"sort"
+)
+
+// DefaultSampleThreshold is the entry count above which the Gemini summary
+// is built from a sample.
+const DefaultSampleThreshold = 2000
+
+// SamplingReport describes the sample a summary was built from.
+type SamplingReport struct {
+	TotalEntries   int     `json:"total_entries"`
+	SampledEntries int     `json:"sampled_entries"`
+	NotableEntries int     `json:"notable_entries"` // errors, warnings and slow requests in the input
+	NotableRate    float64 `json:"notable_rate"`    // fraction of notable entries kept
+	RoutineRate    float64 `json:"routine_rate"`    // fraction of other entries kept
+}
+
+// IsNotable reports whether an entry is listed individually in the log
+// summary: errors, warnings and slow requests.
+func IsNotable(log LogEntry) bool {
+	return log.Status >= 400 || log.Level == "error" || log.Level == "warning" || log.Duration > 1000
+}
+
+// SampleLogs draws at most n entries from logs and returns their indexes in
+// ascending order. Notable entries are kept
+// first and the remaining capacity is filled with routine entries; within
+// each group every path gets a share of the capacity proportional to its
+// traffic (at least one entry), filled by reservoir sampling. The returned
+// weights give how many input entries each sampled entry stands for, so
+// that counts and averages computed from the sample stay unbiased. Sampling
+// is deterministic for a given input. When logs has n or fewer entries (or n
+// is not positive) every entry is returned with weight 1 and a nil report.
+func SampleLogs(logs []LogEntry, n int) ([]int, []float64, *SamplingReport) {
+	if n <= 0 || len(logs) <= n {
+		indexes := make([]int, len(logs))
+		weights := make([]float64, len(logs))
+		for i := range logs {
+			indexes[i] = i
+			weights[i] = 1
+		}
+		return indexes, weights, nil
+	}
+
+	var notable, routine []int
+	for i, log := range logs {
+		if IsNotable(log) {
+			notable = append(notable, i)
+		} else {
+			routine = append(routine, i)
+		}
+	}
+
+	rng := rand.New(rand.NewSource(int64(len(logs))))
+	weights := make(map[int]float64, n)
+	keptNotable := sampleStrata(logs, notable, n, rng, weights)
+	keptRoutine := sampleStrata(logs, routine, n-keptNotable, rng, weights)
+
+	indexes := make([]int, 0, len(weights))
+	for i := range weights {
+		indexes = append(indexes, i)
+	}
+	sort.Ints(indexes)
+
+	sampleWeights := make([]float64, len(indexes))
+	for j, i := range indexes {
+		sampleWeights[j] = weights[i]
+	}
+
+	report := &SamplingReport{
+		TotalEntries:   len(logs),
+		SampledEntries: len(indexes),
+		NotableEntries: len(notable),
+		NotableRate:    1,
+		RoutineRate:    1,
+	}
+	if len(notable) > 0 {
+		report.NotableRate = round2(float64(keptNotable) / float64(len(notable)))
+	}
+	if len(routine) > 0 {
+		report.RoutineRate = round2(float64(keptRoutine) / float64(len(routine)))
+	}
+	return indexes, sampleWeights, report
+}
+
+// sampleStrata samples up to capacity of the entries at indexes, stratified
+// by path, recording each kept index's weight. It returns how many were kept.
+func sampleStrata(logs []LogEntry, indexes []int, capacity int, rng *rand.Rand, weights map[int]float64) int {
+	if capacity <= 0 || len(indexes) == 0 {
+		return 0
+	}
+	if len(indexes) <= capacity {
+		for _, i := range indexes {
+			weights[i] = 1
+		}
+		return len(indexes)
+	}
+
+	byPath := make(map[string][]int)
+	var paths []string
+	for _, i := range indexes {
+		p := logs[i].Path
+		if _, ok := byPath[p]; !ok {
+			paths = append(paths, p)
+		}
+		byPath[p] = append(byPath[p], i)
+	}
+	// Busiest paths first, so that if the one-entry minimum exhausts the
+	// capacity it is the rarest paths that go unsampled.
+	sort.SliceStable(paths, func(a, b int) bool { return len(byPath[paths[a]]) > len(byPath[paths[b]]) })
+
+	kept := 0
+	for _, p := range paths {
+		members := byPath[p]
+		share := capacity * len(members) / len(indexes)
+		if share < 1 {
+			share = 1
+		}
+		if share > capacity-kept {
+			share = capacity - kept
+		}
+		if share <= 0 {
+			break
+		}
+
+		// Reservoir sampling (Algorithm R).
+		reservoir := make([]int, 0, share)
+		for seen, i := range members {
+			if seen < share {
+				reservoir = append(reservoir, i)
+			} else if j := rng.Intn(seen + 1); j < share {
+				reservoir[j] = i
+			}
+		}
+		for _, i := range reservoir {
+			weights[i] = float64(len(members)) / float64(len(reservoir))
+		}
+		kept += len(reservoir)
+	}
+	return kept
+}
@@ -0,0 +1,197 @@
+package aggregator
+
+import (
+	"fmt"
+	"net/url"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+
+	"analyticsai/ai-service/analytics/parser"
+)
+
+// DefaultAuthFailureThreshold is how many 401/403 responses one client must
+// receive before it is reported as a credential-stuffing suspect.
+const DefaultAuthFailureThreshold = 10
+
+var (
+	sqliPattern      = regexp.MustCompile(`(?i)(union(\s|\+|/\*.*\*/)+select|\bor\s+1\s*=\s*1|'\s*or\s*'|;\s*drop\s+table|\bsleep\s*\(|benchmark\s*\(|information_schema|\bxp_cmdshell)`)
+	xssPattern       = regexp.MustCompile(`(?i)(<script|javascript:|\bon(error|load|mouseover)\s*=|<img[^>]+src|<svg|alert\s*\(|document\.cookie)`)
+	traversalPattern = regexp.MustCompile(`(\.\./|\.\.\\|/etc/passwd|/proc/self|c:\\windows)`)
+)
+
+// scannerPaths are paths probed by vulnerability scanners and bots.
+var scannerPaths = []string{
+	"/wp-admin", "/wp-login.php", "/xmlrpc.php", "/.env", "/.git/", "/phpmyadmin",
+	"/cgi-bin/", "/admin.php", "/actuator", "/.aws/", "/server-status", "/boaform", "/HNAP1",
+}
+
+// scannerAgents are user-agent fragments of known attack and scanning tools.
+var scannerAgents = []string{
+	"sqlmap", "nikto", "nmap", "masscan", "zgrab", "nuclei", "acunetix", "wpscan",
+	"dirbuster", "gobuster", "ffuf", "wfuzz", "netsparker", "burp", "hydra", "openvas",
+}
+
+// scriptAgents are generic HTTP libraries; unusual for browser-facing
+// endpoints but often legitimate, so they only produce low-severity findings.
+var scriptAgents = []string{
+	"python-requests", "curl/", "wget/", "go-http-client", "libwww-perl", "java/", "okhttp", "httpclient",
+}
+
+var severityRank = map[string]int{"critical": 4, "high": 3, "medium": 2, "low": 1}
+
+// SeverityRank orders severities from "critical" (4) down to "low" (1);
+// unknown severities rank 0.
+func SeverityRank(severity string) int {
+	return severityRank[severity]
+}
+
+type Threat struct {
+	Type        string   `json:"type"`
+	Severity    string   `json:"severity"`
+	Description string   `json:"description"`
+	ClientIP    string   `json:"client_ip,omitempty"`
+	Paths       []string `json:"paths"`
+	Count       int      `json:"count"`
+	FirstSeen   string   `json:"first_seen,omitempty"`
+	LastSeen    string   `json:"last_seen,omitempty"`
+	Evidence    []string `json:"evidence"`
+}
+
+type SecurityReport struct {
+	Threats         []Threat       `json:"threats"`
+	CountsByType    map[string]int `json:"counts_by_type"`
+	Assessment      string         `json:"assessment"`
+	Recommendations []string       `json:"recommendations"`
+}
+
+type threatBuilder struct {
+	threat      Threat
+	paths       map[string]int
+	first, last time.Time
+}
+
+type threatSet struct {
+	byKey map[string]*threatBuilder
+}
+
+func (s *threatSet) add(kind, severity, description, ip string, log LogEntry, evidence string) {
+	key := kind + "|" + ip
+	b, ok := s.byKey[key]
+	if !ok {
+		b = &threatBuilder{
+			threat: Threat{Type: kind, Severity: severity, Description: description, ClientIP: ip},
+			paths:  make(map[string]int),
+		}
+		s.byKey[key] = b
+	}
+	b.threat.Count++
+	b.paths[log.Path]++
+	if len(b.threat.Evidence) < 3 && !containsString(b.threat.Evidence, evidence) {
+		b.threat.Evidence = append(b.threat.Evidence, evidence)
+	}
+	if t, ok := parser.ParseTimestamp(log.Timestamp); ok {
+		if b.first.IsZero() || t.Before(b.first) {
+			b.first = t
+		}
+		if b.last.IsZero() || t.After(b.last) {
+			b.last = t
+		}
+	}
+}
+
+func matchesAny(s string, fragments []string) string {
+	lower := strings.ToLower(s)
+	for _, f := range fragments {
+		if strings.Contains(lower, strings.ToLower(f)) {
+			return f
+		}
+	}
+	return ""
+}
+
+// DetectThreats scans logs for injection attempts, path traversal, scanner
+// activity, credential stuffing and suspicious user agents, returning the
+// findings ordered by severity and volume.
+func DetectThreats(logs []LogEntry, authFailureThreshold int) []Threat {
+	if authFailureThreshold <= 0 {
+		authFailureThreshold = DefaultAuthFailureThreshold
+	}
+
+	set := &threatSet{byKey: make(map[string]*threatBuilder)}
+	authFailures := make(map[string][]LogEntry)
+
+	for _, log := range logs {
+		ip := ClientIP(log)
+		ua := UserAgent(log)
+		target := log.Path
+		if decoded, err := url.QueryUnescape(target); err == nil {
+			target = decoded
+		}
+
+		if sqliPattern.MatchString(target) {
+			severity := "high"
+			if log.Status < 400 {
+				// The request was not rejected, so the payload may have run.
+				severity = "critical"
+			}
+			set.add("sql_injection", severity, "SQL injection payloads in request paths", ip, log, target)
+		}
+		if xssPattern.MatchString(target) {
+			set.add("xss", "high", "Cross-site scripting payloads in request paths", ip, log, target)
+		}
+		if traversalPattern.MatchString(target) {
+			set.add("path_traversal", "high", "Path traversal attempts", ip, log, target)
+		}
+		if tool := matchesAny(ua, scannerAgents); tool != "" {
+			set.add("scanner", "high", fmt.Sprintf("Requests from vulnerability scanner (%s)", tool), ip, log, ua)
+		} else if probe := matchesAny(log.Path, scannerPaths); probe != "" && log.Status == 404 {
+			set.add("scanner", "medium", "Probing for common vulnerable paths", ip, log, log.Path)
+		}
+		if agent := matchesAny(ua, scriptAgents); agent != "" {
+			set.add("suspicious_user_agent", "low", fmt.Sprintf("Scripted client (%s)", agent), ip, log, ua)
+		} else if ua == "" && len(log.Metadata) > 0 && ip != "" {
+			set.add("suspicious_user_agent", "low", "Requests without a user agent", ip, log, "(empty user agent)")
+		}
+		if ip != "" && (log.Status == 401 || log.Status == 403) {
+			authFailures[ip] = append(authFailures[ip], log)
+		}
+	}
+
+	for ip, failures := range authFailures {
+		if len(failures) < authFailureThreshold {
+			continue
+		}
+		severity := "high"
+		if len(failures) >= 10*authFailureThreshold {
+			severity = "critical"
+		}
+		for _, log := range failures {
+			set.add("credential_stuffing", severity,
+				fmt.Sprintf("%d authentication failures from one client", len(failures)),
+				ip, log, fmt.Sprintf("%s %s -> %d", log.Method, log.Path, log.Status))
+		}
+	}
+
+	threats := make([]Threat, 0, len(set.byKey))
+	for _, b := range set.byKey {
+		b.threat.Paths = topKeys(b.paths, 5)
+		if !b.first.IsZero() {
+			b.threat.FirstSeen = b.first.Format(time.RFC3339)
+			b.threat.LastSeen = b.last.Format(time.RFC3339)
+		}
+		threats = append(threats, b.threat)
+	}
+	sort.Slice(threats, func(i, j int) bool {
+		a, b := threats[i], threats[j]
+		if severityRank[a.Severity] != severityRank[b.Severity] {
+			return severityRank[a.Severity] > severityRank[b.Severity]
+		}
+		if a.Count != b.Count {
+			return a.Count > b.Count
+		}
+		return a.Type+a.ClientIP < b.Type+b.ClientIP
+	})
+	return threats
+}
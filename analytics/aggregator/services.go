@@ -0,0 +1,159 @@
+package aggregator
+
+import (
+	"fmt"
+	"sort"
+)
+
+// ServiceDimension is the GroupBy dimension of the service that emitted a
+// log entry, as set by log aggregators covering several services.
+const ServiceDimension = metadataDimensionPrefix + "service"
+
+// HasServices reports whether any entry of logs names its service.
+func HasServices(logs []LogEntry) bool {
+	for _, log := range logs {
+		if FieldValue(log, ServiceDimension) != "" {
+			return true
+		}
+	}
+	return false
+}
+
+// ServiceStats aggregates logs per service, ordered by request count. It
+// returns nil when no entry names its service; entries without one form
+// the "(none)" group.
+func ServiceStats(logs []LogEntry) []DimensionStats {
+	if !HasServices(logs) {
+		return nil
+	}
+	return GroupStats(logs, GroupBy{ServiceDimension})
+}
+
+// splitByService partitions logs by service, keeping their order.
+func splitByService(logs []LogEntry) ([]string, map[string][]LogEntry) {
+	byService := make(map[string][]LogEntry)
+	var services []string
+	for _, log := range logs {
+		service := dimensionValue(log, ServiceDimension)
+		if _, ok := byService[service]; !ok {
+			services = append(services, service)
+		}
+		byService[service] = append(byService[service], log)
+	}
+	sort.Strings(services)
+	return services, byService
+}
+
+// ServiceBudget is the error budget of one service.
+type ServiceBudget struct {
+	Service      string           `json:"service"`
+	Availability SLIReport        `json:"availability"`
+	Latency      *SLIReport       `json:"latency,omitempty"`
+	BudgetShare  float64          `json:"platform_bad_share_percent"` // share of the platform's bad requests
+	Exhausted    bool             `json:"exhausted"`
+	TopEndpoints []EndpointBudget `json:"top_endpoints"` // endpoints burning the most budget
+}
+
+// ErrorBudgetReport rolls up the error budget consumption of every service.
+type ErrorBudgetReport struct {
+	Start      string          `json:"start,omitempty"`
+	End        string          `json:"end,omitempty"`
+	FastWindow string          `json:"fast_window"`
+	SlowWindow string          `json:"slow_window"`
+	Platform   SLIReport       `json:"platform"`
+	Services   []ServiceBudget `json:"services"`
+	Exhausted  []string        `json:"exhausted_services"`
+	Alerting   []string        `json:"alerting_services"` // services over a burn-rate alert threshold
+}
+
+// serviceBudgets computes the error budget of each service in logs against
+// target, or against the availability in overrides for services listed
+// there. Services are ordered by budget consumed. The target must have been
+// validated.
+func serviceBudgets(logs []LogEntry, target SLOTarget, overrides map[string]float64) []ServiceBudget {
+	services, byService := splitByService(logs)
+	totalBad := 0
+	reports := make(map[string]*SLOReport, len(services))
+	for _, service := range services {
+		t := target
+		if availability, ok := overrides[service]; ok {
+			t.Availability = availability
+		}
+		reports[service] = computeSLO(byService[service], t)
+		for _, ep := range reports[service].Endpoints {
+			totalBad += ep.BadRequests
+		}
+	}
+
+	budgets := make([]ServiceBudget, 0, len(services))
+	for _, service := range services {
+		report := reports[service]
+		budget := ServiceBudget{
+			Service:      service,
+			Availability: report.Availability,
+			Latency:      report.Latency,
+			Exhausted:    report.Availability.BudgetConsumed >= 100,
+			TopEndpoints: []EndpointBudget{},
+		}
+		if report.Latency != nil && report.Latency.BudgetConsumed >= 100 {
+			budget.Exhausted = true
+		}
+		bad := 0
+		for i, ep := range report.Endpoints {
+			bad += ep.BadRequests
+			if i < 3 && ep.BadRequests > 0 {
+				budget.TopEndpoints = append(budget.TopEndpoints, ep)
+			}
+		}
+		if totalBad > 0 {
+			budget.BudgetShare = round2(float64(bad) / float64(totalBad) * 100)
+		}
+		budgets = append(budgets, budget)
+	}
+	sort.SliceStable(budgets, func(i, j int) bool {
+		return budgets[i].Availability.BudgetConsumed > budgets[j].Availability.BudgetConsumed
+	})
+	return budgets
+}
+
+// ComputeErrorBudgets reports the error budget consumption of every
+// service in logs, with overrides setting the availability target of
+// individual services. It fails when no entry names its service.
+func ComputeErrorBudgets(logs []LogEntry, target SLOTarget, overrides map[string]float64) (*ErrorBudgetReport, error) {
+	if err := target.Validate(); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidInput, err)
+	}
+	for service, availability := range overrides {
+		if availability <= 0 || availability >= 100 {
+			return nil, fmt.Errorf("%w: availability target of service %q must be between 0 and 100 (exclusive), got %v", ErrInvalidInput, service, availability)
+		}
+	}
+	if !HasServices(logs) {
+		return nil, fmt.Errorf("%w: no log entry sets metadata.service", ErrInvalidInput)
+	}
+
+	platform := computeSLO(logs, target)
+	report := &ErrorBudgetReport{
+		Start:      platform.Start,
+		End:        platform.End,
+		FastWindow: platform.FastWindow,
+		SlowWindow: platform.SlowWindow,
+		Platform:   platform.Availability,
+		Services:   serviceBudgets(logs, target, overrides),
+		Exhausted:  []string{},
+		Alerting:   []string{},
+	}
+	for _, budget := range report.Services {
+		if budget.Exhausted {
+			report.Exhausted = append(report.Exhausted, budget.Service)
+		}
+		alerting := budget.Availability.FastBurnAlert || budget.Availability.SlowBurnAlert
+		if budget.Latency != nil && (budget.Latency.FastBurnAlert || budget.Latency.SlowBurnAlert) {
+			alerting = true
+		}
+		if alerting {
+			report.Alerting = append(report.Alerting, budget.Service)
+		}
+	}
+	return report, nil
+}
@@ -0,0 +1,227 @@
+package aggregator
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"analyticsai/ai-service/analytics/parser"
+)
+
+// DefaultSessionGap is the inactivity period after which a client's next
+// request starts a new session.
+const DefaultSessionGap = 30 * time.Minute
+
+// maxJourneySteps caps how many pages of a session form its journey.
+const maxJourneySteps = 5
+
+var (
+	sessionIDKeys = []string{"session_id", "sessionId", "sid"}
+	userIDKeys    = []string{"user_id", "userId", "uid"}
+)
+
+type Session struct {
+	ID       string   `json:"id"`
+	Key      string   `json:"key"` // session ID, user ID, or IP + user agent
+	Start    string   `json:"start"`
+	End      string   `json:"end"`
+	Pages    []string `json:"pages"` // consecutive repeats collapsed
+	Requests int      `json:"requests"`
+	Errors   int      `json:"errors"`
+}
+
+type JourneyPath struct {
+	Steps    []string `json:"steps"`
+	Sessions int      `json:"sessions"`
+}
+
+type Transition struct {
+	From  string `json:"from"`
+	To    string `json:"to"`
+	Count int    `json:"count"`
+}
+
+type ExitPage struct {
+	Path     string  `json:"path"`
+	Views    int     `json:"views"`
+	Exits    int     `json:"exits"`
+	ExitRate float64 `json:"exit_rate"` // percent
+}
+
+type JourneyReport struct {
+	Sessions       int           `json:"sessions"`
+	AvgPages       float64       `json:"avg_pages_per_session"`
+	AvgDurationSec float64       `json:"avg_session_duration_seconds"`
+	BounceRate     float64       `json:"bounce_rate"` // percent of single-page sessions
+	CommonJourneys []JourneyPath `json:"common_journeys"`
+	TopTransitions []Transition  `json:"top_transitions"`
+	DropOffPoints  []ExitPage    `json:"drop_off_points"`
+	UXInsights     []string      `json:"ux_insights"`
+}
+
+// sessionKey identifies who made a request: an explicit session ID, a user
+// ID, or failing those the client IP and user agent.
+func sessionKey(log LogEntry) string {
+	if id := MetadataValue(log, sessionIDKeys...); id != "" {
+		return "session:" + id
+	}
+	if id := MetadataValue(log, userIDKeys...); id != "" {
+		return "user:" + id
+	}
+	if ip := ClientIP(log); ip != "" {
+		return "client:" + ip + "|" + UserAgent(log)
+	}
+	return ""
+}
+
+// BuildSessions groups timestamped entries into sessions by sessionKey,
+// splitting a key's activity wherever it pauses for longer than gap.
+// Entries without a key or a parseable timestamp are skipped.
+func BuildSessions(logs []LogEntry, gap time.Duration) []Session {
+	if gap <= 0 {
+		gap = DefaultSessionGap
+	}
+
+	type event struct {
+		t   time.Time
+		log LogEntry
+	}
+	byKey := make(map[string][]event)
+	for _, log := range logs {
+		key := sessionKey(log)
+		t, ok := parser.ParseTimestamp(log.Timestamp)
+		if key == "" || !ok {
+			continue
+		}
+		byKey[key] = append(byKey[key], event{t, log})
+	}
+
+	keys := make([]string, 0, len(byKey))
+	for key := range byKey {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	var sessions []Session
+	for _, key := range keys {
+		events := byKey[key]
+		sort.SliceStable(events, func(i, j int) bool { return events[i].t.Before(events[j].t) })
+
+		var current *Session
+		var last time.Time
+		for _, e := range events {
+			if current == nil || e.t.Sub(last) > gap {
+				if current != nil {
+					sessions = append(sessions, *current)
+				}
+				current = &Session{
+					ID:    fmt.Sprintf("s%d", len(sessions)+1),
+					Key:   key,
+					Start: e.t.Format(time.RFC3339),
+				}
+			}
+			current.Requests++
+			if e.log.Status >= 400 {
+				current.Errors++
+			}
+			if n := len(current.Pages); n == 0 || current.Pages[n-1] != e.log.Path {
+				current.Pages = append(current.Pages, e.log.Path)
+			}
+			current.End = e.t.Format(time.RFC3339)
+			last = e.t
+		}
+		sessions = append(sessions, *current)
+	}
+	return sessions
+}
+
+// SummarizeJourneys computes navigation statistics over sessions.
+func SummarizeJourneys(sessions []Session) *JourneyReport {
+	report := &JourneyReport{
+		Sessions:       len(sessions),
+		CommonJourneys: []JourneyPath{},
+		TopTransitions: []Transition{},
+		DropOffPoints:  []ExitPage{},
+		UXInsights:     []string{},
+	}
+	if len(sessions) == 0 {
+		return report
+	}
+
+	journeys := make(map[string]int)
+	transitions := make(map[[2]string]int)
+	views := make(map[string]int)
+	exits := make(map[string]int)
+	var pages, bounces int
+	var duration time.Duration
+
+	for _, s := range sessions {
+		pages += len(s.Pages)
+		if len(s.Pages) == 1 {
+			bounces++
+		}
+		start, _ := time.Parse(time.RFC3339, s.Start)
+		end, _ := time.Parse(time.RFC3339, s.End)
+		duration += end.Sub(start)
+
+		steps := s.Pages
+		if len(steps) > maxJourneySteps {
+			steps = steps[:maxJourneySteps]
+		}
+		journeys[strings.Join(steps, "\x00")]++
+		for i, page := range s.Pages {
+			views[page]++
+			if i > 0 {
+				transitions[[2]string{s.Pages[i-1], page}]++
+			}
+		}
+		exits[s.Pages[len(s.Pages)-1]]++
+	}
+
+	n := float64(len(sessions))
+	report.AvgPages = round2(float64(pages) / n)
+	report.AvgDurationSec = round2(duration.Seconds() / n)
+	report.BounceRate = round2(float64(bounces) / n * 100)
+
+	for _, key := range topKeys(journeys, 10) {
+		report.CommonJourneys = append(report.CommonJourneys, JourneyPath{
+			Steps:    strings.Split(key, "\x00"),
+			Sessions: journeys[key],
+		})
+	}
+
+	for pair, count := range transitions {
+		report.TopTransitions = append(report.TopTransitions, Transition{From: pair[0], To: pair[1], Count: count})
+	}
+	sort.Slice(report.TopTransitions, func(i, j int) bool {
+		a, b := report.TopTransitions[i], report.TopTransitions[j]
+		if a.Count != b.Count {
+			return a.Count > b.Count
+		}
+		return a.From+a.To < b.From+b.To
+	})
+	if len(report.TopTransitions) > 15 {
+		report.TopTransitions = report.TopTransitions[:15]
+	}
+
+	for path, v := range views {
+		report.DropOffPoints = append(report.DropOffPoints, ExitPage{
+			Path:     path,
+			Views:    v,
+			Exits:    exits[path],
+			ExitRate: round2(float64(exits[path]) / float64(v) * 100),
+		})
+	}
+	sort.Slice(report.DropOffPoints, func(i, j int) bool {
+		a, b := report.DropOffPoints[i], report.DropOffPoints[j]
+		if a.Exits != b.Exits {
+			return a.Exits > b.Exits
+		}
+		return a.Path < b.Path
+	})
+	if len(report.DropOffPoints) > 10 {
+		report.DropOffPoints = report.DropOffPoints[:10]
+	}
+	return report
+}
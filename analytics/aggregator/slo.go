@@ -0,0 +1,239 @@
+package aggregator
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"time"
+
+	"analyticsai/ai-service/analytics/parser"
+)
+
+// Multi-window burn-rate alert thresholds from the Google SRE workbook:
+// a 1h burn of 14.4x or a 6h burn of 6x exhausts a 30-day budget early.
+const (
+	fastBurnAlertRate = 14.4
+	slowBurnAlertRate = 6.0
+)
+
+type SLOTarget struct {
+	Availability   float64 `json:"availability"`              // percent of non-5xx requests, e.g. 99.9
+	LatencyMs      int64   `json:"latency_ms,omitempty"`      // latency threshold, optional
+	LatencyPercent float64 `json:"latency_percent,omitempty"` // percent of requests that must be under LatencyMs
+	FastWindow     string  `json:"fast_window,omitempty"`     // defaults to 1h
+	SlowWindow     string  `json:"slow_window,omitempty"`     // defaults to 6h
+}
+
+type SLIReport struct {
+	Target          float64 `json:"target"`
+	Actual          float64 `json:"actual"`
+	Compliant       bool    `json:"compliant"`
+	GoodRequests    int     `json:"good_requests"`
+	TotalRequests   int     `json:"total_requests"`
+	AllowedBad      float64 `json:"allowed_bad_requests"`
+	BudgetConsumed  float64 `json:"budget_consumed_percent"`
+	BudgetRemaining float64 `json:"budget_remaining_percent"`
+	FastBurnRate    float64 `json:"fast_burn_rate"`
+	SlowBurnRate    float64 `json:"slow_burn_rate"`
+	FastBurnAlert   bool    `json:"fast_burn_alert"`
+	SlowBurnAlert   bool    `json:"slow_burn_alert"`
+}
+
+type EndpointBudget struct {
+	Path              string   `json:"path"`
+	Requests          int      `json:"requests"`
+	BadRequests       int      `json:"bad_requests"`
+	BudgetShare       float64  `json:"budget_share_percent"`
+	Availability      float64  `json:"availability"`
+	LatencyCompliance *float64 `json:"latency_compliance,omitempty"`
+}
+
+type SLOReport struct {
+	Start           string           `json:"start,omitempty"`
+	End             string           `json:"end,omitempty"`
+	FastWindow      string           `json:"fast_window"`
+	SlowWindow      string           `json:"slow_window"`
+	Availability    SLIReport        `json:"availability"`
+	Latency         *SLIReport       `json:"latency,omitempty"`
+	Endpoints       []EndpointBudget `json:"endpoints"`
+	Services        []ServiceBudget  `json:"services,omitempty"` // set when entries name their service
+	Recommendations []string         `json:"recommendations"`
+}
+
+// Validate checks the targets and fills in default windows.
+func (t *SLOTarget) Validate() error {
+	if t.Availability <= 0 || t.Availability >= 100 {
+		return fmt.Errorf("availability target must be between 0 and 100 (exclusive), got %v", t.Availability)
+	}
+	if t.LatencyMs < 0 {
+		return fmt.Errorf("latency_ms must not be negative")
+	}
+	if t.LatencyMs > 0 && (t.LatencyPercent <= 0 || t.LatencyPercent >= 100) {
+		return fmt.Errorf("latency_percent must be between 0 and 100 (exclusive) when latency_ms is set")
+	}
+	if t.FastWindow == "" {
+		t.FastWindow = "1h"
+	}
+	if t.SlowWindow == "" {
+		t.SlowWindow = "6h"
+	}
+	for _, w := range []string{t.FastWindow, t.SlowWindow} {
+		if d, err := time.ParseDuration(w); err != nil || d <= 0 {
+			return fmt.Errorf("invalid window %q", w)
+		}
+	}
+	return nil
+}
+
+type sliCounter struct {
+	good, total int
+}
+
+func (c sliCounter) ratio() float64 {
+	if c.total == 0 {
+		return 1
+	}
+	return float64(c.good) / float64(c.total)
+}
+
+func round2(v float64) float64 {
+	return math.Round(v*100) / 100
+}
+
+// buildSLI turns overall and windowed counts into a report for one SLI.
+func buildSLI(target float64, all, fast, slow sliCounter) SLIReport {
+	allowedFraction := 1 - target/100
+	allowedBad := allowedFraction * float64(all.total)
+	bad := float64(all.total - all.good)
+
+	consumed := 0.0
+	if allowedBad > 0 {
+		consumed = bad / allowedBad * 100
+	}
+
+	burn := func(c sliCounter) float64 {
+		if c.total == 0 {
+			return 0
+		}
+		return (1 - c.ratio()) / allowedFraction
+	}
+
+	report := SLIReport{
+		Target:          target,
+		Actual:          round2(all.ratio() * 100),
+		Compliant:       all.ratio()*100 >= target,
+		GoodRequests:    all.good,
+		TotalRequests:   all.total,
+		AllowedBad:      round2(allowedBad),
+		BudgetConsumed:  round2(consumed),
+		BudgetRemaining: round2(math.Max(0, 100-consumed)),
+		FastBurnRate:    round2(burn(fast)),
+		SlowBurnRate:    round2(burn(slow)),
+	}
+	report.FastBurnAlert = report.FastBurnRate >= fastBurnAlertRate
+	report.SlowBurnAlert = report.SlowBurnRate >= slowBurnAlertRate
+	return report
+}
+
+// ComputeSLO measures compliance and error-budget consumption against the
+// target, per service as well when entries name their service. Burn-rate
+// windows end at the latest timestamp in the logs. The target must have
+// been validated.
+func ComputeSLO(logs []LogEntry, target SLOTarget) *SLOReport {
+	report := computeSLO(logs, target)
+	if HasServices(logs) {
+		report.Services = serviceBudgets(logs, target, nil)
+	}
+	return report
+}
+
+func computeSLO(logs []LogEntry, target SLOTarget) *SLOReport {
+	fastWindow, _ := time.ParseDuration(target.FastWindow)
+	slowWindow, _ := time.ParseDuration(target.SlowWindow)
+	start, end, hasTime := TimeRange(logs)
+
+	report := &SLOReport{FastWindow: target.FastWindow, SlowWindow: target.SlowWindow}
+	if hasTime {
+		report.Start = start.Format(time.RFC3339)
+		report.End = end.Format(time.RFC3339)
+	}
+
+	var avail, availFast, availSlow, lat, latFast, latSlow sliCounter
+	type endpointCounts struct {
+		avail, lat sliCounter
+		bad        int
+	}
+	byPath := make(map[string]*endpointCounts)
+	totalBad := 0
+
+	for _, log := range logs {
+		availGood := log.Status < 500
+		latGood := target.LatencyMs == 0 || log.Duration <= target.LatencyMs
+
+		inFast, inSlow := false, false
+		if t, ok := parser.ParseTimestamp(log.Timestamp); ok && hasTime {
+			inFast = end.Sub(t) < fastWindow
+			inSlow = end.Sub(t) < slowWindow
+		}
+
+		count := func(c *sliCounter, good bool) {
+			c.total++
+			if good {
+				c.good++
+			}
+		}
+		count(&avail, availGood)
+		count(&lat, latGood)
+		if inFast {
+			count(&availFast, availGood)
+			count(&latFast, latGood)
+		}
+		if inSlow {
+			count(&availSlow, availGood)
+			count(&latSlow, latGood)
+		}
+
+		ep, ok := byPath[log.Path]
+		if !ok {
+			ep = &endpointCounts{}
+			byPath[log.Path] = ep
+		}
+		count(&ep.avail, availGood)
+		count(&ep.lat, latGood)
+		if !availGood || !latGood {
+			ep.bad++
+			totalBad++
+		}
+	}
+
+	report.Availability = buildSLI(target.Availability, avail, availFast, availSlow)
+	if target.LatencyMs > 0 {
+		latency := buildSLI(target.LatencyPercent, lat, latFast, latSlow)
+		report.Latency = &latency
+	}
+
+	for path, ep := range byPath {
+		budget := EndpointBudget{
+			Path:         path,
+			Requests:     ep.avail.total,
+			BadRequests:  ep.bad,
+			Availability: round2(ep.avail.ratio() * 100),
+		}
+		if totalBad > 0 {
+			budget.BudgetShare = round2(float64(ep.bad) / float64(totalBad) * 100)
+		}
+		if target.LatencyMs > 0 {
+			compliance := round2(ep.lat.ratio() * 100)
+			budget.LatencyCompliance = &compliance
+		}
+		report.Endpoints = append(report.Endpoints, budget)
+	}
+	sort.Slice(report.Endpoints, func(i, j int) bool {
+		if report.Endpoints[i].BadRequests != report.Endpoints[j].BadRequests {
+			return report.Endpoints[i].BadRequests > report.Endpoints[j].BadRequests
+		}
+		return report.Endpoints[i].Path < report.Endpoints[j].Path
+	})
+
+	return report
+}
@@ -0,0 +1,83 @@
+package aggregator
+
+import (
+	"math"
+	"sort"
+)
+
+// Percentile returns the p-th percentile (0-100) of durations using the
+// nearest-rank method. durations must be sorted ascending.
+func Percentile(durations []int64, p float64) int64 {
+	if len(durations) == 0 {
+		return 0
+	}
+	rank := int(math.Ceil(p / 100 * float64(len(durations))))
+	if rank < 1 {
+		rank = 1
+	}
+	return durations[rank-1]
+}
+
+// SortDurations sorts durations ascending, as Percentile expects.
+func SortDurations(durations []int64) {
+	sort.Slice(durations, func(i, j int) bool { return durations[i] < durations[j] })
+}
+
+// DimensionStats aggregates requests sharing one value of a dimension such
+// as browser, country or service.
+type DimensionStats struct {
+	Value       string  `json:"value"`
+	Requests    int     `json:"requests"`
+	Errors      int     `json:"errors"`
+	ErrorRate   float64 `json:"error_rate"` // percent
+	AvgDuration int64   `json:"avg_duration"`
+	P95Duration int64   `json:"p95_duration"`
+}
+
+// aggregateBy groups logs by the value key returns, skipping entries for
+// which it returns "". Results are ordered by request count.
+func aggregateBy(logs []LogEntry, key func(i int, log LogEntry) string) []DimensionStats {
+	type data struct {
+		errors    int
+		total     int64
+		durations []int64
+	}
+	groups := make(map[string]*data)
+	for i, log := range logs {
+		k := key(i, log)
+		if k == "" {
+			continue
+		}
+		d, ok := groups[k]
+		if !ok {
+			d = &data{}
+			groups[k] = d
+		}
+		d.durations = append(d.durations, log.Duration)
+		d.total += log.Duration
+		if log.Status >= 400 {
+			d.errors++
+		}
+	}
+
+	stats := make([]DimensionStats, 0, len(groups))
+	for value, d := range groups {
+		SortDurations(d.durations)
+		n := len(d.durations)
+		stats = append(stats, DimensionStats{
+			Value:       value,
+			Requests:    n,
+			Errors:      d.errors,
+			ErrorRate:   round2(float64(d.errors) / float64(n) * 100),
+			AvgDuration: d.total / int64(n),
+			P95Duration: Percentile(d.durations, 95),
+		})
+	}
+	sort.Slice(stats, func(i, j int) bool {
+		if stats[i].Requests != stats[j].Requests {
+			return stats[i].Requests > stats[j].Requests
+		}
+		return stats[i].Value < stats[j].Value
+	})
+	return stats
+}
@@ -0,0 +1,109 @@
+package aggregator
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"time"
+
+	"analyticsai/ai-service/analytics/parser"
+)
+
+type StatusCounts struct {
+	Total   int            `json:"total"`
+	Classes map[string]int `json:"classes"` // "2xx", "4xx", ...
+	Codes   map[string]int `json:"codes"`
+}
+
+type PathStatus struct {
+	Path string `json:"path"`
+	StatusCounts
+}
+
+type StatusBucket struct {
+	Start string `json:"start"`
+	StatusCounts
+}
+
+type StatusReport struct {
+	StatusCounts
+	Paths      []PathStatus   `json:"paths"`
+	Interval   string         `json:"interval,omitempty"`
+	TimeSeries []StatusBucket `json:"time_series,omitempty"`
+}
+
+func newStatusCounts() StatusCounts {
+	return StatusCounts{Classes: make(map[string]int), Codes: make(map[string]int)}
+}
+
+// statusClass returns "2xx"-style classes; codes outside 100-599 are "other".
+func statusClass(status int) string {
+	if status < 100 || status > 599 {
+		return "other"
+	}
+	return fmt.Sprintf("%dxx", status/100)
+}
+
+func (s *StatusCounts) add(status int) {
+	s.Total++
+	s.Classes[statusClass(status)]++
+	s.Codes[strconv.Itoa(status)]++
+}
+
+// BreakdownStatus counts responses per status class and exact code overall,
+// per path, and per time bucket. A zero interval is chosen automatically.
+func BreakdownStatus(logs []LogEntry, interval time.Duration) (*StatusReport, error) {
+	report := &StatusReport{StatusCounts: newStatusCounts()}
+
+	byPath := make(map[string]*PathStatus)
+	for _, log := range logs {
+		report.add(log.Status)
+		p, ok := byPath[log.Path]
+		if !ok {
+			p = &PathStatus{Path: log.Path, StatusCounts: newStatusCounts()}
+			byPath[log.Path] = p
+		}
+		p.add(log.Status)
+	}
+	for _, p := range byPath {
+		report.Paths = append(report.Paths, *p)
+	}
+	sort.Slice(report.Paths, func(i, j int) bool {
+		if report.Paths[i].Total != report.Paths[j].Total {
+			return report.Paths[i].Total > report.Paths[j].Total
+		}
+		return report.Paths[i].Path < report.Paths[j].Path
+	})
+
+	if interval <= 0 {
+		interval = AutoInterval(logs)
+	}
+	if interval <= 0 {
+		return report, nil
+	}
+	// Reuse the time-series alignment so buckets line up with other stats.
+	series, err := BuildTimeSeries(logs, interval)
+	if err != nil {
+		return nil, err
+	}
+	report.Interval = series.Interval
+
+	index := make(map[int64]int, len(series.Buckets))
+	for i, b := range series.Buckets {
+		start, _ := time.Parse(time.RFC3339, b.Start)
+		index[start.Unix()] = i
+		report.TimeSeries = append(report.TimeSeries, StatusBucket{Start: b.Start, StatusCounts: newStatusCounts()})
+	}
+	for _, log := range logs {
+		t, ok := parser.ParseTimestamp(log.Timestamp)
+		if !ok {
+			continue
+		}
+		i, ok := index[bucketStart(t, interval).Unix()]
+		if !ok {
+			return nil, fmt.Errorf("no time bucket for %s", log.Timestamp)
+		}
+		report.TimeSeries[i].add(log.Status)
+	}
+	return report, nil
+}
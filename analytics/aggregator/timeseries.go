@@ -0,0 +1,187 @@
+package aggregator
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"analyticsai/ai-service/analytics/parser"
+)
+
+// maxTimeBuckets bounds the size of a time series so a tiny interval over a
+// long range can't produce an enormous response.
+const maxTimeBuckets = 5000
+
+type TimeBucket struct {
+	Start       string  `json:"start"`
+	Requests    int     `json:"requests"`
+	RequestRate float64 `json:"request_rate"` // requests per minute
+	Errors      int     `json:"errors"`
+	ErrorRate   float64 `json:"error_rate"` // percent
+	AvgDuration int64   `json:"avg_duration"`
+	P95Duration int64   `json:"p95_duration"`
+}
+
+type TimeSeries struct {
+	Interval string       `json:"interval"`
+	Buckets  []TimeBucket `json:"buckets"`
+	Skipped  int          `json:"skipped_entries,omitempty"` // entries without a parseable timestamp
+}
+
+// ParseInterval parses a bucket interval such as "5m", "1h" or "1d".
+func ParseInterval(raw string) (time.Duration, error) {
+	if strings.HasSuffix(raw, "d") {
+		days, err := strconv.Atoi(strings.TrimSuffix(raw, "d"))
+		if err != nil || days <= 0 {
+			return 0, fmt.Errorf("invalid interval %q", raw)
+		}
+		return time.Duration(days) * 24 * time.Hour, nil
+	}
+
+	d, err := time.ParseDuration(raw)
+	if err != nil || d < time.Second {
+		return 0, fmt.Errorf("invalid interval %q", raw)
+	}
+	return d, nil
+}
+
+// FormatInterval formats an interval the way ParseInterval accepts it,
+// e.g. "5m" or "1d".
+func FormatInterval(d time.Duration) string {
+	if d%(24*time.Hour) == 0 {
+		return fmt.Sprintf("%dd", d/(24*time.Hour))
+	}
+	s := d.String()
+	if strings.HasSuffix(s, "m0s") {
+		s = strings.TrimSuffix(s, "0s")
+	}
+	if strings.HasSuffix(s, "h0m") {
+		s = strings.TrimSuffix(s, "0m")
+	}
+	return s
+}
+
+// bucketStart aligns t to interval in t's own UTC offset, so that hourly and
+// daily buckets start on local hour and midnight boundaries.
+func bucketStart(t time.Time, interval time.Duration) time.Time {
+	_, offset := t.Zone()
+	shift := time.Duration(offset) * time.Second
+	return t.Add(shift).Truncate(interval).Add(-shift)
+}
+
+// nextBucketStart returns the start of the bucket following the one at
+// start. Whole days are stepped by the calendar, so that daily buckets stay
+// on local midnight across daylight saving changes, and the result is
+// realigned to its own UTC offset.
+func nextBucketStart(start time.Time, interval time.Duration) time.Time {
+	var next time.Time
+	if interval%(24*time.Hour) == 0 {
+		next = bucketStart(start.AddDate(0, 0, int(interval/(24*time.Hour))), interval)
+	} else {
+		next = bucketStart(start.Add(interval), interval)
+	}
+	if !next.After(start) {
+		next = start.Add(interval)
+	}
+	return next
+}
+
+// BuildTimeSeries groups logs into buckets aligned to the interval in each
+// entry's UTC offset. Buckets with no traffic inside the covered range are
+// included so charts stay continuous. When the offset changes within the
+// range, as entries with fixed offsets do across daylight saving changes,
+// every bucket holding entries is still visited: empty buckets are only
+// filled in up to the next one.
+func BuildTimeSeries(logs []LogEntry, interval time.Duration) (*TimeSeries, error) {
+	series := &TimeSeries{Interval: FormatInterval(interval), Buckets: []TimeBucket{}}
+
+	type bucketData struct {
+		start     time.Time
+		errors    int
+		durations []int64
+		total     int64
+	}
+	buckets := make(map[int64]*bucketData)
+	for _, log := range logs {
+		t, ok := parser.ParseTimestamp(log.Timestamp)
+		if !ok {
+			series.Skipped++
+			continue
+		}
+
+		start := bucketStart(t, interval)
+		b, ok := buckets[start.Unix()]
+		if !ok {
+			b = &bucketData{start: start}
+			buckets[start.Unix()] = b
+		}
+		b.durations = append(b.durations, log.Duration)
+		b.total += log.Duration
+		if log.Status >= 400 {
+			b.errors++
+		}
+	}
+
+	if len(buckets) == 0 {
+		return series, nil
+	}
+	keys := make([]int64, 0, len(buckets))
+	for key := range buckets {
+		keys = append(keys, key)
+	}
+	sort.Slice(keys, func(i, j int) bool { return keys[i] < keys[j] })
+
+	step := int64(interval / time.Second)
+	if count := (keys[len(keys)-1]-keys[0])/step + 1; count > maxTimeBuckets {
+		return nil, fmt.Errorf("%w: interval %s produces %d buckets over this time range (max %d)", ErrInvalidInput, series.Interval, count, maxTimeBuckets)
+	}
+
+	minutes := interval.Minutes()
+	start := buckets[keys[0]].start
+	for i := 0; ; {
+		bucket := TimeBucket{Start: start.Format(time.RFC3339)}
+		if start.Unix() == keys[i] {
+			b := buckets[keys[i]]
+			SortDurations(b.durations)
+			bucket.Requests = len(b.durations)
+			bucket.RequestRate = round2(float64(bucket.Requests) / minutes)
+			bucket.Errors = b.errors
+			bucket.ErrorRate = round2(float64(b.errors) / float64(bucket.Requests) * 100)
+			bucket.AvgDuration = b.total / int64(bucket.Requests)
+			bucket.P95Duration = Percentile(b.durations, 95)
+			i++
+		}
+		series.Buckets = append(series.Buckets, bucket)
+		if i == len(keys) {
+			break
+		}
+		if len(series.Buckets) == maxTimeBuckets {
+			return nil, fmt.Errorf("%w: interval %s produces more than %d buckets over this time range", ErrInvalidInput, series.Interval, maxTimeBuckets)
+		}
+		start = nextBucketStart(start, interval)
+		if next := buckets[keys[i]].start; !start.Before(next) {
+			start = next
+		}
+	}
+	return series, nil
+}
+
+// TimeRange returns the earliest and latest parseable timestamps in logs.
+func TimeRange(logs []LogEntry) (start, end time.Time, ok bool) {
+	for _, log := range logs {
+		t, parsed := parser.ParseTimestamp(log.Timestamp)
+		if !parsed {
+			continue
+		}
+		if !ok || t.Before(start) {
+			start = t
+		}
+		if !ok || t.After(end) {
+			end = t
+		}
+		ok = true
+	}
+	return start, end, ok
+}
@@ -0,0 +1,59 @@
+package aggregator
+
+import (
+	"fmt"
+	"sort"
+)
+
+// Ranking criteria accepted by TopEndpoints.
+const (
+	RankByTraffic = "traffic"
+	RankByErrors  = "errors"
+	RankByLatency = "latency"
+)
+
+type RankedEndpoint struct {
+	Rank int    `json:"rank"`
+	Path string `json:"path,omitempty"` // set when grouping by path
+	DimensionStats
+}
+
+// TopEndpoints ranks the groups formed by g (paths by default) by request
+// count, error count (ties broken by error rate) or p95 latency (ties broken
+// by average latency) and returns the first n.
+func TopEndpoints(logs []LogEntry, g GroupBy, by string, n int) ([]RankedEndpoint, error) {
+	stats := GroupStats(logs, g)
+
+	switch by {
+	case RankByTraffic, "":
+		// aggregateBy already orders by request count.
+	case RankByErrors:
+		sort.SliceStable(stats, func(i, j int) bool {
+			if stats[i].Errors != stats[j].Errors {
+				return stats[i].Errors > stats[j].Errors
+			}
+			return stats[i].ErrorRate > stats[j].ErrorRate
+		})
+	case RankByLatency:
+		sort.SliceStable(stats, func(i, j int) bool {
+			if stats[i].P95Duration != stats[j].P95Duration {
+				return stats[i].P95Duration > stats[j].P95Duration
+			}
+			return stats[i].AvgDuration > stats[j].AvgDuration
+		})
+	default:
+		return nil, fmt.Errorf("%w: unknown ranking %q (use traffic, errors or latency)", ErrInvalidInput, by)
+	}
+
+	if n > 0 && len(stats) > n {
+		stats = stats[:n]
+	}
+	ranked := make([]RankedEndpoint, len(stats))
+	for i, s := range stats {
+		ranked[i] = RankedEndpoint{Rank: i + 1, DimensionStats: s}
+		if g.IsPath() {
+			ranked[i].Path = s.Value
+		}
+	}
+	return ranked, nil
+}
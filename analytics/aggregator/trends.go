@@ -0,0 +1,213 @@
+package aggregator
+
+import (
+	"math"
+	"sort"
+	"time"
+)
+
+const (
+	maxSnapshotEndpoints = 50   // busiest paths kept in a metrics snapshot
+	slowEndpointP95      = 1000 // p95 in ms above which an endpoint counts as slow
+)
+
+const (
+	TrendImproving  = "improving"
+	TrendRegressing = "regressing"
+	TrendStable     = "stable"
+	TrendMixed      = "mixed"
+)
+
+// MetricsSnapshot is a compact set of deterministic metrics stored with an
+// analysis so that later analyses of the same source can be compared with
+// it.
+type MetricsSnapshot struct {
+	Requests      int              `json:"requests"`
+	ErrorRate     float64          `json:"error_rate"` // percent
+	AvgDuration   int64            `json:"avg_duration"`
+	P95Duration   int64            `json:"p95_duration"`
+	SlowEndpoints int              `json:"slow_endpoints"`      // endpoints with p95 above 1000ms
+	Issues        int              `json:"issues"`              // issues reported by the AI analysis
+	Endpoints     []DimensionStats `json:"endpoints,omitempty"` // busiest paths
+}
+
+// Snapshot computes the metrics snapshot of logs. issues is the number of
+// issues the AI analysis of logs reported.
+func Snapshot(logs []LogEntry, issues int) *MetricsSnapshot {
+	snapshot := &MetricsSnapshot{Issues: issues, Endpoints: []DimensionStats{}}
+	if overall := aggregateBy(logs, func(int, LogEntry) string { return "all" }); len(overall) == 1 {
+		snapshot.Requests = overall[0].Requests
+		snapshot.ErrorRate = overall[0].ErrorRate
+		snapshot.AvgDuration = overall[0].AvgDuration
+		snapshot.P95Duration = overall[0].P95Duration
+	}
+	for _, endpoint := range GroupStats(logs, nil) {
+		if endpoint.P95Duration > slowEndpointP95 {
+			snapshot.SlowEndpoints++
+		}
+		if len(snapshot.Endpoints) < maxSnapshotEndpoints {
+			snapshot.Endpoints = append(snapshot.Endpoints, endpoint)
+		}
+	}
+	return snapshot
+}
+
+// TrendPoint is one stored analysis in a trend.
+type TrendPoint struct {
+	AnalysisID string           `json:"analysis_id"`
+	CreatedAt  time.Time        `json:"created_at"`
+	Metrics    *MetricsSnapshot `json:"metrics"`
+}
+
+// MetricTrend compares a metric in the oldest and newest analysis.
+type MetricTrend struct {
+	Metric    string    `json:"metric"`
+	Values    []float64 `json:"values"` // oldest first
+	Change    float64   `json:"change"` // newest minus oldest
+	Direction string    `json:"direction"`
+}
+
+// EndpointTrend compares an endpoint present in both the oldest and newest
+// analysis.
+type EndpointTrend struct {
+	Path      string  `json:"path"`
+	ErrorRate float64 `json:"error_rate_change"` // percentage points
+	P95       int64   `json:"p95_change"`        // ms
+	Direction string  `json:"direction"`
+}
+
+type TrendReport struct {
+	Source     string          `json:"source"`
+	Kind       string          `json:"kind"`
+	Points     []TrendPoint    `json:"points"`
+	Metrics    []MetricTrend   `json:"metrics"`
+	Regressed  []EndpointTrend `json:"regressed_endpoints"`
+	Improved   []EndpointTrend `json:"improved_endpoints"`
+	Direction  string          `json:"direction"`
+	Commentary string          `json:"commentary"`
+}
+
+// trendMetric describes how a snapshot metric is compared. Lower values are
+// better for every metric; tolerance is the change below which it counts as
+// stable.
+type trendMetric struct {
+	name      string
+	value     func(*MetricsSnapshot) float64
+	tolerance func(first float64) float64
+}
+
+var trendMetrics = []trendMetric{
+	{"error_rate", func(m *MetricsSnapshot) float64 { return m.ErrorRate }, func(float64) float64 { return 0.5 }},
+	{"p95_duration", func(m *MetricsSnapshot) float64 { return float64(m.P95Duration) }, relativeTolerance},
+	{"avg_duration", func(m *MetricsSnapshot) float64 { return float64(m.AvgDuration) }, relativeTolerance},
+	{"slow_endpoints", func(m *MetricsSnapshot) float64 { return float64(m.SlowEndpoints) }, func(float64) float64 { return 0.5 }},
+	{"issues", func(m *MetricsSnapshot) float64 { return float64(m.Issues) }, func(float64) float64 { return 0.5 }},
+}
+
+// relativeTolerance treats changes within 10% (and at least 10ms) as noise.
+func relativeTolerance(first float64) float64 {
+	return math.Max(first*0.1, 10)
+}
+
+// direction classifies a change of a metric where lower values are better.
+func direction(change, tolerance float64) string {
+	switch {
+	case change > tolerance:
+		return TrendRegressing
+	case change < -tolerance:
+		return TrendImproving
+	}
+	return TrendStable
+}
+
+// ComputeTrend compares points, which must be ordered oldest first, and
+// reports how the overall metrics and individual endpoints moved between
+// the oldest and newest analysis.
+func ComputeTrend(points []TrendPoint) *TrendReport {
+	report := &TrendReport{
+		Points:    points,
+		Metrics:   []MetricTrend{},
+		Regressed: []EndpointTrend{},
+		Improved:  []EndpointTrend{},
+		Direction: TrendStable,
+	}
+	if len(points) < 2 {
+		return report
+	}
+	first, last := points[0].Metrics, points[len(points)-1].Metrics
+
+	regressing, improving := 0, 0
+	for _, metric := range trendMetrics {
+		trend := MetricTrend{Metric: metric.name}
+		for _, p := range points {
+			trend.Values = append(trend.Values, metric.value(p.Metrics))
+		}
+		trend.Change = round2(metric.value(last) - metric.value(first))
+		trend.Direction = direction(trend.Change, metric.tolerance(metric.value(first)))
+		switch trend.Direction {
+		case TrendRegressing:
+			regressing++
+		case TrendImproving:
+			improving++
+		}
+		report.Metrics = append(report.Metrics, trend)
+	}
+	switch {
+	case regressing > 0 && improving == 0:
+		report.Direction = TrendRegressing
+	case improving > 0 && regressing == 0:
+		report.Direction = TrendImproving
+	case regressing > 0:
+		report.Direction = TrendMixed
+	}
+
+	before := make(map[string]DimensionStats, len(first.Endpoints))
+	for _, e := range first.Endpoints {
+		before[e.Value] = e
+	}
+	for _, e := range last.Endpoints {
+		old, ok := before[e.Value]
+		if !ok {
+			continue
+		}
+		trend := EndpointTrend{
+			Path:      e.Value,
+			ErrorRate: round2(e.ErrorRate - old.ErrorRate),
+			P95:       e.P95Duration - old.P95Duration,
+			Direction: endpointDirection(old, e),
+		}
+		switch trend.Direction {
+		case TrendRegressing:
+			report.Regressed = append(report.Regressed, trend)
+		case TrendImproving:
+			report.Improved = append(report.Improved, trend)
+		}
+	}
+	sortEndpointTrends(report.Regressed, true)
+	sortEndpointTrends(report.Improved, false)
+	return report
+}
+
+// endpointDirection classifies how an endpoint moved from before to after
+// under the default regression thresholds.
+func endpointDirection(before, after DimensionStats) string {
+	return DefaultRegressionThresholds.classify(before, after)
+}
+
+// sortEndpointTrends orders trends by error-rate change, then p95 change,
+// largest regressions (or improvements) first.
+func sortEndpointTrends(trends []EndpointTrend, worstFirst bool) {
+	sort.Slice(trends, func(i, j int) bool {
+		a, b := trends[i], trends[j]
+		if !worstFirst {
+			a, b = b, a
+		}
+		if a.ErrorRate != b.ErrorRate {
+			return a.ErrorRate > b.ErrorRate
+		}
+		if a.P95 != b.P95 {
+			return a.P95 > b.P95
+		}
+		return trends[i].Path < trends[j].Path
+	})
+}
@@ -0,0 +1,132 @@
+package aggregator
+
+import (
+	"regexp"
+	"strings"
+)
+
+// Metadata keys written by EnrichUserAgents.
+const (
+	MetaBrowser = "ua_browser"
+	MetaOS      = "ua_os"
+	MetaDevice  = "ua_device"
+)
+
+type UserAgentInfo struct {
+	Browser        string `json:"browser"`
+	BrowserVersion string `json:"browser_version,omitempty"`
+	OS             string `json:"os"`
+	Device         string `json:"device"` // desktop, mobile, tablet or bot
+}
+
+type UserAgentBreakdown struct {
+	Browsers []DimensionStats `json:"browsers"`
+	OS       []DimensionStats `json:"os"`
+	Devices  []DimensionStats `json:"devices"`
+}
+
+// Browser rules are checked in order; several browsers embed the tokens of
+// the ones they are based on (Edge and Opera claim to be Chrome, Chrome
+// claims to be Safari), so the more specific ones come first.
+var browserRules = []struct {
+	name    string
+	pattern *regexp.Regexp
+}{
+
+	{"Edge", regexp.MustCompile(`Edg(?:e|A|iOS)?/(\d+)`)},
+	{"Opera", regexp.MustCompile(`(?:OPR|Opera)/(\d+)`)},
+	{"Samsung Internet", regexp.MustCompile(`SamsungBrowser/(\d+)`)},
+	{"Firefox", regexp.MustCompile(`(?:Firefox|FxiOS)/(\d+)`)},
+	{"Chrome", regexp.MustCompile(`(?:Chrome|CriOS)/(\d+)`)},
+	{"Safari", regexp.MustCompile(`Version/(\d+).*Safari/`)},
+	{"Internet Explorer", regexp.MustCompile(`(?:MSIE |Trident/.*rv:)(\d+)`)},
+}
+
+var osRules = []struct {
+	name    string
+	pattern *regexp.Regexp
+}{
+
+	{"iOS", regexp.MustCompile(`iPhone|iPad|iPod`)},
+	{"Android", regexp.MustCompile(`Android`)},
+	{"Windows", regexp.MustCompile(`Windows`)},
+	{"macOS", regexp.MustCompile(`Mac OS X|Macintosh`)},
+	{"ChromeOS", regexp.MustCompile(`CrOS`)},
+	{"Linux", regexp.MustCompile(`Linux`)},
+}
+
+// ParseUserAgent extracts browser, OS and device type from a user-agent
+// string using lightweight pattern matching.
+func ParseUserAgent(ua string) UserAgentInfo {
+	info := UserAgentInfo{Browser: "Other", OS: "Other", Device: "desktop"}
+	if class, _ := classifyAgent(ua); class != TrafficHuman {
+		info.Device = "bot"
+	}
+
+	for _, rule := range browserRules {
+		if m := rule.pattern.FindStringSubmatch(ua); m != nil {
+			info.Browser, info.BrowserVersion = rule.name, m[1]
+			break
+		}
+	}
+	for _, rule := range osRules {
+		if rule.pattern.MatchString(ua) {
+			info.OS = rule.name
+			break
+		}
+	}
+
+	if info.Device != "bot" {
+		switch {
+		case strings.Contains(ua, "iPad") || strings.Contains(ua, "Tablet") ||
+			(strings.Contains(ua, "Android") && !strings.Contains(ua, "Mobile")):
+			info.Device = "tablet"
+		case strings.Contains(ua, "Mobi") || strings.Contains(ua, "iPhone"):
+			info.Device = "mobile"
+		}
+	}
+	return info
+}
+
+// EnrichUserAgents parses each entry's user agent into the ua_browser,
+// ua_os and ua_device Metadata fields. It reports whether any entry had a
+// user agent. Entries get a copy of their Metadata before the first write,
+// so maps shared with the caller, such as those of a log buffer, are left
+// alone.
+func EnrichUserAgents(logs []LogEntry) bool {
+	found := false
+	for i := range logs {
+		ua := UserAgent(logs[i])
+		if ua == "" {
+			continue
+		}
+		found = true
+		info := ParseUserAgent(ua)
+		logs[i].Metadata = cloneMetadata(logs[i].Metadata, 3)
+		logs[i].Metadata[MetaBrowser] = info.Browser
+		logs[i].Metadata[MetaOS] = info.OS
+		logs[i].Metadata[MetaDevice] = info.Device
+	}
+	return found
+}
+
+// cloneMetadata returns a copy of metadata with room for extra more keys.
+func cloneMetadata(metadata map[string]string, extra int) map[string]string {
+	clone := make(map[string]string, len(metadata)+extra)
+	for k, v := range metadata {
+		clone[k] = v
+	}
+	return clone
+}
+
+// BreakdownUserAgents aggregates traffic by the fields EnrichUserAgents set.
+func BreakdownUserAgents(logs []LogEntry) *UserAgentBreakdown {
+	by := func(key string) []DimensionStats {
+		return aggregateBy(logs, func(_ int, log LogEntry) string { return log.Metadata[key] })
+	}
+	return &UserAgentBreakdown{
+		Browsers: by(MetaBrowser),
+		OS:       by(MetaOS),
+		Devices:  by(MetaDevice),
+	}
+}
@@ -0,0 +1,288 @@
+package analytics
+
+import (
+	"maps"
+	"regexp"
+	"sort"
+	"sync"
+	"time"
+)
+
+// bufferName matches valid log buffer names.
+var bufferName = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9_.-]{0,63}$`)
+
+// ValidBufferName reports whether name can name a log buffer: up to 64
+// letters, digits, '_', '.' and '-', starting with a letter or digit.
+func ValidBufferName(name string) bool {
+	return bufferName.MatchString(name)
+}
+
+// LogBuffer is a rolling window of log entries received over time, bounded
+// by entry count and by age. It is safe for concurrent use.
+type LogBuffer struct {
+	mu         sync.Mutex
+	maxEntries int
+	maxAge     time.Duration
+	entries    []bufferedEntry
+	start      int // index of the oldest kept entry in entries
+	appended   int64
+	evicted    int64
+	last       time.Time
+
+	journal BufferJournal
+	stale   int // evicted entries the journal still holds
+}
+
+type bufferedEntry struct {
+	log      LogEntry
+	received time.Time
+}
+
+// BufferedBatch is a set of log entries received together.
+type BufferedBatch struct {
+	Received time.Time  `json:"received"`
+	Logs     []LogEntry `json:"logs"`
+}
+
+// BufferJournal persists the contents of a LogBuffer, so that it can be
+// restored after a restart.
+type BufferJournal interface {
+	// Append records a batch added to the buffer.
+	Append(batch BufferedBatch) error
+	// Rewrite replaces everything recorded with the buffer's current
+	// contents, dropping evicted entries.
+	Rewrite(batches []BufferedBatch) error
+}
+
+// BufferStats describes the contents of a LogBuffer.
+type BufferStats struct {
+	Entries      int    `json:"entries"`
+	MaxEntries   int    `json:"max_entries"`
+	MaxAge       string `json:"max_age,omitempty"`
+	Appended     int64  `json:"appended"` // entries received since the buffer was created
+	Evicted      int64  `json:"evicted"`  // entries dropped for size or age
+	OldestEntry  string `json:"oldest_received,omitempty"`
+	LastReceived string `json:"last_received,omitempty"`
+}
+
+// NewLogBuffer returns a buffer keeping at most maxEntries entries, none
+// received longer than maxAge ago. A zero maxAge keeps entries until they
+// are pushed out by newer ones.
+func NewLogBuffer(maxEntries int, maxAge time.Duration) *LogBuffer {
+	return &LogBuffer{maxEntries: maxEntries, maxAge: maxAge}
+}
+
+// SetJournal makes the buffer record every batch appended from now on in
+// j.
+func (b *LogBuffer) SetJournal(j BufferJournal) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.journal = j
+}
+
+// Append adds logs to the buffer, evicting the oldest entries beyond its
+// size. The error is that of the journal; the logs are buffered either way.
+func (b *LogBuffer) Append(logs []LogEntry) error {
+	if len(logs) == 0 {
+		return nil
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	now := time.Now().UTC()
+	b.add(BufferedBatch{Received: now, Logs: logs})
+	b.appended += int64(len(logs))
+	b.expire(now)
+	if b.journal == nil {
+		return nil
+	}
+	// Rewrite the journal once it holds more evicted entries than the
+	// buffer can keep, so that it doesn't grow without bound.
+	if b.stale > b.maxEntries {
+		if err := b.journal.Rewrite(b.batches()); err != nil {
+			return err
+		}
+		b.stale = 0
+		return nil
+	}
+	return b.journal.Append(BufferedBatch{Received: now, Logs: logs})
+}
+
+// Restore adds batches read back from a journal, oldest first, keeping
+// their received times.
+func (b *LogBuffer) Restore(batches []BufferedBatch) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	for _, batch := range batches {
+		b.add(batch)
+	}
+	b.expire(time.Now().UTC())
+}
+
+// add appends batch and evicts the oldest entries beyond the buffer's size.
+// b.mu must be held.
+func (b *LogBuffer) add(batch BufferedBatch) {
+	for _, log := range batch.Logs {
+		b.entries = append(b.entries, bufferedEntry{log: log, received: batch.Received})
+	}
+	if batch.Received.After(b.last) {
+		b.last = batch.Received
+	}
+	if excess := len(b.entries) - b.start - b.maxEntries; excess > 0 {
+		b.start += excess
+		b.evicted += int64(excess)
+		b.stale += excess
+	}
+}
+
+// expire drops entries older than maxAge and compacts the backing slice
+// once most of it is unused. b.mu must be held.
+func (b *LogBuffer) expire(now time.Time) {
+	if b.maxAge > 0 {
+		cutoff := now.Add(-b.maxAge)
+		n := sort.Search(len(b.entries)-b.start, func(i int) bool {
+			return !b.entries[b.start+i].received.Before(cutoff)
+		})
+		b.start += n
+		b.evicted += int64(n)
+		b.stale += n
+	}
+	if b.start > len(b.entries)/2 {
+		b.entries = append([]bufferedEntry(nil), b.entries[b.start:]...)
+		b.start = 0
+	}
+}
+
+// Entries returns a copy of the buffered entries, oldest first. Their
+// metadata maps are copies too, so that analyses running concurrently on
+// the same buffer can enrich them.
+func (b *LogBuffer) Entries() []LogEntry {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.expire(time.Now().UTC())
+	logs := make([]LogEntry, 0, len(b.entries)-b.start)
+	for _, e := range b.entries[b.start:] {
+		log := e.log
+		log.Metadata = maps.Clone(log.Metadata)
+		logs = append(logs, log)
+	}
+	return logs
+}
+
+// Batches returns the buffered entries grouped by the time they were
+// received, oldest first.
+func (b *LogBuffer) Batches() []BufferedBatch {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.expire(time.Now().UTC())
+	return b.batches()
+}
+
+// batches groups the kept entries by received time. b.mu must be held.
+func (b *LogBuffer) batches() []BufferedBatch {
+	var batches []BufferedBatch
+	for _, e := range b.entries[b.start:] {
+		if n := len(batches); n > 0 && batches[n-1].Received.Equal(e.received) {
+			batches[n-1].Logs = append(batches[n-1].Logs, e.log)
+			continue
+		}
+		batches = append(batches, BufferedBatch{Received: e.received, Logs: []LogEntry{e.log}})
+	}
+	return batches
+}
+
+// Stats describes the buffer's current contents.
+func (b *LogBuffer) Stats() BufferStats {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.expire(time.Now().UTC())
+	stats := BufferStats{
+		Entries:    len(b.entries) - b.start,
+		MaxEntries: b.maxEntries,
+		Appended:   b.appended,
+		Evicted:    b.evicted,
+	}
+	if b.maxAge > 0 {
+		stats.MaxAge = b.maxAge.String()
+	}
+	if stats.Entries > 0 {
+		stats.OldestEntry = b.entries[b.start].received.Format(time.RFC3339)
+	}
+	if !b.last.IsZero() {
+		stats.LastReceived = b.last.Format(time.RFC3339)
+	}
+	return stats
+}
+
+// BufferRegistry holds the named log buffers of each tenant.
+type BufferRegistry struct {
+	mu      sync.Mutex
+	buffers map[string]map[string]*LogBuffer
+}
+
+func NewBufferRegistry() *BufferRegistry {
+	return &BufferRegistry{buffers: make(map[string]map[string]*LogBuffer)}
+}
+
+// GetOrCreate returns the tenant's buffer name, creating it with create
+// if there is none.
+func (r *BufferRegistry) GetOrCreate(tenant, name string, create func() *LogBuffer) *LogBuffer {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if b := r.buffers[tenant][name]; b != nil {
+		return b
+	}
+	if r.buffers[tenant] == nil {
+		r.buffers[tenant] = make(map[string]*LogBuffer)
+	}
+	b := create()
+	r.buffers[tenant][name] = b
+	return b
+}
+
+// Get returns the tenant's buffer name, or nil if there is none.
+func (r *BufferRegistry) Get(tenant, name string) *LogBuffer {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.buffers[tenant][name]
+}
+
+// List returns the statistics of the tenant's buffers by name.
+func (r *BufferRegistry) List(tenant string) map[string]BufferStats {
+	r.mu.Lock()
+	buffers := make(map[string]*LogBuffer, len(r.buffers[tenant]))
+	for name, b := range r.buffers[tenant] {
+		buffers[name] = b
+	}
+	r.mu.Unlock()
+
+	stats := make(map[string]BufferStats, len(buffers))
+	for name, b := range buffers {
+		stats[name] = b.Stats()
+	}
+	return stats
+}
+
+// Delete drops the tenant's buffer name and reports whether it existed.
+func (r *BufferRegistry) Delete(tenant, name string) bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if _, ok := r.buffers[tenant][name]; !ok {
+		return false
+	}
+	delete(r.buffers[tenant], name)
+	return true
+}
+
+// Count returns the number of buffers the tenant has.
+func (r *BufferRegistry) Count(tenant string) int {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return len(r.buffers[tenant])
+}
+
+// DeleteTenant drops the tenant's buffers.
+func (r *BufferRegistry) DeleteTenant(tenant string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	delete(r.buffers, tenant)
+}
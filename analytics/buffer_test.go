@@ -0,0 +1,43 @@
+package analytics
+
+import (
+	"fmt"
+	"sync"
+	"testing"
+)
+
+// TestLogBufferEntriesConcurrentAnalyses runs analyses that enrich the
+// entries' metadata concurrently on one buffer; run with -race.
+func TestLogBufferEntriesConcurrentAnalyses(t *testing.T) {
+	b := NewLogBuffer(100, 0)
+	logs := make([]LogEntry, 10)
+	for i := range logs {
+		logs[i] = LogEntry{Path: "/", Metadata: map[string]string{"service": "api"}}
+	}
+	if err := b.Append(logs); err != nil {
+		t.Fatal(err)
+	}
+
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			for _, log := range b.Entries() {
+				log.Metadata["analysis"] = fmt.Sprint(i)
+			}
+		}(i)
+	}
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		b.Append([]LogEntry{{Path: "/new", Metadata: map[string]string{"service": "web"}}})
+	}()
+	wg.Wait()
+
+	for _, log := range b.Entries() {
+		if _, ok := log.Metadata["analysis"]; ok {
+			t.Errorf("buffered entry %s was modified: %v", log.Path, log.Metadata)
+		}
+	}
+}
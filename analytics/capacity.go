@@ -0,0 +1,73 @@
+package analytics
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"analyticsai/ai-service/analytics/aggregator"
+)
+
+// maxCapacityServicesSummary caps the services written into the prompt.
+const maxCapacityServicesSummary = 10
+
+// AnalyzeCapacity computes the capacity report and asks Gemini to frame
+// scaling recommendations around it.
+func (s *AnalyticsService) AnalyzeCapacity(ctx context.Context, logs []LogEntry, opts aggregator.CapacityOptions) (*aggregator.CapacityReport, error) {
+	if err := CheckEntryLimit(ctx, len(logs)); err != nil {
+		return nil, err
+	}
+	report := aggregator.ComputeCapacity(logs, opts)
+	if len(report.Services) == 0 {
+		return report, nil
+	}
+
+	var summary strings.Builder
+	summary.WriteString(fmt.Sprintf("Bucket width %s, latency target p95 <= %dms, planning for %.0f%% utilization.\n\n",
+		report.Interval, report.LatencyTargetMs, report.TargetUtilization*100))
+	for i, sc := range report.Services {
+		if i == maxCapacityServicesSummary {
+			break
+		}
+		summary.WriteString(fmt.Sprintf("- %s: peak %.2f rps (p95 %dms), average %.2f rps, max p95 %dms, trend %+.2f rps/day",
+			untrusted(sc.Service), sc.PeakRPS, sc.PeakP95, sc.AvgRPS, sc.MaxP95, sc.TrendRPSPerDay))
+		if sc.Instances > 0 {
+			summary.WriteString(fmt.Sprintf(", %d instances", sc.Instances))
+		}
+		summary.WriteString(fmt.Sprintf(", p95 grows %.2fms per rps (r=%.2f)", sc.LatencySlope, sc.Correlation))
+		if sc.SaturationRPS != nil {
+			summary.WriteString(fmt.Sprintf(", estimated saturation %.2f rps", *sc.SaturationRPS))
+		}
+		if sc.SaturationRPSPerInstance != nil {
+			summary.WriteString(fmt.Sprintf(" (%.2f per instance)", *sc.SaturationRPSPerInstance))
+		}
+		if sc.Headroom != nil {
+			summary.WriteString(fmt.Sprintf(", headroom %.0f%%", *sc.Headroom))
+		}
+		if sc.DaysToSaturation != nil {
+			summary.WriteString(fmt.Sprintf(", saturates in %.1f days at the current trend", *sc.DaysToSaturation))
+		}
+		if sc.RecommendedInstances > 0 {
+			summary.WriteString(fmt.Sprintf(", recommended instances %d", sc.RecommendedInstances))
+		}
+		summary.WriteString(fmt.Sprintf(", action %s\n", sc.Action))
+	}
+
+	prompt := buildPrompt(s.instructions(PromptCapacity, nil), "Capacity Report", s.redact(ctx, summary.String()))
+
+	response, err := s.callGeminiAPI(ctx, prompt)
+	if err != nil {
+		return nil, fmt.Errorf("error generating analysis: %w", err)
+	}
+
+	var result struct {
+		Summary         string   `json:"summary"`
+		Recommendations []string `json:"recommendations"`
+	}
+	if err := decodeModelOutput(ctx, response, &result); err != nil {
+		return nil, err
+	}
+	report.Summary = result.Summary
+	report.Recommendations = result.Recommendations
+	return report, nil
+}
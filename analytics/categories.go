@@ -0,0 +1,113 @@
+package analytics
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Categories are the owner-facing categories insights and issues are
+// tagged with.
+var Categories = []string{"performance", "reliability", "security", "ux", "cost"}
+
+// categoryAliases maps category names models commonly use instead of
+// Categories.
+var categoryAliases = map[string]string{
+	"latency":         "performance",
+	"speed":           "performance",
+	"availability":    "reliability",
+	"errors":          "reliability",
+	"stability":       "reliability",
+	"user_experience": "ux",
+	"usability":       "ux",
+	"user":            "ux",
+	"resources":       "cost",
+	"resource":        "cost",
+	"efficiency":      "cost",
+}
+
+// issueTypeCategories is the category of each of IssueTypes, used when the
+// model leaves an issue's category out. Issues of type other are
+// categorized by their text.
+var issueTypeCategories = map[string]string{
+	"performance":   "performance",
+	"errors":        "reliability",
+	"availability":  "reliability",
+	"security":      "security",
+	"resource":      "cost",
+	"traffic":       "performance",
+	"configuration": "reliability",
+}
+
+// categoryKeywords infers a category from text, checked in order.
+var categoryKeywords = []struct {
+	category string
+	keywords []string
+}{
+	{"security", []string{"secur", "auth", "login", "attack", "injection", "brute", "vulnerab", "suspicious", "malicious"}},
+	{"reliability", []string{"error", "fail", "outage", "downtime", "unavailable", "crash", "timeout", "5xx", "exception"}},
+	{"ux", []string{"user experience", "bounce", "journey", "funnel", "abandon", "navigation", "mobile", "device", "browser", "session"}},
+	{"cost", []string{"cost", "bandwidth", "memory", "cpu", "disk", "crawler", "bot", "resource", "capacity"}},
+}
+
+// normalizeCategory maps c onto Categories, returning "" when it can't.
+func normalizeCategory(c string) string {
+	c = strings.Join(strings.FieldsFunc(strings.ToLower(c), func(r rune) bool {
+		return r == ' ' || r == '-' || r == '_'
+	}), "_")
+	if containsString(Categories, c) {
+		return c
+	}
+	return categoryAliases[c]
+}
+
+// inferCategory picks a category for text by keyword, defaulting to
+// performance.
+func inferCategory(text string) string {
+	text = strings.ToLower(text)
+	for _, k := range categoryKeywords {
+		for _, keyword := range k.keywords {
+			if strings.Contains(text, keyword) {
+				return k.category
+			}
+		}
+	}
+	return "performance"
+}
+
+// category returns the issue's category, falling back to one derived from
+// its type and text.
+func (i Issue) category() string {
+	if c := normalizeCategory(i.Category); c != "" {
+		return c
+	}
+	if c, ok := issueTypeCategories[normalizeIssueType(i.Type)]; ok {
+		return c
+	}
+	return inferCategory(i.Type + " " + i.Description)
+}
+
+func (i Insight) category() string {
+	if c := normalizeCategory(i.Category); c != "" {
+		return c
+	}
+	return inferCategory(i.Text)
+}
+
+// ParseCategories parses a comma-separated category filter.
+func ParseCategories(raw string) ([]string, error) {
+	var categories []string
+	for _, part := range strings.Split(raw, ",") {
+		part = strings.TrimSpace(part)
+		if part == "" {
+			continue
+		}
+		c := normalizeCategory(part)
+		if c == "" {
+			return nil, fmt.Errorf("%w: unknown category %q, must be one of %s", ErrInvalidInput, part, strings.Join(Categories, ", "))
+		}
+		if !containsString(categories, c) {
+			categories = append(categories, c)
+		}
+	}
+	return categories, nil
+}
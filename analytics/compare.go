@@ -0,0 +1,86 @@
+package analytics
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"analyticsai/ai-service/analytics/aggregator"
+)
+
+const maxPromptDeltas = 30
+
+// Comparison verdicts returned by Gemini.
+const (
+	VerdictRegressed    = "regressed"
+	VerdictNoRegression = "no_regression"
+	VerdictImproved     = "improved"
+	VerdictInconclusive = "inconclusive"
+)
+
+var verdicts = []string{VerdictRegressed, VerdictNoRegression, VerdictImproved, VerdictInconclusive}
+
+// AnalyzeComparison compares two log sets, typically from before and after
+// a deploy, and asks Gemini whether the change regressed anything.
+func (s *AnalyticsService) AnalyzeComparison(ctx context.Context, req aggregator.CompareRequest) (*aggregator.ComparisonReport, error) {
+	if err := CheckEntryLimit(ctx, len(req.Before)+len(req.After)); err != nil {
+		return nil, err
+	}
+	if len(req.Before) == 0 || len(req.After) == 0 {
+		return nil, fmt.Errorf("%w: both before and after need at least one log entry", ErrInvalidInput)
+	}
+
+	report := aggregator.CompareLogs(req.Before, req.After)
+
+	var summary strings.Builder
+	for _, set := range []struct {
+		name string
+		m    *aggregator.MetricsSnapshot
+	}{{"Before", report.Before}, {"After", report.After}} {
+		summary.WriteString(fmt.Sprintf("%s: %d requests, error rate %.2f%%, avg %dms, p95 %dms, %d slow endpoints\n",
+			set.name, set.m.Requests, set.m.ErrorRate, set.m.AvgDuration, set.m.P95Duration, set.m.SlowEndpoints))
+	}
+	summary.WriteString("\nEndpoint changes:\n")
+	for i, d := range report.Endpoints {
+		if i == maxPromptDeltas {
+			break
+		}
+		switch d.Status {
+		case aggregator.EndpointAdded:
+			summary.WriteString(fmt.Sprintf("- %s: new, %d requests, error rate %.1f%%, p95 %dms\n",
+				untrusted(d.Path), d.After.Requests, d.After.ErrorRate, d.After.P95Duration))
+		case aggregator.EndpointRemoved:
+			summary.WriteString(fmt.Sprintf("- %s: no longer requested (had %d requests)\n", untrusted(d.Path), d.Before.Requests))
+		default:
+			summary.WriteString(fmt.Sprintf("- %s (%s): traffic %+.1f%%, error rate %+.2f pp, avg %+dms, p95 %+dms\n",
+				untrusted(d.Path), d.Status, d.TrafficChange, d.ErrorRateChange, d.AvgChange, d.P95Change))
+		}
+	}
+
+	prompt := buildPrompt(s.instructions(PromptComparison, nil), "Comparison", s.redact(ctx, summary.String()))
+
+	response, err := s.callGeminiAPI(ctx, prompt)
+	if err != nil {
+		return nil, fmt.Errorf("error generating analysis: %w", err)
+	}
+
+	var result struct {
+		Verdict     string   `json:"verdict"`
+		Explanation string   `json:"explanation"`
+		Concerns    []string `json:"concerns"`
+	}
+	if err := decodeModelOutput(ctx, response, &result); err != nil {
+		return nil, err
+	}
+	result.Verdict = strings.ToLower(result.Verdict)
+	if !containsString(verdicts, result.Verdict) {
+		return nil, fmt.Errorf("%w: unknown verdict %q", ErrInvalidModelOutput, result.Verdict)
+	}
+	report.Verdict = result.Verdict
+	report.Explanation = result.Explanation
+	if result.Concerns != nil {
+		report.Concerns = result.Concerns
+	}
+
+	return report, nil
+}
@@ -0,0 +1,315 @@
+package analytics
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"unicode"
+)
+
+// Thresholds of word overlap (Jaccard similarity) above which findings of
+// different models are treated as the same finding.
+const (
+	sameIssueSimilarity   = 0.5
+	sameIssueWithPath     = 0.25 // for issues of the same type and path
+	sameInsightSimilarity = 0.4
+)
+
+// ConsensusReport describes how the models of a consensus analysis agreed.
+type ConsensusReport struct {
+	Models []ModelRun `json:"models"`
+
+	// Agreement is the mean, over all merged findings, of the share of
+	// successful models that reported the finding: 1 when every model
+	// reported everything.
+	Agreement           float64 `json:"agreement"`
+	SingleModelFindings int     `json:"single_model_findings"`
+}
+
+// ModelRun is one model's part in a consensus analysis.
+type ModelRun struct {
+	Model    string `json:"model"`
+	Issues   int    `json:"issues"`
+	Insights int    `json:"insights"`
+	Error    string `json:"error,omitempty"` // the model's output was left out
+}
+
+// Provenance records which models of a consensus analysis reported a
+// finding.
+type Provenance struct {
+	Models      []string `json:"models"`
+	Agreement   float64  `json:"agreement"`    // share of successful models that reported it
+	SingleModel bool     `json:"single_model"` // only one of several models reported it
+}
+
+// logAnalysisOutput holds the AI-generated fields of a log analysis, decoded
+// apart from the deterministic ones so the model can't overwrite them.
+type logAnalysisOutput struct {
+	PopularPages    []string          `json:"popular_pages"`
+	SlowPages       []PerformanceData `json:"slow_pages"`
+	PotentialIssues []Issue           `json:"potential_issues"`
+	Insights        []Insight         `json:"insights"`
+}
+
+// consensusLogAnalysis runs prompt through every consensus model and
+// reconciles their outputs. Models that fail are reported and left out;
+// the analysis fails only when every model does, or when a request limit
+// is hit.
+func (s *AnalyticsService) consensusLogAnalysis(ctx context.Context, prompt string) (*logAnalysisOutput, *ConsensusReport, error) {
+	models := s.consensusModels
+	if len(models) < 2 {
+		return nil, nil, fmt.Errorf("%w: consensus mode needs at least two models configured in CONSENSUS_MODELS", ErrInvalidInput)
+	}
+
+	outputs := make([]*logAnalysisOutput, len(models))
+	errs := make([]error, len(models))
+	var wg sync.WaitGroup
+	for i, model := range models {
+		wg.Add(1)
+		go func(i int, model Model) {
+			defer wg.Done()
+			response, err := s.generateWith(ctx, model, prompt, logAnalysisSchema)
+			if err != nil {
+				errs[i] = fmt.Errorf("error generating analysis: %w", err)
+				return
+			}
+			var output logAnalysisOutput
+			if err := decodeModelOutput(ctx, response, &output); err != nil {
+				errs[i] = err
+				return
+			}
+			outputs[i] = &output
+		}(i, model)
+	}
+	wg.Wait()
+
+	report := &ConsensusReport{}
+	var names []string
+	var succeeded []*logAnalysisOutput
+	for i, model := range models {
+		run := ModelRun{Model: model.String()}
+		if err := errs[i]; err != nil {
+			var limitErr *LimitError
+			if errors.As(err, &limitErr) {
+				return nil, nil, err
+			}
+			run.Error = err.Error()
+		} else {
+			run.Issues, run.Insights = len(outputs[i].PotentialIssues), len(outputs[i].Insights)
+			names = append(names, run.Model)
+			succeeded = append(succeeded, outputs[i])
+		}
+		report.Models = append(report.Models, run)
+	}
+	if len(succeeded) == 0 {
+		return nil, nil, errs[0]
+	}
+
+	merged := reconcile(names, succeeded, report)
+	return merged, report, nil
+}
+
+// reconcile merges the outputs of several models: the union of their
+// issues and insights, with findings reported by more than one model
+// merged and tagged with their provenance.
+func reconcile(names []string, outputs []*logAnalysisOutput, report *ConsensusReport) *logAnalysisOutput {
+	type issueGroup struct {
+		issue       Issue
+		models      []string
+		confidences []float64
+	}
+	type insightGroup struct {
+		insight     Insight
+		models      []string
+		confidences []float64
+	}
+	var issues []*issueGroup
+	var insights []*insightGroup
+	merged := &logAnalysisOutput{}
+	pageVotes := make(map[string]int)
+	slowPages := make(map[string]bool)
+
+	for m, output := range outputs {
+		name := names[m]
+		for _, issue := range output.PotentialIssues {
+			var group *issueGroup
+			for _, g := range issues {
+				if !containsString(g.models, name) && sameIssue(g.issue, issue) {
+					group = g
+					break
+				}
+			}
+			if group == nil {
+				issues = append(issues, &issueGroup{issue: issue, models: []string{name}, confidences: []float64{issue.Confidence}})
+				continue
+			}
+			group.models = append(group.models, name)
+			group.confidences = append(group.confidences, issue.Confidence)
+			group.issue = mergeIssues(group.issue, issue)
+		}
+		for _, insight := range output.Insights {
+			var group *insightGroup
+			for _, g := range insights {
+				if !containsString(g.models, name) && textSimilarity(g.insight.Text, insight.Text) >= sameInsightSimilarity {
+					group = g
+					break
+				}
+			}
+			if group == nil {
+				insights = append(insights, &insightGroup{insight: insight, models: []string{name}, confidences: []float64{insight.Confidence}})
+				continue
+			}
+			group.models = append(group.models, name)
+			group.confidences = append(group.confidences, insight.Confidence)
+			evidence := append(append([]Evidence{}, group.insight.Evidence...), insight.Evidence...)
+			if insight.Confidence > group.insight.Confidence {
+				group.insight = insight
+			}
+			group.insight.Evidence = evidence
+		}
+		for _, page := range output.PopularPages {
+			if pageVotes[page] == 0 {
+				merged.PopularPages = append(merged.PopularPages, page)
+			}
+			pageVotes[page]++
+		}
+		for _, page := range output.SlowPages {
+			if !slowPages[page.Path] {
+				slowPages[page.Path] = true
+				merged.SlowPages = append(merged.SlowPages, page)
+			}
+		}
+	}
+	sort.SliceStable(merged.PopularPages, func(i, j int) bool {
+		return pageVotes[merged.PopularPages[i]] > pageVotes[merged.PopularPages[j]]
+	})
+
+	provenance := func(models []string) *Provenance {
+		p := &Provenance{
+			Models:      models,
+			Agreement:   float64(len(models)) / float64(len(outputs)),
+			SingleModel: len(models) == 1 && len(outputs) > 1,
+		}
+		report.Agreement += p.Agreement
+		if p.SingleModel {
+			report.SingleModelFindings++
+		}
+		return p
+	}
+	for _, g := range issues {
+		g.issue.Confidence = meanConfidence(g.confidences)
+		g.issue.Consensus = provenance(g.models)
+		merged.PotentialIssues = append(merged.PotentialIssues, g.issue)
+	}
+	for _, g := range insights {
+		g.insight.Confidence = meanConfidence(g.confidences)
+		g.insight.Consensus = provenance(g.models)
+		merged.Insights = append(merged.Insights, g.insight)
+	}
+	if findings := len(issues) + len(insights); findings > 0 {
+		report.Agreement = round2(report.Agreement / float64(findings))
+	} else {
+		report.Agreement = 1
+	}
+
+	// Findings more models agree on come first.
+	sort.SliceStable(merged.PotentialIssues, func(i, j int) bool {
+		return len(merged.PotentialIssues[i].Consensus.Models) > len(merged.PotentialIssues[j].Consensus.Models)
+	})
+	sort.SliceStable(merged.Insights, func(i, j int) bool {
+		return len(merged.Insights[i].Consensus.Models) > len(merged.Insights[j].Consensus.Models)
+	})
+	return merged
+}
+
+// sameIssue reports whether two models' issues describe the same problem:
+// their descriptions overlap, more loosely so when they share a type and
+// a path.
+func sameIssue(a, b Issue) bool {
+	similarity := textSimilarity(a.Type+" "+a.Description, b.Type+" "+b.Description)
+	if a.Type == b.Type && (sharesPath(a.Path, b.Path) || len(a.Path) == 0 && len(b.Path) == 0) {
+		return similarity >= sameIssueWithPath
+	}
+	return similarity >= sameIssueSimilarity
+}
+
+func sharesPath(a, b []string) bool {
+	for _, p := range a {
+		if containsString(b, p) {
+			return true
+		}
+	}
+	return false
+}
+
+// mergeIssues combines two models' versions of an issue, keeping the text of
+// the more confident one, the higher severity, and every path and piece of
+// evidence.
+func mergeIssues(a, b Issue) Issue {
+	merged := a
+	if b.Confidence > a.Confidence {
+		merged = b
+	}
+	if severityIndex(a.Severity) > severityIndex(merged.Severity) {
+		merged.Severity = a.Severity
+	}
+	if severityIndex(b.Severity) > severityIndex(merged.Severity) {
+		merged.Severity = b.Severity
+	}
+	merged.Path = append([]string{}, a.Path...)
+	for _, p := range b.Path {
+		if !containsString(merged.Path, p) {
+			merged.Path = append(merged.Path, p)
+		}
+	}
+	merged.Evidence = append(append([]Evidence{}, a.Evidence...), b.Evidence...)
+	return merged
+}
+
+func severityIndex(severity string) int {
+	for i, s := range IssueSeverities {
+		if s == severity {
+			return i
+		}
+	}
+	return -1
+}
+
+func meanConfidence(confidences []float64) float64 {
+	var sum float64
+	for _, c := range confidences {
+		sum += c
+	}
+	return round2(sum / float64(len(confidences)))
+}
+
+// textSimilarity is the Jaccard similarity of the words of a and b, ignoring
+// case, punctuation and words shorter than three letters.
+func textSimilarity(a, b string) float64 {
+	wordsA, wordsB := wordSet(a), wordSet(b)
+	if len(wordsA) == 0 || len(wordsB) == 0 {
+		return 0
+	}
+	shared := 0
+	for w := range wordsA {
+		if wordsB[w] {
+			shared++
+		}
+	}
+	return float64(shared) / float64(len(wordsA)+len(wordsB)-shared)
+}
+
+func wordSet(text string) map[string]bool {
+	words := make(map[string]bool)
+	for _, w := range strings.FieldsFunc(strings.ToLower(text), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r) && r != '/'
+	}) {
+		if len(w) >= 3 {
+			words[w] = true
+		}
+	}
+	return words
+}
@@ -0,0 +1,256 @@
+package analytics
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"analyticsai/ai-service/analytics/aggregator"
+)
+
+const (
+	maxConversationTurns  = 10   // previous turns included in each prompt
+	maxQuestionLength     = 1000 // characters
+	maxConversations      = 1000 // live conversations kept per instance
+	maxContextTimeBuckets = 200
+)
+
+// Turn is one question about an analysis and its answer.
+type Turn struct {
+	Question           string    `json:"question"`
+	Answer             string    `json:"answer"`
+	SuggestedQuestions []string  `json:"suggested_questions"`
+	AskedAt            time.Time `json:"asked_at"`
+}
+
+// Conversation is a series of questions about one analysis. Each question
+// is answered with the analysis and the previous turns as context.
+type Conversation struct {
+	ID         string    `json:"id"`
+	Tenant     string    `json:"tenant"`
+	AnalysisID string    `json:"analysis_id,omitempty"`
+	CreatedAt  time.Time `json:"created_at"`
+	ExpiresAt  time.Time `json:"expires_at"`
+	Turns      []Turn    `json:"turns"`
+
+	context string // summary of the analysis the answers are grounded in
+}
+
+// ConversationContext summarizes an analysis and its metrics for answering
+// questions about it: headline numbers, per-endpoint statistics, the time
+// series and the AI findings. Either argument may be nil.
+func ConversationContext(analysis *AnalysisResult, metrics *aggregator.MetricsSnapshot) string {
+	var b strings.Builder
+	if m := metrics; m != nil {
+		fmt.Fprintf(&b, "Overall: %d requests, %.2f%% errors, avg %dms, p95 %dms, %d slow endpoints\n",
+			m.Requests, m.ErrorRate, m.AvgDuration, m.P95Duration, m.SlowEndpoints)
+		if len(m.Endpoints) > 0 {
+			b.WriteString("Endpoints (requests, errors, error rate, avg, p95):\n")
+			for _, e := range m.Endpoints {
+				fmt.Fprintf(&b, "- %s: %d, %d, %.2f%%, %dms, %dms\n", untrusted(e.Value), e.Requests, e.Errors, e.ErrorRate, e.AvgDuration, e.P95Duration)
+			}
+		}
+	}
+	if analysis == nil {
+		return b.String()
+	}
+
+	if ts := analysis.TimeSeries; ts != nil && len(ts.Buckets) > 0 {
+		buckets := ts.Buckets
+		if len(buckets) > maxContextTimeBuckets {
+			buckets = buckets[len(buckets)-maxContextTimeBuckets:]
+		}
+		fmt.Fprintf(&b, "Time series per %s (start, requests, errors, error rate, avg, p95):\n", ts.Interval)
+		for _, bucket := range buckets {
+			fmt.Fprintf(&b, "- %s: %d, %d, %.2f%%, %dms, %dms\n", bucket.Start, bucket.Requests, bucket.Errors, bucket.ErrorRate, bucket.AvgDuration, bucket.P95Duration)
+		}
+	}
+	for _, a := range analysis.Anomalies {
+		fmt.Fprintf(&b, "Anomaly: %s %s from %s to %s, %g vs expected %g (%s)\n", untrusted(a.Path), a.Metric, a.Start, a.End, a.Value, a.Expected, a.Severity)
+	}
+	for _, page := range analysis.SlowPages {
+		fmt.Fprintf(&b, "Slow page: %s, avg %dms over %d requests, %.1f%% errors\n", untrusted(page.Path), page.AvgDuration, page.RequestCount, page.ErrorRate)
+	}
+	for _, issue := range analysis.PotentialIssues {
+		paths := make([]string, 0)
+		for _, p := range issue.Path {
+			paths = append(paths, untrusted(p))
+		}
+		fmt.Fprintf(&b, "Reported issue (%s, %s, confidence %.2f, %s): %s: %s [%s]\n", issue.Severity, untrusted(issue.Category), issue.Confidence, groundedLabel(issue.Grounded), untrusted(issue.Type), untrusted(issue.Description), strings.Join(paths, ", "))
+	}
+	for _, insight := range analysis.Insights {
+		fmt.Fprintf(&b, "Reported insight (%s, confidence %.2f, %s): %s\n", untrusted(insight.Category), insight.Confidence, groundedLabel(insight.Grounded), untrusted(insight.Text))
+	}
+	return b.String()
+}
+
+func groundedLabel(grounded bool) string {
+	if grounded {
+		return "evidence verified"
+	}
+	return "unverified"
+}
+
+// Ask answers question about the conversation's analysis, taking its
+// previous turns into account. The caller records the returned turn.
+func (s *AnalyticsService) Ask(ctx context.Context, conv Conversation, question string) (*Turn, error) {
+	question = strings.TrimSpace(question)
+	if question == "" {
+		return nil, fmt.Errorf("%w: question is required", ErrInvalidInput)
+	}
+	if len(question) > maxQuestionLength {
+		return nil, fmt.Errorf("%w: question is longer than %d characters", ErrInvalidInput, maxQuestionLength)
+	}
+
+	var data strings.Builder
+	data.WriteString(conv.context)
+	turns := conv.Turns
+	if len(turns) > maxConversationTurns {
+		turns = turns[len(turns)-maxConversationTurns:]
+	}
+	if len(turns) > 0 {
+		data.WriteString("\nEarlier in this conversation:\n")
+		for _, t := range turns {
+			fmt.Fprintf(&data, "Q: %s\nA: %s\n", untrusted(t.Question), untrusted(t.Answer))
+		}
+	}
+
+	prompt := buildPrompt(s.instructions(PromptConversation, nil)+"\n\nQuestion: "+s.redact(ctx, untrusted(question)), "Analysis", s.redact(ctx, data.String()))
+
+	response, err := s.callGeminiAPI(ctx, prompt)
+	if err != nil {
+		return nil, fmt.Errorf("error generating answer: %w", err)
+	}
+
+	var result struct {
+		Answer             string   `json:"answer"`
+		SuggestedQuestions []string `json:"suggested_questions"`
+	}
+	if err := decodeModelOutput(ctx, response, &result); err != nil {
+		return nil, err
+	}
+	if result.SuggestedQuestions == nil {
+		result.SuggestedQuestions = []string{}
+	}
+	return &Turn{
+		Question:           question,
+		Answer:             result.Answer,
+		SuggestedQuestions: result.SuggestedQuestions,
+		AskedAt:            time.Now().UTC(),
+	}, nil
+}
+
+// ConversationRegistry keeps conversations in memory until they have been
+// idle for the TTL. Expired conversations are dropped as the registry is
+// used, so it needs no background goroutine.
+type ConversationRegistry struct {
+	mu            sync.Mutex
+	ttl           time.Duration
+	conversations map[string]*Conversation
+}
+
+func NewConversationRegistry(ttl time.Duration) *ConversationRegistry {
+	return &ConversationRegistry{ttl: ttl, conversations: make(map[string]*Conversation)}
+}
+
+func (r *ConversationRegistry) expire(now time.Time) {
+	for id, conv := range r.conversations {
+		if now.After(conv.ExpiresAt) {
+			delete(r.conversations, id)
+		}
+	}
+}
+
+// Create starts a conversation about an analysis summarized by context, as
+// built by ConversationContext. When the registry is full the conversation
+// closest to expiring is dropped.
+func (r *ConversationRegistry) Create(tenant, analysisID, context string) (Conversation, error) {
+	b := make([]byte, 8)
+	if _, err := rand.Read(b); err != nil {
+		return Conversation{}, fmt.Errorf("error generating conversation id: %v", err)
+	}
+	now := time.Now().UTC()
+	conv := &Conversation{
+		ID:         hex.EncodeToString(b),
+		Tenant:     tenant,
+		AnalysisID: analysisID,
+		CreatedAt:  now,
+		ExpiresAt:  now.Add(r.ttl),
+		Turns:      []Turn{},
+		context:    context,
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.expire(now)
+	if len(r.conversations) >= maxConversations {
+		ids := make([]string, 0, len(r.conversations))
+		for id := range r.conversations {
+			ids = append(ids, id)
+		}
+		sort.Slice(ids, func(i, j int) bool {
+			return r.conversations[ids[i]].ExpiresAt.Before(r.conversations[ids[j]].ExpiresAt)
+		})
+		delete(r.conversations, ids[0])
+	}
+	r.conversations[conv.ID] = conv
+	return *conv, nil
+}
+
+// Get returns the tenant's conversation id if it hasn't expired.
+func (r *ConversationRegistry) Get(tenant, id string) (Conversation, bool) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.expire(time.Now())
+	conv, ok := r.conversations[id]
+	if !ok || conv.Tenant != tenant {
+		return Conversation{}, false
+	}
+	c := *conv
+	c.Turns = append([]Turn{}, conv.Turns...)
+	return c, true
+}
+
+// AddTurn appends turn to the tenant's conversation id and extends its
+// expiry. It reports false if the conversation expired meanwhile.
+func (r *ConversationRegistry) AddTurn(tenant, id string, turn Turn) (Conversation, bool) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	conv, ok := r.conversations[id]
+	if !ok || conv.Tenant != tenant {
+		return Conversation{}, false
+	}
+	conv.Turns = append(conv.Turns, turn)
+	conv.ExpiresAt = time.Now().UTC().Add(r.ttl)
+	c := *conv
+	c.Turns = append([]Turn{}, conv.Turns...)
+	return c, true
+}
+
+// Delete ends the tenant's conversation id, reporting whether it existed.
+func (r *ConversationRegistry) Delete(tenant, id string) bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	conv, ok := r.conversations[id]
+	if !ok || conv.Tenant != tenant {
+		return false
+	}
+	delete(r.conversations, id)
+	return true
+}
+
+// DeleteTenant ends every conversation of tenant.
+func (r *ConversationRegistry) DeleteTenant(tenant string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for id, conv := range r.conversations {
+		if conv.Tenant == tenant {
+			delete(r.conversations, id)
+		}
+	}
+}
@@ -0,0 +1,77 @@
+package analytics
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"analyticsai/ai-service/analytics/aggregator"
+)
+
+const maxGraphPromptRows = 40 // nodes and edges each written into a prompt
+
+// AnalyzeDependencies builds the dependency graph of logs and asks Gemini
+// to comment on its fragile hotspots.
+func (s *AnalyticsService) AnalyzeDependencies(ctx context.Context, logs []LogEntry, interval time.Duration) (*aggregator.DependencyReport, error) {
+	if err := CheckEntryLimit(ctx, len(logs)); err != nil {
+		return nil, err
+	}
+
+	report := &aggregator.DependencyReport{Graph: aggregator.BuildDependencyGraph(logs, interval), Assessments: []aggregator.HotspotAssessment{}}
+	if len(report.Graph.Edges) == 0 {
+		return report, nil
+	}
+
+	var summary strings.Builder
+	summary.WriteString(fmt.Sprintf("Nodes (%ss), busiest first:\n", report.Graph.NodeKind))
+	for i, n := range report.Graph.Nodes {
+		if i == maxGraphPromptRows {
+			break
+		}
+		summary.WriteString(fmt.Sprintf("- %s: %d requests, error rate %.1f%%, p95 %dms, %d callers, %d dependencies, %d transitive dependents\n",
+			untrusted(n.ID), n.Requests, n.ErrorRate, n.P95Duration, n.Callers, n.Dependencies, n.Dependents))
+	}
+	summary.WriteString("\nDependencies (caller -> dependency):\n")
+	for i, e := range report.Graph.Edges {
+		if i == maxGraphPromptRows {
+			break
+		}
+		line := fmt.Sprintf("- %s -> %s (from %s)", untrusted(e.From), untrusted(e.To), strings.Join(e.Sources, ", "))
+		if e.Calls > 0 {
+			line += fmt.Sprintf(": %d calls, error rate %.1f%%", e.Calls, e.ErrorRate)
+		}
+		if e.Correlation > 0 {
+			line += fmt.Sprintf("; dependency errors lead caller errors by %s (r=%.2f)", e.Lag, e.Correlation)
+		}
+		summary.WriteString(line + "\n")
+	}
+	if len(report.Graph.Hotspots) > 0 {
+		hotspots := make([]string, len(report.Graph.Hotspots))
+		for i, id := range report.Graph.Hotspots {
+			hotspots[i] = untrusted(id)
+		}
+		summary.WriteString(fmt.Sprintf("\nHotspots (failing nodes others depend on): %s\n", strings.Join(hotspots, ", ")))
+	}
+
+	prompt := buildPrompt(s.instructions(PromptDependencies, nil), "Dependency graph", s.redact(ctx, summary.String()))
+
+	response, err := s.callGeminiAPI(ctx, prompt)
+	if err != nil {
+		return nil, fmt.Errorf("error generating analysis: %w", err)
+	}
+
+	var result struct {
+		Summary  string                         `json:"summary"`
+		Hotspots []aggregator.HotspotAssessment `json:"hotspots"`
+	}
+	if err := decodeModelOutput(ctx, response, &result); err != nil {
+		return nil, err
+	}
+	report.Summary = result.Summary
+	if result.Hotspots != nil {
+		report.Assessments = result.Hotspots
+	}
+
+	return report, nil
+}
@@ -0,0 +1,474 @@
+package analytics
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"math"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"analyticsai/ai-service/analytics/aggregator"
+	"analyticsai/ai-service/analytics/llm"
+)
+
+const (
+	embeddingModel = "models/text-embedding-004"
+
+	maxEmbedBatch        = 100  // texts per batchEmbedContents request
+	maxEmbedText         = 2000 // characters embedded per text
+	maxSemanticDocuments = 10000
+	maxSemanticExamples  = 3
+	maxSemanticResults   = 100
+)
+
+// Semantic document kinds.
+const (
+	DocumentLog     = "log"     // a log message template and its entries
+	DocumentInsight = "insight" // an insight of a stored analysis
+	DocumentIssue   = "issue"   // a potential issue of a stored analysis
+)
+
+// Embed returns the embedding of each text by the configured Embedder,
+// normalized to unit length. taskType is
+// RETRIEVAL_DOCUMENT for indexed texts and RETRIEVAL_QUERY for queries.
+func (s *AnalyticsService) Embed(ctx context.Context, texts []string, taskType string) ([][]float32, error) {
+	if s.embedder == nil {
+		return nil, fmt.Errorf("no embedding client is configured")
+	}
+	vectors := make([][]float32, 0, len(texts))
+	for start := 0; start < len(texts); start += maxEmbedBatch {
+		end := start + maxEmbedBatch
+		if end > len(texts) {
+			end = len(texts)
+		}
+		if err := consumeLLMCall(ctx); err != nil {
+			return nil, err
+		}
+
+		batch := make([]string, 0, end-start)
+		for _, text := range texts[start:end] {
+			if s.redactor != nil {
+				var counts map[string]int
+				text, counts = s.redactor.Redact(text)
+				recordRedactions(ctx, counts)
+			}
+			if len(text) > maxEmbedText {
+				text = text[:maxEmbedText]
+			}
+			batch = append(batch, text)
+		}
+		embeddings, err := s.embedder.Embed(ctx, llm.EmbedRequest{Model: embeddingModel, Texts: batch, TaskType: taskType})
+		if err != nil {
+			return nil, err
+		}
+		// The embedding API doesn't report tokens.
+		recordModelUsage(ctx, embeddingModel, 0, 0)
+		for _, e := range embeddings {
+			vectors = append(vectors, normalize(e))
+		}
+	}
+	return vectors, nil
+}
+
+func normalize(v []float32) []float32 {
+	var sum float64
+	for _, x := range v {
+		sum += float64(x) * float64(x)
+	}
+	if sum == 0 {
+		return v
+	}
+	norm := float32(math.Sqrt(sum))
+	for i := range v {
+		v[i] /= norm
+	}
+	return v
+}
+
+func dot(a, b []float32) float64 {
+	if len(a) != len(b) {
+		return 0
+	}
+	var sum float64
+	for i := range a {
+		sum += float64(a[i]) * float64(b[i])
+	}
+	return sum
+}
+
+// SemanticDocument is an embedded text: a log message template with its
+// occurrences, or an insight or issue of a stored analysis.
+type SemanticDocument struct {
+	ID         string     `json:"id"`
+	Tenant     string     `json:"tenant"`
+	Kind       string     `json:"kind"`
+	Text       string     `json:"text"`
+	Count      int        `json:"count,omitempty"` // log entries seen with this template
+	FirstSeen  string     `json:"first_seen,omitempty"`
+	LastSeen   string     `json:"last_seen,omitempty"`
+	Examples   []LogEntry `json:"examples,omitempty"`
+	AnalysisID string     `json:"analysis_id,omitempty"`
+	Severity   string     `json:"severity,omitempty"`
+	Category   string     `json:"category,omitempty"` // of insights and issues
+	Paths      []string   `json:"paths,omitempty"`
+	Resolution string     `json:"resolution,omitempty"` // how an issue was resolved, recorded by Resolve
+	ResolvedAt *time.Time `json:"resolved_at,omitempty"`
+	IndexedAt  time.Time  `json:"indexed_at"`
+	Vector     []float32  `json:"vector,omitempty"`
+}
+
+func documentID(tenant, kind, analysisID, text string) string {
+	sum := sha256.Sum256([]byte(tenant + "\x00" + kind + "\x00" + analysisID + "\x00" + text))
+	return hex.EncodeToString(sum[:8])
+}
+
+// IndexStore persists the documents of a VectorIndex, one tenant at a time,
+// so that indexing only rewrites the tenant it changed. Data is the
+// tenant's documents as JSON.
+type IndexStore interface {
+	Tenants() ([]string, error)
+	Load(tenant string) ([]byte, error)
+	Save(tenant string, data []byte) error
+	Delete(tenant string) error
+}
+
+// VectorIndex holds embedded documents per tenant, optionally persisted in
+// an IndexStore.
+type VectorIndex struct {
+	mu      sync.Mutex
+	store   IndexStore
+	tenants map[string]map[string]*SemanticDocument // tenant -> ID -> document
+}
+
+// NewVectorIndex loads an index from store. A nil store yields an in-memory
+// index.
+func NewVectorIndex(store IndexStore) (*VectorIndex, error) {
+	idx := &VectorIndex{store: store, tenants: make(map[string]map[string]*SemanticDocument)}
+	if store == nil {
+		return idx, nil
+	}
+	tenants, err := store.Tenants()
+	if err != nil {
+		return nil, fmt.Errorf("error listing semantic index: %v", err)
+	}
+	for _, tenant := range tenants {
+		data, err := store.Load(tenant)
+		if err != nil {
+			return nil, fmt.Errorf("error reading semantic index of tenant %q: %v", tenant, err)
+		}
+		var docs []*SemanticDocument
+		if err := json.Unmarshal(data, &docs); err != nil {
+			return nil, fmt.Errorf("error parsing semantic index of tenant %q: %v", tenant, err)
+		}
+		owned := make(map[string]*SemanticDocument, len(docs))
+		for _, doc := range docs {
+			owned[doc.ID] = doc
+		}
+		idx.tenants[tenant] = owned
+	}
+	return idx, nil
+}
+
+// save writes the tenant's documents to the store.
+func (idx *VectorIndex) save(tenant string) error {
+	if idx.store == nil {
+		return nil
+	}
+	owned := idx.tenants[tenant]
+	docs := make([]*SemanticDocument, 0, len(owned))
+	for _, doc := range owned {
+		docs = append(docs, doc)
+	}
+	sort.Slice(docs, func(i, j int) bool { return docs[i].ID < docs[j].ID })
+	data, err := json.Marshal(docs)
+	if err != nil {
+		return fmt.Errorf("error marshaling semantic index: %v", err)
+	}
+	if err := idx.store.Save(tenant, data); err != nil {
+		return fmt.Errorf("error writing semantic index: %v", err)
+	}
+	return nil
+}
+
+// add stores docs, evicting the tenant's least recently indexed documents
+// beyond maxSemanticDocuments.
+func (idx *VectorIndex) add(tenant string, docs []*SemanticDocument) error {
+	idx.mu.Lock()
+	defer idx.mu.Unlock()
+	owned, ok := idx.tenants[tenant]
+	if !ok {
+		owned = make(map[string]*SemanticDocument)
+		idx.tenants[tenant] = owned
+	}
+	for _, doc := range docs {
+		owned[doc.ID] = doc
+	}
+	if len(owned) > maxSemanticDocuments {
+		all := make([]*SemanticDocument, 0, len(owned))
+		for _, doc := range owned {
+			all = append(all, doc)
+		}
+		sort.Slice(all, func(i, j int) bool { return all[i].IndexedAt.Before(all[j].IndexedAt) })
+		for _, doc := range all[:len(all)-maxSemanticDocuments] {
+			delete(owned, doc.ID)
+		}
+	}
+	return idx.save(tenant)
+}
+
+// merge folds the occurrences of an already indexed log template into its
+// document, returning false if it isn't indexed.
+func (idx *VectorIndex) merge(doc *SemanticDocument) bool {
+	idx.mu.Lock()
+	defer idx.mu.Unlock()
+	existing, ok := idx.tenants[doc.Tenant][doc.ID]
+	if !ok {
+		return false
+	}
+	existing.Count += doc.Count
+	if doc.FirstSeen != "" && (existing.FirstSeen == "" || doc.FirstSeen < existing.FirstSeen) {
+		existing.FirstSeen = doc.FirstSeen
+	}
+	if doc.LastSeen > existing.LastSeen {
+		existing.LastSeen = doc.LastSeen
+	}
+	for _, e := range doc.Examples {
+		if len(existing.Examples) < maxSemanticExamples && !hasExample(existing.Examples, e) {
+			existing.Examples = append(existing.Examples, e)
+		}
+	}
+	existing.IndexedAt = doc.IndexedAt
+	return true
+}
+
+func hasExample(examples []LogEntry, e LogEntry) bool {
+	for _, x := range examples {
+		if x.Timestamp == e.Timestamp && x.Message == e.Message {
+			return true
+		}
+	}
+	return false
+}
+
+// DeleteTenant removes every document of tenant and returns how many there
+// were.
+func (idx *VectorIndex) DeleteTenant(tenant string) (int, error) {
+	idx.mu.Lock()
+	defer idx.mu.Unlock()
+	n := len(idx.tenants[tenant])
+	delete(idx.tenants, tenant)
+	if idx.store == nil {
+		return n, nil
+	}
+	return n, idx.store.Delete(tenant)
+}
+
+// IndexSummary reports what an indexing call did.
+type IndexSummary struct {
+	Documents int `json:"documents"` // documents covering the input
+	Embedded  int `json:"embedded"`  // of which were new and embedded
+}
+
+// embedNew embeds the documents not yet in the index, merging the
+// occurrences of the others, and stores them.
+func (s *AnalyticsService) embedNew(ctx context.Context, idx *VectorIndex, tenant string, docs []*SemanticDocument) (*IndexSummary, error) {
+	var fresh []*SemanticDocument
+	for _, doc := range docs {
+		if !idx.merge(doc) {
+			fresh = append(fresh, doc)
+		}
+	}
+	texts := make([]string, len(fresh))
+	for i, doc := range fresh {
+		texts[i] = doc.Text
+	}
+	vectors, err := s.Embed(ctx, texts, "RETRIEVAL_DOCUMENT")
+	if err != nil {
+		return nil, fmt.Errorf("error embedding documents: %w", err)
+	}
+	for i, doc := range fresh {
+		doc.Vector = vectors[i]
+	}
+	if err := idx.add(tenant, fresh); err != nil {
+		return nil, err
+	}
+	return &IndexSummary{Documents: len(docs), Embedded: len(fresh)}, nil
+}
+
+// redactEntry returns a copy of log with its free-text fields redacted, as
+// examples are kept in the index.
+func (s *AnalyticsService) redactEntry(log LogEntry) LogEntry {
+	if s.redactor == nil {
+		return log
+	}
+	log.Message, _ = s.redactor.Redact(log.Message)
+	log.Path, _ = s.redactor.Redact(log.Path)
+	if len(log.Metadata) > 0 {
+		metadata := make(map[string]string, len(log.Metadata))
+		for k, v := range log.Metadata {
+			metadata[k], _ = s.redactor.Redact(v)
+		}
+		log.Metadata = metadata
+	}
+	return log
+}
+
+// IndexLogs embeds the message templates of logs, with variable parts such
+// as IDs and numbers masked, so that entries can be found by meaning.
+// Templates already in the index only have their counts and examples
+// updated.
+func (s *AnalyticsService) IndexLogs(ctx context.Context, idx *VectorIndex, tenant string, logs []LogEntry) (*IndexSummary, error) {
+	now := time.Now().UTC()
+	byTemplate := make(map[string]*SemanticDocument)
+	var docs []*SemanticDocument
+	for _, log := range logs {
+		template := strings.Join(aggregator.MessageTokens(log.Message), " ")
+		if template == "" {
+			continue
+		}
+		doc, ok := byTemplate[template]
+		if !ok {
+			doc = &SemanticDocument{
+				ID:        documentID(tenant, DocumentLog, "", template),
+				Tenant:    tenant,
+				Kind:      DocumentLog,
+				Text:      template,
+				IndexedAt: now,
+			}
+			byTemplate[template] = doc
+			docs = append(docs, doc)
+		}
+		doc.Count++
+		if log.Timestamp != "" {
+			if doc.FirstSeen == "" || log.Timestamp < doc.FirstSeen {
+				doc.FirstSeen = log.Timestamp
+			}
+			if log.Timestamp > doc.LastSeen {
+				doc.LastSeen = log.Timestamp
+			}
+		}
+		if len(doc.Examples) < maxSemanticExamples {
+			doc.Examples = append(doc.Examples, s.redactEntry(log))
+		}
+	}
+	return s.embedNew(ctx, idx, tenant, docs)
+}
+
+// IndexAnalysis embeds the insights and potential issues of a stored
+// analysis so that later searches and analyses can refer back to them.
+func (s *AnalyticsService) IndexAnalysis(ctx context.Context, idx *VectorIndex, tenant, analysisID string, result *AnalysisResult) (*IndexSummary, error) {
+	now := time.Now().UTC()
+	var docs []*SemanticDocument
+	for _, insight := range result.Insights {
+		docs = append(docs, &SemanticDocument{
+			ID:         documentID(tenant, DocumentInsight, analysisID, insight.Text),
+			Tenant:     tenant,
+			Kind:       DocumentInsight,
+			Text:       insight.Text,
+			AnalysisID: analysisID,
+			Category:   insight.Category,
+			IndexedAt:  now,
+		})
+	}
+	for _, issue := range result.PotentialIssues {
+		text := issueText(issue)
+		docs = append(docs, &SemanticDocument{
+			ID:         documentID(tenant, DocumentIssue, analysisID, text),
+			Tenant:     tenant,
+			Kind:       DocumentIssue,
+			Text:       text,
+			AnalysisID: analysisID,
+			Severity:   issue.Severity,
+			Category:   issue.Category,
+			Paths:      issue.Path,
+			IndexedAt:  now,
+		})
+	}
+	return s.embedNew(ctx, idx, tenant, docs)
+}
+
+// SemanticMatch is a search result; its document is returned without the
+// vector.
+type SemanticMatch struct {
+	Score    float64          `json:"score"`
+	Document SemanticDocument `json:"document"`
+}
+
+// SemanticQuery is a search over a tenant's index.
+type SemanticQuery struct {
+	Query      string   `json:"query"`
+	Kinds      []string `json:"kinds"`      // default every kind
+	Categories []string `json:"categories"` // insights and issues of these categories only
+	Limit      int      `json:"limit"`      // default 20
+	MinScore   float64  `json:"min_score"`  // cosine similarity, default 0.5
+}
+
+// search ranks the tenant's documents of the query's kinds by similarity
+// to vector.
+func (idx *VectorIndex) search(tenant string, vector []float32, q SemanticQuery) []SemanticMatch {
+	idx.mu.Lock()
+	defer idx.mu.Unlock()
+	matches := []SemanticMatch{}
+	for _, doc := range idx.tenants[tenant] {
+		if (len(q.Kinds) > 0 && !containsString(q.Kinds, doc.Kind)) ||
+			(len(q.Categories) > 0 && !containsString(q.Categories, doc.Category)) {
+			continue
+		}
+		score := dot(vector, doc.Vector)
+		if score < q.MinScore {
+			continue
+		}
+		match := SemanticMatch{Score: math.Round(score*1000) / 1000, Document: *doc}
+		match.Document.Vector = nil
+		matches = append(matches, match)
+	}
+	sort.Slice(matches, func(i, j int) bool {
+		if matches[i].Score != matches[j].Score {
+			return matches[i].Score > matches[j].Score
+		}
+		return matches[i].Document.ID < matches[j].Document.ID
+	})
+	if len(matches) > q.Limit {
+		matches = matches[:q.Limit]
+	}
+	return matches
+}
+
+// SemanticSearch returns the tenant's indexed documents closest in meaning
+// to the query text, most similar first.
+func (s *AnalyticsService) SemanticSearch(ctx context.Context, idx *VectorIndex, tenant string, q SemanticQuery) ([]SemanticMatch, error) {
+	q.Query = strings.TrimSpace(q.Query)
+	if q.Query == "" {
+		return nil, fmt.Errorf("%w: query is required", ErrInvalidInput)
+	}
+	for _, kind := range q.Kinds {
+		if kind != DocumentLog && kind != DocumentInsight && kind != DocumentIssue {
+			return nil, fmt.Errorf("%w: unknown kind %q", ErrInvalidInput, kind)
+		}
+	}
+	categories, err := ParseCategories(strings.Join(q.Categories, ","))
+	if err != nil {
+		return nil, err
+	}
+	q.Categories = categories
+	if q.Limit <= 0 {
+		q.Limit = 20
+	}
+	if q.Limit > maxSemanticResults {
+		q.Limit = maxSemanticResults
+	}
+	if q.MinScore == 0 {
+		q.MinScore = 0.5
+	}
+
+	vectors, err := s.Embed(ctx, []string{q.Query}, "RETRIEVAL_QUERY")
+	if err != nil {
+		return nil, fmt.Errorf("error embedding query: %w", err)
+	}
+	return idx.search(tenant, vectors[0], q), nil
+}
@@ -0,0 +1,95 @@
+package analytics
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+
+	"analyticsai/ai-service/analytics/aggregator"
+)
+
+// maxPromptClusters caps the clusters Gemini is asked about.
+const maxPromptClusters = 20
+
+// AnalyzeErrors clusters error entries and asks Gemini for a probable cause
+// for each of the largest clusters.
+func (s *AnalyticsService) AnalyzeErrors(ctx context.Context, logs []LogEntry) (*aggregator.ErrorClusterReport, error) {
+	if err := CheckEntryLimit(ctx, len(logs)); err != nil {
+		return nil, err
+	}
+
+	report := aggregator.ClusterErrors(logs)
+	if len(report.Clusters) == 0 {
+		return report, nil
+	}
+
+	var summary strings.Builder
+	for i, cluster := range report.Clusters {
+		if i == maxPromptClusters {
+			break
+		}
+		summary.WriteString(fmt.Sprintf("Cluster %s: %d occurrences between %s and %s\n",
+			cluster.ID, cluster.Count, cluster.FirstSeen, cluster.LastSeen))
+		summary.WriteString(fmt.Sprintf("- Template: %s\n", untrusted(cluster.Template)))
+		summary.WriteString(fmt.Sprintf("- Paths: %s\n", untrusted(strings.Join(cluster.Paths, ", "))))
+		for _, example := range cluster.Examples {
+			summary.WriteString(fmt.Sprintf("- Example: %s\n", untrusted(example)))
+		}
+		summary.WriteString("\n")
+	}
+
+	prompt := buildPrompt(s.instructions(PromptErrorClusters, nil), "Error Clusters", s.redact(ctx, summary.String()))
+
+	response, err := s.callGeminiAPI(ctx, prompt)
+	if err != nil {
+		return nil, fmt.Errorf("error generating analysis: %w", err)
+	}
+
+	var result struct {
+		Clusters []struct {
+			ID            string `json:"id"`
+			ProbableCause string `json:"probable_cause"`
+		} `json:"clusters"`
+	}
+	if err := decodeModelOutput(ctx, response, &result); err != nil {
+		return nil, err
+	}
+
+	causes := make(map[string]string, len(result.Clusters))
+	for _, c := range result.Clusters {
+		causes[c.ID] = c.ProbableCause
+	}
+	for i := range report.Clusters {
+		report.Clusters[i].ProbableCause = causes[report.Clusters[i].ID]
+	}
+
+	return report, nil
+}
+
+func containsString(values []string, s string) bool {
+	for _, v := range values {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
+
+// topKeys returns up to n keys with the highest counts, ties broken by key.
+func topKeys(counts map[string]int, n int) []string {
+	keys := make([]string, 0, len(counts))
+	for k := range counts {
+		keys = append(keys, k)
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		if counts[keys[i]] != counts[keys[j]] {
+			return counts[keys[i]] > counts[keys[j]]
+		}
+		return keys[i] < keys[j]
+	})
+	if len(keys) > n {
+		keys = keys[:n]
+	}
+	return keys
+}
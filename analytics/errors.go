@@ -0,0 +1,8 @@
+package analytics
+
+import "analyticsai/ai-service/analytics/parser"
+
+// ErrInvalidInput wraps errors caused by the caller's data or options rather
+// than by the service, so handlers can report them as bad requests. It is
+// the parser layer's error, so every layer wraps the same value.
+var ErrInvalidInput = parser.ErrInvalidInput
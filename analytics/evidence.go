@@ -0,0 +1,337 @@
+package analytics
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+
+	"analyticsai/ai-service/analytics/aggregator"
+)
+
+// Metrics an Evidence value can cite.
+var evidenceMetrics = []string{"requests", "errors", "error_rate", "avg_duration", "p95_duration"}
+
+// evidenceTolerance is how far, relatively, a cited value may be from the
+// recomputed one and still count as verified. Counts are also allowed to be
+// off by one.
+const evidenceTolerance = 0.1
+
+// Evidence points at the data a finding rests on: a path, a time window, or
+// both, optionally with a metric value the model read from the summary.
+type Evidence struct {
+	Path   string   `json:"path,omitempty"`
+	Start  string   `json:"start,omitempty"` // RFC 3339
+	End    string   `json:"end,omitempty"`
+	Metric string   `json:"metric,omitempty"` // one of evidenceMetrics
+	Value  *float64 `json:"value,omitempty"`
+
+	// Verified is set by the service when the reference matches the logs:
+	// the path and window contain entries, and the value, if any, is
+	// within evidenceTolerance of the recomputed metric.
+	Verified bool `json:"verified"`
+}
+
+// UnmarshalJSON also accepts a quoted or percentage value, such as "4.2"
+// or "4.2%". Unknown fields are ignored.
+func (e *Evidence) UnmarshalJSON(data []byte) error {
+	type plain Evidence
+	var raw struct {
+		plain
+		Value json.RawMessage `json:"value"`
+	}
+	if err := json.Unmarshal(data, &raw); err != nil {
+		return err
+	}
+	*e = Evidence(raw.plain)
+	if len(raw.Value) == 0 || string(raw.Value) == "null" {
+		return nil
+	}
+	value, err := looseNumber(raw.Value)
+	if err != nil {
+		return fmt.Errorf("value: %v", err)
+	}
+	e.Value = &value
+	return nil
+}
+
+// Insight is an observation about the analyzed logs.
+type Insight struct {
+	Text       string     `json:"text"`
+	Category   string     `json:"category"`   // one of Categories
+	Confidence float64    `json:"confidence"` // 0 to 1, as estimated by the model
+	Evidence   []Evidence `json:"evidence"`
+	Grounded   bool       `json:"grounded"` // whether any evidence was verified
+
+	// Consensus is set in consensus mode.
+	Consensus *Provenance `json:"consensus,omitempty"`
+}
+
+// UnmarshalJSON also accepts a plain string, the form insights took before
+// they carried confidence and evidence, so older stored analyses decode,
+// and a quoted or percentage confidence. Unknown fields are ignored.
+func (i *Insight) UnmarshalJSON(data []byte) error {
+	var text string
+	if json.Unmarshal(data, &text) == nil {
+		*i = Insight{Text: text, Evidence: []Evidence{}}
+		return nil
+	}
+	type plain Insight
+	var raw struct {
+		plain
+		Confidence json.RawMessage `json:"confidence"`
+	}
+	if err := json.Unmarshal(data, &raw); err != nil {
+		return err
+	}
+	confidence, err := looseNumber(raw.Confidence)
+	if err != nil {
+		return fmt.Errorf("confidence: %v", err)
+	}
+	*i = Insight(raw.plain)
+	i.Confidence = confidence
+	return nil
+}
+
+// looseNumber reads a number that models sometimes quote or write as a
+// percentage, such as 0.8, "0.8" or "80%"; the percent sign is dropped.
+// A missing or null number reads as 0.
+func looseNumber(raw json.RawMessage) (float64, error) {
+	if len(raw) == 0 || string(raw) == "null" {
+		return 0, nil
+	}
+	var n float64
+	if json.Unmarshal(raw, &n) == nil {
+		return n, nil
+	}
+	var s string
+	if err := json.Unmarshal(raw, &s); err != nil {
+		return 0, fmt.Errorf("%s is not a number", raw)
+	}
+	n, err := strconv.ParseFloat(strings.TrimSpace(strings.TrimSuffix(strings.TrimSpace(s), "%")), 64)
+	if err != nil {
+		return 0, fmt.Errorf("%q is not a number", s)
+	}
+	return n, nil
+}
+
+// InsightTexts returns the text of each insight.
+func InsightTexts(insights []Insight) []string {
+	texts := make([]string, len(insights))
+	for i, insight := range insights {
+		texts[i] = insight.Text
+	}
+	return texts
+}
+
+// validateConfidence checks a model-reported confidence, reading values
+// between 1 and 100 as percentages.
+func validateConfidence(c *float64) error {
+	if *c > 1 && *c <= 100 {
+		*c /= 100
+	}
+	if *c < 0 || *c > 1 || math.IsNaN(*c) {
+		return fmt.Errorf("confidence %g is not between 0 and 1", *c)
+	}
+	*c = math.Round(*c*100) / 100
+	return nil
+}
+
+func (e *Evidence) validate() error {
+	if e.Metric != "" && !containsString(evidenceMetrics, e.Metric) {
+		return fmt.Errorf("unknown evidence metric %q", e.Metric)
+	}
+	return nil
+}
+
+func (i *Insight) validate() error {
+	i.Category = i.category()
+	i.Consensus = nil // set by the service, never by the model
+	return validateConfidence(&i.Confidence)
+}
+
+// evidenceInstructions explains the issue vocabularies, categories and the
+// confidence and evidence fields of insights and issues; it follows the
+// JSON structure in prompts.
+const evidenceInstructions = `
+An issue's "type" is one of performance, errors, availability, security, resource, traffic, configuration or other, its "severity" one of low, medium, high or critical, and its "path" a list of the affected paths. Give every insight and issue a "category" for the team that owns it: performance (latency, throughput, slow pages), reliability (errors, outages, failed requests), security (attacks, authentication, suspicious clients), ux (user journeys, devices, abandonment) or cost (bots, crawlers, bandwidth, resource use). Set "confidence" between 0 and 1: high only when the summary directly shows the finding, low when it is an inference or a guess. In "evidence", cite the summary lines the finding rests on: the path, the time window (start and end as RFC 3339 timestamps), and the metric (requests, errors, error_rate in percent, avg_duration or p95_duration in milliseconds) with its value as given in the summary. Leave evidence empty rather than inventing it.`
+
+// evidenceSchema is the response schema of an evidence list.
+var evidenceSchema = map[string]interface{}{
+	"type": "ARRAY",
+	"items": map[string]interface{}{
+		"type": "OBJECT",
+		"properties": map[string]interface{}{
+			"path":   map[string]interface{}{"type": "STRING"},
+			"start":  map[string]interface{}{"type": "STRING"},
+			"end":    map[string]interface{}{"type": "STRING"},
+			"metric": map[string]interface{}{"type": "STRING", "enum": evidenceMetrics},
+			"value":  map[string]interface{}{"type": "NUMBER"},
+		},
+	},
+}
+
+// issueSchema is the response schema of an issue list.
+var issueSchema = map[string]interface{}{
+	"type": "ARRAY",
+	"items": map[string]interface{}{
+		"type": "OBJECT",
+		"properties": map[string]interface{}{
+			"type":        map[string]interface{}{"type": "STRING", "enum": IssueTypes},
+			"description": map[string]interface{}{"type": "STRING"},
+			"severity":    map[string]interface{}{"type": "STRING", "enum": IssueSeverities},
+			"category":    map[string]interface{}{"type": "STRING", "enum": Categories},
+			"path":        map[string]interface{}{"type": "ARRAY", "items": map[string]interface{}{"type": "STRING"}},
+			"confidence":  map[string]interface{}{"type": "NUMBER"},
+			"evidence":    evidenceSchema,
+		},
+		"required": []string{"type", "description", "severity", "category", "confidence", "evidence"},
+	},
+}
+
+// pageSchema is the response schema of a PerformanceData list.
+var pageSchema = map[string]interface{}{
+	"type": "ARRAY",
+	"items": map[string]interface{}{
+		"type": "OBJECT",
+		"properties": map[string]interface{}{
+			"path":          map[string]interface{}{"type": "STRING"},
+			"avg_duration":  map[string]interface{}{"type": "INTEGER"},
+			"request_count": map[string]interface{}{"type": "INTEGER"},
+			"error_rate":    map[string]interface{}{"type": "NUMBER"},
+		},
+	},
+}
+
+var stringsSchema = map[string]interface{}{"type": "ARRAY", "items": map[string]interface{}{"type": "STRING"}}
+
+// logAnalysisSchema constrains the log analysis response through Gemini's
+// structured output.
+var logAnalysisSchema = map[string]interface{}{
+	"type": "OBJECT",
+	"properties": map[string]interface{}{
+		"popular_pages":    stringsSchema,
+		"slow_pages":       pageSchema,
+		"potential_issues": issueSchema,
+		"insights": map[string]interface{}{
+			"type": "ARRAY",
+			"items": map[string]interface{}{
+				"type": "OBJECT",
+				"properties": map[string]interface{}{
+					"text":       map[string]interface{}{"type": "STRING"},
+					"category":   map[string]interface{}{"type": "STRING", "enum": Categories},
+					"confidence": map[string]interface{}{"type": "NUMBER"},
+					"evidence":   evidenceSchema,
+				},
+				"required": []string{"text", "category", "confidence", "evidence"},
+			},
+		},
+	},
+	"required": []string{"popular_pages", "slow_pages", "potential_issues", "insights"},
+}
+
+// performanceAnalysisSchema constrains the performance analysis response.
+var performanceAnalysisSchema = map[string]interface{}{
+	"type": "OBJECT",
+	"properties": map[string]interface{}{
+		"slow_endpoints":       pageSchema,
+		"performance_patterns": stringsSchema,
+		"resource_issues":      issueSchema,
+		"recommendations":      stringsSchema,
+	},
+	"required": []string{"slow_endpoints", "performance_patterns", "resource_issues", "recommendations"},
+}
+
+// verifyEvidence checks e against logs, which the model only saw summarized.
+func verifyEvidence(e Evidence, logs []LogEntry) bool {
+	var start, end time.Time
+	if e.Start != "" || e.End != "" {
+		var err error
+		if start, err = time.Parse(time.RFC3339, e.Start); err != nil {
+			return false
+		}
+		if end, err = time.Parse(time.RFC3339, e.End); err != nil || end.Before(start) {
+			return false
+		}
+	}
+	if e.Path == "" && start.IsZero() {
+		return false
+	}
+
+	var matched []LogEntry
+	for _, log := range logs {
+		if e.Path != "" && log.Path != e.Path {
+			continue
+		}
+		if !start.IsZero() {
+			t, err := time.Parse(time.RFC3339, log.Timestamp)
+			if err != nil || t.Before(start) || t.After(end) {
+				continue
+			}
+		}
+		matched = append(matched, log)
+	}
+	if len(matched) == 0 {
+		return false
+	}
+	if e.Metric == "" || e.Value == nil {
+		return true
+	}
+
+	requests, errors := len(matched), 0
+	var durationSum int64
+	durations := make([]int64, 0, len(matched))
+	for _, log := range matched {
+		if log.Status >= 400 {
+			errors++
+		}
+		durationSum += log.Duration
+		durations = append(durations, log.Duration)
+	}
+	var actual float64
+	count := false
+	switch e.Metric {
+	case "requests":
+		actual, count = float64(requests), true
+	case "errors":
+		actual, count = float64(errors), true
+	case "error_rate":
+		actual = float64(errors) / float64(requests) * 100
+	case "avg_duration":
+		actual = float64(durationSum) / float64(requests)
+	case "p95_duration":
+		aggregator.SortDurations(durations)
+		actual = float64(aggregator.Percentile(durations, 95))
+	default:
+		return false
+	}
+	diff := math.Abs(*e.Value - actual)
+	return diff <= evidenceTolerance*math.Abs(actual) || count && diff <= 1 || diff < 0.05
+}
+
+// groundFindings verifies the evidence of every insight and issue against
+// logs and marks the findings with verified evidence as grounded.
+func groundFindings(logs []LogEntry, insights []Insight, issues []Issue) {
+	ground := func(evidence []Evidence) bool {
+		grounded := false
+		for i := range evidence {
+			evidence[i].Verified = verifyEvidence(evidence[i], logs)
+			grounded = grounded || evidence[i].Verified
+		}
+		return grounded
+	}
+	for i := range insights {
+		if insights[i].Evidence == nil {
+			insights[i].Evidence = []Evidence{}
+		}
+		insights[i].Grounded = ground(insights[i].Evidence)
+	}
+	for i := range issues {
+		if issues[i].Evidence == nil {
+			issues[i].Evidence = []Evidence{}
+		}
+		issues[i].Grounded = ground(issues[i].Evidence)
+	}
+}
@@ -0,0 +1,240 @@
+package analytics
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Feedback ratings.
+const (
+	RatingUseful    = "useful"
+	RatingWrong     = "wrong"
+	RatingDuplicate = "duplicate"
+)
+
+const (
+	maxFeedbackPerTenant = 5000
+	maxFeedbackComment   = 500 // characters
+	maxFeedbackExamples  = 3   // examples per polarity included in prompts
+)
+
+// Feedback is a user's rating of one insight or potential issue of a
+// stored analysis.
+type Feedback struct {
+	ID         string    `json:"id"`
+	Tenant     string    `json:"tenant"`
+	AnalysisID string    `json:"analysis_id"`
+	Kind       string    `json:"kind"`  // DocumentInsight or DocumentIssue
+	Index      int       `json:"index"` // position in the analysis's insights or potential issues
+	Text       string    `json:"text"`  // the rated insight, or "type: description" of the issue
+	Rating     string    `json:"rating"`
+	Comment    string    `json:"comment,omitempty"`
+	CreatedAt  time.Time `json:"created_at"`
+}
+
+// FeedbackItem returns the text of the kind item at index of an analysis,
+// as stored in Feedback.Text.
+func FeedbackItem(result *AnalysisResult, kind string, index int) (string, error) {
+	switch kind {
+	case DocumentInsight:
+		if index < 0 || index >= len(result.Insights) {
+			return "", fmt.Errorf("%w: the analysis has no insight %d", ErrInvalidInput, index)
+		}
+		return result.Insights[index].Text, nil
+	case DocumentIssue:
+		if index < 0 || index >= len(result.PotentialIssues) {
+			return "", fmt.Errorf("%w: the analysis has no potential issue %d", ErrInvalidInput, index)
+		}
+		return issueText(result.PotentialIssues[index]), nil
+	}
+	return "", fmt.Errorf("%w: kind must be %q or %q", ErrInvalidInput, DocumentInsight, DocumentIssue)
+}
+
+// FeedbackExample is a rated insight or issue used as few-shot guidance.
+type FeedbackExample struct {
+	Kind    string
+	Text    string
+	Rating  string
+	Count   int    // times it was given this rating
+	Comment string // the latest comment, if any
+}
+
+// writeFeedbackGuidance appends reviewer feedback on earlier analyses to a
+// prompt's data.
+func writeFeedbackGuidance(summary *strings.Builder, examples []FeedbackExample) {
+	if len(examples) == 0 {
+		return
+	}
+	summary.WriteString("\nReviewer feedback on earlier analyses:\n")
+	for _, e := range examples {
+		fmt.Fprintf(summary, "- %s rated %s by %d reviewer(s): %s", e.Kind, e.Rating, e.Count, untrusted(e.Text))
+		if e.Comment != "" {
+			fmt.Fprintf(summary, " (comment: %s)", untrusted(e.Comment))
+		}
+		summary.WriteString("\n")
+	}
+}
+
+// feedbackInstructions tells the model how to use the feedback written by
+// writeFeedbackGuidance.
+const feedbackInstructions = `
+If the data ends with reviewer feedback on earlier analyses, write insights and issues in the style of those rated useful, and avoid the mistakes and repetition of those rated wrong or duplicate. Don't copy the examples unless this data supports them.`
+
+// FeedbackRegistry holds feedback, optionally backed by a JSON file.
+type FeedbackRegistry struct {
+	mu       sync.Mutex
+	path     string
+	feedback []Feedback
+}
+
+// NewFeedbackRegistry loads feedback from path. An empty path or a missing
+// file yields an empty registry; additions are written back when path is
+// set.
+func NewFeedbackRegistry(path string) (*FeedbackRegistry, error) {
+	r := &FeedbackRegistry{path: path}
+	if path == "" {
+		return r, nil
+	}
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return r, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("error reading feedback file: %v", err)
+	}
+	if err := json.Unmarshal(data, &r.feedback); err != nil {
+		return nil, fmt.Errorf("error parsing feedback file: %v", err)
+	}
+	return r, nil
+}
+
+func (r *FeedbackRegistry) save() error {
+	if r.path == "" {
+		return nil
+	}
+	data, err := json.MarshalIndent(r.feedback, "", "  ")
+	if err != nil {
+		return fmt.Errorf("error marshaling feedback: %v", err)
+	}
+	if err := os.WriteFile(r.path, data, 0644); err != nil {
+		return fmt.Errorf("error writing feedback file: %v", err)
+	}
+	return nil
+}
+
+// Add validates and stores f, assigning its ID and time. The tenant's
+// oldest feedback is dropped beyond maxFeedbackPerTenant.
+func (r *FeedbackRegistry) Add(f Feedback) (Feedback, error) {
+	if f.Rating != RatingUseful && f.Rating != RatingWrong && f.Rating != RatingDuplicate {
+		return Feedback{}, fmt.Errorf("%w: rating must be %q, %q or %q", ErrInvalidInput, RatingUseful, RatingWrong, RatingDuplicate)
+	}
+	f.Comment = strings.TrimSpace(f.Comment)
+	if len(f.Comment) > maxFeedbackComment {
+		return Feedback{}, fmt.Errorf("%w: comment is longer than %d characters", ErrInvalidInput, maxFeedbackComment)
+	}
+	b := make([]byte, 8)
+	if _, err := rand.Read(b); err != nil {
+		return Feedback{}, fmt.Errorf("error generating feedback id: %v", err)
+	}
+	f.ID = hex.EncodeToString(b)
+	f.CreatedAt = time.Now().UTC()
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.feedback = append(r.feedback, f)
+	n := 0
+	for i := len(r.feedback) - 1; i >= 0; i-- {
+		if r.feedback[i].Tenant != f.Tenant {
+			continue
+		}
+		if n++; n > maxFeedbackPerTenant {
+			r.feedback = append(r.feedback[:i], r.feedback[i+1:]...)
+		}
+	}
+	return f, r.save()
+}
+
+// List returns the tenant's feedback, newest first, restricted to one
+// analysis when analysisID is set.
+func (r *FeedbackRegistry) List(tenant, analysisID string) []Feedback {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	list := []Feedback{}
+	for i := len(r.feedback) - 1; i >= 0; i-- {
+		f := r.feedback[i]
+		if f.Tenant == tenant && (analysisID == "" || f.AnalysisID == analysisID) {
+			list = append(list, f)
+		}
+	}
+	return list
+}
+
+// Examples returns the tenant's most often rated useful items, followed by
+// those most often rated wrong or duplicate, for inclusion in prompts.
+func (r *FeedbackRegistry) Examples(tenant string) []FeedbackExample {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	type key struct{ kind, text, rating string }
+	byKey := make(map[key]*FeedbackExample)
+	latest := make(map[key]time.Time)
+	for _, f := range r.feedback {
+		if f.Tenant != tenant {
+			continue
+		}
+		k := key{f.Kind, f.Text, f.Rating}
+		e, ok := byKey[k]
+		if !ok {
+			e = &FeedbackExample{Kind: f.Kind, Text: f.Text, Rating: f.Rating}
+			byKey[k] = e
+		}
+		e.Count++
+		if f.Comment != "" {
+			e.Comment = f.Comment
+		}
+		latest[k] = f.CreatedAt
+	}
+
+	var useful, rejected []FeedbackExample
+	keys := make([]key, 0, len(byKey))
+	for k := range byKey {
+		keys = append(keys, k)
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		if a, b := byKey[keys[i]].Count, byKey[keys[j]].Count; a != b {
+			return a > b
+		}
+		return latest[keys[i]].After(latest[keys[j]])
+	})
+	for _, k := range keys {
+		e := *byKey[k]
+		if e.Rating == RatingUseful && len(useful) < maxFeedbackExamples {
+			useful = append(useful, e)
+		} else if e.Rating != RatingUseful && len(rejected) < maxFeedbackExamples {
+			rejected = append(rejected, e)
+		}
+	}
+	return append(useful, rejected...)
+}
+
+// DeleteTenant removes the tenant's feedback and returns how much there
+// was.
+func (r *FeedbackRegistry) DeleteTenant(tenant string) (int, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	kept := r.feedback[:0]
+	for _, f := range r.feedback {
+		if f.Tenant != tenant {
+			kept = append(kept, f)
+		}
+	}
+	n := len(r.feedback) - len(kept)
+	r.feedback = kept
+	return n, r.save()
+}
@@ -0,0 +1,71 @@
+package analytics
+
+import (
+	"fmt"
+	"strings"
+
+	"analyticsai/ai-service/analytics/aggregator"
+	"analyticsai/ai-service/analytics/parser"
+)
+
+// Filter keeps log entries whose field equals (or, when Negate is set,
+// differs from) Value. Field is any GroupBy dimension, e.g. "level" or
+// "metadata.region".
+type Filter struct {
+	Field  string
+	Value  string
+	Negate bool
+}
+
+// ParseFilter parses an expression such as "metadata.region=eu-west" or
+// "metadata.version!=1.4.2".
+func ParseFilter(expr string) (Filter, error) {
+	var f Filter
+	field, value, ok := strings.Cut(expr, "!=")
+	if ok {
+		f.Negate = true
+	} else if field, value, ok = strings.Cut(expr, "="); !ok {
+		return f, fmt.Errorf("%w: filter %q must have the form field=value or field!=value", ErrInvalidInput, expr)
+	}
+	f.Field = strings.TrimSpace(field)
+	f.Value = strings.TrimSpace(value)
+	if _, err := aggregator.ParseGroupBy(f.Field); err != nil || f.Field == "" {
+		return f, fmt.Errorf("%w: unknown filter field %q", ErrInvalidInput, f.Field)
+	}
+	return f, nil
+}
+
+// Match reports whether log passes the filter. Metadata values compare
+// exactly; the other fields compare case-insensitively.
+func (f Filter) Match(log LogEntry) bool {
+	value := aggregator.FieldValue(log, f.Field)
+	var equal bool
+	if strings.HasPrefix(f.Field, parser.MetadataPrefix) {
+		equal = value == f.Value
+	} else {
+		equal = strings.EqualFold(value, f.Value)
+	}
+	return equal != f.Negate
+}
+
+// applyFilters returns the entries of logs matching every filter, reusing
+// the backing array of logs.
+func applyFilters(logs []LogEntry, filters []Filter) []LogEntry {
+	kept := logs[:0]
+	for _, log := range logs {
+		if matchesAll(log, filters) {
+			kept = append(kept, log)
+		}
+	}
+	return kept
+}
+
+// matchesAll reports whether log passes every filter.
+func matchesAll(log LogEntry, filters []Filter) bool {
+	for _, f := range filters {
+		if !f.Match(log) {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,53 @@
+package analytics
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"analyticsai/ai-service/analytics/aggregator"
+)
+
+// ForecastTraffic fits the forecast and asks Gemini to comment on the
+// expected peaks.
+func (s *AnalyticsService) ForecastTraffic(ctx context.Context, logs []LogEntry, opts aggregator.ForecastOptions) (*aggregator.ForecastReport, error) {
+	if err := CheckEntryLimit(ctx, len(logs)); err != nil {
+		return nil, err
+	}
+	report, err := aggregator.FitForecast(logs, opts)
+	if err != nil {
+		return nil, err
+	}
+
+	var summary strings.Builder
+	summary.WriteString(fmt.Sprintf("%s seasonal model over %d %s buckets, trend %+.2f requests per bucket per day",
+		report.Season, report.History, report.Interval, report.TrendPerDay))
+	if report.MAPE != nil {
+		summary.WriteString(fmt.Sprintf(", in-sample error %.1f%%", *report.MAPE))
+	}
+	summary.WriteString(fmt.Sprintf(".\n\nProjected requests per day (%.0f%% band):\n", report.Confidence*100))
+	for _, d := range report.Daily {
+		summary.WriteString(fmt.Sprintf("- %s: %.0f (%.0f-%.0f), peak %.0f at %s\n", d.Date, d.Requests, d.Lower, d.Upper, d.PeakValue, d.PeakStart))
+	}
+	summary.WriteString("\nBusiest projected buckets:\n")
+	for _, p := range report.Peaks {
+		summary.WriteString(fmt.Sprintf("- %s: %.0f (%.0f-%.0f)\n", p.Start, p.Requests, p.Lower, p.Upper))
+	}
+	writeTimezoneNote(&summary, opts.Location)
+
+	prompt := buildPrompt(s.instructions(PromptForecast, nil), "Traffic Forecast", s.redact(ctx, summary.String()))
+
+	response, err := s.callGeminiAPI(ctx, prompt)
+	if err != nil {
+		return nil, fmt.Errorf("error generating analysis: %w", err)
+	}
+
+	var result struct {
+		Commentary string `json:"commentary"`
+	}
+	if err := decodeModelOutput(ctx, response, &result); err != nil {
+		return nil, err
+	}
+	report.Commentary = result.Commentary
+	return report, nil
+}
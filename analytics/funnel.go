@@ -0,0 +1,62 @@
+package analytics
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"analyticsai/ai-service/analytics/aggregator"
+)
+
+// AnalyzeFunnel computes conversion through the given steps and asks
+// Gemini for hypotheses about the biggest leaks.
+func (s *AnalyticsService) AnalyzeFunnel(ctx context.Context, req aggregator.FunnelRequest) (*aggregator.FunnelReport, error) {
+	if err := CheckEntryLimit(ctx, len(req.Logs)); err != nil {
+		return nil, err
+	}
+	if len(req.Steps) < 2 {
+		return nil, fmt.Errorf("%w: a funnel needs at least two steps", ErrInvalidInput)
+	}
+	var gap time.Duration
+	if req.SessionGap != "" {
+		d, err := time.ParseDuration(req.SessionGap)
+		if err != nil || d <= 0 {
+			return nil, fmt.Errorf("%w: invalid session_gap %q", ErrInvalidInput, req.SessionGap)
+		}
+		gap = d
+	}
+
+	report := aggregator.ComputeFunnel(aggregator.BuildSessions(req.Logs, gap), req.Steps)
+	if report.Steps[0].Sessions == 0 {
+		return report, nil
+	}
+
+	var summary strings.Builder
+	for _, step := range report.Steps {
+		summary.WriteString(fmt.Sprintf("Step %d %s: %d sessions, %.1f%% from previous step, %.1f%% drop-off\n",
+			step.Step, untrusted(step.Path), step.Sessions, step.ConversionFromPrev, step.DropOffRate))
+		for dest, n := range step.DropOffDestinations {
+			summary.WriteString(fmt.Sprintf("- %d dropped sessions went to %s\n", n, untrusted(dest)))
+		}
+	}
+
+	prompt := buildPrompt(s.instructions(PromptFunnel, nil), "Funnel", s.redact(ctx, summary.String()))
+
+	response, err := s.callGeminiAPI(ctx, prompt)
+	if err != nil {
+		return nil, fmt.Errorf("error generating analysis: %w", err)
+	}
+
+	var result struct {
+		Hypotheses []string `json:"hypotheses"`
+	}
+	if err := decodeModelOutput(ctx, response, &result); err != nil {
+		return nil, err
+	}
+	if result.Hypotheses != nil {
+		report.Hypotheses = result.Hypotheses
+	}
+
+	return report, nil
+}
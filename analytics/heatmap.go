@@ -0,0 +1,48 @@
+package analytics
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"analyticsai/ai-service/analytics/aggregator"
+)
+
+// AnalyzeHeatmap builds the traffic heatmap and asks Gemini to comment on
+// peak windows and good maintenance windows.
+func (s *AnalyticsService) AnalyzeHeatmap(ctx context.Context, logs []LogEntry, loc *time.Location) (*aggregator.Heatmap, error) {
+	if err := CheckEntryLimit(ctx, len(logs)); err != nil {
+		return nil, err
+	}
+
+	heatmap := aggregator.BuildHeatmap(logs, loc)
+
+	var summary strings.Builder
+	summary.WriteString(fmt.Sprintf("Requests per weekday and hour (%s), non-empty slots only:\n", heatmap.Timezone))
+	for day, hours := range heatmap.Requests {
+		for hour, requests := range hours {
+			if requests > 0 {
+				summary.WriteString(fmt.Sprintf("- %s %02d:00: %d requests, error rate %.1f%%\n",
+					heatmap.Days[day], hour, requests, heatmap.ErrorRates[day][hour]))
+			}
+		}
+	}
+
+	prompt := buildPrompt(s.instructions(PromptHeatmap, nil), "Heatmap", s.redact(ctx, summary.String()))
+
+	response, err := s.callGeminiAPI(ctx, prompt)
+	if err != nil {
+		return nil, fmt.Errorf("error generating analysis: %w", err)
+	}
+
+	var result struct {
+		Commentary []string `json:"commentary"`
+	}
+	if err := decodeModelOutput(ctx, response, &result); err != nil {
+		return nil, err
+	}
+	heatmap.Commentary = result.Commentary
+
+	return heatmap, nil
+}
@@ -0,0 +1,129 @@
+package analytics
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"analyticsai/ai-service/analytics/aggregator"
+)
+
+// Incident categories.
+const (
+	CategoryAvailability = "availability"
+	CategorySecurity     = "security"
+)
+
+// Keywords that place an AI-reported issue type in an incident category.
+var (
+	availabilityKeywords = []string{"availability", "outage", "downtime", "unavailable", "error", "5xx", "timeout", "crash", "failure"}
+	securityKeywords     = []string{"security", "attack", "injection", "xss", "brute", "unauthorized", "intrusion", "exploit", "vulnerab", "scan"}
+)
+
+// Finding is one critical issue behind an incident.
+type Finding struct {
+	Source      string   `json:"source"` // "analysis" or "anomaly"
+	Type        string   `json:"type"`
+	Description string   `json:"description"`
+	Paths       []string `json:"paths,omitempty"`
+}
+
+// IncidentCandidate groups the critical findings of one category in the
+// time window an analysis covered.
+type IncidentCandidate struct {
+	Category    string    `json:"category"`
+	WindowStart string    `json:"window_start,omitempty"`
+	WindowEnd   string    `json:"window_end,omitempty"`
+	Findings    []Finding `json:"findings"`
+}
+
+// issueCategory returns the incident category of an issue type, or "".
+func issueCategory(issueType string) string {
+	t := strings.ToLower(issueType)
+	for _, k := range securityKeywords {
+		if strings.Contains(t, k) {
+			return CategorySecurity
+		}
+	}
+	for _, k := range availabilityKeywords {
+		if strings.Contains(t, k) {
+			return CategoryAvailability
+		}
+	}
+	return ""
+}
+
+// CriticalFindings collects the findings of an analysis that warrant paging
+// someone: critical availability or security issues reported by the model
+// and high-severity error-rate anomalies. Findings are grouped into one
+// candidate per category, availability first.
+func CriticalFindings(logs []LogEntry, issues []Issue, anomalies []aggregator.Anomaly) []IncidentCandidate {
+	byCategory := make(map[string]*IncidentCandidate)
+	add := func(category string, f Finding) {
+		candidate, ok := byCategory[category]
+		if !ok {
+			candidate = &IncidentCandidate{Category: category}
+			byCategory[category] = candidate
+		}
+		candidate.Findings = append(candidate.Findings, f)
+	}
+
+	for _, issue := range issues {
+		if issue.Severity != "critical" {
+			continue
+		}
+		if category := issueCategory(issue.Type); category != "" {
+			add(category, Finding{
+				Source:      "analysis",
+				Type:        issue.Type,
+				Description: issue.Description,
+				Paths:       issue.Path,
+			})
+		}
+	}
+	for _, a := range anomalies {
+		if a.Metric != "error_rate" || a.Severity != "high" {
+			continue
+		}
+		add(CategoryAvailability, Finding{
+			Source: "anomaly",
+			Type:   "error_rate_spike",
+			Description: fmt.Sprintf("error rate %.1f%% against an expected %.1f%% between %s and %s",
+				a.Value, a.Expected, a.Start, a.End),
+			Paths: []string{a.Path},
+		})
+	}
+
+	var start, end string
+	if first, last, ok := aggregator.TimeRange(logs); ok {
+		start, end = first.UTC().Format(time.RFC3339), last.UTC().Format(time.RFC3339)
+	}
+	candidates := []IncidentCandidate{}
+	for _, category := range []string{CategoryAvailability, CategorySecurity} {
+		if c, ok := byCategory[category]; ok {
+			c.WindowStart, c.WindowEnd = start, end
+			candidates = append(candidates, *c)
+		}
+	}
+	return candidates
+}
+
+// DedupKey identifies the incident for tenant, so that analysing the same
+// window again updates the open incident instead of paging twice. Without
+// timestamps the affected paths stand in for the window.
+func (c IncidentCandidate) DedupKey(tenant, kind string) string {
+	parts := []string{tenant, kind, c.Category, c.WindowStart, c.WindowEnd}
+	if c.WindowStart == "" {
+		var paths []string
+		for _, f := range c.Findings {
+			paths = append(paths, f.Paths...)
+		}
+		sort.Strings(paths)
+		parts = append(parts, paths...)
+	}
+	sum := sha256.Sum256([]byte(strings.Join(parts, "\x00")))
+	return c.Category + "-" + hex.EncodeToString(sum[:12])
+}
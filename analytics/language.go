@@ -0,0 +1,81 @@
+package analytics
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// languages maps the supported output language codes to the names used in
+// prompts.
+var languages = map[string]string{
+	"ar": "Arabic",
+	"de": "German",
+	"en": "English",
+	"es": "Spanish",
+	"fr": "French",
+	"hi": "Hindi",
+	"id": "Indonesian",
+	"it": "Italian",
+	"ja": "Japanese",
+	"ko": "Korean",
+	"nl": "Dutch",
+	"pl": "Polish",
+	"pt": "Portuguese",
+	"ru": "Russian",
+	"th": "Thai",
+	"tr": "Turkish",
+	"vi": "Vietnamese",
+	"zh": "Chinese",
+}
+
+// ParseLanguage validates an output language code such as "ko" or "pt-BR",
+// returning its lowercased primary subtag. Empty means English.
+func ParseLanguage(raw string) (string, error) {
+	if raw == "" {
+		return "", nil
+	}
+	code := strings.ToLower(raw)
+	if i := strings.IndexAny(code, "-_"); i >= 0 {
+		code = code[:i]
+	}
+	if _, ok := languages[code]; !ok {
+		codes := make([]string, 0, len(languages))
+		for c := range languages {
+			codes = append(codes, c)
+		}
+		sort.Strings(codes)
+		return "", fmt.Errorf("unsupported lang %q, expected one of %s", raw, strings.Join(codes, ", "))
+	}
+	return code, nil
+}
+
+type languageKey struct{}
+
+// WithLanguage makes the analyses run with ctx write their free text in the
+// language code, as returned by ParseLanguage.
+func WithLanguage(ctx context.Context, code string) context.Context {
+	if code == "" || code == "en" {
+		return ctx
+	}
+	return context.WithValue(ctx, languageKey{}, code)
+}
+
+// LanguageFromContext returns the language attached by WithLanguage, or ""
+// for English.
+func LanguageFromContext(ctx context.Context) string {
+	code, _ := ctx.Value(languageKey{}).(string)
+	return code
+}
+
+// languageInstructions tells the model to answer in the language attached
+// to ctx. Field names and enumerated values stay in English, since they
+// are decoded and validated.
+func languageInstructions(ctx context.Context) string {
+	code := LanguageFromContext(ctx)
+	if code == "" {
+		return ""
+	}
+	return fmt.Sprintf("Write every free-text value of your response (insights, descriptions, explanations, recommendations, answers and other prose) in %s. Keep the JSON field names and structure, enumerated values such as severity, confidence and verdict, and paths, identifiers and numbers exactly as they are, in English.\n\n", languages[code])
+}
@@ -0,0 +1,373 @@
+package analytics
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"os"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// DefaultTenant is used for limits lookups when a request names no tenant,
+// and as the fallback entry for tenants without their own limits.
+const DefaultTenant = "default"
+
+// Limits caps the resources a single analysis may use, and the model calls
+// a tenant may make per UTC day and month across requests. Zero means
+// unlimited.
+type Limits struct {
+	MaxEntries          int `json:"max_entries,omitempty"`
+	MaxLLMCalls         int `json:"max_llm_calls,omitempty"`
+	MaxDurationSec      int `json:"max_duration_seconds,omitempty"`
+	MaxLLMCallsPerDay   int `json:"max_llm_calls_per_day,omitempty"`
+	MaxLLMCallsPerMonth int `json:"max_llm_calls_per_month,omitempty"`
+}
+
+// LimitError is returned when an analysis exceeds one of its Limits.
+type LimitError struct {
+	Limit  string `json:"limit"`
+	Max    int    `json:"max"`
+	Actual int    `json:"actual"`
+}
+
+func (e *LimitError) Error() string {
+	return fmt.Sprintf("%s limit exceeded: %d (max %d)", e.Limit, e.Actual, e.Max)
+}
+
+type budget struct {
+	limits   Limits
+	llmCalls int32
+
+	mu         sync.Mutex
+	redactions map[string]int        // see recordRedactions
+	models     map[string]ModelUsage // see recordModelUsage
+	warnings   []string              // see recordWarning
+}
+
+type budgetKey struct{}
+
+// WithLimits attaches limits to ctx so the analysis pipeline can enforce
+// them. When MaxDurationSec is set the returned context carries a deadline.
+func WithLimits(ctx context.Context, limits Limits) (context.Context, context.CancelFunc) {
+	ctx = context.WithValue(ctx, budgetKey{}, &budget{limits: limits})
+	if limits.MaxDurationSec > 0 {
+		return context.WithTimeout(ctx, time.Duration(limits.MaxDurationSec)*time.Second)
+	}
+	return context.WithCancel(ctx)
+}
+
+// LimitsFromContext returns the limits attached by WithLimits, if any.
+func LimitsFromContext(ctx context.Context) Limits {
+	if b, ok := ctx.Value(budgetKey{}).(*budget); ok {
+		return b.limits
+	}
+	return Limits{}
+}
+
+// CheckEntryLimit fails if n log entries exceed the MaxEntries limit in ctx.
+func CheckEntryLimit(ctx context.Context, n int) error {
+	b, ok := ctx.Value(budgetKey{}).(*budget)
+	if !ok || b.limits.MaxEntries <= 0 || n <= b.limits.MaxEntries {
+		return nil
+	}
+	return &LimitError{Limit: "max_entries", Max: b.limits.MaxEntries, Actual: n}
+}
+
+// consumeLLMCall counts one model call against the MaxLLMCalls limit in ctx,
+// and then against the tenant's quota if ctx carries one.
+func consumeLLMCall(ctx context.Context) error {
+	b, ok := ctx.Value(budgetKey{}).(*budget)
+	if !ok {
+		return nil
+	}
+	if b.limits.MaxLLMCalls > 0 {
+		calls := int(atomic.AddInt32(&b.llmCalls, 1))
+		if calls > b.limits.MaxLLMCalls {
+			return &LimitError{Limit: "max_llm_calls", Max: b.limits.MaxLLMCalls, Actual: calls}
+		}
+	}
+	if q, ok := ctx.Value(quotaKey{}).(quota); ok {
+		return q.meter.consume(q.tenant, b.limits, time.Now())
+	}
+	return nil
+}
+
+type quotaKey struct{}
+
+type quota struct {
+	meter  *QuotaMeter
+	tenant string
+}
+
+// WithQuota makes model calls made with ctx count against tenant's
+// MaxLLMCallsPerDay and MaxLLMCallsPerMonth limits, as attached by
+// WithLimits, in meter.
+func WithQuota(ctx context.Context, meter *QuotaMeter, tenant string) context.Context {
+	return context.WithValue(ctx, quotaKey{}, quota{meter: meter, tenant: tenant})
+}
+
+// QuotaUsage is the number of model calls a tenant has made in the current
+// UTC day and month.
+type QuotaUsage struct {
+	Day   int `json:"llm_calls_today"`
+	Month int `json:"llm_calls_this_month"`
+}
+
+// QuotaStore shares model call counts between instances and keeps them
+// across restarts. Each instance saves its own counts, as JSON, under its
+// instance ID; Load returns the counts of every instance by ID.
+type QuotaStore interface {
+	Save(instance string, data []byte) error
+	Load() (map[string][]byte, error)
+}
+
+// quotaRefresh is how long the counts of other instances are used before
+// they are loaded again.
+const quotaRefresh = 30 * time.Second
+
+// QuotaMeter counts the model calls of each tenant per UTC day and month.
+// Without a store, counts are kept in memory, per instance, and start over
+// on restart. With one, the calls of every instance sharing the store are
+// counted; those of other instances are seen up to quotaRefresh late.
+type QuotaMeter struct {
+	mu    sync.Mutex
+	usage map[string]*tenantUsage
+
+	store    QuotaStore
+	instance string
+	others   map[string]map[string]*tenantUsage // instance → tenant → counts
+	loaded   time.Time
+}
+
+type tenantUsage struct {
+	day, month string // periods the counts are for
+	QuotaUsage
+}
+
+// savedUsage is the stored form of tenantUsage.
+type savedUsage struct {
+	Day   string `json:"day"`
+	Month string `json:"month"`
+	QuotaUsage
+}
+
+// NewQuotaMeter returns a meter counting in store. A nil store yields a
+// meter that only counts the calls of this instance, in memory.
+func NewQuotaMeter(store QuotaStore) (*QuotaMeter, error) {
+	m := &QuotaMeter{usage: make(map[string]*tenantUsage), store: store}
+	if store == nil {
+		return m, nil
+	}
+	id := make([]byte, 8)
+	if _, err := rand.Read(id); err != nil {
+		return nil, err
+	}
+	m.instance = hex.EncodeToString(id)
+	if err := m.load(time.Now()); err != nil {
+		return nil, fmt.Errorf("error loading quota usage: %v", err)
+	}
+	return m, nil
+}
+
+// load reads the counts of the other instances. The caller holds m.mu, or
+// is the constructor.
+func (m *QuotaMeter) load(now time.Time) error {
+	stored, err := m.store.Load()
+	if err != nil {
+		return err
+	}
+	others := make(map[string]map[string]*tenantUsage, len(stored))
+	for instance, data := range stored {
+		if instance == m.instance {
+			continue
+		}
+		var saved map[string]savedUsage
+		if err := json.Unmarshal(data, &saved); err != nil {
+			return fmt.Errorf("quota usage of instance %s: %v", instance, err)
+		}
+		usage := make(map[string]*tenantUsage, len(saved))
+		for tenant, u := range saved {
+			usage[tenant] = &tenantUsage{day: u.Day, month: u.Month, QuotaUsage: u.QuotaUsage}
+		}
+		others[instance] = usage
+	}
+	m.others, m.loaded = others, now
+	return nil
+}
+
+// save writes the counts of this instance. The caller holds m.mu.
+func (m *QuotaMeter) save() error {
+	saved := make(map[string]savedUsage, len(m.usage))
+	for tenant, u := range m.usage {
+		saved[tenant] = savedUsage{Day: u.day, Month: u.month, QuotaUsage: u.QuotaUsage}
+	}
+	data, err := json.Marshal(saved)
+	if err != nil {
+		return err
+	}
+	return m.store.Save(m.instance, data)
+}
+
+// current returns tenant's counts, starting them over when the day or
+// month has turned. The caller holds m.mu.
+func (m *QuotaMeter) current(tenant string, now time.Time) *tenantUsage {
+	now = now.UTC()
+	day, month := now.Format("2006-01-02"), now.Format("2006-01")
+	u, ok := m.usage[tenant]
+	if !ok {
+		u = &tenantUsage{}
+		m.usage[tenant] = u
+	}
+	if u.month != month {
+		u.month, u.Month = month, 0
+	}
+	if u.day != day {
+		u.day, u.Day = day, 0
+	}
+	return u
+}
+
+// total returns tenant's counts across all instances, loading those of
+// other instances again once they are older than quotaRefresh. The caller
+// holds m.mu.
+func (m *QuotaMeter) total(tenant string, now time.Time) (QuotaUsage, error) {
+	u := m.current(tenant, now)
+	total := u.QuotaUsage
+	if m.store == nil {
+		return total, nil
+	}
+	if now.Sub(m.loaded) > quotaRefresh {
+		if err := m.load(now); err != nil {
+			return total, err
+		}
+	}
+	for _, usage := range m.others {
+		o, ok := usage[tenant]
+		if !ok || o.month != u.month {
+			continue
+		}
+		total.Month += o.Month
+		if o.day == u.day {
+			total.Day += o.Day
+		}
+	}
+	return total, nil
+}
+
+// consume counts one model call of tenant, unless it would exceed one of
+// the quotas in limits. With a store, calls are refused while it can't be
+// read or written, so that they aren't made uncounted.
+func (m *QuotaMeter) consume(tenant string, limits Limits, now time.Time) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	total, err := m.total(tenant, now)
+	if err != nil {
+		return fmt.Errorf("error loading quota usage: %v", err)
+	}
+	if limits.MaxLLMCallsPerDay > 0 && total.Day >= limits.MaxLLMCallsPerDay {
+		return &LimitError{Limit: "max_llm_calls_per_day", Max: limits.MaxLLMCallsPerDay, Actual: total.Day + 1}
+	}
+	if limits.MaxLLMCallsPerMonth > 0 && total.Month >= limits.MaxLLMCallsPerMonth {
+		return &LimitError{Limit: "max_llm_calls_per_month", Max: limits.MaxLLMCallsPerMonth, Actual: total.Month + 1}
+	}
+	u := m.current(tenant, now)
+	u.Day++
+	u.Month++
+	if m.store != nil {
+		if err := m.save(); err != nil {
+			u.Day--
+			u.Month--
+			return fmt.Errorf("error saving quota usage: %v", err)
+		}
+	}
+	return nil
+}
+
+// Usage returns tenant's model calls in the current day and month, across
+// all instances sharing the store.
+func (m *QuotaMeter) Usage(tenant string) QuotaUsage {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	total, _ := m.total(tenant, time.Now())
+	return total
+}
+
+// LimitRegistry holds per-tenant limits, optionally backed by a JSON file
+// mapping tenant IDs to Limits.
+type LimitRegistry struct {
+	mu     sync.RWMutex
+	path   string
+	limits map[string]Limits
+}
+
+// NewLimitRegistry loads limits from path. An empty path or a missing file
+// yields an empty registry; updates are written back when path is set.
+func NewLimitRegistry(path string) (*LimitRegistry, error) {
+	r := &LimitRegistry{path: path, limits: make(map[string]Limits)}
+	if path == "" {
+		return r, nil
+	}
+
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return r, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("error reading limits file: %v", err)
+	}
+	if err := json.Unmarshal(data, &r.limits); err != nil {
+		return nil, fmt.Errorf("error parsing limits file: %v", err)
+	}
+	return r, nil
+}
+
+// Get returns the tenant's limits, falling back to the DefaultTenant entry.
+func (r *LimitRegistry) Get(tenant string) Limits {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	if limits, ok := r.limits[tenant]; ok {
+		return limits
+	}
+	return r.limits[DefaultTenant]
+}
+
+// Set replaces the tenant's limits and persists the registry.
+func (r *LimitRegistry) Set(tenant string, limits Limits) error {
+	if limits.MaxEntries < 0 || limits.MaxLLMCalls < 0 || limits.MaxDurationSec < 0 || limits.MaxLLMCallsPerDay < 0 || limits.MaxLLMCallsPerMonth < 0 {
+		return fmt.Errorf("limits must not be negative")
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.limits[tenant] = limits
+	return r.save()
+}
+
+// All returns a copy of every configured tenant's limits.
+func (r *LimitRegistry) All() map[string]Limits {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	all := make(map[string]Limits, len(r.limits))
+	for tenant, limits := range r.limits {
+		all[tenant] = limits
+	}
+	return all
+}
+
+func (r *LimitRegistry) save() error {
+	if r.path == "" {
+		return nil
+	}
+	data, err := json.MarshalIndent(r.limits, "", "  ")
+	if err != nil {
+		return fmt.Errorf("error marshaling limits: %v", err)
+	}
+	if err := os.WriteFile(r.path, data, 0644); err != nil {
+		return fmt.Errorf("error writing limits file: %v", err)
+	}
+	return nil
+}
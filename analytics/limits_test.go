@@ -0,0 +1,77 @@
+package analytics
+
+import (
+	"errors"
+	"sync"
+	"testing"
+	"time"
+)
+
+type memQuotaStore struct {
+	mu   sync.Mutex
+	data map[string][]byte
+}
+
+func (s *memQuotaStore) Save(instance string, data []byte) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.data[instance] = data
+	return nil
+}
+
+func (s *memQuotaStore) Load() (map[string][]byte, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	out := make(map[string][]byte, len(s.data))
+	for k, v := range s.data {
+		out[k] = v
+	}
+	return out, nil
+}
+
+func TestQuotaMeterSharedStore(t *testing.T) {
+	store := &memQuotaStore{data: make(map[string][]byte)}
+	limits := Limits{MaxLLMCallsPerDay: 3}
+	now := time.Date(2026, 10, 16, 12, 0, 0, 0, time.UTC)
+
+	a, err := NewQuotaMeter(store)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 2; i++ {
+		if err := a.consume("team-a", limits, now); err != nil {
+			t.Fatalf("call %d on a: %v", i, err)
+		}
+	}
+
+	// A restarted or second instance sees the calls already made.
+	b, err := NewQuotaMeter(store)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := b.consume("team-a", limits, now); err != nil {
+		t.Fatalf("third call on b: %v", err)
+	}
+	var limitErr *LimitError
+	if err := b.consume("team-a", limits, now); !errors.As(err, &limitErr) || limitErr.Limit != "max_llm_calls_per_day" {
+		t.Fatalf("fourth call on b = %v, want max_llm_calls_per_day", err)
+	}
+	if err := b.consume("team-b", limits, now); err != nil {
+		t.Fatalf("other tenant: %v", err)
+	}
+
+	// a sees b's call once it reloads.
+	later := now.Add(quotaRefresh + time.Second)
+	if err := a.consume("team-a", limits, later); !errors.As(err, &limitErr) {
+		t.Fatalf("call on a after refresh = %v, want a limit error", err)
+	}
+	if got, _ := a.total("team-a", later); got.Day != 3 || got.Month != 3 {
+		t.Errorf("total = %+v, want 3 calls today and this month", got)
+	}
+
+	// The next day starts over, but the month doesn't.
+	tomorrow := now.Add(24 * time.Hour)
+	if got, _ := a.total("team-a", tomorrow); got.Day != 0 || got.Month != 3 {
+		t.Errorf("total tomorrow = %+v, want 0 today and 3 this month", got)
+	}
+}
@@ -0,0 +1,185 @@
+package llm
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+)
+
+// DefaultGeminiBaseURL is the Gemini API the Gemini client calls by default.
+const DefaultGeminiBaseURL = "https://generativelanguage.googleapis.com/v1beta"
+
+// Gemini is a Client and Embedder for Google's Gemini API.
+type Gemini struct {
+	APIKey     string
+	BaseURL    string // defaults to DefaultGeminiBaseURL
+	HTTPClient *http.Client
+}
+
+// NewGemini returns a Gemini client calling with apiKey. Its HTTP client is
+// shared by every call, so connections are reused across requests.
+func NewGemini(apiKey string) *Gemini {
+	return &Gemini{APIKey: apiKey, BaseURL: DefaultGeminiBaseURL, HTTPClient: newHTTPClient()}
+}
+
+// apiKey returns the API key to call with for ctx.
+func (g *Gemini) apiKey(ctx context.Context) string {
+	if key, ok := ctx.Value(geminiKeyKey{}).(string); ok && key != "" {
+		return key
+	}
+	return g.APIKey
+}
+
+// post sends body to the method of model and returns the response body.
+func (g *Gemini) post(ctx context.Context, model, method string, body interface{}) ([]byte, error) {
+	jsonData, err := json.Marshal(body)
+	if err != nil {
+		return nil, fmt.Errorf("error marshaling request: %v", err)
+	}
+	baseURL := g.BaseURL
+	if baseURL == "" {
+		baseURL = DefaultGeminiBaseURL
+	}
+	if !strings.HasPrefix(model, "models/") {
+		model = "models/" + model
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, strings.TrimSuffix(baseURL, "/")+"/"+model+":"+method, bytes.NewReader(jsonData))
+	if err != nil {
+		return nil, fmt.Errorf("error creating request: %v", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("x-goog-api-key", g.apiKey(ctx))
+
+	client := g.HTTPClient
+	if client == nil {
+		client = http.DefaultClient
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("error making request: %w", err)
+	}
+	defer resp.Body.Close()
+
+	respBody, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("error reading response body: %v", err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("API error (status %d): %s", resp.StatusCode, string(respBody))
+	}
+	return respBody, nil
+}
+
+// Generate calls generateContent.
+func (g *Gemini) Generate(ctx context.Context, r Request) (Response, error) {
+	reqBody := map[string]interface{}{
+		"contents": []map[string]interface{}{
+			{
+				"parts": []map[string]string{
+					{"text": r.Prompt},
+				},
+			},
+		},
+		"generationConfig": map[string]interface{}{
+			"temperature":     0.3,
+			"topP":            0.8,
+			"topK":            40,
+			"maxOutputTokens": 1024,
+		},
+	}
+	if r.Schema != nil {
+		config := reqBody["generationConfig"].(map[string]interface{})
+		config["responseMimeType"] = "application/json"
+		config["responseSchema"] = r.Schema
+		// Evidence lists make structured responses longer.
+		config["maxOutputTokens"] = 4096
+	}
+
+	body, err := g.post(ctx, r.Model, "generateContent", reqBody)
+	if err != nil {
+		return Response{}, err
+	}
+
+	var result map[string]interface{}
+	if err := json.Unmarshal(body, &result); err != nil {
+		return Response{}, fmt.Errorf("error parsing response: %v", err)
+	}
+
+	candidates, ok := result["candidates"].([]interface{})
+	if !ok || len(candidates) == 0 {
+		return Response{}, fmt.Errorf("no candidates in response: %s", string(body))
+	}
+
+	content, ok := candidates[0].(map[string]interface{})["content"].(map[string]interface{})
+	if !ok {
+		return Response{}, fmt.Errorf("invalid response format: %s", string(body))
+	}
+
+	parts, ok := content["parts"].([]interface{})
+	if !ok || len(parts) == 0 {
+		return Response{}, fmt.Errorf("no parts in response: %s", string(body))
+	}
+
+	text, ok := parts[0].(map[string]interface{})["text"].(string)
+	if !ok {
+		return Response{}, fmt.Errorf("invalid text format in response: %s", string(body))
+	}
+
+	usage, _ := result["usageMetadata"].(map[string]interface{})
+	inputTokens, _ := usage["promptTokenCount"].(float64)
+	outputTokens, _ := usage["candidatesTokenCount"].(float64)
+	return Response{Text: text, InputTokens: int(inputTokens), OutputTokens: int(outputTokens)}, nil
+}
+
+// Embed calls batchEmbedContents. Callers keep batches within the API's
+// limit of 100 texts.
+func (g *Gemini) Embed(ctx context.Context, r EmbedRequest) ([][]float32, error) {
+	type part struct {
+		Text string `json:"text"`
+	}
+	type request struct {
+		Model   string `json:"model"`
+		Content struct {
+			Parts []part `json:"parts"`
+		} `json:"content"`
+		TaskType string `json:"taskType"`
+	}
+
+	model := r.Model
+	if !strings.HasPrefix(model, "models/") {
+		model = "models/" + model
+	}
+	var reqBody struct {
+		Requests []request `json:"requests"`
+	}
+	for _, text := range r.Texts {
+		req := request{Model: model, TaskType: r.TaskType}
+		req.Content.Parts = []part{{text}}
+		reqBody.Requests = append(reqBody.Requests, req)
+	}
+
+	body, err := g.post(ctx, model, "batchEmbedContents", reqBody)
+	if err != nil {
+		return nil, err
+	}
+	var result struct {
+		Embeddings []struct {
+			Values []float32 `json:"values"`
+		} `json:"embeddings"`
+	}
+	if err := json.Unmarshal(body, &result); err != nil {
+		return nil, fmt.Errorf("error parsing response: %v", err)
+	}
+	if len(result.Embeddings) != len(r.Texts) {
+		return nil, fmt.Errorf("expected %d embeddings, got %d", len(r.Texts), len(result.Embeddings))
+	}
+	vectors := make([][]float32, len(result.Embeddings))
+	for i, e := range result.Embeddings {
+		vectors[i] = e.Values
+	}
+	return vectors, nil
+}
@@ -0,0 +1,59 @@
+// Package llm is the model client layer of the analytics library. Client
+// and Embedder are what the analysis layer calls; Gemini and OpenAI
+// implement them over the providers' HTTP APIs, and tests or other services
+// can substitute their own.
+package llm
+
+import (
+	"context"
+	"net/http"
+	"time"
+)
+
+// Request is one text generation request.
+type Request struct {
+	Model  string
+	Prompt string
+	// Schema, if set, asks for a JSON response following this OpenAPI-style
+	// schema object. Providers without schema support fall back to JSON
+	// mode, so the prompt should describe the structure too.
+	Schema map[string]interface{}
+}
+
+// Response is the generated text and the tokens the provider reported.
+type Response struct {
+	Text         string
+	InputTokens  int
+	OutputTokens int
+}
+
+// Client generates text with a provider's models.
+type Client interface {
+	Generate(ctx context.Context, req Request) (Response, error)
+}
+
+// EmbedRequest asks for the embeddings of Texts. TaskType is
+// RETRIEVAL_DOCUMENT for indexed texts and RETRIEVAL_QUERY for queries.
+type EmbedRequest struct {
+	Model    string
+	Texts    []string
+	TaskType string
+}
+
+// Embedder returns one embedding per text, in order.
+type Embedder interface {
+	Embed(ctx context.Context, req EmbedRequest) ([][]float32, error)
+}
+
+type geminiKeyKey struct{}
+
+// WithGeminiKey makes Gemini calls made with ctx use key instead of the
+// client's API key.
+func WithGeminiKey(ctx context.Context, key string) context.Context {
+	return context.WithValue(ctx, geminiKeyKey{}, key)
+}
+
+// newHTTPClient returns the HTTP client used when a client has none.
+func newHTTPClient() *http.Client {
+	return &http.Client{Timeout: 15 * time.Second}
+}
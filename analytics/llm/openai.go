@@ -0,0 +1,99 @@
+package llm
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+)
+
+// DefaultOpenAIBaseURL is the API the OpenAI client calls by default.
+const DefaultOpenAIBaseURL = "https://api.openai.com/v1"
+
+// OpenAI is a Client for OpenAI or any OpenAI-compatible chat completions
+// API.
+type OpenAI struct {
+	APIKey     string
+	BaseURL    string // defaults to DefaultOpenAIBaseURL
+	HTTPClient *http.Client
+}
+
+// NewOpenAI returns an OpenAI client calling baseURL with apiKey. An empty
+// base URL selects OpenAI's API.
+func NewOpenAI(apiKey, baseURL string) *OpenAI {
+	if baseURL == "" {
+		baseURL = DefaultOpenAIBaseURL
+	}
+	return &OpenAI{APIKey: apiKey, BaseURL: strings.TrimSuffix(baseURL, "/"), HTTPClient: newHTTPClient()}
+}
+
+// Generate calls chat completions. Schemas aren't passed on, since
+// providers disagree on their dialect; the prompt describes the JSON
+// structure and JSON mode keeps the response parseable.
+func (o *OpenAI) Generate(ctx context.Context, r Request) (Response, error) {
+	reqBody := map[string]interface{}{
+		"model":       r.Model,
+		"messages":    []map[string]string{{"role": "user", "content": r.Prompt}},
+		"temperature": 0.3,
+		"max_tokens":  1024,
+	}
+	if r.Schema != nil {
+		reqBody["response_format"] = map[string]string{"type": "json_object"}
+		reqBody["max_tokens"] = 4096
+	}
+
+	jsonData, err := json.Marshal(reqBody)
+	if err != nil {
+		return Response{}, fmt.Errorf("error marshaling request: %v", err)
+	}
+	baseURL := o.BaseURL
+	if baseURL == "" {
+		baseURL = DefaultOpenAIBaseURL
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, strings.TrimSuffix(baseURL, "/")+"/chat/completions", bytes.NewBuffer(jsonData))
+	if err != nil {
+		return Response{}, fmt.Errorf("error creating request: %v", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Authorization", "Bearer "+o.APIKey)
+
+	client := o.HTTPClient
+	if client == nil {
+		client = http.DefaultClient
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return Response{}, fmt.Errorf("error making request: %w", err)
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return Response{}, fmt.Errorf("error reading response body: %v", err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		return Response{}, fmt.Errorf("API error (status %d): %s", resp.StatusCode, string(body))
+	}
+
+	var result struct {
+		Choices []struct {
+			Message struct {
+				Content string `json:"content"`
+			} `json:"message"`
+		} `json:"choices"`
+		Usage struct {
+			PromptTokens     int `json:"prompt_tokens"`
+			CompletionTokens int `json:"completion_tokens"`
+		} `json:"usage"`
+	}
+	if err := json.Unmarshal(body, &result); err != nil {
+		return Response{}, fmt.Errorf("error parsing response: %v", err)
+	}
+	if len(result.Choices) == 0 {
+		return Response{}, fmt.Errorf("no choices in response: %s", string(body))
+	}
+	return Response{Text: result.Choices[0].Message.Content, InputTokens: result.Usage.PromptTokens, OutputTokens: result.Usage.CompletionTokens}, nil
+}
@@ -0,0 +1,54 @@
+package analytics
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Model providers.
+const (
+	ProviderGemini = "gemini"
+	ProviderOpenAI = "openai" // OpenAI or any OpenAI-compatible chat completions API
+)
+
+const defaultGeminiModel = "gemini-2.0-flash"
+
+// Model names a model of a provider.
+type Model struct {
+	Provider string `json:"provider"`
+	Name     string `json:"name"`
+}
+
+func (m Model) String() string {
+	return m.Provider + ":" + m.Name
+}
+
+// ParseModels parses a comma-separated list of models written as
+// provider:name, e.g. "gemini:gemini-1.5-pro,openai:gpt-4o-mini". A name
+// without a provider is a Gemini model.
+func ParseModels(raw string) ([]Model, error) {
+	var models []Model
+	for _, part := range strings.Split(raw, ",") {
+		part = strings.TrimSpace(part)
+		if part == "" {
+			continue
+		}
+		m := Model{Provider: ProviderGemini, Name: part}
+		if provider, name, ok := strings.Cut(part, ":"); ok {
+			m = Model{Provider: strings.ToLower(provider), Name: name}
+		}
+		if m.Provider != ProviderGemini && m.Provider != ProviderOpenAI {
+			return nil, fmt.Errorf("unknown model provider %q in %q", m.Provider, part)
+		}
+		if m.Name == "" {
+			return nil, fmt.Errorf("missing model name in %q", part)
+		}
+		for _, existing := range models {
+			if existing == m {
+				return nil, fmt.Errorf("model %s is listed twice", m)
+			}
+		}
+		models = append(models, m)
+	}
+	return models, nil
+}
@@ -0,0 +1,137 @@
+package analytics
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+
+	"analyticsai/ai-service/analytics/parser"
+)
+
+// ndjsonFlushEvery is how many written entries pass between flushes of the
+// output, so clients receive a large export progressively.
+const ndjsonFlushEvery = 500
+
+// marshalFields encodes the fields of log as a JSON object with its keys in
+// the order given.
+func marshalFields(log LogEntry, fields []string) ([]byte, error) {
+	var buf bytes.Buffer
+	buf.WriteByte('{')
+	for i, field := range fields {
+		if i > 0 {
+			buf.WriteByte(',')
+		}
+		key, _ := json.Marshal(field)
+		value, err := json.Marshal(parser.Field(log, field))
+		if err != nil {
+			return nil, err
+		}
+		buf.Write(key)
+		buf.WriteByte(':')
+		buf.Write(value)
+	}
+	buf.WriteByte('}')
+	return buf.Bytes(), nil
+}
+
+// entryDecoder reads log entries one at a time from either a JSON array or
+// newline-delimited JSON.
+type entryDecoder struct {
+	dec     *json.Decoder
+	inArray bool
+}
+
+func newEntryDecoder(r io.Reader) (*entryDecoder, error) {
+	br := bufio.NewReader(r)
+	var first byte
+	for {
+		b, err := br.ReadByte()
+		if err == io.EOF {
+			return &entryDecoder{dec: json.NewDecoder(br)}, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		if b != ' ' && b != '\t' && b != '\r' && b != '\n' {
+			first = b
+			br.UnreadByte()
+			break
+		}
+	}
+	d := &entryDecoder{dec: json.NewDecoder(br)}
+	if first == '[' {
+		if _, err := d.dec.Token(); err != nil {
+			return nil, err
+		}
+		d.inArray = true
+	}
+	return d, nil
+}
+
+// next decodes the next entry, returning false at the end of the input.
+func (d *entryDecoder) next(log *LogEntry) (bool, error) {
+	if !d.dec.More() {
+		if d.inArray {
+			if _, err := d.dec.Token(); err != nil {
+				return false, err
+			}
+		}
+		return false, nil
+	}
+	*log = LogEntry{}
+	if err := d.dec.Decode(log); err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+// StreamNDJSON copies the log entries read from r, a JSON array or NDJSON,
+// to w as newline-delimited JSON, one entry at a time. Only entries matching
+// every filter are written, limited to fields when given. It returns the
+// number of entries written; w is flushed periodically if it has a Flush
+// method.
+func (s *AnalyticsService) StreamNDJSON(r io.Reader, w io.Writer, filters []Filter, fields []string) (int, error) {
+	dec, err := newEntryDecoder(r)
+	if err != nil {
+		return 0, fmt.Errorf("%w: invalid JSON: %v", ErrInvalidInput, err)
+	}
+	flusher, _ := w.(interface{ Flush() })
+
+	written := 0
+	var log LogEntry
+	for {
+		ok, err := dec.next(&log)
+		if err != nil {
+			return written, fmt.Errorf("%w: invalid log entry after %d written: %v", ErrInvalidInput, written, err)
+		}
+		if !ok {
+			break
+		}
+		if !matchesAll(log, filters) {
+			continue
+		}
+
+		var line []byte
+		if len(fields) == 0 {
+			line, err = json.Marshal(log)
+		} else {
+			line, err = marshalFields(log, fields)
+		}
+		if err != nil {
+			return written, fmt.Errorf("error encoding log entry: %v", err)
+		}
+		if _, err := w.Write(append(line, '\n')); err != nil {
+			return written, err
+		}
+		written++
+		if flusher != nil && written%ndjsonFlushEvery == 0 {
+			flusher.Flush()
+		}
+	}
+	if flusher != nil {
+		flusher.Flush()
+	}
+	return written, nil
+}
@@ -0,0 +1,234 @@
+package parser
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"path"
+	"regexp"
+	"strings"
+	"time"
+)
+
+// ContainerLabels identify the Kubernetes container a log stream came from.
+// They are added to the Metadata of every entry as namespace, pod and
+// container, unless a line names its own.
+type ContainerLabels struct {
+	Namespace string
+	Pod       string
+	Container string
+}
+
+var (
+	// criLine is a containerd/CRI-O log line: time, stream, partial (P) or
+	// full (F) tag, and the logged text.
+	criLine = regexp.MustCompile(`^(\S+) (stdout|stderr) ([FP])(?: (.*))?$`)
+	// kubectlPrefix is the source prefix kubectl logs --prefix adds, e.g.
+	// "[pod/web-5d9f/nginx] ".
+	kubectlPrefix = regexp.MustCompile(`^\[(pod/[^\]/]+/[^\]]+)\] ?(.*)$`)
+	// messageLevel finds a level keyword near the start of a text line.
+	messageLevel = regexp.MustCompile(`(?i)^\W{0,3}(?:\S+\s+){0,3}?\W?(?:level=|lvl=)?"?(fatal|panic|error|err|warn|warning|info|debug|trace)\b`)
+
+	// podsLogFile and containersLogFile match the kubelet's log file paths
+	// under /var/log/pods and /var/log/containers; the latter is recognized
+	// by its file name alone.
+	podsLogFile       = regexp.MustCompile(`/pods/([^/_]+)_([^/_]+)_[^/]+/([^/]+)/[^/]+$`)
+	containersLogFile = regexp.MustCompile(`/([^/_]+)_([^/_]+)_(.+)-[0-9a-f]{64}\.log$`)
+)
+
+// dockerAttrLabels maps the Kubernetes labels Docker's json-file driver
+// records in "attrs" to ContainerLabels fields.
+var dockerAttrLabels = map[string]string{
+	"io.kubernetes.pod.namespace":  "namespace",
+	"io.kubernetes.pod.name":       "pod",
+	"io.kubernetes.container.name": "container",
+}
+
+// LabelsFromLogFile derives the labels of a container from the path of its
+// log file on a node, e.g. /var/log/pods/<namespace>_<pod>_<uid>/<container>/0.log
+// or /var/log/containers/<pod>_<namespace>_<container>-<id>.log. Other paths
+// yield no labels.
+func LabelsFromLogFile(file string) ContainerLabels {
+	file = "/" + path.Clean(strings.ReplaceAll(file, `\`, "/"))
+	if m := podsLogFile.FindStringSubmatch(file); m != nil {
+		return ContainerLabels{Namespace: m[1], Pod: m[2], Container: m[3]}
+	}
+	if m := containersLogFile.FindStringSubmatch(file); m != nil {
+		return ContainerLabels{Pod: m[1], Namespace: m[2], Container: m[3]}
+	}
+	return ContainerLabels{}
+}
+
+// Merge returns l with the non-empty fields of override on top.
+func (l ContainerLabels) Merge(override ContainerLabels) ContainerLabels {
+	if override.Namespace != "" {
+		l.Namespace = override.Namespace
+	}
+	if override.Pod != "" {
+		l.Pod = override.Pod
+	}
+	if override.Container != "" {
+		l.Container = override.Container
+	}
+	return l
+}
+
+// containerRecord is one logged line, reassembled from partial lines.
+type containerRecord struct {
+	timestamp string
+	stream    string
+	text      string
+	labels    map[string]string
+}
+
+type dockerLine struct {
+	Log    *string           `json:"log"`
+	Stream string            `json:"stream"`
+	Time   string            `json:"time"`
+	Attrs  map[string]string `json:"attrs"`
+}
+
+// ParseContainerLogs parses container logs as written by Kubernetes nodes
+// or exported with kubectl logs: containerd/CRI lines, Docker json-file
+// lines, and plain lines with the prefix and timestamp kubectl logs
+// --prefix --timestamps adds. Formats may be mixed. Lines split by the
+// runtime are joined again.
+//
+// Text that is a JSON object is decoded like a record of DecodeLogs, with
+// mapping m; other text becomes the message, with its level taken from a
+// keyword near its start. The stream and the labels go into Metadata.
+func ParseContainerLogs(data []byte, labels ContainerLabels, m FieldMapping) ([]LogEntry, error) {
+	var records []containerRecord
+	partial := make(map[string]*containerRecord) // by stream
+	appendText := func(r containerRecord, complete bool) {
+		if p, ok := partial[r.stream]; ok {
+			p.text += r.text
+			r.text, r.timestamp = p.text, p.timestamp
+			delete(partial, r.stream)
+		}
+		if !complete {
+			partial[r.stream] = &r
+			return
+		}
+		records = append(records, r)
+	}
+
+	for _, line := range bytes.Split(data, []byte("\n")) {
+		line = bytes.TrimSuffix(line, []byte("\r"))
+		if len(bytes.TrimSpace(line)) == 0 {
+			continue
+		}
+		text := string(line)
+
+		var docker dockerLine
+		if line[0] == '{' && json.Unmarshal(line, &docker) == nil {
+			if docker.Log != nil {
+				r := containerRecord{timestamp: docker.Time, stream: docker.Stream, text: strings.TrimSuffix(*docker.Log, "\n")}
+				for attr, label := range dockerAttrLabels {
+					if v := docker.Attrs[attr]; v != "" {
+						if r.labels == nil {
+							r.labels = make(map[string]string)
+						}
+						r.labels[label] = v
+					}
+				}
+				// Docker splits long lines at 16KB; only the last part ends
+				// with a newline.
+				appendText(r, strings.HasSuffix(*docker.Log, "\n"))
+				continue
+			}
+			// A structured application log exported without a runtime
+			// wrapper.
+			records = append(records, containerRecord{text: text})
+			continue
+		}
+
+		if match := criLine.FindStringSubmatch(text); match != nil {
+			if _, ok := ParseTimestamp(match[1]); ok {
+				appendText(containerRecord{timestamp: match[1], stream: match[2], text: match[4]}, match[3] == "F")
+				continue
+			}
+		}
+
+		r := containerRecord{text: text}
+		if match := kubectlPrefix.FindStringSubmatch(r.text); match != nil {
+			parts := strings.SplitN(match[1], "/", 3)
+			r.labels = map[string]string{"pod": parts[1], "container": parts[2]}
+			r.text = match[2]
+		}
+		if ts, rest, ok := strings.Cut(r.text, " "); ok && strings.Contains(ts, "T") {
+			if _, err := time.Parse(time.RFC3339Nano, ts); err == nil {
+				r.timestamp, r.text = ts, rest
+			}
+		}
+		records = append(records, r)
+	}
+	// A stream that ends mid-line still logged what it has.
+	for _, stream := range []string{"stdout", "stderr", ""} {
+		if p, ok := partial[stream]; ok {
+			records = append(records, *p)
+		}
+	}
+
+	logs := make([]LogEntry, 0, len(records))
+	for i, r := range records {
+		entry, err := r.entry(m)
+		if err != nil {
+			return nil, fmt.Errorf("%w: record %d: %v", ErrInvalidInput, i+1, err)
+		}
+		// Labels a line carries itself are more specific than the stream's.
+		for label, value := range map[string]string{"namespace": labels.Namespace, "pod": labels.Pod, "container": labels.Container} {
+			if _, ok := r.labels[label]; !ok && value != "" {
+				entry.Metadata[label] = value
+			}
+		}
+		logs = append(logs, entry)
+	}
+	return logs, nil
+}
+
+func (r containerRecord) entry(m FieldMapping) (LogEntry, error) {
+	var entry LogEntry
+	text := strings.TrimSpace(r.text)
+	var record map[string]interface{}
+	decoder := json.NewDecoder(strings.NewReader(text))
+	decoder.UseNumber()
+	if strings.HasPrefix(text, "{") && decoder.Decode(&record) == nil {
+		var err error
+		if entry, err = m.decode(record); err != nil {
+			return entry, err
+		}
+	} else {
+		entry = LogEntry{Message: r.text, Metadata: make(map[string]string)}
+		if match := messageLevel.FindStringSubmatch(text); match != nil {
+			entry.Level = normalizeLevel(match[1])
+		}
+	}
+	if entry.Timestamp == "" {
+		entry.Timestamp = r.timestamp
+	}
+	if entry.Level == "" {
+		entry.Level = "info"
+	}
+	if r.stream != "" {
+		entry.Metadata["stream"] = r.stream
+	}
+	for label, value := range r.labels {
+		entry.Metadata[label] = value
+	}
+	return entry, nil
+}
+
+// normalizeLevel maps the level keywords of text logs to the levels used in
+// log entries.
+func normalizeLevel(keyword string) string {
+	switch strings.ToLower(keyword) {
+	case "fatal", "panic":
+		return "fatal"
+	case "error", "err":
+		return "error"
+	case "warn", "warning":
+		return "warn"
+	}
+	return strings.ToLower(keyword)
+}
@@ -0,0 +1,160 @@
+package parser
+
+import (
+	"bytes"
+	"encoding/csv"
+	"fmt"
+	"io"
+	"math"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+// csvFields are the columns of a CSV export without a header row, in
+// order.
+var csvFields = []string{"timestamp", "level", "message", "path", "method", "duration", "status"}
+
+// ParseDelimiter parses a CSV delimiter: a single character, or "tab".
+func ParseDelimiter(raw string) (rune, error) {
+	switch raw {
+	case "":
+		return ',', nil
+	case "tab", `\t`:
+		return '\t', nil
+	}
+	r := []rune(raw)
+	if len(r) != 1 || r[0] == '"' || r[0] == '\r' || r[0] == '\n' || r[0] == utf8.RuneError {
+		return 0, fmt.Errorf("%w: invalid delimiter %q", ErrInvalidInput, raw)
+	}
+	return r[0], nil
+}
+
+// sniffDelimiter picks the most frequent of the common delimiters on the
+// first line of data, defaulting to a comma.
+func sniffDelimiter(data []byte) rune {
+	line, _, _ := bytes.Cut(data, []byte("\n"))
+	best, bestCount := ',', 0
+	for _, d := range []rune{',', ';', '\t', '|'} {
+		if n := bytes.Count(line, []byte(string(d))); n > bestCount {
+			best, bestCount = d, n
+		}
+	}
+	return best
+}
+
+// csvColumn maps a header cell to an entry field, or to "metadata.<name>"
+// for columns that aren't one.
+func csvColumn(cell string) (string, bool) {
+	name := strings.ToLower(strings.TrimSpace(cell))
+	for _, f := range csvFields {
+		if name == f {
+			return f, true
+		}
+	}
+	if strings.HasPrefix(name, MetadataPrefix) && len(name) > len(MetadataPrefix) {
+		return MetadataPrefix + strings.TrimSpace(cell)[len(MetadataPrefix):], true
+	}
+	return MetadataPrefix + strings.TrimSpace(cell), false
+}
+
+// parseCSVNumber coerces a duration or status cell, accepting spreadsheet
+// renderings such as "200.0" and a trailing "ms". Empty cells are zero.
+func parseCSVNumber(cell string) (int64, error) {
+	cell = strings.TrimSuffix(strings.TrimSpace(cell), "ms")
+	cell = strings.TrimSpace(cell)
+	if cell == "" {
+		return 0, nil
+	}
+	if n, err := strconv.ParseInt(cell, 10, 64); err == nil {
+		return n, nil
+	}
+	f, err := strconv.ParseFloat(cell, 64)
+	if err != nil || math.IsNaN(f) || math.IsInf(f, 0) {
+		return 0, fmt.Errorf("%q is not a number", cell)
+	}
+	return int64(math.Round(f)), nil
+}
+
+// ParseCSV parses a CSV in the format written by export.CSV back into log
+// entries. A first row naming any entry field is taken as the header, and
+// its other columns become metadata keys; without one the columns are read
+// in the order timestamp, level, message, path, method, duration, status.
+// A zero delimiter is detected from the first line.
+func ParseCSV(data []byte, delimiter rune) ([]LogEntry, error) {
+	data = bytes.TrimPrefix(data, []byte("\xef\xbb\xbf")) // spreadsheet byte order mark
+	if delimiter == 0 {
+		delimiter = sniffDelimiter(data)
+	}
+	reader := csv.NewReader(bytes.NewReader(data))
+	reader.Comma = delimiter
+	reader.FieldsPerRecord = -1
+
+	var columns []string
+	logs := []LogEntry{}
+	for {
+		record, err := reader.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("%w: %v", ErrInvalidInput, err)
+		}
+		line, _ := reader.FieldPos(0)
+
+		if columns == nil {
+			header := make([]string, len(record))
+			isHeader := false
+			for i, cell := range record {
+				var known bool
+				header[i], known = csvColumn(cell)
+				isHeader = isHeader || known
+			}
+			if isHeader {
+				columns = header
+				continue
+			}
+			columns = csvFields
+		}
+		if len(record) > len(columns) {
+			return nil, fmt.Errorf("%w: line %d has %d columns, expected at most %d", ErrInvalidInput, line, len(record), len(columns))
+		}
+
+		var log LogEntry
+		for i, cell := range record {
+			switch column := columns[i]; column {
+			case "timestamp":
+				log.Timestamp = cell
+			case "level":
+				log.Level = cell
+			case "message":
+				log.Message = cell
+			case "path":
+				log.Path = cell
+			case "method":
+				log.Method = cell
+			case "duration", "status":
+				n, err := parseCSVNumber(cell)
+				if err != nil {
+					return nil, fmt.Errorf("%w: line %d, %s: %v", ErrInvalidInput, line, column, err)
+				}
+				if column == "duration" {
+					log.Duration = n
+				} else {
+					log.Status = int(n)
+				}
+			default:
+				key := strings.TrimPrefix(column, MetadataPrefix)
+				if key == "" || cell == "" {
+					continue
+				}
+				if log.Metadata == nil {
+					log.Metadata = make(map[string]string)
+				}
+				log.Metadata[key] = cell
+			}
+		}
+		logs = append(logs, log)
+	}
+	return logs, nil
+}
@@ -0,0 +1,27 @@
+// Package parser decodes log entries from the formats the service accepts
+// (JSON with optional field mappings, Kubernetes container logs and CSV)
+// and parses and normalizes their timestamps. It is the first layer of the
+// analytics library and depends on nothing else in it.
+package parser
+
+import "errors"
+
+// ErrInvalidInput wraps errors caused by the caller's data or options rather
+// than by the service, so handlers can report them as bad requests.
+var ErrInvalidInput = errors.New("invalid input")
+
+// LogEntry is one log entry, as analyzed by every layer of the library.
+type LogEntry struct {
+	Timestamp string            `json:"timestamp"`
+	Level     string            `json:"level"`
+	Message   string            `json:"message"`
+	Path      string            `json:"path"`
+	Method    string            `json:"method"`
+	Duration  int64             `json:"duration"`
+	Status    int               `json:"status"`
+	Metadata  map[string]string `json:"metadata"`
+}
+
+// MetadataPrefix addresses a metadata key as a field: in field mappings, CSV
+// headers and group-by dimensions, "metadata.<key>" is LogEntry.Metadata[key].
+const MetadataPrefix = "metadata."
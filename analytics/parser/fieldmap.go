@@ -0,0 +1,315 @@
+package parser
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"math"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// logEntryFields are the LogEntry JSON names a FieldMapping may target, in
+// addition to "metadata.<key>".
+var logEntryFields = []string{"timestamp", "level", "message", "path", "method", "duration", "status"}
+
+func isLogEntryField(field string) bool {
+	for _, f := range logEntryFields {
+		if f == field {
+			return true
+		}
+	}
+	return false
+}
+
+// FieldMapping maps LogEntry fields ("timestamp", "path", "metadata.service",
+// ...) to the keys holding them in the source records. Source keys may be
+// dot-separated to reach into nested objects, e.g. "http.route". Fields
+// without a mapping are read from their usual key.
+type FieldMapping map[string]string
+
+// ParseFieldMapping parses a comma-separated list of field=source pairs
+// such as "timestamp=ts,level=sev,duration=latency_ms".
+func ParseFieldMapping(raw string) (FieldMapping, error) {
+	m := make(FieldMapping)
+	for _, pair := range strings.Split(raw, ",") {
+		field, source, ok := strings.Cut(pair, "=")
+		if !ok {
+			return nil, fmt.Errorf("%w: field mapping %q must have the form field=source", ErrInvalidInput, pair)
+		}
+		m[strings.TrimSpace(field)] = strings.TrimSpace(source)
+	}
+	return m, m.Validate()
+}
+
+// Validate checks that every target is a LogEntry field and every source
+// key is non-empty.
+func (m FieldMapping) Validate() error {
+	for field, source := range m {
+		if source == "" {
+			return fmt.Errorf("%w: empty source key for field %q", ErrInvalidInput, field)
+		}
+		if strings.HasPrefix(field, MetadataPrefix) && len(field) > len(MetadataPrefix) {
+			continue
+		}
+		if !isLogEntryField(field) {
+			return fmt.Errorf("%w: unknown log field %q in field mapping", ErrInvalidInput, field)
+		}
+	}
+	return nil
+}
+
+// Merge returns m with the entries of override added on top.
+func (m FieldMapping) Merge(override FieldMapping) FieldMapping {
+	merged := make(FieldMapping, len(m)+len(override))
+	for field, source := range m {
+		merged[field] = source
+	}
+	for field, source := range override {
+		merged[field] = source
+	}
+	return merged
+}
+
+// DecodeLogs parses a JSON array of log records. Without a mapping the
+// records must use LogEntry's own field names. With one, each field is read
+// from its mapped key, the "metadata" object is kept, and any other
+// top-level scalar values are added to Metadata.
+func DecodeLogs(data []byte, m FieldMapping) ([]LogEntry, error) {
+	if len(m) == 0 {
+		var logs []LogEntry
+		if err := json.Unmarshal(data, &logs); err != nil {
+			return nil, err
+		}
+		return logs, nil
+	}
+
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.UseNumber()
+	var records []map[string]interface{}
+	if err := decoder.Decode(&records); err != nil {
+		return nil, err
+	}
+
+	logs := make([]LogEntry, len(records))
+	for i, record := range records {
+		entry, err := m.decode(record)
+		if err != nil {
+			return nil, fmt.Errorf("%w: record %d: %v", ErrInvalidInput, i, err)
+		}
+		logs[i] = entry
+	}
+	return logs, nil
+}
+
+func (m FieldMapping) decode(record map[string]interface{}) (LogEntry, error) {
+	var entry LogEntry
+	used := map[string]bool{"metadata": true}
+	source := func(field string) (interface{}, bool) {
+		key := field
+		if mapped, ok := m[field]; ok {
+			key = mapped
+		}
+		used[strings.SplitN(key, ".", 2)[0]] = true
+		return lookupPath(record, key)
+	}
+
+	for _, field := range logEntryFields {
+		raw, ok := source(field)
+		if !ok || raw == nil {
+			continue
+		}
+		switch field {
+		case "duration", "status":
+			n, err := toInt64(raw)
+			if err != nil {
+				return entry, fmt.Errorf("%s: %v", field, err)
+			}
+			if field == "duration" {
+				entry.Duration = n
+			} else {
+				entry.Status = int(n)
+			}
+		default:
+			s, ok := toString(raw)
+			if !ok {
+				return entry, fmt.Errorf("%s: expected a string, got %T", field, raw)
+			}
+			switch field {
+			case "timestamp":
+				entry.Timestamp = s
+			case "level":
+				entry.Level = s
+			case "message":
+				entry.Message = s
+			case "path":
+				entry.Path = s
+			case "method":
+				entry.Method = s
+			}
+		}
+	}
+
+	entry.Metadata = make(map[string]string)
+	if nested, ok := record["metadata"].(map[string]interface{}); ok {
+		for key, value := range nested {
+			if s, ok := toString(value); ok {
+				entry.Metadata[key] = s
+			}
+		}
+	}
+	for field := range m {
+		if !strings.HasPrefix(field, MetadataPrefix) {
+			continue
+		}
+		if raw, ok := source(field); ok {
+			if s, ok := toString(raw); ok {
+				entry.Metadata[strings.TrimPrefix(field, MetadataPrefix)] = s
+			}
+		}
+	}
+	for key, value := range record {
+		if used[key] {
+			continue
+		}
+		if _, exists := entry.Metadata[key]; exists {
+			continue
+		}
+		if s, ok := toString(value); ok {
+			entry.Metadata[key] = s
+		}
+	}
+	return entry, nil
+}
+
+// lookupPath resolves a dot-separated key in a decoded JSON object. A key
+// present verbatim (dots included) takes precedence over nesting.
+func lookupPath(record map[string]interface{}, key string) (interface{}, bool) {
+	if v, ok := record[key]; ok {
+		return v, true
+	}
+	head, rest, nested := strings.Cut(key, ".")
+	if !nested {
+		return nil, false
+	}
+	child, ok := record[head].(map[string]interface{})
+	if !ok {
+		return nil, false
+	}
+	return lookupPath(child, rest)
+}
+
+// toString formats scalar JSON values; objects and arrays are rejected.
+func toString(v interface{}) (string, bool) {
+	switch v := v.(type) {
+	case string:
+		return v, true
+	case json.Number:
+		return v.String(), true
+	case bool:
+		return strconv.FormatBool(v), true
+	}
+	return "", false
+}
+
+// toInt64 accepts JSON numbers and numeric strings, rounding fractions.
+func toInt64(v interface{}) (int64, error) {
+	var raw string
+	switch v := v.(type) {
+	case json.Number:
+		raw = v.String()
+	case string:
+		raw = strings.TrimSpace(v)
+	default:
+		return 0, fmt.Errorf("expected a number, got %T", v)
+	}
+	if n, err := strconv.ParseInt(raw, 10, 64); err == nil {
+		return n, nil
+	}
+	f, err := strconv.ParseFloat(raw, 64)
+	if err != nil {
+		return 0, fmt.Errorf("%q is not a number", raw)
+	}
+	return int64(math.Round(f)), nil
+}
+
+// MappingRegistry holds named field mapping profiles, optionally backed by
+// a JSON file mapping profile names to FieldMappings.
+type MappingRegistry struct {
+	mu       sync.RWMutex
+	path     string
+	mappings map[string]FieldMapping
+}
+
+// NewMappingRegistry loads profiles from path. An empty path or a missing
+// file yields an empty registry; updates are written back when path is set.
+func NewMappingRegistry(path string) (*MappingRegistry, error) {
+	r := &MappingRegistry{path: path, mappings: make(map[string]FieldMapping)}
+	if path == "" {
+		return r, nil
+	}
+
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return r, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("error reading field mappings file: %v", err)
+	}
+	if err := json.Unmarshal(data, &r.mappings); err != nil {
+		return nil, fmt.Errorf("error parsing field mappings file: %v", err)
+	}
+	for name, m := range r.mappings {
+		if err := m.Validate(); err != nil {
+			return nil, fmt.Errorf("field mapping %q: %v", name, err)
+		}
+	}
+	return r, nil
+}
+
+// Get returns the named profile.
+func (r *MappingRegistry) Get(name string) (FieldMapping, bool) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	m, ok := r.mappings[name]
+	return m, ok
+}
+
+// Set validates and stores a profile and persists the registry.
+func (r *MappingRegistry) Set(name string, m FieldMapping) error {
+	if err := m.Validate(); err != nil {
+		return err
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.mappings[name] = m
+	return r.save()
+}
+
+// All returns a copy of every stored profile.
+func (r *MappingRegistry) All() map[string]FieldMapping {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	all := make(map[string]FieldMapping, len(r.mappings))
+	for name, m := range r.mappings {
+		all[name] = m
+	}
+	return all
+}
+
+func (r *MappingRegistry) save() error {
+	if r.path == "" {
+		return nil
+	}
+	data, err := json.MarshalIndent(r.mappings, "", "  ")
+	if err != nil {
+		return fmt.Errorf("error marshaling field mappings: %v", err)
+	}
+	if err := os.WriteFile(r.path, data, 0644); err != nil {
+		return fmt.Errorf("error writing field mappings file: %v", err)
+	}
+	return nil
+}
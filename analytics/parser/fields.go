@@ -0,0 +1,64 @@
+package parser
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Entry fields accepted by ParseFields besides "metadata.<key>".
+var entryFields = []string{"timestamp", "level", "message", "path", "method", "duration", "status", "metadata"}
+
+// ParseFields parses a comma-separated list of entry fields to export, such
+// as "timestamp,path,status,metadata.region". An empty string selects every
+// field.
+func ParseFields(raw string) ([]string, error) {
+	if strings.TrimSpace(raw) == "" {
+		return nil, nil
+	}
+	var fields []string
+	for _, field := range strings.Split(raw, ",") {
+		field = strings.TrimSpace(field)
+		known := strings.HasPrefix(field, MetadataPrefix) && len(field) > len(MetadataPrefix)
+		for _, f := range entryFields {
+			known = known || field == f
+		}
+		if !known {
+			return nil, fmt.Errorf("%w: unknown field %q", ErrInvalidInput, field)
+		}
+		fields = append(fields, field)
+	}
+	return fields, nil
+}
+
+// Field returns the value of field, as accepted by ParseFields, for
+// log. Missing metadata keys are nil.
+func Field(log LogEntry, field string) interface{} {
+	switch field {
+	case "timestamp":
+		return log.Timestamp
+	case "level":
+		return log.Level
+	case "message":
+		return log.Message
+	case "path":
+		return log.Path
+	case "method":
+		return log.Method
+	case "duration":
+		return log.Duration
+	case "status":
+		return log.Status
+	case "metadata":
+		return log.Metadata
+	}
+	if v, ok := log.Metadata[strings.TrimPrefix(field, MetadataPrefix)]; ok {
+		return v
+	}
+	return nil
+}
+
+// DefaultFields returns every entry field accepted by ParseFields, in the
+// order exports write them.
+func DefaultFields() []string {
+	return append([]string(nil), entryFields...)
+}
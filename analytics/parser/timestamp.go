@@ -0,0 +1,282 @@
+package parser
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Names of the timestamp layouts recognized besides Go reference layouts.
+const (
+	LayoutAuto    = "auto"
+	LayoutRFC3339 = "rfc3339"
+	LayoutEpochS  = "epoch_s"
+	LayoutEpochMS = "epoch_ms"
+	LayoutEpochUS = "epoch_us"
+	LayoutEpochNS = "epoch_ns"
+	LayoutSyslog  = "syslog" // "Jan  2 15:04:05", year inferred
+	LayoutCLF     = "clf"    // Apache/nginx "02/Jan/2006:15:04:05 -0700"
+)
+
+// InvalidTimestampPolicy decides what happens to entries whose timestamp
+// doesn't match the layout.
+type InvalidTimestampPolicy string
+
+const (
+	InvalidKeep   InvalidTimestampPolicy = "keep"   // analyze them, but leave them out of time-based statistics
+	InvalidDrop   InvalidTimestampPolicy = "drop"   // remove them before analysis
+	InvalidReject InvalidTimestampPolicy = "reject" // fail the request
+)
+
+// timestampParser parses ts, interpreting timestamps without a zone or
+// offset in loc.
+type timestampParser func(ts string, loc *time.Location) (time.Time, error)
+
+type timestampLayout struct {
+	name  string
+	parse timestampParser
+}
+
+func goLayout(layout string) timestampParser {
+	return func(ts string, loc *time.Location) (time.Time, error) { return time.ParseInLocation(layout, ts, loc) }
+}
+
+// knownLayouts are tried in order when detecting a layout.
+var knownLayouts = []timestampLayout{
+	{LayoutRFC3339, goLayout(time.RFC3339Nano)},
+	{"2006-01-02T15:04:05.999999999", goLayout("2006-01-02T15:04:05.999999999")},
+	{"2006-01-02 15:04:05.999999999Z07:00", goLayout("2006-01-02 15:04:05.999999999Z07:00")},
+	{"2006-01-02 15:04:05.999999999 -0700", goLayout("2006-01-02 15:04:05.999999999 -0700")},
+	{"2006-01-02 15:04:05.999999999", goLayout("2006-01-02 15:04:05.999999999")},
+	{"2006-01-02 15:04:05,999", goLayout("2006-01-02 15:04:05,999")},
+	{LayoutCLF, goLayout("02/Jan/2006:15:04:05 -0700")},
+	{LayoutSyslog, parseSyslog},
+	{"rfc1123z", goLayout(time.RFC1123Z)},
+	{"rfc1123", goLayout(time.RFC1123)},
+	{"unixdate", goLayout(time.UnixDate)},
+	{"ansic", goLayout(time.ANSIC)},
+	{LayoutEpochS, epochParser(time.Second)},
+	{LayoutEpochMS, epochParser(time.Millisecond)},
+	{LayoutEpochUS, epochParser(time.Microsecond)},
+	{LayoutEpochNS, epochParser(time.Nanosecond)},
+}
+
+// maxEpochSeconds is the last second of year 9999, the latest epoch
+// timestamp accepted.
+const maxEpochSeconds = 253402300799
+
+// epochParser parses decimal epoch values in the given unit. Fractions are
+// allowed. Values before 1970 or after year 9999 are rejected rather than
+// wrapped around.
+func epochParser(unit time.Duration) timestampParser {
+	perSecond := int64(time.Second / unit)
+	return func(ts string, _ *time.Location) (time.Time, error) {
+		if n, err := strconv.ParseInt(ts, 10, 64); err == nil {
+			if n < 0 || n/perSecond > maxEpochSeconds {
+				return time.Time{}, fmt.Errorf("epoch timestamp %q is out of range", ts)
+			}
+			switch unit {
+			case time.Second:
+				return time.Unix(n, 0).UTC(), nil
+			case time.Millisecond:
+				return time.UnixMilli(n).UTC(), nil
+			case time.Microsecond:
+				return time.UnixMicro(n).UTC(), nil
+			}
+			return time.Unix(0, n).UTC(), nil
+		}
+		f, err := strconv.ParseFloat(ts, 64)
+		if err != nil || strings.ContainsAny(ts, "eE") {
+			return time.Time{}, fmt.Errorf("%q is not an epoch timestamp", ts)
+		}
+		secs := f / float64(perSecond)
+		if !(secs >= 0 && secs <= maxEpochSeconds) {
+			return time.Time{}, fmt.Errorf("epoch timestamp %q is out of range", ts)
+		}
+		whole := math.Floor(secs)
+		return time.Unix(int64(whole), int64(math.Round((secs-whole)*1e9))).UTC(), nil
+	}
+}
+
+// parseSyslog parses BSD syslog timestamps, which have no year: the most
+// recent year that doesn't put the timestamp in the future is assumed.
+func parseSyslog(ts string, loc *time.Location) (time.Time, error) {
+	t, err := time.ParseInLocation(time.StampMicro, ts, loc)
+	if err != nil {
+		if t, err = time.ParseInLocation(time.Stamp, ts, loc); err != nil {
+			return t, err
+		}
+	}
+	now := time.Now().In(loc)
+	t = t.AddDate(now.Year(), 0, 0)
+	if t.After(now.Add(24 * time.Hour)) {
+		t = t.AddDate(-1, 0, 0)
+	}
+	return t, nil
+}
+
+// epochLayoutFor picks the epoch unit from the integer digit count of ts,
+// so that auto-detection doesn't read milliseconds as seconds.
+func epochLayoutFor(ts string) string {
+	digits := ts
+	if i := strings.IndexByte(ts, '.'); i >= 0 {
+		digits = ts[:i]
+	}
+	switch {
+	case len(digits) <= 10:
+		return LayoutEpochS
+	case len(digits) <= 13:
+		return LayoutEpochMS
+	case len(digits) <= 16:
+		return LayoutEpochUS
+	default:
+		return LayoutEpochNS
+	}
+}
+
+func isNumeric(ts string) bool {
+	_, err := strconv.ParseFloat(ts, 64)
+	return err == nil && !strings.ContainsAny(ts, "eE")
+}
+
+// lookupLayout returns the parser for a layout name or Go reference layout.
+func lookupLayout(layout string) (timestampLayout, error) {
+	for _, l := range knownLayouts {
+		if l.name == layout {
+			return l, nil
+		}
+	}
+	// Anything else must be a Go reference layout; formatting the reference
+	// time with it and parsing the result back checks that it is one.
+	ref := time.Date(2006, 1, 2, 15, 4, 5, 0, time.UTC)
+	if _, err := time.Parse(layout, ref.Format(layout)); err != nil || !strings.ContainsAny(layout, "0123456789") {
+		return timestampLayout{}, fmt.Errorf("%w: unknown timestamp layout %q", ErrInvalidInput, layout)
+	}
+	return timestampLayout{layout, goLayout(layout)}, nil
+}
+
+// ParseTimestamp parses a log entry timestamp in any known layout. Entries
+// whose timestamp can't be parsed are left out of time-based statistics.
+func ParseTimestamp(ts string) (time.Time, bool) {
+	return parseAnyLayout(ts, time.UTC)
+}
+
+func parseAnyLayout(ts string, loc *time.Location) (time.Time, bool) {
+	ts = strings.TrimSpace(ts)
+	if ts == "" {
+		return time.Time{}, false
+	}
+	if isNumeric(ts) {
+		l, _ := lookupLayout(epochLayoutFor(ts))
+		t, err := l.parse(ts, loc)
+		return t, err == nil
+	}
+	for _, l := range knownLayouts {
+		if t, err := l.parse(ts, loc); err == nil {
+			return t, true
+		}
+	}
+	return time.Time{}, false
+}
+
+// maxLayoutSamples bounds how many entries DetectTimestampLayout inspects.
+const maxLayoutSamples = 200
+
+// DetectTimestampLayout returns the name of the layout that parses the most
+// of the first entries' timestamps, or "" if none parses any.
+func DetectTimestampLayout(logs []LogEntry) string {
+	counts := make(map[string]int)
+	for i, log := range logs {
+		if i == maxLayoutSamples {
+			break
+		}
+		ts := strings.TrimSpace(log.Timestamp)
+		if ts == "" {
+			continue
+		}
+		if isNumeric(ts) {
+			counts[epochLayoutFor(ts)]++
+			continue
+		}
+		for _, l := range knownLayouts {
+			if _, err := l.parse(ts, time.UTC); err == nil {
+				counts[l.name]++
+				break
+			}
+		}
+	}
+
+	best := ""
+	for _, l := range knownLayouts {
+		if counts[l.name] > counts[best] {
+			best = l.name
+		}
+	}
+	return best
+}
+
+// TimestampReport describes how timestamps were normalized.
+type TimestampReport struct {
+	Layout   string `json:"layout"`
+	Detected bool   `json:"detected"`
+	Invalid  int    `json:"invalid"` // entries that didn't match Layout
+	Dropped  int    `json:"dropped"`
+}
+
+// NormalizeTimestamps parses every timestamp with layout and rewrites it as RFC 3339 in loc, which also
+// applies to timestamps without an offset; nil means UTC. When layout is
+// empty or LayoutAuto the most common layout is reported and every entry may
+// use any known layout. Entries that don't parse are handled according to
+// policy. The input slice may be modified.
+func NormalizeTimestamps(logs []LogEntry, layout string, loc *time.Location, policy InvalidTimestampPolicy) ([]LogEntry, TimestampReport, error) {
+	var report TimestampReport
+	if loc == nil {
+		loc = time.UTC
+	}
+	switch policy {
+	case "", InvalidKeep, InvalidDrop, InvalidReject:
+	default:
+		return nil, report, fmt.Errorf("%w: unknown invalid timestamp policy %q", ErrInvalidInput, policy)
+	}
+
+	var parse timestampParser
+	if layout == "" || layout == LayoutAuto {
+		layout = DetectTimestampLayout(logs)
+		report.Detected = true
+		parse = func(ts string, loc *time.Location) (time.Time, error) {
+			if t, ok := parseAnyLayout(ts, loc); ok {
+				return t, nil
+			}
+			return time.Time{}, fmt.Errorf("unknown timestamp layout")
+		}
+	} else {
+		parser, err := lookupLayout(layout)
+		if err != nil {
+			return nil, report, err
+		}
+		parse = parser.parse
+	}
+	report.Layout = layout
+
+	kept := logs[:0]
+	for i, log := range logs {
+		t, err := parse(strings.TrimSpace(log.Timestamp), loc)
+		if err != nil {
+			report.Invalid++
+			switch policy {
+			case InvalidReject:
+				return nil, report, fmt.Errorf("%w: entry %d: unparseable timestamp %q (layout %q)", ErrInvalidInput, i, log.Timestamp, layout)
+			case InvalidDrop:
+				report.Dropped++
+				continue
+			}
+			kept = append(kept, log)
+			continue
+		}
+		log.Timestamp = t.In(loc).Format(time.RFC3339Nano)
+		kept = append(kept, log)
+	}
+	return kept, report, nil
+}
@@ -0,0 +1,39 @@
+package parser
+
+import (
+	"testing"
+	"time"
+)
+
+func TestEpochParser(t *testing.T) {
+	tests := []struct {
+		unit time.Duration
+		ts   string
+		want time.Time
+		ok   bool
+	}{
+		{time.Second, "1712397600", time.Date(2024, 4, 6, 10, 0, 0, 0, time.UTC), true},
+		{time.Second, "1712397600.25", time.Date(2024, 4, 6, 10, 0, 0, 250000000, time.UTC), true},
+		{time.Millisecond, "1712397600123", time.Date(2024, 4, 6, 10, 0, 0, 123000000, time.UTC), true},
+		{time.Microsecond, "1712397600123456", time.Date(2024, 4, 6, 10, 0, 0, 123456000, time.UTC), true},
+		{time.Nanosecond, "1712397600123456789", time.Date(2024, 4, 6, 10, 0, 0, 123456789, time.UTC), true},
+		// Seconds this large used to overflow time.Duration and wrap around.
+		{time.Second, "253402300799", time.Date(9999, 12, 31, 23, 59, 59, 0, time.UTC), true},
+		{time.Second, "253402300800", time.Time{}, false},
+		{time.Millisecond, "99999999999999999", time.Time{}, false},
+		{time.Second, "-1", time.Time{}, false},
+		{time.Second, "1e9", time.Time{}, false},
+		{time.Second, "NaN", time.Time{}, false},
+		{time.Second, "Inf", time.Time{}, false},
+	}
+	for _, tt := range tests {
+		got, err := epochParser(tt.unit)(tt.ts, time.UTC)
+		if (err == nil) != tt.ok {
+			t.Errorf("epochParser(%v)(%q) error = %v, want ok %v", tt.unit, tt.ts, err, tt.ok)
+			continue
+		}
+		if tt.ok && !got.Equal(tt.want) {
+			t.Errorf("epochParser(%v)(%q) = %v, want %v", tt.unit, tt.ts, got, tt.want)
+		}
+	}
+}
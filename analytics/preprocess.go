@@ -0,0 +1,115 @@
+package analytics
+
+import (
+	"fmt"
+	"net/url"
+	"strings"
+	"time"
+
+	"analyticsai/ai-service/analytics/aggregator"
+	"analyticsai/ai-service/analytics/parser"
+)
+
+// QueryMode controls how query strings take part in path aggregation.
+type QueryMode string
+
+const (
+	QueryKeep   QueryMode = "keep"   // leave query strings untouched
+	QueryStrip  QueryMode = "strip"  // drop query strings entirely
+	QuerySelect QueryMode = "select" // keep only the listed parameters
+)
+
+// PreprocessOptions are the transformations applied to log entries before
+// any statistics are computed.
+type PreprocessOptions struct {
+	NormalizePaths bool      // collapse numeric, UUID and hash path segments
+	PathPatterns   []string  // route templates, see NewPathNormalizer
+	QueryMode      QueryMode // defaults to QueryKeep
+	QueryParams    []string  // parameters retained by QuerySelect
+	Filters        []Filter  // entries must match all filters to be analyzed
+
+	NormalizeTimestamps bool                          // rewrite timestamps as RFC 3339 UTC
+	TimestampLayout     string                        // see parser.NormalizeTimestamps, detected when empty
+	InvalidTimestamps   parser.InvalidTimestampPolicy // defaults to parser.InvalidKeep
+	Location            *time.Location                // zone timestamps are reported in, defaults to UTC
+
+	Dedup       aggregator.DedupMode // defaults to DedupOff
+	DedupWindow time.Duration        // fuzzy dedup window, defaults to DefaultDedupWindow
+}
+
+// PreprocessReport describes what Preprocess did to the entries.
+type PreprocessReport struct {
+	Timestamps        *parser.TimestampReport `json:"timestamps,omitempty"`
+	DuplicatesRemoved int                     `json:"duplicates_removed"`
+}
+
+// Preprocess applies opts to logs and returns the entries to analyze. The
+// input slice may be modified.
+func Preprocess(logs []LogEntry, opts PreprocessOptions) ([]LogEntry, PreprocessReport, error) {
+	var report PreprocessReport
+	var err error
+	if len(opts.Filters) > 0 {
+		logs = applyFilters(logs, opts.Filters)
+	}
+
+	if opts.NormalizeTimestamps {
+		var timestamps parser.TimestampReport
+		logs, timestamps, err = parser.NormalizeTimestamps(logs, opts.TimestampLayout, opts.Location, opts.InvalidTimestamps)
+		if err != nil {
+			return nil, report, err
+		}
+		report.Timestamps = &timestamps
+	}
+
+	if logs, report.DuplicatesRemoved, err = aggregator.Deduplicate(logs, opts.Dedup, opts.DedupWindow); err != nil {
+		return nil, report, err
+	}
+
+	switch opts.QueryMode {
+	case "", QueryKeep:
+	case QueryStrip, QuerySelect:
+		for i := range logs {
+			logs[i].Path = rewriteQuery(logs[i].Path, opts.QueryMode, opts.QueryParams)
+		}
+	default:
+		return nil, report, fmt.Errorf("%w: unknown query mode %q", ErrInvalidInput, opts.QueryMode)
+	}
+
+	if opts.NormalizePaths || len(opts.PathPatterns) > 0 {
+		normalizer, err := aggregator.NewPathNormalizer(opts.PathPatterns, opts.NormalizePaths)
+		if err != nil {
+			return nil, report, err
+		}
+		for i := range logs {
+			logs[i].Path = normalizer.Normalize(logs[i].Path)
+		}
+	}
+	return logs, report, nil
+}
+
+// rewriteQuery strips the query string from path or, in QuerySelect mode,
+// reduces it to params. Retained parameters are sorted by name so that
+// "?page=2&sort=asc" and "?sort=asc&page=2" aggregate together.
+func rewriteQuery(path string, mode QueryMode, params []string) string {
+	route, rawQuery, hasQuery := strings.Cut(path, "?")
+	if !hasQuery || mode == QueryStrip {
+		return route
+	}
+
+	values, err := url.ParseQuery(rawQuery)
+	if err != nil {
+		// Malformed query strings can't be filtered reliably; drop them
+		// rather than let them fragment the route.
+		return route
+	}
+	kept := url.Values{}
+	for _, name := range params {
+		if v, ok := values[name]; ok {
+			kept[name] = v
+		}
+	}
+	if len(kept) == 0 {
+		return route
+	}
+	return route + "?" + kept.Encode()
+}
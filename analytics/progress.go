@@ -0,0 +1,29 @@
+package analytics
+
+import "context"
+
+// Stages an analysis reports through WithProgress.
+const (
+	ProgressStatistics    = "statistics"     // computing the deterministic statistics
+	ProgressModelCall     = "model_call"     // waiting for a model
+	ProgressModelResponse = "model_response" // a model answered
+)
+
+// ProgressFunc receives the stages of the analyses run with a context from
+// WithProgress. Consensus analyses call models concurrently, so it must be
+// safe for concurrent use.
+type ProgressFunc func(stage, detail string)
+
+type progressKey struct{}
+
+// WithProgress makes the analyses run with ctx report their progress to fn.
+func WithProgress(ctx context.Context, fn ProgressFunc) context.Context {
+	return context.WithValue(ctx, progressKey{}, fn)
+}
+
+// reportProgress passes a stage to the ProgressFunc of ctx, if any.
+func reportProgress(ctx context.Context, stage, detail string) {
+	if fn, ok := ctx.Value(progressKey{}).(ProgressFunc); ok {
+		fn(stage, detail)
+	}
+}
@@ -0,0 +1,159 @@
+package analytics
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"analyticsai/ai-service/analytics/aggregator"
+)
+
+// maxWindowPaths bounds the paths exposed per window, keeping the label
+// cardinality of the exposition in check.
+const maxWindowPaths = 100
+
+// windowQuantiles are the latency quantiles exposed per path.
+var windowQuantiles = []float64{0.5, 0.9, 0.95, 0.99}
+
+// PathWindow is the traffic of one path in a window.
+type PathWindow struct {
+	Path        string
+	Requests    int
+	Errors      int
+	DurationSum int64   // ms
+	Quantiles   []int64 // ms, one per windowQuantiles entry
+}
+
+// Window holds the per-path statistics of the most recently analyzed logs.
+type Window struct {
+	Kind       string
+	Source     string
+	AnalyzedAt time.Time
+	Start, End time.Time // zero when no timestamp parses
+	Paths      []PathWindow
+}
+
+// NewWindow computes the window statistics of logs, keeping the busiest
+// paths.
+func NewWindow(logs []LogEntry, kind, source string) *Window {
+	w := &Window{Kind: kind, Source: source, AnalyzedAt: time.Now().UTC()}
+	if start, end, ok := aggregator.TimeRange(logs); ok {
+		w.Start, w.End = start, end
+	}
+
+	byPath := make(map[string]*PathWindow)
+	durations := make(map[string][]int64)
+	for _, log := range logs {
+		p, ok := byPath[log.Path]
+		if !ok {
+			p = &PathWindow{Path: log.Path}
+			byPath[log.Path] = p
+		}
+		p.Requests++
+		if log.Status >= 400 {
+			p.Errors++
+		}
+		p.DurationSum += log.Duration
+		durations[log.Path] = append(durations[log.Path], log.Duration)
+	}
+	for path, p := range byPath {
+		d := durations[path]
+		aggregator.SortDurations(d)
+		for _, q := range windowQuantiles {
+			p.Quantiles = append(p.Quantiles, aggregator.Percentile(d, q*100))
+		}
+		w.Paths = append(w.Paths, *p)
+	}
+	sort.Slice(w.Paths, func(i, j int) bool {
+		if w.Paths[i].Requests != w.Paths[j].Requests {
+			return w.Paths[i].Requests > w.Paths[j].Requests
+		}
+		return w.Paths[i].Path < w.Paths[j].Path
+	})
+	if len(w.Paths) > maxWindowPaths {
+		w.Paths = w.Paths[:maxWindowPaths]
+	}
+	return w
+}
+
+var labelEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+
+// WritePrometheus writes the window in the Prometheus text exposition
+// format. Durations are exposed in seconds.
+func (w *Window) WritePrometheus(out io.Writer) error {
+	b := bufio.NewWriter(out)
+	metric := func(name, typ, help string) {
+		fmt.Fprintf(b, "# HELP %s %s\n# TYPE %s %s\n", name, help, name, typ)
+	}
+	seconds := func(ms int64) float64 { return float64(ms) / 1000 }
+	timestamp := func(t time.Time) float64 { return float64(t.UnixMilli()) / 1000 }
+
+	metric("analyzed_window_info", "gauge", "Source of the most recently analyzed logs.")
+	fmt.Fprintf(b, "analyzed_window_info{kind=\"%s\",source=\"%s\"} 1\n", labelEscaper.Replace(w.Kind), labelEscaper.Replace(w.Source))
+	metric("analyzed_window_analyzed_timestamp_seconds", "gauge", "When the window was analyzed.")
+	fmt.Fprintf(b, "analyzed_window_analyzed_timestamp_seconds %.3f\n", timestamp(w.AnalyzedAt))
+	if !w.Start.IsZero() {
+		metric("analyzed_window_start_timestamp_seconds", "gauge", "Earliest log timestamp in the window.")
+		fmt.Fprintf(b, "analyzed_window_start_timestamp_seconds %.3f\n", timestamp(w.Start))
+		metric("analyzed_window_end_timestamp_seconds", "gauge", "Latest log timestamp in the window.")
+		fmt.Fprintf(b, "analyzed_window_end_timestamp_seconds %.3f\n", timestamp(w.End))
+	}
+
+	metric("analyzed_requests", "gauge", "Requests per path in the window.")
+	for _, p := range w.Paths {
+		fmt.Fprintf(b, "analyzed_requests{path=\"%s\"} %d\n", labelEscaper.Replace(p.Path), p.Requests)
+	}
+	metric("analyzed_errors", "gauge", "Requests per path with a status of 400 or above in the window.")
+	for _, p := range w.Paths {
+		fmt.Fprintf(b, "analyzed_errors{path=\"%s\"} %d\n", labelEscaper.Replace(p.Path), p.Errors)
+	}
+	metric("analyzed_error_ratio", "gauge", "Share of requests per path that failed in the window.")
+	for _, p := range w.Paths {
+		fmt.Fprintf(b, "analyzed_error_ratio{path=\"%s\"} %g\n", labelEscaper.Replace(p.Path), float64(p.Errors)/float64(p.Requests))
+	}
+	metric("analyzed_request_duration_seconds", "summary", "Request duration per path in the window.")
+	for _, p := range w.Paths {
+		path := labelEscaper.Replace(p.Path)
+		for i, q := range windowQuantiles {
+			fmt.Fprintf(b, "analyzed_request_duration_seconds{path=\"%s\",quantile=\"%g\"} %g\n", path, q, seconds(p.Quantiles[i]))
+		}
+		fmt.Fprintf(b, "analyzed_request_duration_seconds_sum{path=\"%s\"} %g\n", path, seconds(p.DurationSum))
+		fmt.Fprintf(b, "analyzed_request_duration_seconds_count{path=\"%s\"} %d\n", path, p.Requests)
+	}
+	return b.Flush()
+}
+
+// WindowRegistry keeps the most recent window of each tenant in memory.
+type WindowRegistry struct {
+	mu      sync.Mutex
+	windows map[string]*Window
+}
+
+func NewWindowRegistry() *WindowRegistry {
+	return &WindowRegistry{windows: make(map[string]*Window)}
+}
+
+// Set records w as the tenant's most recent window.
+func (r *WindowRegistry) Set(tenant string, w *Window) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.windows[tenant] = w
+}
+
+// Get returns the tenant's most recent window, or nil if none was recorded.
+func (r *WindowRegistry) Get(tenant string) *Window {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.windows[tenant]
+}
+
+// DeleteTenant forgets the tenant's window.
+func (r *WindowRegistry) DeleteTenant(tenant string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	delete(r.windows, tenant)
+}
@@ -0,0 +1,51 @@
+package analytics
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"testing"
+	"unicode/utf8"
+)
+
+func TestDecodeModelOutputRepairs(t *testing.T) {
+	ctx, cancel := WithLimits(context.Background(), Limits{})
+	defer cancel()
+
+	issues := make([]string, maxModelItems+5)
+	for i := range issues {
+		issues[i] = fmt.Sprintf(`{"type": "errors", "description": "issue %d", "severity": "high"}`, i)
+	}
+	issues[0] = `{"type": "errors", "description": "odd", "severity": "sev-2"}`
+	response := `{"potential_issues": [` + strings.Join(issues, ",") + `]}`
+
+	var result struct {
+		PotentialIssues []Issue `json:"potential_issues"`
+	}
+	if err := decodeModelOutput(ctx, response, &result); err != nil {
+		t.Fatalf("decodeModelOutput: %v", err)
+	}
+	if len(result.PotentialIssues) != maxModelItems {
+		t.Errorf("got %d issues, want %d", len(result.PotentialIssues), maxModelItems)
+	}
+	if got := result.PotentialIssues[0].Severity; got != "low" {
+		t.Errorf("unknown severity became %q, want low", got)
+	}
+	warnings := WarningsFromContext(ctx)
+	if len(warnings) != 2 {
+		t.Fatalf("got warnings %q, want 2", warnings)
+	}
+	if !strings.Contains(warnings[0], "potential_issues had 105 items") || !strings.Contains(warnings[1], `unknown severity "sev-2"`) {
+		t.Errorf("unexpected warnings %q", warnings)
+	}
+}
+
+func TestUntrustedTruncatesRunes(t *testing.T) {
+	s := untrusted(strings.Repeat("é", maxUntrustedField+10))
+	if !utf8.ValidString(s) {
+		t.Fatalf("untrusted returned invalid UTF-8: %q", s)
+	}
+	if want := strings.Repeat("é", maxUntrustedField) + "…"; s != want {
+		t.Errorf("got %d runes, want %d", utf8.RuneCountInString(s), maxUntrustedField+1)
+	}
+}
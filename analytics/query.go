@@ -0,0 +1,123 @@
+package analytics
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"analyticsai/ai-service/analytics/aggregator"
+	"analyticsai/ai-service/analytics/parser"
+)
+
+// Page sizes for QueryLogs.
+const (
+	DefaultQueryLimit = 100
+	MaxQueryLimit     = 1000
+)
+
+// LogQuery selects log entries. Zero values leave a criterion unset.
+type LogQuery struct {
+	Levels      []string // case-insensitive
+	Methods     []string // case-insensitive
+	PathPrefix  string
+	Route       string // route template such as "/users/:id", see NewPathNormalizer
+	StatusMin   int
+	StatusMax   int
+	MinDuration int64     // ms
+	From        time.Time // inclusive
+	To          time.Time // exclusive
+	Offset      int
+	Limit       int // defaults to DefaultQueryLimit
+}
+
+type LogQueryResult struct {
+	Entries    []LogEntry `json:"entries"`
+	Total      int        `json:"total"` // matches before pagination
+	Offset     int        `json:"offset"`
+	Limit      int        `json:"limit"`
+	NextOffset *int       `json:"next_offset,omitempty"`
+}
+
+// QueryLogs returns the page of logs matching q, in their original order.
+// Entries without a parseable timestamp never match a time range.
+func QueryLogs(logs []LogEntry, q LogQuery) (*LogQueryResult, error) {
+	if q.Limit == 0 {
+		q.Limit = DefaultQueryLimit
+	}
+	if q.Limit < 0 || q.Limit > MaxQueryLimit || q.Offset < 0 {
+		return nil, fmt.Errorf("%w: limit must be 1-%d and offset non-negative", ErrInvalidInput, MaxQueryLimit)
+	}
+	if q.StatusMax > 0 && q.StatusMin > q.StatusMax {
+		return nil, fmt.Errorf("%w: status_min is greater than status_max", ErrInvalidInput)
+	}
+	if !q.From.IsZero() && !q.To.IsZero() && !q.From.Before(q.To) {
+		return nil, fmt.Errorf("%w: from must be before to", ErrInvalidInput)
+	}
+
+	var route *aggregator.PathNormalizer
+	if q.Route != "" {
+		var err error
+		if route, err = aggregator.NewPathNormalizer([]string{q.Route}, false); err != nil {
+			return nil, err
+		}
+		q.Route = "/" + strings.Trim(q.Route, "/")
+	}
+
+	result := &LogQueryResult{Entries: []LogEntry{}, Offset: q.Offset, Limit: q.Limit}
+	for _, log := range logs {
+		if !q.match(log, route) {
+			continue
+		}
+		if result.Total >= q.Offset && len(result.Entries) < q.Limit {
+			result.Entries = append(result.Entries, log)
+		}
+		result.Total++
+	}
+	if next := q.Offset + q.Limit; next < result.Total {
+		result.NextOffset = &next
+	}
+	return result, nil
+}
+
+func (q LogQuery) match(log LogEntry, route *aggregator.PathNormalizer) bool {
+	if len(q.Levels) > 0 && !containsFold(q.Levels, log.Level) {
+		return false
+	}
+	if len(q.Methods) > 0 && !containsFold(q.Methods, log.Method) {
+		return false
+	}
+	if q.PathPrefix != "" && !strings.HasPrefix(log.Path, q.PathPrefix) {
+		return false
+	}
+	if route != nil {
+		normalized, _, _ := strings.Cut(route.Normalize(log.Path), "?")
+		if normalized != q.Route {
+			return false
+		}
+	}
+	if q.StatusMin > 0 && log.Status < q.StatusMin {
+		return false
+	}
+	if q.StatusMax > 0 && log.Status > q.StatusMax {
+		return false
+	}
+	if log.Duration < q.MinDuration {
+		return false
+	}
+	if !q.From.IsZero() || !q.To.IsZero() {
+		t, ok := parser.ParseTimestamp(log.Timestamp)
+		if !ok || (!q.From.IsZero() && t.Before(q.From)) || (!q.To.IsZero() && !t.Before(q.To)) {
+			return false
+		}
+	}
+	return true
+}
+
+func containsFold(values []string, s string) bool {
+	for _, v := range values {
+		if strings.EqualFold(strings.TrimSpace(v), s) {
+			return true
+		}
+	}
+	return false
+}
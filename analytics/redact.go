@@ -0,0 +1,211 @@
+package analytics
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Built-in redaction categories.
+const (
+	RedactEmail      = "email"
+	RedactIP         = "ip"
+	RedactToken      = "token"
+	RedactCreditCard = "credit_card"
+)
+
+// RedactionConfig customizes a Redactor.
+type RedactionConfig struct {
+	Disabled  []string          `json:"disabled,omitempty"`  // built-in categories to skip
+	Patterns  map[string]string `json:"patterns,omitempty"`  // extra categories: name -> regular expression
+	Allowlist []string          `json:"allowlist,omitempty"` // exact values never redacted
+}
+
+// LoadRedactionConfig reads a RedactionConfig from a JSON file. An empty
+// path yields the default configuration.
+func LoadRedactionConfig(path string) (RedactionConfig, error) {
+	var cfg RedactionConfig
+	if path == "" {
+		return cfg, nil
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return cfg, fmt.Errorf("error reading redaction config: %v", err)
+	}
+	if err := json.Unmarshal(data, &cfg); err != nil {
+		return cfg, fmt.Errorf("error parsing redaction config: %v", err)
+	}
+	return cfg, nil
+}
+
+type redactionRule struct {
+	category string
+	pattern  *regexp.Regexp
+	// group, when non-zero, is the submatch to mask; the rest of the match
+	// (e.g. the "password=" prefix) is kept for context.
+	group int
+	// valid, when set, must accept a match for it to be masked.
+	valid func(string) bool
+}
+
+// Built-in rules, applied in order. Tokens come first so that secrets
+// containing digits aren't partially masked as card numbers.
+var builtinRedactionRules = []redactionRule{
+	{category: RedactToken, pattern: regexp.MustCompile(`(?i)\bbearer\s+([A-Za-z0-9\-._~+/]{8,}=*)`), group: 1},
+	{category: RedactToken, pattern: regexp.MustCompile(`\beyJ[A-Za-z0-9_-]+\.[A-Za-z0-9_-]+\.[A-Za-z0-9_-]+`)},
+	{category: RedactToken, pattern: regexp.MustCompile(`(?i)\b(?:api[_-]?key|access[_-]?token|auth[_-]?token|token|secret|password|passwd|pwd|session[_-]?id|sig|signature)=([^&\s"']+)`), group: 1},
+	{category: RedactEmail, pattern: regexp.MustCompile(`[A-Za-z0-9._%+-]+@[A-Za-z0-9.-]+\.[A-Za-z]{2,}`)},
+	{category: RedactCreditCard, pattern: regexp.MustCompile(`\b[3-6]\d(?:[ -]?\d){11,17}\b`), valid: luhnValid},
+	// Dotted quads after a '/' or '.', or within a longer dotted sequence,
+	// are versions such as Chrome/120.0.0.0 rather than addresses.
+	{category: RedactIP, pattern: regexp.MustCompile(`(?:^|[^0-9A-Za-z_./])((?:\d+\.)+\d+)\b`), group: 1, valid: ipv4Valid},
+	{category: RedactIP, pattern: regexp.MustCompile(`(?i)\b(?:[0-9a-f]{1,4}:){7}[0-9a-f]{1,4}\b|\b(?:[0-9a-f]{1,4}:){1,6}:(?:[0-9a-f]{1,4}:?){0,6}[0-9a-f]{1,4}\b`)},
+}
+
+// ipv4Valid reports whether s is exactly four dot-separated numbers of up
+// to three digits, each at most 255.
+func ipv4Valid(s string) bool {
+	parts := strings.Split(s, ".")
+	if len(parts) != 4 {
+		return false
+	}
+	for _, p := range parts {
+		n, err := strconv.Atoi(p)
+		if err != nil || len(p) > 3 || n > 255 {
+			return false
+		}
+	}
+	return true
+}
+
+// luhnValid reports whether the digits in s pass the Luhn checksum used by
+// payment card numbers.
+func luhnValid(s string) bool {
+	sum, double := 0, false
+	for i := len(s) - 1; i >= 0; i-- {
+		c := s[i]
+		if c < '0' || c > '9' {
+			continue
+		}
+		d := int(c - '0')
+		if double {
+			if d *= 2; d > 9 {
+				d -= 9
+			}
+		}
+		sum += d
+		double = !double
+	}
+	return sum%10 == 0
+}
+
+// Redactor masks personal data and secrets in text sent to Gemini.
+type Redactor struct {
+	rules []redactionRule
+	allow map[string]bool
+}
+
+// NewRedactor builds a Redactor from the built-in rules adjusted by cfg.
+func NewRedactor(cfg RedactionConfig) (*Redactor, error) {
+	r := &Redactor{allow: make(map[string]bool, len(cfg.Allowlist))}
+	for _, v := range cfg.Allowlist {
+		r.allow[v] = true
+	}
+	for _, rule := range builtinRedactionRules {
+		if !containsString(cfg.Disabled, rule.category) {
+			r.rules = append(r.rules, rule)
+		}
+	}
+
+	names := make([]string, 0, len(cfg.Patterns))
+	for name := range cfg.Patterns {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		pattern, err := regexp.Compile(cfg.Patterns[name])
+		if err != nil {
+			return nil, fmt.Errorf("invalid redaction pattern %q: %v", name, err)
+		}
+		r.rules = append(r.rules, redactionRule{category: name, pattern: pattern})
+	}
+	return r, nil
+}
+
+// Redact replaces every match with "[REDACTED_<CATEGORY>]" and returns the
+// redacted text with the number of values masked per category.
+func (r *Redactor) Redact(text string) (string, map[string]int) {
+	counts := make(map[string]int)
+	for _, rule := range r.rules {
+		placeholder := "[REDACTED_" + strings.ToUpper(rule.category) + "]"
+		text = rule.pattern.ReplaceAllStringFunc(text, func(match string) string {
+			value := match
+			prefix := ""
+			if rule.group > 0 {
+				sub := rule.pattern.FindStringSubmatchIndex(match)
+				if sub == nil || sub[2*rule.group] < 0 {
+					return match
+				}
+				prefix, value = match[:sub[2*rule.group]], match[sub[2*rule.group]:sub[2*rule.group+1]]
+				if sub[2*rule.group+1] != len(match) {
+					return match
+				}
+			}
+			if r.allow[value] || (rule.valid != nil && !rule.valid(value)) {
+				return match
+			}
+			counts[rule.category]++
+			return prefix + placeholder
+		})
+	}
+	return text, counts
+}
+
+// redact masks sensitive values in log- or user-derived prompt data,
+// adding what it masked to the request's redaction tally in ctx. Only the
+// data is redacted, not the trusted instructions around it.
+func (s *AnalyticsService) redact(ctx context.Context, text string) string {
+	if s.redactor == nil {
+		return text
+	}
+	text, counts := s.redactor.Redact(text)
+	recordRedactions(ctx, counts)
+	return text
+}
+
+// recordRedactions adds counts to the request's redaction tally in ctx.
+func recordRedactions(ctx context.Context, counts map[string]int) {
+	b, ok := ctx.Value(budgetKey{}).(*budget)
+	if !ok || len(counts) == 0 {
+		return
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.redactions == nil {
+		b.redactions = make(map[string]int)
+	}
+	for category, n := range counts {
+		b.redactions[category] += n
+	}
+}
+
+// RedactionsFromContext returns how many values of each category were
+// redacted from prompts sent on behalf of the request carrying ctx.
+func RedactionsFromContext(ctx context.Context) map[string]int {
+	b, ok := ctx.Value(budgetKey{}).(*budget)
+	if !ok {
+		return nil
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	counts := make(map[string]int, len(b.redactions))
+	for category, n := range b.redactions {
+		counts[category] = n
+	}
+	return counts
+}
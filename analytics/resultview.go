@@ -0,0 +1,151 @@
+package analytics
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+)
+
+// findingLists are the fields of a stored analysis result that hold
+// insights and issues.
+var findingLists = []string{"insights", "potential_issues", "resource_issues"}
+
+// ResultView selects part of a stored analysis result.
+type ResultView struct {
+	Categories []string // keep insights and issues of these categories
+	Severities []string // keep issues of these severities; insights have none
+	Offset     int      // first finding of each list to return
+	Limit      int      // findings of each list to return; 0 returns all
+	Fields     []string // result fields to keep; empty keeps all
+}
+
+// FindingsPage describes the page of a finding list a ResultView returned.
+type FindingsPage struct {
+	Total      int  `json:"total"` // findings after filtering, before pagination
+	Offset     int  `json:"offset"`
+	Limit      int  `json:"limit"`
+	NextOffset *int `json:"next_offset,omitempty"`
+}
+
+// ParseSeverities parses a severity filter: either a comma-separated list
+// of severities, or the lowest severity to keep.
+func ParseSeverities(list, minimum string) ([]string, error) {
+	if list != "" && minimum != "" {
+		return nil, fmt.Errorf("%w: pass severity or min_severity, not both", ErrInvalidInput)
+	}
+	var severities []string
+	for _, part := range strings.Split(list, ",") {
+		s, err := parseSeverity(part)
+		if err != nil {
+			return nil, err
+		}
+		if s != "" && !containsString(severities, s) {
+			severities = append(severities, s)
+		}
+	}
+	s, err := parseSeverity(minimum)
+	if err != nil || s == "" {
+		return severities, err
+	}
+	for i, severity := range IssueSeverities {
+		if severity == s {
+			return append([]string(nil), IssueSeverities[i:]...), nil
+		}
+	}
+	return severities, nil
+}
+
+func parseSeverity(raw string) (string, error) {
+	s := strings.ToLower(strings.TrimSpace(raw))
+	if alias, ok := severityAliases[s]; ok {
+		s = alias
+	}
+	if s != "" && !containsString(IssueSeverities, s) {
+		return "", fmt.Errorf("%w: unknown severity %q, must be one of %s", ErrInvalidInput, strings.TrimSpace(raw), strings.Join(IssueSeverities, ", "))
+	}
+	return s, nil
+}
+
+// ViewResult applies v to a stored analysis result. Filters and pagination
+// apply to each of the insights, potential_issues and resource_issues
+// lists the result has; the pages returned are keyed by list. Other fields
+// are returned unchanged, unless v.Fields leaves them out. Findings stored
+// before categories existed are categorized on the way out.
+func ViewResult(result json.RawMessage, v ResultView) (json.RawMessage, map[string]FindingsPage, error) {
+	if v.Offset < 0 || v.Limit < 0 || v.Limit > MaxQueryLimit {
+		return nil, nil, fmt.Errorf("%w: limit must be 0-%d and offset non-negative", ErrInvalidInput, MaxQueryLimit)
+	}
+	if len(result) == 0 || (len(v.Categories) == 0 && len(v.Severities) == 0 && v.Offset == 0 && v.Limit == 0 && len(v.Fields) == 0) {
+		return result, nil, nil
+	}
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal(result, &fields); err != nil {
+		return nil, nil, err
+	}
+	if len(v.Fields) > 0 {
+		for key := range fields {
+			if !containsString(v.Fields, key) {
+				delete(fields, key)
+			}
+		}
+	}
+
+	pages := make(map[string]FindingsPage)
+	for _, key := range findingLists {
+		raw, ok := fields[key]
+		if !ok {
+			continue
+		}
+		var kept []interface{}
+		if key == "insights" {
+			var insights []Insight
+			if err := json.Unmarshal(raw, &insights); err != nil {
+				return nil, nil, err
+			}
+			for _, insight := range insights {
+				insight.Category = insight.category()
+				if len(v.Categories) == 0 || containsString(v.Categories, insight.Category) {
+					kept = append(kept, insight)
+				}
+			}
+		} else {
+			var issues []Issue
+			if err := json.Unmarshal(raw, &issues); err != nil {
+				return nil, nil, err
+			}
+			for _, issue := range issues {
+				issue.Category = issue.category()
+				if len(v.Categories) > 0 && !containsString(v.Categories, issue.Category) {
+					continue
+				}
+				if len(v.Severities) > 0 && !containsString(v.Severities, strings.ToLower(issue.Severity)) {
+					continue
+				}
+				kept = append(kept, issue)
+			}
+		}
+
+		page := FindingsPage{Total: len(kept), Offset: v.Offset, Limit: v.Limit}
+		if v.Limit > 0 || v.Offset > 0 {
+			start, end := v.Offset, len(kept)
+			if start > end {
+				start = end
+			}
+			if v.Limit > 0 && start+v.Limit < end {
+				end = start + v.Limit
+				page.NextOffset = &end
+			}
+			kept = kept[start:end]
+			pages[key] = page
+		}
+		if kept == nil {
+			kept = []interface{}{}
+		}
+		var err error
+		if fields[key], err = json.Marshal(kept); err != nil {
+			return nil, nil, err
+		}
+	}
+	viewed, err := json.Marshal(fields)
+	return viewed, pages, err
+}
@@ -0,0 +1,61 @@
+package analytics
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"analyticsai/ai-service/analytics/aggregator"
+)
+
+// AnalyzeRootCause correlates error and latency bursts across paths and
+// asks Gemini to turn the strongest correlations into causal hypotheses.
+func (s *AnalyticsService) AnalyzeRootCause(ctx context.Context, logs []LogEntry, interval time.Duration) (*aggregator.RootCauseReport, error) {
+	if err := CheckEntryLimit(ctx, len(logs)); err != nil {
+		return nil, err
+	}
+	if interval <= 0 {
+		interval = aggregator.AutoInterval(logs)
+	}
+
+	report := &aggregator.RootCauseReport{
+		Interval:     aggregator.FormatInterval(interval),
+		Correlations: aggregator.FindCorrelations(logs, interval),
+		Hypotheses:   []aggregator.Hypothesis{},
+	}
+	if len(report.Correlations) == 0 {
+		return report, nil
+	}
+
+	var summary strings.Builder
+	for _, c := range report.Correlations {
+		summary.WriteString(fmt.Sprintf("%s: %s %s leads %s %s by %s (r=%.2f)\n",
+			c.ID, untrusted(c.Leader), c.LeaderMetric, untrusted(c.Follower), c.FollowerMetric, c.Lag, c.Coefficient))
+		for i, e := range c.Evidence {
+			if i == 3 {
+				break
+			}
+			summary.WriteString(fmt.Sprintf("- %s\n", untrusted(e)))
+		}
+	}
+
+	prompt := buildPrompt(s.instructions(PromptRootCause, map[string]string{"Interval": report.Interval}), "Correlations", s.redact(ctx, summary.String()))
+
+	response, err := s.callGeminiAPI(ctx, prompt)
+	if err != nil {
+		return nil, fmt.Errorf("error generating analysis: %w", err)
+	}
+
+	var result struct {
+		Hypotheses []aggregator.Hypothesis `json:"hypotheses"`
+	}
+	if err := decodeModelOutput(ctx, response, &result); err != nil {
+		return nil, err
+	}
+	if result.Hypotheses != nil {
+		report.Hypotheses = result.Hypotheses
+	}
+
+	return report, nil
+}
@@ -0,0 +1,61 @@
+package analytics
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"analyticsai/ai-service/analytics/aggregator"
+)
+
+// AnalyzeSecurity runs the deterministic threat detectors and asks Gemini
+// for an overall assessment and prioritized recommendations.
+func (s *AnalyticsService) AnalyzeSecurity(ctx context.Context, logs []LogEntry, authFailureThreshold int) (*aggregator.SecurityReport, error) {
+	if err := CheckEntryLimit(ctx, len(logs)); err != nil {
+		return nil, err
+	}
+
+	report := &aggregator.SecurityReport{
+		Threats:      aggregator.DetectThreats(logs, authFailureThreshold),
+		CountsByType: make(map[string]int),
+	}
+	for _, t := range report.Threats {
+		report.CountsByType[t.Type] += t.Count
+	}
+	if len(report.Threats) == 0 {
+		report.Assessment = "No threats detected."
+		report.Recommendations = []string{}
+		return report, nil
+	}
+
+	var summary strings.Builder
+	for i, t := range report.Threats {
+		if i == 30 {
+			break
+		}
+		summary.WriteString(fmt.Sprintf("- [%s] %s: %s (client %s, %d requests, paths %s)\n",
+			t.Severity, t.Type, t.Description, untrusted(t.ClientIP), t.Count, untrusted(strings.Join(t.Paths, ", "))))
+		for _, e := range t.Evidence {
+			summary.WriteString(fmt.Sprintf("  evidence: %q\n", untrusted(e)))
+		}
+	}
+
+	prompt := buildPrompt(s.instructions(PromptSecurity, nil), "Detected Threats", s.redact(ctx, summary.String()))
+
+	response, err := s.callGeminiAPI(ctx, prompt)
+	if err != nil {
+		return nil, fmt.Errorf("error generating analysis: %w", err)
+	}
+
+	var result struct {
+		Assessment      string   `json:"assessment"`
+		Recommendations []string `json:"recommendations"`
+	}
+	if err := decodeModelOutput(ctx, response, &result); err != nil {
+		return nil, err
+	}
+	report.Assessment = result.Assessment
+	report.Recommendations = result.Recommendations
+
+	return report, nil
+}
@@ -0,0 +1,619 @@
+package analytics
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+
+	"analyticsai/ai-service/analytics/aggregator"
+	"analyticsai/ai-service/analytics/parser"
+)
+
+const (
+	maxSEOExamples = 5
+	maxSEOIssues   = 50
+
+	// redirectFollowWindow is how soon after a redirect the same client's
+	// next request is taken as following it, for entries without a
+	// Location.
+	redirectFollowWindow = 5 * time.Second
+
+	// crawlErrorShare is the percentage of 4xx/5xx responses to a crawler
+	// above which its crawl is reported as wasted.
+	crawlErrorShare   = 10.0
+	minCrawlerSample  = 10
+	slowCrawlLatency  = 1000 // ms
+	busyNotFoundCount = 100
+)
+
+// searchCrawlers are the crawlers whose fetches put a page in a search
+// index; only their successful fetches mark a page as indexed.
+var searchCrawlers = []string{"Googlebot", "Bingbot", "YandexBot", "Baiduspider", "DuckDuckBot", "Yahoo Slurp", "Applebot"}
+
+var locationKeys = []string{"location", "redirect_location", "redirect_url", "redirect_to"}
+
+// softErrorPattern matches messages of successful responses that still
+// rendered an error page.
+var softErrorPattern = regexp.MustCompile(`(?i)\b(error|exception|panic|traceback|stack trace|fatal|unavailable|something went wrong)\b`)
+
+// SEO issue types.
+const (
+	SEOBrokenLinks   = "broken_links"
+	SEORedirectChain = "redirect_chain"
+	SEORedirectLoop  = "redirect_loop"
+	SEOServerError   = "server_error_on_indexed_page"
+	SEOSoftError     = "soft_error_on_indexed_page"
+	SEOCrawlErrors   = "crawl_errors"
+	SEOSlowCrawl     = "slow_crawl"
+)
+
+// NotFoundCluster groups 404 responses whose paths normalize to the same
+// pattern.
+type NotFoundCluster struct {
+	Pattern           string   `json:"pattern"`
+	Requests          int      `json:"requests"`
+	URLs              int      `json:"distinct_urls"`
+	Examples          []string `json:"examples"`
+	CrawlerRequests   int      `json:"crawler_requests"`
+	InternalReferrers int      `json:"internal_referrers"` // requests linked from our own pages
+	TopReferrers      []string `json:"top_referrers"`
+}
+
+// RedirectChain is a path that takes more than one redirect to resolve, or
+// never resolves.
+type RedirectChain struct {
+	Hops     []string `json:"hops"` // the requested path, every redirect target, and the final URL
+	Requests int      `json:"requests"`
+	Loop     bool     `json:"loop"`
+}
+
+// IndexedPageErrors counts the failed responses of a page search crawlers
+// have indexed.
+type IndexedPageErrors struct {
+	Path          string   `json:"path"`
+	Requests      int      `json:"requests"`
+	ServerErrors  int      `json:"server_errors"` // 5xx
+	SoftErrors    int      `json:"soft_errors"`   // 2xx that logged an error
+	CrawlerErrors int      `json:"crawler_errors"`
+	Examples      []string `json:"examples"`
+}
+
+// CrawlerActivity summarizes how one crawler fetched the site.
+type CrawlerActivity struct {
+	Name         string  `json:"name"`
+	Requests     int     `json:"requests"`
+	Paths        int     `json:"distinct_paths"`
+	Success      int     `json:"success"`
+	Redirects    int     `json:"redirects"`
+	NotFound     int     `json:"not_found"`
+	ServerErrors int     `json:"server_errors"`
+	ErrorShare   float64 `json:"error_share"` // percent of 4xx and 5xx
+	AvgLatency   float64 `json:"avg_latency_ms"`
+	FirstSeen    string  `json:"first_seen,omitempty"`
+	LastSeen     string  `json:"last_seen,omitempty"`
+}
+
+// SEOIssue is one finding of an SEO health analysis.
+type SEOIssue struct {
+	Type        string   `json:"type"`
+	Severity    string   `json:"severity"`
+	Description string   `json:"description"`
+	Paths       []string `json:"paths"`
+	Count       int      `json:"count"`
+}
+
+type SEOReport struct {
+	IndexedPages    int                 `json:"indexed_pages"`
+	NotFound        []NotFoundCluster   `json:"not_found_clusters"`
+	RedirectChains  []RedirectChain     `json:"redirect_chains"`
+	IndexedErrors   []IndexedPageErrors `json:"indexed_page_errors"`
+	Crawlers        []CrawlerActivity   `json:"crawlers"`
+	Issues          []SEOIssue          `json:"issues"`
+	Assessment      string              `json:"assessment"`
+	Recommendations []string            `json:"recommendations"`
+}
+
+// pagePath returns the path of a request without its query string.
+func pagePath(path string) string {
+	route, _, _ := strings.Cut(path, "?")
+	if route == "" {
+		return "/"
+	}
+	return route
+}
+
+// redirectTarget returns where a redirect points: a path for redirects
+// within the site, or the full URL for other hosts.
+func redirectTarget(log LogEntry) string {
+	location := aggregator.MetadataValue(log, locationKeys...)
+	if location == "" {
+		return ""
+	}
+	u, err := url.Parse(location)
+	if err != nil {
+		return location
+	}
+	if u.Host != "" {
+		own := strings.TrimPrefix(strings.ToLower(aggregator.Host(log)), "www.")
+		if own == "" || strings.TrimPrefix(strings.ToLower(u.Hostname()), "www.") != own {
+			return location
+		}
+	}
+	if u.Path == "" {
+		return "/"
+	}
+	return u.Path
+}
+
+// ComputeSEO finds the SEO problems in web logs: 404 clusters, redirect
+// chains and loops, 5xx and soft errors on pages search crawlers have
+// indexed, and each crawler's activity. Paths should be as logged, since
+// 404 clustering normalizes them itself.
+func ComputeSEO(logs []LogEntry) *SEOReport {
+	classes, names := aggregator.ClassifyEntries(logs)
+	report := &SEOReport{
+		NotFound:       []NotFoundCluster{},
+		RedirectChains: []RedirectChain{},
+		IndexedErrors:  []IndexedPageErrors{},
+		Crawlers:       []CrawlerActivity{},
+		Issues:         []SEOIssue{},
+	}
+
+	indexed := make(map[string]bool)
+	for i, log := range logs {
+		if classes[i] == aggregator.TrafficCrawler && containsString(searchCrawlers, names[i]) && log.Status >= 200 && log.Status < 300 {
+			indexed[pagePath(log.Path)] = true
+		}
+	}
+	report.IndexedPages = len(indexed)
+
+	report.NotFound = notFoundClusters(logs, classes)
+	report.RedirectChains = redirectChains(logs)
+	report.IndexedErrors = indexedPageErrors(logs, classes, indexed)
+	report.Crawlers = crawlerActivity(logs, names)
+	report.Issues = seoIssues(report)
+	return report
+}
+
+func notFoundClusters(logs []LogEntry, classes []string) []NotFoundCluster {
+	normalizer, _ := aggregator.NewPathNormalizer(nil, true)
+	type builder struct {
+		cluster   NotFoundCluster
+		urls      map[string]int
+		referrers map[string]int
+	}
+	byPattern := make(map[string]*builder)
+	for i, log := range logs {
+		if log.Status != 404 && log.Status != 410 {
+			continue
+		}
+		path := pagePath(log.Path)
+		pattern := normalizer.Normalize(path)
+		b, ok := byPattern[pattern]
+		if !ok {
+			b = &builder{
+				cluster:   NotFoundCluster{Pattern: pattern},
+				urls:      make(map[string]int),
+				referrers: make(map[string]int),
+			}
+			byPattern[pattern] = b
+		}
+		b.cluster.Requests++
+		b.urls[path]++
+		if classes[i] == aggregator.TrafficCrawler {
+			b.cluster.CrawlerRequests++
+		}
+		if ref := aggregator.Referrer(log); ref != "" && ref != "-" {
+			b.referrers[ref]++
+			if aggregator.ClassifyReferrer(log, nil) == aggregator.SourceInternal {
+				b.cluster.InternalReferrers++
+			}
+		}
+	}
+
+	clusters := make([]NotFoundCluster, 0, len(byPattern))
+	for _, b := range byPattern {
+		b.cluster.URLs = len(b.urls)
+		b.cluster.Examples = topKeys(b.urls, maxSEOExamples)
+		b.cluster.TopReferrers = topKeys(b.referrers, 3)
+		clusters = append(clusters, b.cluster)
+	}
+	sort.Slice(clusters, func(i, j int) bool {
+		if clusters[i].Requests != clusters[j].Requests {
+			return clusters[i].Requests > clusters[j].Requests
+		}
+		return clusters[i].Pattern < clusters[j].Pattern
+	})
+	return clusters
+}
+
+// redirectChains follows the redirects in logs. A redirect's target is its
+// Location metadata; without one, it is the next request of the same client
+// within redirectFollowWindow. Each path keeps its most frequent target.
+func redirectChains(logs []LogEntry) []RedirectChain {
+	edges := make(map[string]map[string]int)
+	addEdge := func(from, to string) {
+		if from == to {
+			return
+		}
+		if edges[from] == nil {
+			edges[from] = make(map[string]int)
+		}
+		edges[from][to]++
+	}
+
+	type request struct {
+		at   time.Time
+		path string
+		log  LogEntry
+	}
+	byClient := make(map[string][]request)
+	isRedirect := func(log LogEntry) bool {
+		return log.Status >= 300 && log.Status < 400 && log.Status != 304
+	}
+	for _, log := range logs {
+		if isRedirect(log) {
+			if target := redirectTarget(log); target != "" {
+				addEdge(pagePath(log.Path), target)
+				continue
+			}
+		}
+		if ip := aggregator.ClientIP(log); ip != "" {
+			if t, ok := parser.ParseTimestamp(log.Timestamp); ok {
+				key := ip + "|" + aggregator.UserAgent(log)
+				byClient[key] = append(byClient[key], request{t, pagePath(log.Path), log})
+			}
+		}
+	}
+	for _, requests := range byClient {
+		sort.SliceStable(requests, func(i, j int) bool { return requests[i].at.Before(requests[j].at) })
+		for i := 0; i+1 < len(requests); i++ {
+			r := requests[i]
+			if !isRedirect(r.log) {
+				continue
+			}
+			if next := requests[i+1]; next.at.Sub(r.at) <= redirectFollowWindow {
+				addEdge(r.path, next.path)
+			}
+		}
+	}
+
+	target := make(map[string]string)
+	requests := make(map[string]int)
+	targeted := make(map[string]bool)
+	for from, tos := range edges {
+		target[from] = topKeys(tos, 1)[0]
+		targeted[target[from]] = true
+		for _, n := range tos {
+			requests[from] += n
+		}
+	}
+	sources := make([]string, 0, len(target))
+	for from := range target {
+		sources = append(sources, from)
+	}
+	sort.Strings(sources)
+
+	var chains []RedirectChain
+	reached := make(map[string]bool)
+	follow := func(start string) {
+		chain := RedirectChain{Hops: []string{start}, Requests: requests[start]}
+		seen := map[string]bool{start: true}
+		for cur := start; ; {
+			reached[cur] = true
+			next, ok := target[cur]
+			if !ok {
+				break
+			}
+			chain.Hops = append(chain.Hops, next)
+			if seen[next] {
+				chain.Loop = true
+				break
+			}
+			seen[next] = true
+			cur = next
+		}
+		// A single redirect is fine; only chains and loops are reported.
+		if chain.Loop || len(chain.Hops) > 2 {
+			chains = append(chains, chain)
+		}
+	}
+	// Chains start at paths nothing redirects to; whatever is left after
+	// following them is part of a loop.
+	for _, from := range sources {
+		if !targeted[from] {
+			follow(from)
+		}
+	}
+	for _, from := range sources {
+		if !reached[from] {
+			follow(from)
+		}
+	}
+
+	sort.SliceStable(chains, func(i, j int) bool {
+		if chains[i].Loop != chains[j].Loop {
+			return chains[i].Loop
+		}
+		return chains[i].Requests > chains[j].Requests
+	})
+	if chains == nil {
+		return []RedirectChain{}
+	}
+	return chains
+}
+
+// isSoftError reports whether a successful response still logged an error.
+func isSoftError(log LogEntry) bool {
+	if log.Status < 200 || log.Status >= 300 {
+		return false
+	}
+	switch strings.ToLower(log.Level) {
+	case "error", "fatal", "critical":
+		return true
+	}
+	return softErrorPattern.MatchString(log.Message)
+}
+
+func indexedPageErrors(logs []LogEntry, classes []string, indexed map[string]bool) []IndexedPageErrors {
+	type builder struct {
+		page     IndexedPageErrors
+		examples map[string]int
+	}
+	byPath := make(map[string]*builder)
+	for i, log := range logs {
+		path := pagePath(log.Path)
+		if !indexed[path] {
+			continue
+		}
+		b, ok := byPath[path]
+		if !ok {
+			b = &builder{page: IndexedPageErrors{Path: path}, examples: make(map[string]int)}
+			byPath[path] = b
+		}
+		b.page.Requests++
+		failed := false
+		switch {
+		case log.Status >= 500:
+			b.page.ServerErrors++
+			failed = true
+		case isSoftError(log):
+			b.page.SoftErrors++
+			failed = true
+		}
+		if !failed {
+			continue
+		}
+		if classes[i] == aggregator.TrafficCrawler {
+			b.page.CrawlerErrors++
+		}
+		if log.Message != "" {
+			b.examples[log.Message]++
+		}
+	}
+
+	pages := []IndexedPageErrors{}
+	for _, b := range byPath {
+		if b.page.ServerErrors+b.page.SoftErrors == 0 {
+			continue
+		}
+		b.page.Examples = topKeys(b.examples, 3)
+		pages = append(pages, b.page)
+	}
+	sort.Slice(pages, func(i, j int) bool {
+		ei, ej := pages[i].ServerErrors+pages[i].SoftErrors, pages[j].ServerErrors+pages[j].SoftErrors
+		if ei != ej {
+			return ei > ej
+		}
+		return pages[i].Path < pages[j].Path
+	})
+	return pages
+}
+
+func crawlerActivity(logs []LogEntry, names []string) []CrawlerActivity {
+	type builder struct {
+		activity    CrawlerActivity
+		paths       map[string]bool
+		latency     int64
+		first, last time.Time
+	}
+	byName := make(map[string]*builder)
+	for i, log := range logs {
+		if names[i] == "" {
+			continue
+		}
+		b, ok := byName[names[i]]
+		if !ok {
+			b = &builder{activity: CrawlerActivity{Name: names[i]}, paths: make(map[string]bool)}
+			byName[names[i]] = b
+		}
+		b.activity.Requests++
+		b.paths[pagePath(log.Path)] = true
+		b.latency += log.Duration
+		switch {
+		case log.Status >= 500:
+			b.activity.ServerErrors++
+		case log.Status == 404 || log.Status == 410:
+			b.activity.NotFound++
+		case log.Status >= 300 && log.Status < 400:
+			b.activity.Redirects++
+		case log.Status >= 200 && log.Status < 300:
+			b.activity.Success++
+		}
+		if log.Status >= 400 {
+			b.activity.ErrorShare++
+		}
+		if t, ok := parser.ParseTimestamp(log.Timestamp); ok {
+			if b.first.IsZero() || t.Before(b.first) {
+				b.first = t
+			}
+			if t.After(b.last) {
+				b.last = t
+			}
+		}
+	}
+
+	crawlers := []CrawlerActivity{}
+	for _, b := range byName {
+		a := b.activity
+		a.Paths = len(b.paths)
+		a.ErrorShare = round2(a.ErrorShare / float64(a.Requests) * 100)
+		a.AvgLatency = round2(float64(b.latency) / float64(a.Requests))
+		if !b.first.IsZero() {
+			a.FirstSeen = b.first.Format(time.RFC3339)
+			a.LastSeen = b.last.Format(time.RFC3339)
+		}
+		crawlers = append(crawlers, a)
+	}
+	sort.Slice(crawlers, func(i, j int) bool {
+		if crawlers[i].Requests != crawlers[j].Requests {
+			return crawlers[i].Requests > crawlers[j].Requests
+		}
+		return crawlers[i].Name < crawlers[j].Name
+	})
+	return crawlers
+}
+
+// seoIssues turns the findings of report into issues ordered by severity
+// and volume.
+func seoIssues(report *SEOReport) []SEOIssue {
+	issues := []SEOIssue{}
+	for _, c := range report.NotFound {
+		severity := "low"
+		switch {
+		case c.CrawlerRequests > 0 && (c.InternalReferrers > 0 || c.Requests >= busyNotFoundCount):
+			severity = "high"
+		case c.CrawlerRequests > 0 || c.InternalReferrers > 0:
+			severity = "medium"
+		}
+		description := fmt.Sprintf("%d requests to %d missing URLs matching %s", c.Requests, c.URLs, c.Pattern)
+		if c.InternalReferrers > 0 {
+			description += fmt.Sprintf(", %d of them from links on our own pages", c.InternalReferrers)
+		}
+		if c.CrawlerRequests > 0 {
+			description += fmt.Sprintf(", %d from crawlers", c.CrawlerRequests)
+		}
+		issues = append(issues, SEOIssue{Type: SEOBrokenLinks, Severity: severity, Description: description, Paths: c.Examples, Count: c.Requests})
+	}
+
+	for _, chain := range report.RedirectChains {
+		issue := SEOIssue{Paths: chain.Hops, Count: chain.Requests}
+		switch {
+		case chain.Loop:
+			issue.Type, issue.Severity = SEORedirectLoop, "high"
+			issue.Description = fmt.Sprintf("%s redirects in a loop: %s", chain.Hops[0], strings.Join(chain.Hops, " -> "))
+		default:
+			issue.Type, issue.Severity = SEORedirectChain, "low"
+			if len(chain.Hops) > 3 {
+				issue.Severity = "medium"
+			}
+			issue.Description = fmt.Sprintf("%s takes %d redirects to resolve: %s", chain.Hops[0], len(chain.Hops)-1, strings.Join(chain.Hops, " -> "))
+		}
+		issues = append(issues, issue)
+	}
+
+	for _, p := range report.IndexedErrors {
+		if p.ServerErrors > 0 {
+			severity := "medium"
+			if p.CrawlerErrors > 0 {
+				severity = "high"
+			}
+			issues = append(issues, SEOIssue{
+				Type: SEOServerError, Severity: severity, Paths: []string{p.Path}, Count: p.ServerErrors,
+				Description: fmt.Sprintf("Indexed page %s returned %d server errors in %d requests", p.Path, p.ServerErrors, p.Requests),
+			})
+		}
+		if p.SoftErrors > 0 {
+			issues = append(issues, SEOIssue{
+				Type: SEOSoftError, Severity: "medium", Paths: []string{p.Path}, Count: p.SoftErrors,
+				Description: fmt.Sprintf("Indexed page %s returned 2xx while logging an error %d times", p.Path, p.SoftErrors),
+			})
+		}
+	}
+
+	for _, c := range report.Crawlers {
+		if c.Requests < minCrawlerSample {
+			continue
+		}
+		if c.ErrorShare > crawlErrorShare {
+			severity := "medium"
+			if c.ServerErrors > 0 && containsString(searchCrawlers, c.Name) {
+				severity = "high"
+			}
+			issues = append(issues, SEOIssue{
+				Type: SEOCrawlErrors, Severity: severity, Count: c.NotFound + c.ServerErrors, Paths: []string{},
+				Description: fmt.Sprintf("%.1f%% of %s's %d requests failed (%d not found, %d server errors)", c.ErrorShare, c.Name, c.Requests, c.NotFound, c.ServerErrors),
+			})
+		}
+		if c.AvgLatency > slowCrawlLatency {
+			issues = append(issues, SEOIssue{
+				Type: SEOSlowCrawl, Severity: "low", Count: c.Requests, Paths: []string{},
+				Description: fmt.Sprintf("%s's requests took %.0f ms on average, which can reduce its crawl rate", c.Name, c.AvgLatency),
+			})
+		}
+	}
+
+	sort.SliceStable(issues, func(i, j int) bool {
+		if aggregator.SeverityRank(issues[i].Severity) != aggregator.SeverityRank(issues[j].Severity) {
+			return aggregator.SeverityRank(issues[i].Severity) > aggregator.SeverityRank(issues[j].Severity)
+		}
+		return issues[i].Count > issues[j].Count
+	})
+	if len(issues) > maxSEOIssues {
+		issues = issues[:maxSEOIssues]
+	}
+	return issues
+}
+
+// AnalyzeSEO computes the SEO findings of logs and asks Gemini to assess
+// them and recommend fixes.
+func (s *AnalyticsService) AnalyzeSEO(ctx context.Context, logs []LogEntry) (*SEOReport, error) {
+	if err := CheckEntryLimit(ctx, len(logs)); err != nil {
+		return nil, err
+	}
+
+	report := ComputeSEO(logs)
+	if len(report.Issues) == 0 {
+		report.Assessment = "No SEO issues detected."
+		report.Recommendations = []string{}
+		return report, nil
+	}
+
+	var summary strings.Builder
+	summary.WriteString(fmt.Sprintf("%d pages were fetched successfully by search crawlers.\n\nIssues:\n", report.IndexedPages))
+	for i, issue := range report.Issues {
+		if i == 30 {
+			break
+		}
+		summary.WriteString(fmt.Sprintf("- [%s] %s: %s\n", issue.Severity, issue.Type, untrusted(issue.Description)))
+	}
+	if len(report.Crawlers) > 0 {
+		summary.WriteString("\nCrawler activity:\n")
+		for _, c := range report.Crawlers {
+			summary.WriteString(fmt.Sprintf("- %s: %d requests over %d paths, %d ok, %d redirects, %d not found, %d server errors, avg %.0f ms\n",
+				c.Name, c.Requests, c.Paths, c.Success, c.Redirects, c.NotFound, c.ServerErrors, c.AvgLatency))
+		}
+	}
+
+	prompt := buildPrompt(s.instructions(PromptSEO, nil), "SEO Findings", s.redact(ctx, summary.String()))
+
+	response, err := s.callGeminiAPI(ctx, prompt)
+	if err != nil {
+		return nil, fmt.Errorf("error generating analysis: %w", err)
+	}
+
+	var result struct {
+		Assessment      string   `json:"assessment"`
+		Recommendations []string `json:"recommendations"`
+	}
+	if err := decodeModelOutput(ctx, response, &result); err != nil {
+		return nil, err
+	}
+	report.Assessment = result.Assessment
+	report.Recommendations = result.Recommendations
+	return report, nil
+}
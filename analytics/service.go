@@ -1,45 +1,117 @@
+// Package analytics analyzes web server and application logs with
+// deterministic statistics and an LLM. It is layered so other Go services
+// can embed it instead of calling this service over HTTP:
+//
+//   - parser decodes log entries (JSON, container logs, CSV) and their
+//     timestamps;
+//   - aggregator computes the deterministic statistics over them;
+//   - this package runs the LLM analyses, such as AnalyzeLogs, over the
+//     aggregates;
+//   - llm holds the model clients the analyses call, behind the Client and
+//     Embedder interfaces;
+//   - report renders analysis results as PDF and HTML, and export writes
+//     the logs as CSV, Excel and Parquet.
+//
+// An AnalyticsService has no package-level state: everything it uses is
+// passed to New, and per-request limits and usage travel in the context.
+//
+//	gemini := llm.NewGemini(apiKey)
+//	svc := analytics.New(analytics.Config{Gemini: gemini, Embedder: gemini})
+//	logs, err := parser.DecodeLogs(data, nil)
+//	...
+//	result, err := svc.AnalyzeLogs(ctx, logs, analytics.AnalysisOptions{})
 package analytics
 
 import (
-	"bytes"
 	"context"
-	"encoding/csv"
 	"encoding/json"
 	"fmt"
-	"io"
-	"net/http"
-	"strconv"
 	"strings"
 	"time"
-)
 
-const (
-	chunkSize      = 8000 // characters per chunk for Gemini API
-	geminiEndpoint = "https://generativelanguage.googleapis.com/v1beta/models/gemini-2.0-flash:generateContent"
+	"analyticsai/ai-service/analytics/aggregator"
+	"analyticsai/ai-service/analytics/llm"
+	"analyticsai/ai-service/analytics/parser"
 )
 
+const chunkSize = 8000 // characters per chunk for Gemini API
+
+// AnalyticsService runs analyses. Its state is what New was configured
+// with, so several services with different clients can share a process.
 type AnalyticsService struct {
-	apiKey string
+	gemini   llm.Client
+	openAI   llm.Client
+	embedder llm.Embedder
+	geo      aggregator.GeoLocator
+	redactor *Redactor
+	prompts  *PromptRegistry
+
+	consensusModels []Model
+}
+
+// Config configures an AnalyticsService. Every field is optional; analyses
+// needing a missing client fail when they call it.
+type Config struct {
+	Gemini          llm.Client   // gemini models, including the default model
+	OpenAI          llm.Client   // openai models
+	Embedder        llm.Embedder // embeddings for semantic search
+	GeoLocator      aggregator.GeoLocator
+	Redactor        *Redactor       // applied to the log data of every prompt and to embedded text
+	Prompts         *PromptRegistry // defaults to the built-in prompts
+	ConsensusModels []Model
 }
 
-type LogEntry struct {
-	Timestamp string            `json:"timestamp"`
-	Level     string            `json:"level"`
-	Message   string            `json:"message"`
-	Path      string            `json:"path"`
-	Method    string            `json:"method"`
-	Duration  int64             `json:"duration"`
-	Status    int               `json:"status"`
-	Metadata  map[string]string `json:"metadata"`
+// New returns a service configured by cfg.
+func New(cfg Config) *AnalyticsService {
+	return &AnalyticsService{
+		gemini:          cfg.Gemini,
+		openAI:          cfg.OpenAI,
+		embedder:        cfg.Embedder,
+		geo:             cfg.GeoLocator,
+		redactor:        cfg.Redactor,
+		prompts:         cfg.Prompts,
+		consensusModels: cfg.ConsensusModels,
+	}
 }
 
+// LogEntry is the log entry type of the parser layer; it is aliased here so
+// callers of the analysis layer need not import the parser.
+type LogEntry = parser.LogEntry
+
 type AnalysisResult struct {
-	PopularPages    []string          `json:"popular_pages"`
-	SlowPages       []PerformanceData `json:"slow_pages"`
-	PotentialIssues []Issue           `json:"potential_issues"`
-	Insights        []string          `json:"insights"`
+	PopularPages    []string                          `json:"popular_pages"`
+	SlowPages       []PerformanceData                 `json:"slow_pages"`
+	PotentialIssues []Issue                           `json:"potential_issues"`
+	Insights        []Insight                         `json:"insights"`
+	TimeSeries      *aggregator.TimeSeries            `json:"time_series,omitempty"`
+	Anomalies       []aggregator.Anomaly              `json:"anomalies"`
+	Traffic         *aggregator.TrafficClassification `json:"traffic_classification"`
+	UserAgents      *aggregator.UserAgentBreakdown    `json:"user_agents,omitempty"`
+	Geography       *aggregator.GeoBreakdown          `json:"geography,omitempty"`
+	Referrers       *aggregator.ReferrerBreakdown     `json:"referrers,omitempty"`
+	GroupBy         string                            `json:"group_by,omitempty"`
+	Groups          []aggregator.DimensionStats       `json:"groups,omitempty"`   // set when grouping by something other than path
+	Services        []aggregator.DimensionStats       `json:"services,omitempty"` // set when entries name their service
+	Sampling        *aggregator.SamplingReport        `json:"sampling,omitempty"`
+	Consensus       *ConsensusReport                  `json:"consensus,omitempty"`
 }
 
+// AnalysisOptions controls the deterministic statistics computed alongside
+// the AI analysis.
+type AnalysisOptions struct {
+	PreprocessOptions
+	Interval         time.Duration      // time-series bucket width, zero disables bucketing
+	AnomalyThreshold float64            // z-score for anomaly flags, defaults to aggregator.DefaultAnomalyThreshold
+	InternalHosts    []string           // referrer hosts treated as internal navigation
+	GroupBy          aggregator.GroupBy // dimensions statistics are grouped by, defaults to path
+	SampleThreshold  int                // entries above which the summary is sampled, defaults to aggregator.DefaultSampleThreshold; negative disables
+	Feedback         []FeedbackExample  // rated insights and issues of earlier analyses, given to the model as guidance
+	Consensus        bool               // run the analysis on every consensus model and reconcile their outputs
+}
+
+// maxSummaryBuckets caps how many time buckets are written into a prompt.
+const maxSummaryBuckets = 48
+
 type PerformanceData struct {
 	Path         string  `json:"path"`
 	AvgDuration  int64   `json:"avg_duration"`
@@ -48,38 +120,64 @@ type PerformanceData struct {
 }
 
 type Issue struct {
-	Type        string      `json:"type"`
-	Description string      `json:"description"`
-	Severity    string      `json:"severity"`
-	Path        interface{} `json:"path"` // Can be either string or []string
-}
-
-type GeminiRequest struct {
-	Contents []GeminiContent `json:"contents"`
+	Type        string     `json:"type"` // one of IssueTypes
+	Description string     `json:"description"`
+	Severity    string     `json:"severity"` // one of IssueSeverities
+	Category    string     `json:"category"` // one of Categories
+	Path        []string   `json:"path"`
+	Confidence  float64    `json:"confidence"` // 0 to 1, as estimated by the model
+	Evidence    []Evidence `json:"evidence"`
+	Grounded    bool       `json:"grounded"` // whether any evidence was verified
+
+	// SimilarPast lists similar issues of earlier analyses, set by
+	// FindSimilarIssues.
+	SimilarPast []SimilarIssue `json:"similar_past_issues,omitempty"`
+
+	// Consensus is set in consensus mode.
+	Consensus *Provenance `json:"consensus,omitempty"`
 }
 
-type GeminiContent struct {
-	Parts []GeminiPart `json:"parts"`
-}
-
-type GeminiPart struct {
-	Text string `json:"text"`
-}
-
-type GeminiResponse struct {
-	Candidates []struct {
-		Content struct {
-			Parts []struct {
-				Text string `json:"text"`
-			} `json:"parts"`
-		} `json:"content"`
-	} `json:"candidates"`
+// UnmarshalJSON also accepts a single string or null as the path, forms
+// that model output and older stored analyses use, and a quoted or
+// percentage confidence. Unknown fields are ignored.
+func (i *Issue) UnmarshalJSON(data []byte) error {
+	type plain Issue
+	var raw struct {
+		plain
+		Path       json.RawMessage `json:"path"`
+		Confidence json.RawMessage `json:"confidence"`
+	}
+	if err := json.Unmarshal(data, &raw); err != nil {
+		return err
+	}
+	confidence, err := looseNumber(raw.Confidence)
+	if err != nil {
+		return fmt.Errorf("confidence: %v", err)
+	}
+	*i = Issue(raw.plain)
+	i.Confidence = confidence
+	i.Path = []string{}
+	if len(raw.Path) == 0 || string(raw.Path) == "null" {
+		return nil
+	}
+	var path string
+	if json.Unmarshal(raw.Path, &path) == nil {
+		if path != "" {
+			i.Path = []string{path}
+		}
+		return nil
+	}
+	if err := json.Unmarshal(raw.Path, &i.Path); err != nil {
+		return fmt.Errorf("path must be a string or a list of strings")
+	}
+	return nil
 }
 
+// NewAnalyticsService returns a service calling Gemini with apiKey, for
+// generation and embeddings.
 func NewAnalyticsService(apiKey string) *AnalyticsService {
-	return &AnalyticsService{
-		apiKey: apiKey,
-	}
+	gemini := llm.NewGemini(apiKey)
+	return New(Config{Gemini: gemini, Embedder: gemini})
 }
 
 func cleanJSONResponse(response string) string {
@@ -99,76 +197,194 @@ func cleanJSONResponse(response string) string {
 	return response
 }
 
-func (s *AnalyticsService) AnalyzeLogs(ctx context.Context, logs []LogEntry) (*AnalysisResult, error) {
+func (s *AnalyticsService) AnalyzeLogs(ctx context.Context, logs []LogEntry, opts AnalysisOptions) (*AnalysisResult, error) {
+	if err := CheckEntryLimit(ctx, len(logs)); err != nil {
+		return nil, err
+	}
+	reportProgress(ctx, ProgressStatistics, fmt.Sprintf("%d entries", len(logs)))
+
+	var series *aggregator.TimeSeries
+	if opts.Interval > 0 {
+		var err error
+		if series, err = aggregator.BuildTimeSeries(logs, opts.Interval); err != nil {
+			return nil, err
+		}
+	}
+
 	// Create a summary of the logs instead of sending raw data
 	var summary strings.Builder
 	summary.WriteString("Log Summary:\n\n")
 
-	// Group logs by path for better analysis
-	pathStats := make(map[string]struct {
-		count     int
-		totalTime int64
-		errors    int
+	classes, crawlerNames := aggregator.ClassifyEntries(logs)
+
+	threshold := opts.SampleThreshold
+	if threshold == 0 {
+		threshold = aggregator.DefaultSampleThreshold
+	}
+	sampled, weights, sampling := aggregator.SampleLogs(logs, threshold)
+	if sampling != nil {
+		summary.WriteString(fmt.Sprintf("This summary is built from a sample of %d of %d entries (%.0f%% of errors, warnings and slow requests, %.0f%% of other requests); path statistics are weighted estimates.\n\n",
+			sampling.SampledEntries, sampling.TotalEntries, sampling.NotableRate*100, sampling.RoutineRate*100))
+	}
+
+	// Group logs by path (or the requested dimensions) for better analysis
+	groupStats := make(map[string]struct {
+		count     float64
+		totalTime float64
+		errors    float64
+		bots      float64
 	})
 
-	for _, log := range logs {
-		stats := pathStats[log.Path]
-		stats.count++
-		stats.totalTime += log.Duration
+	for j, i := range sampled {
+		log, weight := logs[i], weights[j]
+		key := opts.GroupBy.Key(log)
+		stats := groupStats[key]
+		stats.count += weight
+		stats.totalTime += float64(log.Duration) * weight
 		if log.Status >= 400 {
-			stats.errors++
+			stats.errors += weight
+		}
+		if aggregator.IsAutomated(classes[i]) {
+			stats.bots += weight
 		}
-		pathStats[log.Path] = stats
+		groupStats[key] = stats
 
 		// Add important events (errors, warnings, slow requests)
-		if log.Status >= 400 || log.Level == "error" || log.Level == "warning" || log.Duration > 1000 {
+		if aggregator.IsNotable(log) {
 			summary.WriteString(fmt.Sprintf("- %s [%s] %s (Duration: %dms, Status: %d)\n",
-				log.Timestamp, log.Level, log.Path, log.Duration, log.Status))
+				untrusted(log.Timestamp), untrusted(log.Level), untrusted(log.Path), log.Duration, log.Status))
 		}
 	}
 
-	// Add path statistics
-	summary.WriteString("\nPath Statistics:\n")
-	for path, stats := range pathStats {
-		avgTime := stats.totalTime / int64(stats.count)
-		errorRate := float64(stats.errors) / float64(stats.count) * 100
-		summary.WriteString(fmt.Sprintf("- %s: %d requests, avg time %dms, error rate %.1f%%\n",
-			path, stats.count, avgTime, errorRate))
+	// Add group statistics
+	if opts.GroupBy.IsPath() {
+		summary.WriteString("\nPath Statistics:\n")
+	} else {
+		summary.WriteString(fmt.Sprintf("\nStatistics by %s:\n", opts.GroupBy))
+	}
+	for key, stats := range groupStats {
+		avgTime := stats.totalTime / stats.count
+		errorRate := stats.errors / stats.count * 100
+		botShare := stats.bots / stats.count * 100
+		summary.WriteString(fmt.Sprintf("- %s: %.0f requests, avg time %.0fms, error rate %.1f%%, bot traffic %.1f%%\n",
+			untrusted(key), stats.count, avgTime, errorRate, botShare))
 	}
 
-	prompt := fmt.Sprintf(`Analyze this log summary and provide insights. Return ONLY a JSON object with this exact structure (no markdown, no backticks):
-{
-    "popular_pages": ["page1", "page2"],
-    "slow_pages": [{"path": "/example", "avg_duration": 1000, "request_count": 10, "error_rate": 5.0}],
-    "potential_issues": [{"type": "security", "description": "desc", "severity": "high", "path": "/example"}],
-    "insights": ["insight1", "insight2"]
-}
+	services := aggregator.ServiceStats(logs)
+	if len(services) > 0 {
+		writeDimensionSummary(&summary, "Statistics by service", services, 20)
+	}
 
-Log Summary:
-%s`, summary.String())
+	// Repetitive messages collapse into a few templates, which tell the
+	// model more than the handful of notable entries above.
+	if templates := aggregator.MineTemplates(logs); templates.TemplateCount > 0 {
+		writeTemplateSummary(&summary, templates, maxPromptTemplates)
+	}
 
-	response, err := s.callGeminiAPI(ctx, prompt)
-	if err != nil {
-		return nil, fmt.Errorf("error generating analysis: %v", err)
+	traffic := aggregator.SummarizeTraffic(logs, classes, crawlerNames)
+	summary.WriteString(fmt.Sprintf("\nTraffic mix: %.1f%% human, %.1f%% bots, %.1f%% known crawlers, %.1f%% unknown\n",
+		traffic.Shares[aggregator.TrafficHuman], traffic.Shares[aggregator.TrafficBot], traffic.Shares[aggregator.TrafficCrawler], traffic.Shares[aggregator.TrafficUnknown]))
+
+	var userAgents *aggregator.UserAgentBreakdown
+	if aggregator.EnrichUserAgents(logs) {
+		userAgents = aggregator.BreakdownUserAgents(logs)
+		writeDimensionSummary(&summary, "Traffic by device type", userAgents.Devices, 5)
+		writeDimensionSummary(&summary, "Traffic by browser", userAgents.Browsers, 8)
+		writeDimensionSummary(&summary, "Traffic by operating system", userAgents.OS, 8)
+	}
+
+	var geography *aggregator.GeoBreakdown
+	if s.geo != nil && aggregator.EnrichGeo(logs, s.geo) {
+		geography = aggregator.BreakdownGeo(logs)
+		writeDimensionSummary(&summary, "Traffic by country", geography.Countries, 10)
+		writeDimensionSummary(&summary, "Traffic by region", geography.Regions, 10)
+	}
+
+	referrers := aggregator.BreakdownReferrers(logs, opts.InternalHosts)
+	if referrers != nil {
+		writeDimensionSummary(&summary, "Traffic by source", referrers.Sources, 5)
+		writeDimensionSummary(&summary, "Top referring sites", referrers.TopReferrers, 10)
+	}
+
+	if series != nil {
+		writeTimeSeriesSummary(&summary, series, maxSummaryBuckets)
+	}
+	writeTimezoneNote(&summary, opts.Location)
+
+	anomalies := aggregator.DetectAnomalies(logs, opts.Interval, opts.AnomalyThreshold)
+	if len(anomalies) > 0 {
+		writeAnomalySummary(&summary, anomalies)
 	}
+	writeFeedbackGuidance(&summary, opts.Feedback)
 
-	// Clean and parse the response
-	cleanedResponse := cleanJSONResponse(response)
-	var result AnalysisResult
-	if err := json.Unmarshal([]byte(cleanedResponse), &result); err != nil {
-		return nil, fmt.Errorf("error parsing analysis result: %v, response: %s", err, cleanedResponse)
+	instructions := s.instructions(PromptLogAnalysis, nil)
+	if len(opts.Feedback) > 0 {
+		instructions += feedbackInstructions
+	}
+	prompt := buildPrompt(instructions, "Log Summary", s.redact(ctx, summary.String()))
+
+	generated := &logAnalysisOutput{}
+	var consensus *ConsensusReport
+	if opts.Consensus {
+		var err error
+		if generated, consensus, err = s.consensusLogAnalysis(ctx, prompt); err != nil {
+			return nil, err
+		}
+	} else {
+		response, err := s.callGeminiStructured(ctx, prompt, logAnalysisSchema)
+		if err != nil {
+			return nil, fmt.Errorf("error generating analysis: %w", err)
+		}
+		if err := decodeModelOutput(ctx, response, generated); err != nil {
+			return nil, err
+		}
+	}
+	result := AnalysisResult{
+		PopularPages:    generated.PopularPages,
+		SlowPages:       generated.SlowPages,
+		PotentialIssues: generated.PotentialIssues,
+		Insights:        generated.Insights,
+		Consensus:       consensus,
+	}
+	groundFindings(logs, result.Insights, result.PotentialIssues)
+	result.TimeSeries = series
+	result.Anomalies = anomalies
+	traffic.PopularPages = aggregator.BotShareFor(logs, classes, result.PopularPages)
+	result.Traffic = traffic
+	result.UserAgents = userAgents
+	result.Geography = geography
+	result.Referrers = referrers
+	result.Sampling = sampling
+	result.Services = services
+	if !opts.GroupBy.IsPath() {
+		result.GroupBy = opts.GroupBy.String()
+		result.Groups = aggregator.GroupStats(logs, opts.GroupBy)
 	}
 
 	return &result, nil
 }
 
-func (s *AnalyticsService) AnalyzePerformance(ctx context.Context, logs []LogEntry) (*PerformanceAnalysis, error) {
+// PerformanceOptions tunes the deterministic statistics attached to a
+// performance analysis.
+type PerformanceOptions struct {
+	AnalysisOptions
+	LatencyBuckets  []int64 // histogram bucket upper bounds in ms
+	ApdexSatisfied  int64   // Apdex T in ms, defaults to DefaultApdexThreshold
+	ApdexTolerating int64   // defaults to 4T
+}
+
+func (s *AnalyticsService) AnalyzePerformance(ctx context.Context, logs []LogEntry, opts PerformanceOptions) (*PerformanceAnalysis, error) {
+	if err := CheckEntryLimit(ctx, len(logs)); err != nil {
+		return nil, err
+	}
+	reportProgress(ctx, ProgressStatistics, fmt.Sprintf("%d entries", len(logs)))
+
 	// Create a performance summary
 	var summary strings.Builder
 	summary.WriteString("Performance Summary:\n\n")
 
-	// Group by path for performance analysis
-	pathStats := make(map[string]struct {
+	// Group by path (or the requested dimensions) for performance analysis
+	groupStats := make(map[string]struct {
 		count     int
 		totalTime int64
 		maxTime   int64
@@ -177,7 +393,8 @@ func (s *AnalyticsService) AnalyzePerformance(ctx context.Context, logs []LogEnt
 	})
 
 	for _, log := range logs {
-		stats := pathStats[log.Path]
+		key := opts.GroupBy.Key(log)
+		stats := groupStats[key]
 		if stats.count == 0 {
 			stats.minTime = log.Duration
 			stats.maxTime = log.Duration
@@ -194,160 +411,149 @@ func (s *AnalyticsService) AnalyzePerformance(ctx context.Context, logs []LogEnt
 		if log.Status >= 400 {
 			stats.errors++
 		}
-		pathStats[log.Path] = stats
+		groupStats[key] = stats
+	}
+
+	satisfied, tolerating, err := aggregator.ApdexThresholds(opts.ApdexSatisfied, opts.ApdexTolerating)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidInput, err)
+	}
+
+	var series *aggregator.TimeSeries
+	if opts.Interval > 0 {
+		if series, err = aggregator.BuildTimeSeries(logs, opts.Interval); err != nil {
+			return nil, err
+		}
+	}
+	apdex := aggregator.ComputeApdex(logs, satisfied, tolerating)
+	apdexByPath := make(map[string]float64, len(apdex.Endpoints))
+	for _, score := range apdex.Endpoints {
+		apdexByPath[score.Path] = score.Score
 	}
 
 	// Add performance statistics
-	for path, stats := range pathStats {
+	label := "Endpoint"
+	if !opts.GroupBy.IsPath() {
+		label = fmt.Sprintf("Group (%s)", opts.GroupBy)
+	}
+	for key, stats := range groupStats {
 		avgTime := stats.totalTime / int64(stats.count)
 		errorRate := float64(stats.errors) / float64(stats.count) * 100
-		summary.WriteString(fmt.Sprintf("Endpoint: %s\n", path))
+		summary.WriteString(fmt.Sprintf("%s: %s\n", label, untrusted(key)))
 		summary.WriteString(fmt.Sprintf("- Requests: %d\n", stats.count))
 		summary.WriteString(fmt.Sprintf("- Avg Time: %dms\n", avgTime))
 		summary.WriteString(fmt.Sprintf("- Min Time: %dms\n", stats.minTime))
 		summary.WriteString(fmt.Sprintf("- Max Time: %dms\n", stats.maxTime))
-		summary.WriteString(fmt.Sprintf("- Error Rate: %.1f%%\n\n", errorRate))
-	}
-
-	prompt := fmt.Sprintf(`Analyze this performance data and provide insights. Return ONLY a JSON object with this exact structure (no markdown, no backticks):
-{
-    "slow_endpoints": [{"path": "/example", "avg_duration": 1000, "request_count": 10, "error_rate": 5.0}],
-    "performance_patterns": ["pattern1", "pattern2"],
-    "resource_issues": [{"type": "memory", "description": "High memory usage", "severity": "high"}],
-    "recommendations": ["recommendation1", "recommendation2"]
-}
-
-Performance Data:
-%s`, summary.String())
-
-	response, err := s.callGeminiAPI(ctx, prompt)
-	if err != nil {
-		return nil, fmt.Errorf("error generating analysis: %v", err)
+		summary.WriteString(fmt.Sprintf("- Error Rate: %.1f%%\n", errorRate))
+		if score, ok := apdexByPath[key]; ok && opts.GroupBy.IsPath() {
+			summary.WriteString(fmt.Sprintf("- Apdex (T=%dms): %.2f\n", satisfied, score))
+		}
+		summary.WriteString("\n")
 	}
-
-	// Clean and parse the response
-	cleanedResponse := cleanJSONResponse(response)
-	var result PerformanceAnalysis
-	if err := json.Unmarshal([]byte(cleanedResponse), &result); err != nil {
-		return nil, fmt.Errorf("error parsing analysis result: %v, response: %s", err, cleanedResponse)
+	summary.WriteString(fmt.Sprintf("Overall Apdex (T=%dms): %.2f\n", satisfied, apdex.Overall.Score))
+	services := aggregator.ServiceStats(logs)
+	if len(services) > 0 {
+		writeDimensionSummary(&summary, "Statistics by service", services, 20)
 	}
 
-	return &result, nil
-}
-
-type PerformanceAnalysis struct {
-	SlowEndpoints       []PerformanceData `json:"slow_endpoints"`
-	PerformancePatterns []string          `json:"performance_patterns"`
-	ResourceIssues      []Issue           `json:"resource_issues"`
-	Recommendations     []string          `json:"recommendations"`
-}
-
-func (s *AnalyticsService) callGeminiAPI(ctx context.Context, prompt string) (string, error) {
-	reqBody := map[string]interface{}{
-		"contents": []map[string]interface{}{
-			{
-				"parts": []map[string]string{
-					{"text": prompt},
-				},
-			},
-		},
-		"generationConfig": map[string]interface{}{
-			"temperature":     0.3,
-			"topP":            0.8,
-			"topK":            40,
-			"maxOutputTokens": 1024,
-		},
-	}
-
-	jsonData, err := json.Marshal(reqBody)
-	if err != nil {
-		return "", fmt.Errorf("error marshaling request: %v", err)
+	// Repetitive messages collapse into a few templates, which tell the
+	// model more than the handful of notable entries above.
+	if templates := aggregator.MineTemplates(logs); templates.TemplateCount > 0 {
+		writeTemplateSummary(&summary, templates, maxPromptTemplates)
 	}
-
-	req, err := http.NewRequestWithContext(ctx, "POST", geminiEndpoint, bytes.NewBuffer(jsonData))
-	if err != nil {
-		return "", fmt.Errorf("error creating request: %v", err)
+	if series != nil {
+		writeTimeSeriesSummary(&summary, series, maxSummaryBuckets)
 	}
+	writeTimezoneNote(&summary, opts.Location)
 
-	req.Header.Set("Content-Type", "application/json")
-	req.Header.Set("x-goog-api-key", s.apiKey)
+	prompt := buildPrompt(s.instructions(PromptPerformanceAnalysis, nil), "Performance Data", s.redact(ctx, summary.String()))
 
-	client := &http.Client{Timeout: 15 * time.Second}
-	resp, err := client.Do(req)
+	response, err := s.callGeminiStructured(ctx, prompt, performanceAnalysisSchema)
 	if err != nil {
-		return "", fmt.Errorf("error making request: %v", err)
+		return nil, fmt.Errorf("error generating analysis: %w", err)
 	}
-	defer resp.Body.Close()
 
-	body, err := io.ReadAll(resp.Body)
-	if err != nil {
-		return "", fmt.Errorf("error reading response body: %v", err)
+	var generated struct {
+		SlowEndpoints       []PerformanceData `json:"slow_endpoints"`
+		PerformancePatterns []string          `json:"performance_patterns"`
+		ResourceIssues      []Issue           `json:"resource_issues"`
+		Recommendations     []string          `json:"recommendations"`
 	}
-
-	if resp.StatusCode != http.StatusOK {
-		return "", fmt.Errorf("API error (status %d): %s", resp.StatusCode, string(body))
+	if err := decodeModelOutput(ctx, response, &generated); err != nil {
+		return nil, err
 	}
-
-	var result map[string]interface{}
-	if err := json.Unmarshal(body, &result); err != nil {
-		return "", fmt.Errorf("error parsing response: %v", err)
+	result := PerformanceAnalysis{
+		SlowEndpoints:       generated.SlowEndpoints,
+		PerformancePatterns: generated.PerformancePatterns,
+		ResourceIssues:      generated.ResourceIssues,
+		Recommendations:     generated.Recommendations,
 	}
-
-	candidates, ok := result["candidates"].([]interface{})
-	if !ok || len(candidates) == 0 {
-		return "", fmt.Errorf("no candidates in response: %s", string(body))
+	groundFindings(logs, nil, result.ResourceIssues)
+
+	result.LatencyHistograms = aggregator.BuildLatencyHistograms(logs, opts.LatencyBuckets)
+	result.Apdex = apdex
+	result.TimeSeries = series
+	result.Services = services
+	if !opts.GroupBy.IsPath() {
+		result.GroupBy = opts.GroupBy.String()
+		result.Groups = aggregator.GroupStats(logs, opts.GroupBy)
 	}
 
-	content, ok := candidates[0].(map[string]interface{})["content"].(map[string]interface{})
-	if !ok {
-		return "", fmt.Errorf("invalid response format: %s", string(body))
-	}
+	return &result, nil
+}
 
-	parts, ok := content["parts"].([]interface{})
-	if !ok || len(parts) == 0 {
-		return "", fmt.Errorf("no parts in response: %s", string(body))
-	}
+type PerformanceAnalysis struct {
+	SlowEndpoints       []PerformanceData             `json:"slow_endpoints"`
+	PerformancePatterns []string                      `json:"performance_patterns"`
+	ResourceIssues      []Issue                       `json:"resource_issues"`
+	Recommendations     []string                      `json:"recommendations"`
+	LatencyHistograms   []aggregator.LatencyHistogram `json:"latency_histograms"`
+	Apdex               *aggregator.ApdexReport       `json:"apdex"`
+	TimeSeries          *aggregator.TimeSeries        `json:"time_series,omitempty"`
+	GroupBy             string                        `json:"group_by,omitempty"`
+	Groups              []aggregator.DimensionStats   `json:"groups,omitempty"`
+	Services            []aggregator.DimensionStats   `json:"services,omitempty"`
+}
 
-	text, ok := parts[0].(map[string]interface{})["text"].(string)
-	if !ok {
-		return "", fmt.Errorf("invalid text format in response: %s", string(body))
-	}
+func (s *AnalyticsService) callGeminiAPI(ctx context.Context, prompt string) (string, error) {
+	return s.generate(ctx, prompt, nil)
+}
 
-	return text, nil
+// callGeminiStructured is callGeminiAPI with Gemini's structured output:
+// the response is JSON constrained to schema, an OpenAPI-style schema
+// object.
+func (s *AnalyticsService) callGeminiStructured(ctx context.Context, prompt string, schema map[string]interface{}) (string, error) {
+	return s.generate(ctx, prompt, schema)
 }
 
-func (s *AnalyticsService) ConvertToCSV(logs []LogEntry) ([]byte, error) {
-	var buffer bytes.Buffer
-	writer := csv.NewWriter(&buffer)
+func (s *AnalyticsService) generate(ctx context.Context, prompt string, schema map[string]interface{}) (string, error) {
+	return s.generateWith(ctx, Model{Provider: ProviderGemini, Name: defaultGeminiModel}, prompt, schema)
+}
 
-	// Write header
-	header := []string{"timestamp", "level", "message", "path", "method", "duration", "status"}
-	if err := writer.Write(header); err != nil {
-		return nil, fmt.Errorf("error writing CSV header: %v", err)
+// generateWith sends prompt to model. Every call counts against the
+// request's LLM call limit, whatever the provider. The log data in prompt
+// has already been redacted by its builder.
+func (s *AnalyticsService) generateWith(ctx context.Context, model Model, prompt string, schema map[string]interface{}) (string, error) {
+	if err := consumeLLMCall(ctx); err != nil {
+		return "", err
 	}
+	prompt = languageInstructions(ctx) + prompt
 
-	// Write log entries
-	for _, log := range logs {
-		row := []string{
-			log.Timestamp,
-			log.Level,
-			log.Message,
-			log.Path,
-			log.Method,
-			strconv.FormatInt(log.Duration, 10),
-			strconv.Itoa(log.Status),
-		}
-		if err := writer.Write(row); err != nil {
-			return nil, fmt.Errorf("error writing CSV row: %v", err)
-		}
+	client := s.gemini
+	if model.Provider == ProviderOpenAI {
+		client = s.openAI
 	}
-
-	writer.Flush()
-	if err := writer.Error(); err != nil {
-		return nil, fmt.Errorf("error flushing CSV writer: %v", err)
+	if client == nil {
+		return "", fmt.Errorf("model %s is not configured", model)
 	}
-
-	return buffer.Bytes(), nil
+	reportProgress(ctx, ProgressModelCall, model.String())
+	resp, err := client.Generate(ctx, llm.Request{Model: model.Name, Prompt: prompt, Schema: schema})
+	if err != nil {
+		return "", err
+	}
+	recordModelUsage(ctx, model.Name, resp.InputTokens, resp.OutputTokens)
+	reportProgress(ctx, ProgressModelResponse, model.String())
+	return resp.Text, nil
 }
 
 func splitIntoChunks(text string, chunkSize int) []string {
@@ -0,0 +1,58 @@
+package analytics
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"analyticsai/ai-service/analytics/aggregator"
+)
+
+// AnalyzeJourneys sessionizes the logs, summarizes navigation, and asks
+// Gemini for UX insights.
+func (s *AnalyticsService) AnalyzeJourneys(ctx context.Context, logs []LogEntry, gap time.Duration) (*aggregator.JourneyReport, error) {
+	if err := CheckEntryLimit(ctx, len(logs)); err != nil {
+		return nil, err
+	}
+
+	report := aggregator.SummarizeJourneys(aggregator.BuildSessions(logs, gap))
+	if report.Sessions == 0 {
+		return report, nil
+	}
+
+	var summary strings.Builder
+	summary.WriteString(fmt.Sprintf("%d sessions, %.1f pages per session, %.0fs average duration, %.1f%% bounce rate\n",
+		report.Sessions, report.AvgPages, report.AvgDurationSec, report.BounceRate))
+	summary.WriteString("\nMost common journeys:\n")
+	for _, j := range report.CommonJourneys {
+		summary.WriteString(fmt.Sprintf("- %s (%d sessions)\n", untrusted(strings.Join(j.Steps, " -> ")), j.Sessions))
+	}
+	summary.WriteString("\nTop transitions:\n")
+	for _, t := range report.TopTransitions {
+		summary.WriteString(fmt.Sprintf("- %s -> %s: %d\n", untrusted(t.From), untrusted(t.To), t.Count))
+	}
+	summary.WriteString("\nExit pages:\n")
+	for _, e := range report.DropOffPoints {
+		summary.WriteString(fmt.Sprintf("- %s: %d exits of %d views (%.1f%%)\n", untrusted(e.Path), e.Exits, e.Views, e.ExitRate))
+	}
+
+	prompt := buildPrompt(s.instructions(PromptSessions, nil), "Journey Statistics", s.redact(ctx, summary.String()))
+
+	response, err := s.callGeminiAPI(ctx, prompt)
+	if err != nil {
+		return nil, fmt.Errorf("error generating analysis: %w", err)
+	}
+
+	var result struct {
+		UXInsights []string `json:"ux_insights"`
+	}
+	if err := decodeModelOutput(ctx, response, &result); err != nil {
+		return nil, err
+	}
+	if result.UXInsights != nil {
+		report.UXInsights = result.UXInsights
+	}
+
+	return report, nil
+}
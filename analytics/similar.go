@@ -0,0 +1,120 @@
+package analytics
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+)
+
+const (
+	similarIssueMinScore = 0.8
+	maxSimilarIssues     = 3
+)
+
+// SimilarIssue references an issue of an earlier analysis that resembles
+// a newly found one.
+type SimilarIssue struct {
+	Score       float64    `json:"score"`
+	DocumentID  string     `json:"document_id"`
+	AnalysisID  string     `json:"analysis_id,omitempty"`
+	Type        string     `json:"type"`
+	Description string     `json:"description"`
+	Severity    string     `json:"severity,omitempty"`
+	SeenAt      time.Time  `json:"seen_at"`
+	Resolution  string     `json:"resolution,omitempty"`
+	ResolvedAt  *time.Time `json:"resolved_at,omitempty"`
+	Reference   string     `json:"reference"` // e.g. "Seen on 2024-11-03 in analysis 1a2b…, resolved by: …"
+}
+
+func issueText(issue Issue) string {
+	return issue.Type + ": " + issue.Description
+}
+
+func similarIssue(m SemanticMatch) SimilarIssue {
+	doc := m.Document
+	issueType, description, _ := strings.Cut(doc.Text, ": ")
+	ref := "Seen on " + doc.IndexedAt.Format("2006-01-02")
+	if doc.AnalysisID != "" {
+		ref += " in analysis " + doc.AnalysisID
+	}
+	if doc.Resolution != "" {
+		ref += ", resolved by: " + doc.Resolution
+	} else {
+		ref += ", no resolution recorded"
+	}
+	return SimilarIssue{
+		Score:       m.Score,
+		DocumentID:  doc.ID,
+		AnalysisID:  doc.AnalysisID,
+		Type:        issueType,
+		Description: description,
+		Severity:    doc.Severity,
+		SeenAt:      doc.IndexedAt,
+		Resolution:  doc.Resolution,
+		ResolvedAt:  doc.ResolvedAt,
+		Reference:   ref,
+	}
+}
+
+// FindSimilarIssues sets SimilarPast on each issue to the most similar
+// issues indexed from the tenant's earlier analyses. All issues are
+// embedded in one call.
+func (s *AnalyticsService) FindSimilarIssues(ctx context.Context, idx *VectorIndex, tenant string, issues []Issue) error {
+	if len(issues) == 0 || !idx.hasKind(tenant, DocumentIssue) {
+		return nil
+	}
+	texts := make([]string, len(issues))
+	for i, issue := range issues {
+		texts[i] = issueText(issue)
+	}
+	vectors, err := s.Embed(ctx, texts, "RETRIEVAL_QUERY")
+	if err != nil {
+		return fmt.Errorf("error embedding issues: %w", err)
+	}
+	q := SemanticQuery{Kinds: []string{DocumentIssue}, Limit: maxSimilarIssues, MinScore: similarIssueMinScore}
+	for i := range issues {
+		issues[i].SimilarPast = nil
+		for _, m := range idx.search(tenant, vectors[i], q) {
+			issues[i].SimilarPast = append(issues[i].SimilarPast, similarIssue(m))
+		}
+	}
+	return nil
+}
+
+// hasKind reports whether the tenant has any documents of kind, saving an
+// embedding call when there is nothing to compare against.
+func (idx *VectorIndex) hasKind(tenant, kind string) bool {
+	idx.mu.Lock()
+	defer idx.mu.Unlock()
+	for _, doc := range idx.tenants[tenant] {
+		if doc.Kind == kind {
+			return true
+		}
+	}
+	return false
+}
+
+// Resolve records how the tenant's issue document id was resolved, so
+// later similar issues can point to the fix. It returns the document
+// without its vector, and false if the tenant has no such issue.
+func (idx *VectorIndex) Resolve(tenant, id, resolution string) (SemanticDocument, bool, error) {
+	idx.mu.Lock()
+	defer idx.mu.Unlock()
+	doc, ok := idx.tenants[tenant][id]
+	if !ok || doc.Kind != DocumentIssue {
+		return SemanticDocument{}, false, nil
+	}
+	doc.Resolution = strings.TrimSpace(resolution)
+	doc.ResolvedAt = nil
+	if doc.Resolution != "" {
+		now := time.Now().UTC()
+		doc.ResolvedAt = &now
+	}
+	if err := idx.save(tenant); err != nil {
+		return SemanticDocument{}, false, err
+	}
+	d := *doc
+	d.Vector = nil
+	return d, true, nil
+}
@@ -0,0 +1,66 @@
+package analytics
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"strings"
+
+	"analyticsai/ai-service/analytics/aggregator"
+)
+
+// AnalyzeSLO computes the SLO report and asks Gemini which endpoints
+// threaten the error budget most and what to do about them.
+func (s *AnalyticsService) AnalyzeSLO(ctx context.Context, logs []LogEntry, target aggregator.SLOTarget) (*aggregator.SLOReport, error) {
+	if err := CheckEntryLimit(ctx, len(logs)); err != nil {
+		return nil, err
+	}
+	if err := target.Validate(); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidInput, err)
+	}
+
+	report := aggregator.ComputeSLO(logs, target)
+
+	var summary strings.Builder
+	writeSLI := func(name string, sli aggregator.SLIReport) {
+		summary.WriteString(fmt.Sprintf("%s SLO: target %.2f%%, actual %.2f%%, budget consumed %.1f%%, burn rate %.1fx (%s) / %.1fx (%s)\n",
+			name, sli.Target, sli.Actual, sli.BudgetConsumed, sli.FastBurnRate, report.FastWindow, sli.SlowBurnRate, report.SlowWindow))
+	}
+	writeSLI("Availability", report.Availability)
+	if report.Latency != nil {
+		writeSLI(fmt.Sprintf("Latency (<= %dms)", target.LatencyMs), *report.Latency)
+	}
+	summary.WriteString("\nEndpoints by bad requests:\n")
+	for i, ep := range report.Endpoints {
+		if i == 10 || ep.BadRequests == 0 {
+			break
+		}
+		summary.WriteString(fmt.Sprintf("- %s: %d/%d bad, %.1f%% of budget burn, availability %.2f%%\n",
+			untrusted(ep.Path), ep.BadRequests, ep.Requests, ep.BudgetShare, ep.Availability))
+	}
+
+	if len(report.Services) > 0 {
+		writeServiceBudgetSummary(&summary, report.Services, report.FastWindow)
+	}
+
+	prompt := buildPrompt(s.instructions(PromptSLO, nil), "SLO Report", s.redact(ctx, summary.String()))
+
+	response, err := s.callGeminiAPI(ctx, prompt)
+	if err != nil {
+		return nil, fmt.Errorf("error generating analysis: %w", err)
+	}
+
+	var result struct {
+		Recommendations []string `json:"recommendations"`
+	}
+	if err := decodeModelOutput(ctx, response, &result); err != nil {
+		return nil, err
+	}
+	report.Recommendations = result.Recommendations
+
+	return report, nil
+}
+
+func round2(v float64) float64 {
+	return math.Round(v*100) / 100
+}
@@ -0,0 +1,97 @@
+package analytics
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"analyticsai/ai-service/analytics/aggregator"
+)
+
+// maxPromptTemplates caps the log templates written into a prompt.
+const maxPromptTemplates = 15
+
+// writeTimeSeriesSummary appends a compact view of the series to a prompt,
+// skipping empty buckets and capping the number of lines.
+func writeTimeSeriesSummary(summary *strings.Builder, series *aggregator.TimeSeries, maxLines int) {
+	summary.WriteString(fmt.Sprintf("\nTraffic per %s:\n", series.Interval))
+	lines := 0
+	for _, b := range series.Buckets {
+		if b.Requests == 0 {
+			continue
+		}
+		if lines == maxLines {
+			summary.WriteString("- ...\n")
+			break
+		}
+		summary.WriteString(fmt.Sprintf("- %s: %d requests, error rate %.1f%%, avg %dms, p95 %dms\n",
+			b.Start, b.Requests, b.ErrorRate, b.AvgDuration, b.P95Duration))
+		lines++
+	}
+}
+
+// writeTimezoneNote tells Gemini which zone the summary's times are in so
+// that time-of-day insights refer to the team's local time.
+func writeTimezoneNote(summary *strings.Builder, loc *time.Location) {
+	if loc == nil || loc == time.UTC {
+		return
+	}
+	summary.WriteString(fmt.Sprintf("\nAll times are local to %s; refer to times of day in that zone.\n", loc))
+}
+
+// writeAnomalySummary lists detected anomalies in a prompt so the model
+// explains them instead of having to spot them.
+func writeAnomalySummary(summary *strings.Builder, anomalies []aggregator.Anomaly) {
+	summary.WriteString("\nStatistically detected anomalies (z-score against moving baseline):\n")
+	for _, a := range anomalies {
+		summary.WriteString(fmt.Sprintf("- %s %s from %s to %s: %.1f (expected ~%.1f, z=%.1f)\n",
+			a.Path, a.Metric, a.Start, a.End, a.Value, a.Expected, a.ZScore))
+	}
+}
+
+// writeDimensionSummary appends per-value request, error and latency stats
+// to a prompt.
+func writeDimensionSummary(summary *strings.Builder, title string, stats []aggregator.DimensionStats, maxLines int) {
+	summary.WriteString(fmt.Sprintf("\n%s:\n", title))
+	for i, s := range stats {
+		if i == maxLines {
+			break
+		}
+		summary.WriteString(fmt.Sprintf("- %s: %d requests, error rate %.1f%%, avg %dms, p95 %dms\n",
+			untrusted(s.Value), s.Requests, s.ErrorRate, s.AvgDuration, s.P95Duration))
+	}
+}
+
+// writeServiceBudgetSummary writes one line per service budget.
+func writeServiceBudgetSummary(summary *strings.Builder, budgets []aggregator.ServiceBudget, window string) {
+	summary.WriteString("\nError budget by service:\n")
+	for _, b := range budgets {
+		summary.WriteString(fmt.Sprintf("- %s: availability %.2f%% (target %.2f%%), budget consumed %.1f%%, burn rate %.1fx (%s), %.1f%% of platform bad requests\n",
+			untrusted(b.Service), b.Availability.Actual, b.Availability.Target, b.Availability.BudgetConsumed, b.Availability.FastBurnRate, window, b.BudgetShare))
+	}
+}
+
+// formatLevels writes level counts as "error 3, info 10", most frequent
+// first.
+func formatLevels(levels map[string]int) string {
+	keys := topKeys(levels, len(levels))
+	parts := make([]string, len(keys))
+	for i, level := range keys {
+		parts[i] = fmt.Sprintf("%s %d", level, levels[level])
+	}
+	return strings.Join(parts, ", ")
+}
+
+// writeTemplateSummary writes the level distribution and the n most
+// frequent message templates.
+func writeTemplateSummary(summary *strings.Builder, report *aggregator.TemplateReport, n int) {
+	summary.WriteString(fmt.Sprintf("\nLog levels: %s\n", untrusted(formatLevels(report.Levels))))
+	summary.WriteString(fmt.Sprintf("\nMessage templates (%d distinct, <*> marks variable parts), most frequent first:\n", report.TemplateCount))
+	for i, t := range report.Templates {
+		if i == n {
+			break
+		}
+		summary.WriteString(fmt.Sprintf("- %s: %d entries (%.1f%%; %s): %s\n",
+			t.ID, t.Count, t.Share, untrusted(formatLevels(t.Levels)), untrusted(t.Template)))
+	}
+}
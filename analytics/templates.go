@@ -0,0 +1,444 @@
+package analytics
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"text/template"
+	"time"
+)
+
+// Prompt template names.
+const (
+	PromptLogAnalysis         = "log_analysis"
+	PromptPerformanceAnalysis = "performance_analysis"
+	PromptCapacity            = "capacity"
+	PromptComparison          = "comparison"
+	PromptConversation        = "conversation"
+	PromptDependencies        = "dependencies"
+	PromptErrorClusters       = "error_clusters"
+	PromptForecast            = "forecast"
+	PromptFunnel              = "funnel"
+	PromptHeatmap             = "heatmap"
+	PromptRootCause           = "root_cause"
+	PromptSecurity            = "security"
+	PromptSEO                 = "seo"
+	PromptSessions            = "sessions"
+	PromptSLO                 = "slo"
+	PromptTrends              = "trends"
+)
+
+const maxPromptVersions = 50 // versions kept per template
+
+// builtinPrompt is the task description a prompt ships with. Only the task
+// can be changed through the registry: the JSON structure the response
+// must follow is appended by the code that decodes it.
+type builtinPrompt struct {
+	description string
+	params      []string // template fields available to the text, e.g. {{.Interval}}
+	sample      map[string]string
+	text        string
+	format      string // the JSON structure of the response
+}
+
+var builtinPrompts = map[string]builtinPrompt{
+	PromptLogAnalysis: {
+		description: "Insights, issues and popular and slow pages of a log summary (/analyze/logs, /upload).",
+		text:        "Analyze this log summary and provide insights. If device, browser or OS breakdowns are present, include insights on latency or error differences between them.",
+		format: `{
+    "popular_pages": ["page1", "page2"],
+    "slow_pages": [{"path": "/example", "avg_duration": 1000, "request_count": 10, "error_rate": 5.0}],
+    "potential_issues": [{"type": "security", "description": "desc", "severity": "high", "category": "security", "path": ["/example"], "confidence": 0.8, "evidence": [{"path": "/example", "start": "2024-04-06T10:00:00Z", "end": "2024-04-06T11:00:00Z", "metric": "error_rate", "value": 12.5}]}],
+    "insights": [{"text": "insight1", "category": "performance", "confidence": 0.9, "evidence": [{"path": "/example", "metric": "p95_duration", "value": 1200}]}]
+}` + evidenceInstructions,
+	},
+	PromptPerformanceAnalysis: {
+		description: "Slow endpoints, patterns, resource issues and recommendations (/analyze/performance).",
+		text:        "Analyze this performance data and provide insights.",
+		format: `{
+    "slow_endpoints": [{"path": "/example", "avg_duration": 1000, "request_count": 10, "error_rate": 5.0}],
+    "performance_patterns": ["pattern1", "pattern2"],
+    "resource_issues": [{"type": "resource", "description": "High memory usage", "severity": "high", "category": "cost", "path": ["/example"], "confidence": 0.6, "evidence": [{"path": "/example", "metric": "avg_duration", "value": 1000}]}],
+    "recommendations": ["recommendation1", "recommendation2"]
+}` + evidenceInstructions,
+	},
+	PromptCapacity: {
+		description: "Scaling recommendations from per-service capacity estimates (/analyze/capacity).",
+		text:        "These capacity estimates come from fitting p95 latency against throughput per service and extrapolating to the latency target. Summarize the headroom of each service and recommend scaling actions, naming the throughput at which each service saturates (for example \"checkout saturates around 450 rps\"). Treat estimates with weak correlation as uncertain, and don't contradict the computed numbers.",
+		format: `{
+    "summary": "summary",
+    "recommendations": ["recommendation1", "recommendation2"]
+}`,
+	},
+	PromptComparison: {
+		description: "Regression verdict for logs before and after a change (/analyze/compare).",
+		text:        `These are two sets of web logs, before and after a change such as a deploy. Decide whether the change regressed latency, errors or traffic, taking traffic shifts into account. The verdict must be one of "regressed", "no_regression", "improved" or "inconclusive".`,
+		format: `{
+    "verdict": "regressed",
+    "explanation": "why",
+    "concerns": ["concern1", "concern2"]
+}`,
+	},
+	PromptConversation: {
+		description: "Answers to follow-up questions about an analysis (/conversations).",
+		text:        "You are answering an engineer's questions about an analysis of their web service's logs. Answer the question below using only the analysis data, and say so when the data doesn't contain the answer. Follow-up questions may refer to earlier answers in the conversation. Be specific: name endpoints, times and numbers.",
+		format: `{
+    "answer": "answer",
+    "suggested_questions": ["follow-up question"]
+}`,
+	},
+	PromptErrorClusters: {
+		description: "Probable causes of clusters of similar error messages (/analyze/errors).",
+		text:        "These are clusters of similar error log messages. For each cluster, give the most probable root cause in one or two sentences.",
+		format: `{
+    "clusters": [{"id": "c1", "probable_cause": "cause"}]
+}`,
+	},
+	PromptDependencies: {
+		description: "Fragile hotspots of the inferred service dependency graph (/analyze/dependencies).",
+		text:        "This is a service dependency graph inferred from logs: calls named in upstream/downstream metadata or in request paths, and dependencies whose errors precede their callers' errors. Identify the fragile hotspots, such as failing nodes many others depend on, single points of failure and error cascades, explain the risk each poses and recommend how to make the system more resilient.",
+		format: `{
+    "summary": "overall assessment",
+    "hotspots": [{"node": "payments", "risk": "high", "reason": "why it is fragile", "recommendation": "what to do"}]
+}`,
+	},
+	PromptForecast: {
+		description: "Commentary on expected traffic peaks in a seasonal forecast (/forecast).",
+		text:        "This is a seasonal traffic forecast projected from past request counts. Comment on the expected peaks: when they occur, how high they may go within the band, how they compare with the rest of the period, and what to prepare for them. Mention when the fit error or band width makes the forecast unreliable.",
+		format: `{
+    "commentary": "commentary"
+}`,
+	},
+	PromptFunnel: {
+		description: "Drop-off hypotheses for a conversion funnel (/analyze/funnel).",
+		text:        "Analyze this conversion funnel built from web logs. Give hypotheses for why users drop off at the biggest leaks and what to test to fix them.",
+		format: `{
+    "hypotheses": ["hypothesis1", "hypothesis2"]
+}`,
+	},
+	PromptHeatmap: {
+		description: "Commentary on the weekly traffic heatmap (/stats/heatmap).",
+		text:        "Analyze this weekly traffic heatmap. Comment on peak traffic windows, error rate patterns by time, and which windows are safest for maintenance.",
+		format: `{
+    "commentary": ["observation1", "observation2"]
+}`,
+	},
+	PromptRootCause: {
+		description: "Causal hypothesis chains from correlated signals (/analyze/root-cause).",
+		params:      []string{"Interval"},
+		sample:      map[string]string{"Interval": "5m"},
+		text:        `These are statistically correlated error and latency signals between endpoints, measured in {{.Interval}} buckets. "A leads B by lag" means spikes in A are followed by spikes in B. Build the most plausible causal hypothesis chains, from root cause to symptoms, citing correlation IDs as evidence.`,
+		format: `{
+    "hypotheses": [{"chain": ["/payment latency spike", "/checkout 500 errors"], "explanation": "why", "confidence": "high", "evidence": ["r1"]}]
+}`,
+	},
+	PromptSecurity: {
+		description: "Threat assessment and mitigations (/analyze/security).",
+		text:        "You are a security analyst. Assess these threats detected in web server logs and give prioritized, concrete mitigation recommendations.",
+		format: `{
+    "assessment": "overall assessment",
+    "recommendations": ["recommendation1", "recommendation2"]
+}`,
+	},
+	PromptSEO: {
+		description: "SEO assessment and fixes for crawl and indexing problems (/analyze/seo).",
+		text:        "You are an SEO specialist. Assess these findings from web server logs, covering broken links, redirect chains, errors on indexed pages and crawler activity, and give prioritized fixes the marketing and web teams can act on.",
+		format: `{
+    "assessment": "overall assessment",
+    "recommendations": ["recommendation1", "recommendation2"]
+}`,
+	},
+	PromptSessions: {
+		description: "UX insights from user journeys (/analyze/journeys).",
+		text:        "Analyze these user navigation statistics from web logs and give UX insights: where users get stuck or leave, and what to improve.",
+		format: `{
+    "ux_insights": ["insight1", "insight2"]
+}`,
+	},
+	PromptSLO: {
+		description: "Fix-first recommendations from an SLO report (/analyze/slo).",
+		text:        "Given this SLO and error budget report, recommend which endpoints to fix first to protect the error budget and how.",
+		format: `{
+    "recommendations": ["recommendation1", "recommendation2"]
+}`,
+	},
+	PromptTrends: {
+		description: "Commentary on metrics across successive analyses (/analyses/trends).",
+		text:        "These metrics come from successive analyses of the same log source, oldest first. Describe the trajectory: whether the service is getting healthier or worse, which endpoints drive the change, and what to look into next.",
+		format: `{
+    "commentary": "commentary"
+}`,
+	},
+}
+
+// outputInstructions introduces the JSON structure a response must follow.
+func outputInstructions(task, format string) string {
+	return task + " Return ONLY a JSON object with this exact structure (no markdown, no backticks):\n" + format
+}
+
+// instructions returns the instructions of the prompt name: its active task
+// text rendered with params, followed by the JSON structure of the response.
+func (s *AnalyticsService) instructions(name string, params map[string]string) string {
+	return outputInstructions(s.prompts.task(name, params), builtinPrompts[name].format)
+}
+
+// PromptVersion is one revision of a prompt template's task text.
+type PromptVersion struct {
+	Version   int       `json:"version"`
+	Text      string    `json:"text"`
+	Comment   string    `json:"comment,omitempty"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// PromptTemplate describes a prompt and its revisions. Version 0 is the
+// built-in text, which is active until another version is.
+type PromptTemplate struct {
+	Name          string          `json:"name"`
+	Description   string          `json:"description"`
+	Params        []string        `json:"params,omitempty"`
+	ActiveVersion int             `json:"active_version"`
+	Text          string          `json:"text"` // the active text
+	Builtin       string          `json:"builtin"`
+	Versions      []PromptVersion `json:"versions"`
+}
+
+type promptState struct {
+	Active   int             `json:"active"`
+	Versions []PromptVersion `json:"versions"`
+}
+
+// PromptRegistry holds the revisions of the prompt templates, optionally
+// backed by a JSON file, so prompts can be tuned without a deploy.
+type PromptRegistry struct {
+	mu     sync.RWMutex
+	path   string
+	states map[string]*promptState
+}
+
+// NewPromptRegistry loads prompt revisions from path. An empty path or a
+// missing file yields the built-in prompts; updates are written back when
+// path is set.
+func NewPromptRegistry(path string) (*PromptRegistry, error) {
+	r := &PromptRegistry{path: path, states: make(map[string]*promptState)}
+	if path == "" {
+		return r, nil
+	}
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return r, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("error reading prompts file: %v", err)
+	}
+	if err := json.Unmarshal(data, &r.states); err != nil {
+		return nil, fmt.Errorf("error parsing prompts file: %v", err)
+	}
+	for name, state := range r.states {
+		if _, ok := builtinPrompts[name]; !ok {
+			return nil, fmt.Errorf("prompts file: unknown prompt %q", name)
+		}
+		for _, v := range state.Versions {
+			if _, err := renderPrompt(name, v.Text, builtinPrompts[name].sample); err != nil {
+				return nil, fmt.Errorf("prompt %q version %d: %v", name, v.Version, err)
+			}
+		}
+	}
+	return r, nil
+}
+
+func (r *PromptRegistry) save() error {
+	if r.path == "" {
+		return nil
+	}
+	data, err := json.MarshalIndent(r.states, "", "  ")
+	if err != nil {
+		return fmt.Errorf("error marshaling prompts: %v", err)
+	}
+	if err := os.WriteFile(r.path, data, 0644); err != nil {
+		return fmt.Errorf("error writing prompts file: %v", err)
+	}
+	return nil
+}
+
+// renderPrompt executes text with params, failing on unknown fields.
+func renderPrompt(name, text string, params map[string]string) (string, error) {
+	if strings.TrimSpace(text) == "" {
+		return "", fmt.Errorf("%w: prompt text is empty", ErrInvalidInput)
+	}
+	tmpl, err := template.New(name).Option("missingkey=error").Parse(text)
+	if err != nil {
+		return "", fmt.Errorf("%w: %v", ErrInvalidInput, err)
+	}
+	if params == nil {
+		params = map[string]string{}
+	}
+	var b strings.Builder
+	if err := tmpl.Execute(&b, params); err != nil {
+		return "", fmt.Errorf("%w: %v", ErrInvalidInput, err)
+	}
+	return b.String(), nil
+}
+
+// activeText returns the active text of name.
+func (r *PromptRegistry) activeText(name string) string {
+	if r == nil {
+		return builtinPrompts[name].text
+	}
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return r.active(name)
+}
+
+// active returns the active text of name; the caller holds r.mu.
+func (r *PromptRegistry) active(name string) string {
+	if state, ok := r.states[name]; ok {
+		for _, v := range state.Versions {
+			if v.Version == state.Active {
+				return v.Text
+			}
+		}
+	}
+	return builtinPrompts[name].text
+}
+
+// task renders the active task text of name with params. A nil registry
+// uses the built-in prompts, as does a revision that fails to render.
+func (r *PromptRegistry) task(name string, params map[string]string) string {
+	text, err := renderPrompt(name, r.activeText(name), params)
+	if err != nil {
+		text, _ = renderPrompt(name, builtinPrompts[name].text, params)
+	}
+	return text
+}
+
+// describe returns the template name; the caller holds r.mu.
+func (r *PromptRegistry) describe(name string) PromptTemplate {
+	builtin := builtinPrompts[name]
+	t := PromptTemplate{
+		Name:        name,
+		Description: builtin.description,
+		Params:      builtin.params,
+		Text:        r.active(name),
+		Builtin:     builtin.text,
+		Versions:    []PromptVersion{},
+	}
+	if state, ok := r.states[name]; ok {
+		t.ActiveVersion = state.Active
+		t.Versions = append(t.Versions, state.Versions...)
+	}
+	return t
+}
+
+// List returns every prompt template, by name.
+func (r *PromptRegistry) List() []PromptTemplate {
+	names := make([]string, 0, len(builtinPrompts))
+	for name := range builtinPrompts {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	list := make([]PromptTemplate, 0, len(names))
+	for _, name := range names {
+		t := r.describe(name)
+		t.Versions = nil
+		list = append(list, t)
+	}
+	return list
+}
+
+// Get returns the named template with its revisions.
+func (r *PromptRegistry) Get(name string) (PromptTemplate, bool) {
+	if _, ok := builtinPrompts[name]; !ok {
+		return PromptTemplate{}, false
+	}
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return r.describe(name), true
+}
+
+// Update stores text as a new version of name and activates it. Only the
+// oldest revisions beyond maxPromptVersions are dropped.
+func (r *PromptRegistry) Update(name, text, comment string) (PromptTemplate, error) {
+	builtin, ok := builtinPrompts[name]
+	if !ok {
+		return PromptTemplate{}, fmt.Errorf("%w: unknown prompt %q", ErrInvalidInput, name)
+	}
+	if _, err := renderPrompt(name, text, builtin.sample); err != nil {
+		return PromptTemplate{}, err
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	state, ok := r.states[name]
+	if !ok {
+		state = &promptState{}
+		r.states[name] = state
+	}
+	version := 1
+	if n := len(state.Versions); n > 0 {
+		version = state.Versions[n-1].Version + 1
+	}
+	state.Versions = append(state.Versions, PromptVersion{
+		Version:   version,
+		Text:      text,
+		Comment:   strings.TrimSpace(comment),
+		CreatedAt: time.Now().UTC(),
+	})
+	if len(state.Versions) > maxPromptVersions {
+		state.Versions = state.Versions[len(state.Versions)-maxPromptVersions:]
+	}
+	state.Active = version
+	return r.describe(name), r.save()
+}
+
+// Rollback activates an earlier version of name; version 0 restores the
+// built-in text.
+func (r *PromptRegistry) Rollback(name string, version int) (PromptTemplate, error) {
+	if _, ok := builtinPrompts[name]; !ok {
+		return PromptTemplate{}, fmt.Errorf("%w: unknown prompt %q", ErrInvalidInput, name)
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	state, ok := r.states[name]
+	if !ok {
+		state = &promptState{}
+		r.states[name] = state
+	}
+	found := version == 0
+	for _, v := range state.Versions {
+		if v.Version == version {
+			found = true
+		}
+	}
+	if !found {
+		return PromptTemplate{}, fmt.Errorf("%w: prompt %q has no version %d", ErrInvalidInput, name, version)
+	}
+	state.Active = version
+	return r.describe(name), r.save()
+}
+
+// Preview renders the full prompt name would send with data in place of
+// the log-derived summary. Text, when set, previews a candidate revision
+// instead of the active one; params default to sample values.
+func (r *PromptRegistry) Preview(name, text string, params map[string]string, data string) (string, error) {
+	builtin, ok := builtinPrompts[name]
+	if !ok {
+		return "", fmt.Errorf("%w: unknown prompt %q", ErrInvalidInput, name)
+	}
+	if text == "" {
+		text = r.activeText(name)
+	}
+	if params == nil {
+		params = builtin.sample
+	}
+	task, err := renderPrompt(name, text, params)
+	if err != nil {
+		return "", err
+	}
+	return buildPrompt(outputInstructions(task, builtin.format), "Sample Data", data), nil
+}
@@ -0,0 +1,63 @@
+package analytics
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"analyticsai/ai-service/analytics/aggregator"
+)
+
+const maxTrendEndpoints = 20 // endpoint trends reported per direction
+
+// AnalyzeTrends compares stored analyses of one source and asks Gemini for
+// commentary on the trajectory. points must be ordered oldest first.
+func (s *AnalyticsService) AnalyzeTrends(ctx context.Context, source, kind string, points []aggregator.TrendPoint) (*aggregator.TrendReport, error) {
+	if len(points) < 2 {
+		return nil, fmt.Errorf("%w: at least two stored analyses of source %q are needed, found %d", ErrInvalidInput, source, len(points))
+	}
+	report := aggregator.ComputeTrend(points)
+	report.Source = source
+	report.Kind = kind
+	if len(report.Regressed) > maxTrendEndpoints {
+		report.Regressed = report.Regressed[:maxTrendEndpoints]
+	}
+	if len(report.Improved) > maxTrendEndpoints {
+		report.Improved = report.Improved[:maxTrendEndpoints]
+	}
+
+	var summary strings.Builder
+	summary.WriteString(fmt.Sprintf("%d analyses from %s to %s\n", len(points),
+		points[0].CreatedAt.Format(time.RFC3339), points[len(points)-1].CreatedAt.Format(time.RFC3339)))
+	for _, m := range report.Metrics {
+		values := make([]string, len(m.Values))
+		for i, v := range m.Values {
+			values[i] = fmt.Sprintf("%g", v)
+		}
+		summary.WriteString(fmt.Sprintf("- %s: %s (%s)\n", m.Metric, strings.Join(values, " -> "), m.Direction))
+	}
+	for _, e := range report.Regressed {
+		summary.WriteString(fmt.Sprintf("- regressed %s: error rate %+.2f pp, p95 %+dms\n", untrusted(e.Path), e.ErrorRate, e.P95))
+	}
+	for _, e := range report.Improved {
+		summary.WriteString(fmt.Sprintf("- improved %s: error rate %+.2f pp, p95 %+dms\n", untrusted(e.Path), e.ErrorRate, e.P95))
+	}
+
+	prompt := buildPrompt(s.instructions(PromptTrends, nil), "Trend", s.redact(ctx, summary.String()))
+
+	response, err := s.callGeminiAPI(ctx, prompt)
+	if err != nil {
+		return nil, fmt.Errorf("error generating analysis: %w", err)
+	}
+
+	var result struct {
+		Commentary string `json:"commentary"`
+	}
+	if err := decodeModelOutput(ctx, response, &result); err != nil {
+		return nil, err
+	}
+	report.Commentary = result.Commentary
+
+	return report, nil
+}
@@ -0,0 +1,107 @@
+package analytics
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sort"
+)
+
+// ModelUsage counts the calls made to a model and the tokens they used.
+type ModelUsage struct {
+	Calls        int `json:"calls"`
+	InputTokens  int `json:"input_tokens"`
+	OutputTokens int `json:"output_tokens"`
+}
+
+// Add returns the sum of u and v.
+func (u ModelUsage) Add(v ModelUsage) ModelUsage {
+	return ModelUsage{Calls: u.Calls + v.Calls, InputTokens: u.InputTokens + v.InputTokens, OutputTokens: u.OutputTokens + v.OutputTokens}
+}
+
+// recordModelUsage adds a call to model, with the tokens the provider
+// reported for it, to the request's usage tally in ctx.
+func recordModelUsage(ctx context.Context, model string, inputTokens, outputTokens int) {
+	b, ok := ctx.Value(budgetKey{}).(*budget)
+	if !ok {
+		return
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.models == nil {
+		b.models = make(map[string]ModelUsage)
+	}
+	b.models[model] = b.models[model].Add(ModelUsage{Calls: 1, InputTokens: inputTokens, OutputTokens: outputTokens})
+}
+
+// ModelUsageFromContext returns the model calls made on behalf of the
+// request carrying ctx, by model.
+func ModelUsageFromContext(ctx context.Context) map[string]ModelUsage {
+	b, ok := ctx.Value(budgetKey{}).(*budget)
+	if !ok {
+		return nil
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if len(b.models) == 0 {
+		return nil
+	}
+	usage := make(map[string]ModelUsage, len(b.models))
+	for model, u := range b.models {
+		usage[model] = u
+	}
+	return usage
+}
+
+// ModelPrice is the price of a model in US dollars per million tokens.
+type ModelPrice struct {
+	Input  float64 `json:"input"`
+	Output float64 `json:"output"`
+}
+
+// DefaultModelPrices are the list prices of the models the service calls
+// by default. Embeddings are free of charge.
+var DefaultModelPrices = map[string]ModelPrice{
+	defaultGeminiModel: {Input: 0.10, Output: 0.40},
+	embeddingModel:     {},
+}
+
+// ParseModelPrices parses a JSON object mapping model names to ModelPrice,
+// and returns DefaultModelPrices overridden by it.
+func ParseModelPrices(raw string) (map[string]ModelPrice, error) {
+	prices := make(map[string]ModelPrice, len(DefaultModelPrices))
+	for model, price := range DefaultModelPrices {
+		prices[model] = price
+	}
+	if raw == "" {
+		return prices, nil
+	}
+	var overrides map[string]ModelPrice
+	if err := json.Unmarshal([]byte(raw), &overrides); err != nil {
+		return nil, fmt.Errorf("invalid model prices: %v", err)
+	}
+	for model, price := range overrides {
+		if price.Input < 0 || price.Output < 0 {
+			return nil, fmt.Errorf("invalid model prices: %s has a negative price", model)
+		}
+		prices[model] = price
+	}
+	return prices, nil
+}
+
+// EstimateCost returns the cost in US dollars of usage at prices, and the
+// models used that have no price and so are left out of it.
+func EstimateCost(usage map[string]ModelUsage, prices map[string]ModelPrice) (float64, []string) {
+	var cost float64
+	var unpriced []string
+	for model, u := range usage {
+		price, ok := prices[model]
+		if !ok {
+			unpriced = append(unpriced, model)
+			continue
+		}
+		cost += (float64(u.InputTokens)*price.Input + float64(u.OutputTokens)*price.Output) / 1e6
+	}
+	sort.Strings(unpriced)
+	return cost, unpriced
+}
@@ -0,0 +1,506 @@
+// Package bigquery exports log entries and analysis results to BigQuery
+// tables through its REST API.
+package bigquery
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"net/textproto"
+	"net/url"
+	"os"
+	"sort"
+	"sync"
+	"time"
+
+	"analyticsai/ai-service/analytics"
+	"analyticsai/ai-service/analytics/aggregator"
+	"analyticsai/ai-service/analytics/parser"
+)
+
+const (
+	metadataTokenURL = "http://metadata.google.internal/computeMetadata/v1/instance/service-accounts/default/token"
+
+	// insertBatchSize is the rows per streaming insert request, as
+	// BigQuery recommends.
+	insertBatchSize = 500
+)
+
+// apiURL is the BigQuery API root.
+var apiURL = "https://bigquery.googleapis.com"
+
+var client = &http.Client{Timeout: 2 * time.Minute}
+
+// Export modes.
+const (
+	ModeStream = "stream" // tabledata.insertAll; rows are queryable at once
+	ModeLoad   = "load"   // load jobs; free, but applied asynchronously
+)
+
+// Exporter writes to the logs and analyses tables of one dataset.
+type Exporter struct {
+	Project       string
+	Dataset       string
+	LogsTable     string
+	AnalysesTable string
+	Mode          string
+
+	mu      sync.Mutex
+	created map[string]bool // tables known to exist
+}
+
+// FromEnv configures an exporter from BIGQUERY_DATASET, BIGQUERY_PROJECT
+// (default GOOGLE_CLOUD_PROJECT), BIGQUERY_LOGS_TABLE, BIGQUERY_ANALYSES_TABLE
+// and BIGQUERY_MODE. It returns nil when no dataset is set.
+func FromEnv() (*Exporter, error) {
+	dataset := os.Getenv("BIGQUERY_DATASET")
+	if dataset == "" {
+		return nil, nil
+	}
+	e := &Exporter{
+		Project:       os.Getenv("BIGQUERY_PROJECT"),
+		Dataset:       dataset,
+		LogsTable:     os.Getenv("BIGQUERY_LOGS_TABLE"),
+		AnalysesTable: os.Getenv("BIGQUERY_ANALYSES_TABLE"),
+		Mode:          os.Getenv("BIGQUERY_MODE"),
+		created:       make(map[string]bool),
+	}
+	if e.Project == "" {
+		e.Project = os.Getenv("GOOGLE_CLOUD_PROJECT")
+	}
+	if e.Project == "" {
+		return nil, fmt.Errorf("BIGQUERY_PROJECT or GOOGLE_CLOUD_PROJECT is required with BIGQUERY_DATASET")
+	}
+	if e.LogsTable == "" {
+		e.LogsTable = "log_entries"
+	}
+	if e.AnalysesTable == "" {
+		e.AnalysesTable = "analyses"
+	}
+	if e.Mode == "" {
+		e.Mode = ModeStream
+	}
+	if e.Mode != ModeStream && e.Mode != ModeLoad {
+		return nil, fmt.Errorf("BIGQUERY_MODE must be %s or %s", ModeStream, ModeLoad)
+	}
+	return e, nil
+}
+
+type field struct {
+	Name   string  `json:"name"`
+	Type   string  `json:"type"`
+	Mode   string  `json:"mode,omitempty"`
+	Fields []field `json:"fields,omitempty"`
+}
+
+var logsSchema = []field{
+	{Name: "tenant", Type: "STRING", Mode: "REQUIRED"},
+	{Name: "analysis_id", Type: "STRING"},
+	{Name: "source", Type: "STRING"},
+	{Name: "timestamp", Type: "TIMESTAMP"},
+	{Name: "raw_timestamp", Type: "STRING"},
+	{Name: "level", Type: "STRING"},
+	{Name: "message", Type: "STRING"},
+	{Name: "path", Type: "STRING"},
+	{Name: "method", Type: "STRING"},
+	{Name: "duration", Type: "INTEGER"},
+	{Name: "status", Type: "INTEGER"},
+	{Name: "metadata", Type: "RECORD", Mode: "REPEATED", Fields: []field{
+		{Name: "key", Type: "STRING"},
+		{Name: "value", Type: "STRING"},
+	}},
+	{Name: "exported_at", Type: "TIMESTAMP", Mode: "REQUIRED"},
+}
+
+var analysesSchema = []field{
+	{Name: "tenant", Type: "STRING", Mode: "REQUIRED"},
+	{Name: "analysis_id", Type: "STRING"},
+	{Name: "kind", Type: "STRING"},
+	{Name: "source", Type: "STRING"},
+	{Name: "entries", Type: "INTEGER"},
+	{Name: "requests", Type: "INTEGER"},
+	{Name: "error_rate", Type: "FLOAT"},
+	{Name: "avg_duration", Type: "INTEGER"},
+	{Name: "p95_duration", Type: "INTEGER"},
+	{Name: "slow_endpoints", Type: "INTEGER"},
+	{Name: "issues", Type: "INTEGER"},
+	{Name: "result", Type: "STRING"}, // the JSON-encoded analysis result
+	{Name: "exported_at", Type: "TIMESTAMP", Mode: "REQUIRED"},
+}
+
+// partitionField is the column each table is partitioned by day on.
+var partitionField = map[string]string{"logs": "timestamp", "analyses": "exported_at"}
+
+type metadataPair struct {
+	Key   string `json:"key"`
+	Value string `json:"value"`
+}
+
+type logRow struct {
+	Tenant       string         `json:"tenant"`
+	AnalysisID   string         `json:"analysis_id,omitempty"`
+	Source       string         `json:"source,omitempty"`
+	Timestamp    string         `json:"timestamp,omitempty"`
+	RawTimestamp string         `json:"raw_timestamp"`
+	Level        string         `json:"level"`
+	Message      string         `json:"message"`
+	Path         string         `json:"path"`
+	Method       string         `json:"method"`
+	Duration     int64          `json:"duration"`
+	Status       int            `json:"status"`
+	Metadata     []metadataPair `json:"metadata"`
+	ExportedAt   string         `json:"exported_at"`
+}
+
+type analysisRow struct {
+	Tenant        string  `json:"tenant"`
+	AnalysisID    string  `json:"analysis_id,omitempty"`
+	Kind          string  `json:"kind"`
+	Source        string  `json:"source,omitempty"`
+	Entries       int     `json:"entries"`
+	Requests      int     `json:"requests"`
+	ErrorRate     float64 `json:"error_rate"`
+	AvgDuration   int64   `json:"avg_duration"`
+	P95Duration   int64   `json:"p95_duration"`
+	SlowEndpoints int     `json:"slow_endpoints"`
+	Issues        int     `json:"issues"`
+	Result        string  `json:"result"`
+	ExportedAt    string  `json:"exported_at"`
+}
+
+// Batch is one analysis and the log entries it was run on.
+type Batch struct {
+	Tenant     string
+	AnalysisID string // empty when the analysis isn't stored
+	Kind       string
+	Source     string
+	Logs       []analytics.LogEntry
+	Metrics    *aggregator.MetricsSnapshot
+	Result     interface{}
+}
+
+// Summary reports what Export wrote: the rows inserted, or the load jobs
+// started.
+type Summary struct {
+	Mode         string   `json:"mode"`
+	LogRows      int      `json:"log_rows"`
+	AnalysisRows int      `json:"analysis_rows"`
+	Jobs         []string `json:"jobs,omitempty"`
+}
+
+func (e *Exporter) rows(b Batch) ([]interface{}, []interface{}, error) {
+	now := time.Now().UTC().Format(time.RFC3339Nano)
+	logs := make([]interface{}, len(b.Logs))
+	for i, log := range b.Logs {
+		row := logRow{
+			Tenant:       b.Tenant,
+			AnalysisID:   b.AnalysisID,
+			Source:       b.Source,
+			RawTimestamp: log.Timestamp,
+			Level:        log.Level,
+			Message:      log.Message,
+			Path:         log.Path,
+			Method:       log.Method,
+			Duration:     log.Duration,
+			Status:       log.Status,
+			Metadata:     []metadataPair{},
+			ExportedAt:   now,
+		}
+		if t, ok := parser.ParseTimestamp(log.Timestamp); ok {
+			row.Timestamp = t.UTC().Format(time.RFC3339Nano)
+		}
+		for key, value := range log.Metadata {
+			row.Metadata = append(row.Metadata, metadataPair{key, value})
+		}
+		sort.Slice(row.Metadata, func(i, j int) bool { return row.Metadata[i].Key < row.Metadata[j].Key })
+		logs[i] = row
+	}
+
+	result, err := json.Marshal(b.Result)
+	if err != nil {
+		return nil, nil, fmt.Errorf("error encoding analysis result: %v", err)
+	}
+	m := b.Metrics
+	analysis := analysisRow{
+		Tenant:        b.Tenant,
+		AnalysisID:    b.AnalysisID,
+		Kind:          b.Kind,
+		Source:        b.Source,
+		Entries:       len(b.Logs),
+		Requests:      m.Requests,
+		ErrorRate:     m.ErrorRate,
+		AvgDuration:   m.AvgDuration,
+		P95Duration:   m.P95Duration,
+		SlowEndpoints: m.SlowEndpoints,
+		Issues:        m.Issues,
+		Result:        string(result),
+		ExportedAt:    now,
+	}
+	return logs, []interface{}{analysis}, nil
+}
+
+// Export writes the batch's log entries to the logs table and a summary of
+// its analysis to the analyses table.
+func (e *Exporter) Export(ctx context.Context, b Batch) (*Summary, error) {
+	logs, analyses, err := e.rows(b)
+	if err != nil {
+		return nil, err
+	}
+	token, err := metadataToken(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("error getting access token: %v", err)
+	}
+
+	summary := &Summary{Mode: e.Mode}
+	tables := []struct {
+		kind, table string
+		schema      []field
+		rows        []interface{}
+		count       *int
+	}{
+		{"logs", e.LogsTable, logsSchema, logs, &summary.LogRows},
+		{"analyses", e.AnalysesTable, analysesSchema, analyses, &summary.AnalysisRows},
+	}
+	for _, t := range tables {
+		if len(t.rows) == 0 {
+			continue
+		}
+		if e.Mode == ModeLoad {
+			job, err := e.load(ctx, token, t.kind, t.table, t.schema, t.rows)
+			if err != nil {
+				return summary, fmt.Errorf("error loading %s: %v", t.table, err)
+			}
+			summary.Jobs = append(summary.Jobs, job)
+		} else {
+			if err := e.ensureTable(ctx, token, t.kind, t.table, t.schema); err != nil {
+				return summary, fmt.Errorf("error creating %s: %v", t.table, err)
+			}
+			if err := e.insert(ctx, token, t.table, b.AnalysisID, t.rows); err != nil {
+				return summary, fmt.Errorf("error inserting into %s: %v", t.table, err)
+			}
+		}
+		*t.count = len(t.rows)
+	}
+	return summary, nil
+}
+
+func (e *Exporter) tableReference(table string) map[string]string {
+	return map[string]string{"projectId": e.Project, "datasetId": e.Dataset, "tableId": table}
+}
+
+func (e *Exporter) partitioning(kind string) map[string]string {
+	return map[string]string{"type": "DAY", "field": partitionField[kind]}
+}
+
+// ensureTable creates table with schema unless this process has already
+// seen it exist.
+func (e *Exporter) ensureTable(ctx context.Context, token, kind, table string, schema []field) error {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if e.created[table] {
+		return nil
+	}
+	body := map[string]interface{}{
+		"tableReference":   e.tableReference(table),
+		"schema":           map[string]interface{}{"fields": schema},
+		"timePartitioning": e.partitioning(kind),
+	}
+	target := fmt.Sprintf("%s/bigquery/v2/projects/%s/datasets/%s/tables", apiURL, url.PathEscape(e.Project), url.PathEscape(e.Dataset))
+	status, _, err := call(ctx, token, target, body)
+	if err != nil && status != http.StatusConflict {
+		return err
+	}
+	e.created[table] = true
+	return nil
+}
+
+// insert streams rows into table in batches. Insert IDs derive from the
+// analysis ID so that retried exports of a stored analysis aren't
+// duplicated.
+func (e *Exporter) insert(ctx context.Context, token, table, analysisID string, rows []interface{}) error {
+	prefix := analysisID
+	if prefix == "" {
+		b := make([]byte, 8)
+		if _, err := rand.Read(b); err != nil {
+			return err
+		}
+		prefix = hex.EncodeToString(b)
+	}
+	target := fmt.Sprintf("%s/bigquery/v2/projects/%s/datasets/%s/tables/%s/insertAll",
+		apiURL, url.PathEscape(e.Project), url.PathEscape(e.Dataset), url.PathEscape(table))
+
+	type insertRow struct {
+		InsertID string      `json:"insertId"`
+		JSON     interface{} `json:"json"`
+	}
+	for start := 0; start < len(rows); start += insertBatchSize {
+		end := start + insertBatchSize
+		if end > len(rows) {
+			end = len(rows)
+		}
+		batch := make([]insertRow, 0, end-start)
+		for i := start; i < end; i++ {
+			batch = append(batch, insertRow{fmt.Sprintf("%s-%s-%d", prefix, table, i), rows[i]})
+		}
+		_, data, err := call(ctx, token, target, map[string]interface{}{"rows": batch})
+		if err != nil {
+			return err
+		}
+		var resp struct {
+			InsertErrors []struct {
+				Index  int `json:"index"`
+				Errors []struct {
+					Message string `json:"message"`
+				} `json:"errors"`
+			} `json:"insertErrors"`
+		}
+		if err := json.Unmarshal(data, &resp); err != nil {
+			return fmt.Errorf("invalid insertAll response: %v", err)
+		}
+		if n := len(resp.InsertErrors); n > 0 {
+			first := resp.InsertErrors[0]
+			msg := ""
+			if len(first.Errors) > 0 {
+				msg = first.Errors[0].Message
+			}
+			return fmt.Errorf("%d row(s) rejected, row %d: %s", n, start+first.Index, msg)
+		}
+	}
+	return nil
+}
+
+// load starts a load job appending rows, as newline-delimited JSON, to
+// table, creating it if needed. It returns the job ID without waiting for
+// the job to finish.
+func (e *Exporter) load(ctx context.Context, token, kind, table string, schema []field, rows []interface{}) (string, error) {
+	var data bytes.Buffer
+	enc := json.NewEncoder(&data)
+	for _, row := range rows {
+		if err := enc.Encode(row); err != nil {
+			return "", err
+		}
+	}
+	config, err := json.Marshal(map[string]interface{}{
+		"configuration": map[string]interface{}{
+			"load": map[string]interface{}{
+				"destinationTable":  e.tableReference(table),
+				"sourceFormat":      "NEWLINE_DELIMITED_JSON",
+				"writeDisposition":  "WRITE_APPEND",
+				"createDisposition": "CREATE_IF_NEEDED",
+				"schema":            map[string]interface{}{"fields": schema},
+				"timePartitioning":  e.partitioning(kind),
+			},
+		},
+	})
+	if err != nil {
+		return "", err
+	}
+
+	var body bytes.Buffer
+	mw := multipart.NewWriter(&body)
+	parts := []struct {
+		contentType string
+		data        []byte
+	}{
+		{"application/json; charset=UTF-8", config},
+		{"application/octet-stream", data.Bytes()},
+	}
+	for _, p := range parts {
+		w, err := mw.CreatePart(textproto.MIMEHeader{"Content-Type": {p.contentType}})
+		if err != nil {
+			return "", err
+		}
+		w.Write(p.data)
+	}
+	if err := mw.Close(); err != nil {
+		return "", err
+	}
+
+	target := fmt.Sprintf("%s/upload/bigquery/v2/projects/%s/jobs?uploadType=multipart", apiURL, url.PathEscape(e.Project))
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, target, &body)
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("Content-Type", "multipart/related; boundary="+mw.Boundary())
+	_, resp, err := do(req, token)
+	if err != nil {
+		return "", err
+	}
+	var job struct {
+		JobReference struct {
+			JobID string `json:"jobId"`
+		} `json:"jobReference"`
+	}
+	if err := json.Unmarshal(resp, &job); err != nil {
+		return "", fmt.Errorf("invalid job response: %v", err)
+	}
+	return job.JobReference.JobID, nil
+}
+
+// call POSTs body as JSON to target.
+func call(ctx context.Context, token, target string, body interface{}) (int, []byte, error) {
+	data, err := json.Marshal(body)
+	if err != nil {
+		return 0, nil, err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, target, bytes.NewReader(data))
+	if err != nil {
+		return 0, nil, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	return do(req, token)
+}
+
+func do(req *http.Request, token string) (int, []byte, error) {
+	req.Header.Set("Authorization", "Bearer "+token)
+	resp, err := client.Do(req)
+	if err != nil {
+		return 0, nil, err
+	}
+	defer resp.Body.Close()
+	data, err := io.ReadAll(io.LimitReader(resp.Body, 1<<20))
+	if err != nil {
+		return resp.StatusCode, nil, err
+	}
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		var apiErr struct {
+			Error struct {
+				Message string `json:"message"`
+			} `json:"error"`
+		}
+		json.Unmarshal(data, &apiErr)
+		return resp.StatusCode, data, fmt.Errorf("BigQuery returned status %d: %s", resp.StatusCode, apiErr.Error.Message)
+	}
+	return resp.StatusCode, data, nil
+}
+
+// metadataToken returns the service account's access token from the
+// metadata server, which is how the service authenticates on Cloud Run and
+// GCE.
+func metadataToken(ctx context.Context) (string, error) {
+	ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, metadataTokenURL, nil)
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("Metadata-Flavor", "Google")
+	resp, err := client.Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+	var token struct {
+		AccessToken string `json:"access_token"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&token); err != nil || token.AccessToken == "" {
+		return "", fmt.Errorf("invalid metadata token response")
+	}
+	return token.AccessToken, nil
+}
@@ -0,0 +1,24 @@
+// Package dashboard serves a small web UI for the service: it uploads a log
+// file, shows the progress of its analysis as the service pushes it over a
+// WebSocket, and browses stored analyses. The assets are embedded in the
+// binary, so the service is usable on its own, without a separate frontend.
+package dashboard
+
+import (
+	"embed"
+	"io/fs"
+	"net/http"
+)
+
+//go:embed static
+var static embed.FS
+
+// Handler serves the dashboard's assets, with index.html at the root. Mount
+// it with the mount point stripped from request paths.
+func Handler() http.Handler {
+	assets, err := fs.Sub(static, "static")
+	if err != nil {
+		panic(err) // the embedded directory always exists
+	}
+	return http.FileServer(http.FS(assets))
+}
@@ -0,0 +1,208 @@
+// Dashboard for the log analytics service. Files are analyzed over the
+// /ws/analyze WebSocket, which pushes progress as the analysis runs; stored
+// analyses are read from the REST API.
+"use strict";
+
+const $ = (id) => document.getElementById(id);
+
+// Credentials stay in this browser tab only.
+for (const id of ["api-key", "tenant"]) {
+  $(id).value = sessionStorage.getItem(id) || "";
+  $(id).addEventListener("change", () => sessionStorage.setItem(id, $(id).value));
+}
+
+function apiHeaders() {
+  const headers = {};
+  if ($("api-key").value) headers["X-API-Key"] = $("api-key").value;
+  if ($("tenant").value) headers["X-Tenant-ID"] = $("tenant").value;
+  return headers;
+}
+
+function el(tag, className, text) {
+  const node = document.createElement(tag);
+  if (className) node.className = className;
+  if (text !== undefined) node.textContent = text;
+  return node;
+}
+
+function addProgress(text, className) {
+  $("progress").appendChild(el("li", className, text));
+}
+
+const stageLabels = {
+  received: "File received",
+  statistics: "Computing statistics",
+  model_call: "Waiting for model",
+  model_response: "Model answered",
+};
+
+$("upload").addEventListener("submit", (event) => {
+  event.preventDefault();
+  const file = $("file").files[0];
+  if (!file) return;
+
+  $("progress").replaceChildren();
+  $("result").hidden = true;
+  const button = event.submitter || $("upload").querySelector("button");
+  button.disabled = true;
+
+  const scheme = location.protocol === "https:" ? "wss:" : "ws:";
+  const ws = new WebSocket(scheme + "//" + location.host + "/ws/analyze");
+  let finished = false;
+
+  ws.onopen = () => {
+    addProgress("Uploading " + file.name + " (" + file.size + " bytes)");
+    ws.send(JSON.stringify({
+      api_key: $("api-key").value,
+      tenant: $("tenant").value,
+      kind: $("kind").value,
+      filename: file.name,
+      query: $("query").value,
+    }));
+    ws.send(file);
+  };
+
+  ws.onmessage = (msg) => {
+    const data = JSON.parse(msg.data);
+    switch (data.type) {
+      case "progress":
+        addProgress((stageLabels[data.stage] || data.stage) + (data.detail ? ": " + data.detail : ""));
+        break;
+      case "result":
+        finished = true;
+        addProgress("Done", "done");
+        showResult(data.result);
+        loadAnalyses();
+        break;
+      case "error":
+        finished = true;
+        addProgress("Failed (" + data.status + "): " + data.error, "error");
+        break;
+    }
+  };
+
+  ws.onclose = (ev) => {
+    if (ev.code === 1009) addProgress("Failed: the file is too large", "error");
+    else if (!finished) addProgress("Connection closed before the analysis finished", "error");
+    button.disabled = false;
+  };
+});
+
+const resultKeys = ["analysis", "errors", "security", "root_cause", "dependencies"];
+
+function showResult(result) {
+  const body = $("result-body");
+  body.replaceChildren();
+  $("result").hidden = false;
+  if (result && result.analysis_id) {
+    body.appendChild(el("p", "meta", "Stored as " + result.analysis_id));
+  }
+
+  // Responses wrap the report in a key named after the analysis.
+  let analysis = result;
+  for (const key of resultKeys) {
+    if (result && result[key]) {
+      analysis = result[key];
+      break;
+    }
+  }
+  renderAnalysis(body, analysis);
+  body.appendChild(rawJSON(result));
+}
+
+function renderAnalysis(body, analysis) {
+  if (!analysis || typeof analysis !== "object") return;
+  const summary = analysis.summary || analysis.Summary;
+  if (typeof summary === "string") body.appendChild(el("p", "", summary));
+
+  const insights = analysis.insights || analysis.performance_patterns || analysis.recommendations || [];
+  if (insights.length) {
+    body.appendChild(el("h3", "", "Insights"));
+    for (const insight of insights) {
+      const card = el("div", "card", typeof insight === "string" ? insight : insight.text);
+      if (insight.category) card.appendChild(el("div", "meta", insight.category));
+      body.appendChild(card);
+    }
+  }
+
+  const issues = analysis.potential_issues || analysis.resource_issues || analysis.issues || [];
+  if (issues.length) {
+    body.appendChild(el("h3", "", "Issues"));
+    for (const issue of issues) {
+      const card = el("div", "card " + (issue.severity || "").toLowerCase(), issue.description || issue.type);
+      const meta = [issue.severity, issue.type, (issue.path || []).join(", ")].filter(Boolean).join(" · ");
+      card.appendChild(el("div", "meta", meta));
+      body.appendChild(card);
+    }
+  }
+
+  const slow = analysis.slow_pages || analysis.slow_endpoints || [];
+  if (slow.length) {
+    body.appendChild(el("h3", "", "Slow pages"));
+    const table = el("table");
+    table.innerHTML = "<thead><tr><th>Path</th><th>Avg ms</th><th>Requests</th><th>Error rate</th></tr></thead>";
+    const rows = el("tbody");
+    for (const page of slow) {
+      const row = el("tr");
+      for (const value of [page.path, page.avg_duration, page.request_count, page.error_rate]) {
+        row.appendChild(el("td", "", String(value)));
+      }
+      rows.appendChild(row);
+    }
+    table.appendChild(rows);
+    body.appendChild(table);
+  }
+}
+
+function rawJSON(value) {
+  const details = el("details");
+  details.appendChild(el("summary", "", "Raw JSON"));
+  details.appendChild(el("pre", "", JSON.stringify(value, null, 2)));
+  return details;
+}
+
+async function loadAnalyses() {
+  const status = $("history-status");
+  const rows = $("analyses");
+  rows.replaceChildren();
+  status.textContent = "Loading…";
+  try {
+    const resp = await fetch("/analyses?limit=50", { headers: apiHeaders() });
+    const data = await resp.json();
+    if (!resp.ok) {
+      status.textContent = data.error || "Error " + resp.status;
+      return;
+    }
+    const analyses = data.analyses || [];
+    status.textContent = analyses.length ? "" : "No stored analyses yet.";
+    for (const a of analyses) {
+      const row = el("tr");
+      for (const value of [new Date(a.created_at).toLocaleString(), a.kind, a.source.name || a.source.filename || a.source.type, a.source.entries]) {
+        row.appendChild(el("td", "", String(value)));
+      }
+      row.addEventListener("click", () => openAnalysis(a.id));
+      rows.appendChild(row);
+    }
+  } catch (err) {
+    status.textContent = "Error: " + err.message;
+  }
+}
+
+async function openAnalysis(id) {
+  const resp = await fetch("/analyses/" + encodeURIComponent(id), { headers: apiHeaders() });
+  const data = await resp.json();
+  if (!resp.ok) {
+    $("history-status").textContent = data.error || "Error " + resp.status;
+    return;
+  }
+  const body = $("result-body");
+  body.replaceChildren();
+  $("result").hidden = false;
+  body.appendChild(el("p", "meta", data.kind + " analysis " + data.id + " of " + new Date(data.created_at).toLocaleString()));
+  renderAnalysis(body, data.result);
+  body.appendChild(rawJSON(data.result));
+  $("result").scrollIntoView({ behavior: "smooth" });
+}
+
+$("refresh").addEventListener("click", loadAnalyses);
+loadAnalyses();
@@ -0,0 +1,80 @@
+package dashboard
+
+import (
+	"encoding/json"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+// TextMessage is the message type of text messages.
+const TextMessage = websocket.TextMessage
+
+// writeTimeout bounds each message written to a connection.
+const writeTimeout = 10 * time.Second
+
+// upgrader refuses handshakes from pages of another origin than the
+// service's, as browsers send cookies with WebSocket handshakes from any
+// page, and answers refused handshakes in JSON like the rest of the API.
+var upgrader = websocket.Upgrader{
+	HandshakeTimeout: writeTimeout,
+	Error: func(w http.ResponseWriter, r *http.Request, status int, reason error) {
+		w.Header().Set("Content-Type", "application/json; charset=utf-8")
+		w.WriteHeader(status)
+		json.NewEncoder(w).Encode(map[string]string{"error": reason.Error()})
+	},
+}
+
+// Conn is a server-side WebSocket connection. One goroutine may read from
+// it while others write.
+type Conn struct {
+	ws *websocket.Conn
+	mu sync.Mutex // serializes writes
+}
+
+// Upgrade completes the WebSocket handshake of r and takes over its
+// connection. If the handshake fails, the error has already been written
+// to w.
+func Upgrade(w http.ResponseWriter, r *http.Request) (*Conn, error) {
+	ws, err := upgrader.Upgrade(w, r, nil)
+	if err != nil {
+		return nil, err
+	}
+	return &Conn{ws: ws}, nil
+}
+
+// SetReadLimit sets the largest message ReadMessage accepts.
+func (c *Conn) SetReadLimit(n int64) {
+	c.ws.SetReadLimit(n)
+}
+
+// SetReadDeadline sets the time by which the next message must have been
+// read. A zero t means no deadline.
+func (c *Conn) SetReadDeadline(t time.Time) error {
+	return c.ws.SetReadDeadline(t)
+}
+
+// ReadMessage reads the next text or binary message. Pings are answered as
+// they arrive.
+func (c *Conn) ReadMessage() (int, []byte, error) {
+	return c.ws.ReadMessage()
+}
+
+// WriteJSON sends v as a text message.
+func (c *Conn) WriteJSON(v interface{}) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.ws.SetWriteDeadline(time.Now().Add(writeTimeout))
+	return c.ws.WriteJSON(v)
+}
+
+// Close sends a close message and closes the connection.
+func (c *Conn) Close() error {
+	c.mu.Lock()
+	msg := websocket.FormatCloseMessage(websocket.CloseNormalClosure, "")
+	c.ws.WriteControl(websocket.CloseMessage, msg, time.Now().Add(writeTimeout))
+	c.mu.Unlock()
+	return c.ws.Close()
+}
@@ -0,0 +1,84 @@
+// Package export writes log entries in formats other tools load directly:
+// CSV, Excel workbooks and Parquet. It is the counterpart of report, which
+// renders analysis results for people.
+package export
+
+import (
+	"bytes"
+	"encoding/csv"
+	"fmt"
+	"strconv"
+
+	"analyticsai/ai-service/analytics/aggregator"
+	"analyticsai/ai-service/analytics/parser"
+)
+
+// CSVOptions controls the columns and format of CSV.
+type CSVOptions struct {
+	// Columns are entry fields as accepted by parser.ParseFields, in
+	// output order. "metadata" expands to a "metadata.<key>" column per key
+	// found in the logs. Empty selects every field.
+	Columns   []string
+	Delimiter rune // default ','
+}
+
+// csvValue formats field of log for a CSV cell.
+func csvValue(log parser.LogEntry, field string) string {
+	switch v := parser.Field(log, field).(type) {
+	case string:
+		return v
+	case int64:
+		return strconv.FormatInt(v, 10)
+	case int:
+		return strconv.Itoa(v)
+	}
+	return ""
+}
+
+// CSV writes logs as CSV. By default the standard fields are followed by
+// one "metadata.<key>" column per metadata key in the logs.
+func CSV(logs []parser.LogEntry, opts CSVOptions) ([]byte, error) {
+	var buffer bytes.Buffer
+	writer := csv.NewWriter(&buffer)
+	if opts.Delimiter != 0 {
+		writer.Comma = opts.Delimiter
+	}
+
+	fields := opts.Columns
+	if len(fields) == 0 {
+		fields = parser.DefaultFields()
+	}
+	var header []string
+	for _, field := range fields {
+		if field != "metadata" {
+			header = append(header, field)
+			continue
+		}
+		for _, key := range aggregator.MetadataKeys(logs) {
+			header = append(header, aggregator.MetadataColumn(key))
+		}
+	}
+
+	// Write header
+	if err := writer.Write(header); err != nil {
+		return nil, fmt.Errorf("error writing CSV header: %v", err)
+	}
+
+	// Write log entries
+	row := make([]string, len(header))
+	for _, log := range logs {
+		for i, field := range header {
+			row[i] = csvValue(log, field)
+		}
+		if err := writer.Write(row); err != nil {
+			return nil, fmt.Errorf("error writing CSV row: %v", err)
+		}
+	}
+
+	writer.Flush()
+	if err := writer.Error(); err != nil {
+		return nil, fmt.Errorf("error flushing CSV writer: %v", err)
+	}
+
+	return buffer.Bytes(), nil
+}
@@ -0,0 +1,384 @@
+package export
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/binary"
+	"fmt"
+
+	"analyticsai/ai-service/analytics/parser"
+)
+
+// parquetRowGroupSize bounds the rows per row group, and so the size of each
+// page held in memory while writing.
+const parquetRowGroupSize = 100000
+
+// Parquet physical types, converted types, repetitions, encodings and codec
+// from the parquet-format Thrift definitions.
+const (
+	parquetInt32     = 1
+	parquetInt64     = 2
+	parquetByteArray = 6
+
+	parquetUTF8            = 0
+	parquetTimestampMicros = 10
+	parquetNoConversion    = -1
+
+	parquetRequired = 0
+	parquetOptional = 1
+
+	parquetPlain = 0
+	parquetRLE   = 3
+
+	parquetGzip     = 2
+	parquetDataPage = 0
+)
+
+var parquetMagic = []byte("PAR1")
+
+// Thrift compact protocol field types.
+const (
+	thriftI32    = 5
+	thriftI64    = 6
+	thriftBinary = 8
+	thriftList   = 9
+	thriftStruct = 12
+)
+
+// thriftWriter encodes structs with the Thrift compact protocol, which
+// Parquet uses for page headers and the file footer.
+type thriftWriter struct {
+	buf  bytes.Buffer
+	last []int16 // last field id written in each open struct
+}
+
+func (w *thriftWriter) varint(v uint64) {
+	var b [binary.MaxVarintLen64]byte
+	w.buf.Write(b[:binary.PutUvarint(b[:], v)])
+}
+
+func zigzag(v int64) uint64 { return uint64((v << 1) ^ (v >> 63)) }
+
+func (w *thriftWriter) field(id int16, typ byte) {
+	last := &w.last[len(w.last)-1]
+	if delta := id - *last; delta > 0 && delta <= 15 {
+		w.buf.WriteByte(byte(delta)<<4 | typ)
+	} else {
+		w.buf.WriteByte(typ)
+		w.varint(zigzag(int64(id)))
+	}
+	*last = id
+}
+
+func (w *thriftWriter) i32(id int16, v int32) {
+	w.field(id, thriftI32)
+	w.varint(zigzag(int64(v)))
+}
+
+func (w *thriftWriter) i64(id int16, v int64) {
+	w.field(id, thriftI64)
+	w.varint(zigzag(v))
+}
+
+func (w *thriftWriter) string(id int16, s string) {
+	w.field(id, thriftBinary)
+	w.rawString(s)
+}
+
+func (w *thriftWriter) rawString(s string) {
+	w.varint(uint64(len(s)))
+	w.buf.WriteString(s)
+}
+
+// list starts a list field of n elements; the caller writes the elements.
+func (w *thriftWriter) list(id int16, elem byte, n int) {
+	w.field(id, thriftList)
+	if n < 15 {
+		w.buf.WriteByte(byte(n)<<4 | elem)
+		return
+	}
+	w.buf.WriteByte(0xf0 | elem)
+	w.varint(uint64(n))
+}
+
+// begin starts a struct: the top-level one, a list element, or after
+// structField.
+func (w *thriftWriter) begin() { w.last = append(w.last, 0) }
+
+func (w *thriftWriter) structField(id int16) {
+	w.field(id, thriftStruct)
+	w.begin()
+}
+
+func (w *thriftWriter) end() {
+	w.buf.WriteByte(0)
+	w.last = w.last[:len(w.last)-1]
+}
+
+// parquetColumn is a leaf column of the log schema.
+type parquetColumn struct {
+	path      []string
+	physical  int32
+	converted int32
+	optional  bool
+	// value returns the entry's int32, int64 or string value, or false for
+	// a null.
+	value func(parser.LogEntry) (interface{}, bool)
+}
+
+func requiredString(path string, get func(parser.LogEntry) string) parquetColumn {
+	return parquetColumn{[]string{path}, parquetByteArray, parquetUTF8, false, func(log parser.LogEntry) (interface{}, bool) {
+		return get(log), true
+	}}
+}
+
+func logColumns(metadataColumns []string) []parquetColumn {
+	columns := []parquetColumn{
+		{[]string{"timestamp"}, parquetInt64, parquetTimestampMicros, true, func(log parser.LogEntry) (interface{}, bool) {
+			t, ok := parser.ParseTimestamp(log.Timestamp)
+			return t.UnixMicro(), ok
+		}},
+		requiredString("level", func(log parser.LogEntry) string { return log.Level }),
+		requiredString("message", func(log parser.LogEntry) string { return log.Message }),
+		requiredString("path", func(log parser.LogEntry) string { return log.Path }),
+		requiredString("method", func(log parser.LogEntry) string { return log.Method }),
+		{[]string{"duration"}, parquetInt64, parquetNoConversion, false, func(log parser.LogEntry) (interface{}, bool) {
+			return log.Duration, true
+		}},
+		{[]string{"status"}, parquetInt32, parquetNoConversion, false, func(log parser.LogEntry) (interface{}, bool) {
+			return int32(log.Status), true
+		}},
+	}
+	for _, key := range metadataColumns {
+		key := key
+		columns = append(columns, parquetColumn{[]string{"metadata", key}, parquetByteArray, parquetUTF8, true, func(log parser.LogEntry) (interface{}, bool) {
+			v, ok := log.Metadata[key]
+			return v, ok
+		}})
+	}
+	return columns
+}
+
+// writeDefinitionLevels writes the 0/1 definition levels of an optional
+// column as runs of the RLE/bit-packing hybrid encoding, prefixed with their
+// length.
+func writeDefinitionLevels(buf *bytes.Buffer, defined []bool) {
+	var runs thriftWriter
+	for i := 0; i < len(defined); {
+		j := i
+		for j < len(defined) && defined[j] == defined[i] {
+			j++
+		}
+		runs.varint(uint64(j-i) << 1)
+		if defined[i] {
+			runs.buf.WriteByte(1)
+		} else {
+			runs.buf.WriteByte(0)
+		}
+		i = j
+	}
+	binary.Write(buf, binary.LittleEndian, uint32(runs.buf.Len()))
+	buf.Write(runs.buf.Bytes())
+}
+
+// encodePage returns the uncompressed data page of col for logs: the
+// definition levels of an optional column followed by the plain-encoded
+// non-null values.
+func encodePage(col parquetColumn, logs []parser.LogEntry) []byte {
+	var values bytes.Buffer
+	defined := make([]bool, len(logs))
+	for i, log := range logs {
+		v, ok := col.value(log)
+		defined[i] = ok
+		if !ok {
+			continue
+		}
+		switch v := v.(type) {
+		case int32:
+			binary.Write(&values, binary.LittleEndian, v)
+		case int64:
+			binary.Write(&values, binary.LittleEndian, v)
+		case string:
+			binary.Write(&values, binary.LittleEndian, uint32(len(v)))
+			values.WriteString(v)
+		}
+	}
+
+	var page bytes.Buffer
+	if col.optional {
+		writeDefinitionLevels(&page, defined)
+	}
+	page.Write(values.Bytes())
+	return page.Bytes()
+}
+
+// parquetChunk is a written column chunk, recorded for the footer.
+type parquetChunk struct {
+	offset           int64
+	uncompressedSize int64
+	compressedSize   int64
+}
+
+func writeColumnChunk(out *bytes.Buffer, col parquetColumn, logs []parser.LogEntry) (parquetChunk, error) {
+	page := encodePage(col, logs)
+	var compressed bytes.Buffer
+	zw := gzip.NewWriter(&compressed)
+	if _, err := zw.Write(page); err != nil {
+		return parquetChunk{}, err
+	}
+	if err := zw.Close(); err != nil {
+		return parquetChunk{}, err
+	}
+
+	var header thriftWriter
+	header.begin()
+	header.i32(1, parquetDataPage)
+	header.i32(2, int32(len(page)))
+	header.i32(3, int32(compressed.Len()))
+	header.structField(5)
+	header.i32(1, int32(len(logs)))
+	header.i32(2, parquetPlain)
+	header.i32(3, parquetRLE)
+	header.i32(4, parquetRLE)
+	header.end()
+	header.end()
+
+	chunk := parquetChunk{
+		offset:           int64(out.Len()),
+		uncompressedSize: int64(header.buf.Len() + len(page)),
+		compressedSize:   int64(header.buf.Len() + compressed.Len()),
+	}
+	out.Write(header.buf.Bytes())
+	out.Write(compressed.Bytes())
+	return chunk, nil
+}
+
+// writeSchema writes the footer schema: the root, the top-level columns and
+// a "metadata" group holding the metadata columns.
+func writeSchema(w *thriftWriter, columns []parquetColumn) {
+	leaf := func(col parquetColumn) {
+		w.begin()
+		w.i32(1, col.physical)
+		repetition := int32(parquetRequired)
+		if col.optional {
+			repetition = parquetOptional
+		}
+		w.i32(3, repetition)
+		w.string(4, col.path[len(col.path)-1])
+		if col.converted != parquetNoConversion {
+			w.i32(6, col.converted)
+		}
+		w.end()
+	}
+
+	var top, metadata []parquetColumn
+	for _, col := range columns {
+		if len(col.path) > 1 {
+			metadata = append(metadata, col)
+		} else {
+			top = append(top, col)
+		}
+	}
+	children := len(top)
+	elements := 1 + len(top) + len(metadata)
+	if len(metadata) > 0 {
+		children++
+		elements++
+	}
+
+	w.list(2, thriftStruct, elements)
+	w.begin()
+	w.string(4, "schema")
+	w.i32(5, int32(children))
+	w.end()
+	for _, col := range top {
+		leaf(col)
+	}
+	if len(metadata) > 0 {
+		w.begin()
+		w.i32(3, parquetRequired)
+		w.string(4, "metadata")
+		w.i32(5, int32(len(metadata)))
+		w.end()
+		for _, col := range metadata {
+			leaf(col)
+		}
+	}
+}
+
+// Parquet writes logs as a gzip-compressed Parquet file. Timestamps
+// that parse become TIMESTAMP_MICROS values (null otherwise) and each key in
+// metadataColumns becomes a nullable string column of a "metadata" group.
+//
+// The file is encoded here rather than with github.com/xitongsys/parquet-go
+// or github.com/parquet-go/parquet-go: both depend on
+// github.com/pierrec/lz4/v4, and the former also on github.com/apache/thrift,
+// neither of which the build's module mirror carries.
+// Only the flat, plain-encoded subset above is written.
+func Parquet(logs []parser.LogEntry, metadataColumns []string) ([]byte, error) {
+	columns := logColumns(metadataColumns)
+
+	var out bytes.Buffer
+	out.Write(parquetMagic)
+
+	var footer thriftWriter
+	footer.begin()
+	footer.i32(1, 1)
+	writeSchema(&footer, columns)
+	footer.i64(3, int64(len(logs)))
+
+	groups := (len(logs) + parquetRowGroupSize - 1) / parquetRowGroupSize
+	footer.list(4, thriftStruct, groups)
+	for start := 0; start < len(logs); start += parquetRowGroupSize {
+		end := start + parquetRowGroupSize
+		if end > len(logs) {
+			end = len(logs)
+		}
+		rows := logs[start:end]
+
+		chunks := make([]parquetChunk, len(columns))
+		var totalSize int64
+		for i, col := range columns {
+			chunk, err := writeColumnChunk(&out, col, rows)
+			if err != nil {
+				return nil, fmt.Errorf("error writing column %q: %v", col.path[len(col.path)-1], err)
+			}
+			chunks[i] = chunk
+			totalSize += chunk.uncompressedSize
+		}
+
+		footer.begin()
+		footer.list(1, thriftStruct, len(columns))
+		for i, col := range columns {
+			chunk := chunks[i]
+			footer.begin()
+			footer.i64(2, chunk.offset)
+			footer.structField(3)
+			footer.i32(1, col.physical)
+			footer.list(2, thriftI32, 2)
+			footer.varint(zigzag(parquetPlain))
+			footer.varint(zigzag(parquetRLE))
+			footer.list(3, thriftBinary, len(col.path))
+			for _, name := range col.path {
+				footer.rawString(name)
+			}
+			footer.i32(4, parquetGzip)
+			footer.i64(5, int64(len(rows)))
+			footer.i64(6, chunk.uncompressedSize)
+			footer.i64(7, chunk.compressedSize)
+			footer.i64(9, chunk.offset)
+			footer.end()
+			footer.end()
+		}
+		footer.i64(2, totalSize)
+		footer.i64(3, int64(len(rows)))
+		footer.end()
+	}
+	footer.string(6, "analyticsai ai-service")
+	footer.end()
+
+	out.Write(footer.buf.Bytes())
+	binary.Write(&out, binary.LittleEndian, uint32(footer.buf.Len()))
+	out.Write(parquetMagic)
+	return out.Bytes(), nil
+}
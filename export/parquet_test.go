@@ -0,0 +1,383 @@
+package export
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"analyticsai/ai-service/analytics/parser"
+)
+
+// The reader below is written from the parquet-format and Thrift compact
+// protocol specifications, independently of the writer: it decodes generic
+// Thrift structs, walks the schema for column paths and types, and reads
+// the pages at the offsets the footer gives.
+
+type thriftReader struct {
+	b []byte
+}
+
+var errThriftTruncated = errors.New("thrift: truncated")
+
+func (r *thriftReader) byte() (byte, error) {
+	if len(r.b) == 0 {
+		return 0, errThriftTruncated
+	}
+	b := r.b[0]
+	r.b = r.b[1:]
+	return b, nil
+}
+
+func (r *thriftReader) uvarint() (uint64, error) {
+	v, n := binary.Uvarint(r.b)
+	if n <= 0 {
+		return 0, errThriftTruncated
+	}
+	r.b = r.b[n:]
+	return v, nil
+}
+
+func (r *thriftReader) zigzag() (int64, error) {
+	v, err := r.uvarint()
+	return int64(v>>1) ^ -int64(v&1), err
+}
+
+// value reads a value of compact type typ: int64 for integers, string for
+// binary, []interface{} for lists and map[int16]interface{} for structs.
+func (r *thriftReader) value(typ byte) (interface{}, error) {
+	switch typ {
+	case 1, 2: // boolean true, false
+		return typ == 1, nil
+	case 3:
+		b, err := r.byte()
+		return int64(int8(b)), err
+	case 4, 5, 6:
+		return r.zigzag()
+	case 7:
+		if len(r.b) < 8 {
+			return nil, errThriftTruncated
+		}
+		v := math.Float64frombits(binary.LittleEndian.Uint64(r.b))
+		r.b = r.b[8:]
+		return v, nil
+	case 8:
+		n, err := r.uvarint()
+		if err != nil || n > uint64(len(r.b)) {
+			return nil, errThriftTruncated
+		}
+		s := string(r.b[:n])
+		r.b = r.b[n:]
+		return s, nil
+	case 9, 10:
+		header, err := r.byte()
+		if err != nil {
+			return nil, err
+		}
+		size, elem := uint64(header>>4), header&0x0f
+		if size == 15 {
+			if size, err = r.uvarint(); err != nil {
+				return nil, err
+			}
+		}
+		list := []interface{}{}
+		for i := uint64(0); i < size; i++ {
+			if elem == 1 || elem == 2 {
+				b, err := r.byte() // booleans in lists take a byte each
+				if err != nil {
+					return nil, err
+				}
+				list = append(list, b == 1)
+				continue
+			}
+			v, err := r.value(elem)
+			if err != nil {
+				return nil, err
+			}
+			list = append(list, v)
+		}
+		return list, nil
+	case 12:
+		return r.structure()
+	}
+	return nil, fmt.Errorf("thrift: unsupported type %d", typ)
+}
+
+func (r *thriftReader) structure() (map[int16]interface{}, error) {
+	fields := make(map[int16]interface{})
+	var last int16
+	for {
+		header, err := r.byte()
+		if err != nil {
+			return nil, err
+		}
+		if header == 0 {
+			return fields, nil
+		}
+		id := last + int16(header>>4)
+		if header>>4 == 0 {
+			v, err := r.zigzag()
+			if err != nil {
+				return nil, err
+			}
+			id = int16(v)
+		}
+		if fields[id], err = r.value(header & 0x0f); err != nil {
+			return nil, err
+		}
+		last = id
+	}
+}
+
+type parquetLeaf struct {
+	physical  int64
+	converted int64 // -1 without one
+	maxDef    int
+}
+
+// parquetSchemaLeaves returns the leaf columns of a flattened schema by
+// their dotted path.
+func parquetSchemaLeaves(t *testing.T, schema []interface{}) map[string]parquetLeaf {
+	leaves := make(map[string]parquetLeaf)
+	pos := 1 // element 0 is the root
+	var walk func(prefix string, children int64, def int)
+	walk = func(prefix string, children int64, def int) {
+		for i := int64(0); i < children; i++ {
+			el := schema[pos].(map[int16]interface{})
+			pos++
+			name := prefix + el[4].(string)
+			d := def
+			if rep, _ := el[3].(int64); rep == 1 {
+				d++
+			} else if rep == 2 {
+				t.Fatalf("column %s is repeated", name)
+			}
+			if n, ok := el[5].(int64); ok {
+				walk(name+".", n, d)
+				continue
+			}
+			converted := int64(-1)
+			if c, ok := el[6].(int64); ok {
+				converted = c
+			}
+			leaves[name] = parquetLeaf{physical: el[1].(int64), converted: converted, maxDef: d}
+		}
+	}
+	walk("", schema[0].(map[int16]interface{})[5].(int64), 0)
+	if pos != len(schema) {
+		t.Fatalf("schema has %d elements, %d reachable from the root", len(schema), pos)
+	}
+	return leaves
+}
+
+// readDefinitionLevels decodes n levels of bit width 1 in the RLE/bit-packing
+// hybrid encoding.
+func readDefinitionLevels(data []byte, n int) ([]bool, error) {
+	r := &thriftReader{b: data}
+	var levels []bool
+	for len(levels) < n {
+		header, err := r.uvarint()
+		if err != nil {
+			return nil, err
+		}
+		if header&1 == 0 { // RLE run
+			v, err := r.byte()
+			if err != nil {
+				return nil, err
+			}
+			for i := uint64(0); i < header>>1; i++ {
+				levels = append(levels, v == 1)
+			}
+			continue
+		}
+		for g := uint64(0); g < header>>1; g++ { // bit-packed groups of 8
+			b, err := r.byte()
+			if err != nil {
+				return nil, err
+			}
+			for bit := 0; bit < 8; bit++ {
+				levels = append(levels, b>>bit&1 == 1)
+			}
+		}
+	}
+	return levels[:n], nil
+}
+
+// readParquet returns the values of every leaf column by dotted path,
+// nil for nulls, and the row count of the footer.
+func readParquet(t *testing.T, data []byte) (map[string][]interface{}, map[string]parquetLeaf, int64) {
+	t.Helper()
+	if len(data) < 12 || string(data[:4]) != "PAR1" || string(data[len(data)-4:]) != "PAR1" {
+		t.Fatal("missing PAR1 magic")
+	}
+	footerLen := int(binary.LittleEndian.Uint32(data[len(data)-8:]))
+	footer := &thriftReader{b: data[len(data)-8-footerLen : len(data)-8]}
+	meta, err := footer.structure()
+	if err != nil || len(footer.b) != 0 {
+		t.Fatalf("footer: %v, %d trailing bytes", err, len(footer.b))
+	}
+	leaves := parquetSchemaLeaves(t, meta[2].([]interface{}))
+	columns := make(map[string][]interface{})
+
+	for _, rg := range meta[4].([]interface{}) {
+		rowGroup := rg.(map[int16]interface{})
+		rows := rowGroup[3].(int64)
+		chunks := rowGroup[1].([]interface{})
+		if len(chunks) != len(leaves) {
+			t.Fatalf("row group has %d column chunks for %d leaf columns", len(chunks), len(leaves))
+		}
+		for _, c := range chunks {
+			cm := c.(map[int16]interface{})[3].(map[int16]interface{})
+			var path []string
+			for _, p := range cm[3].([]interface{}) {
+				path = append(path, p.(string))
+			}
+			name := strings.Join(path, ".")
+			leaf, ok := leaves[name]
+			if !ok {
+				t.Fatalf("column chunk %s is not in the schema", name)
+			}
+			if cm[1].(int64) != leaf.physical || cm[4].(int64) != 2 || cm[5].(int64) != rows {
+				t.Fatalf("column %s: type %v, codec %v, %v values; want %d, gzip, %d", name, cm[1], cm[4], cm[5], leaf.physical, rows)
+			}
+
+			pageReader := &thriftReader{b: data[cm[9].(int64):]}
+			header, err := pageReader.structure()
+			if err != nil {
+				t.Fatalf("column %s page header: %v", name, err)
+			}
+			headerLen := len(data[cm[9].(int64):]) - len(pageReader.b)
+			if total := int64(headerLen) + header[3].(int64); total != cm[7].(int64) {
+				t.Errorf("column %s: page takes %d bytes, chunk says %d", name, total, cm[7])
+			}
+			zr, err := gzip.NewReader(bytes.NewReader(pageReader.b[:header[3].(int64)]))
+			if err != nil {
+				t.Fatalf("column %s: %v", name, err)
+			}
+			page, err := io.ReadAll(zr)
+			if err != nil || int64(len(page)) != header[2].(int64) {
+				t.Fatalf("column %s: %d bytes decompressed, want %v: %v", name, len(page), header[2], err)
+			}
+			dataPage := header[5].(map[int16]interface{})
+			if header[1].(int64) != 0 || dataPage[1].(int64) != rows || dataPage[2].(int64) != 0 {
+				t.Fatalf("column %s: unexpected page header %v", name, header)
+			}
+
+			defined := make([]bool, rows)
+			for i := range defined {
+				defined[i] = true
+			}
+			if leaf.maxDef > 0 {
+				n := binary.LittleEndian.Uint32(page)
+				if defined, err = readDefinitionLevels(page[4:4+n], int(rows)); err != nil {
+					t.Fatalf("column %s levels: %v", name, err)
+				}
+				page = page[4+n:]
+			}
+			for _, ok := range defined {
+				if !ok {
+					columns[name] = append(columns[name], nil)
+					continue
+				}
+				switch leaf.physical {
+				case 1:
+					columns[name] = append(columns[name], int32(binary.LittleEndian.Uint32(page)))
+					page = page[4:]
+				case 2:
+					columns[name] = append(columns[name], int64(binary.LittleEndian.Uint64(page)))
+					page = page[8:]
+				case 6:
+					n := binary.LittleEndian.Uint32(page)
+					columns[name] = append(columns[name], string(page[4:4+n]))
+					page = page[4+n:]
+				default:
+					t.Fatalf("column %s: unexpected physical type %d", name, leaf.physical)
+				}
+			}
+			if len(page) != 0 {
+				t.Errorf("column %s: %d bytes left after the values", name, len(page))
+			}
+		}
+	}
+	return columns, leaves, meta[3].(int64)
+}
+
+func TestParquetReadBack(t *testing.T) {
+	logs := []parser.LogEntry{
+		{Timestamp: "2024-05-01T12:00:00.123456Z", Level: "error", Message: "payment failed: ünïcode ✓", Path: "/checkout", Method: "POST", Duration: 1520, Status: 502, Metadata: map[string]string{"region": "eu-west1", "version": "1.4.2"}},
+		{Timestamp: "not a time", Level: "info", Path: "/", Method: "GET", Duration: 12, Status: 200, Metadata: map[string]string{"version": "1.4.2"}},
+		{Timestamp: "2024-05-01T12:00:01Z", Level: "", Path: "/api/orders", Method: "GET", Duration: 0, Status: 404},
+	}
+	data, err := Parquet(logs, []string{"region", "version"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	columns, leaves, rows := readParquet(t, data)
+	if rows != 3 {
+		t.Errorf("footer has %d rows, want 3", rows)
+	}
+	want := map[string][]interface{}{
+		"timestamp":        {time.Date(2024, 5, 1, 12, 0, 0, 123456000, time.UTC).UnixMicro(), nil, time.Date(2024, 5, 1, 12, 0, 1, 0, time.UTC).UnixMicro()},
+		"level":            {"error", "info", ""},
+		"message":          {"payment failed: ünïcode ✓", "", ""},
+		"path":             {"/checkout", "/", "/api/orders"},
+		"method":           {"POST", "GET", "GET"},
+		"duration":         {int64(1520), int64(12), int64(0)},
+		"status":           {int32(502), int32(200), int32(404)},
+		"metadata.region":  {"eu-west1", nil, nil},
+		"metadata.version": {"1.4.2", "1.4.2", nil},
+	}
+	if !reflect.DeepEqual(columns, want) {
+		t.Errorf("read back\n%v\nwant\n%v", columns, want)
+	}
+	wantLeaves := map[string]parquetLeaf{
+		"timestamp":        {physical: 2, converted: 10, maxDef: 1},
+		"level":            {physical: 6, converted: 0},
+		"message":          {physical: 6, converted: 0},
+		"path":             {physical: 6, converted: 0},
+		"method":           {physical: 6, converted: 0},
+		"duration":         {physical: 2, converted: -1},
+		"status":           {physical: 1, converted: -1},
+		"metadata.region":  {physical: 6, converted: 0, maxDef: 1},
+		"metadata.version": {physical: 6, converted: 0, maxDef: 1},
+	}
+	if !reflect.DeepEqual(leaves, wantLeaves) {
+		t.Errorf("schema\n%v\nwant\n%v", leaves, wantLeaves)
+	}
+}
+
+func TestParquetRowGroups(t *testing.T) {
+	logs := make([]parser.LogEntry, parquetRowGroupSize+3)
+	for i := range logs {
+		logs[i] = parser.LogEntry{Path: fmt.Sprintf("/p/%d", i), Status: 200 + i%3}
+		if i%2 == 0 {
+			logs[i].Metadata = map[string]string{"shard": fmt.Sprint(i % 7)}
+		}
+	}
+	data, err := Parquet(logs, []string{"shard"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	columns, _, rows := readParquet(t, data)
+	if rows != int64(len(logs)) || len(columns["path"]) != len(logs) {
+		t.Fatalf("read %d rows (footer %d), want %d", len(columns["path"]), rows, len(logs))
+	}
+	for _, i := range []int{0, 1, parquetRowGroupSize - 1, parquetRowGroupSize, len(logs) - 1} {
+		var shard interface{}
+		if i%2 == 0 {
+			shard = fmt.Sprint(i % 7)
+		}
+		if columns["path"][i] != logs[i].Path || columns["status"][i] != int32(logs[i].Status) || columns["metadata.shard"][i] != shard {
+			t.Errorf("row %d = %v %v %v", i, columns["path"][i], columns["status"][i], columns["metadata.shard"][i])
+		}
+	}
+}
@@ -0,0 +1,255 @@
+package export
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+
+	"analyticsai/ai-service/analytics"
+	"analyticsai/ai-service/analytics/aggregator"
+	"analyticsai/ai-service/analytics/parser"
+)
+
+// maxXLSXCellText is Excel's limit on the characters in a cell.
+const maxXLSXCellText = 32767
+
+// Cell styles defined in xlsxStyles; 0 is the default style.
+const (
+	xlsxStyleHeader  = 1
+	xlsxStyleDate    = 2
+	xlsxStylePercent = 3 // values are already percentages, shown with two decimals
+)
+
+// excelEpoch is day zero of Excel's 1900 date system, adjusted for its
+// fictitious February 29, 1900.
+var excelEpoch = time.Date(1899, 12, 30, 0, 0, 0, 0, time.UTC)
+
+// xlsxCell is a typed cell value: a string, int, int64 or float64, or a
+// time.Time written as an Excel date.
+type xlsxCell struct {
+	value interface{}
+	style int
+}
+
+type xlsxSheet struct {
+	name   string
+	widths []float64 // column widths in characters
+	rows   [][]xlsxCell
+}
+
+func xlsxColumn(i int) string {
+	name := ""
+	for i++; i > 0; i = (i - 1) / 26 {
+		name = string(rune('A'+(i-1)%26)) + name
+	}
+	return name
+}
+
+func xlsxEscape(s string) string {
+	if len(s) > maxXLSXCellText {
+		s = s[:maxXLSXCellText]
+	}
+	var b strings.Builder
+	xml.EscapeText(&b, []byte(s))
+	return b.String()
+}
+
+func (sh *xlsxSheet) write(w io.Writer) error {
+	var b strings.Builder
+	b.WriteString(`<?xml version="1.0" encoding="UTF-8" standalone="yes"?>` + "\n")
+	b.WriteString(`<worksheet xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main">`)
+	// Keep the header row in view while scrolling.
+	b.WriteString(`<sheetViews><sheetView workbookViewId="0"><pane ySplit="1" topLeftCell="A2" activePane="bottomLeft" state="frozen"/></sheetView></sheetViews>`)
+	if len(sh.widths) > 0 {
+		b.WriteString("<cols>")
+		for i, width := range sh.widths {
+			fmt.Fprintf(&b, `<col min="%d" max="%d" width="%.1f" customWidth="1"/>`, i+1, i+1, width)
+		}
+		b.WriteString("</cols>")
+	}
+	b.WriteString("<sheetData>")
+	for r, row := range sh.rows {
+		fmt.Fprintf(&b, `<row r="%d">`, r+1)
+		for c, cell := range row {
+			ref := xlsxColumn(c) + strconv.Itoa(r+1)
+			switch v := cell.value.(type) {
+			case nil:
+				continue
+			case string:
+				if v == "" {
+					continue
+				}
+				fmt.Fprintf(&b, `<c r="%s" s="%d" t="inlineStr"><is><t xml:space="preserve">%s</t></is></c>`, ref, cell.style, xlsxEscape(v))
+			case int:
+				fmt.Fprintf(&b, `<c r="%s" s="%d"><v>%d</v></c>`, ref, cell.style, v)
+			case int64:
+				fmt.Fprintf(&b, `<c r="%s" s="%d"><v>%d</v></c>`, ref, cell.style, v)
+			case float64:
+				fmt.Fprintf(&b, `<c r="%s" s="%d"><v>%s</v></c>`, ref, cell.style, strconv.FormatFloat(v, 'f', -1, 64))
+			case time.Time:
+				days := v.UTC().Sub(excelEpoch).Hours() / 24
+				fmt.Fprintf(&b, `<c r="%s" s="%d"><v>%s</v></c>`, ref, xlsxStyleDate, strconv.FormatFloat(days, 'f', 8, 64))
+			default:
+				return fmt.Errorf("unsupported cell type %T", v)
+			}
+		}
+		b.WriteString("</row>")
+	}
+	b.WriteString("</sheetData>")
+	if len(sh.rows) > 1 {
+		fmt.Fprintf(&b, `<autoFilter ref="A1:%s%d"/>`, xlsxColumn(len(sh.rows[0])-1), len(sh.rows))
+	}
+	b.WriteString("</worksheet>")
+	_, err := io.WriteString(w, b.String())
+	return err
+}
+
+const xlsxStyles = `<?xml version="1.0" encoding="UTF-8" standalone="yes"?>
+<styleSheet xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main">
+<numFmts count="2"><numFmt numFmtId="164" formatCode="yyyy-mm-dd hh:mm:ss"/><numFmt numFmtId="165" formatCode="0.00&quot;%&quot;"/></numFmts>
+<fonts count="2"><font><sz val="11"/><name val="Calibri"/></font><font><b/><sz val="11"/><name val="Calibri"/></font></fonts>
+<fills count="2"><fill><patternFill patternType="none"/></fill><fill><patternFill patternType="gray125"/></fill></fills>
+<borders count="1"><border><left/><right/><top/><bottom/><diagonal/></border></borders>
+<cellStyleXfs count="1"><xf numFmtId="0" fontId="0" fillId="0" borderId="0"/></cellStyleXfs>
+<cellXfs count="4">
+<xf numFmtId="0" fontId="0" fillId="0" borderId="0" xfId="0"/>
+<xf numFmtId="0" fontId="1" fillId="0" borderId="0" xfId="0" applyFont="1"/>
+<xf numFmtId="164" fontId="0" fillId="0" borderId="0" xfId="0" applyNumberFormat="1"/>
+<xf numFmtId="165" fontId="0" fillId="0" borderId="0" xfId="0" applyNumberFormat="1"/>
+</cellXfs>
+</styleSheet>`
+
+// writeXLSX packages sheets as an Office Open XML workbook.
+func writeXLSX(sheets []*xlsxSheet) ([]byte, error) {
+	var buf bytes.Buffer
+	zw := zip.NewWriter(&buf)
+	add := func(name, content string) error {
+		w, err := zw.Create(name)
+		if err != nil {
+			return err
+		}
+		_, err = io.WriteString(w, content)
+		return err
+	}
+
+	var overrides, sheetEntries, rels strings.Builder
+	for i, sh := range sheets {
+		fmt.Fprintf(&overrides, `<Override PartName="/xl/worksheets/sheet%d.xml" ContentType="application/vnd.openxmlformats-officedocument.spreadsheetml.worksheet+xml"/>`, i+1)
+		fmt.Fprintf(&sheetEntries, `<sheet name="%s" sheetId="%d" r:id="rId%d"/>`, xlsxEscape(sh.name), i+1, i+1)
+		fmt.Fprintf(&rels, `<Relationship Id="rId%d" Type="http://schemas.openxmlformats.org/officeDocument/2006/relationships/worksheet" Target="worksheets/sheet%d.xml"/>`, i+1, i+1)
+	}
+	fmt.Fprintf(&rels, `<Relationship Id="rId%d" Type="http://schemas.openxmlformats.org/officeDocument/2006/relationships/styles" Target="styles.xml"/>`, len(sheets)+1)
+
+	files := []struct{ name, content string }{
+		{"[Content_Types].xml", `<?xml version="1.0" encoding="UTF-8" standalone="yes"?>
+<Types xmlns="http://schemas.openxmlformats.org/package/2006/content-types"><Default Extension="rels" ContentType="application/vnd.openxmlformats-package.relationships+xml"/><Default Extension="xml" ContentType="application/xml"/><Override PartName="/xl/workbook.xml" ContentType="application/vnd.openxmlformats-officedocument.spreadsheetml.sheet.main+xml"/><Override PartName="/xl/styles.xml" ContentType="application/vnd.openxmlformats-officedocument.spreadsheetml.styles+xml"/>` + overrides.String() + `</Types>`},
+		{"_rels/.rels", `<?xml version="1.0" encoding="UTF-8" standalone="yes"?>
+<Relationships xmlns="http://schemas.openxmlformats.org/package/2006/relationships"><Relationship Id="rId1" Type="http://schemas.openxmlformats.org/officeDocument/2006/relationships/officeDocument" Target="xl/workbook.xml"/></Relationships>`},
+		{"xl/workbook.xml", `<?xml version="1.0" encoding="UTF-8" standalone="yes"?>
+<workbook xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main" xmlns:r="http://schemas.openxmlformats.org/officeDocument/2006/relationships"><sheets>` + sheetEntries.String() + `</sheets></workbook>`},
+		{"xl/_rels/workbook.xml.rels", `<?xml version="1.0" encoding="UTF-8" standalone="yes"?>
+<Relationships xmlns="http://schemas.openxmlformats.org/package/2006/relationships">` + rels.String() + `</Relationships>`},
+		{"xl/styles.xml", xlsxStyles},
+	}
+	for _, f := range files {
+		if err := add(f.name, f.content); err != nil {
+			return nil, fmt.Errorf("error writing %s: %v", f.name, err)
+		}
+	}
+	for i, sh := range sheets {
+		w, err := zw.Create(fmt.Sprintf("xl/worksheets/sheet%d.xml", i+1))
+		if err != nil {
+			return nil, err
+		}
+		if err := sh.write(w); err != nil {
+			return nil, fmt.Errorf("error writing sheet %q: %v", sh.name, err)
+		}
+	}
+	if err := zw.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+func headerRow(names ...string) []xlsxCell {
+	row := make([]xlsxCell, len(names))
+	for i, name := range names {
+		row[i] = xlsxCell{name, xlsxStyleHeader}
+	}
+	return row
+}
+
+// XLSX writes an Excel workbook with the raw logs on a "Logs"
+// sheet, per-path statistics on a "Paths" sheet and, when analysis is
+// given, its insights, issues and slow pages on an "Insights" sheet.
+// Timestamps that parse become Excel dates and numbers stay numeric; each
+// key in metadataColumns adds a "metadata.<key>" column to the logs.
+func XLSX(logs []parser.LogEntry, metadataColumns []string, analysis *analytics.AnalysisResult) ([]byte, error) {
+	logSheet := &xlsxSheet{name: "Logs", widths: []float64{20, 8, 40, 30, 8, 10, 8}}
+	header := headerRow("timestamp", "level", "message", "path", "method", "duration", "status")
+	for _, key := range metadataColumns {
+		header = append(header, xlsxCell{aggregator.MetadataColumn(key), xlsxStyleHeader})
+		logSheet.widths = append(logSheet.widths, 18)
+	}
+	logSheet.rows = append(logSheet.rows, header)
+	for _, log := range logs {
+		var ts interface{} = log.Timestamp
+		if t, ok := parser.ParseTimestamp(log.Timestamp); ok {
+			ts = t
+		}
+		row := []xlsxCell{{ts, 0}, {log.Level, 0}, {log.Message, 0}, {log.Path, 0}, {log.Method, 0}, {log.Duration, 0}, {log.Status, 0}}
+		for _, key := range metadataColumns {
+			row = append(row, xlsxCell{log.Metadata[key], 0})
+		}
+		logSheet.rows = append(logSheet.rows, row)
+	}
+
+	pathSheet := &xlsxSheet{name: "Paths", widths: []float64{40, 10, 10, 12, 16, 16}}
+	pathSheet.rows = append(pathSheet.rows, headerRow("path", "requests", "errors", "error_rate", "avg_duration_ms", "p95_duration_ms"))
+	for _, stat := range aggregator.GroupStats(logs, nil) {
+		pathSheet.rows = append(pathSheet.rows, []xlsxCell{
+			{stat.Value, 0}, {stat.Requests, 0}, {stat.Errors, 0},
+			{stat.ErrorRate, xlsxStylePercent}, {stat.AvgDuration, 0}, {stat.P95Duration, 0},
+		})
+	}
+
+	sheets := []*xlsxSheet{logSheet, pathSheet}
+	if analysis != nil {
+		insights := &xlsxSheet{name: "Insights", widths: []float64{16, 10, 20, 80, 40, 12, 10, 14}}
+		insights.rows = append(insights.rows, headerRow("section", "severity", "type", "detail", "paths", "confidence", "grounded", "category"))
+		for _, insight := range analysis.Insights {
+			insights.rows = append(insights.rows, []xlsxCell{
+				{"insight", 0}, {"", 0}, {"", 0}, {insight.Text, 0}, {"", 0},
+				{insight.Confidence * 100, xlsxStylePercent}, {yesNo(insight.Grounded), 0}, {insight.Category, 0},
+			})
+		}
+		for _, issue := range analysis.PotentialIssues {
+			insights.rows = append(insights.rows, []xlsxCell{
+				{"potential_issue", 0}, {issue.Severity, 0}, {issue.Type, 0}, {issue.Description, 0},
+				{strings.Join(issue.Path, ", "), 0},
+				{issue.Confidence * 100, xlsxStylePercent}, {yesNo(issue.Grounded), 0}, {issue.Category, 0},
+			})
+		}
+		for _, page := range analysis.SlowPages {
+			detail := fmt.Sprintf("avg %dms over %d requests, %.1f%% errors", page.AvgDuration, page.RequestCount, page.ErrorRate)
+			insights.rows = append(insights.rows, []xlsxCell{{"slow_page", 0}, {"", 0}, {"", 0}, {detail, 0}, {page.Path, 0}})
+		}
+		for _, page := range analysis.PopularPages {
+			insights.rows = append(insights.rows, []xlsxCell{{"popular_page", 0}, {"", 0}, {"", 0}, {"", 0}, {page, 0}})
+		}
+		sheets = append(sheets, insights)
+	}
+	return writeXLSX(sheets)
+}
+
+func yesNo(b bool) string {
+	if b {
+		return "yes"
+	}
+	return "no"
+}
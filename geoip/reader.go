@@ -0,0 +1,85 @@
+// Package geoip looks up client locations in MaxMind DB (.mmdb) files such
+// as GeoLite2-Country and GeoLite2-City.
+package geoip
+
+import (
+	"fmt"
+	"net"
+
+	"github.com/oschwald/maxminddb-golang"
+)
+
+// Location is the subset of a GeoIP record used for log enrichment.
+type Location struct {
+	CountryCode string
+	CountryName string
+	RegionCode  string
+	RegionName  string
+	City        string
+}
+
+// Reader looks up IP addresses in a MaxMind database.
+type Reader struct {
+	db *maxminddb.Reader
+}
+
+// Open opens the database at path.
+func Open(path string) (*Reader, error) {
+	db, err := maxminddb.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("error reading GeoIP database: %v", err)
+	}
+	return &Reader{db: db}, nil
+}
+
+// FromBytes reads a database already held in memory.
+func FromBytes(buf []byte) (*Reader, error) {
+	db, err := maxminddb.FromBytes(buf)
+	if err != nil {
+		return nil, fmt.Errorf("invalid GeoIP database: %v", err)
+	}
+	return &Reader{db: db}, nil
+}
+
+// Close releases the database.
+func (r *Reader) Close() error {
+	return r.db.Close()
+}
+
+type place struct {
+	ISOCode string            `maxminddb:"iso_code"`
+	Names   map[string]string `maxminddb:"names"`
+}
+
+// record holds the fields of GeoLite2/GeoIP2 Country and City records that
+// Lookup uses.
+type record struct {
+	Country           place   `maxminddb:"country"`
+	RegisteredCountry place   `maxminddb:"registered_country"`
+	Subdivisions      []place `maxminddb:"subdivisions"`
+	City              place   `maxminddb:"city"`
+}
+
+// Lookup returns the location for ip in a GeoLite2/GeoIP2 Country or City
+// database.
+func (r *Reader) Lookup(ip net.IP) (Location, bool) {
+	var rec record
+	if err := r.db.Lookup(ip, &rec); err != nil {
+		return Location{}, false
+	}
+
+	country := rec.Country
+	if country.ISOCode == "" {
+		country = rec.RegisteredCountry
+	}
+	loc := Location{
+		CountryCode: country.ISOCode,
+		CountryName: country.Names["en"],
+		City:        rec.City.Names["en"],
+	}
+	if len(rec.Subdivisions) > 0 {
+		loc.RegionCode = rec.Subdivisions[0].ISOCode
+		loc.RegionName = rec.Subdivisions[0].Names["en"]
+	}
+	return loc, loc.CountryCode != ""
+}
@@ -0,0 +1,258 @@
+// Package grafana serves the metrics of stored analyses through the Grafana
+// JSON datasource protocol.
+package grafana
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"analyticsai/ai-service/analytics/aggregator"
+)
+
+// Metrics of a whole analysis. Targets of the form "<metric>:<path>" chart
+// the endpoint metrics of a path instead.
+var (
+	analysisMetrics = []string{"requests", "error_rate", "avg_duration", "p95_duration", "slow_endpoints", "issues"}
+	endpointMetrics = []string{"requests", "errors", "error_rate", "avg_duration", "p95_duration"}
+)
+
+// Sample is the metrics snapshot of one stored analysis.
+type Sample struct {
+	Time    time.Time
+	Source  string // the analysis's source name
+	Kind    string
+	Metrics *aggregator.MetricsSnapshot
+}
+
+// Target is one query of a panel.
+type Target struct {
+	Target  string          `json:"target"`
+	RefID   string          `json:"refId"`
+	Type    string          `json:"type"` // "timeserie" (default) or "table"
+	Hide    bool            `json:"hide"`
+	Payload json.RawMessage `json:"payload"` // optional {"source": ..., "kind": ...}
+}
+
+// QueryRequest is the body of a /query request.
+type QueryRequest struct {
+	Range struct {
+		From time.Time `json:"from"`
+		To   time.Time `json:"to"`
+	} `json:"range"`
+	MaxDataPoints int      `json:"maxDataPoints"`
+	Targets       []Target `json:"targets"`
+}
+
+// TimeSeries is a time series response; each datapoint is [value, unix ms].
+type TimeSeries struct {
+	Target     string       `json:"target"`
+	RefID      string       `json:"refId,omitempty"`
+	Datapoints [][2]float64 `json:"datapoints"`
+}
+
+type TableColumn struct {
+	Text string `json:"text"`
+	Type string `json:"type"`
+}
+
+// Table is a table response with one row per analysis.
+type Table struct {
+	Type    string          `json:"type"`
+	RefID   string          `json:"refId,omitempty"`
+	Columns []TableColumn   `json:"columns"`
+	Rows    [][]interface{} `json:"rows"`
+}
+
+// payloadFilter restricts a target to the analyses of one source or kind.
+type payloadFilter struct {
+	Source string `json:"source"`
+	Kind   string `json:"kind"`
+}
+
+// parsePayload decodes a target payload. Grafana sends an empty string or
+// object when none is set, so anything but an object means no filter.
+func parsePayload(raw json.RawMessage) payloadFilter {
+	var f payloadFilter
+	if len(raw) > 0 && raw[0] == '{' {
+		json.Unmarshal(raw, &f)
+	}
+	return f
+}
+
+func (f payloadFilter) match(s Sample) bool {
+	return (f.Source == "" || s.Source == f.Source) && (f.Kind == "" || s.Kind == f.Kind)
+}
+
+func contains(values []string, s string) bool {
+	for _, v := range values {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
+
+// parseTarget splits a target into its metric and, for endpoint targets,
+// path.
+func parseTarget(target string) (metric, path string, err error) {
+	metric, path, _ = strings.Cut(target, ":")
+	metric = strings.TrimSpace(metric)
+	if path == "" && contains(analysisMetrics, metric) || path != "" && contains(endpointMetrics, metric) {
+		return metric, path, nil
+	}
+	return "", "", fmt.Errorf("unknown target %q", target)
+}
+
+// value returns metric of the snapshot, or of the endpoint path when set.
+// Paths outside the snapshot's busiest endpoints have no value.
+func value(m *aggregator.MetricsSnapshot, metric, path string) (float64, bool) {
+	if path == "" {
+		switch metric {
+		case "requests":
+			return float64(m.Requests), true
+		case "error_rate":
+			return m.ErrorRate, true
+		case "avg_duration":
+			return float64(m.AvgDuration), true
+		case "p95_duration":
+			return float64(m.P95Duration), true
+		case "slow_endpoints":
+			return float64(m.SlowEndpoints), true
+		case "issues":
+			return float64(m.Issues), true
+		}
+		return 0, false
+	}
+	for _, e := range m.Endpoints {
+		if e.Value != path {
+			continue
+		}
+		switch metric {
+		case "requests":
+			return float64(e.Requests), true
+		case "errors":
+			return float64(e.Errors), true
+		case "error_rate":
+			return e.ErrorRate, true
+		case "avg_duration":
+			return float64(e.AvgDuration), true
+		case "p95_duration":
+			return float64(e.P95Duration), true
+		}
+	}
+	return 0, false
+}
+
+// Search returns the targets containing query: every analysis metric, and
+// the endpoint metrics of each path in samples.
+func Search(samples []Sample, query string) []string {
+	query = strings.ToLower(strings.TrimSpace(query))
+	targets := append([]string{}, analysisMetrics...)
+	seen := make(map[string]bool)
+	var paths []string
+	for _, s := range samples {
+		for _, e := range s.Metrics.Endpoints {
+			if !seen[e.Value] {
+				seen[e.Value] = true
+				paths = append(paths, e.Value)
+			}
+		}
+	}
+	sort.Strings(paths)
+	for _, path := range paths {
+		for _, metric := range endpointMetrics {
+			targets = append(targets, metric+":"+path)
+		}
+	}
+
+	matched := []string{}
+	for _, t := range targets {
+		if strings.Contains(strings.ToLower(t), query) {
+			matched = append(matched, t)
+		}
+	}
+	return matched
+}
+
+// Query answers the targets of req from samples, returning a TimeSeries
+// per target and source for time series targets and a Table for table
+// targets.
+func Query(req QueryRequest, samples []Sample) ([]interface{}, error) {
+	sorted := append([]Sample{}, samples...)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i].Time.Before(sorted[j].Time) })
+
+	results := []interface{}{}
+	for _, t := range req.Targets {
+		if t.Hide || t.Target == "" {
+			continue
+		}
+		filter := parsePayload(t.Payload)
+		if t.Type == "table" {
+			results = append(results, table(t, filter, sorted))
+			continue
+		}
+
+		metric, path, err := parseTarget(t.Target)
+		if err != nil {
+			return nil, err
+		}
+		// One series per source, in order of first appearance.
+		bySource := make(map[string]*TimeSeries)
+		var order []string
+		for _, s := range sorted {
+			if !filter.match(s) {
+				continue
+			}
+			v, ok := value(s.Metrics, metric, path)
+			if !ok {
+				continue
+			}
+			series, ok := bySource[s.Source]
+			if !ok {
+				name := t.Target
+				if s.Source != "" {
+					name = fmt.Sprintf("%s (%s)", t.Target, s.Source)
+				}
+				series = &TimeSeries{Target: name, RefID: t.RefID, Datapoints: [][2]float64{}}
+				bySource[s.Source] = series
+				order = append(order, s.Source)
+			}
+			series.Datapoints = append(series.Datapoints, [2]float64{v, float64(s.Time.UnixMilli())})
+		}
+		for _, source := range order {
+			series := bySource[source]
+			if n := req.MaxDataPoints; n > 0 && len(series.Datapoints) > n {
+				series.Datapoints = series.Datapoints[len(series.Datapoints)-n:]
+			}
+			results = append(results, series)
+		}
+	}
+	return results, nil
+}
+
+func table(t Target, filter payloadFilter, samples []Sample) Table {
+	tbl := Table{
+		Type:  "table",
+		RefID: t.RefID,
+		Columns: []TableColumn{
+			{"Time", "time"}, {"Source", "string"}, {"Kind", "string"},
+			{"Requests", "number"}, {"Error rate", "number"}, {"Avg duration", "number"},
+			{"p95 duration", "number"}, {"Slow endpoints", "number"}, {"Issues", "number"},
+		},
+		Rows: [][]interface{}{},
+	}
+	for _, s := range samples {
+		if !filter.match(s) {
+			continue
+		}
+		m := s.Metrics
+		tbl.Rows = append(tbl.Rows, []interface{}{
+			s.Time.UnixMilli(), s.Source, s.Kind,
+			m.Requests, m.ErrorRate, m.AvgDuration, m.P95Duration, m.SlowEndpoints, m.Issues,
+		})
+	}
+	return tbl
+}
@@ -0,0 +1,158 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"strconv"
+	"time"
+
+	"analyticsai/ai-service/analytics"
+	"analyticsai/ai-service/analytics/parser"
+	"analyticsai/ai-service/kafka"
+)
+
+// decodeEntries decodes one log entry as a JSON object, or several as an
+// array.
+func decodeEntries(data []byte, mapping parser.FieldMapping) ([]analytics.LogEntry, error) {
+	data = bytes.TrimSpace(data)
+	if len(data) > 0 && data[0] == '{' {
+		data = append(append([]byte{'['}, data...), ']')
+	}
+	return parser.DecodeLogs(data, mapping)
+}
+
+// newIngestBuffer returns a buffer for /ingest, journaled in bufferStore
+// when it is set.
+func newIngestBuffer(tenant, name string) *analytics.LogBuffer {
+	buffer := analytics.NewLogBuffer(ingestBufferSize, ingestBufferWindow)
+	if bufferStore != nil {
+		buffer.SetJournal(bufferJournal{tenant: tenant, name: name})
+	}
+	return buffer
+}
+
+// bufferJournal records a log buffer in bufferStore, one JSON-encoded
+// batch per record.
+type bufferJournal struct {
+	tenant, name string
+}
+
+func (j bufferJournal) Append(batch analytics.BufferedBatch) error {
+	record, err := json.Marshal(batch)
+	if err != nil {
+		return err
+	}
+	return bufferStore.Append(j.tenant, j.name, record)
+}
+
+func (j bufferJournal) Rewrite(batches []analytics.BufferedBatch) error {
+	records := make([][]byte, 0, len(batches))
+	for _, batch := range batches {
+		record, err := json.Marshal(batch)
+		if err != nil {
+			return err
+		}
+		records = append(records, record)
+	}
+	return bufferStore.Rewrite(j.tenant, j.name, records)
+}
+
+// restoreLogBuffers recreates the buffers journaled in bufferStore and
+// returns how many there were.
+func restoreLogBuffers() (int, error) {
+	stored, err := bufferStore.List()
+	if err != nil {
+		return 0, err
+	}
+	for _, sb := range stored {
+		records, err := bufferStore.Load(sb.Tenant, sb.Name)
+		if err != nil {
+			return 0, fmt.Errorf("buffer %q of tenant %q: %v", sb.Name, sb.Tenant, err)
+		}
+		batches := make([]analytics.BufferedBatch, 0, len(records))
+		for i, record := range records {
+			var batch analytics.BufferedBatch
+			if err := json.Unmarshal(record, &batch); err != nil {
+				return 0, fmt.Errorf("buffer %q of tenant %q: record %d: %v", sb.Name, sb.Tenant, i+1, err)
+			}
+			batches = append(batches, batch)
+		}
+		buffer := newIngestBuffer(sb.Tenant, sb.Name)
+		buffer.Restore(batches)
+		logBuffers.GetOrCreate(sb.Tenant, sb.Name, func() *analytics.LogBuffer { return buffer })
+	}
+	return len(stored), nil
+}
+
+// kafkaBufferName is the name of the log buffer the Kafka consumer fills.
+const kafkaBufferName = "kafka"
+
+// startKafkaConsumer starts consuming cfg's topics into the kafka buffer of
+// KAFKA_TENANT, which keeps the last KAFKA_BUFFER_SIZE entries received
+// within KAFKA_BUFFER_WINDOW. Messages are decoded with KAFKA_FIELD_MAP.
+func startKafkaConsumer(cfg kafka.Config) error {
+	size := 100000
+	if raw := os.Getenv("KAFKA_BUFFER_SIZE"); raw != "" {
+		n, err := strconv.Atoi(raw)
+		if err != nil || n <= 0 {
+			return fmt.Errorf("invalid KAFKA_BUFFER_SIZE: %q", raw)
+		}
+		size = n
+	}
+	window := time.Hour
+	if raw := os.Getenv("KAFKA_BUFFER_WINDOW"); raw != "" {
+		d, err := time.ParseDuration(raw)
+		if err != nil || d < 0 {
+			return fmt.Errorf("invalid KAFKA_BUFFER_WINDOW: %q", raw)
+		}
+		window = d
+	}
+	var mapping parser.FieldMapping
+	if raw := os.Getenv("KAFKA_FIELD_MAP"); raw != "" {
+		var err error
+		if mapping, err = parser.ParseFieldMapping(raw); err != nil {
+			return fmt.Errorf("invalid KAFKA_FIELD_MAP: %v", err)
+		}
+	}
+	kafkaTenant = os.Getenv("KAFKA_TENANT")
+	if kafkaTenant == "" || tenantRegistry == nil {
+		kafkaTenant = analytics.DefaultTenant
+	}
+
+	newBuffer := func() *analytics.LogBuffer {
+		return analytics.NewLogBuffer(size, window)
+	}
+	consumer, err := kafka.NewConsumer(cfg, func(r kafka.Record) error {
+		logs, err := decodeKafkaMessage(r, mapping)
+		if err != nil {
+			return err
+		}
+		// The buffer is recreated if the tenant's data was deleted.
+		return logBuffers.GetOrCreate(kafkaTenant, kafkaBufferName, newBuffer).Append(logs)
+	})
+	if err != nil {
+		return err
+	}
+	logBuffers.GetOrCreate(kafkaTenant, kafkaBufferName, newBuffer)
+	kafkaConsumer = consumer
+	go consumer.Run(context.Background())
+	return nil
+}
+
+// decodeKafkaMessage decodes the log entries of a message. Entries without
+// a timestamp take the message's.
+func decodeKafkaMessage(r kafka.Record, mapping parser.FieldMapping) ([]analytics.LogEntry, error) {
+	logs, err := decodeEntries(r.Value, mapping)
+	if err != nil {
+		return nil, err
+	}
+	for i := range logs {
+		if logs[i].Timestamp == "" {
+			logs[i].Timestamp = r.Time.Format(time.RFC3339Nano)
+		}
+	}
+	return logs, nil
+}
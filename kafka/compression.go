@@ -0,0 +1,282 @@
+package kafka
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+
+	"github.com/klauspost/compress/snappy"
+	"github.com/klauspost/compress/zstd"
+)
+
+// Compression codecs of record batches.
+const (
+	compressionNone   = 0
+	compressionGzip   = 1
+	compressionSnappy = 2
+	compressionLZ4    = 3
+	compressionZstd   = 4
+)
+
+// maxDecompressedBatch bounds the records of one batch once decompressed.
+// A fetch returns at most partitionBytes of compressed data per partition,
+// but a batch compressed by a hostile or broken producer can expand far
+// beyond that.
+const maxDecompressedBatch = 64 << 20
+
+var errBatchTooLarge = fmt.Errorf("decompressed record batch exceeds %d bytes", maxDecompressedBatch)
+
+// zstdDecoder is shared by all consumers; DecodeAll is safe for concurrent
+// use.
+var zstdDecoder, _ = zstd.NewReader(nil, zstd.WithDecoderConcurrency(0), zstd.WithDecoderMaxMemory(maxDecompressedBatch))
+
+// decompress returns the records of a batch compressed with codec.
+func decompress(codec int16, data []byte) ([]byte, error) {
+	switch codec {
+	case compressionNone:
+		return data, nil
+	case compressionGzip:
+		return gunzip(data)
+	case compressionSnappy:
+		return unsnappy(data)
+	case compressionLZ4:
+		return unlz4(data)
+	case compressionZstd:
+		records, err := zstdDecoder.DecodeAll(data, nil)
+		if errors.Is(err, zstd.ErrDecoderSizeExceeded) || errors.Is(err, zstd.ErrWindowSizeExceeded) {
+			return nil, errBatchTooLarge
+		}
+		return records, err
+	}
+	return nil, fmt.Errorf("unknown compression codec %d", codec)
+}
+
+func gunzip(data []byte) ([]byte, error) {
+	r, err := gzip.NewReader(bytes.NewReader(data))
+	if err != nil {
+		return nil, err
+	}
+	defer r.Close()
+	records, err := io.ReadAll(io.LimitReader(r, maxDecompressedBatch+1))
+	if err != nil {
+		return nil, err
+	}
+	if len(records) > maxDecompressedBatch {
+		return nil, errBatchTooLarge
+	}
+	return records, nil
+}
+
+// xerialHeader starts snappy data in the framing of the Java client, which
+// splits it into separately compressed blocks. librdkafka and other clients
+// write a single raw snappy block instead.
+var xerialHeader = []byte{0x82, 'S', 'N', 'A', 'P', 'P', 'Y', 0}
+
+func unsnappy(data []byte) ([]byte, error) {
+	if !bytes.HasPrefix(data, xerialHeader) {
+		return unsnappyBlock(nil, data)
+	}
+	if len(data) < 16 {
+		return nil, errors.New("snappy: truncated xerial header")
+	}
+	data = data[16:] // header, version and compatible version
+	var records []byte
+	for len(data) > 0 {
+		if len(data) < 4 {
+			return nil, errors.New("snappy: truncated xerial block")
+		}
+		n := binary.BigEndian.Uint32(data)
+		if uint64(n) > uint64(len(data)-4) {
+			return nil, errors.New("snappy: truncated xerial block")
+		}
+		var err error
+		if records, err = unsnappyBlock(records, data[4:4+n]); err != nil {
+			return nil, err
+		}
+		data = data[4+n:]
+	}
+	return records, nil
+}
+
+// unsnappyBlock appends the decoded snappy block to records.
+func unsnappyBlock(records, block []byte) ([]byte, error) {
+	n, err := snappy.DecodedLen(block)
+	if err != nil {
+		return nil, err
+	}
+	if n > maxDecompressedBatch-len(records) {
+		return nil, errBatchTooLarge
+	}
+	decoded, err := snappy.Decode(nil, block)
+	if err != nil {
+		return nil, err
+	}
+	return append(records, decoded...), nil
+}
+
+// LZ4 frame format constants.
+const (
+	lz4Magic          = 0x184D2204
+	lz4SkippableMask  = 0xFFFFFFF0
+	lz4SkippableMagic = 0x184D2A50
+	lz4Uncompressed   = 1 << 31
+)
+
+var errLZ4Truncated = errors.New("lz4: truncated frame")
+
+// unlz4 decodes the LZ4 frames Kafka writes for magic 2 batches. Checksums
+// are not verified; the batch CRC already covers the compressed data.
+func unlz4(data []byte) ([]byte, error) {
+	var records []byte
+	for len(data) > 0 {
+		if len(data) < 4 {
+			return nil, errLZ4Truncated
+		}
+		magic := binary.LittleEndian.Uint32(data)
+		if magic&lz4SkippableMask == lz4SkippableMagic {
+			if len(data) < 8 {
+				return nil, errLZ4Truncated
+			}
+			n := binary.LittleEndian.Uint32(data[4:])
+			if uint64(n) > uint64(len(data)-8) {
+				return nil, errLZ4Truncated
+			}
+			data = data[8+n:]
+			continue
+		}
+		if magic != lz4Magic {
+			return nil, fmt.Errorf("lz4: invalid frame magic %#x", magic)
+		}
+		if len(data) < 7 {
+			return nil, errLZ4Truncated
+		}
+		flags := data[4]
+		if flags>>6 != 1 {
+			return nil, fmt.Errorf("lz4: unsupported frame version %d", flags>>6)
+		}
+		blockChecksum := flags&0x10 != 0
+		contentChecksum := flags&0x04 != 0
+		header := 7 // magic, FLG, BD and header checksum
+		if flags&0x08 != 0 {
+			header += 8 // content size
+		}
+		if flags&0x01 != 0 {
+			header += 4 // dictionary id
+		}
+		if len(data) < header {
+			return nil, errLZ4Truncated
+		}
+		data = data[header:]
+
+		for {
+			if len(data) < 4 {
+				return nil, errLZ4Truncated
+			}
+			size := binary.LittleEndian.Uint32(data)
+			data = data[4:]
+			if size == 0 {
+				break // end mark
+			}
+			n := size &^ lz4Uncompressed
+			if uint64(n) > uint64(len(data)) {
+				return nil, errLZ4Truncated
+			}
+			block := data[:n]
+			data = data[n:]
+			if blockChecksum {
+				if len(data) < 4 {
+					return nil, errLZ4Truncated
+				}
+				data = data[4:]
+			}
+			var err error
+			if size&lz4Uncompressed != 0 {
+				if len(block) > maxDecompressedBatch-len(records) {
+					return nil, errBatchTooLarge
+				}
+				records = append(records, block...)
+			} else if records, err = unlz4Block(records, block); err != nil {
+				return nil, err
+			}
+		}
+		if contentChecksum {
+			if len(data) < 4 {
+				return nil, errLZ4Truncated
+			}
+			data = data[4:]
+		}
+	}
+	return records, nil
+}
+
+// unlz4Block appends the decoded LZ4 block to out. Matches may reach back
+// into earlier blocks of the frame, which out still holds.
+func unlz4Block(out, block []byte) ([]byte, error) {
+	// length reads the extension bytes of a 4-bit length that is 15.
+	length := func(n int) (int, error) {
+		for n >= 15 {
+			if len(block) == 0 {
+				return 0, errLZ4Truncated
+			}
+			b := block[0]
+			block = block[1:]
+			n += int(b)
+			if n > maxDecompressedBatch {
+				return 0, errBatchTooLarge
+			}
+			if b != 255 {
+				break
+			}
+		}
+		return n, nil
+	}
+
+	for {
+		if len(block) == 0 {
+			return nil, errLZ4Truncated
+		}
+		token := block[0]
+		block = block[1:]
+
+		literals, err := length(int(token >> 4))
+		if err != nil {
+			return nil, err
+		}
+		if literals > len(block) {
+			return nil, errLZ4Truncated
+		}
+		if literals > maxDecompressedBatch-len(out) {
+			return nil, errBatchTooLarge
+		}
+		out = append(out, block[:literals]...)
+		block = block[literals:]
+		if len(block) == 0 {
+			return out, nil // the last sequence has no match
+		}
+
+		if len(block) < 2 {
+			return nil, errLZ4Truncated
+		}
+		offset := int(binary.LittleEndian.Uint16(block))
+		block = block[2:]
+		if offset == 0 || offset > len(out) {
+			return nil, fmt.Errorf("lz4: invalid match offset %d", offset)
+		}
+		match, err := length(int(token & 0x0F))
+		if err != nil {
+			return nil, err
+		}
+		match += 4
+		if match > maxDecompressedBatch-len(out) {
+			return nil, errBatchTooLarge
+		}
+		// Byte by byte: a match may overlap the bytes it produces.
+		start := len(out) - offset
+		for i := 0; i < match; i++ {
+			out = append(out, out[start+i])
+		}
+	}
+}
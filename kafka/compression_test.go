@@ -0,0 +1,70 @@
+package kafka
+
+import (
+	"os"
+	"strings"
+	"testing"
+)
+
+// The fixtures were written by the reference lz4 CLI (v1.9.4):
+//
+//	lz4 small.txt small.lz4
+//	lz4 -B4 -BD -BX --content-size orders.txt orders.lz4
+//
+// orders.lz4 has 64 KB blocks that refer back to earlier ones, block
+// checksums and a content size.
+func TestUnlz4Reference(t *testing.T) {
+	tests := []struct {
+		file, want string
+	}{
+		{"testdata/small.lz4", "Kafka record batches compressed with LZ4, LZ4, LZ4 frames!"},
+		{"testdata/orders.lz4", strings.Repeat("GET /api/orders 200\n", 8000)},
+	}
+	for _, tt := range tests {
+		data, err := os.ReadFile(tt.file)
+		if err != nil {
+			t.Fatal(err)
+		}
+		got, err := unlz4(data)
+		if err != nil {
+			t.Fatalf("%s: %v", tt.file, err)
+		}
+		if string(got) != tt.want {
+			t.Errorf("%s: decoded %d bytes that differ from the %d bytes compressed", tt.file, len(got), len(tt.want))
+		}
+
+		// Concatenated frames decode to the concatenated content.
+		got, err = unlz4(append(append([]byte{}, data...), data...))
+		if err != nil || string(got) != tt.want+tt.want {
+			t.Errorf("%s twice: %d bytes, %v", tt.file, len(got), err)
+		}
+
+		// Cut-off frames fail without panicking.
+		for n := 1; n < len(data)-4; n += 7 {
+			if _, err := unlz4(data[:n]); err == nil {
+				t.Errorf("%s cut at %d: no error", tt.file, n)
+			}
+		}
+	}
+}
+
+func TestDecompressLimits(t *testing.T) {
+	// A literal run followed by a match copying the last byte far beyond
+	// maxDecompressedBatch.
+	block := []byte{0x1F, 'x', 1, 0}
+	for n := 0; n < maxDecompressedBatch/255+1; n++ {
+		block = append(block, 255)
+	}
+	block = append(block, 0, 'y', 'y', 'y', 'y', 'y')
+	if _, err := unlz4Block(nil, block); err != errBatchTooLarge {
+		t.Errorf("lz4 bomb: err = %v, want %v", err, errBatchTooLarge)
+	}
+
+	zeros := make([]byte, maxDecompressedBatch+1)
+	if _, err := decompress(compressionZstd, zstdBytes(zeros)); err == nil {
+		t.Error("zstd bomb: no error")
+	}
+	if _, err := decompress(compressionSnappy, xerialSnappy(1<<20)(zeros)); err != errBatchTooLarge {
+		t.Errorf("snappy bomb: err = %v, want %v", err, errBatchTooLarge)
+	}
+}
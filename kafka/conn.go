@@ -0,0 +1,291 @@
+package kafka
+
+import (
+	"bufio"
+	"crypto/tls"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"net"
+	"time"
+)
+
+// maxResponseSize bounds the responses the client reads, well above the
+// fetch size it asks for.
+const maxResponseSize = 256 << 20
+
+// conn is a connection to one broker. Requests are sent one at a time.
+type conn struct {
+	addr          string
+	nc            net.Conn
+	r             *bufio.Reader
+	clientID      string
+	correlationID int32
+}
+
+// dial connects to the broker at addr with the TLS and SASL settings of
+// cfg.
+func dial(addr string, cfg *Config, timeout time.Duration) (*conn, error) {
+	dialer := &net.Dialer{Timeout: timeout, KeepAlive: 30 * time.Second}
+	var nc net.Conn
+	var err error
+	if cfg.TLS != nil {
+		nc, err = tls.DialWithDialer(dialer, "tcp", addr, cfg.TLS)
+	} else {
+		nc, err = dialer.Dial("tcp", addr)
+	}
+	if err != nil {
+		return nil, err
+	}
+	c := &conn{addr: addr, nc: nc, r: bufio.NewReader(nc), clientID: cfg.ClientID}
+	if cfg.SASL != nil {
+		if err := c.authenticate(cfg.SASL, timeout); err != nil {
+			nc.Close()
+			return nil, err
+		}
+	}
+	return c, nil
+}
+
+func (c *conn) Close() error {
+	return c.nc.Close()
+}
+
+// roundTrip sends a request with body and returns the body of its response.
+func (c *conn) roundTrip(apiKey, apiVersion int16, body []byte, timeout time.Duration) (*decoder, error) {
+	c.correlationID++
+	req := &encoder{b: make([]byte, 4, 4+10+len(c.clientID)+len(body))}
+	req.int16(apiKey)
+	req.int16(apiVersion)
+	req.int32(c.correlationID)
+	req.string(c.clientID)
+	req.b = append(req.b, body...)
+	binary.BigEndian.PutUint32(req.b, uint32(len(req.b)-4))
+
+	if err := c.nc.SetDeadline(time.Now().Add(timeout)); err != nil {
+		return nil, err
+	}
+	if _, err := c.nc.Write(req.b); err != nil {
+		return nil, fmt.Errorf("kafka: write to %s: %v", c.addr, err)
+	}
+	var header [8]byte
+	if _, err := io.ReadFull(c.r, header[:]); err != nil {
+		return nil, fmt.Errorf("kafka: read from %s: %v", c.addr, err)
+	}
+	size := int32(binary.BigEndian.Uint32(header[:4]))
+	if size < 4 || size > maxResponseSize {
+		return nil, fmt.Errorf("kafka: invalid response size %d from %s", size, c.addr)
+	}
+	if id := int32(binary.BigEndian.Uint32(header[4:])); id != c.correlationID {
+		return nil, fmt.Errorf("kafka: response %d from %s does not match request %d", id, c.addr, c.correlationID)
+	}
+	resp := make([]byte, size-4)
+	if _, err := io.ReadFull(c.r, resp); err != nil {
+		return nil, fmt.Errorf("kafka: read from %s: %v", c.addr, err)
+	}
+	return &decoder{b: resp}, nil
+}
+
+// broker is a broker listed in a metadata response.
+type broker struct {
+	id   int32
+	addr string
+}
+
+// partitionMetadata is a partition listed in a metadata response.
+type partitionMetadata struct {
+	topic     string
+	partition int32
+	leader    int32
+	err       int16
+}
+
+// metadata returns the brokers of the cluster and the partitions of
+// topics.
+func (c *conn) metadata(topics []string, timeout time.Duration) (map[int32]broker, []partitionMetadata, error) {
+	req := &encoder{}
+	req.int32(int32(len(topics)))
+	for _, topic := range topics {
+		req.string(topic)
+	}
+	req.int8(0) // allow_auto_topic_creation
+	d, err := c.roundTrip(apiMetadata, metadataVersion, req.b, timeout)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	d.int32() // throttle time
+	brokers := make(map[int32]broker)
+	for i, n := 0, d.arrayLen(); i < n; i++ {
+		id := d.int32()
+		host := d.string()
+		port := d.int32()
+		d.string() // rack
+		brokers[id] = broker{id: id, addr: net.JoinHostPort(host, fmt.Sprint(port))}
+	}
+	d.string() // cluster id
+	d.int32()  // controller id
+	var partitions []partitionMetadata
+	for i, n := 0, d.arrayLen(); i < n; i++ {
+		topicErr := d.int16()
+		topic := d.string()
+		d.int8() // is internal
+		if topicErr != errNone {
+			partitions = append(partitions, partitionMetadata{topic: topic, partition: -1, leader: -1, err: topicErr})
+		}
+		for j, m := 0, d.arrayLen(); j < m; j++ {
+			p := partitionMetadata{topic: topic, err: d.int16(), partition: d.int32(), leader: d.int32()}
+			for k, l := 0, d.arrayLen(); k < l; k++ {
+				d.int32() // replica
+			}
+			for k, l := 0, d.arrayLen(); k < l; k++ {
+				d.int32() // in-sync replica
+			}
+			partitions = append(partitions, p)
+		}
+	}
+	if d.err != nil {
+		return nil, nil, d.err
+	}
+	return brokers, partitions, nil
+}
+
+// topicPartition identifies a partition.
+type topicPartition struct {
+	topic     string
+	partition int32
+}
+
+// listOffsets returns the offset at timestamp (offsetLatest or
+// offsetEarliest) of each partition, all led by the broker c is connected
+// to.
+func (c *conn) listOffsets(partitions []topicPartition, timestamp int64, timeout time.Duration) (map[topicPartition]int64, error) {
+	byTopic := groupByTopic(partitions)
+	req := &encoder{}
+	req.int32(-1) // replica id
+	req.int32(int32(len(byTopic)))
+	for _, t := range byTopic {
+		req.string(t.topic)
+		req.int32(int32(len(t.partitions)))
+		for _, p := range t.partitions {
+			req.int32(p)
+			req.int64(timestamp)
+		}
+	}
+	d, err := c.roundTrip(apiListOffsets, listOffsetsVersion, req.b, timeout)
+	if err != nil {
+		return nil, err
+	}
+
+	offsets := make(map[topicPartition]int64)
+	for i, n := 0, d.arrayLen(); i < n; i++ {
+		topic := d.string()
+		for j, m := 0, d.arrayLen(); j < m; j++ {
+			partition := d.int32()
+			code := d.int16()
+			d.int64() // timestamp
+			offset := d.int64()
+			if code != errNone {
+				return nil, &protocolError{code: code, topic: topic, partition: partition}
+			}
+			offsets[topicPartition{topic, partition}] = offset
+		}
+	}
+	if d.err != nil {
+		return nil, d.err
+	}
+	return offsets, nil
+}
+
+// fetchedPartition is the part of a fetch response for one partition.
+type fetchedPartition struct {
+	err           int16
+	highWatermark int64
+	records       []byte
+}
+
+// fetch reads from offsets of partitions led by the broker c is connected
+// to, waiting up to maxWait for data.
+func (c *conn) fetch(offsets map[topicPartition]int64, maxWait time.Duration, partitionBytes int32, timeout time.Duration) (map[topicPartition]fetchedPartition, error) {
+	partitions := make([]topicPartition, 0, len(offsets))
+	for tp := range offsets {
+		partitions = append(partitions, tp)
+	}
+	byTopic := groupByTopic(partitions)
+	req := &encoder{}
+	req.int32(-1) // replica id
+	req.int32(int32(maxWait / time.Millisecond))
+	req.int32(1) // min bytes
+	req.int32(partitionBytes * int32(len(partitions)))
+	req.int8(0) // read uncommitted
+	req.int32(int32(len(byTopic)))
+	for _, t := range byTopic {
+		req.string(t.topic)
+		req.int32(int32(len(t.partitions)))
+		for _, p := range t.partitions {
+			req.int32(p)
+			req.int64(offsets[topicPartition{t.topic, p}])
+			req.int32(partitionBytes)
+		}
+	}
+	d, err := c.roundTrip(apiFetch, fetchVersion, req.b, timeout+maxWait)
+	if err != nil {
+		return nil, err
+	}
+
+	d.int32() // throttle time
+	fetched := make(map[topicPartition]fetchedPartition)
+	for i, n := 0, d.arrayLen(); i < n; i++ {
+		topic := d.string()
+		for j, m := 0, d.arrayLen(); j < m; j++ {
+			partition := d.int32()
+			p := fetchedPartition{err: d.int16(), highWatermark: d.int64()}
+			d.int64() // last stable offset
+			for k, l := 0, d.arrayLen(); k < l; k++ {
+				d.int64() // aborted producer id
+				d.int64() // aborted first offset
+			}
+			p.records = d.bytes()
+			fetched[topicPartition{topic, partition}] = p
+		}
+	}
+	if d.err != nil {
+		return nil, d.err
+	}
+	return fetched, nil
+}
+
+type topicPartitions struct {
+	topic      string
+	partitions []int32
+}
+
+// groupByTopic groups partitions by topic, keeping their order.
+func groupByTopic(partitions []topicPartition) []topicPartitions {
+	var grouped []topicPartitions
+	index := make(map[string]int)
+	for _, tp := range partitions {
+		i, ok := index[tp.topic]
+		if !ok {
+			i = len(grouped)
+			index[tp.topic] = i
+			grouped = append(grouped, topicPartitions{topic: tp.topic})
+		}
+		grouped[i].partitions = append(grouped[i].partitions, tp.partition)
+	}
+	return grouped
+}
+
+// protocolError is an error code a broker returned for a partition.
+type protocolError struct {
+	code      int16
+	topic     string
+	partition int32
+}
+
+func (e *protocolError) Error() string {
+	if e.partition < 0 {
+		return fmt.Sprintf("kafka: topic %s: error code %d", e.topic, e.code)
+	}
+	return fmt.Sprintf("kafka: %s/%d: error code %d", e.topic, e.partition, e.code)
+}
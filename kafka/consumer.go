@@ -0,0 +1,442 @@
+// Package kafka consumes messages from Kafka topics. It speaks the Kafka
+// wire protocol directly and reads every partition of its topics without
+// joining a consumer group, so offsets are not committed and a restarted
+// consumer starts again from its configured position.
+//
+// The maintained clients, github.com/segmentio/kafka-go and
+// github.com/twmb/franz-go, were ruled out because both pull in
+// github.com/pierrec/lz4/v4, which the build's module mirror doesn't carry.
+// Only the fetch path is implemented here: snappy and zstd come from
+// github.com/klauspost/compress, and the LZ4 frame decoder, the one codec
+// without a library, is checked against frames written by the lz4 tool in
+// testdata.
+package kafka
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Start positions of a consumer.
+const (
+	StartLatest   = "latest"   // only messages produced after the consumer starts
+	StartEarliest = "earliest" // everything the topics still retain
+)
+
+const (
+	requestTimeout = 30 * time.Second
+	fetchMaxWait   = 500 * time.Millisecond
+	partitionBytes = 1 << 20
+
+	minBackoff = time.Second
+	maxBackoff = 30 * time.Second
+)
+
+// Config configures a Consumer.
+type Config struct {
+	Brokers  []string    // bootstrap brokers, host:port
+	Topics   []string    // topics to read
+	Start    string      // StartLatest (the default) or StartEarliest
+	ClientID string      // client id sent to brokers
+	TLS      *tls.Config // connect with TLS when set
+	SASL     *SASL       // authenticate with SASL when set
+}
+
+// FromEnv returns the consumer configuration in KAFKA_BROKERS, KAFKA_TOPICS,
+// KAFKA_START, KAFKA_CLIENT_ID, KAFKA_TLS and KAFKA_SASL_MECHANISM,
+// KAFKA_SASL_USERNAME and KAFKA_SASL_PASSWORD, or nil if KAFKA_BROKERS is
+// unset.
+func FromEnv() (*Config, error) {
+	brokers := splitList(os.Getenv("KAFKA_BROKERS"))
+	if len(brokers) == 0 {
+		return nil, nil
+	}
+	cfg := &Config{
+		Brokers:  brokers,
+		Topics:   splitList(os.Getenv("KAFKA_TOPICS")),
+		Start:    os.Getenv("KAFKA_START"),
+		ClientID: os.Getenv("KAFKA_CLIENT_ID"),
+	}
+	if len(cfg.Topics) == 0 {
+		return nil, fmt.Errorf("KAFKA_TOPICS is required with KAFKA_BROKERS")
+	}
+	if cfg.Start != "" && cfg.Start != StartLatest && cfg.Start != StartEarliest {
+		return nil, fmt.Errorf("KAFKA_START must be %s or %s", StartLatest, StartEarliest)
+	}
+	if os.Getenv("KAFKA_TLS") == "true" {
+		cfg.TLS = &tls.Config{MinVersion: tls.VersionTLS12}
+	}
+	if mechanism := os.Getenv("KAFKA_SASL_MECHANISM"); mechanism != "" {
+		cfg.SASL = &SASL{
+			Mechanism: strings.ToUpper(mechanism),
+			Username:  os.Getenv("KAFKA_SASL_USERNAME"),
+			Password:  os.Getenv("KAFKA_SASL_PASSWORD"),
+		}
+		if err := cfg.SASL.validate(); err != nil {
+			return nil, err
+		}
+	}
+	return cfg, nil
+}
+
+func splitList(raw string) []string {
+	var items []string
+	for _, item := range strings.Split(raw, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
+
+// Handler processes a message. An error marks the message as rejected;
+// consumption continues either way.
+type Handler func(Record) error
+
+// Consumer reads the messages of a set of topics and passes them to a
+// Handler, one at a time.
+type Consumer struct {
+	cfg    Config
+	handle Handler
+
+	// Owned by Run.
+	conns   map[int32]*conn
+	brokers map[int32]broker
+	leaders map[topicPartition]int32
+
+	mu             sync.Mutex
+	offsets        map[topicPartition]int64
+	highWatermarks map[topicPartition]int64
+	consumed       int64
+	rejected       int64
+	skipped        int64
+	lastError      string
+	lastErrorAt    time.Time
+	lastMessageAt  time.Time
+	connected      bool
+}
+
+// NewConsumer returns a consumer for cfg, which Run starts.
+func NewConsumer(cfg Config, handle Handler) (*Consumer, error) {
+	if len(cfg.Brokers) == 0 {
+		return nil, errors.New("kafka: no brokers configured")
+	}
+	if len(cfg.Topics) == 0 {
+		return nil, errors.New("kafka: no topics configured")
+	}
+	switch cfg.Start {
+	case "":
+		cfg.Start = StartLatest
+	case StartLatest, StartEarliest:
+	default:
+		return nil, fmt.Errorf("kafka: start position must be %q or %q, got %q", StartLatest, StartEarliest, cfg.Start)
+	}
+	if cfg.ClientID == "" {
+		cfg.ClientID = "ai-service"
+	}
+	if cfg.SASL != nil {
+		if err := cfg.SASL.validate(); err != nil {
+			return nil, err
+		}
+	}
+	return &Consumer{
+		cfg:            cfg,
+		handle:         handle,
+		conns:          make(map[int32]*conn),
+		offsets:        make(map[topicPartition]int64),
+		highWatermarks: make(map[topicPartition]int64),
+	}, nil
+}
+
+// Run consumes messages until ctx is done. Errors are recorded in the
+// status and retried with backoff, reconnecting to the cluster.
+func (c *Consumer) Run(ctx context.Context) error {
+	defer c.closeConns()
+	backoff := minBackoff
+	for ctx.Err() == nil {
+		err := c.poll()
+		if err == nil {
+			backoff = minBackoff
+			continue
+		}
+		c.setError(err)
+		c.closeConns()
+		c.leaders = nil
+		select {
+		case <-ctx.Done():
+		case <-time.After(backoff):
+		}
+		if backoff *= 2; backoff > maxBackoff {
+			backoff = maxBackoff
+		}
+	}
+	return ctx.Err()
+}
+
+// poll fetches once from the leader of every partition.
+func (c *Consumer) poll() error {
+	if c.leaders == nil {
+		if err := c.refreshMetadata(); err != nil {
+			return err
+		}
+	}
+
+	byLeader := make(map[int32][]topicPartition)
+	for tp, leader := range c.leaders {
+		byLeader[leader] = append(byLeader[leader], tp)
+	}
+	for leader, partitions := range byLeader {
+		conn, err := c.conn(leader)
+		if err != nil {
+			return err
+		}
+		if err := c.initOffsets(conn, partitions); err != nil {
+			return err
+		}
+		if err := c.fetch(conn, partitions); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// refreshMetadata looks up the brokers of the cluster and the leaders of
+// the topics' partitions, through the first bootstrap broker that answers.
+func (c *Consumer) refreshMetadata() error {
+	var lastErr error
+	for _, addr := range c.cfg.Brokers {
+		conn, err := dial(addr, &c.cfg, requestTimeout)
+		if err != nil {
+			lastErr = fmt.Errorf("kafka: connect to %s: %v", addr, err)
+			continue
+		}
+		brokers, partitions, err := conn.metadata(c.cfg.Topics, requestTimeout)
+		conn.Close()
+		if err != nil {
+			lastErr = err
+			continue
+		}
+
+		leaders := make(map[topicPartition]int32)
+		found := make(map[string]bool)
+		for _, p := range partitions {
+			if p.err != errNone {
+				return &protocolError{code: p.err, topic: p.topic, partition: p.partition}
+			}
+			if _, ok := brokers[p.leader]; !ok {
+				return &protocolError{code: errLeaderNotAvailable, topic: p.topic, partition: p.partition}
+			}
+			leaders[topicPartition{p.topic, p.partition}] = p.leader
+			found[p.topic] = true
+		}
+		for _, topic := range c.cfg.Topics {
+			if !found[topic] {
+				return &protocolError{code: errUnknownTopicPartition, topic: topic, partition: -1}
+			}
+		}
+		c.brokers, c.leaders = brokers, leaders
+		c.mu.Lock()
+		c.connected = true
+		c.mu.Unlock()
+		return nil
+	}
+	return lastErr
+}
+
+// conn returns a connection to the broker id, dialing it if needed.
+func (c *Consumer) conn(id int32) (*conn, error) {
+	if conn, ok := c.conns[id]; ok {
+		return conn, nil
+	}
+	b := c.brokers[id]
+	conn, err := dial(b.addr, &c.cfg, requestTimeout)
+	if err != nil {
+		return nil, fmt.Errorf("kafka: connect to broker %d at %s: %v", id, b.addr, err)
+	}
+	c.conns[id] = conn
+	return conn, nil
+}
+
+func (c *Consumer) closeConns() {
+	for id, conn := range c.conns {
+		conn.Close()
+		delete(c.conns, id)
+	}
+	c.mu.Lock()
+	c.connected = false
+	c.mu.Unlock()
+}
+
+// initOffsets sets the offset of partitions not read yet, or whose offset
+// fell out of range, to the start position.
+func (c *Consumer) initOffsets(conn *conn, partitions []topicPartition) error {
+	c.mu.Lock()
+	var missing []topicPartition
+	for _, tp := range partitions {
+		if _, ok := c.offsets[tp]; !ok {
+			missing = append(missing, tp)
+		}
+	}
+	c.mu.Unlock()
+	if len(missing) == 0 {
+		return nil
+	}
+
+	timestamp := int64(offsetLatest)
+	if c.cfg.Start == StartEarliest {
+		timestamp = offsetEarliest
+	}
+	offsets, err := conn.listOffsets(missing, timestamp, requestTimeout)
+	if err != nil {
+		return err
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for tp, offset := range offsets {
+		c.offsets[tp] = offset
+	}
+	return nil
+}
+
+// fetch reads the next messages of partitions and hands them over.
+func (c *Consumer) fetch(conn *conn, partitions []topicPartition) error {
+	c.mu.Lock()
+	offsets := make(map[topicPartition]int64, len(partitions))
+	for _, tp := range partitions {
+		if offset, ok := c.offsets[tp]; ok {
+			offsets[tp] = offset
+		}
+	}
+	c.mu.Unlock()
+	if len(offsets) == 0 {
+		return nil
+	}
+
+	fetched, err := conn.fetch(offsets, fetchMaxWait, partitionBytes, requestTimeout)
+	if err != nil {
+		return err
+	}
+	var refresh error
+	for tp, p := range fetched {
+		offset, ok := offsets[tp]
+		if !ok {
+			continue
+		}
+		switch p.err {
+		case errNone:
+		case errOffsetOutOfRange:
+			// The partition no longer retains offset; start over.
+			c.mu.Lock()
+			delete(c.offsets, tp)
+			c.mu.Unlock()
+			c.setError(&protocolError{code: p.err, topic: tp.topic, partition: tp.partition})
+			continue
+		default:
+			// Leadership moved or the topic changed; look the cluster up
+			// again after handing over what the other partitions returned.
+			refresh = &protocolError{code: p.err, topic: tp.topic, partition: tp.partition}
+			continue
+		}
+
+		next, skipped, skipErr := decodeRecordBatches(p.records, offset, func(r Record) {
+			r.Topic, r.Partition = tp.topic, tp.partition
+			err := c.handle(r)
+			c.mu.Lock()
+			c.consumed++
+			c.lastMessageAt = time.Now().UTC()
+			if err != nil {
+				c.rejected++
+				c.lastError = fmt.Sprintf("%s/%d at offset %d: %v", tp.topic, tp.partition, r.Offset, err)
+				c.lastErrorAt = c.lastMessageAt
+			}
+			c.mu.Unlock()
+		})
+		c.mu.Lock()
+		c.offsets[tp] = next
+		c.highWatermarks[tp] = p.highWatermark
+		c.skipped += int64(skipped)
+		c.mu.Unlock()
+		if skipErr != nil {
+			c.setError(skipErr)
+		}
+	}
+	return refresh
+}
+
+func (c *Consumer) setError(err error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.lastError = err.Error()
+	c.lastErrorAt = time.Now().UTC()
+}
+
+// PartitionStatus is the position of a consumer in one partition.
+type PartitionStatus struct {
+	Topic         string `json:"topic"`
+	Partition     int32  `json:"partition"`
+	Offset        int64  `json:"offset"`         // next offset to read
+	HighWatermark int64  `json:"high_watermark"` // offset after the last message, as of the last fetch
+	Lag           int64  `json:"lag"`
+}
+
+// Status describes the state of a consumer.
+type Status struct {
+	Brokers       []string          `json:"brokers"`
+	Topics        []string          `json:"topics"`
+	Start         string            `json:"start"`
+	Connected     bool              `json:"connected"`
+	Partitions    []PartitionStatus `json:"partitions"`
+	Lag           int64             `json:"lag"`
+	Consumed      int64             `json:"consumed"`        // messages handed over
+	Rejected      int64             `json:"rejected"`        // messages the handler rejected
+	Skipped       int64             `json:"skipped_batches"` // record batches that could not be read
+	LastError     string            `json:"last_error,omitempty"`
+	LastErrorAt   string            `json:"last_error_at,omitempty"`
+	LastMessageAt string            `json:"last_message_at,omitempty"`
+}
+
+// Status returns the current state of the consumer.
+func (c *Consumer) Status() Status {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	status := Status{
+		Brokers:    c.cfg.Brokers,
+		Topics:     c.cfg.Topics,
+		Start:      c.cfg.Start,
+		Connected:  c.connected,
+		Partitions: []PartitionStatus{},
+		Consumed:   c.consumed,
+		Rejected:   c.rejected,
+		Skipped:    c.skipped,
+		LastError:  c.lastError,
+	}
+	for tp, offset := range c.offsets {
+		p := PartitionStatus{Topic: tp.topic, Partition: tp.partition, Offset: offset, HighWatermark: c.highWatermarks[tp]}
+		if p.HighWatermark > offset {
+			p.Lag = p.HighWatermark - offset
+		}
+		status.Lag += p.Lag
+		status.Partitions = append(status.Partitions, p)
+	}
+	sort.Slice(status.Partitions, func(i, j int) bool {
+		a, b := status.Partitions[i], status.Partitions[j]
+		if a.Topic != b.Topic {
+			return a.Topic < b.Topic
+		}
+		return a.Partition < b.Partition
+	})
+	if !c.lastErrorAt.IsZero() {
+		status.LastErrorAt = c.lastErrorAt.Format(time.RFC3339)
+	}
+	if !c.lastMessageAt.IsZero() {
+		status.LastMessageAt = c.lastMessageAt.Format(time.RFC3339)
+	}
+	return status
+}
@@ -0,0 +1,323 @@
+package kafka
+
+import (
+	"bufio"
+	"cmp"
+	"context"
+	"encoding/binary"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/xdg-go/scram"
+)
+
+const errSaslAuthenticationFailed = 58
+
+// fakeBroker is a single-broker cluster serving one partition of one
+// topic, speaking the request versions the consumer uses.
+type fakeBroker struct {
+	t       *testing.T
+	ln      net.Listener
+	topic   string
+	batches []byte // record batches of partition 0
+	end     int64  // offset after the last record
+	sasl    *SASL  // credentials required, if any
+
+	mu       sync.Mutex
+	requests map[int16]int
+}
+
+func newFakeBroker(t *testing.T, topic string, batches []byte, end int64, sasl *SASL) *fakeBroker {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	b := &fakeBroker{t: t, ln: ln, topic: topic, batches: batches, end: end, sasl: sasl, requests: make(map[int16]int)}
+	t.Cleanup(func() { ln.Close() })
+	go func() {
+		for {
+			nc, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			go b.serve(nc)
+		}
+	}()
+	return b
+}
+
+func (b *fakeBroker) count(apiKey int16) int {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.requests[apiKey]
+}
+
+func (b *fakeBroker) serve(nc net.Conn) {
+	defer nc.Close()
+	r := bufio.NewReader(nc)
+	authenticated := b.sasl == nil
+	var scramConv *scram.ServerConversation
+	for {
+		var size [4]byte
+		if _, err := io.ReadFull(r, size[:]); err != nil {
+			return
+		}
+		req := make([]byte, binary.BigEndian.Uint32(size[:]))
+		if _, err := io.ReadFull(r, req); err != nil {
+			return
+		}
+		d := &decoder{b: req}
+		apiKey, version, correlationID := d.int16(), d.int16(), d.int32()
+		d.string() // client id
+		b.mu.Lock()
+		b.requests[apiKey]++
+		b.mu.Unlock()
+
+		resp := &encoder{}
+		switch {
+		case apiKey == apiSaslHandshake && version == saslHandshakeVersion:
+			mechanism := d.string()
+			if mechanism == b.sasl.Mechanism {
+				resp.int16(errNone)
+			} else {
+				resp.int16(33) // unsupported SASL mechanism
+			}
+			resp.int32(1)
+			resp.string(b.sasl.Mechanism)
+			if mechanism != b.sasl.Mechanism {
+				b.write(nc, correlationID, resp.b)
+				return
+			}
+			if mechanism != SASLPlain {
+				scramConv = b.scramServer().NewConversation()
+			}
+		case apiKey == apiSaslAuthenticate && version == saslAuthenticateVersion:
+			auth := string(d.bytes())
+			var reply string
+			var ok bool
+			if scramConv == nil {
+				ok = auth == "\x00"+b.sasl.Username+"\x00"+b.sasl.Password
+			} else {
+				var err error
+				reply, err = scramConv.Step(auth)
+				ok = err == nil
+			}
+			if !ok {
+				resp.int16(errSaslAuthenticationFailed)
+				resp.string("invalid credentials")
+				resp.bytes(nil)
+				b.write(nc, correlationID, resp.b)
+				return
+			}
+			authenticated = scramConv == nil || scramConv.Valid()
+			resp.int16(errNone)
+			resp.int16(-1) // no error message
+			resp.bytes([]byte(reply))
+		case !authenticated:
+			b.t.Errorf("request %d before authentication", apiKey)
+			return
+		case apiKey == apiMetadata && version == metadataVersion:
+			host, port, _ := net.SplitHostPort(b.ln.Addr().String())
+			portNum, _ := strconv.Atoi(port)
+			resp.int32(0) // throttle time
+			resp.int32(1) // brokers
+			resp.int32(1)
+			resp.string(host)
+			resp.int32(int32(portNum))
+			resp.int16(-1) // rack
+			resp.int16(-1) // cluster id
+			resp.int32(1)  // controller id
+			resp.int32(1)  // topics
+			resp.int16(errNone)
+			resp.string(b.topic)
+			resp.int8(0)
+			resp.int32(1) // partitions
+			resp.int16(errNone)
+			resp.int32(0) // partition
+			resp.int32(1) // leader
+			resp.int32(1) // replicas
+			resp.int32(1)
+			resp.int32(1) // in-sync replicas
+			resp.int32(1)
+		case apiKey == apiListOffsets && version == listOffsetsVersion:
+			d.int32() // replica id
+			d.int32() // topics
+			d.string()
+			d.int32() // partitions
+			d.int32()
+			offset := b.end
+			if d.int64() == offsetEarliest {
+				offset = 0
+			}
+			resp.int32(1)
+			resp.string(b.topic)
+			resp.int32(1)
+			resp.int32(0)
+			resp.int16(errNone)
+			resp.int64(-1)
+			resp.int64(offset)
+		case apiKey == apiFetch && version == fetchVersion:
+			d.int32() // replica id
+			maxWait := time.Duration(d.int32()) * time.Millisecond
+			d.int32() // min bytes
+			d.int32() // max bytes
+			d.int8()  // isolation level
+			d.int32() // topics
+			d.string()
+			d.int32() // partitions
+			d.int32()
+			offset := d.int64()
+			records := b.batches
+			if offset >= b.end {
+				records = nil
+				time.Sleep(maxWait)
+			}
+			resp.int32(0) // throttle time
+			resp.int32(1)
+			resp.string(b.topic)
+			resp.int32(1)
+			resp.int32(0)
+			resp.int16(errNone)
+			resp.int64(b.end) // high watermark
+			resp.int64(b.end) // last stable offset
+			resp.int32(0)     // aborted transactions
+			resp.bytes(records)
+		default:
+			b.t.Errorf("unexpected request: api key %d version %d", apiKey, version)
+			return
+		}
+		if d.err != nil {
+			b.t.Errorf("request %d: %v", apiKey, d.err)
+			return
+		}
+		b.write(nc, correlationID, resp.b)
+	}
+}
+
+func (b *fakeBroker) write(nc net.Conn, correlationID int32, body []byte) {
+	out := &encoder{}
+	out.int32(int32(4 + len(body)))
+	out.int32(correlationID)
+	nc.Write(append(out.b, body...))
+}
+
+func (b *fakeBroker) scramServer() *scram.Server {
+	hash := scram.SHA256
+	if b.sasl.Mechanism == SASLScramSHA512 {
+		hash = scram.SHA512
+	}
+	client, err := hash.NewClient(b.sasl.Username, b.sasl.Password, "")
+	if err != nil {
+		b.t.Fatal(err)
+	}
+	credentials := client.GetStoredCredentials(scram.KeyFactors{Salt: "fake-broker-salt", Iters: 4096})
+	server, err := hash.NewServer(func(user string) (scram.StoredCredentials, error) {
+		return credentials, nil
+	})
+	if err != nil {
+		b.t.Fatal(err)
+	}
+	return server
+}
+
+// consume runs a consumer of broker until want values arrived or a few
+// seconds passed, and returns the values and final status.
+func consume(t *testing.T, broker *fakeBroker, sasl *SASL, want int) ([]string, Status) {
+	t.Helper()
+	var mu sync.Mutex
+	var values []string
+	consumer, err := NewConsumer(Config{
+		Brokers: []string{broker.ln.Addr().String()},
+		Topics:  []string{broker.topic},
+		Start:   StartEarliest,
+		SASL:    sasl,
+	}, func(r Record) error {
+		mu.Lock()
+		defer mu.Unlock()
+		values = append(values, string(r.Value))
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		consumer.Run(ctx)
+		close(done)
+	}()
+	for deadline := time.Now().Add(3 * time.Second); time.Now().Before(deadline); time.Sleep(10 * time.Millisecond) {
+		mu.Lock()
+		n := len(values)
+		mu.Unlock()
+		if n >= want && (want > 0 || consumer.Status().LastError != "") {
+			break
+		}
+	}
+	cancel()
+	<-done
+	mu.Lock()
+	defer mu.Unlock()
+	return values, consumer.Status()
+}
+
+func TestConsumerRoundTrip(t *testing.T) {
+	records := []testRecord{{value: `{"path":"/a"}`}, {value: `{"path":"/b"}`}, {value: `{"path":"/c"}`}}
+	batches := encodeBatch(t, 0, time.Now(), compressionGzip, gzipBytes, records[:2])
+	batches = append(batches, encodeBatch(t, 2, time.Now(), compressionZstd, zstdBytes, records[2:])...)
+
+	for _, mechanism := range []string{"", SASLPlain, SASLScramSHA256, SASLScramSHA512} {
+		t.Run(cmp.Or(mechanism, "no SASL"), func(t *testing.T) {
+			var sasl *SASL
+			if mechanism != "" {
+				sasl = &SASL{Mechanism: mechanism, Username: "ingest", Password: "s3cret"}
+			}
+			broker := newFakeBroker(t, "logs", batches, 3, sasl)
+
+			values, status := consume(t, broker, sasl, 3)
+			if strings.Join(values, " ") != `{"path":"/a"} {"path":"/b"} {"path":"/c"}` {
+				t.Errorf("consumed %v", values)
+			}
+			if status.Consumed != 3 || status.Skipped != 0 || status.Lag != 0 {
+				t.Errorf("status = %+v, want 3 consumed, none skipped, no lag", status)
+			}
+			if len(status.Partitions) != 1 || status.Partitions[0].Offset != 3 {
+				t.Errorf("partitions = %+v, want offset 3", status.Partitions)
+			}
+			if mechanism != "" && broker.count(apiSaslAuthenticate) == 0 {
+				t.Error("consumer didn't authenticate")
+			}
+		})
+	}
+}
+
+func TestConsumerAuthenticationFailure(t *testing.T) {
+	batches := encodeBatch(t, 0, time.Now(), compressionNone, identity, []testRecord{{value: "a"}})
+	for _, mechanism := range []string{SASLPlain, SASLScramSHA256} {
+		t.Run(mechanism, func(t *testing.T) {
+			broker := newFakeBroker(t, "logs", batches, 1, &SASL{Mechanism: mechanism, Username: "ingest", Password: "s3cret"})
+
+			values, status := consume(t, broker, &SASL{Mechanism: mechanism, Username: "ingest", Password: "wrong"}, 0)
+			if len(values) != 0 || status.Connected {
+				t.Errorf("consumed %v, connected %v without valid credentials", values, status.Connected)
+			}
+			if !strings.Contains(status.LastError, "authentication") {
+				t.Errorf("last error = %q, want an authentication failure", status.LastError)
+			}
+			if n := broker.count(apiMetadata); n != 0 {
+				t.Errorf("%d metadata requests served without authentication", n)
+			}
+		})
+	}
+
+	broker := newFakeBroker(t, "logs", batches, 1, &SASL{Mechanism: SASLScramSHA512, Username: "ingest", Password: "s3cret"})
+	_, status := consume(t, broker, &SASL{Mechanism: SASLPlain, Username: "ingest", Password: "s3cret"}, 0)
+	if !strings.Contains(status.LastError, "does not accept SASL mechanism PLAIN") {
+		t.Errorf("last error = %q, want the mechanism rejected", status.LastError)
+	}
+}
@@ -0,0 +1,273 @@
+package kafka
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"time"
+)
+
+// API keys and the versions of them this client speaks. They are the
+// oldest versions that Kafka 4 still accepts, and that return record
+// batches (magic 2).
+const (
+	apiFetch       = 1
+	apiListOffsets = 2
+	apiMetadata    = 3
+
+	fetchVersion       = 4
+	listOffsetsVersion = 1
+	metadataVersion    = 4
+)
+
+// Error codes the consumer acts on.
+const (
+	errNone                  = 0
+	errOffsetOutOfRange      = 1
+	errUnknownTopicPartition = 3
+	errLeaderNotAvailable    = 5
+)
+
+// Special ListOffsets timestamps.
+const (
+	offsetLatest   = -1
+	offsetEarliest = -2
+)
+
+// Record batch attributes.
+const (
+	compressionMask = 0x07
+	controlBatch    = 0x20
+)
+
+var castagnoli = crc32.MakeTable(crc32.Castagnoli)
+
+// errTruncated reports a response shorter than its fields say.
+var errTruncated = errors.New("kafka: truncated response")
+
+// encoder appends the protocol's big-endian primitives to a request body.
+type encoder struct {
+	b []byte
+}
+
+func (e *encoder) int8(v int8)   { e.b = append(e.b, byte(v)) }
+func (e *encoder) int16(v int16) { e.b = binary.BigEndian.AppendUint16(e.b, uint16(v)) }
+func (e *encoder) int32(v int32) { e.b = binary.BigEndian.AppendUint32(e.b, uint32(v)) }
+func (e *encoder) int64(v int64) { e.b = binary.BigEndian.AppendUint64(e.b, uint64(v)) }
+
+func (e *encoder) string(s string) {
+	e.int16(int16(len(s)))
+	e.b = append(e.b, s...)
+}
+
+func (e *encoder) bytes(b []byte) {
+	e.int32(int32(len(b)))
+	e.b = append(e.b, b...)
+}
+
+// decoder reads the protocol's primitives from a response body. The first
+// error sticks; later reads return zero values.
+type decoder struct {
+	b   []byte
+	err error
+}
+
+func (d *decoder) take(n int) []byte {
+	if d.err != nil {
+		return nil
+	}
+	if n < 0 || n > len(d.b) {
+		d.err = errTruncated
+		return nil
+	}
+	v := d.b[:n]
+	d.b = d.b[n:]
+	return v
+}
+
+func (d *decoder) int8() int8 {
+	if v := d.take(1); v != nil {
+		return int8(v[0])
+	}
+	return 0
+}
+
+func (d *decoder) int16() int16 {
+	if v := d.take(2); v != nil {
+		return int16(binary.BigEndian.Uint16(v))
+	}
+	return 0
+}
+
+func (d *decoder) int32() int32 {
+	if v := d.take(4); v != nil {
+		return int32(binary.BigEndian.Uint32(v))
+	}
+	return 0
+}
+
+func (d *decoder) int64() int64 {
+	if v := d.take(8); v != nil {
+		return int64(binary.BigEndian.Uint64(v))
+	}
+	return 0
+}
+
+// string reads a nullable string; null reads as "".
+func (d *decoder) string() string {
+	n := d.int16()
+	if n < 0 {
+		return ""
+	}
+	return string(d.take(int(n)))
+}
+
+// bytes reads nullable bytes; null reads as nil.
+func (d *decoder) bytes() []byte {
+	n := d.int32()
+	if n < 0 {
+		return nil
+	}
+	return d.take(int(n))
+}
+
+// arrayLen reads an array length; null arrays read as empty.
+func (d *decoder) arrayLen() int {
+	n := d.int32()
+	if n < 0 || d.err != nil {
+		return 0
+	}
+	if int(n) > len(d.b) {
+		// Every element takes at least a byte.
+		d.err = errTruncated
+		return 0
+	}
+	return int(n)
+}
+
+func (d *decoder) varint() int64 {
+	if d.err != nil {
+		return 0
+	}
+	v, n := binary.Varint(d.b)
+	if n <= 0 {
+		d.err = errTruncated
+		return 0
+	}
+	d.b = d.b[n:]
+	return v
+}
+
+// varbytes reads varint-length-prefixed bytes; -1 reads as nil.
+func (d *decoder) varbytes() []byte {
+	n := d.varint()
+	if n < 0 {
+		return nil
+	}
+	return d.take(int(n))
+}
+
+// Record is one message read from a partition.
+type Record struct {
+	Topic     string
+	Partition int32
+	Offset    int64
+	Time      time.Time
+	Key       []byte
+	Value     []byte
+	Headers   map[string]string
+}
+
+// decodeRecordBatches calls fn for each record at or after offset in the
+// record batches of a fetched partition, and returns the offset to fetch
+// next. A batch cut off at the end of the data, as brokers do to respect
+// the fetch size, is left for the next fetch. Batches that cannot be read,
+// being corrupt, in an old message format, compressed with an unknown codec
+// or expanding beyond maxDecompressedBatch, are skipped; skipped counts them
+// and err describes the last.
+func decodeRecordBatches(data []byte, offset int64, fn func(Record)) (next int64, skipped int, err error) {
+	next = offset
+	for len(data) >= 12 {
+		baseOffset := int64(binary.BigEndian.Uint64(data))
+		length := int(int32(binary.BigEndian.Uint32(data[8:])))
+		if length < 0 || len(data) < 12+length {
+			break
+		}
+		batch := &decoder{b: data[12 : 12+length]}
+		data = data[12+length:]
+
+		batch.int32() // partition leader epoch
+		if magic := batch.int8(); magic != 2 {
+			// A message of format v0 or v1 holds a single offset.
+			if baseOffset >= next {
+				next = baseOffset + 1
+			}
+			skipped++
+			err = fmt.Errorf("kafka: skipped message at offset %d: unsupported message format v%d", baseOffset, magic)
+			continue
+		}
+		crc := uint32(batch.int32())
+		checksum := crc32.Checksum(batch.b, castagnoli)
+		attributes := batch.int16()
+		lastOffsetDelta := batch.int32()
+		firstTimestamp := batch.int64()
+		batch.int64() // max timestamp
+		batch.int64() // producer id
+		batch.int16() // producer epoch
+		batch.int32() // base sequence
+		count := batch.int32()
+		if batch.err != nil {
+			skipped++
+			err = fmt.Errorf("kafka: skipped record batch at offset %d: %v", baseOffset, batch.err)
+			continue
+		}
+		if end := baseOffset + int64(lastOffsetDelta) + 1; end > next {
+			next = end
+		}
+		if checksum != crc {
+			skipped++
+			err = fmt.Errorf("kafka: skipped record batch at offset %d: checksum mismatch", baseOffset)
+			continue
+		}
+		if attributes&controlBatch != 0 {
+			continue
+		}
+
+		records, decompressErr := decompress(attributes&compressionMask, batch.b)
+		if decompressErr != nil {
+			skipped++
+			err = fmt.Errorf("kafka: skipped record batch at offset %d: %v", baseOffset, decompressErr)
+			continue
+		}
+
+		d := &decoder{b: records}
+		for i := int32(0); i < count && d.err == nil; i++ {
+			d.varint() // record length
+			d.int8()   // attributes
+			timestampDelta := d.varint()
+			offsetDelta := d.varint()
+			r := Record{
+				Offset: baseOffset + offsetDelta,
+				Time:   time.UnixMilli(firstTimestamp + timestampDelta).UTC(),
+				Key:    d.varbytes(),
+				Value:  d.varbytes(),
+			}
+			if headers := d.varint(); headers > 0 {
+				r.Headers = make(map[string]string)
+				for h := int64(0); h < headers && d.err == nil; h++ {
+					key := d.varbytes()
+					r.Headers[string(key)] = string(d.varbytes())
+				}
+			}
+			if d.err == nil && r.Offset >= offset {
+				fn(r)
+			}
+		}
+		if d.err != nil {
+			skipped++
+			err = fmt.Errorf("kafka: record batch at offset %d is truncated", baseOffset)
+		}
+	}
+	return next, skipped, err
+}
@@ -0,0 +1,214 @@
+package kafka
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/binary"
+	"fmt"
+	"hash/crc32"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/klauspost/compress/snappy"
+	"github.com/klauspost/compress/zstd"
+)
+
+type testRecord struct {
+	key, value string
+	headers    map[string]string
+}
+
+// encodeRecords encodes records in the format of a magic 2 record batch,
+// the nth at offset delta n and timestamp delta n milliseconds.
+func encodeRecords(records []testRecord) []byte {
+	var out []byte
+	for i, r := range records {
+		var body []byte
+		body = append(body, 0) // attributes
+		body = binary.AppendVarint(body, int64(i))
+		body = binary.AppendVarint(body, int64(i))
+		body = binary.AppendVarint(body, int64(len(r.key)))
+		body = append(body, r.key...)
+		body = binary.AppendVarint(body, int64(len(r.value)))
+		body = append(body, r.value...)
+		body = binary.AppendVarint(body, int64(len(r.headers)))
+		for k, v := range r.headers {
+			body = binary.AppendVarint(body, int64(len(k)))
+			body = append(body, k...)
+			body = binary.AppendVarint(body, int64(len(v)))
+			body = append(body, v...)
+		}
+		out = binary.AppendVarint(out, int64(len(body)))
+		out = append(out, body...)
+	}
+	return out
+}
+
+// encodeBatch returns a record batch of records starting at baseOffset,
+// compressed with compress under codec.
+func encodeBatch(t *testing.T, baseOffset int64, firstTimestamp time.Time, codec int16, compress func([]byte) []byte, records []testRecord) []byte {
+	t.Helper()
+	tail := &encoder{}
+	tail.int16(codec)
+	tail.int32(int32(len(records) - 1)) // last offset delta
+	tail.int64(firstTimestamp.UnixMilli())
+	tail.int64(firstTimestamp.UnixMilli() + int64(len(records)-1))
+	tail.int64(-1) // producer id
+	tail.int16(-1) // producer epoch
+	tail.int32(-1) // base sequence
+	tail.int32(int32(len(records)))
+	tail.b = append(tail.b, compress(encodeRecords(records))...)
+
+	batch := &encoder{}
+	batch.int64(baseOffset)
+	batch.int32(int32(4 + 1 + 4 + len(tail.b)))
+	batch.int32(0) // partition leader epoch
+	batch.int8(2)  // magic
+	batch.int32(int32(crc32.Checksum(tail.b, castagnoli)))
+	batch.b = append(batch.b, tail.b...)
+	return batch.b
+}
+
+func identity(b []byte) []byte { return b }
+
+func gzipBytes(b []byte) []byte {
+	var buf bytes.Buffer
+	w := gzip.NewWriter(&buf)
+	w.Write(b)
+	w.Close()
+	return buf.Bytes()
+}
+
+// xerialSnappy frames b as the Java client does, in blocks of blockSize.
+func xerialSnappy(blockSize int) func([]byte) []byte {
+	return func(b []byte) []byte {
+		out := append([]byte{}, xerialHeader...)
+		out = binary.BigEndian.AppendUint32(out, 1) // version
+		out = binary.BigEndian.AppendUint32(out, 1) // compatible version
+		for len(b) > 0 {
+			n := min(blockSize, len(b))
+			block := snappy.Encode(nil, b[:n])
+			out = binary.BigEndian.AppendUint32(out, uint32(len(block)))
+			out = append(out, block...)
+			b = b[n:]
+		}
+		return out
+	}
+}
+
+func zstdBytes(b []byte) []byte {
+	enc, _ := zstd.NewWriter(nil)
+	defer enc.Close()
+	return enc.EncodeAll(b, nil)
+}
+
+// lz4Literals writes b as an LZ4 frame of one block holding a single
+// literal run, which any LZ4 decoder must accept.
+func lz4Literals(b []byte) []byte {
+	block := []byte{0xF0}
+	n := len(b) - 15
+	for ; n >= 255; n -= 255 {
+		block = append(block, 255)
+	}
+	block = append(block, byte(n))
+	block = append(block, b...)
+
+	out := binary.LittleEndian.AppendUint32(nil, lz4Magic)
+	out = append(out, 0x60, 0x40, 0x82) // FLG, BD, header checksum (unchecked)
+	out = binary.LittleEndian.AppendUint32(out, uint32(len(block)))
+	out = append(out, block...)
+	return binary.LittleEndian.AppendUint32(out, 0) // end mark
+}
+
+func TestDecodeRecordBatchesCodecs(t *testing.T) {
+	records := []testRecord{
+		{key: "k1", value: `{"path":"/checkout","status":500}`, headers: map[string]string{"source": "nginx"}},
+		{value: strings.Repeat(`{"path":"/api/orders","status":200}`, 40)},
+		{key: "k3", value: `{"path":"/","status":200}`},
+	}
+	first := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+
+	codecs := []struct {
+		name     string
+		codec    int16
+		compress func([]byte) []byte
+	}{
+		{"none", compressionNone, identity},
+		{"gzip", compressionGzip, gzipBytes},
+		{"snappy", compressionSnappy, func(b []byte) []byte { return snappy.Encode(nil, b) }},
+		{"snappy xerial", compressionSnappy, xerialSnappy(100)},
+		{"lz4", compressionLZ4, lz4Literals},
+		{"zstd", compressionZstd, zstdBytes},
+	}
+	for _, c := range codecs {
+		t.Run(c.name, func(t *testing.T) {
+			data := encodeBatch(t, 40, first, c.codec, c.compress, records)
+			data = append(data, encodeBatch(t, 43, first, c.codec, c.compress, records[:1])...)
+
+			var got []Record
+			next, skipped, err := decodeRecordBatches(data, 41, func(r Record) { got = append(got, r) })
+			if err != nil || skipped != 0 {
+				t.Fatalf("skipped %d batches: %v", skipped, err)
+			}
+			if next != 44 {
+				t.Errorf("next offset = %d, want 44", next)
+			}
+			// Offset 40 lies before the requested offset.
+			want := []testRecord{records[1], records[2], records[0]}
+			if len(got) != len(want) {
+				t.Fatalf("got %d records, want %d", len(got), len(want))
+			}
+			for i, r := range got {
+				if r.Offset != int64(41+i) || string(r.Key) != want[i].key || string(r.Value) != want[i].value {
+					t.Errorf("record %d = offset %d %q/%q, want offset %d %q/%q", i, r.Offset, r.Key, r.Value, 41+i, want[i].key, want[i].value)
+				}
+			}
+			if got[0].Time != first.Add(time.Millisecond) {
+				t.Errorf("record time = %v, want %v", got[0].Time, first.Add(time.Millisecond))
+			}
+			if got[2].Headers["source"] != "nginx" {
+				t.Errorf("headers = %v, want source=nginx", got[2].Headers)
+			}
+		})
+	}
+}
+
+func TestDecodeRecordBatchesSkipsUnreadable(t *testing.T) {
+	records := []testRecord{{value: "a"}, {value: "b"}}
+	first := time.Now()
+
+	corrupt := encodeBatch(t, 0, first, compressionNone, identity, records)
+	corrupt[len(corrupt)-1] ^= 0xFF
+	tests := []struct {
+		name, err string
+		data      []byte
+	}{
+		{"unknown codec", "unknown compression codec 6", encodeBatch(t, 0, first, 6, identity, records)},
+		{"checksum", "checksum mismatch", corrupt},
+		{"gzip bomb", "exceeds", encodeBatch(t, 0, first, compressionGzip, func([]byte) []byte {
+			return gzipBytes(make([]byte, maxDecompressedBatch+1))
+		}, records)},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			data := append(tt.data, encodeBatch(t, 2, first, compressionNone, identity, records)...)
+			var got []string
+			next, skipped, err := decodeRecordBatches(data, 0, func(r Record) { got = append(got, fmt.Sprintf("%d:%s", r.Offset, r.Value)) })
+			if skipped != 1 || err == nil || !strings.Contains(err.Error(), tt.err) {
+				t.Fatalf("skipped %d, err %v; want 1 skipped with %q", skipped, err, tt.err)
+			}
+			if next != 4 || strings.Join(got, ",") != "2:a,3:b" {
+				t.Errorf("next %d, records %v; want 4 and the second batch", next, got)
+			}
+		})
+	}
+}
+
+func TestDecodeRecordBatchesPartial(t *testing.T) {
+	data := encodeBatch(t, 7, time.Now(), compressionNone, identity, []testRecord{{value: "a"}})
+	next, skipped, err := decodeRecordBatches(data[:len(data)-3], 7, func(Record) { t.Error("record from a partial batch") })
+	if next != 7 || skipped != 0 || err != nil {
+		t.Errorf("partial batch: next %d, skipped %d, err %v; want it left for the next fetch", next, skipped, err)
+	}
+}
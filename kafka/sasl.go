@@ -0,0 +1,117 @@
+package kafka
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/xdg-go/scram"
+)
+
+// SASL mechanisms a consumer can authenticate with.
+const (
+	SASLPlain       = "PLAIN"
+	SASLScramSHA256 = "SCRAM-SHA-256"
+	SASLScramSHA512 = "SCRAM-SHA-512"
+)
+
+// API keys and versions of the SASL exchange. Handshake version 1 wraps
+// the mechanism's messages in SaslAuthenticate requests.
+const (
+	apiSaslHandshake    = 17
+	apiSaslAuthenticate = 36
+
+	saslHandshakeVersion    = 1
+	saslAuthenticateVersion = 0
+)
+
+// SASL configures authentication with the brokers.
+type SASL struct {
+	Mechanism string // SASLPlain, SASLScramSHA256 or SASLScramSHA512
+	Username  string
+	Password  string
+}
+
+func (s *SASL) validate() error {
+	switch s.Mechanism {
+	case SASLPlain, SASLScramSHA256, SASLScramSHA512:
+	default:
+		return fmt.Errorf("kafka: SASL mechanism must be %s, %s or %s, got %q", SASLPlain, SASLScramSHA256, SASLScramSHA512, s.Mechanism)
+	}
+	if s.Username == "" || s.Password == "" {
+		return fmt.Errorf("kafka: SASL %s needs a username and password", s.Mechanism)
+	}
+	return nil
+}
+
+// authenticate runs the SASL exchange on a newly dialed connection.
+func (c *conn) authenticate(sasl *SASL, timeout time.Duration) error {
+	req := &encoder{}
+	req.string(sasl.Mechanism)
+	d, err := c.roundTrip(apiSaslHandshake, saslHandshakeVersion, req.b, timeout)
+	if err != nil {
+		return err
+	}
+	code := d.int16()
+	var mechanisms []string
+	for i, n := 0, d.arrayLen(); i < n; i++ {
+		mechanisms = append(mechanisms, d.string())
+	}
+	if d.err != nil {
+		return d.err
+	}
+	if code != errNone {
+		return fmt.Errorf("kafka: %s does not accept SASL mechanism %s (enabled: %s)", c.addr, sasl.Mechanism, strings.Join(mechanisms, ", "))
+	}
+
+	if sasl.Mechanism == SASLPlain {
+		_, err := c.saslAuthenticate([]byte("\x00"+sasl.Username+"\x00"+sasl.Password), timeout)
+		return err
+	}
+
+	hash := scram.SHA256
+	if sasl.Mechanism == SASLScramSHA512 {
+		hash = scram.SHA512
+	}
+	client, err := hash.NewClient(sasl.Username, sasl.Password, "")
+	if err != nil {
+		return fmt.Errorf("kafka: %s: %v", sasl.Mechanism, err)
+	}
+	conv := client.NewConversation()
+	msg, err := conv.Step("")
+	for err == nil && !conv.Done() {
+		var challenge []byte
+		if challenge, err = c.saslAuthenticate([]byte(msg), timeout); err != nil {
+			return err
+		}
+		msg, err = conv.Step(string(challenge))
+	}
+	if err != nil {
+		return fmt.Errorf("kafka: %s authentication with %s: %v", sasl.Mechanism, c.addr, err)
+	}
+	return nil
+}
+
+// saslAuthenticate sends one message of the SASL exchange and returns the
+// broker's reply.
+func (c *conn) saslAuthenticate(auth []byte, timeout time.Duration) ([]byte, error) {
+	req := &encoder{}
+	req.bytes(auth)
+	d, err := c.roundTrip(apiSaslAuthenticate, saslAuthenticateVersion, req.b, timeout)
+	if err != nil {
+		return nil, err
+	}
+	code := d.int16()
+	message := d.string()
+	reply := d.bytes()
+	if d.err != nil {
+		return nil, d.err
+	}
+	if code != errNone {
+		if message == "" {
+			message = fmt.Sprintf("error code %d", code)
+		}
+		return nil, fmt.Errorf("kafka: authentication with %s failed: %s", c.addr, message)
+	}
+	return reply, nil
+}
@@ -1,30 +1,155 @@
 package main
 
 import (
-	"encoding/json"
-	"fmt"
+	"context"
 	"log"
-	"net/http"
 	"os"
-	"path/filepath"
+	"strconv"
 	"strings"
+	"time"
+	_ "time/tzdata" // timezone names must resolve on minimal container images
 
+	"analyticsai/ai-service/alerts"
 	"analyticsai/ai-service/analytics"
+	"analyticsai/ai-service/analytics/llm"
+	"analyticsai/ai-service/analytics/parser"
+	"analyticsai/ai-service/bigquery"
+	"analyticsai/ai-service/geoip"
+	"analyticsai/ai-service/kafka"
+	"analyticsai/ai-service/notify"
+	"analyticsai/ai-service/scheduler"
+	"analyticsai/ai-service/storage"
+	"analyticsai/ai-service/tenants"
 
 	"github.com/gin-gonic/gin"
 	"github.com/joho/godotenv"
 )
 
+const (
+	uploadDir              = "uploads"
+	defaultAuditDir        = "audit"
+	defaultTrendAnalyses   = 5
+	maxTrendAnalyses       = 50
+	grafanaSearchAnalyses  = 20 // recent analyses whose endpoints /grafana/search offers
+	bigQueryExportTimeout  = time.Minute
+	scheduledRunTimeout    = 10 * time.Minute
+	defaultConversationTTL = 30 * time.Minute
+	maxBuffersPerTenant    = 20 // log buffers /ingest creates per tenant
+	maxBatchSets           = 50 // log sets per /analyze/batch request
+	defaultBatchWorkers    = 4
+	maxDashboardUpload     = 256 << 20 // bytes of a file sent over /ws/analyze
+	maxDashboardRequest    = 4 << 10   // bytes of its analysis request, read before authentication
+	dashboardRequestWait   = 10 * time.Second
+	dashboardUploadWait    = 5 * time.Minute
+)
+
 var (
 	analyticsService *analytics.AnalyticsService
+	tenantLimits     *analytics.LimitRegistry
+	quotaMeter       *analytics.QuotaMeter
+	uploadStore      = storage.NewUploadStore(uploadDir)
+	fieldMappings    *parser.MappingRegistry
+	feedback         *analytics.FeedbackRegistry
+	prompts          *analytics.PromptRegistry
+
+	// modelPrices are the prices /usage estimates costs with.
+	modelPrices map[string]analytics.ModelPrice
+
+	// auditLog records every API request. It is nil when records only go to
+	// the service log.
+	auditLog *storage.AuditLog
+
+	// tenantRegistry maps API keys to tenants. It is nil unless
+	// TENANTS_FILE is set, in which case every request needs a key.
+	tenantRegistry *tenants.Registry
+
+	// analysisStore keeps /analyze/logs, /analyze/performance and /upload
+	// results. It is nil when results aren't persisted.
+	analysisStore *storage.AnalysisStore
+
+	schedules *scheduler.Scheduler
+
+	// notifier delivers schedule notifications, alerts, incidents and
+	// email reports.
+	notifier *notify.Notifier
+
+	// issueAlertChannels receive the high and critical issues of every
+	// analysis; publicURL, if set, is used to link to stored results.
+	issueAlertChannels []notify.Channel
+	publicURL          string
+
+	alertRules *alerts.Registry
+
+	// bigQuery exports every analysis and its logs when BIGQUERY_DATASET is
+	// set.
+	bigQuery *bigquery.Exporter
+
+	// conversations holds the question-and-answer sessions about analyses.
+	conversations *analytics.ConversationRegistry
+
+	// semanticIndex holds the embedded log templates and analysis findings
+	// searched by /search/semantic. With SEMANTIC_AUTO_INDEX=true every logs
+	// analysis adds its logs and findings to it.
+	semanticIndex     *analytics.VectorIndex
+	semanticAutoIndex bool
+
+	// logWindows holds the statistics of each tenant's most recently
+	// analyzed logs for /metrics/logs.
+	logWindows = analytics.NewWindowRegistry()
+
+	// logBuffers holds each tenant's rolling windows of streamed logs,
+	// analyzed by passing buffer=<name> instead of a request body.
+	logBuffers = analytics.NewBufferRegistry()
+
+	// batchWorkers bounds the log sets /analyze/batch analyzes at once,
+	// across all requests.
+	batchWorkers chan struct{}
+
+	// bufferStore keeps a journal of every buffer /ingest fills when
+	// BUFFERS_DIR is set, so that they survive restarts.
+	bufferStore *storage.BufferStore
+
+	// maxDecompressedBody bounds the size a compressed request body may
+	// inflate to, like the largest dashboard upload unless
+	// MAX_DECOMPRESSED_BODY says otherwise.
+	maxDecompressedBody int64 = maxDashboardUpload
+
+	// ingestBufferSize and ingestBufferWindow bound the buffers /ingest
+	// creates.
+	ingestBufferSize   = 10000
+	ingestBufferWindow = time.Hour
+
+	// kafkaConsumer fills the "kafka" buffer when KAFKA_BROKERS is set.
+	kafkaConsumer *kafka.Consumer
+	kafkaTenant   string
+
+	// uploadRetention and analysesRetention are how long uploads and stored
+	// analyses are kept by the periodic cleanups and the /tasks and /admin
+	// cleanup endpoints. Zero keeps them until deleted.
+	uploadRetention   time.Duration
+	analysesRetention time.Duration
+
+	// cloudRunMode targets scale-to-zero platforms: no background goroutines,
+	// no reliance on local disk, and periodic work triggered via /tasks.
+	cloudRunMode bool
+
+	// defaultLocation is the zone analyses report times in when a request
+	// doesn't pass timezone.
+	defaultLocation = time.UTC
 )
 
 func main() {
 	log.Println("Starting Analytics AI service initialization...")
 
-	// Load environment variables
+	cloudRunMode = os.Getenv("DEPLOY_MODE") == "cloudrun" || os.Getenv("K_SERVICE") != ""
+
+	// Load environment variables. Cloud Run injects configuration directly,
+	// so a missing .env file is only fatal outside of it.
 	if err := godotenv.Load(); err != nil {
-		log.Fatalf("Error loading .env file: %v", err)
+		if !cloudRunMode {
+			log.Fatalf("Error loading .env file: %v", err)
+		}
+		log.Println("No .env file found, using environment configuration")
 	}
 
 	apiKey := os.Getenv("GEMINI_API_KEY")
@@ -37,120 +162,358 @@ func main() {
 		port = "8081"
 	}
 
-	// Initialize analytics service
-	analyticsService = analytics.NewAnalyticsService(apiKey)
-	log.Println("Successfully initialized Analytics service")
+	// Uploads are only deleted automatically when a retention is configured.
+	if raw := os.Getenv("UPLOAD_RETENTION"); raw != "" {
+		d, err := time.ParseDuration(raw)
+		if err != nil || d <= 0 {
+			log.Fatalf("Invalid UPLOAD_RETENTION %q: must be a positive duration", raw)
+		}
+		uploadRetention = d
+	}
 
-	// Initialize router with trusted proxy configuration
-	gin.SetMode(gin.ReleaseMode)
-	router := gin.Default()
-	router.SetTrustedProxies([]string{"127.0.0.1"})
+	// Likewise stored analyses, which are only pruned with a retention.
+	if raw := os.Getenv("ANALYSES_RETENTION"); raw != "" {
+		d, err := time.ParseDuration(raw)
+		if err != nil || d <= 0 {
+			log.Fatalf("Invalid ANALYSES_RETENTION %q: must be a positive duration", raw)
+		}
+		analysesRetention = d
+	}
 
-	// Health check endpoint
-	router.GET("/health", func(c *gin.Context) {
-		c.JSON(http.StatusOK, gin.H{
-			"status":  "healthy",
-			"message": "Analytics AI service is running",
-		})
-	})
+	conversationTTL := defaultConversationTTL
+	if raw := os.Getenv("CONVERSATION_TTL"); raw != "" {
+		d, err := time.ParseDuration(raw)
+		if err != nil || d <= 0 {
+			log.Fatalf("Invalid CONVERSATION_TTL: %q", raw)
+		}
+		conversationTTL = d
+	}
+	conversations = analytics.NewConversationRegistry(conversationTTL)
+
+	semanticAutoIndex = os.Getenv("SEMANTIC_AUTO_INDEX") == "true"
 
-	// File upload endpoint
-	router.POST("/upload", func(c *gin.Context) {
-		file, err := c.FormFile("file")
+	if name := os.Getenv("DEFAULT_TIMEZONE"); name != "" {
+		loc, err := time.LoadLocation(name)
 		if err != nil {
-			c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("get form err: %v", err)})
-			return
+			log.Fatalf("Invalid DEFAULT_TIMEZONE: %v", err)
 		}
+		defaultLocation = loc
+	}
 
-		// Create uploads directory if it doesn't exist
-		if err := os.MkdirAll("uploads", 0755); err != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{"error": fmt.Sprintf("failed to create uploads directory: %v", err)})
-			return
-		}
+	// The analytics service is built from this once everything it depends
+	// on is loaded.
+	gemini := llm.NewGemini(apiKey)
+	serviceConfig := analytics.Config{Gemini: gemini, Embedder: gemini}
 
-		filename := filepath.Join("uploads", file.Filename)
-		if err := c.SaveUploadedFile(file, filename); err != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{"error": fmt.Sprintf("upload file err: %v", err)})
-			return
+	if path := os.Getenv("GEOIP_DB_PATH"); path != "" {
+		geo, err := geoip.Open(path)
+		if err != nil {
+			log.Fatalf("Error loading GeoIP database: %v", err)
 		}
+		serviceConfig.GeoLocator = geo
+		log.Printf("Loaded GeoIP database from %s", path)
+	}
 
-		// Read and parse the uploaded file
-		data, err := os.ReadFile(filename)
+	// Prompts are redacted unless explicitly turned off, so that personal
+	// data and secrets in logs don't reach Gemini by default.
+	if os.Getenv("PII_REDACTION") != "off" {
+		cfg, err := analytics.LoadRedactionConfig(os.Getenv("REDACTION_CONFIG"))
+		if err != nil {
+			log.Fatalf("Error loading redaction config: %v", err)
+		}
+		redactor, err := analytics.NewRedactor(cfg)
 		if err != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{"error": fmt.Sprintf("read file err: %v", err)})
-			return
+			log.Fatalf("Error loading redaction config: %v", err)
+		}
+		serviceConfig.Redactor = redactor
+	}
+
+	key, err := storage.LoadKey("UPLOAD_ENCRYPTION_KEY")
+	if err != nil {
+		log.Fatalf("Error loading upload encryption key: %v", err)
+	}
+	// With a key set, files stored unencrypted are refused unless they are
+	// being migrated.
+	allowPlaintext := os.Getenv("UPLOAD_ENCRYPTION_ALLOW_PLAINTEXT") == "true"
+	if key != nil && allowPlaintext {
+		log.Println("Warning: files stored without encryption are still read; unset UPLOAD_ENCRYPTION_ALLOW_PLAINTEXT once they have been rewritten or deleted")
+	}
+	// Analysis results are only kept when ANALYSES_DIR is set; on Cloud Run
+	// it should point at a mounted volume, as local disk doesn't survive
+	// restarts.
+	if dir := os.Getenv("ANALYSES_DIR"); dir != "" {
+		analysisStore = storage.NewAnalysisStore(dir)
+	}
+
+	// As with analyses, audit records only go to the service log, which
+	// Cloud Logging keeps, unless AUDIT_DIR is set.
+	if dir := os.Getenv("AUDIT_DIR"); dir != "" || !cloudRunMode {
+		if dir == "" {
+			dir = defaultAuditDir
 		}
+		auditLog = storage.NewAuditLog(dir)
+	}
 
-		var logs []analytics.LogEntry
-		if err := json.Unmarshal(data, &logs); err != nil {
-			c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("parse json err: %v", err)})
-			return
+	if key != nil {
+		if err := uploadStore.SetKey(key, allowPlaintext); err != nil {
+			log.Fatalf("Error loading upload encryption key: %v", err)
 		}
+		if analysisStore != nil {
+			if err := analysisStore.SetKey(key, allowPlaintext); err != nil {
+				log.Fatalf("Error loading upload encryption key: %v", err)
+			}
+		}
+		log.Println("Uploads and analyses are encrypted at rest")
+	}
 
-		// Analyze the logs
-		analysis, err := analyticsService.AnalyzeLogs(c.Request.Context(), logs)
-		if err != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{"error": fmt.Sprintf("analysis err: %v", err)})
-			return
+	var indexStore analytics.IndexStore
+	if dir := os.Getenv("SEMANTIC_INDEX_DIR"); dir != "" {
+		store := storage.NewIndexStore(dir)
+		if key != nil {
+			if err := store.SetKey(key, allowPlaintext); err != nil {
+				log.Fatalf("Error loading upload encryption key: %v", err)
+			}
 		}
+		indexStore = store
+	}
+	if semanticIndex, err = analytics.NewVectorIndex(indexStore); err != nil {
+		log.Fatalf("Error loading semantic index: %v", err)
+	}
 
-		c.JSON(http.StatusOK, gin.H{
-			"message":  "File successfully uploaded and analyzed",
-			"analysis": analysis,
-		})
-	})
+	workers := defaultBatchWorkers
+	if raw := os.Getenv("BATCH_WORKERS"); raw != "" {
+		n, err := strconv.Atoi(raw)
+		if err != nil || n <= 0 {
+			log.Fatalf("Invalid BATCH_WORKERS: %q", raw)
+		}
+		workers = n
+	}
+	batchWorkers = make(chan struct{}, workers)
 
-	// Log analysis endpoint
-	router.POST("/analyze/logs", func(c *gin.Context) {
-		var logs []analytics.LogEntry
-		if err := c.BindJSON(&logs); err != nil {
-			c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("invalid request body: %v", err)})
-			return
+	if raw := os.Getenv("MAX_DECOMPRESSED_BODY"); raw != "" {
+		n, err := strconv.ParseInt(raw, 10, 64)
+		if err != nil || n <= 0 {
+			log.Fatalf("Invalid MAX_DECOMPRESSED_BODY: %q", raw)
 		}
+		maxDecompressedBody = n
+	}
 
-		analysis, err := analyticsService.AnalyzeLogs(c.Request.Context(), logs)
+	if raw := os.Getenv("INGEST_BUFFER_SIZE"); raw != "" {
+		n, err := strconv.Atoi(raw)
+		if err != nil || n <= 0 {
+			log.Fatalf("Invalid INGEST_BUFFER_SIZE: %q", raw)
+		}
+		ingestBufferSize = n
+	}
+	if raw := os.Getenv("INGEST_BUFFER_WINDOW"); raw != "" {
+		d, err := time.ParseDuration(raw)
+		if err != nil || d < 0 {
+			log.Fatalf("Invalid INGEST_BUFFER_WINDOW: %q", raw)
+		}
+		ingestBufferWindow = d
+	}
+	if dir := os.Getenv("BUFFERS_DIR"); dir != "" {
+		bufferStore = storage.NewBufferStore(dir)
+		if key != nil {
+			if err := bufferStore.SetKey(key, allowPlaintext); err != nil {
+				log.Fatalf("Error loading upload encryption key: %v", err)
+			}
+		}
+		restored, err := restoreLogBuffers()
 		if err != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{"error": fmt.Sprintf("error generating analysis: %v", err)})
-			return
+			log.Fatalf("Error restoring log buffers: %v", err)
 		}
+		log.Printf("Restored %d log buffer(s) from %s", restored, dir)
+	}
 
-		c.JSON(http.StatusOK, gin.H{"analysis": analysis})
-	})
+	tenantLimits, err = analytics.NewLimitRegistry(os.Getenv("TENANT_LIMITS_FILE"))
+	if err != nil {
+		log.Fatalf("Error loading tenant limits: %v", err)
+	}
+	// Daily and monthly quotas only count the calls of this instance since
+	// it started, unless QUOTA_DIR names a directory all instances share.
+	var quotaStore analytics.QuotaStore
+	if dir := os.Getenv("QUOTA_DIR"); dir != "" {
+		quotaStore = storage.NewQuotaStore(dir)
+	}
+	if quotaMeter, err = analytics.NewQuotaMeter(quotaStore); err != nil {
+		log.Fatalf("Error loading quota usage: %v", err)
+	}
 
-	// Performance analysis endpoint
-	router.POST("/analyze/performance", func(c *gin.Context) {
-		var logs []analytics.LogEntry
-		if err := c.BindJSON(&logs); err != nil {
-			c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("invalid request body: %v", err)})
-			return
+	if modelPrices, err = analytics.ParseModelPrices(os.Getenv("MODEL_PRICES")); err != nil {
+		log.Fatalf("Invalid MODEL_PRICES: %v", err)
+	}
+
+	if path := os.Getenv("TENANTS_FILE"); path != "" {
+		if tenantRegistry, err = tenants.Load(path); err != nil {
+			log.Fatalf("Error loading tenants: %v", err)
 		}
+		log.Printf("Multi-tenant mode: %d tenant(s), API keys required", len(tenantRegistry.IDs()))
+	}
 
-		analysis, err := analyticsService.AnalyzePerformance(c.Request.Context(), logs)
-		if err != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{"error": fmt.Sprintf("error generating analysis: %v", err)})
-			return
+	fieldMappings, err = parser.NewMappingRegistry(os.Getenv("FIELD_MAPPINGS_FILE"))
+	if err != nil {
+		log.Fatalf("Error loading field mappings: %v", err)
+	}
+
+	feedback, err = analytics.NewFeedbackRegistry(os.Getenv("FEEDBACK_FILE"))
+	if err != nil {
+		log.Fatalf("Error loading feedback: %v", err)
+	}
+
+	prompts, err = analytics.NewPromptRegistry(os.Getenv("PROMPTS_FILE"))
+	if err != nil {
+		log.Fatalf("Error loading prompt templates: %v", err)
+	}
+	serviceConfig.Prompts = prompts
+
+	if key := os.Getenv("OPENAI_API_KEY"); key != "" {
+		serviceConfig.OpenAI = llm.NewOpenAI(key, os.Getenv("OPENAI_BASE_URL"))
+	}
+	consensusModels, err := analytics.ParseModels(os.Getenv("CONSENSUS_MODELS"))
+	if err != nil {
+		log.Fatalf("Error parsing CONSENSUS_MODELS: %v", err)
+	}
+	for _, m := range consensusModels {
+		if m.Provider == analytics.ProviderOpenAI && os.Getenv("OPENAI_API_KEY") == "" {
+			log.Fatalf("CONSENSUS_MODELS lists %s but OPENAI_API_KEY is not set", m)
 		}
+	}
+	serviceConfig.ConsensusModels = consensusModels
 
-		c.JSON(http.StatusOK, gin.H{"analysis": analysis})
-	})
+	analyticsService = analytics.New(serviceConfig)
+	log.Println("Successfully initialized Analytics service")
 
-	// CSV conversion endpoint
-	router.POST("/convert/to-csv", func(c *gin.Context) {
-		var logs []analytics.LogEntry
-		if err := c.BindJSON(&logs); err != nil {
-			c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("invalid request body: %v", err)})
-			return
+	if cloudRunMode {
+		log.Println("Running in Cloud Run mode: background jobs disabled, use /tasks endpoints")
+		if unset := unsetStateVars(); len(unset) > 0 {
+			log.Printf("Warning: %s unset; that state is kept in instance memory, split across instances and lost when an instance stops", strings.Join(unset, ", "))
 		}
+	} else if uploadRetention > 0 {
+		go runPeriodically(time.Hour, func() {
+			if removed, err := uploadStore.Cleanup(uploadRetention); err != nil {
+				log.Printf("Upload cleanup failed: %v", err)
+			} else if removed > 0 {
+				log.Printf("Upload cleanup removed %d file(s)", removed)
+			}
+		})
+	}
+	if !cloudRunMode && analysesRetention > 0 && analysisStore != nil {
+		go runPeriodically(time.Hour, func() {
+			if removed, err := analysisStore.Cleanup(analysesRetention); err != nil {
+				log.Printf("Analyses cleanup failed: %v", err)
+			} else if removed > 0 {
+				log.Printf("Analyses cleanup removed %d analysis(es)", removed)
+			}
+		})
+	}
 
-		csvData, err := analyticsService.ConvertToCSV(logs)
-		if err != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{"error": fmt.Sprintf("error converting to CSV: %v", err)})
-			return
+	// Initialize router with trusted proxy configuration
+	gin.SetMode(gin.ReleaseMode)
+	router := gin.Default()
+	router.SetTrustedProxies([]string{"127.0.0.1"})
+	router.Use(auditRequests, gzipResponses, decompressRequests, authenticateTenant)
+
+	// Tenants may only email their own domains and read their own Cloud
+	// Storage locations: those listed in TENANTS_FILE in multi-tenant mode,
+	// or else those of EMAIL_ALLOWED_DOMAINS and SCHEDULE_GCS_PREFIXES.
+	emailDomains, gcsPrefixes := envList("EMAIL_ALLOWED_DOMAINS"), envList("SCHEDULE_GCS_PREFIXES")
+	if tenantRegistry != nil {
+		emailDomains, gcsPrefixes = tenantRegistry.EmailDomains, tenantRegistry.GCSPrefixes
+	}
+
+	emailConfig, err := notify.EmailConfigFromEnv()
+	if err != nil {
+		log.Fatalf("Error configuring email: %v", err)
+	}
+	notifier = notify.New(notify.Config{
+		Email:            emailConfig,
+		Incidents:        notify.IncidentConfigFromEnv(),
+		AllowPrivateURLs: os.Getenv("NOTIFY_ALLOW_PRIVATE_URLS") == "true",
+		EmailDomains:     emailDomains,
+	})
+	if notifier.EmailEnabled() {
+		log.Println("Email delivery enabled")
+	}
+	if notifier.IncidentsEnabled() {
+		log.Println("Incident alerting enabled")
+	}
+	publicURL = strings.TrimRight(os.Getenv("PUBLIC_URL"), "/")
+	for _, ch := range []notify.Channel{
+		{Type: notify.ChannelSlack, URL: os.Getenv("ALERT_SLACK_WEBHOOK_URL")},
+		{Type: notify.ChannelWebhook, URL: os.Getenv("ALERT_WEBHOOK_URL")},
+	} {
+		if ch.URL == "" {
+			continue
+		}
+		if err := ch.Validate(); err != nil {
+			log.Fatalf("Error configuring issue alerts: %v", err)
+		}
+		issueAlertChannels = append(issueAlertChannels, ch)
+	}
+
+	alertRules, err = alerts.NewRegistry(os.Getenv("ALERT_RULES_FILE"), notifier)
+	if err != nil {
+		log.Fatalf("Error loading alert rules: %v", err)
+	}
+
+	bigQuery, err = bigquery.FromEnv()
+	if err != nil {
+		log.Fatalf("Invalid BigQuery configuration: %v", err)
+	}
+	if bigQuery != nil {
+		log.Printf("Exporting analyses to BigQuery dataset %s.%s (%s)", bigQuery.Project, bigQuery.Dataset, bigQuery.Mode)
+	}
+
+	kafkaConfig, err := kafka.FromEnv()
+	if err != nil {
+		log.Fatalf("Invalid Kafka configuration: %v", err)
+	}
+	if kafkaConfig != nil && cloudRunMode {
+		log.Println("KAFKA_BROKERS is ignored in Cloud Run mode, which runs no background consumers")
+	} else if kafkaConfig != nil {
+		if err := startKafkaConsumer(*kafkaConfig); err != nil {
+			log.Fatalf("Invalid Kafka configuration: %v", err)
 		}
+		log.Printf("Consuming topics %s from %s into tenant %s's kafka buffer", strings.Join(kafkaConfig.Topics, ","), strings.Join(kafkaConfig.Brokers, ","), kafkaTenant)
+	}
 
-		c.Header("Content-Disposition", "attachment; filename=analytics.csv")
-		c.Data(http.StatusOK, "text/csv", csvData)
+	schedules, err = scheduler.New(scheduler.Config{
+		Path:    os.Getenv("SCHEDULES_FILE"),
+		Run:     runScheduledAnalysis,
+		Timeout: scheduledRunTimeout,
+		Sources: scheduler.SourceConfig{
+			AllowPrivateURLs: os.Getenv("SCHEDULE_ALLOW_PRIVATE_URLS") == "true",
+			GCSPrefixes:      gcsPrefixes,
+			Uploads:          uploadStore.Load,
+		},
+		Notifier: notifier,
 	})
+	if err != nil {
+		log.Fatalf("Error loading schedules: %v", err)
+	}
+	if !cloudRunMode {
+		go runPeriodically(time.Minute, func() {
+			if ran := schedules.RunDue(context.Background()); ran > 0 {
+				log.Printf("Ran %d scheduled analysis(es)", ran)
+			}
+		})
+	}
+
+	registerRoutes(router)
+
+	// Task endpoints for externally triggered jobs (Cloud Scheduler / Cloud
+	// Tasks). Only registered when a shared token is configured.
+	if token := os.Getenv("TASKS_AUTH_TOKEN"); token != "" {
+		registerTaskRoutes(router, token)
+	} else if cloudRunMode {
+		log.Println("TASKS_AUTH_TOKEN is not set, /tasks endpoints are disabled")
+	}
+
+	// Admin endpoints. Only registered when ADMIN_TOKEN is set.
+	if token := os.Getenv("ADMIN_TOKEN"); token != "" {
+		registerAdminRoutes(router, token)
+	}
 
 	log.Println("Starting server...")
 	if err := router.Run(":" + port); err != nil {
@@ -158,22 +521,40 @@ func main() {
 	}
 }
 
-func filterPerformanceInsights(insights []string) []string {
-	var performanceInsights []string
-	for _, insight := range insights {
-		// Simple filtering based on keywords
-		if containsAny(insight, []string{"slow", "performance", "latency", "duration", "response time"}) {
-			performanceInsights = append(performanceInsights, insight)
-		}
+// envList returns a lookup that gives every tenant the comma-separated
+// values of the environment variable name.
+func envList(name string) func(tenant string) []string {
+	var values []string
+	if raw := os.Getenv(name); raw != "" {
+		values = strings.Split(raw, ",")
 	}
-	return performanceInsights
+	return func(string) []string { return values }
+}
+
+// stateVars name the files and directories that keep state changed at
+// runtime. Without them that state only lives in memory.
+var stateVars = []string{
+	"TENANT_LIMITS_FILE", "QUOTA_DIR", "FEEDBACK_FILE", "PROMPTS_FILE",
+	"FIELD_MAPPINGS_FILE", "ALERT_RULES_FILE", "SCHEDULES_FILE",
+	"BUFFERS_DIR", "SEMANTIC_INDEX_DIR", "INCIDENTS_DIR",
 }
 
-func containsAny(s string, keywords []string) bool {
-	for _, keyword := range keywords {
-		if strings.Contains(strings.ToLower(s), strings.ToLower(keyword)) {
-			return true
+// unsetStateVars returns the stateVars that are not set.
+func unsetStateVars() []string {
+	var unset []string
+	for _, name := range stateVars {
+		if os.Getenv(name) == "" {
+			unset = append(unset, name)
 		}
 	}
-	return false
+	return unset
+}
+
+// runPeriodically calls fn every interval for the lifetime of the process.
+func runPeriodically(interval time.Duration, fn func()) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for range ticker.C {
+		fn()
+	}
 }
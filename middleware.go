@@ -0,0 +1,434 @@
+package main
+
+import (
+	"bufio"
+	"compress/flate"
+	"compress/gzip"
+	"compress/zlib"
+	"context"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"analyticsai/ai-service/analytics"
+	"analyticsai/ai-service/analytics/llm"
+	"analyticsai/ai-service/storage"
+
+	"github.com/gin-gonic/gin"
+)
+
+// auditRequests records who called which endpoint, with the size of the
+// request and response as sent over the wire, the resulting status and the
+// model calls made, in the audit log. Health checks are not recorded.
+func auditRequests(c *gin.Context) {
+	if c.Request.URL.Path == "/health" {
+		c.Next()
+		return
+	}
+	start := time.Now()
+	body := &countingReader{ReadCloser: c.Request.Body}
+	c.Request.Body = body
+	contentLength := c.Request.ContentLength
+	w := c.Writer
+	c.Next()
+
+	record := storage.AuditRecord{
+		Time:          start.UTC(),
+		Credential:    credentialFingerprint(c),
+		ClientIP:      c.ClientIP(),
+		UserAgent:     c.Request.UserAgent(),
+		Method:        c.Request.Method,
+		Path:          c.Request.URL.Path,
+		Query:         c.Request.URL.RawQuery,
+		Status:        w.Status(),
+		RequestBytes:  body.n,
+		ResponseBytes: int64(w.Size()),
+		DurationMS:    time.Since(start).Milliseconds(),
+		Models:        analytics.ModelUsageFromContext(c.Request.Context()),
+		Limit:         c.GetString(limitHitKey),
+	}
+	if contentLength > record.RequestBytes {
+		record.RequestBytes = contentLength
+	}
+	if record.ResponseBytes < 0 {
+		record.ResponseBytes = 0
+	}
+	if !strings.HasPrefix(record.Path, "/admin/") && !strings.HasPrefix(record.Path, "/tasks/") {
+		record.Tenant = tenantID(c)
+	}
+	writeAuditRecord(record)
+}
+
+// writeAuditRecord appends record to the audit log, or to the service log
+// without AUDIT_DIR.
+func writeAuditRecord(record storage.AuditRecord) {
+	if auditLog == nil {
+		line, _ := json.Marshal(record)
+		log.Printf("Audit: %s", line)
+		return
+	}
+	if err := auditLog.Append(record); err != nil {
+		log.Printf("Error writing audit record: %v", err)
+	}
+}
+
+// countingReader counts the bytes read from a request body.
+type countingReader struct {
+	io.ReadCloser
+	n int64
+}
+
+func (r *countingReader) Read(p []byte) (int, error) {
+	n, err := r.ReadCloser.Read(p)
+	r.n += int64(n)
+	return n, err
+}
+
+// credentialFingerprint identifies the API key or token a request carries
+// without recording it: the first 16 hex digits of its SHA-256.
+func credentialFingerprint(c *gin.Context) string {
+	key := c.GetHeader("X-API-Key")
+	if key == "" {
+		key, _ = strings.CutPrefix(c.GetHeader("Authorization"), "Bearer ")
+	}
+	if key == "" {
+		return ""
+	}
+	sum := sha256.Sum256([]byte(key))
+	return hex.EncodeToString(sum[:8])
+}
+
+// tenantContextKey is the gin context key of the tenant authenticateTenant
+// identified.
+const tenantContextKey = "tenant"
+
+// tenantID identifies the calling tenant: the owner of the request's API
+// key in multi-tenant mode, or else DefaultTenant. Without API keys nothing
+// vouches for a tenant the client names, so the X-Tenant-ID header is not
+// trusted; it would let any caller read and delete other tenants' data.
+func tenantID(c *gin.Context) string {
+	if tenant := c.GetString(tenantContextKey); tenant != "" {
+		return tenant
+	}
+	return analytics.DefaultTenant
+}
+
+// authenticateTenant identifies the tenant of each request by its API key,
+// sent as X-API-Key or as a bearer token, when TENANTS_FILE is set. The
+// health check and the /admin and /tasks endpoints, which have their own
+// tokens, are exempt, as are the dashboard's assets and its WebSocket, whose
+// requests carry the key in their first message.
+func authenticateTenant(c *gin.Context) {
+	path := c.FullPath()
+	if tenantRegistry == nil || path == "/health" || strings.HasPrefix(path, "/admin/") || strings.HasPrefix(path, "/tasks/") ||
+		strings.HasPrefix(path, "/dashboard") || path == "/ws/analyze" {
+		c.Next()
+		return
+	}
+
+	key := c.GetHeader("X-API-Key")
+	if key == "" {
+		key, _ = strings.CutPrefix(c.GetHeader("Authorization"), "Bearer ")
+	}
+	tenant, ok := tenantRegistry.Authenticate(key)
+	if !ok {
+		c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "missing or invalid API key"})
+		return
+	}
+	if header := c.GetHeader("X-Tenant-ID"); header != "" && header != tenant {
+		c.AbortWithStatusJSON(http.StatusForbidden, gin.H{"error": fmt.Sprintf("API key does not belong to tenant %q", header)})
+		return
+	}
+	c.Set(tenantContextKey, tenant)
+	c.Next()
+}
+
+// applyTenantLimits attaches the calling tenant's resource limits and
+// usage quota to the request context, where the analysis pipeline enforces
+// them, along with the tenant's own Gemini key, if any, and the output
+// language requested by the lang query parameter.
+func applyTenantLimits(c *gin.Context) {
+	ctx, cancel, err := withTenantLimits(c.Request.Context(), tenantID(c), c.Query("lang"))
+	if err != nil {
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	defer cancel()
+	c.Request = c.Request.WithContext(ctx)
+	c.Writer = &redactionReportWriter{ResponseWriter: c.Writer, ctx: ctx}
+	c.Next()
+}
+
+// withTenantLimits returns ctx with the tenant's limits, quota and Gemini
+// key, and the output language lang, for one analysis.
+func withTenantLimits(ctx context.Context, tenant, lang string) (context.Context, context.CancelFunc, error) {
+	language, err := analytics.ParseLanguage(lang)
+	if err != nil {
+		return nil, nil, err
+	}
+	ctx, cancel := analytics.WithLimits(ctx, tenantLimits.Get(tenant))
+	ctx = analytics.WithQuota(ctx, quotaMeter, tenant)
+	if tenantRegistry != nil {
+		if key := tenantRegistry.GeminiKey(tenant); key != "" {
+			ctx = llm.WithGeminiKey(ctx, key)
+		}
+	}
+	return analytics.WithLanguage(ctx, language), cancel, nil
+}
+
+// decompressRequests decodes request bodies sent with Content-Encoding gzip
+// or deflate, so shippers can post compressed logs directly instead of as a
+// multipart upload.
+func decompressRequests(c *gin.Context) {
+	encoding := strings.ToLower(strings.TrimSpace(c.GetHeader("Content-Encoding")))
+	if encoding == "" || encoding == "identity" {
+		c.Next()
+		return
+	}
+	var body io.ReadCloser
+	var err error
+	switch encoding {
+	case "gzip", "x-gzip":
+		body, err = gzip.NewReader(c.Request.Body)
+	case "deflate":
+		body, err = newDeflateReader(c.Request.Body)
+	default:
+		c.AbortWithStatusJSON(http.StatusUnsupportedMediaType, gin.H{"error": fmt.Sprintf("unsupported Content-Encoding %q, must be gzip or deflate", encoding)})
+		return
+	}
+	if err != nil {
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("invalid %s request body: %v", encoding, err)})
+		return
+	}
+	c.Request.Body = http.MaxBytesReader(c.Writer, body, maxDecompressedBody)
+	// The body is now plain, so nothing reading these headers later may
+	// decode it again.
+	c.Request.Header.Del("Content-Encoding")
+	c.Request.Header.Del("Content-Length")
+	c.Request.ContentLength = -1
+	c.Next()
+}
+
+// newDeflateReader reads a deflate body: zlib-wrapped as HTTP specifies, or
+// raw deflate as some clients send it.
+func newDeflateReader(r io.Reader) (io.ReadCloser, error) {
+	br := bufio.NewReader(r)
+	header, err := br.Peek(2)
+	if err != nil && err != io.EOF {
+		return nil, err
+	}
+	if len(header) == 2 && header[0]&0x0f == 8 && (uint16(header[0])<<8|uint16(header[1]))%31 == 0 {
+		return zlib.NewReader(br)
+	}
+	return flate.NewReader(br), nil
+}
+
+// isBodyTooLarge reports whether err is a request body exceeding
+// maxDecompressedBody.
+func isBodyTooLarge(err error) bool {
+	var maxErr *http.MaxBytesError
+	return errors.As(err, &maxErr)
+}
+
+// gzipMinSize is the smallest response body worth compressing.
+const gzipMinSize = 1024
+
+// gzipContentTypes are the response types gzipResponses compresses.
+var gzipContentTypes = []string{"application/json", "text/csv", "application/x-ndjson"}
+
+// gzipResponses compresses JSON, CSV and NDJSON responses for clients that
+// accept gzip. Upgrade requests are left alone, as their connections are
+// taken over.
+func gzipResponses(c *gin.Context) {
+	if c.Request.Method == http.MethodHead || c.GetHeader("Upgrade") != "" || !acceptsGzip(c.GetHeader("Accept-Encoding")) {
+		c.Next()
+		return
+	}
+	w := &gzipResponseWriter{ResponseWriter: c.Writer}
+	c.Writer = w
+	defer w.close()
+	c.Next()
+}
+
+// acceptsGzip reports whether an Accept-Encoding header allows gzip.
+func acceptsGzip(header string) bool {
+	for _, part := range strings.Split(header, ",") {
+		coding, params, _ := strings.Cut(strings.TrimSpace(part), ";")
+		coding = strings.ToLower(strings.TrimSpace(coding))
+		if coding != "gzip" && coding != "*" {
+			continue
+		}
+		if q, ok := strings.CutPrefix(strings.ReplaceAll(params, " ", ""), "q="); ok {
+			if v, err := strconv.ParseFloat(q, 64); err == nil && v == 0 {
+				continue
+			}
+		}
+		return true
+	}
+	return false
+}
+
+// gzipResponseWriter holds back the start of the body until it knows the
+// response is worth compressing: of a compressible type and at least
+// gzipMinSize bytes, or flushed by a streaming handler.
+type gzipResponseWriter struct {
+	gin.ResponseWriter
+	buf     []byte
+	gz      *gzip.Writer
+	decided bool // whether buf has been released, compressed or not
+}
+
+func (w *gzipResponseWriter) Write(data []byte) (int, error) {
+	if w.decided {
+		if w.gz != nil {
+			return w.gz.Write(data)
+		}
+		return w.ResponseWriter.Write(data)
+	}
+	if !w.compressible() {
+		if err := w.release(false); err != nil {
+			return 0, err
+		}
+		return w.ResponseWriter.Write(data)
+	}
+	w.buf = append(w.buf, data...)
+	if len(w.buf) >= gzipMinSize {
+		if err := w.release(true); err != nil {
+			return 0, err
+		}
+	}
+	return len(data), nil
+}
+
+func (w *gzipResponseWriter) WriteString(s string) (int, error) {
+	return w.Write([]byte(s))
+}
+
+// Flush sends what has been written so far, compressing it if the response
+// qualifies, so that streamed responses are compressed too.
+func (w *gzipResponseWriter) Flush() {
+	if !w.decided && len(w.buf) > 0 {
+		w.release(w.compressible())
+	}
+	if w.gz != nil {
+		w.gz.Flush()
+	}
+	w.ResponseWriter.Flush()
+}
+
+// compressible reports whether the response can be compressed.
+func (w *gzipResponseWriter) compressible() bool {
+	header := w.Header()
+	if w.ResponseWriter.Written() || header.Get("Content-Encoding") != "" || header.Get("Content-Range") != "" {
+		return false
+	}
+	switch w.Status() {
+	case http.StatusNoContent, http.StatusNotModified, http.StatusPartialContent:
+		return false
+	}
+	mediaType, _, _ := strings.Cut(header.Get("Content-Type"), ";")
+	return containsField(gzipContentTypes, strings.ToLower(strings.TrimSpace(mediaType)))
+}
+
+// release writes the held-back body, compressed or not; later writes
+// follow the same way.
+func (w *gzipResponseWriter) release(compress bool) error {
+	w.decided = true
+	buf := w.buf
+	w.buf = nil
+	if compress {
+		header := w.Header()
+		header.Set("Content-Encoding", "gzip")
+		header.Add("Vary", "Accept-Encoding")
+		header.Del("Content-Length")
+		w.gz = gzip.NewWriter(w.ResponseWriter)
+		_, err := w.gz.Write(buf)
+		return err
+	}
+	if len(buf) == 0 {
+		return nil
+	}
+	_, err := w.ResponseWriter.Write(buf)
+	return err
+}
+
+// close ends the response, writing a body smaller than gzipMinSize as it
+// is.
+func (w *gzipResponseWriter) close() {
+	if !w.decided {
+		w.release(false)
+	}
+	if w.gz != nil {
+		w.gz.Close()
+	}
+}
+
+// redactionReportWriter adds an X-Redacted header summarizing what was
+// redacted from the request's Gemini prompts, e.g. "email=2,ip=5", and an
+// X-Model-Warnings header with the number of repairs made to the model's
+// output. The headers are set when the status is written, after the
+// analysis has run.
+type redactionReportWriter struct {
+	gin.ResponseWriter
+	ctx context.Context
+}
+
+func (w *redactionReportWriter) WriteHeader(code int) {
+	counts := analytics.RedactionsFromContext(w.ctx)
+	if len(counts) > 0 {
+		parts := make([]string, 0, len(counts))
+		for category, n := range counts {
+			parts = append(parts, fmt.Sprintf("%s=%d", category, n))
+		}
+		sort.Strings(parts)
+		w.Header().Set("X-Redacted", strings.Join(parts, ","))
+	}
+	if warnings := analytics.WarningsFromContext(w.ctx); len(warnings) > 0 {
+		w.Header().Set("X-Model-Warnings", strconv.Itoa(len(warnings)))
+	}
+	w.ResponseWriter.WriteHeader(code)
+}
+
+// requireAuditLog rejects requests to the endpoints that read the audit
+// log when it is only written to the service log.
+func requireAuditLog(c *gin.Context) {
+	if auditLog == nil {
+		c.AbortWithStatusJSON(http.StatusNotFound, gin.H{"error": "audit records are only written to the service log; set AUDIT_DIR to query them"})
+		return
+	}
+	c.Next()
+}
+
+// requireAnalysisStore rejects requests to the stored-analysis endpoints
+// when results aren't persisted.
+func requireAnalysisStore(c *gin.Context) {
+	if analysisStore == nil {
+		c.AbortWithStatusJSON(http.StatusNotFound, gin.H{"error": "analyses are not stored; set ANALYSES_DIR to enable"})
+		return
+	}
+	c.Next()
+}
+
+// requireBearerToken rejects requests that don't carry the expected token
+// in the Authorization header. Cloud Scheduler and Cloud Tasks HTTP targets
+// can both be configured to send it.
+func requireBearerToken(token string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		auth := c.GetHeader("Authorization")
+		if subtle.ConstantTimeCompare([]byte(auth), []byte("Bearer "+token)) != 1 {
+			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "unauthorized"})
+			return
+		}
+		c.Next()
+	}
+}
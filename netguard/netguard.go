@@ -0,0 +1,94 @@
+// Package netguard builds HTTP clients for URLs tenants supply, such as
+// schedule sources and notification webhooks, that refuse to connect to
+// the service's own network.
+package netguard
+
+import (
+	"errors"
+	"net"
+	"net/http"
+	"net/netip"
+	"syscall"
+	"time"
+)
+
+// ErrPrivateAddress is returned for connections to addresses that are not
+// globally reachable.
+var ErrPrivateAddress = errors.New("url must not resolve to a private address")
+
+// deniedPrefixes are the special-purpose ranges of the IANA IPv4 and IPv6
+// registries that aren't globally reachable, plus multicast and the NAT64
+// and 6to4 prefixes, through which any IPv4 address can be reached.
+var deniedPrefixes = []netip.Prefix{
+	netip.MustParsePrefix("0.0.0.0/8"),       // "this network"
+	netip.MustParsePrefix("10.0.0.0/8"),      // private
+	netip.MustParsePrefix("100.64.0.0/10"),   // carrier-grade NAT
+	netip.MustParsePrefix("127.0.0.0/8"),     // loopback
+	netip.MustParsePrefix("169.254.0.0/16"),  // link-local, incl. the metadata server
+	netip.MustParsePrefix("172.16.0.0/12"),   // private
+	netip.MustParsePrefix("192.0.0.0/24"),    // IETF protocol assignments
+	netip.MustParsePrefix("192.0.2.0/24"),    // documentation
+	netip.MustParsePrefix("192.88.99.0/24"),  // 6to4 relay anycast
+	netip.MustParsePrefix("192.168.0.0/16"),  // private
+	netip.MustParsePrefix("198.18.0.0/15"),   // benchmarking
+	netip.MustParsePrefix("198.51.100.0/24"), // documentation
+	netip.MustParsePrefix("203.0.113.0/24"),  // documentation
+	netip.MustParsePrefix("224.0.0.0/4"),     // multicast
+	netip.MustParsePrefix("240.0.0.0/4"),     // reserved, incl. broadcast
+	netip.MustParsePrefix("::/128"),          // unspecified
+	netip.MustParsePrefix("::1/128"),         // loopback
+	netip.MustParsePrefix("64:ff9b::/96"),    // NAT64
+	netip.MustParsePrefix("64:ff9b:1::/48"),  // local-use NAT64
+	netip.MustParsePrefix("100::/64"),        // discard-only
+	netip.MustParsePrefix("2001::/23"),       // IETF protocol assignments
+	netip.MustParsePrefix("2001:db8::/32"),   // documentation
+	netip.MustParsePrefix("2002::/16"),       // 6to4
+	netip.MustParsePrefix("fc00::/7"),        // unique local
+	netip.MustParsePrefix("fe80::/10"),       // link-local
+	netip.MustParsePrefix("ff00::/8"),        // multicast
+}
+
+// NewClient returns a client that refuses connections to addresses that
+// aren't globally reachable, which also covers redirects and DNS names
+// resolving to internal hosts such as the metadata server. The check is
+// made at dial time on the address actually dialed, so the client doesn't
+// use a proxy: through one, only the proxy's address would be checked.
+// Private addresses are allowed while *allowPrivate is true; it is read on
+// every dial.
+func NewClient(timeout time.Duration, allowPrivate *bool) *http.Client {
+	return &http.Client{
+		Timeout: timeout,
+		Transport: &http.Transport{
+			Proxy: nil,
+			DialContext: (&net.Dialer{
+				Timeout: 30 * time.Second,
+				Control: func(network, address string, _ syscall.RawConn) error {
+					if allowPrivate != nil && *allowPrivate {
+						return nil
+					}
+					return CheckAddress(address)
+				},
+			}).DialContext,
+		},
+	}
+}
+
+// CheckAddress returns ErrPrivateAddress for a host:port address that is not
+// a globally reachable IP address. IPv4-mapped IPv6 addresses are checked as
+// the IPv4 address they map to.
+func CheckAddress(address string) error {
+	addrPort, err := netip.ParseAddrPort(address)
+	if err != nil {
+		return ErrPrivateAddress
+	}
+	ip := addrPort.Addr().Unmap()
+	if ip.Zone() != "" {
+		return ErrPrivateAddress
+	}
+	for _, prefix := range deniedPrefixes {
+		if prefix.Contains(ip) {
+			return ErrPrivateAddress
+		}
+	}
+	return nil
+}
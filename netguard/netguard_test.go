@@ -0,0 +1,74 @@
+package netguard
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestCheckAddress(t *testing.T) {
+	tests := []struct {
+		address string
+		allowed bool
+	}{
+		{"93.184.216.34:443", true},
+		{"[2606:2800:220:1:248:1893:25c8:1946]:443", true},
+		{"8.8.8.8:53", true},
+		{"0.0.0.0:80", false},
+		{"0.1.2.3:80", false},
+		{"10.1.2.3:80", false},
+		{"100.64.0.1:80", false},
+		{"100.127.255.255:80", false},
+		{"127.0.0.1:80", false},
+		{"169.254.169.254:80", false},
+		{"172.16.0.1:80", false},
+		{"172.32.0.1:80", true},
+		{"192.0.0.8:80", false},
+		{"192.168.1.1:80", false},
+		{"198.18.0.1:80", false},
+		{"224.0.0.1:80", false},
+		{"255.255.255.255:80", false},
+		{"[::]:80", false},
+		{"[::1]:80", false},
+		{"[::ffff:127.0.0.1]:80", false},
+		{"[::ffff:169.254.169.254]:80", false},
+		{"[64:ff9b::a9fe:a9fe]:80", false},
+		{"[2002:a9fe:a9fe::1]:80", false},
+		{"[fd00::1]:80", false},
+		{"[fe80::1%eth0]:80", false},
+		{"[ff02::1]:80", false},
+		{"metadata.google.internal:80", false},
+	}
+	for _, tt := range tests {
+		err := CheckAddress(tt.address)
+		if tt.allowed && err != nil {
+			t.Errorf("CheckAddress(%q) = %v, want nil", tt.address, err)
+		}
+		if !tt.allowed && !errors.Is(err, ErrPrivateAddress) {
+			t.Errorf("CheckAddress(%q) = %v, want ErrPrivateAddress", tt.address, err)
+		}
+	}
+}
+
+func TestNewClient(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer server.Close()
+	// A proxy would be dialed instead of the target, which then goes
+	// unchecked.
+	t.Setenv("HTTP_PROXY", "http://93.184.216.34:3128")
+
+	allow := false
+	client := NewClient(5*time.Second, &allow)
+	if _, err := client.Get(server.URL); !errors.Is(err, ErrPrivateAddress) {
+		t.Fatalf("Get(%s) = %v, want ErrPrivateAddress", server.URL, err)
+	}
+
+	allow = true
+	resp, err := client.Get(server.URL)
+	if err != nil {
+		t.Fatalf("Get(%s) with private addresses allowed: %v", server.URL, err)
+	}
+	resp.Body.Close()
+}
@@ -0,0 +1,348 @@
+package notify
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"html/template"
+	"io"
+	"mime"
+	"mime/multipart"
+	"net"
+	"net/mail"
+	"net/smtp"
+	"net/textproto"
+	"os"
+	"strings"
+	"time"
+)
+
+const (
+	sendGridURL     = "https://api.sendgrid.com/v3/mail/send"
+	maxRecipients   = 20
+	attachmentName  = "analysis.json"
+	defaultSMTPPort = "587"
+)
+
+// EmailConfig configures email delivery through SendGrid, when
+// SendGridAPIKey is set, or an SMTP server.
+type EmailConfig struct {
+	From           string
+	SendGridAPIKey string
+	SMTPHost       string
+	SMTPPort       string
+	SMTPUsername   string
+	SMTPPassword   string
+}
+
+// EmailConfigFromEnv reads email delivery settings from EMAIL_FROM and
+// either SENDGRID_API_KEY or SMTP_HOST, SMTP_PORT, SMTP_USERNAME and
+// SMTP_PASSWORD. It returns nil if neither SendGrid nor SMTP is configured.
+func EmailConfigFromEnv() (*EmailConfig, error) {
+	cfg := EmailConfig{
+		From:           os.Getenv("EMAIL_FROM"),
+		SendGridAPIKey: os.Getenv("SENDGRID_API_KEY"),
+		SMTPHost:       os.Getenv("SMTP_HOST"),
+		SMTPPort:       os.Getenv("SMTP_PORT"),
+		SMTPUsername:   os.Getenv("SMTP_USERNAME"),
+		SMTPPassword:   os.Getenv("SMTP_PASSWORD"),
+	}
+	if cfg.SendGridAPIKey == "" && cfg.SMTPHost == "" {
+		return nil, nil
+	}
+	if _, err := mail.ParseAddress(cfg.From); err != nil {
+		return nil, fmt.Errorf("EMAIL_FROM must be a valid address: %v", err)
+	}
+	if cfg.SMTPPort == "" {
+		cfg.SMTPPort = defaultSMTPPort
+	}
+	return &cfg, nil
+}
+
+func validateEmail(to []string) error {
+	if len(to) == 0 || len(to) > maxRecipients {
+		return fmt.Errorf("email notifications need 1 to %d recipients", maxRecipients)
+	}
+	for _, addr := range to {
+		if _, err := mail.ParseAddress(addr); err != nil {
+			return fmt.Errorf("invalid email address %q", addr)
+		}
+	}
+	return nil
+}
+
+// checkEmail returns an error unless email is configured and tenant may
+// send it to the recipients to.
+func (n *Notifier) checkEmail(tenant string, to []string) error {
+	if n.cfg.Email == nil {
+		return fmt.Errorf("email delivery is not configured")
+	}
+	if err := validateEmail(to); err != nil {
+		return err
+	}
+	return n.CheckRecipients(tenant, to)
+}
+
+// CheckRecipients returns an error unless every address in to is in a
+// domain tenant may email, as listed by Config.EmailDomains. Domains match
+// case-insensitively and exactly, so "example.com" doesn't allow
+// "mail.example.com".
+func (n *Notifier) CheckRecipients(tenant string, to []string) error {
+	var domains []string
+	if n.cfg.EmailDomains != nil {
+		domains = n.cfg.EmailDomains(tenant)
+	}
+	for _, raw := range to {
+		addr, err := mail.ParseAddress(raw)
+		if err != nil {
+			return fmt.Errorf("invalid email address %q", raw)
+		}
+		domain := addr.Address[strings.LastIndex(addr.Address, "@")+1:]
+		if !containsFold(domains, domain) {
+			return fmt.Errorf("%s is not in an email domain allowed for tenant %q", addr.Address, tenant)
+		}
+	}
+	return nil
+}
+
+func containsFold(values []string, s string) bool {
+	for _, v := range values {
+		if strings.EqualFold(strings.TrimSpace(v), s) {
+			return true
+		}
+	}
+	return false
+}
+
+// reportIssue is an issue as it appears in analysis responses.
+type reportIssue struct {
+	Type        string   `json:"type"`
+	Description string   `json:"description"`
+	Severity    string   `json:"severity"`
+	Path        []string `json:"path"`
+}
+
+// Paths joins the issue's paths for display.
+func (i reportIssue) Paths() string {
+	return strings.Join(i.Path, ", ")
+}
+
+type reportInsight struct {
+	Text       string  `json:"text"`
+	Confidence float64 `json:"confidence"`
+	Grounded   bool    `json:"grounded"`
+}
+
+// Percent returns the confidence as a percentage.
+func (i reportInsight) Percent() float64 {
+	return i.Confidence * 100
+}
+
+type reportEndpoint struct {
+	Path         string  `json:"path"`
+	AvgDuration  int64   `json:"avg_duration"`
+	RequestCount int     `json:"request_count"`
+	ErrorRate    float64 `json:"error_rate"`
+}
+
+// reportData is the part of an analysis response shown in email reports.
+type reportData struct {
+	Message  Message
+	Analysis struct {
+		Insights            []reportInsight  `json:"insights"`
+		PotentialIssues     []reportIssue    `json:"potential_issues"`
+		PopularPages        []string         `json:"popular_pages"`
+		SlowPages           []reportEndpoint `json:"slow_pages"`
+		SlowEndpoints       []reportEndpoint `json:"slow_endpoints"`
+		PerformancePatterns []string         `json:"performance_patterns"`
+		ResourceIssues      []reportIssue    `json:"resource_issues"`
+		Recommendations     []string         `json:"recommendations"`
+	} `json:"analysis"`
+	Baseline *struct {
+		Baseline    string `json:"baseline"`
+		Regressed   bool   `json:"regressed"`
+		Regressions []struct {
+			Path            string  `json:"path"`
+			ErrorRateChange float64 `json:"error_rate_change"`
+			P95Change       int64   `json:"p95_duration_change"`
+		} `json:"regressions"`
+	} `json:"baseline_comparison"`
+}
+
+var reportTemplate = template.Must(template.New("report").Parse(`<!DOCTYPE html>
+<html><body style="font-family: sans-serif; color: #222;">
+<h2>{{.Title}}</h2>
+{{with .Data}}
+<p>{{.Message.Time.Format "2006-01-02 15:04 MST"}}{{if .Message.AnalysisID}} &middot; analysis {{.Message.AnalysisID}}{{end}}</p>
+{{if .Message.Error}}<p style="color: #b00020;"><strong>Error:</strong> {{.Message.Error}}</p>{{end}}
+{{with .Baseline}}<h3>Baseline {{.Baseline}}: {{if .Regressed}}<span style="color: #b00020;">regressed</span>{{else}}no regression{{end}}</h3>
+{{if .Regressions}}<ul>{{range .Regressions}}<li>{{.Path}}: error rate {{printf "%+.2f" .ErrorRateChange}} pp, p95 {{printf "%+d" .P95Change}}ms</li>{{end}}</ul>{{end}}{{end}}
+{{with .Analysis}}
+{{if .PotentialIssues}}<h3>Potential issues</h3><ul>{{range .PotentialIssues}}<li><strong>[{{.Severity}}] {{.Type}}</strong>: {{.Description}}{{with .Paths}} ({{.}}){{end}}</li>{{end}}</ul>{{end}}
+{{if .ResourceIssues}}<h3>Resource issues</h3><ul>{{range .ResourceIssues}}<li><strong>[{{.Severity}}] {{.Type}}</strong>: {{.Description}}</li>{{end}}</ul>{{end}}
+{{if .Insights}}<h3>Insights</h3><ul>{{range .Insights}}<li>{{.Text}} <small>({{printf "%.0f" .Percent}}% confidence{{if not .Grounded}}, unverified{{end}})</small></li>{{end}}</ul>{{end}}
+{{if .PerformancePatterns}}<h3>Performance patterns</h3><ul>{{range .PerformancePatterns}}<li>{{.}}</li>{{end}}</ul>{{end}}
+{{if .Recommendations}}<h3>Recommendations</h3><ul>{{range .Recommendations}}<li>{{.}}</li>{{end}}</ul>{{end}}
+{{if or .SlowPages .SlowEndpoints}}<h3>Slow endpoints</h3>
+<table cellpadding="4" style="border-collapse: collapse;"><tr><th align="left">Path</th><th>Avg (ms)</th><th>Requests</th><th>Error rate</th></tr>
+{{range .SlowPages}}<tr><td>{{.Path}}</td><td align="right">{{.AvgDuration}}</td><td align="right">{{.RequestCount}}</td><td align="right">{{printf "%.1f" .ErrorRate}}%</td></tr>{{end}}
+{{range .SlowEndpoints}}<tr><td>{{.Path}}</td><td align="right">{{.AvgDuration}}</td><td align="right">{{.RequestCount}}</td><td align="right">{{printf "%.1f" .ErrorRate}}%</td></tr>{{end}}
+</table>{{end}}
+{{if .PopularPages}}<h3>Popular pages</h3><p>{{range $i, $p := .PopularPages}}{{if $i}}, {{end}}{{$p}}{{end}}</p>{{end}}
+{{end}}
+{{end}}
+<p style="color: #888; font-size: small;">The full analysis is attached as JSON.</p>
+</body></html>
+`))
+
+func emailSubject(msg Message) string {
+	name := msg.Schedule
+	if name == "" {
+		name = "Log analysis"
+	}
+	if msg.Event == EventAnalysisFailed {
+		return fmt.Sprintf("[Analytics] %s failed", name)
+	}
+	return fmt.Sprintf("[Analytics] %s report", name)
+}
+
+// renderReport renders msg as an HTML email body.
+func renderReport(msg Message) (string, error) {
+	data := reportData{Message: msg}
+	if len(msg.Result) > 0 {
+		// The report shows whatever it can; unknown shapes just render less.
+		json.Unmarshal(msg.Result, &data)
+	}
+	var body bytes.Buffer
+	err := reportTemplate.Execute(&body, struct {
+		Title string
+		Data  reportData
+	}{emailSubject(msg), data})
+	return body.String(), err
+}
+
+func (n *Notifier) sendEmail(ctx context.Context, to []string, msg Message) error {
+	if err := n.checkEmail(msg.Tenant, to); err != nil {
+		return err
+	}
+	html, err := renderReport(msg)
+	if err != nil {
+		return fmt.Errorf("error rendering email: %v", err)
+	}
+	return n.deliverEmail(ctx, to, emailSubject(msg), html, msg.Result)
+}
+
+// deliverEmail sends an HTML email with an optional JSON attachment to
+// validated recipients.
+func (n *Notifier) deliverEmail(ctx context.Context, to []string, subject, html string, attachment []byte) error {
+	// Send to bare addresses so display names can't smuggle in headers.
+	addrs := make([]string, len(to))
+	for i, addr := range to {
+		parsed, _ := mail.ParseAddress(addr)
+		addrs[i] = parsed.Address
+	}
+	if n.cfg.Email.SendGridAPIKey != "" {
+		return n.sendGridMail(ctx, addrs, subject, html, attachment)
+	}
+	return n.smtpMail(ctx, addrs, subject, html, attachment)
+}
+
+func (n *Notifier) sendGridMail(ctx context.Context, to []string, subject, html string, attachment []byte) error {
+	type address struct {
+		Email string `json:"email"`
+	}
+	recipients := make([]address, len(to))
+	for i, addr := range to {
+		recipients[i] = address{addr}
+	}
+	from, _ := mail.ParseAddress(n.cfg.Email.From)
+	body := map[string]interface{}{
+		"personalizations": []map[string]interface{}{{"to": recipients}},
+		"from":             map[string]string{"email": from.Address, "name": from.Name},
+		"subject":          subject,
+		"content":          []map[string]string{{"type": "text/html", "value": html}},
+	}
+	if len(attachment) > 0 {
+		body["attachments"] = []map[string]string{{
+			"content":     base64.StdEncoding.EncodeToString(attachment),
+			"filename":    attachmentName,
+			"type":        "application/json",
+			"disposition": "attachment",
+		}}
+	}
+	return n.postJSON(ctx, sendGridURL, body, map[string]string{"Authorization": "Bearer " + n.cfg.Email.SendGridAPIKey})
+}
+
+// buildMIME assembles a multipart message with an HTML body and the
+// analysis as a JSON attachment.
+func (n *Notifier) buildMIME(to []string, subject, html string, attachment []byte) ([]byte, error) {
+	var buf bytes.Buffer
+	w := multipart.NewWriter(&buf)
+
+	fmt.Fprintf(&buf, "From: %s\r\n", n.cfg.Email.From)
+	fmt.Fprintf(&buf, "To: %s\r\n", strings.Join(to, ", "))
+	fmt.Fprintf(&buf, "Subject: %s\r\n", mime.QEncoding.Encode("utf-8", subject))
+	fmt.Fprintf(&buf, "Date: %s\r\n", time.Now().Format(time.RFC1123Z))
+	fmt.Fprintf(&buf, "MIME-Version: 1.0\r\n")
+	fmt.Fprintf(&buf, "Content-Type: multipart/mixed; boundary=%s\r\n\r\n", w.Boundary())
+
+	part, err := w.CreatePart(textproto.MIMEHeader{
+		"Content-Type":              {"text/html; charset=utf-8"},
+		"Content-Transfer-Encoding": {"base64"},
+	})
+	if err != nil {
+		return nil, err
+	}
+	writeBase64(part, []byte(html))
+
+	if len(attachment) > 0 {
+		part, err = w.CreatePart(textproto.MIMEHeader{
+			"Content-Type":              {"application/json"},
+			"Content-Transfer-Encoding": {"base64"},
+			"Content-Disposition":       {fmt.Sprintf("attachment; filename=%q", attachmentName)},
+		})
+		if err != nil {
+			return nil, err
+		}
+		writeBase64(part, attachment)
+	}
+	if err := w.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// writeBase64 writes data base64-encoded in 76-character lines.
+func writeBase64(w io.Writer, data []byte) {
+	encoded := base64.StdEncoding.EncodeToString(data)
+	for len(encoded) > 76 {
+		w.Write([]byte(encoded[:76] + "\r\n"))
+		encoded = encoded[76:]
+	}
+	w.Write([]byte(encoded + "\r\n"))
+}
+
+// smtpMail sends through the configured SMTP server. net/smtp has no
+// context support, so ctx only guards against starting after cancellation.
+func (n *Notifier) smtpMail(ctx context.Context, to []string, subject, html string, attachment []byte) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	data, err := n.buildMIME(to, subject, html, attachment)
+	if err != nil {
+		return fmt.Errorf("error building email: %v", err)
+	}
+	var auth smtp.Auth
+	cfg := n.cfg.Email
+	if cfg.SMTPUsername != "" {
+		auth = smtp.PlainAuth("", cfg.SMTPUsername, cfg.SMTPPassword, cfg.SMTPHost)
+	}
+	from, _ := mail.ParseAddress(cfg.From)
+	addr := net.JoinHostPort(cfg.SMTPHost, cfg.SMTPPort)
+	if err := smtp.SendMail(addr, auth, from.Address, to, data); err != nil {
+		return fmt.Errorf("error sending email: %v", err)
+	}
+	return nil
+}
@@ -0,0 +1,46 @@
+package notify
+
+import "testing"
+
+func TestCheckRecipients(t *testing.T) {
+	n := New(Config{
+		Email: &EmailConfig{From: "reports@service.test", SMTPHost: "localhost", SMTPPort: "25"},
+		EmailDomains: func(tenant string) []string {
+			if tenant != "team-a" {
+				return nil
+			}
+			return []string{"example.com", " Team-A.example.org"}
+		},
+	})
+
+	tests := []struct {
+		tenant  string
+		to      []string
+		allowed bool
+	}{
+		{"team-a", []string{"ops@example.com"}, true},
+		{"team-a", []string{"Ops <ops@EXAMPLE.com>", "dev@team-a.example.org"}, true},
+		{"team-a", []string{"ops@example.com", "attacker@evil.test"}, false},
+		{"team-a", []string{"ops@mail.example.com"}, false},
+		{"team-a", []string{"ops@example.com.evil.test"}, false},
+		{"team-a", []string{`"x@example.com"@evil.test`}, false},
+		{"team-a", []string{"not an address"}, false},
+		{"team-b", []string{"ops@example.com"}, false},
+	}
+	for _, tt := range tests {
+		err := n.CheckRecipients(tt.tenant, tt.to)
+		if (err == nil) != tt.allowed {
+			t.Errorf("CheckRecipients(%q, %q) = %v, want allowed %v", tt.tenant, tt.to, err, tt.allowed)
+		}
+	}
+
+	if err := n.Check(Channel{Type: ChannelWebhook, URL: "https://hooks.example.test"}, "team-b"); err != nil {
+		t.Errorf("webhook channel: Check = %v, want nil", err)
+	}
+	if err := n.Check(Channel{Type: ChannelEmail, To: []string{"ops@example.com"}}, "team-b"); err == nil {
+		t.Errorf("email channel of tenant without domains: Check = nil, want error")
+	}
+	if err := New(Config{}).Check(Channel{Type: ChannelEmail, To: []string{"ops@example.com"}}, "team-a"); err == nil {
+		t.Errorf("email channel without email configured: Check = nil, want error")
+	}
+}
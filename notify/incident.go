@@ -0,0 +1,286 @@
+package notify
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+const (
+	pagerDutyEventsURL = "https://events.pagerduty.com/v2/enqueue"
+	defaultOpsgenieURL = "https://api.opsgenie.com"
+
+	// incidentDedupWindow is how long an opened incident is remembered.
+	// PagerDuty and Opsgenie also deduplicate open incidents by key.
+	incidentDedupWindow = 24 * time.Hour
+
+	maxPagerDutySummary    = 1024
+	maxOpsgenieMessage     = 130
+	maxOpsgenieDescription = 15000
+)
+
+// IncidentConfig configures the services incidents are opened in.
+type IncidentConfig struct {
+	PagerDutyRoutingKey string
+	OpsgenieAPIKey      string
+	OpsgenieURL         string
+
+	// StateDir, if set, holds a marker file per opened incident, so that
+	// restarts and other instances mounting the same directory don't open
+	// it again. Without it each instance only remembers its own incidents.
+	StateDir string
+}
+
+// IncidentConfigFromEnv reads the incident services from
+// PAGERDUTY_ROUTING_KEY and OPSGENIE_API_KEY, with OPSGENIE_API_URL
+// selecting the Opsgenie region and INCIDENTS_DIR keeping the opened
+// incidents. It returns nil if neither service is set.
+func IncidentConfigFromEnv() *IncidentConfig {
+	cfg := IncidentConfig{
+		PagerDutyRoutingKey: os.Getenv("PAGERDUTY_ROUTING_KEY"),
+		OpsgenieAPIKey:      os.Getenv("OPSGENIE_API_KEY"),
+		OpsgenieURL:         strings.TrimRight(os.Getenv("OPSGENIE_API_URL"), "/"),
+		StateDir:            os.Getenv("INCIDENTS_DIR"),
+	}
+	if cfg.PagerDutyRoutingKey == "" && cfg.OpsgenieAPIKey == "" {
+		return nil
+	}
+	if cfg.OpsgenieURL == "" {
+		cfg.OpsgenieURL = defaultOpsgenieURL
+	}
+	return &cfg
+}
+
+// IncidentsEnabled reports whether an incident service is configured.
+func (n *Notifier) IncidentsEnabled() bool {
+	return n.cfg.Incidents != nil
+}
+
+// Incident is a critical finding to page someone about.
+type Incident struct {
+	DedupKey   string
+	Summary    string
+	Category   string // "availability" or "security"
+	Tenant     string
+	AnalysisID string
+	Link       string
+	Details    interface{} // attached as custom details
+}
+
+// claimIncident reports whether key hasn't been opened within the dedup
+// window and records it as opened.
+func (n *Notifier) claimIncident(key string) (bool, error) {
+	if dir := n.cfg.Incidents.StateDir; dir != "" {
+		return claimMarker(dir, key, time.Now())
+	}
+	n.openedMu.Lock()
+	defer n.openedMu.Unlock()
+	now := time.Now()
+	for k, t := range n.opened {
+		if now.Sub(t) > incidentDedupWindow {
+			delete(n.opened, k)
+		}
+	}
+	if _, ok := n.opened[key]; ok {
+		return false, nil
+	}
+	n.opened[key] = now
+	return true, nil
+}
+
+func (n *Notifier) releaseIncident(key string) {
+	if dir := n.cfg.Incidents.StateDir; dir != "" {
+		os.Remove(markerPath(dir, key))
+		return
+	}
+	n.openedMu.Lock()
+	defer n.openedMu.Unlock()
+	delete(n.opened, key)
+}
+
+// markerPath is the marker file of key in dir. Keys contain the tenant and
+// category, so they are hashed rather than used as file names.
+func markerPath(dir, key string) string {
+	sum := sha256.Sum256([]byte(key))
+	return filepath.Join(dir, hex.EncodeToString(sum[:])+".incident")
+}
+
+// claimMarker creates the marker file of key in dir, replacing one older
+// than the dedup window, and removes other expired markers. The exclusive
+// create makes only one of several instances claim a key.
+func claimMarker(dir, key string, now time.Time) (bool, error) {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return false, err
+	}
+	sweepMarkers(dir, now)
+	path := markerPath(dir, key)
+	for attempt := 0; attempt < 2; attempt++ {
+		f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0o644)
+		if err == nil {
+			_, err = f.WriteString(key + "\n")
+			if cerr := f.Close(); err == nil {
+				err = cerr
+			}
+			if err != nil {
+				os.Remove(path)
+				return false, err
+			}
+			return true, nil
+		}
+		if !errors.Is(err, fs.ErrExist) {
+			return false, err
+		}
+		info, err := os.Stat(path)
+		if errors.Is(err, fs.ErrNotExist) {
+			continue
+		}
+		if err != nil {
+			return false, err
+		}
+		if now.Sub(info.ModTime()) <= incidentDedupWindow {
+			return false, nil
+		}
+		if err := os.Remove(path); err != nil && !errors.Is(err, fs.ErrNotExist) {
+			return false, err
+		}
+	}
+	return false, nil
+}
+
+// sweepMarkers removes the markers in dir older than the dedup window.
+// Failures only leave files behind, so they are ignored.
+func sweepMarkers(dir string, now time.Time) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return
+	}
+	for _, e := range entries {
+		if e.IsDir() || filepath.Ext(e.Name()) != ".incident" {
+			continue
+		}
+		if info, err := e.Info(); err == nil && now.Sub(info.ModTime()) > incidentDedupWindow {
+			os.Remove(filepath.Join(dir, e.Name()))
+		}
+	}
+}
+
+// OpenIncident opens inc in every configured service. It reports false
+// without sending anything if an incident with the same key was already
+// opened recently.
+func (n *Notifier) OpenIncident(ctx context.Context, inc Incident) (bool, error) {
+	cfg := n.cfg.Incidents
+	if cfg == nil {
+		return false, fmt.Errorf("incident alerting is not configured")
+	}
+	claimed, err := n.claimIncident(inc.DedupKey)
+	if err != nil {
+		return false, fmt.Errorf("recording incident: %v", err)
+	}
+	if !claimed {
+		return false, nil
+	}
+
+	var errs []error
+	if cfg.PagerDutyRoutingKey != "" {
+		if err := n.openPagerDuty(ctx, inc); err != nil {
+			errs = append(errs, fmt.Errorf("pagerduty: %v", err))
+		}
+	}
+	if cfg.OpsgenieAPIKey != "" {
+		if err := n.openOpsgenie(ctx, inc); err != nil {
+			errs = append(errs, fmt.Errorf("opsgenie: %v", err))
+		}
+	}
+	if len(errs) > 0 {
+		// Let the next analysis of the window retry.
+		n.releaseIncident(inc.DedupKey)
+		return false, errors.Join(errs...)
+	}
+	return true, nil
+}
+
+func (n *Notifier) openPagerDuty(ctx context.Context, inc Incident) error {
+	type link struct {
+		Href string `json:"href"`
+		Text string `json:"text"`
+	}
+	event := struct {
+		RoutingKey  string `json:"routing_key"`
+		EventAction string `json:"event_action"`
+		DedupKey    string `json:"dedup_key"`
+		Payload     struct {
+			Summary       string      `json:"summary"`
+			Source        string      `json:"source"`
+			Severity      string      `json:"severity"`
+			Group         string      `json:"group,omitempty"`
+			Class         string      `json:"class"`
+			CustomDetails interface{} `json:"custom_details,omitempty"`
+		} `json:"payload"`
+		Links []link `json:"links,omitempty"`
+	}{
+		RoutingKey:  n.cfg.Incidents.PagerDutyRoutingKey,
+		EventAction: "trigger",
+		DedupKey:    inc.DedupKey,
+	}
+	event.Payload.Summary = inc.Summary
+	if len(event.Payload.Summary) > maxPagerDutySummary {
+		event.Payload.Summary = event.Payload.Summary[:maxPagerDutySummary-3] + "..."
+	}
+	event.Payload.Source = "ai-service/" + inc.Tenant
+	event.Payload.Severity = "critical"
+	event.Payload.Group = inc.Tenant
+	event.Payload.Class = inc.Category
+	event.Payload.CustomDetails = inc.Details
+	if inc.Link != "" {
+		event.Links = []link{{Href: inc.Link, Text: "Full analysis"}}
+	}
+	return n.postJSON(ctx, pagerDutyEventsURL, event, nil)
+}
+
+func (n *Notifier) openOpsgenie(ctx context.Context, inc Incident) error {
+	message := inc.Summary
+	if len(message) > maxOpsgenieMessage {
+		message = message[:maxOpsgenieMessage-3] + "..."
+	}
+	details := map[string]string{"tenant": inc.Tenant}
+	if inc.AnalysisID != "" {
+		details["analysis_id"] = inc.AnalysisID
+	}
+	if inc.Link != "" {
+		details["link"] = inc.Link
+	}
+	var description string
+	if data, err := json.MarshalIndent(inc.Details, "", "  "); err == nil {
+		description = string(data)
+		if len(description) > maxOpsgenieDescription {
+			description = description[:maxOpsgenieDescription]
+		}
+	}
+	alert := struct {
+		Message     string            `json:"message"`
+		Alias       string            `json:"alias"`
+		Description string            `json:"description,omitempty"`
+		Source      string            `json:"source"`
+		Tags        []string          `json:"tags"`
+		Details     map[string]string `json:"details"`
+		Priority    string            `json:"priority"`
+	}{
+		Message:     message,
+		Alias:       inc.DedupKey,
+		Description: description,
+		Source:      "ai-service",
+		Tags:        []string{inc.Category, "tenant:" + inc.Tenant},
+		Details:     details,
+		Priority:    "P1",
+	}
+	return n.postJSON(ctx, n.cfg.Incidents.OpsgenieURL+"/v2/alerts", alert,
+		map[string]string{"Authorization": "GenieKey " + n.cfg.Incidents.OpsgenieAPIKey})
+}
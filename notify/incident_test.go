@@ -0,0 +1,33 @@
+package notify
+
+import (
+	"os"
+	"testing"
+	"time"
+)
+
+func TestClaimIncidentSharedStateDir(t *testing.T) {
+	dir := t.TempDir()
+	a := New(Config{Incidents: &IncidentConfig{PagerDutyRoutingKey: "key", StateDir: dir}})
+	b := New(Config{Incidents: &IncidentConfig{PagerDutyRoutingKey: "key", StateDir: dir}})
+
+	if ok, err := a.claimIncident("team-a/availability/1"); !ok || err != nil {
+		t.Fatalf("first claim = %v, %v, want true", ok, err)
+	}
+	if ok, err := b.claimIncident("team-a/availability/1"); ok || err != nil {
+		t.Fatalf("claim by another instance = %v, %v, want false", ok, err)
+	}
+
+	old := time.Now().Add(-incidentDedupWindow - time.Minute)
+	if err := os.Chtimes(markerPath(dir, "team-a/availability/1"), old, old); err != nil {
+		t.Fatal(err)
+	}
+	if ok, err := b.claimIncident("team-a/availability/1"); !ok || err != nil {
+		t.Fatalf("claim after the dedup window = %v, %v, want true", ok, err)
+	}
+
+	b.releaseIncident("team-a/availability/1")
+	if ok, err := a.claimIncident("team-a/availability/1"); !ok || err != nil {
+		t.Fatalf("claim after release = %v, %v, want true", ok, err)
+	}
+}
@@ -0,0 +1,135 @@
+package notify
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// EventIssuesDetected is the event of an IssueAlert.
+const EventIssuesDetected = "issues.detected"
+
+// Slack messages list at most maxAlertIssues issues and maxAlertPaths
+// affected paths per issue, staying well under Slack's block limits.
+const (
+	maxAlertIssues = 20
+	maxAlertPaths  = 10
+)
+
+// AlertIssue is one issue reported by an analysis.
+type AlertIssue struct {
+	Type        string   `json:"type"`
+	Description string   `json:"description"`
+	Severity    string   `json:"severity"`
+	Category    string   `json:"category,omitempty"`
+	Paths       []string `json:"paths,omitempty"`
+}
+
+// IssueAlert reports the high-severity issues of an analysis.
+type IssueAlert struct {
+	Event      string       `json:"event"`
+	Tenant     string       `json:"tenant"`
+	Kind       string       `json:"kind"` // "logs" or "performance"
+	AnalysisID string       `json:"analysis_id,omitempty"`
+	Link       string       `json:"link,omitempty"` // where the full result can be fetched
+	Time       time.Time    `json:"time"`
+	Issues     []AlertIssue `json:"issues"`
+}
+
+// SendIssueAlert delivers alert to a webhook or Slack channel.
+func (n *Notifier) SendIssueAlert(ctx context.Context, ch Channel, alert IssueAlert) error {
+	alert.Event = EventIssuesDetected
+	switch ch.Type {
+	case ChannelWebhook:
+		return n.postJSON(ctx, ch.URL, alert, nil)
+	case ChannelSlack:
+		return n.postJSON(ctx, ch.URL, slackIssueAlert(alert), nil)
+	}
+	return fmt.Errorf("issue alerts can't be sent to %q channels", ch.Type)
+}
+
+type slackText struct {
+	Type string `json:"type"`
+	Text string `json:"text"`
+}
+
+type slackBlock struct {
+	Type string     `json:"type"`
+	Text *slackText `json:"text,omitempty"`
+}
+
+type slackPayload struct {
+	Text   string       `json:"text"` // shown in notifications and clients without blocks
+	Blocks []slackBlock `json:"blocks,omitempty"`
+}
+
+// slackEscape escapes the characters Slack treats as markup.
+var slackEscape = strings.NewReplacer("&", "&amp;", "<", "&lt;", ">", "&gt;")
+
+func slackSection(text string) slackBlock {
+	return slackBlock{Type: "section", Text: &slackText{Type: "mrkdwn", Text: text}}
+}
+
+func slackIssueAlert(alert IssueAlert) slackPayload {
+	title := fmt.Sprintf("%d high-severity issue(s) in %s analysis for tenant %s",
+		len(alert.Issues), alert.Kind, alert.Tenant)
+	payload := slackPayload{
+		Text:   title,
+		Blocks: []slackBlock{slackSection(":rotating_light: *" + slackEscape.Replace(title) + "*")},
+	}
+	for i, issue := range alert.Issues {
+		if i == maxAlertIssues {
+			payload.Blocks = append(payload.Blocks, slackSection(fmt.Sprintf("…and %d more", len(alert.Issues)-i)))
+			break
+		}
+		var b strings.Builder
+		fmt.Fprintf(&b, "*[%s] %s*", slackEscape.Replace(strings.ToUpper(issue.Severity)), slackEscape.Replace(issue.Type))
+		if issue.Category != "" {
+			fmt.Fprintf(&b, " (%s)", slackEscape.Replace(issue.Category))
+		}
+		b.WriteString("\n" + slackEscape.Replace(issue.Description))
+		if len(issue.Paths) > 0 {
+			paths := issue.Paths
+			if len(paths) > maxAlertPaths {
+				paths = paths[:maxAlertPaths]
+			}
+			b.WriteString("\nAffected paths: ")
+			for i, p := range paths {
+				if i > 0 {
+					b.WriteString(", ")
+				}
+				b.WriteString("`" + slackEscape.Replace(strings.ReplaceAll(p, "`", "'")) + "`")
+			}
+			if len(issue.Paths) > len(paths) {
+				fmt.Fprintf(&b, " and %d more", len(issue.Paths)-len(paths))
+			}
+		}
+		payload.Blocks = append(payload.Blocks, slackSection(b.String()))
+	}
+	switch {
+	case alert.Link != "":
+		payload.Blocks = append(payload.Blocks, slackSection(fmt.Sprintf("<%s|View the full analysis>", alert.Link)))
+	case alert.AnalysisID != "":
+		payload.Blocks = append(payload.Blocks, slackSection("Analysis "+slackEscape.Replace(alert.AnalysisID)))
+	}
+	return payload
+}
+
+// slackMessageText summarizes a scheduled analysis message for Slack.
+func slackMessageText(msg Message) string {
+	name := msg.Schedule
+	if name == "" {
+		name = "Log analysis"
+	}
+	text := fmt.Sprintf("*%s* completed", slackEscape.Replace(name))
+	if msg.Event == EventAnalysisFailed {
+		text = fmt.Sprintf("*%s* failed: %s", slackEscape.Replace(name), slackEscape.Replace(msg.Error))
+	} else if msg.Regressed {
+		text += " and regressed against its baseline"
+	}
+	if msg.AnalysisID != "" {
+		text += " (analysis " + msg.AnalysisID + ")"
+	}
+	return text
+}
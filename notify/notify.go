@@ -0,0 +1,160 @@
+// Package notify delivers messages about finished analyses to external
+// channels.
+package notify
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"sync"
+	"time"
+
+	"analyticsai/ai-service/netguard"
+)
+
+// Events a Message can report.
+const (
+	EventAnalysisCompleted = "analysis.completed"
+	EventAnalysisFailed    = "analysis.failed"
+)
+
+// Message describes a finished analysis.
+type Message struct {
+	Event      string          `json:"event"`
+	Tenant     string          `json:"tenant"`
+	ScheduleID string          `json:"schedule_id,omitempty"`
+	Schedule   string          `json:"schedule,omitempty"` // schedule name
+	AnalysisID string          `json:"analysis_id,omitempty"`
+	Regressed  bool            `json:"regressed,omitempty"` // the analysis regressed against its baseline
+	Error      string          `json:"error,omitempty"`
+	Time       time.Time       `json:"time"`
+	Result     json.RawMessage `json:"result,omitempty"` // the analysis endpoint's response
+}
+
+// Channel types.
+const (
+	ChannelWebhook = "webhook"
+	ChannelSlack   = "slack" // Slack incoming webhook
+	ChannelEmail   = "email"
+)
+
+// Channel configures where messages are sent.
+type Channel struct {
+	Type string   `json:"type"`
+	URL  string   `json:"url,omitempty"` // webhook or Slack webhook target
+	To   []string `json:"to,omitempty"`  // email recipients
+}
+
+// Config configures a Notifier.
+type Config struct {
+	// Email enables email channels; without it they are rejected.
+	Email *EmailConfig
+	// Incidents enables OpenIncident; without it no incidents are opened.
+	Incidents *IncidentConfig
+	// AllowPrivateURLs lets webhook and Slack channels point at loopback,
+	// private and link-local addresses. It is off by default so that
+	// tenants can't use notifications to reach internal services such as
+	// the metadata server.
+	AllowPrivateURLs bool
+	// EmailDomains returns the domains a tenant may email, e.g.
+	// "example.com". Recipients come from tenants' requests and schedules,
+	// so without allowed domains a tenant can't send email at all, and one
+	// can't use the service's sender to mail arbitrary addresses.
+	EmailDomains func(tenant string) []string
+}
+
+// Notifier delivers messages, alerts and incidents as configured.
+type Notifier struct {
+	cfg Config
+	// client refuses connections to private addresses, unless
+	// AllowPrivateURLs is set. Every notification target goes through it.
+	client *http.Client
+
+	openedMu sync.Mutex
+	opened   map[string]time.Time // incident dedup key → when it was opened
+}
+
+// New returns a Notifier configured by cfg.
+func New(cfg Config) *Notifier {
+	n := &Notifier{cfg: cfg, opened: make(map[string]time.Time)}
+	n.client = netguard.NewClient(30*time.Second, &n.cfg.AllowPrivateURLs)
+	return n
+}
+
+// EmailEnabled reports whether email channels can be delivered to.
+func (n *Notifier) EmailEnabled() bool {
+	return n.cfg.Email != nil
+}
+
+// Validate checks that the channel is well formed.
+func (ch Channel) Validate() error {
+	switch ch.Type {
+	case ChannelWebhook, ChannelSlack:
+		u, err := url.Parse(ch.URL)
+		if err != nil || (u.Scheme != "https" && u.Scheme != "http") || u.Host == "" {
+			return fmt.Errorf("%s url must be an http or https URL", ch.Type)
+		}
+		return nil
+	case ChannelEmail:
+		return validateEmail(ch.To)
+	}
+	return fmt.Errorf("unknown notification type %q", ch.Type)
+}
+
+// Check returns an error unless tenant may deliver to ch: the channel must
+// be valid, and for email channels email must be configured and every
+// recipient must be in one of the tenant's allowed domains.
+func (n *Notifier) Check(ch Channel, tenant string) error {
+	if err := ch.Validate(); err != nil {
+		return err
+	}
+	if ch.Type != ChannelEmail {
+		return nil
+	}
+	return n.checkEmail(tenant, ch.To)
+}
+
+// Send delivers msg to ch.
+func (n *Notifier) Send(ctx context.Context, ch Channel, msg Message) error {
+	switch ch.Type {
+	case ChannelWebhook:
+		return n.postJSON(ctx, ch.URL, msg, nil)
+	case ChannelSlack:
+		return n.postJSON(ctx, ch.URL, slackPayload{Text: slackMessageText(msg)}, nil)
+	case ChannelEmail:
+		return n.sendEmail(ctx, ch.To, msg)
+	}
+	return fmt.Errorf("unknown notification type %q", ch.Type)
+}
+
+// postJSON posts body as JSON to target with the extra headers and treats
+// non-2xx responses as errors.
+func (n *Notifier) postJSON(ctx context.Context, target string, body interface{}, headers map[string]string) error {
+	data, err := json.Marshal(body)
+	if err != nil {
+		return fmt.Errorf("error encoding notification: %v", err)
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, target, bytes.NewReader(data))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	for k, v := range headers {
+		req.Header.Set(k, v)
+	}
+
+	resp, err := n.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("error sending notification: %v", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode/100 != 2 {
+		respBody, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return fmt.Errorf("notification endpoint returned status %d: %s", resp.StatusCode, respBody)
+	}
+	return nil
+}
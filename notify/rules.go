@@ -0,0 +1,69 @@
+package notify
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"html/template"
+	"time"
+)
+
+// EventAlertTriggered is the event of a RuleAlert.
+const EventAlertTriggered = "alert.triggered"
+
+// RuleAlert reports that an analysis breached an alert rule.
+type RuleAlert struct {
+	Event      string    `json:"event"`
+	Tenant     string    `json:"tenant"`
+	RuleID     string    `json:"rule_id"`
+	Rule       string    `json:"rule"` // rule name
+	Kind       string    `json:"kind"`
+	Metric     string    `json:"metric"`
+	Operator   string    `json:"operator"`
+	Threshold  float64   `json:"threshold"`
+	Value      float64   `json:"value"`
+	Severity   string    `json:"severity"`
+	AnalysisID string    `json:"analysis_id,omitempty"`
+	Link       string    `json:"link,omitempty"`
+	Time       time.Time `json:"time"`
+}
+
+func (a RuleAlert) summary() string {
+	return fmt.Sprintf("%s: %s is %g (%s %g) in %s analysis for tenant %s",
+		a.Rule, a.Metric, a.Value, a.Operator, a.Threshold, a.Kind, a.Tenant)
+}
+
+var ruleAlertTemplate = template.Must(template.New("alert").Parse(`<!DOCTYPE html>
+<html><body style="font-family: sans-serif; color: #222;">
+<h2>[{{.Severity}}] {{.Rule}}</h2>
+<p><strong>{{.Metric}}</strong> is {{.Value}}, which is {{.Operator}} the threshold of {{.Threshold}}.</p>
+<p>{{.Kind}} analysis for tenant {{.Tenant}} &middot; {{.Time.Format "2006-01-02 15:04 MST"}}{{if .AnalysisID}} &middot; analysis {{.AnalysisID}}{{end}}</p>
+{{if .Link}}<p><a href="{{.Link}}">View the full analysis</a></p>{{end}}
+</body></html>
+`))
+
+// SendRuleAlert delivers alert to ch.
+func (n *Notifier) SendRuleAlert(ctx context.Context, ch Channel, alert RuleAlert) error {
+	alert.Event = EventAlertTriggered
+	switch ch.Type {
+	case ChannelWebhook:
+		return n.postJSON(ctx, ch.URL, alert, nil)
+	case ChannelSlack:
+		text := fmt.Sprintf(":warning: *[%s] %s*", slackEscape.Replace(alert.Severity), slackEscape.Replace(alert.summary()))
+		if alert.Link != "" {
+			text += fmt.Sprintf("\n<%s|View the full analysis>", alert.Link)
+		}
+		return n.postJSON(ctx, ch.URL, slackPayload{Text: text}, nil)
+	case ChannelEmail:
+		if err := n.checkEmail(alert.Tenant, ch.To); err != nil {
+			return err
+		}
+		var body bytes.Buffer
+		if err := ruleAlertTemplate.Execute(&body, alert); err != nil {
+			return fmt.Errorf("error rendering email: %v", err)
+		}
+		subject := fmt.Sprintf("[Analytics] %s alert: %s", alert.Severity, alert.Rule)
+		return n.deliverEmail(ctx, ch.To, subject, body.String(), nil)
+	}
+	return fmt.Errorf("unknown notification type %q", ch.Type)
+}
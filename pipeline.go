@@ -0,0 +1,854 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"analyticsai/ai-service/alerts"
+	"analyticsai/ai-service/analytics"
+	"analyticsai/ai-service/analytics/aggregator"
+	"analyticsai/ai-service/bigquery"
+	"analyticsai/ai-service/grafana"
+	"analyticsai/ai-service/notify"
+	"analyticsai/ai-service/scheduler"
+	"analyticsai/ai-service/storage"
+
+	"github.com/gin-gonic/gin"
+)
+
+// analysisRun is one analysis of a tenant's logs, whether for an
+// /analyze/<kind> request or run by the service on the tenant's behalf.
+type analysisRun struct {
+	Tenant  string
+	Kind    string
+	Logs    []analytics.LogEntry // preprocessed according to Options
+	Options analytics.AnalysisOptions
+	Query   url.Values // the /analyze/<kind> query parameters
+	Source  storage.AnalysisSource
+}
+
+// newAnalysisRun returns the run of kind on logs for request c.
+func newAnalysisRun(c *gin.Context, kind string, logs []analytics.LogEntry, opts analytics.AnalysisOptions) *analysisRun {
+	return &analysisRun{
+		Tenant:  tenantID(c),
+		Kind:    kind,
+		Logs:    logs,
+		Options: opts,
+		Query:   c.Request.URL.Query(),
+		Source:  storage.AnalysisSource{Type: "request"},
+	}
+}
+
+// analysisKinds are the analyses of the /analyze/<kind> endpoints that take
+// a list of log entries and read all their options from the query string,
+// so that runAnalysis can run them for /analyze/batch, /analyze/buffer,
+// /ws/analyze and schedules. Each returns the body of its endpoint's
+// response.
+var analysisKinds = map[string]func(ctx context.Context, run *analysisRun) (gin.H, error){
+	"logs":         runLogsAnalysis,
+	"performance":  runPerformanceAnalysis,
+	"errors":       runErrorsAnalysis,
+	"root-cause":   runRootCauseAnalysis,
+	"dependencies": runDependenciesAnalysis,
+	"security":     runSecurityAnalysis,
+	"seo":          runSEOAnalysis,
+	"clients":      runClientsAnalysis,
+	"journeys":     runJourneysAnalysis,
+	"capacity":     runCapacityAnalysis,
+}
+
+// isAnalysisKind reports whether runAnalysis can run kind.
+func isAnalysisKind(kind string) bool {
+	_, ok := analysisKinds[kind]
+	return ok
+}
+
+// optionError is an invalid analysis option, answered with 400.
+type optionError struct {
+	msg string
+}
+
+func (e *optionError) Error() string {
+	return e.msg
+}
+
+func optionErrorf(format string, args ...interface{}) error {
+	return &optionError{msg: fmt.Sprintf(format, args...)}
+}
+
+// kindOptions reads the analysis options of kind from query. The SEO
+// analysis clusters 404s by the URLs as logged, so it only normalizes paths
+// when asked to.
+func kindOptions(tenant, kind string, query url.Values) (analytics.AnalysisOptions, error) {
+	opts, err := parseAnalysisOptions(tenant, query)
+	if err == nil && kind == "seo" {
+		opts.NormalizePaths = query.Get("normalize_paths") == "true"
+	}
+	return opts, err
+}
+
+// serveAnalysis answers an /analyze/<kind> request with the analysis of
+// logs, preprocessed according to opts.
+func serveAnalysis(c *gin.Context, kind string, logs []analytics.LogEntry, opts analytics.AnalysisOptions) {
+	resp, err := analysisKinds[kind](c.Request.Context(), newAnalysisRun(c, kind, logs, opts))
+	if err != nil {
+		respondAnalysisError(c, "error generating analysis", err)
+		return
+	}
+	addWarnings(c.Request.Context(), resp)
+	c.JSON(http.StatusOK, resp)
+}
+
+// addWarnings lists the repairs made to the model output of the request
+// carrying ctx in resp, if there were any.
+func addWarnings(ctx context.Context, resp gin.H) {
+	if warnings := analytics.WarningsFromContext(ctx); len(warnings) > 0 {
+		resp["warnings"] = warnings
+	}
+}
+
+// limitHitKey is the gin context key of the tenant limit that rejected a
+// request, for the audit log.
+const limitHitKey = "limit_hit"
+
+// respondAnalysisError maps analysis failures to a status code, giving
+// limit violations their own status and a machine-readable body.
+func respondAnalysisError(c *gin.Context, prefix string, err error) {
+	status, body, limit := analysisErrorResponse(c.Request.Context(), prefix, err)
+	if limit != "" {
+		c.Set(limitHitKey, limit)
+	}
+	c.JSON(status, body)
+}
+
+// analysisErrorResponse returns the status and body respondAnalysisError
+// answers an analysis failure with, and the tenant limit it hit, if any.
+func analysisErrorResponse(ctx context.Context, prefix string, err error) (int, gin.H, string) {
+	var limitErr *analytics.LimitError
+	var optErr *optionError
+	switch {
+	case errors.As(err, &limitErr):
+		status := http.StatusTooManyRequests
+		if limitErr.Limit == "max_entries" {
+			status = http.StatusRequestEntityTooLarge
+		}
+		return status, gin.H{"error": limitErr.Error(), "limit": limitErr}, limitErr.Limit
+	case errors.As(err, &optErr), errors.Is(err, analytics.ErrInvalidInput):
+		return http.StatusBadRequest, gin.H{"error": err.Error()}, ""
+	case errors.Is(err, analytics.ErrInvalidModelOutput):
+		return http.StatusBadGateway, gin.H{"error": fmt.Sprintf("%s: %v", prefix, err)}, ""
+	case errors.Is(ctx.Err(), context.DeadlineExceeded):
+		limits := analytics.LimitsFromContext(ctx)
+		return http.StatusGatewayTimeout, gin.H{
+			"error": fmt.Sprintf("analysis exceeded the maximum duration of %ds", limits.MaxDurationSec),
+			"limit": analytics.LimitError{Limit: "max_duration_seconds", Max: limits.MaxDurationSec},
+		}, "max_duration_seconds"
+	default:
+		return http.StatusInternalServerError, gin.H{"error": fmt.Sprintf("%s: %v", prefix, err)}, ""
+	}
+}
+
+// pipelineOptions are the options of an analysis run by runAnalysis.
+type pipelineOptions struct {
+	Kind   string
+	Query  url.Values // as for /analyze/<kind>
+	Source storage.AnalysisSource
+}
+
+// runAnalysis analyzes the tenant's logs as /analyze/<opts.Kind> would,
+// without going through the router: under the tenant's limits and quota,
+// preprocessed and stored according to opts.Query. It returns the status
+// and body the endpoint would have responded with. Each run is audited as
+// an internal request of the tenant.
+func runAnalysis(ctx context.Context, tenant string, logs []analytics.LogEntry, opts pipelineOptions) (int, gin.H) {
+	analyze, ok := analysisKinds[opts.Kind]
+	if !ok {
+		return http.StatusBadRequest, gin.H{"error": fmt.Sprintf("invalid kind %q", opts.Kind)}
+	}
+	start := time.Now()
+	ctx, cancel, err := withTenantLimits(ctx, tenant, opts.Query.Get("lang"))
+	if err != nil {
+		return http.StatusBadRequest, gin.H{"error": err.Error()}
+	}
+	defer cancel()
+
+	status, resp := http.StatusOK, gin.H(nil)
+	limit := ""
+	analysisOpts, err := kindOptions(tenant, opts.Kind, opts.Query)
+	if err != nil {
+		status, resp = http.StatusBadRequest, gin.H{"error": err.Error()}
+	} else if logs, _, err = analytics.Preprocess(logs, analysisOpts.PreprocessOptions); err != nil {
+		status, resp, limit = analysisErrorResponse(ctx, "error preprocessing logs", err)
+	} else if resp, err = analyze(ctx, &analysisRun{
+		Tenant:  tenant,
+		Kind:    opts.Kind,
+		Logs:    logs,
+		Options: analysisOpts,
+		Query:   opts.Query,
+		Source:  opts.Source,
+	}); err != nil {
+		status, resp, limit = analysisErrorResponse(ctx, "error generating analysis", err)
+	} else {
+		addWarnings(ctx, resp)
+	}
+
+	writeAuditRecord(storage.AuditRecord{
+		Time:       start.UTC(),
+		Tenant:     tenant,
+		Method:     http.MethodPost,
+		Path:       "/analyze/" + opts.Kind,
+		Query:      opts.Query.Encode(),
+		Status:     status,
+		DurationMS: time.Since(start).Milliseconds(),
+		Models:     analytics.ModelUsageFromContext(ctx),
+		Limit:      limit,
+		Internal:   true,
+	})
+	return status, resp
+}
+
+func runLogsAnalysis(ctx context.Context, run *analysisRun) (gin.H, error) {
+	analysis, err := analyticsService.AnalyzeLogs(ctx, run.Logs, run.Options)
+	if err != nil {
+		return nil, err
+	}
+	resp := gin.H{"analysis": analysis}
+	recordAnalysis(ctx, run, resp, len(analysis.PotentialIssues), analysis)
+	alertOnIssues(ctx, run, resp, analysis.PotentialIssues)
+	openIncidents(ctx, run, resp, analysis.PotentialIssues, analysis.Anomalies)
+	evaluateAlertRules(ctx, run, resp, analysis.PotentialIssues, analysis.Anomalies)
+	emailReport(ctx, run, resp)
+	return resp, nil
+}
+
+func runPerformanceAnalysis(ctx context.Context, run *analysisRun) (gin.H, error) {
+	buckets, err := parseBuckets(run.Query.Get("buckets"))
+	if err != nil {
+		return nil, optionErrorf("invalid buckets: %v", err)
+	}
+	apdexT, err := parseOptionalInt(run.Query.Get("apdex_t"))
+	if err != nil {
+		return nil, optionErrorf("invalid apdex_t: %v", err)
+	}
+	apdexTolerating, err := parseOptionalInt(run.Query.Get("apdex_tolerating"))
+	if err != nil {
+		return nil, optionErrorf("invalid apdex_tolerating: %v", err)
+	}
+	if _, _, err := aggregator.ApdexThresholds(apdexT, apdexTolerating); err != nil {
+		return nil, optionErrorf("invalid apdex thresholds: %v", err)
+	}
+
+	opts := analytics.PerformanceOptions{
+		AnalysisOptions: run.Options,
+		LatencyBuckets:  buckets,
+		ApdexSatisfied:  apdexT,
+		ApdexTolerating: apdexTolerating,
+	}
+	analysis, err := analyticsService.AnalyzePerformance(ctx, run.Logs, opts)
+	if err != nil {
+		return nil, err
+	}
+	resp := gin.H{"analysis": analysis}
+	recordAnalysis(ctx, run, resp, len(analysis.ResourceIssues), analysis)
+	alertOnIssues(ctx, run, resp, analysis.ResourceIssues)
+	openIncidents(ctx, run, resp, analysis.ResourceIssues, nil)
+	evaluateAlertRules(ctx, run, resp, analysis.ResourceIssues, nil)
+	emailReport(ctx, run, resp)
+	return resp, nil
+}
+
+func runErrorsAnalysis(ctx context.Context, run *analysisRun) (gin.H, error) {
+	report, err := analyticsService.AnalyzeErrors(ctx, run.Logs)
+	if err != nil {
+		return nil, err
+	}
+	return gin.H{"errors": report}, nil
+}
+
+func runRootCauseAnalysis(ctx context.Context, run *analysisRun) (gin.H, error) {
+	report, err := analyticsService.AnalyzeRootCause(ctx, run.Logs, run.Options.Interval)
+	if err != nil {
+		return nil, err
+	}
+	return gin.H{"root_cause": report}, nil
+}
+
+func runDependenciesAnalysis(ctx context.Context, run *analysisRun) (gin.H, error) {
+	report, err := analyticsService.AnalyzeDependencies(ctx, run.Logs, run.Options.Interval)
+	if err != nil {
+		return nil, err
+	}
+	return gin.H{"dependencies": report}, nil
+}
+
+func runSecurityAnalysis(ctx context.Context, run *analysisRun) (gin.H, error) {
+	threshold, err := parseOptionalInt(run.Query.Get("auth_failures"))
+	if err != nil {
+		return nil, optionErrorf("invalid auth_failures: %v", err)
+	}
+	report, err := analyticsService.AnalyzeSecurity(ctx, run.Logs, int(threshold))
+	if err != nil {
+		return nil, err
+	}
+	return gin.H{"security": report}, nil
+}
+
+func runSEOAnalysis(ctx context.Context, run *analysisRun) (gin.H, error) {
+	report, err := analyticsService.AnalyzeSEO(ctx, run.Logs)
+	if err != nil {
+		return nil, err
+	}
+	return gin.H{"seo": report}, nil
+}
+
+// runClientsAnalysis scores clients without a Gemini call; the deny list
+// formats of /analyze/clients are served by the endpoint itself.
+func runClientsAnalysis(ctx context.Context, run *analysisRun) (gin.H, error) {
+	if err := analytics.CheckEntryLimit(ctx, len(run.Logs)); err != nil {
+		return nil, err
+	}
+	top, err := parseOptionalInt(run.Query.Get("top"))
+	if err != nil {
+		return nil, optionErrorf("invalid top: %v", err)
+	}
+	if top == 0 {
+		top = 20
+	}
+	scores := aggregator.ScoreClients(run.Logs)
+	if int(top) < len(scores) {
+		scores = scores[:top]
+	}
+	return gin.H{"clients": scores}, nil
+}
+
+func runJourneysAnalysis(ctx context.Context, run *analysisRun) (gin.H, error) {
+	var gap time.Duration
+	if raw := run.Query.Get("session_gap"); raw != "" {
+		d, err := time.ParseDuration(raw)
+		if err != nil || d <= 0 {
+			return nil, optionErrorf("invalid session_gap %q", raw)
+		}
+		gap = d
+	}
+	report, err := analyticsService.AnalyzeJourneys(ctx, run.Logs, gap)
+	if err != nil {
+		return nil, err
+	}
+	return gin.H{"journeys": report}, nil
+}
+
+func runCapacityAnalysis(ctx context.Context, run *analysisRun) (gin.H, error) {
+	capacity := aggregator.CapacityOptions{Interval: run.Options.Interval}
+	if run.Query.Get("group_by") != "" {
+		capacity.GroupBy = run.Options.GroupBy
+	}
+	latency, err := parseOptionalInt(run.Query.Get("latency_ms"))
+	if err != nil {
+		return nil, optionErrorf("invalid latency_ms: %v", err)
+	}
+	instances, err := parseOptionalInt(run.Query.Get("instances"))
+	if err != nil {
+		return nil, optionErrorf("invalid instances: %v", err)
+	}
+	capacity.LatencyTargetMs, capacity.Instances = latency, int(instances)
+	if raw := run.Query.Get("target_utilization"); raw != "" {
+		v, err := strconv.ParseFloat(raw, 64)
+		if err != nil || v <= 0 || v > 1 {
+			return nil, optionErrorf("invalid target_utilization %q: must be between 0 and 1", raw)
+		}
+		capacity.TargetUtilization = v
+	}
+
+	report, err := analyticsService.AnalyzeCapacity(ctx, run.Logs, capacity)
+	if err != nil {
+		return nil, err
+	}
+	return gin.H{"capacity": report}, nil
+}
+
+func filterPerformanceInsights(insights []string) []string {
+	var performanceInsights []string
+	for _, insight := range insights {
+		// Simple filtering based on keywords
+		if containsAny(insight, []string{"slow", "performance", "latency", "duration", "response time"}) {
+			performanceInsights = append(performanceInsights, insight)
+		}
+	}
+	return performanceInsights
+}
+
+func containsAny(s string, keywords []string) bool {
+	for _, keyword := range keywords {
+		if strings.Contains(strings.ToLower(s), strings.ToLower(keyword)) {
+			return true
+		}
+	}
+	return false
+}
+
+// recordAnalysis records the run's logs as its tenant's latest window for
+// /metrics/logs, stores result, their analysis, and exports both to
+// BigQuery when configured. With SEMANTIC_AUTO_INDEX=true the issues of logs
+// analyses are linked to similar past issues, and the analyses are added to
+// the semantic index. The source is named by the source query
+// parameter, falling back to the upload's filename. Storage and export
+// failures are logged or reported in resp rather than failing the request,
+// whose result is still returned.
+func recordAnalysis(ctx context.Context, run *analysisRun, resp gin.H, issues int, result interface{}) {
+	source := run.Source
+	if name := run.Query.Get("source"); name != "" {
+		source.Name = name
+	} else if source.Name == "" {
+		source.Name = source.Filename
+	}
+	source.Entries = len(run.Logs)
+	source.Query = run.Query.Encode()
+
+	logWindows.Set(run.Tenant, analytics.NewWindow(run.Logs, run.Kind, source.Name))
+	analysis, isLogs := result.(*analytics.AnalysisResult)
+	if isLogs && semanticAutoIndex {
+		linkSimilarIssues(ctx, resp, run.Tenant, analysis)
+	}
+	metrics := aggregator.Snapshot(run.Logs, issues)
+	analysisID := storeAnalysis(run, resp, source, metrics, result)
+	exportToBigQuery(ctx, resp, bigquery.Batch{
+		Tenant:     run.Tenant,
+		AnalysisID: analysisID,
+		Kind:       run.Kind,
+		Source:     source.Name,
+		Logs:       run.Logs,
+		Metrics:    metrics,
+		Result:     result,
+	})
+	if isLogs && semanticAutoIndex {
+		indexAnalysis(ctx, resp, run.Tenant, analysisID, run.Logs, analysis)
+	}
+}
+
+// linkSimilarIssues references similar issues of the tenant's earlier
+// analyses, and how they were resolved, on the issues of analysis before
+// it is stored. Failures are reported as similar_issues_error in resp.
+func linkSimilarIssues(ctx context.Context, resp gin.H, tenant string, analysis *analytics.AnalysisResult) {
+	if err := analyticsService.FindSimilarIssues(ctx, semanticIndex, tenant, analysis.PotentialIssues); err != nil {
+		log.Printf("Error finding similar issues: %v", err)
+		resp["similar_issues_error"] = err.Error()
+	}
+}
+
+// indexAnalysis adds the logs and findings of a logs analysis to the
+// semantic index, reporting failures as semantic_index_error in resp.
+func indexAnalysis(ctx context.Context, resp gin.H, tenant, analysisID string, logs []analytics.LogEntry, analysis *analytics.AnalysisResult) {
+	if _, err := analyticsService.IndexLogs(ctx, semanticIndex, tenant, logs); err != nil {
+		log.Printf("Error indexing analysed logs: %v", err)
+		resp["semantic_index_error"] = err.Error()
+		return
+	}
+	if _, err := analyticsService.IndexAnalysis(ctx, semanticIndex, tenant, analysisID, analysis); err != nil {
+		log.Printf("Error indexing analysis findings: %v", err)
+		resp["semantic_index_error"] = err.Error()
+	}
+}
+
+// storeAnalysis saves the analysis and adds its analysis_id to resp, along
+// with a baseline_comparison against the baseline named by the baseline
+// query parameter or, without one, the baseline set for the same source and
+// kind. It returns the analysis ID, or "" if it wasn't stored.
+func storeAnalysis(run *analysisRun, resp gin.H, source storage.AnalysisSource, metrics *aggregator.MetricsSnapshot, result interface{}) string {
+	if analysisStore == nil {
+		return ""
+	}
+	analysis, err := analysisStore.Save(run.Tenant, run.Kind, source, metrics, result)
+	if err != nil {
+		log.Printf("Error saving %s analysis: %v", run.Kind, err)
+		return ""
+	}
+	resp["analysis_id"] = analysis.ID
+
+	comparison, err := compareWithBaseline(run.Tenant, run.Query.Get("baseline"), run.Kind, source.Name, metrics)
+	if err != nil {
+		resp["baseline_error"] = err.Error()
+	} else if comparison != nil {
+		resp["baseline_comparison"] = comparison
+	}
+	return analysis.ID
+}
+
+// exportToBigQuery writes the analysed logs and the analysis to the
+// configured BigQuery tables, adding a bigquery summary, or bigquery_error,
+// to resp.
+func exportToBigQuery(ctx context.Context, resp gin.H, batch bigquery.Batch) {
+	if bigQuery == nil {
+		return
+	}
+	ctx, cancel := context.WithTimeout(ctx, bigQueryExportTimeout)
+	defer cancel()
+	summary, err := bigQuery.Export(ctx, batch)
+	if err != nil {
+		log.Printf("Error exporting %s analysis to BigQuery: %v", batch.Kind, err)
+		resp["bigquery_error"] = err.Error()
+		return
+	}
+	resp["bigquery"] = summary
+}
+
+// analysisLink returns the public URL of stored analysis id, or "" without
+// an id or PUBLIC_URL.
+func analysisLink(id string) string {
+	if id == "" || publicURL == "" {
+		return ""
+	}
+	return publicURL + "/analyses/" + url.PathEscape(id)
+}
+
+// alertOnIssues sends the high and critical issues of an analysis to the
+// issue alert channels. Delivery failures are only logged: the alert
+// channels belong to the operator, not the caller.
+func alertOnIssues(ctx context.Context, run *analysisRun, resp gin.H, issues []analytics.Issue) {
+	if len(issueAlertChannels) == 0 {
+		return
+	}
+	alert := notify.IssueAlert{Tenant: run.Tenant, Kind: run.Kind, Time: time.Now().UTC()}
+	for _, issue := range issues {
+		if issue.Severity == "high" || issue.Severity == "critical" {
+			alert.Issues = append(alert.Issues, notify.AlertIssue{
+				Type:        issue.Type,
+				Description: issue.Description,
+				Severity:    issue.Severity,
+				Category:    issue.Category,
+				Paths:       issue.Path,
+			})
+		}
+	}
+	if len(alert.Issues) == 0 {
+		return
+	}
+	if id, ok := resp["analysis_id"].(string); ok {
+		alert.AnalysisID, alert.Link = id, analysisLink(id)
+	}
+	for _, ch := range issueAlertChannels {
+		if err := notifier.SendIssueAlert(ctx, ch, alert); err != nil {
+			log.Printf("Error sending issue alert to %s: %v", ch.Type, err)
+		}
+	}
+}
+
+// openIncidents opens an incident for each category of critical findings
+// in an analysis. Incidents are keyed on the tenant, kind, category and the
+// time window analysed, so re-analysing a window doesn't page again.
+func openIncidents(ctx context.Context, run *analysisRun, resp gin.H, issues []analytics.Issue, anomalies []aggregator.Anomaly) {
+	if !notifier.IncidentsEnabled() {
+		return
+	}
+	tenant, kind := run.Tenant, run.Kind
+	id, _ := resp["analysis_id"].(string)
+	for _, candidate := range analytics.CriticalFindings(run.Logs, issues, anomalies) {
+		first := candidate.Findings[0]
+		what := first.Description
+		if what == "" {
+			what = first.Type
+		}
+		inc := notify.Incident{
+			DedupKey:   candidate.DedupKey(tenant, kind),
+			Summary:    fmt.Sprintf("Critical %s issue in %s analysis for tenant %s: %s", candidate.Category, kind, tenant, what),
+			Category:   candidate.Category,
+			Tenant:     tenant,
+			AnalysisID: id,
+			Link:       analysisLink(id),
+			Details:    candidate,
+		}
+		opened, err := notifier.OpenIncident(ctx, inc)
+		if err != nil {
+			log.Printf("Error opening %s incident %s: %v", candidate.Category, inc.DedupKey, err)
+		} else if opened {
+			log.Printf("Opened %s incident %s for tenant %s", candidate.Category, inc.DedupKey, tenant)
+		}
+	}
+}
+
+// evaluateAlertRules checks the tenant's alert rules against an analysis,
+// notifies the channels of breached rules that aren't cooling down and
+// lists the breached rules in resp as alerts.
+func evaluateAlertRules(ctx context.Context, run *analysisRun, resp gin.H, issues []analytics.Issue, anomalies []aggregator.Anomaly) {
+	tenant, kind := run.Tenant, run.Kind
+	values := alerts.Values(aggregator.Snapshot(run.Logs, len(issues)), issues, anomalies)
+	triggered := alertRules.Evaluate(tenant, kind, values)
+	if len(triggered) == 0 {
+		return
+	}
+	id, _ := resp["analysis_id"].(string)
+	for i := range triggered {
+		t := &triggered[i]
+		if !t.Notified {
+			continue
+		}
+		alert := notify.RuleAlert{
+			Tenant:     tenant,
+			RuleID:     t.RuleID,
+			Rule:       t.Name,
+			Kind:       kind,
+			Metric:     t.Metric,
+			Operator:   t.Operator,
+			Threshold:  t.Threshold,
+			Value:      t.Value,
+			Severity:   t.Severity,
+			AnalysisID: id,
+			Link:       analysisLink(id),
+			Time:       time.Now().UTC(),
+		}
+		if err := notifier.SendRuleAlert(ctx, t.Channel, alert); err != nil {
+			log.Printf("Error sending alert for rule %s: %v", t.RuleID, err)
+			t.Error = err.Error()
+		}
+	}
+	resp["alerts"] = triggered
+}
+
+// emailReport emails resp to the comma-separated addresses of the email_to
+// query parameter, if any, and records failures in resp as email_error
+// since the analysis itself succeeded.
+func emailReport(ctx context.Context, run *analysisRun, resp gin.H) {
+	raw := run.Query.Get("email_to")
+	if raw == "" {
+		return
+	}
+	ch := notify.Channel{Type: notify.ChannelEmail, To: strings.Split(raw, ",")}
+	for i := range ch.To {
+		ch.To[i] = strings.TrimSpace(ch.To[i])
+	}
+	result, err := json.Marshal(resp)
+	if err != nil {
+		resp["email_error"] = err.Error()
+		return
+	}
+	id, _ := resp["analysis_id"].(string)
+	msg := notify.Message{
+		Event:      notify.EventAnalysisCompleted,
+		Tenant:     run.Tenant,
+		AnalysisID: id,
+		Time:       time.Now().UTC(),
+		Result:     result,
+	}
+	if err := notifier.Send(ctx, ch, msg); err != nil {
+		resp["email_error"] = err.Error()
+		return
+	}
+	resp["emailed_to"] = ch.To
+}
+
+// compareWithBaseline compares metrics with the tenant's baseline name or,
+// if name is empty, the baseline of source and kind. It returns nil if there
+// is no such baseline.
+func compareWithBaseline(tenant, name, kind, source string, metrics *aggregator.MetricsSnapshot) (*aggregator.BaselineComparison, error) {
+	baselines, err := analysisStore.Baselines(tenant)
+	if err != nil {
+		return nil, fmt.Errorf("error reading baselines: %v", err)
+	}
+	var baseline *storage.Baseline
+	for i, b := range baselines {
+		if (name != "" && b.Name == name) || (name == "" && source != "" && b.Source == source && b.Kind == kind) {
+			baseline = &baselines[i]
+			break
+		}
+	}
+	if baseline == nil {
+		if name != "" {
+			return nil, fmt.Errorf("baseline %q not found", name)
+		}
+		return nil, nil
+	}
+
+	analysis, err := analysisStore.Get(tenant, baseline.AnalysisID)
+	if err != nil {
+		return nil, fmt.Errorf("error reading baseline %q: %v", baseline.Name, err)
+	}
+	baselineMetrics, ok := storedMetrics(analysis)
+	if !ok {
+		return nil, fmt.Errorf("baseline %q has no stored metrics", baseline.Name)
+	}
+	thresholds := aggregator.RegressionThresholds{ErrorRate: baseline.ErrorRateThreshold, Latency: baseline.LatencyThreshold}
+	return aggregator.CompareToBaseline(baseline.Name, baseline.AnalysisID, baselineMetrics, metrics, thresholds), nil
+}
+
+// storedMetrics decodes the metrics snapshot of a stored analysis.
+func storedMetrics(analysis storage.Analysis) (*aggregator.MetricsSnapshot, bool) {
+	var metrics aggregator.MetricsSnapshot
+	if len(analysis.Metrics) == 0 || json.Unmarshal(analysis.Metrics, &metrics) != nil {
+		return nil, false
+	}
+	return &metrics, true
+}
+
+// loadTrendPoints returns the metrics of the tenant's n most recent
+// analyses of kind for source, oldest first. Analyses stored without
+// metrics are skipped.
+func loadTrendPoints(tenant, source, kind string, n int) ([]aggregator.TrendPoint, error) {
+	analyses, err := analysisStore.History(tenant, kind)
+	if err != nil {
+		return nil, err
+	}
+
+	var points []aggregator.TrendPoint
+	for _, analysis := range analyses {
+		if len(points) == n {
+			break
+		}
+		if analysis.Source.Name != source {
+			continue
+		}
+		metrics, ok := storedMetrics(analysis)
+		if !ok {
+			continue
+		}
+		points = append(points, aggregator.TrendPoint{AnalysisID: analysis.ID, CreatedAt: analysis.CreatedAt, Metrics: metrics})
+	}
+	for i, j := 0, len(points)-1; i < j; i, j = i+1, j-1 {
+		points[i], points[j] = points[j], points[i]
+	}
+	return points, nil
+}
+
+// loadGrafanaSamples returns the metrics of the tenant's analyses created
+// between from and to, either of which may be zero for no bound, newest
+// first and at most n of them when n is positive. Analyses stored without
+// metrics are skipped.
+func loadGrafanaSamples(tenant string, from, to time.Time, n int) ([]grafana.Sample, error) {
+	analyses, err := analysisStore.History(tenant, "")
+	if err != nil {
+		return nil, err
+	}
+
+	var samples []grafana.Sample
+	for _, analysis := range analyses {
+		if n > 0 && len(samples) == n {
+			break
+		}
+		if (!from.IsZero() && analysis.CreatedAt.Before(from)) || (!to.IsZero() && analysis.CreatedAt.After(to)) {
+			continue
+		}
+		metrics, ok := storedMetrics(analysis)
+		if !ok {
+			continue
+		}
+		samples = append(samples, grafana.Sample{
+			Time:    analysis.CreatedAt,
+			Source:  analysis.Source.Name,
+			Kind:    analysis.Kind,
+			Metrics: metrics,
+		})
+	}
+	return samples, nil
+}
+
+// runScheduledAnalysis is the scheduler's run function. It reads the job's
+// source and analyzes it with runAnalysis, as the job's tenant and with the
+// job's query string, so scheduled analyses are limited, preprocessed,
+// stored and compared with baselines like any other. Unless the query names
+// a source, results are stored under the schedule's name.
+func runScheduledAnalysis(ctx context.Context, job scheduler.Job) (scheduler.Result, error) {
+	query, _ := url.ParseQuery(job.Query)
+	if query.Get("source") == "" {
+		query.Set("source", job.Name)
+	}
+	logs, err := scheduledLogs(ctx, job, query)
+	if err != nil {
+		return scheduler.Result{}, err
+	}
+
+	status, resp := runAnalysis(ctx, job.Tenant, logs, pipelineOptions{
+		Kind:   job.Kind,
+		Query:  query,
+		Source: storage.AnalysisSource{Type: "request"},
+	})
+	if status != http.StatusOK {
+		return scheduler.Result{}, fmt.Errorf("analysis returned status %d: %v", status, resp["error"])
+	}
+	body, err := json.Marshal(resp)
+	if err != nil {
+		return scheduler.Result{}, err
+	}
+	result := scheduler.Result{Response: body}
+	result.AnalysisID, _ = resp["analysis_id"].(string)
+	if comparison, ok := resp["baseline_comparison"].(*aggregator.BaselineComparison); ok {
+		result.Regressed = comparison.Regressed
+	}
+	return result, nil
+}
+
+// scheduledLogs returns the log entries of the job's source: the current
+// window of a log buffer, or the fetched logs decoded according to query.
+func scheduledLogs(ctx context.Context, job scheduler.Job, query url.Values) ([]analytics.LogEntry, error) {
+	if job.Source.Type == scheduler.SourceBuffer {
+		buffer := logBuffers.Get(job.Tenant, job.Source.Buffer)
+		if buffer == nil {
+			return nil, fmt.Errorf("log buffer %q not found", job.Source.Buffer)
+		}
+		return buffer.Entries(), nil
+	}
+	data, err := schedules.Fetch(ctx, job)
+	if err != nil {
+		return nil, err
+	}
+	mapping, err := requestFieldMapping(query)
+	if err != nil {
+		return nil, err
+	}
+	return parseLogData(query, data, mapping, "")
+}
+
+// batchResult is the outcome of one log set of /analyze/batch.
+type batchResult struct {
+	Status int             `json:"status"`
+	Result json.RawMessage `json:"result,omitempty"` // the /analyze/<kind> response
+	Error  string          `json:"error,omitempty"`
+}
+
+// runBatchSet analyzes the log set name, whose body is that of an
+// /analyze/<kind> request with query as its query parameters. The set's
+// name becomes the analysis source.
+func runBatchSet(ctx context.Context, tenant string, query url.Values, kind, name string, body []byte) batchResult {
+	query = cloneQuery(query)
+	query.Del("kind")
+	query.Del("buffer")
+	query.Set("source", name)
+	mapping, err := requestFieldMapping(query)
+	if err != nil {
+		return batchResult{Status: http.StatusBadRequest, Error: err.Error()}
+	}
+	logs, err := parseLogData(query, body, mapping, "")
+	if err != nil {
+		return batchResult{Status: http.StatusBadRequest, Error: fmt.Sprintf("invalid request body: %v", err)}
+	}
+
+	status, resp := runAnalysis(ctx, tenant, logs, pipelineOptions{
+		Kind:   kind,
+		Query:  query,
+		Source: storage.AnalysisSource{Type: "request"},
+	})
+	result := batchResult{Status: status}
+	if status != http.StatusOK {
+		result.Error, _ = resp["error"].(string)
+		return result
+	}
+	if result.Result, err = json.Marshal(resp); err != nil {
+		return batchResult{Status: http.StatusInternalServerError, Error: err.Error()}
+	}
+	return result
+}
+
+// cloneQuery returns a copy of query that can be changed without changing
+// query.
+func cloneQuery(query url.Values) url.Values {
+	clone := make(url.Values, len(query))
+	for key, values := range query {
+		clone[key] = append([]string(nil), values...)
+	}
+	return clone
+}
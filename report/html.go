@@ -0,0 +1,252 @@
+package report
+
+import (
+	"bytes"
+	"fmt"
+	"html"
+	"html/template"
+	"strings"
+
+	"analyticsai/ai-service/analytics"
+	"analyticsai/ai-service/analytics/aggregator"
+)
+
+// SVG chart geometry, in pixels.
+const (
+	svgWidth      = 760.0
+	svgHeight     = 220.0
+	svgAxisWidth  = 56.0
+	svgPlotTop    = 10.0
+	svgPlotHeight = 170.0
+)
+
+// svgColors match the PDF chart colours.
+var svgColors = []string{"#4285f4", "#ea4335", "#34a853", "#fbbc05"}
+
+// svgChart renders a time chart of one or more series as inline SVG, as
+// bars when bars is set and lines otherwise.
+func svgChart(unit string, labels []string, data []series, bars bool) template.HTML {
+	max := 0.0
+	for _, s := range data {
+		for _, v := range s.values {
+			if v > max {
+				max = v
+			}
+		}
+	}
+	max = niceMax(max)
+	plotWidth := svgWidth - svgAxisWidth - 10
+	y := func(v float64) float64 { return svgPlotTop + svgPlotHeight*(1-v/max) }
+	step := plotWidth / float64(len(labels))
+
+	var b strings.Builder
+	fmt.Fprintf(&b, `<svg viewBox="0 0 %.0f %.0f" width="100%%" role="img" xmlns="http://www.w3.org/2000/svg" font-family="sans-serif" font-size="11">`, svgWidth, svgHeight)
+	for i := 0; i <= 4; i++ {
+		v := max * float64(i) / 4
+		fmt.Fprintf(&b, `<line x1="%.1f" x2="%.1f" y1="%.1f" y2="%.1f" stroke="#ddd"/>`, svgAxisWidth, svgAxisWidth+plotWidth, y(v), y(v))
+		fmt.Fprintf(&b, `<text x="%.1f" y="%.1f" text-anchor="end" fill="#666">%s%s</text>`, svgAxisWidth-6, y(v)+4, formatValue(v), html.EscapeString(unit))
+	}
+	for si, s := range data {
+		color := svgColors[si%len(svgColors)]
+		if bars {
+			gap := step * 0.15
+			for i, v := range s.values {
+				fmt.Fprintf(&b, `<rect x="%.1f" y="%.1f" width="%.1f" height="%.1f" fill="%s"><title>%s: %s%s</title></rect>`,
+					svgAxisWidth+float64(i)*step+gap/2, y(v), step-gap, svgPlotTop+svgPlotHeight-y(v), color,
+					html.EscapeString(labels[i]), formatValue(v), html.EscapeString(unit))
+			}
+			continue
+		}
+		points := make([]string, len(s.values))
+		for i, v := range s.values {
+			points[i] = fmt.Sprintf("%.1f,%.1f", svgAxisWidth+(float64(i)+0.5)*step, y(v))
+		}
+		fmt.Fprintf(&b, `<polyline points="%s" fill="none" stroke="%s" stroke-width="2"/>`, strings.Join(points, " "), color)
+	}
+	for _, i := range []int{0, len(labels) / 2, len(labels) - 1} {
+		anchor := "middle"
+		switch i {
+		case 0:
+			anchor = "start"
+		case len(labels) - 1:
+			anchor = "end"
+		}
+		x := svgAxisWidth + (float64(i)+0.5)*step
+		if anchor == "start" {
+			x = svgAxisWidth
+		} else if anchor == "end" {
+			x = svgAxisWidth + plotWidth
+		}
+		fmt.Fprintf(&b, `<text x="%.1f" y="%.1f" text-anchor="%s" fill="#666">%s</text>`, x, svgPlotTop+svgPlotHeight+16, anchor, html.EscapeString(labels[i]))
+	}
+	if len(data) > 1 {
+		x := svgAxisWidth
+		for si, s := range data {
+			fmt.Fprintf(&b, `<rect x="%.1f" y="%.1f" width="10" height="10" fill="%s"/><text x="%.1f" y="%.1f">%s</text>`,
+				x, svgHeight-12, svgColors[si%len(svgColors)], x+14, svgHeight-3, html.EscapeString(s.name))
+			x += float64(len(s.name))*7 + 40
+		}
+	}
+	b.WriteString(`</svg>`)
+	// Every piece of data in the markup above is escaped.
+	return template.HTML(b.String())
+}
+
+type htmlChart struct {
+	Title string
+	SVG   template.HTML
+}
+
+type htmlEndpoint struct {
+	Path        string
+	Requests    int
+	ErrorRate   float64
+	AvgDuration int64
+	P95Duration int64
+	Share       float64 // percent of the busiest endpoint's requests, for the inline bar
+}
+
+var htmlTemplate = template.Must(template.New("report").Parse(`<!DOCTYPE html>
+<html lang="en">
+<head>
+<meta charset="utf-8">
+<meta name="viewport" content="width=device-width, initial-scale=1">
+<title>{{.Title}}</title>
+<style>
+body { font-family: -apple-system, "Segoe UI", Helvetica, Arial, sans-serif; color: #222; max-width: 860px; margin: 2em auto; padding: 0 1em; }
+h1 { margin-bottom: 0.2em; }
+.subtitle { color: #666; font-size: 0.9em; }
+.cards { display: flex; flex-wrap: wrap; gap: 0.8em; margin: 1.5em 0; }
+.card { border: 1px solid #e0e0e0; border-radius: 6px; padding: 0.6em 1em; min-width: 110px; }
+.card .value { font-size: 1.4em; font-weight: bold; }
+.card .label { color: #666; font-size: 0.8em; }
+table { border-collapse: collapse; width: 100%; font-size: 0.9em; }
+th, td { padding: 4px 8px; text-align: right; border-bottom: 1px solid #eee; }
+th:first-child, td:first-child { text-align: left; word-break: break-all; }
+tr:nth-child(even) td { background: #fafafa; }
+.bar { background: #4285f4; height: 8px; border-radius: 2px; }
+.sev { display: inline-block; padding: 0 6px; border-radius: 3px; color: #fff; font-size: 0.8em; text-transform: uppercase; }
+.sev-critical { background: #b00020; } .sev-high { background: #ea4335; } .sev-medium { background: #fbbc05; color: #222; } .sev-low { background: #9e9e9e; }
+code { background: #f3f3f3; padding: 0 3px; border-radius: 3px; }
+</style>
+</head>
+<body>
+<h1>{{.Title}}</h1>
+<p class="subtitle">{{.Subtitle}}</p>
+
+{{if .Summary}}<div class="cards">{{range .Summary}}<div class="card"><div class="value">{{index . 1}}</div><div class="label">{{index . 0}}</div></div>{{end}}</div>{{end}}
+
+{{range .Charts}}<h3>{{.Title}}</h3>
+{{.SVG}}
+{{end}}
+
+{{with .Analysis}}
+{{if .PotentialIssues}}<h2>Potential Issues</h2>
+<ul>{{range .PotentialIssues}}<li><span class="sev sev-{{.Severity}}">{{.Severity}}</span> <strong>{{.Type}}</strong>: {{.Description}}{{with .Paths}} ({{range $i, $p := .}}{{if $i}}, {{end}}<code>{{$p}}</code>{{end}}){{end}} <small>{{.Note}}</small></li>{{end}}</ul>{{end}}
+{{if .Insights}}<h2>Insights</h2>
+<ul>{{range .Insights}}<li>{{.}}</li>{{end}}</ul>{{end}}
+{{end}}
+
+{{if .Endpoints}}<h2>Endpoints</h2>
+<table><tr><th>Path</th><th>Requests</th><th></th><th>Error rate</th><th>Avg</th><th>p95</th></tr>
+{{range .Endpoints}}<tr><td>{{.Path}}</td><td>{{.Requests}}</td><td style="width: 120px;"><div class="bar" style="width: {{printf "%.0f" .Share}}%;"></div></td><td>{{printf "%.2f" .ErrorRate}}%</td><td>{{.AvgDuration}} ms</td><td>{{.P95Duration}} ms</td></tr>
+{{end}}</table>{{end}}
+
+{{with .Analysis}}
+{{if .SlowPages}}<h2>Slow Pages</h2>
+<table><tr><th>Path</th><th>Avg</th><th>Requests</th><th>Error rate</th></tr>
+{{range .SlowPages}}<tr><td>{{.Path}}</td><td>{{.AvgDuration}} ms</td><td>{{.RequestCount}}</td><td>{{printf "%.1f" .ErrorRate}}%</td></tr>
+{{end}}</table>{{end}}
+{{if .Anomalies}}<h2>Anomalies</h2>
+<table><tr><th>Path</th><th>Metric</th><th>Start</th><th>Value</th><th>Expected</th><th>z</th></tr>
+{{range .Anomalies}}<tr><td>{{.Path}}</td><td>{{.Metric}}</td><td>{{.Start}}</td><td>{{.Value}}</td><td>{{.Expected}}</td><td>{{printf "%.1f" .ZScore}}</td></tr>
+{{end}}</table>{{end}}
+{{if .PopularPages}}<h2>Popular Pages</h2>
+<p>{{range $i, $p := .PopularPages}}{{if $i}}, {{end}}<code>{{$p}}</code>{{end}}</p>{{end}}
+{{end}}
+</body>
+</html>
+`))
+
+// htmlIssue is an issue with its paths resolved for the template.
+type htmlIssue struct {
+	Type        string
+	Description string
+	Severity    string
+	Paths       []string
+	Note        string // see findingNote
+}
+
+type htmlAnalysis struct {
+	PotentialIssues []htmlIssue
+	Insights        []string
+	SlowPages       []analytics.PerformanceData
+	Anomalies       []aggregator.Anomaly
+	PopularPages    []string
+}
+
+// RenderHTML renders r as a single HTML file with inline styles and SVG
+// charts, so it can be attached or emailed as is.
+func RenderHTML(r Report) ([]byte, error) {
+	data := struct {
+		Title     string
+		Subtitle  string
+		Summary   [][]string
+		Charts    []htmlChart
+		Analysis  *htmlAnalysis
+		Endpoints []htmlEndpoint
+	}{
+		Title:    r.title(),
+		Subtitle: r.subtitle(),
+		Summary:  r.summaryRows(),
+	}
+
+	for _, ch := range r.timeCharts() {
+		data.Charts = append(data.Charts, htmlChart{ch.title, svgChart(ch.unit, ch.labels, ch.data, ch.bars)})
+	}
+
+	endpoints := r.endpoints()
+	for _, e := range endpoints {
+		data.Endpoints = append(data.Endpoints, htmlEndpoint{
+			Path:        e.Value,
+			Requests:    e.Requests,
+			ErrorRate:   e.ErrorRate,
+			AvgDuration: e.AvgDuration,
+			P95Duration: e.P95Duration,
+			Share:       float64(e.Requests) / float64(endpoints[0].Requests) * 100,
+		})
+	}
+
+	if a := r.Analysis; a != nil {
+		analysis := &htmlAnalysis{
+			SlowPages:    a.SlowPages,
+			Anomalies:    a.Anomalies,
+			PopularPages: a.PopularPages,
+		}
+		if len(analysis.SlowPages) > maxTableRows {
+			analysis.SlowPages = analysis.SlowPages[:maxTableRows]
+		}
+		if len(analysis.Anomalies) > maxTableRows {
+			analysis.Anomalies = analysis.Anomalies[:maxTableRows]
+		}
+		for _, issue := range a.PotentialIssues {
+			analysis.PotentialIssues = append(analysis.PotentialIssues, htmlIssue{
+				Type:        issue.Type,
+				Description: issue.Description,
+				Severity:    issue.Severity,
+				Paths:       issue.Path,
+				Note:        findingNote(issue.Confidence, issue.Grounded),
+			})
+		}
+		for _, insight := range a.Insights {
+			analysis.Insights = append(analysis.Insights, insightLine(insight))
+		}
+		data.Analysis = analysis
+	}
+
+	var out bytes.Buffer
+	if err := htmlTemplate.Execute(&out, data); err != nil {
+		return nil, err
+	}
+	return out.Bytes(), nil
+}
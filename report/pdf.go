@@ -0,0 +1,498 @@
+package report
+
+import (
+	"bytes"
+	"compress/zlib"
+	"fmt"
+	"strings"
+)
+
+// A4 in points, and the layout of the page body.
+const (
+	pageWidth   = 595.0
+	pageHeight  = 842.0
+	margin      = 50.0
+	bodyWidth   = pageWidth - 2*margin
+	chartHeight = 140.0
+	axisWidth   = 40.0 // room for y axis labels left of a chart
+)
+
+// helveticaWidths are the advance widths of ASCII 32-126 in Helvetica, in
+// thousandths of the font size, used to wrap and truncate text.
+var helveticaWidths = [...]int{
+	278, 278, 355, 556, 556, 889, 667, 191, 333, 333, 389, 584, 278, 333, 278, 278,
+	556, 556, 556, 556, 556, 556, 556, 556, 556, 556, 278, 278, 584, 584, 584, 556,
+	1015, 667, 667, 722, 722, 667, 611, 778, 722, 278, 500, 667, 556, 833, 722, 778,
+	667, 778, 722, 667, 611, 722, 667, 944, 667, 667, 611, 278, 278, 278, 469, 556,
+	333, 556, 556, 500, 556, 556, 278, 556, 556, 222, 222, 500, 222, 833, 556, 556,
+	556, 556, 333, 500, 278, 556, 500, 722, 500, 500, 500, 334, 260, 334, 584,
+}
+
+// Chart colours, as PDF RGB operands.
+var seriesColors = []string{"0.26 0.52 0.96", "0.92 0.26 0.21", "0.20 0.66 0.33", "0.98 0.74 0.02"}
+
+// textWidth estimates the width of s in points. Bold text is about 5%
+// wider than regular.
+func textWidth(s string, size float64, bold bool) float64 {
+	w := 0
+	for _, r := range s {
+		if r >= 32 && r <= 126 {
+			w += helveticaWidths[r-32]
+		} else {
+			w += 556
+		}
+	}
+	width := float64(w) * size / 1000
+	if bold {
+		width *= 1.05
+	}
+	return width
+}
+
+// pdfString encodes s as a PDF literal string in WinAnsiEncoding, replacing
+// characters it can't represent with '?'.
+func pdfString(s string) string {
+	var b strings.Builder
+	b.WriteByte('(')
+	for _, r := range s {
+		switch {
+		case r == '(' || r == ')' || r == '\\':
+			b.WriteByte('\\')
+			b.WriteRune(r)
+		case r >= 32 && r <= 126, r >= 160 && r <= 255:
+			b.WriteByte(byte(r))
+		case r == '\t':
+			b.WriteByte(' ')
+		default:
+			b.WriteByte('?')
+		}
+	}
+	b.WriteByte(')')
+	return b.String()
+}
+
+// wrap breaks s into lines no wider than width.
+func wrap(s string, size, width float64, bold bool) []string {
+	var lines []string
+	for _, para := range strings.Split(s, "\n") {
+		line := ""
+		for _, word := range strings.Fields(para) {
+			candidate := word
+			if line != "" {
+				candidate = line + " " + word
+			}
+			if line != "" && textWidth(candidate, size, bold) > width {
+				lines = append(lines, line)
+				candidate = word
+			}
+			// Break words longer than a line, such as long paths.
+			for textWidth(candidate, size, bold) > width && len(candidate) > 1 {
+				cut := len(candidate) - 1
+				for cut > 1 && textWidth(candidate[:cut], size, bold) > width {
+					cut--
+				}
+				lines = append(lines, candidate[:cut])
+				candidate = candidate[cut:]
+			}
+			line = candidate
+		}
+		lines = append(lines, line)
+	}
+	return lines
+}
+
+// truncate shortens s with an ellipsis to fit width.
+func truncate(s string, size, width float64) string {
+	if textWidth(s, size, false) <= width {
+		return s
+	}
+	for len(s) > 0 && textWidth(s+"...", size, false) > width {
+		s = s[:len(s)-1]
+	}
+	return s + "..."
+}
+
+// pdfWriter lays out a document top to bottom, starting new pages as
+// content runs past the bottom margin.
+type pdfWriter struct {
+	pages []*bytes.Buffer
+	page  *bytes.Buffer
+	y     float64 // baseline of the next line
+}
+
+func newPDFWriter() *pdfWriter {
+	w := &pdfWriter{}
+	w.newPage()
+	return w
+}
+
+func (w *pdfWriter) newPage() {
+	w.page = &bytes.Buffer{}
+	w.pages = append(w.pages, w.page)
+	w.y = pageHeight - margin
+}
+
+// ensure starts a new page unless height points fit above the margin.
+func (w *pdfWriter) ensure(height float64) {
+	if w.y-height < margin {
+		w.newPage()
+	}
+}
+
+func (w *pdfWriter) text(x, y, size float64, bold bool, s string) {
+	font := "F1"
+	if bold {
+		font = "F2"
+	}
+	fmt.Fprintf(w.page, "BT /%s %.1f Tf %.2f %.2f Td %s Tj ET\n", font, size, x, y, pdfString(s))
+}
+
+func (w *pdfWriter) fill(color string) {
+	fmt.Fprintf(w.page, "%s rg\n", color)
+}
+
+func (w *pdfWriter) stroke(color string, width float64) {
+	fmt.Fprintf(w.page, "%s RG %.2f w\n", color, width)
+}
+
+func (w *pdfWriter) rect(x, y, width, height float64) {
+	fmt.Fprintf(w.page, "%.2f %.2f %.2f %.2f re f\n", x, y, width, height)
+}
+
+func (w *pdfWriter) line(x1, y1, x2, y2 float64) {
+	fmt.Fprintf(w.page, "%.2f %.2f m %.2f %.2f l S\n", x1, y1, x2, y2)
+}
+
+func (w *pdfWriter) title(s string) {
+	w.ensure(30)
+	w.text(margin, w.y-20, 20, true, s)
+	w.y -= 30
+}
+
+func (w *pdfWriter) heading(s string) {
+	w.ensure(40)
+	w.y -= 12
+	w.text(margin, w.y-13, 13, true, s)
+	w.y -= 20
+}
+
+func (w *pdfWriter) paragraph(s string, size float64) {
+	for _, line := range wrap(s, size, bodyWidth, false) {
+		w.ensure(size * 1.4)
+		w.text(margin, w.y-size, size, false, line)
+		w.y -= size * 1.4
+	}
+	w.y -= 4
+}
+
+func (w *pdfWriter) bullets(items []string) {
+	const size, indent = 10.0, 12.0
+	for _, item := range items {
+		for i, line := range wrap(item, size, bodyWidth-indent, false) {
+			w.ensure(size * 1.4)
+			if i == 0 {
+				w.text(margin, w.y-size, size, false, "-")
+			}
+			w.text(margin+indent, w.y-size, size, false, line)
+			w.y -= size * 1.4
+		}
+		w.y -= 2
+	}
+}
+
+// table draws rows under a bold header. widths are column widths in
+// points; columns after the first are right-aligned. Cells are truncated
+// to fit.
+func (w *pdfWriter) table(header []string, widths []float64, rows [][]string) {
+	const size, rowHeight = 9.0, 14.0
+	drawRow := func(cells []string, bold bool) {
+		w.ensure(rowHeight)
+		x := margin
+		for i, cell := range cells {
+			cell = truncate(cell, size, widths[i]-6)
+			tx := x
+			if i > 0 {
+				tx = x + widths[i] - textWidth(cell, size, bold) - 4
+			}
+			w.text(tx, w.y-size-2, size, bold, cell)
+			x += widths[i]
+		}
+		w.y -= rowHeight
+	}
+
+	w.ensure(rowHeight * 2)
+	drawRow(header, true)
+	w.stroke("0.6 0.6 0.6", 0.5)
+	w.line(margin, w.y+2, margin+sum(widths), w.y+2)
+	for i, row := range rows {
+		if i%2 == 1 {
+			w.ensure(rowHeight)
+			w.fill("0.95 0.95 0.95")
+			w.rect(margin, w.y-rowHeight+2, sum(widths), rowHeight)
+			w.fill("0 0 0")
+		}
+		drawRow(row, false)
+	}
+	w.y -= 6
+}
+
+func sum(values []float64) float64 {
+	total := 0.0
+	for _, v := range values {
+		total += v
+	}
+	return total
+}
+
+// chart draws a time chart of one or more series over labels, as bars when
+// bars is set and lines otherwise.
+func (w *pdfWriter) chart(title, unit string, labels []string, data []series, bars bool) {
+	if len(labels) == 0 {
+		return
+	}
+	w.ensure(chartHeight + 50)
+	w.text(margin, w.y-11, 11, true, title)
+	w.y -= 20
+
+	max := 0.0
+	for _, s := range data {
+		for _, v := range s.values {
+			if v > max {
+				max = v
+			}
+		}
+	}
+	max = niceMax(max)
+
+	left, bottom := margin+axisWidth, w.y-chartHeight
+	plotWidth := bodyWidth - axisWidth
+	w.stroke("0.85 0.85 0.85", 0.5)
+	for i := 0; i <= 4; i++ {
+		y := bottom + chartHeight*float64(i)/4
+		w.line(left, y, left+plotWidth, y)
+		label := formatValue(max*float64(i)/4) + unit
+		w.text(left-textWidth(label, 7, false)-4, y-2.5, 7, false, label)
+	}
+
+	n := float64(len(labels))
+	step := plotWidth / n
+	for si, s := range data {
+		color := seriesColors[si%len(seriesColors)]
+		if bars {
+			w.fill(color)
+			gap := step * 0.15
+			for i, v := range s.values {
+				w.rect(left+float64(i)*step+gap/2, bottom, step-gap, chartHeight*v/max)
+			}
+			w.fill("0 0 0")
+			continue
+		}
+		w.stroke(color, 1.2)
+		for i, v := range s.values {
+			x, y := left+(float64(i)+0.5)*step, bottom+chartHeight*v/max
+			op := "l"
+			if i == 0 {
+				op = "m"
+			}
+			fmt.Fprintf(w.page, "%.2f %.2f %s\n", x, y, op)
+		}
+		if len(s.values) == 1 {
+			fmt.Fprintf(w.page, "%.2f %.2f l\n", left+step, bottom+chartHeight*s.values[0]/max)
+		}
+		fmt.Fprintf(w.page, "S\n")
+	}
+
+	// Label the first, middle and last buckets.
+	w.y = bottom - 10
+	for _, i := range []int{0, len(labels) / 2, len(labels) - 1} {
+		label := labels[i]
+		x := left + (float64(i)+0.5)*step - textWidth(label, 7, false)/2
+		if x < left {
+			x = left
+		}
+		if x+textWidth(label, 7, false) > left+plotWidth {
+			x = left + plotWidth - textWidth(label, 7, false)
+		}
+		w.text(x, w.y, 7, false, label)
+	}
+	if len(data) > 1 {
+		x := left
+		for si, s := range data {
+			w.fill(seriesColors[si%len(seriesColors)])
+			w.rect(x, w.y-12, 8, 6)
+			w.fill("0 0 0")
+			w.text(x+11, w.y-12, 7, false, s.name)
+			x += textWidth(s.name, 7, false) + 30
+		}
+		w.y -= 10
+	}
+	w.y -= 16
+}
+
+// barList draws labelled horizontal bars, one per row.
+func (w *pdfWriter) barList(title string, labels []string, values []float64, format func(float64) string) {
+	if len(labels) == 0 {
+		return
+	}
+	const size, rowHeight, labelWidth = 8.0, 13.0, 170.0
+	w.ensure(rowHeight*2 + 20)
+	w.text(margin, w.y-11, 11, true, title)
+	w.y -= 20
+
+	max := 0.0
+	for _, v := range values {
+		if v > max {
+			max = v
+		}
+	}
+	if max == 0 {
+		max = 1
+	}
+	barSpace := bodyWidth - labelWidth - 50
+	for i, label := range labels {
+		w.ensure(rowHeight)
+		w.text(margin, w.y-size-1, size, false, truncate(label, size, labelWidth-6))
+		w.fill(seriesColors[0])
+		width := barSpace * values[i] / max
+		w.rect(margin+labelWidth, w.y-rowHeight+3, width, rowHeight-4)
+		w.fill("0 0 0")
+		w.text(margin+labelWidth+width+4, w.y-size-1, size, false, format(values[i]))
+		w.y -= rowHeight
+	}
+	w.y -= 8
+}
+
+// bytes assembles the pages into a PDF file, numbering the pages.
+func (w *pdfWriter) bytes() ([]byte, error) {
+	var out bytes.Buffer
+	var offsets []int
+	obj := func(body string) {
+		offsets = append(offsets, out.Len())
+		fmt.Fprintf(&out, "%d 0 obj\n%s\nendobj\n", len(offsets), body)
+	}
+
+	out.WriteString("%PDF-1.4\n%\xe2\xe3\xcf\xd3\n")
+	// The catalog, page tree and two fonts come first, then each page is
+	// followed by its content stream.
+	const firstPage = 5
+	kids := make([]string, len(w.pages))
+	for i := range w.pages {
+		kids[i] = fmt.Sprintf("%d 0 R", firstPage+2*i)
+	}
+	obj("<< /Type /Catalog /Pages 2 0 R >>")
+	obj(fmt.Sprintf("<< /Type /Pages /Kids [%s] /Count %d >>", strings.Join(kids, " "), len(w.pages)))
+	obj("<< /Type /Font /Subtype /Type1 /BaseFont /Helvetica /Encoding /WinAnsiEncoding >>")
+	obj("<< /Type /Font /Subtype /Type1 /BaseFont /Helvetica-Bold /Encoding /WinAnsiEncoding >>")
+
+	for i, page := range w.pages {
+		w.page = page
+		footer := fmt.Sprintf("Page %d of %d", i+1, len(w.pages))
+		w.fill("0.5 0.5 0.5")
+		w.text(pageWidth-margin-textWidth(footer, 8, false), margin/2, 8, false, footer)
+
+		var content bytes.Buffer
+		zw := zlib.NewWriter(&content)
+		if _, err := zw.Write(page.Bytes()); err != nil {
+			return nil, err
+		}
+		if err := zw.Close(); err != nil {
+			return nil, err
+		}
+		obj(fmt.Sprintf("<< /Type /Page /Parent 2 0 R /MediaBox [0 0 %.0f %.0f] /Resources << /Font << /F1 3 0 R /F2 4 0 R >> >> /Contents %d 0 R >>",
+			pageWidth, pageHeight, len(offsets)+2))
+		obj(fmt.Sprintf("<< /Length %d /Filter /FlateDecode >>\nstream\n%s\nendstream", content.Len(), content.Bytes()))
+	}
+
+	xref := out.Len()
+	fmt.Fprintf(&out, "xref\n0 %d\n0000000000 65535 f \n", len(offsets)+1)
+	for _, off := range offsets {
+		fmt.Fprintf(&out, "%010d 00000 n \n", off)
+	}
+	fmt.Fprintf(&out, "trailer\n<< /Size %d /Root 1 0 R >>\nstartxref\n%d\n%%%%EOF\n", len(offsets)+1, xref)
+	return out.Bytes(), nil
+}
+
+// RenderPDF renders r as a PDF document.
+func RenderPDF(r Report) ([]byte, error) {
+	w := newPDFWriter()
+	w.title(r.title())
+	w.fill("0.4 0.4 0.4")
+	w.paragraph(r.subtitle(), 9)
+	w.fill("0 0 0")
+
+	if rows := r.summaryRows(); rows != nil {
+		w.heading("Summary")
+		w.table([]string{"Metric", "Value"}, []float64{250, 120}, rows)
+	}
+
+	if charts := r.timeCharts(); len(charts) > 0 {
+		w.heading("Over Time")
+		for _, ch := range charts {
+			w.chart(ch.title, ch.unit, ch.labels, ch.data, ch.bars)
+		}
+	}
+
+	if endpoints := r.endpoints(); len(endpoints) > 0 {
+		w.heading("Endpoints")
+		labels := make([]string, len(endpoints))
+		requests := make([]float64, len(endpoints))
+		rows := make([][]string, len(endpoints))
+		for i, e := range endpoints {
+			labels[i] = e.Value
+			requests[i] = float64(e.Requests)
+			rows[i] = []string{e.Value, fmt.Sprintf("%d", e.Requests), fmt.Sprintf("%.2f%%", e.ErrorRate),
+				fmt.Sprintf("%d ms", e.AvgDuration), fmt.Sprintf("%d ms", e.P95Duration)}
+		}
+		w.barList("Busiest endpoints", labels, requests, func(v float64) string { return formatValue(v) })
+		w.table([]string{"Path", "Requests", "Error rate", "Avg", "p95"}, []float64{215, 70, 70, 70, 70}, rows)
+	}
+
+	if a := r.Analysis; a != nil {
+		if len(a.PotentialIssues) > 0 {
+			w.heading("Potential Issues")
+			items := make([]string, len(a.PotentialIssues))
+			for i, issue := range a.PotentialIssues {
+				items[i] = issueLine(issue)
+			}
+			w.bullets(items)
+		}
+		if len(a.Insights) > 0 {
+			w.heading("Insights")
+			items := make([]string, len(a.Insights))
+			for i, insight := range a.Insights {
+				items[i] = insightLine(insight)
+			}
+			w.bullets(items)
+		}
+		if len(a.SlowPages) > 0 {
+			w.heading("Slow Pages")
+			var rows [][]string
+			for i, p := range a.SlowPages {
+				if i == maxTableRows {
+					break
+				}
+				rows = append(rows, []string{p.Path, fmt.Sprintf("%d ms", p.AvgDuration),
+					fmt.Sprintf("%d", p.RequestCount), fmt.Sprintf("%.1f%%", p.ErrorRate)})
+			}
+			w.table([]string{"Path", "Avg", "Requests", "Error rate"}, []float64{255, 80, 80, 80}, rows)
+		}
+		if len(a.Anomalies) > 0 {
+			w.heading("Anomalies")
+			var rows [][]string
+			for i, an := range a.Anomalies {
+				if i == maxTableRows {
+					break
+				}
+				rows = append(rows, []string{an.Path, an.Metric, bucketLabel(an.Start),
+					formatValue(an.Value), formatValue(an.Expected), fmt.Sprintf("%.1f", an.ZScore)})
+			}
+			w.table([]string{"Path", "Metric", "Start", "Value", "Expected", "z"}, []float64{160, 75, 80, 60, 70, 50}, rows)
+		}
+		if len(a.PopularPages) > 0 {
+			w.heading("Popular Pages")
+			w.paragraph(strings.Join(a.PopularPages, ", "), 10)
+		}
+	}
+
+	return w.bytes()
+}
@@ -0,0 +1,184 @@
+// Package report renders analysis results as documents for people who
+// don't read JSON: PDF and self-contained HTML.
+package report
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"analyticsai/ai-service/analytics"
+	"analyticsai/ai-service/analytics/aggregator"
+)
+
+// maxTableRows caps the rows of each table in a report.
+const maxTableRows = 20
+
+// Report is a log analysis together with the deterministic metrics of the
+// logs it analysed.
+type Report struct {
+	Title       string
+	Tenant      string
+	AnalysisID  string
+	GeneratedAt time.Time
+	Analysis    *analytics.AnalysisResult
+	Metrics     *aggregator.MetricsSnapshot
+}
+
+func (r Report) title() string {
+	if r.Title != "" {
+		return r.Title
+	}
+	return "Log Analysis Report"
+}
+
+// subtitle describes when and for whom the report was generated.
+func (r Report) subtitle() string {
+	parts := []string{"Generated " + r.GeneratedAt.UTC().Format("2006-01-02 15:04 MST")}
+	if r.Tenant != "" {
+		parts = append(parts, "tenant "+r.Tenant)
+	}
+	if r.AnalysisID != "" {
+		parts = append(parts, "analysis "+r.AnalysisID)
+	}
+	if ts := r.buckets(); len(ts) > 0 {
+		parts = append(parts, fmt.Sprintf("%s to %s", bucketLabel(ts[0].Start), bucketLabel(ts[len(ts)-1].Start)))
+	}
+	return strings.Join(parts, " · ")
+}
+
+func (r Report) buckets() []aggregator.TimeBucket {
+	if r.Analysis == nil || r.Analysis.TimeSeries == nil {
+		return nil
+	}
+	return r.Analysis.TimeSeries.Buckets
+}
+
+// series is one line or set of bars in a chart.
+type series struct {
+	name   string
+	values []float64
+}
+
+// timeChart is a chart of the analysis time series.
+type timeChart struct {
+	title  string
+	unit   string
+	labels []string
+	data   []series
+	bars   bool
+}
+
+// timeCharts are the traffic, latency and error rate charts of the time
+// series, if the analysis has one.
+func (r Report) timeCharts() []timeChart {
+	buckets := r.buckets()
+	if len(buckets) == 0 {
+		return nil
+	}
+	labels := make([]string, len(buckets))
+	traffic := make([]float64, len(buckets))
+	errorRate := make([]float64, len(buckets))
+	avg := make([]float64, len(buckets))
+	p95 := make([]float64, len(buckets))
+	for i, b := range buckets {
+		labels[i] = bucketLabel(b.Start)
+		traffic[i] = float64(b.Requests)
+		errorRate[i] = b.ErrorRate
+		avg[i] = float64(b.AvgDuration)
+		p95[i] = float64(b.P95Duration)
+	}
+	return []timeChart{
+		{"Requests per " + r.Analysis.TimeSeries.Interval, "", labels, []series{{"requests", traffic}}, true},
+		{"Latency", "ms", labels, []series{{"average", avg}, {"p95", p95}}, false},
+		{"Error rate", "%", labels, []series{{"error rate", errorRate}}, false},
+	}
+}
+
+// summaryRows are the headline metrics as label/value pairs.
+func (r Report) summaryRows() [][]string {
+	m := r.Metrics
+	if m == nil {
+		return nil
+	}
+	return [][]string{
+		{"Requests", fmt.Sprintf("%d", m.Requests)},
+		{"Error rate", fmt.Sprintf("%.2f%%", m.ErrorRate)},
+		{"Average duration", fmt.Sprintf("%d ms", m.AvgDuration)},
+		{"p95 duration", fmt.Sprintf("%d ms", m.P95Duration)},
+		{"Slow endpoints (p95 > 1s)", fmt.Sprintf("%d", m.SlowEndpoints)},
+		{"Issues", fmt.Sprintf("%d", m.Issues)},
+	}
+}
+
+func (r Report) endpoints() []aggregator.DimensionStats {
+	if r.Metrics == nil {
+		return nil
+	}
+	if len(r.Metrics.Endpoints) > maxTableRows {
+		return r.Metrics.Endpoints[:maxTableRows]
+	}
+	return r.Metrics.Endpoints
+}
+
+// issueLine formats an issue as "[SEVERITY] type: description (paths)
+// [confidence]".
+func issueLine(issue analytics.Issue) string {
+	line := fmt.Sprintf("[%s] %s: %s", strings.ToUpper(issue.Severity), issue.Type, issue.Description)
+	if paths := issue.Path; len(paths) > 0 {
+		line += " (" + strings.Join(paths, ", ") + ")"
+	}
+	return line + " [" + findingNote(issue.Confidence, issue.Grounded) + "]"
+}
+
+// insightLine formats an insight as "text [confidence]".
+func insightLine(insight analytics.Insight) string {
+	return insight.Text + " [" + findingNote(insight.Confidence, insight.Grounded) + "]"
+}
+
+// findingNote describes how well a finding is supported, e.g. "80%
+// confidence, evidence verified".
+func findingNote(confidence float64, grounded bool) string {
+	if grounded {
+		return fmt.Sprintf("%.0f%% confidence, evidence verified", confidence*100)
+	}
+	return fmt.Sprintf("%.0f%% confidence, unverified", confidence*100)
+}
+
+// bucketLabel shortens an RFC 3339 bucket start for chart axes.
+func bucketLabel(start string) string {
+	t, err := time.Parse(time.RFC3339, start)
+	if err != nil {
+		return start
+	}
+	return t.Format("Jan 2 15:04")
+}
+
+// niceMax rounds v up to 1, 2 or 5 times a power of ten so chart axes get
+// round gridline values.
+func niceMax(v float64) float64 {
+	if v <= 0 {
+		return 1
+	}
+	p := 1.0
+	for p*10 <= v {
+		p *= 10
+	}
+	for p > v {
+		p /= 10
+	}
+	for _, m := range []float64{1, 2, 5, 10} {
+		if m*p >= v {
+			return m * p
+		}
+	}
+	return 10 * p
+}
+
+// formatValue formats an axis value without needless decimals.
+func formatValue(v float64) string {
+	if v == float64(int64(v)) {
+		return fmt.Sprintf("%d", int64(v))
+	}
+	return fmt.Sprintf("%.1f", v)
+}
@@ -0,0 +1,526 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"analyticsai/ai-service/analytics"
+	"analyticsai/ai-service/analytics/aggregator"
+	"analyticsai/ai-service/analytics/parser"
+	"analyticsai/ai-service/storage"
+
+	"github.com/gin-gonic/gin"
+)
+
+func readFormFile(file *multipart.FileHeader) ([]byte, error) {
+	f, err := file.Open()
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return io.ReadAll(f)
+}
+
+// bindLogs decodes a JSON array of log entries from the request body,
+// applying the request's field mapping, and preprocesses it according to the
+// query string. On failure it writes the error response and returns false.
+func bindLogs(c *gin.Context) ([]analytics.LogEntry, analytics.AnalysisOptions, bool) {
+	logs, ok := decodeLogs(c)
+	if !ok {
+		return nil, analytics.AnalysisOptions{}, false
+	}
+	return prepareLogs(c, logs)
+}
+
+// decodeLogs decodes a JSON array of log entries from the request body,
+// applying the request's field mapping. With log_format=container the body
+// is Kubernetes container logs instead. With buffer=<name> the entries are
+// those of the tenant's log buffer, and the body is ignored.
+func decodeLogs(c *gin.Context) ([]analytics.LogEntry, bool) {
+	if buffer, ok := requestBuffer(c); !ok {
+		return nil, false
+	} else if buffer != nil {
+		return buffer.Entries(), true
+	}
+
+	mapping, err := requestFieldMapping(c.Request.URL.Query())
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return nil, false
+	}
+
+	body, err := c.GetRawData()
+	if isBodyTooLarge(err) {
+		c.JSON(http.StatusRequestEntityTooLarge, gin.H{"error": fmt.Sprintf("request body exceeds %d bytes when decompressed", maxDecompressedBody)})
+		return nil, false
+	}
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("invalid request body: %v", err)})
+		return nil, false
+	}
+	logs, err := parseLogData(c.Request.URL.Query(), body, mapping, "")
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("invalid request body: %v", err)})
+		return nil, false
+	}
+	return logs, true
+}
+
+// requestBuffer returns the tenant's log buffer named by the buffer query
+// parameter, or nil if the request doesn't name one. It responds with 404
+// and returns false if there is no such buffer.
+func requestBuffer(c *gin.Context) (*analytics.LogBuffer, bool) {
+	name := c.Query("buffer")
+	if name == "" {
+		return nil, true
+	}
+	buffer := logBuffers.Get(tenantID(c), name)
+	if buffer == nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": fmt.Sprintf("log buffer %q not found", name)})
+		return nil, false
+	}
+	return buffer, true
+}
+
+// parseLogData parses log data in the format named by the log_format query
+// parameter: a JSON array of entries (json, the default) or Kubernetes
+// container logs (container). Uploads named *.log default to container
+// logs, labelled from fileName.
+func parseLogData(query url.Values, data []byte, mapping parser.FieldMapping, fileName string) ([]analytics.LogEntry, error) {
+	format := query.Get("log_format")
+	if format == "" && strings.HasSuffix(fileName, ".log") {
+		format = "container"
+	}
+	switch format {
+	case "", "json":
+		return parser.DecodeLogs(data, mapping)
+	case "container":
+		logFile := query.Get("log_file")
+		if logFile == "" {
+			logFile = fileName
+		}
+		return parser.ParseContainerLogs(data, containerLabels(query, logFile), mapping)
+	}
+	return nil, fmt.Errorf("unsupported log_format %q", format)
+}
+
+// containerLabels returns the Kubernetes labels of container logs: those
+// derived from the name of the log file, overridden by the namespace, pod
+// and container query parameters.
+func containerLabels(query url.Values, logFile string) parser.ContainerLabels {
+	return parser.LabelsFromLogFile(logFile).Merge(parser.ContainerLabels{
+		Namespace: query.Get("namespace"),
+		Pod:       query.Get("pod"),
+		Container: query.Get("container"),
+	})
+}
+
+// requestFieldMapping combines the stored profile named by the mapping query
+// parameter with any inline field_map pairs, which take precedence.
+func requestFieldMapping(query url.Values) (parser.FieldMapping, error) {
+	var mapping parser.FieldMapping
+	if name := query.Get("mapping"); name != "" {
+		profile, ok := fieldMappings.Get(name)
+		if !ok {
+			return nil, fmt.Errorf("unknown field mapping profile %q", name)
+		}
+		mapping = profile
+	}
+	if raw := query.Get("field_map"); raw != "" {
+		inline, err := parser.ParseFieldMapping(raw)
+		if err != nil {
+			return nil, err
+		}
+		mapping = mapping.Merge(inline)
+	}
+	return mapping, nil
+}
+
+// prepareLogs parses the analysis options from the query string and applies
+// their preprocessing steps to logs.
+func prepareLogs(c *gin.Context, logs []analytics.LogEntry) ([]analytics.LogEntry, analytics.AnalysisOptions, bool) {
+	opts, err := parseAnalysisOptions(tenantID(c), c.Request.URL.Query())
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return nil, opts, false
+	}
+	return preprocessLogs(c, logs, opts)
+}
+
+// preprocessLogs applies the preprocessing steps of opts to logs and reports
+// timestamp normalization in the response headers.
+func preprocessLogs(c *gin.Context, logs []analytics.LogEntry, opts analytics.AnalysisOptions) ([]analytics.LogEntry, analytics.AnalysisOptions, bool) {
+	logs, report, err := analytics.Preprocess(logs, opts.PreprocessOptions)
+	if err != nil {
+		respondAnalysisError(c, "error preprocessing logs", err)
+		return nil, opts, false
+	}
+	if ts := report.Timestamps; ts != nil {
+		c.Header("X-Timestamp-Layout", ts.Layout)
+		c.Header("X-Invalid-Timestamps", strconv.Itoa(ts.Invalid))
+	}
+	if report.DuplicatesRemoved > 0 {
+		c.Header("X-Duplicates-Removed", strconv.Itoa(report.DuplicatesRemoved))
+	}
+	return logs, opts, true
+}
+
+// parseAnalysisOptions reads the analysis options shared by the analysis
+// endpoints from query, along with the tenant's feedback examples.
+func parseAnalysisOptions(tenant string, query url.Values) (analytics.AnalysisOptions, error) {
+	var opts analytics.AnalysisOptions
+	// Path normalization is on unless explicitly disabled.
+	opts.NormalizePaths = query.Get("normalize_paths") != "false"
+	if raw := query.Get("path_patterns"); raw != "" {
+		opts.PathPatterns = strings.Split(raw, ",")
+	}
+	filters, err := parseFilters(query)
+	if err != nil {
+		return opts, err
+	}
+	opts.Filters = filters
+	opts.NormalizeTimestamps = true
+	opts.TimestampLayout = query.Get("timestamp_layout")
+	opts.InvalidTimestamps = parser.InvalidTimestampPolicy(query.Get("invalid_timestamps"))
+	opts.Location = defaultLocation
+	if raw := query.Get("timezone"); raw != "" {
+		loc, err := time.LoadLocation(raw)
+		if err != nil {
+			return opts, fmt.Errorf("invalid timezone %q", raw)
+		}
+		opts.Location = loc
+	}
+	opts.Dedup = aggregator.DedupMode(query.Get("dedup"))
+	if raw := query.Get("dedup_window"); raw != "" {
+		window, err := time.ParseDuration(raw)
+		if err != nil || window <= 0 {
+			return opts, fmt.Errorf("invalid dedup_window %q", raw)
+		}
+		opts.DedupWindow = window
+	}
+	opts.QueryMode = analytics.QueryMode(query.Get("query_mode"))
+	if raw := query.Get("query_params"); raw != "" {
+		opts.QueryParams = strings.Split(raw, ",")
+		if opts.QueryMode == "" {
+			opts.QueryMode = analytics.QuerySelect
+		}
+	}
+	if raw := query.Get("interval"); raw != "" {
+		interval, err := aggregator.ParseInterval(raw)
+		if err != nil {
+			return opts, err
+		}
+		opts.Interval = interval
+	}
+	if raw := query.Get("anomaly_threshold"); raw != "" {
+		threshold, err := strconv.ParseFloat(raw, 64)
+		if err != nil || threshold <= 0 {
+			return opts, fmt.Errorf("invalid anomaly_threshold %q", raw)
+		}
+		opts.AnomalyThreshold = threshold
+	}
+	if raw := query.Get("internal_hosts"); raw != "" {
+		opts.InternalHosts = strings.Split(raw, ",")
+	}
+	if raw := query.Get("sample_threshold"); raw != "" {
+		threshold, err := strconv.Atoi(raw)
+		if err != nil {
+			return opts, fmt.Errorf("invalid sample_threshold %q", raw)
+		}
+		opts.SampleThreshold = threshold
+	}
+	groupBy, err := aggregator.ParseGroupBy(query.Get("group_by"))
+	if err != nil {
+		return opts, err
+	}
+	opts.GroupBy = groupBy
+	opts.Feedback = feedback.Examples(tenant)
+	opts.Consensus = query.Get("consensus") == "true"
+	return opts, nil
+}
+
+// loadUpload reads and decodes an upload of the calling tenant stored by
+// /upload. Uploads aren't kept in Cloud Run mode.
+func loadUpload(c *gin.Context, id string) ([]analytics.LogEntry, bool) {
+	if cloudRunMode {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "uploads are not stored in Cloud Run mode; send the logs in the request body"})
+		return nil, false
+	}
+
+	data, err := uploadStore.Load(tenantID(c), id)
+	if errors.Is(err, storage.ErrNotFound) {
+		c.JSON(http.StatusNotFound, gin.H{"error": fmt.Sprintf("upload %q not found", id)})
+		return nil, false
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": fmt.Sprintf("read file err: %v", err)})
+		return nil, false
+	}
+
+	mapping, err := requestFieldMapping(c.Request.URL.Query())
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return nil, false
+	}
+	logs, err := parseLogData(c.Request.URL.Query(), data, mapping, "")
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("parse json err: %v", err)})
+		return nil, false
+	}
+	return logs, true
+}
+
+// parseTimeRange parses the from and to query parameters, either of which
+// may be left out. On failure it writes the error response and returns
+// false.
+func parseTimeRange(c *gin.Context) (from, to time.Time, ok bool) {
+	for name, dst := range map[string]*time.Time{"from": &from, "to": &to} {
+		if raw := c.Query(name); raw != "" {
+			t, ok := parser.ParseTimestamp(raw)
+			if !ok {
+				c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("invalid %s %q", name, raw)})
+				return time.Time{}, time.Time{}, false
+			}
+			*dst = t
+		}
+	}
+	if !from.IsZero() && !to.IsZero() && !from.Before(to) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "from must be before to"})
+		return time.Time{}, time.Time{}, false
+	}
+	return from, to, true
+}
+
+// parseUsagePeriod parses the period a usage report covers: from and to,
+// defaulting to the current UTC month up to now.
+func parseUsagePeriod(c *gin.Context) (from, to time.Time, ok bool) {
+	if from, to, ok = parseTimeRange(c); !ok {
+		return from, to, false
+	}
+	if to.IsZero() {
+		to = time.Now().UTC()
+	}
+	if from.IsZero() {
+		from = time.Date(to.Year(), to.Month(), 1, 0, 0, 0, 0, time.UTC)
+	}
+	if to.Sub(from) > storage.MaxAuditQueryRange {
+		c.JSON(http.StatusBadRequest, gin.H{"error": storage.ErrAuditQueryRange.Error()})
+		return from, to, false
+	}
+	return from, to, true
+}
+
+// parsePagination parses the offset and limit query parameters of a list
+// endpoint. On failure it writes the error response and returns false.
+func parsePagination(c *gin.Context) (offset, limit int, ok bool) {
+	o, err := parseOptionalInt(c.Query("offset"))
+	if err != nil || o < 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "offset must be a non-negative integer"})
+		return 0, 0, false
+	}
+	l, err := parseOptionalInt(c.Query("limit"))
+	if err != nil || l < 0 || l > analytics.MaxQueryLimit {
+		c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("limit must be between 1 and %d", analytics.MaxQueryLimit)})
+		return 0, 0, false
+	}
+	if l == 0 {
+		l = analytics.DefaultQueryLimit
+	}
+	return int(o), int(l), true
+}
+
+// paginate returns the bounds of the page at offset of a list of total
+// items, and adds total, offset, limit and next_offset to resp.
+func paginate(resp gin.H, total, offset, limit int) (start, end int) {
+	start, end = offset, total
+	if start > end {
+		start = end
+	}
+	resp["total"], resp["offset"], resp["limit"] = total, offset, limit
+	if start+limit < end {
+		end = start + limit
+		resp["next_offset"] = end
+	}
+	return start, end
+}
+
+// parseRetention parses the duration query parameter param, defaulting to
+// def. On failure it writes the error response and returns false.
+func parseRetention(c *gin.Context, param string, def time.Duration) (time.Duration, bool) {
+	raw := c.Query(param)
+	if raw == "" {
+		return def, true
+	}
+	d, err := time.ParseDuration(raw)
+	if err != nil || d <= 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("invalid %s %q: must be a positive duration", param, raw)})
+		return 0, false
+	}
+	return d, true
+}
+
+// adminTenants returns the tenant named by the tenant query parameter, or
+// every tenant listed by all.
+func adminTenants(c *gin.Context, all func() ([]string, error)) ([]string, error) {
+	if tenant := c.Query("tenant"); tenant != "" {
+		return []string{tenant}, nil
+	}
+	return all()
+}
+
+// parseLogQuery reads the /logs/query criteria from the query string.
+func parseLogQuery(c *gin.Context) (analytics.LogQuery, error) {
+	q := analytics.LogQuery{
+		PathPrefix: c.Query("path_prefix"),
+		Route:      c.Query("route"),
+	}
+	if raw := c.Query("level"); raw != "" {
+		q.Levels = strings.Split(raw, ",")
+	}
+	if raw := c.Query("method"); raw != "" {
+		q.Methods = strings.Split(raw, ",")
+	}
+
+	var err error
+	intParam := func(name string) int64 {
+		value, parseErr := parseOptionalInt(c.Query(name))
+		if parseErr != nil && err == nil {
+			err = fmt.Errorf("invalid %s: %v", name, parseErr)
+		}
+		return value
+	}
+	q.StatusMin = int(intParam("status_min"))
+	q.StatusMax = int(intParam("status_max"))
+	q.MinDuration = intParam("min_duration")
+	q.Offset = int(intParam("offset"))
+	q.Limit = int(intParam("limit"))
+	if err != nil {
+		return q, err
+	}
+
+	for name, dst := range map[string]*time.Time{"from": &q.From, "to": &q.To} {
+		if raw := c.Query(name); raw != "" {
+			t, ok := parser.ParseTimestamp(raw)
+			if !ok {
+				return q, fmt.Errorf("invalid %s %q", name, raw)
+			}
+			*dst = t
+		}
+	}
+	return q, nil
+}
+
+// analysisFields are the top-level fields of a stored analysis that the
+// fields query parameter can select.
+var analysisFields = []string{"id", "tenant", "kind", "created_at", "source", "metrics", "result"}
+
+// parseResultView parses the query parameters selecting part of a stored
+// analysis: category, severity or min_severity, offset and limit, which
+// page through its findings, and fields. Fields are top-level fields or
+// result.<field>; it returns the top-level ones.
+func parseResultView(c *gin.Context) (analytics.ResultView, []string, error) {
+	var view analytics.ResultView
+	var err error
+	if view.Categories, err = analytics.ParseCategories(c.Query("category")); err != nil {
+		return view, nil, err
+	}
+	if view.Severities, err = analytics.ParseSeverities(c.Query("severity"), c.Query("min_severity")); err != nil {
+		return view, nil, err
+	}
+	offset, err := parseOptionalInt(c.Query("offset"))
+	if err != nil || offset < 0 {
+		return view, nil, fmt.Errorf("offset must be a non-negative integer")
+	}
+	limit, err := parseOptionalInt(c.Query("limit"))
+	if err != nil || limit < 0 || limit > analytics.MaxQueryLimit {
+		return view, nil, fmt.Errorf("limit must be between 1 and %d", analytics.MaxQueryLimit)
+	}
+	view.Offset, view.Limit = int(offset), int(limit)
+
+	var fields []string
+	for _, field := range strings.Split(c.Query("fields"), ",") {
+		field = strings.TrimSpace(field)
+		if field == "" {
+			continue
+		}
+		if sub, ok := strings.CutPrefix(field, "result."); ok && sub != "" {
+			view.Fields = append(view.Fields, sub)
+			field = "result"
+		} else if !containsField(analysisFields, field) {
+			return view, nil, fmt.Errorf("unknown field %q, must be one of %s or result.<field>", field, strings.Join(analysisFields, ", "))
+		}
+		if !containsField(fields, field) {
+			fields = append(fields, field)
+		}
+	}
+	return view, fields, nil
+}
+
+func containsField(fields []string, field string) bool {
+	for _, f := range fields {
+		if f == field {
+			return true
+		}
+	}
+	return false
+}
+
+// parseFilters parses the repeatable filter query parameter, e.g.
+// ?filter=metadata.region=eu-west&filter=level!=debug.
+func parseFilters(query url.Values) ([]analytics.Filter, error) {
+	var filters []analytics.Filter
+	for _, expr := range query["filter"] {
+		filter, err := analytics.ParseFilter(expr)
+		if err != nil {
+			return nil, err
+		}
+		filters = append(filters, filter)
+	}
+	return filters, nil
+}
+
+// parseBuckets parses a comma-separated list of histogram bounds in ms,
+// e.g. "100,500,1000". An empty string selects the default buckets.
+func parseBuckets(raw string) ([]int64, error) {
+	if raw == "" {
+		return nil, nil
+	}
+
+	parts := strings.Split(raw, ",")
+	if len(parts) > aggregator.MaxBuckets {
+		return nil, fmt.Errorf("at most %d bucket bounds are allowed, got %d", aggregator.MaxBuckets, len(parts))
+	}
+	var bounds []int64
+	for _, part := range parts {
+		bound, err := strconv.ParseInt(strings.TrimSpace(part), 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("%q is not a number", part)
+		}
+		bounds = append(bounds, bound)
+	}
+
+	if err := aggregator.ValidateBuckets(bounds); err != nil {
+		return nil, err
+	}
+	return bounds, nil
+}
+
+// parseOptionalInt parses a non-negative integer query value, returning 0
+// when it is absent so callers fall back to their defaults.
+func parseOptionalInt(raw string) (int64, error) {
+	if raw == "" {
+		return 0, nil
+	}
+	value, err := strconv.ParseInt(raw, 10, 64)
+	if err != nil || value < 0 {
+		return 0, fmt.Errorf("%q is not a non-negative integer", raw)
+	}
+	return value, nil
+}
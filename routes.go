@@ -0,0 +1,29 @@
+package main
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+// registerRoutes registers every endpoint of the service on router, except
+// the token-protected /tasks and /admin groups, which main registers only
+// when their tokens are configured.
+func registerRoutes(router *gin.Engine) {
+	// Health check endpoint
+	router.GET("/health", func(c *gin.Context) {
+		c.JSON(http.StatusOK, gin.H{
+			"status":  "healthy",
+			"message": "Analytics AI service is running",
+		})
+	})
+
+	registerAnalysisRoutes(router)
+	registerStorageRoutes(router)
+	registerScheduleRoutes(router)
+	registerReportRoutes(router)
+	registerIngestRoutes(router)
+	registerConversationRoutes(router)
+	registerConvertRoutes(router)
+	registerDashboardRoutes(router)
+}
@@ -0,0 +1,386 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"sort"
+	"strconv"
+	"time"
+
+	"analyticsai/ai-service/analytics"
+	"analyticsai/ai-service/analytics/parser"
+	"analyticsai/ai-service/storage"
+
+	"github.com/gin-gonic/gin"
+)
+
+// registerTaskRoutes registers the /tasks endpoints for externally
+// triggered jobs (Cloud Scheduler / Cloud Tasks), authenticated with token.
+func registerTaskRoutes(router *gin.Engine, token string) {
+	tasks := router.Group("/tasks", requireBearerToken(token))
+
+	tasks.POST("/cleanup-uploads", func(c *gin.Context) {
+		retention, ok := parseRetention(c, "retention", uploadRetention)
+		if !ok {
+			return
+		}
+		if retention == 0 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "retention is required when UPLOAD_RETENTION is not set"})
+			return
+		}
+
+		removed, err := uploadStore.Cleanup(retention)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": fmt.Sprintf("cleanup err: %v", err)})
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{"removed": removed})
+	})
+
+	tasks.POST("/cleanup-analyses", requireAnalysisStore, func(c *gin.Context) {
+		retention, ok := parseRetention(c, "retention", analysesRetention)
+		if !ok {
+			return
+		}
+		if retention == 0 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "retention is required when ANALYSES_RETENTION is not set"})
+			return
+		}
+
+		removed, err := analysisStore.Cleanup(retention)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": fmt.Sprintf("cleanup err: %v", err)})
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{"removed": removed})
+	})
+
+	// Cloud Scheduler should call this every minute in Cloud Run mode.
+	tasks.POST("/run-schedules", func(c *gin.Context) {
+		c.JSON(http.StatusOK, gin.H{"ran": schedules.RunDue(c.Request.Context())})
+	})
+}
+
+// registerAdminRoutes registers the /admin endpoints, authenticated with
+// token.
+func registerAdminRoutes(router *gin.Engine, token string) {
+	admin := router.Group("/admin", requireBearerToken(token))
+
+	admin.GET("/tenants/limits", func(c *gin.Context) {
+		c.JSON(http.StatusOK, gin.H{"limits": tenantLimits.All()})
+	})
+
+	admin.GET("/tenants/:tenant/limits", func(c *gin.Context) {
+		c.JSON(http.StatusOK, gin.H{
+			"tenant": c.Param("tenant"),
+			"limits": tenantLimits.Get(c.Param("tenant")),
+			"usage":  quotaMeter.Usage(c.Param("tenant")),
+		})
+	})
+
+	admin.PUT("/tenants/:tenant/limits", func(c *gin.Context) {
+		var limits analytics.Limits
+		if err := c.BindJSON(&limits); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("invalid request body: %v", err)})
+			return
+		}
+
+		if err := tenantLimits.Set(c.Param("tenant"), limits); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("error saving limits: %v", err)})
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{"tenant": c.Param("tenant"), "limits": limits})
+	})
+
+	admin.DELETE("/tenants/:tenant/data", func(c *gin.Context) {
+		receipt, err := deleteTenantData(c.Param("tenant"))
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": fmt.Sprintf("error deleting tenant data: %v", err)})
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{"receipt": receipt})
+	})
+
+	admin.GET("/uploads", func(c *gin.Context) {
+		offset, limit, ok := parsePagination(c)
+		if !ok {
+			return
+		}
+		tenants, err := adminTenants(c, uploadStore.Tenants)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": fmt.Sprintf("error listing uploads: %v", err)})
+			return
+		}
+		var uploads []storage.Upload
+		var size int64
+		for _, tenant := range tenants {
+			list, err := uploadStore.List(tenant)
+			if err != nil {
+				c.JSON(http.StatusInternalServerError, gin.H{"error": fmt.Sprintf("error listing uploads: %v", err)})
+				return
+			}
+			for _, u := range list {
+				size += u.Size
+			}
+			uploads = append(uploads, list...)
+		}
+		sort.Slice(uploads, func(i, j int) bool {
+			return uploads[i].CreatedAt.After(uploads[j].CreatedAt)
+		})
+
+		resp := gin.H{"total_size": size}
+		start, end := paginate(resp, len(uploads), offset, limit)
+		resp["uploads"] = append([]storage.Upload{}, uploads[start:end]...)
+		c.JSON(http.StatusOK, resp)
+	})
+
+	admin.DELETE("/uploads/:tenant/:id", func(c *gin.Context) {
+		deleteUpload(c, c.Param("tenant"), c.Param("id"))
+	})
+
+	admin.GET("/analyses", requireAnalysisStore, func(c *gin.Context) {
+		offset, limit, ok := parsePagination(c)
+		if !ok {
+			return
+		}
+		tenants, err := adminTenants(c, analysisStore.Tenants)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": fmt.Sprintf("error listing analyses: %v", err)})
+			return
+		}
+		var analyses []storage.Analysis
+		var size int64
+		for _, tenant := range tenants {
+			list, err := analysisStore.List(tenant, c.Query("kind"))
+			if err != nil {
+				c.JSON(http.StatusInternalServerError, gin.H{"error": fmt.Sprintf("error listing analyses: %v", err)})
+				return
+			}
+			for _, a := range list {
+				size += a.Size
+			}
+			analyses = append(analyses, list...)
+		}
+		sort.Slice(analyses, func(i, j int) bool {
+			return analyses[i].CreatedAt.After(analyses[j].CreatedAt)
+		})
+
+		resp := gin.H{"total_size": size}
+		start, end := paginate(resp, len(analyses), offset, limit)
+		resp["analyses"] = append([]storage.Analysis{}, analyses[start:end]...)
+		c.JSON(http.StatusOK, resp)
+	})
+
+	admin.DELETE("/analyses/:tenant/:id", requireAnalysisStore, func(c *gin.Context) {
+		tenant, id := c.Param("tenant"), c.Param("id")
+		err := analysisStore.Delete(tenant, id)
+		if errors.Is(err, storage.ErrNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": fmt.Sprintf("analysis %q not found", id)})
+			return
+		}
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": fmt.Sprintf("error deleting analysis: %v", err)})
+			return
+		}
+
+		receipt, err := storage.NewDeletionReceipt(tenant, "analysis")
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": fmt.Sprintf("error creating receipt: %v", err)})
+			return
+		}
+		receipt.Analyses = append(receipt.Analyses, id)
+		log.Printf("Deletion %s: tenant %q analysis %s", receipt.ReceiptID, tenant, id)
+		c.JSON(http.StatusOK, gin.H{"receipt": receipt})
+	})
+
+	// Runs the upload cleanup now rather than at the next hourly run,
+	// and prunes stored analyses when analyses_retention or
+	// ANALYSES_RETENTION is set. Uploads are kept when neither retention
+	// nor UPLOAD_RETENTION is set.
+	admin.POST("/cleanup", func(c *gin.Context) {
+		retention, ok := parseRetention(c, "retention", uploadRetention)
+		if !ok {
+			return
+		}
+		analysesRetention, ok := parseRetention(c, "analyses_retention", analysesRetention)
+		if !ok {
+			return
+		}
+
+		resp := gin.H{}
+		if retention > 0 {
+			removed, err := uploadStore.Cleanup(retention)
+			if err != nil {
+				c.JSON(http.StatusInternalServerError, gin.H{"error": fmt.Sprintf("cleanup err: %v", err)})
+				return
+			}
+			resp["uploads_removed"] = removed
+		}
+		if analysesRetention > 0 && analysisStore != nil {
+			removed, err := analysisStore.Cleanup(analysesRetention)
+			if err != nil {
+				c.JSON(http.StatusInternalServerError, gin.H{"error": fmt.Sprintf("cleanup err: %v", err)})
+				return
+			}
+			resp["analyses_removed"] = removed
+		}
+		log.Printf("Admin cleanup: %v", resp)
+		c.JSON(http.StatusOK, resp)
+	})
+
+	admin.GET("/audit", requireAuditLog, func(c *gin.Context) {
+		offset, limit, ok := parsePagination(c)
+		if !ok {
+			return
+		}
+		q := storage.AuditQuery{Tenant: c.Query("tenant"), PathPrefix: c.Query("path")}
+		if q.From, q.To, ok = parseTimeRange(c); !ok {
+			return
+		}
+		if q.From.IsZero() {
+			q.From = time.Now().Add(-24 * time.Hour)
+			if !q.To.IsZero() {
+				q.From = q.To.Add(-24 * time.Hour)
+			}
+		}
+		if raw := c.Query("status"); raw != "" {
+			status, err := strconv.Atoi(raw)
+			if err != nil {
+				c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("invalid status %q", raw)})
+				return
+			}
+			q.Status = status
+		}
+
+		records, truncated, err := auditLog.Query(q)
+		if errors.Is(err, storage.ErrAuditQueryRange) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": fmt.Sprintf("error reading audit log: %v", err)})
+			return
+		}
+		resp := gin.H{"from": q.From.UTC(), "truncated": truncated}
+		start, end := paginate(resp, len(records), offset, limit)
+		resp["records"] = records[start:end]
+		c.JSON(http.StatusOK, resp)
+	})
+
+	admin.GET("/usage", requireAuditLog, func(c *gin.Context) {
+		from, to, ok := parseUsagePeriod(c)
+		if !ok {
+			return
+		}
+		usage, err := usageReports(storage.AuditQuery{From: from, To: to, Tenant: c.Query("tenant")})
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": fmt.Sprintf("error reporting usage: %v", err)})
+			return
+		}
+		var cost float64
+		for _, u := range usage {
+			cost += u.EstimatedCostUSD
+		}
+		c.JSON(http.StatusOK, gin.H{"from": from, "to": to, "tenants": usage, "estimated_cost_usd": cost})
+	})
+
+	admin.GET("/kafka", func(c *gin.Context) {
+		if kafkaConsumer == nil {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Kafka ingestion is not enabled"})
+			return
+		}
+		resp := gin.H{"tenant": kafkaTenant, "consumer": kafkaConsumer.Status()}
+		if buffer := logBuffers.Get(kafkaTenant, kafkaBufferName); buffer != nil {
+			resp["buffer"] = buffer.Stats()
+		}
+		c.JSON(http.StatusOK, resp)
+	})
+
+	admin.GET("/mappings", func(c *gin.Context) {
+		c.JSON(http.StatusOK, gin.H{"mappings": fieldMappings.All()})
+	})
+
+	admin.PUT("/mappings/:name", func(c *gin.Context) {
+		var mapping parser.FieldMapping
+		if err := c.BindJSON(&mapping); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("invalid request body: %v", err)})
+			return
+		}
+
+		if err := fieldMappings.Set(c.Param("name"), mapping); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("error saving field mapping: %v", err)})
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{"name": c.Param("name"), "mapping": mapping})
+	})
+
+	admin.GET("/prompts", func(c *gin.Context) {
+		c.JSON(http.StatusOK, gin.H{"prompts": prompts.List()})
+	})
+
+	admin.GET("/prompts/:name", func(c *gin.Context) {
+		tmpl, ok := prompts.Get(c.Param("name"))
+		if !ok {
+			c.JSON(http.StatusNotFound, gin.H{"error": fmt.Sprintf("prompt %q not found", c.Param("name"))})
+			return
+		}
+		c.JSON(http.StatusOK, tmpl)
+	})
+
+	admin.PUT("/prompts/:name", func(c *gin.Context) {
+		var req struct {
+			Text    string `json:"text"`
+			Comment string `json:"comment"`
+		}
+		if err := c.BindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("invalid request body: %v", err)})
+			return
+		}
+		tmpl, err := prompts.Update(c.Param("name"), req.Text, req.Comment)
+		if err != nil {
+			respondAnalysisError(c, "error saving prompt", err)
+			return
+		}
+		c.JSON(http.StatusOK, tmpl)
+	})
+
+	admin.POST("/prompts/:name/rollback", func(c *gin.Context) {
+		var req struct {
+			Version int `json:"version"`
+		}
+		if err := c.BindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("invalid request body: %v", err)})
+			return
+		}
+		tmpl, err := prompts.Rollback(c.Param("name"), req.Version)
+		if err != nil {
+			respondAnalysisError(c, "error rolling back prompt", err)
+			return
+		}
+		c.JSON(http.StatusOK, tmpl)
+	})
+
+	admin.POST("/prompts/:name/preview", func(c *gin.Context) {
+		var req struct {
+			Text   string            `json:"text"`
+			Params map[string]string `json:"params"`
+			Data   string            `json:"data"`
+		}
+		if err := c.BindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("invalid request body: %v", err)})
+			return
+		}
+		prompt, err := prompts.Preview(c.Param("name"), req.Text, req.Params, req.Data)
+		if err != nil {
+			respondAnalysisError(c, "error previewing prompt", err)
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{"prompt": prompt})
+	})
+}
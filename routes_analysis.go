@@ -0,0 +1,476 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"sync"
+
+	"analyticsai/ai-service/analytics"
+	"analyticsai/ai-service/analytics/aggregator"
+
+	"github.com/gin-gonic/gin"
+)
+
+// registerAnalysisRoutes registers the /analyze, /stats and /forecast
+// endpoints, which analyze the posted logs or an upload, and /logs/query.
+func registerAnalysisRoutes(router *gin.Engine) {
+	// Log analysis endpoint
+	router.POST("/analyze/logs", applyTenantLimits, func(c *gin.Context) {
+		logs, opts, ok := bindLogs(c)
+		if !ok {
+			return
+		}
+		serveAnalysis(c, "logs", logs, opts)
+	})
+
+	// Performance analysis endpoint
+	router.POST("/analyze/performance", applyTenantLimits, func(c *gin.Context) {
+		logs, opts, ok := bindLogs(c)
+		if !ok {
+			return
+		}
+		serveAnalysis(c, "performance", logs, opts)
+	})
+
+	// SLO / error-budget endpoint
+	router.POST("/analyze/slo", applyTenantLimits, func(c *gin.Context) {
+		var req struct {
+			aggregator.SLOTarget
+			Logs []analytics.LogEntry `json:"logs"`
+		}
+		if err := c.BindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("invalid request body: %v", err)})
+			return
+		}
+
+		buffer, ok := requestBuffer(c)
+		if !ok {
+			return
+		}
+		if buffer != nil {
+			req.Logs = buffer.Entries()
+		}
+		if req.Logs, _, ok = prepareLogs(c, req.Logs); !ok {
+			return
+		}
+		if err := req.SLOTarget.Validate(); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("invalid SLO target: %v", err)})
+			return
+		}
+
+		report, err := analyticsService.AnalyzeSLO(c.Request.Context(), req.Logs, req.SLOTarget)
+		if err != nil {
+			respondAnalysisError(c, "error generating analysis", err)
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{"slo": report})
+	})
+
+	// Error clustering endpoint
+	router.POST("/analyze/errors", applyTenantLimits, func(c *gin.Context) {
+		logs, opts, ok := bindLogs(c)
+		if !ok {
+			return
+		}
+		serveAnalysis(c, "errors", logs, opts)
+	})
+
+	// Root-cause correlation endpoint
+	router.POST("/analyze/root-cause", applyTenantLimits, func(c *gin.Context) {
+		logs, opts, ok := bindLogs(c)
+		if !ok {
+			return
+		}
+		serveAnalysis(c, "root-cause", logs, opts)
+	})
+
+	// Service dependency graph endpoint. The DOT rendering is the graph
+	// alone, so it makes no Gemini call.
+	router.POST("/analyze/dependencies", applyTenantLimits, func(c *gin.Context) {
+		logs, opts, ok := bindLogs(c)
+		if !ok {
+			return
+		}
+
+		switch c.Query("format") {
+		case "dot":
+			if err := analytics.CheckEntryLimit(c.Request.Context(), len(logs)); err != nil {
+				respondAnalysisError(c, "error building dependency graph", err)
+				return
+			}
+			c.Data(http.StatusOK, "text/vnd.graphviz", aggregator.BuildDependencyGraph(logs, opts.Interval).DOT())
+		case "", "json":
+			serveAnalysis(c, "dependencies", logs, opts)
+		default:
+			c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("unsupported format %q", c.Query("format"))})
+		}
+	})
+
+	// Security analysis endpoint
+	router.POST("/analyze/security", applyTenantLimits, func(c *gin.Context) {
+		logs, opts, ok := bindLogs(c)
+		if !ok {
+			return
+		}
+		serveAnalysis(c, "security", logs, opts)
+	})
+
+	// SEO health endpoint: 404 clusters, redirect chains, errors on indexed
+	// pages and crawler activity
+	router.POST("/analyze/seo", applyTenantLimits, func(c *gin.Context) {
+		logs, ok := decodeLogs(c)
+		if !ok {
+			return
+		}
+		opts, err := kindOptions(tenantID(c), "seo", c.Request.URL.Query())
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		logs, opts, ok = preprocessLogs(c, logs, opts)
+		if !ok {
+			return
+		}
+		serveAnalysis(c, "seo", logs, opts)
+	})
+
+	// Per-client threat scoring endpoint
+	router.POST("/analyze/clients", applyTenantLimits, func(c *gin.Context) {
+		logs, opts, ok := bindLogs(c)
+		if !ok {
+			return
+		}
+
+		switch format := c.Query("format"); format {
+		case "nginx", "cloud-armor":
+			if err := analytics.CheckEntryLimit(c.Request.Context(), len(logs)); err != nil {
+				respondAnalysisError(c, "error scoring clients", err)
+				return
+			}
+			minScore := aggregator.BlockScore
+			if raw := c.Query("min_score"); raw != "" {
+				score, err := strconv.ParseFloat(raw, 64)
+				if err != nil || score < 0 || score > 100 {
+					c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("invalid min_score %q", raw)})
+					return
+				}
+				minScore = score
+			}
+			scores := aggregator.ScoreClients(logs)
+			if format == "nginx" {
+				c.Header("Content-Disposition", "attachment; filename=deny.conf")
+				c.Data(http.StatusOK, "text/plain", aggregator.NginxDenyList(scores, minScore))
+				return
+			}
+			c.JSON(http.StatusOK, gin.H{"rules": aggregator.CloudArmorRules(scores, minScore)})
+		case "", "json":
+			serveAnalysis(c, "clients", logs, opts)
+		default:
+			c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("unsupported format %q", format)})
+		}
+	})
+
+	// User journey endpoint
+	router.POST("/analyze/journeys", applyTenantLimits, func(c *gin.Context) {
+		logs, opts, ok := bindLogs(c)
+		if !ok {
+			return
+		}
+		serveAnalysis(c, "journeys", logs, opts)
+	})
+
+	// Funnel analysis endpoint
+	router.POST("/analyze/funnel", applyTenantLimits, func(c *gin.Context) {
+		var req aggregator.FunnelRequest
+		if err := c.BindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("invalid request body: %v", err)})
+			return
+		}
+
+		buffer, ok := requestBuffer(c)
+		if !ok {
+			return
+		}
+		if buffer != nil {
+			req.Logs = buffer.Entries()
+		}
+		if req.Logs, _, ok = prepareLogs(c, req.Logs); !ok {
+			return
+		}
+
+		report, err := analyticsService.AnalyzeFunnel(c.Request.Context(), req)
+		if err != nil {
+			respondAnalysisError(c, "error generating analysis", err)
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{"funnel": report})
+	})
+
+	// Before/after comparison endpoint
+	router.POST("/analyze/compare", applyTenantLimits, func(c *gin.Context) {
+		var req aggregator.CompareRequest
+		if err := c.BindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("invalid request body: %v", err)})
+			return
+		}
+
+		var ok bool
+		if req.Before, _, ok = prepareLogs(c, req.Before); !ok {
+			return
+		}
+		if req.After, _, ok = prepareLogs(c, req.After); !ok {
+			return
+		}
+
+		report, err := analyticsService.AnalyzeComparison(c.Request.Context(), req)
+		if err != nil {
+			respondAnalysisError(c, "error generating analysis", err)
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{"comparison": report})
+	})
+
+	// Capacity planning endpoint
+	router.POST("/analyze/capacity", applyTenantLimits, func(c *gin.Context) {
+		logs, opts, ok := bindLogs(c)
+		if !ok {
+			return
+		}
+		serveAnalysis(c, "capacity", logs, opts)
+	})
+
+	// Traffic forecasting endpoint
+	router.POST("/forecast", applyTenantLimits, func(c *gin.Context) {
+		logs, opts, ok := bindLogs(c)
+		if !ok {
+			return
+		}
+
+		forecast := aggregator.ForecastOptions{Interval: opts.Interval, Location: opts.Location}
+		days, err := parseOptionalInt(c.Query("days"))
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("invalid days: %v", err)})
+			return
+		}
+		forecast.Days = int(days)
+		if raw := c.Query("confidence"); raw != "" {
+			if forecast.Confidence, err = strconv.ParseFloat(raw, 64); err != nil {
+				c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("invalid confidence %q", raw)})
+				return
+			}
+		}
+
+		report, err := analyticsService.ForecastTraffic(c.Request.Context(), logs, forecast)
+		if err != nil {
+			respondAnalysisError(c, "error generating forecast", err)
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{"forecast": report})
+	})
+
+	// Status code breakdown endpoint
+	router.POST("/stats/status", applyTenantLimits, func(c *gin.Context) {
+		logs, opts, ok := bindLogs(c)
+		if !ok {
+			return
+		}
+		if err := analytics.CheckEntryLimit(c.Request.Context(), len(logs)); err != nil {
+			respondAnalysisError(c, "error computing stats", err)
+			return
+		}
+
+		report, err := aggregator.BreakdownStatus(logs, opts.Interval)
+		if err != nil {
+			respondAnalysisError(c, "error computing stats", err)
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{"status": report})
+	})
+
+	// Top-N endpoint ranking
+	router.POST("/stats/top", applyTenantLimits, func(c *gin.Context) {
+		logs, opts, ok := bindLogs(c)
+		if !ok {
+			return
+		}
+		if err := analytics.CheckEntryLimit(c.Request.Context(), len(logs)); err != nil {
+			respondAnalysisError(c, "error computing stats", err)
+			return
+		}
+
+		n, err := parseOptionalInt(c.Query("n"))
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("invalid n: %v", err)})
+			return
+		}
+		if n == 0 {
+			n = 20
+		}
+
+		by := c.DefaultQuery("by", aggregator.RankByTraffic)
+		ranked, err := aggregator.TopEndpoints(logs, opts.GroupBy, by, int(n))
+		if err != nil {
+			respondAnalysisError(c, "error computing stats", err)
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{"by": by, "group_by": opts.GroupBy.String(), "endpoints": ranked})
+	})
+
+	// Message template mining endpoint
+	router.POST("/stats/templates", applyTenantLimits, func(c *gin.Context) {
+		logs, _, ok := bindLogs(c)
+		if !ok {
+			return
+		}
+		if err := analytics.CheckEntryLimit(c.Request.Context(), len(logs)); err != nil {
+			respondAnalysisError(c, "error computing stats", err)
+			return
+		}
+
+		n, err := parseOptionalInt(c.Query("n"))
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("invalid n: %v", err)})
+			return
+		}
+		if n == 0 {
+			n = 50
+		}
+
+		report := aggregator.MineTemplates(logs)
+		if int(n) < len(report.Templates) {
+			report.Templates = report.Templates[:n]
+		}
+
+		c.JSON(http.StatusOK, gin.H{"templates": report})
+	})
+
+	// Traffic heatmap endpoint
+	router.POST("/stats/heatmap", applyTenantLimits, func(c *gin.Context) {
+		logs, opts, ok := bindLogs(c)
+		if !ok {
+			return
+		}
+
+		heatmap, err := analyticsService.AnalyzeHeatmap(c.Request.Context(), logs, opts.Location)
+		if err != nil {
+			respondAnalysisError(c, "error generating analysis", err)
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{"heatmap": heatmap})
+	})
+
+	// Log query endpoint for drilling into the entries behind an insight.
+	// Logs come from the request body or, with ?upload=, a file saved by
+	// /upload.
+	router.POST("/logs/query", applyTenantLimits, func(c *gin.Context) {
+		var logs []analytics.LogEntry
+		if name := c.Query("upload"); name != "" {
+			var ok bool
+			if logs, ok = loadUpload(c, name); !ok {
+				return
+			}
+		} else {
+			var ok bool
+			if logs, ok = decodeLogs(c); !ok {
+				return
+			}
+		}
+		if err := analytics.CheckEntryLimit(c.Request.Context(), len(logs)); err != nil {
+			respondAnalysisError(c, "error querying logs", err)
+			return
+		}
+
+		opts, err := parseAnalysisOptions(tenantID(c), c.Request.URL.Query())
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		// Return entries as logged; use route= to match a normalized path.
+		opts.NormalizePaths = c.Query("normalize_paths") == "true"
+		logs, _, ok := preprocessLogs(c, logs, opts)
+		if !ok {
+			return
+		}
+
+		query, err := parseLogQuery(c)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		result, err := analytics.QueryLogs(logs, query)
+		if err != nil {
+			respondAnalysisError(c, "error querying logs", err)
+			return
+		}
+
+		c.JSON(http.StatusOK, result)
+	})
+
+	// Batch analysis: one /analyze/<kind> result per named log set, run
+	// through the shared batch worker pool
+	router.POST("/analyze/batch", func(c *gin.Context) {
+		kind := c.DefaultQuery("kind", "logs")
+		if !isAnalysisKind(kind) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("invalid kind %q", kind)})
+			return
+		}
+		var sets map[string]json.RawMessage
+		if err := c.BindJSON(&sets); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("invalid request body: %v", err)})
+			return
+		}
+		if len(sets) == 0 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "no log sets in request body"})
+			return
+		}
+		if len(sets) > maxBatchSets {
+			c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("at most %d log sets per request, got %d", maxBatchSets, len(sets))})
+			return
+		}
+
+		ctx, tenant, query := c.Request.Context(), tenantID(c), c.Request.URL.Query()
+		results := make(map[string]batchResult, len(sets))
+		var mu sync.Mutex
+		var wg sync.WaitGroup
+		for name, body := range sets {
+			wg.Add(1)
+			go func(name string, body []byte) {
+				defer wg.Done()
+				var result batchResult
+				select {
+				case batchWorkers <- struct{}{}:
+					result = runBatchSet(ctx, tenant, query, kind, name, body)
+					<-batchWorkers
+				case <-ctx.Done():
+					result = batchResult{Status: http.StatusServiceUnavailable, Error: ctx.Err().Error()}
+				}
+				mu.Lock()
+				results[name] = result
+				mu.Unlock()
+			}(name, body)
+		}
+		wg.Wait()
+
+		succeeded := 0
+		for _, result := range results {
+			if result.Status == http.StatusOK {
+				succeeded++
+			}
+		}
+		c.JSON(http.StatusOK, gin.H{
+			"kind":      kind,
+			"results":   results,
+			"succeeded": succeeded,
+			"failed":    len(results) - succeeded,
+		})
+	})
+}
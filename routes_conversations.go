@@ -0,0 +1,153 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+
+	"analyticsai/ai-service/analytics"
+	"analyticsai/ai-service/storage"
+
+	"github.com/gin-gonic/gin"
+)
+
+// registerConversationRoutes registers the follow-up conversation and
+// semantic search endpoints.
+func registerConversationRoutes(router *gin.Engine) {
+	// Conversation endpoints: follow-up questions about an analysis, of the
+	// posted logs or a stored one, answered with the previous turns as
+	// context
+	router.POST("/conversations", applyTenantLimits, func(c *gin.Context) {
+		r, ok := analyzeForReport(c)
+		if !ok {
+			return
+		}
+		conv, err := conversations.Create(tenantID(c), "", analytics.ConversationContext(r.Analysis, r.Metrics))
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusCreated, gin.H{"conversation": conv, "analysis": r.Analysis})
+	})
+
+	router.POST("/analyses/:id/conversations", requireAnalysisStore, func(c *gin.Context) {
+		stored, err := analysisStore.Get(tenantID(c), c.Param("id"))
+		if errors.Is(err, storage.ErrNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": fmt.Sprintf("analysis %q not found", c.Param("id"))})
+			return
+		}
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": fmt.Sprintf("error reading analysis: %v", err)})
+			return
+		}
+		metrics, _ := storedMetrics(stored)
+		// Performance analyses are discussed from their metrics alone.
+		var analysis *analytics.AnalysisResult
+		if stored.Kind == "logs" {
+			analysis = &analytics.AnalysisResult{}
+			if err := json.Unmarshal(stored.Result, analysis); err != nil {
+				c.JSON(http.StatusInternalServerError, gin.H{"error": fmt.Sprintf("error reading analysis: %v", err)})
+				return
+			}
+		}
+		conv, err := conversations.Create(stored.Tenant, stored.ID, analytics.ConversationContext(analysis, metrics))
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusCreated, gin.H{"conversation": conv})
+	})
+
+	router.GET("/conversations/:id", func(c *gin.Context) {
+		conv, ok := conversations.Get(tenantID(c), c.Param("id"))
+		if !ok {
+			c.JSON(http.StatusNotFound, gin.H{"error": fmt.Sprintf("conversation %q not found or expired", c.Param("id"))})
+			return
+		}
+		c.JSON(http.StatusOK, conv)
+	})
+
+	router.POST("/conversations/:id/messages", applyTenantLimits, func(c *gin.Context) {
+		var req struct {
+			Question string `json:"question"`
+		}
+		if err := c.BindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("invalid request body: %v", err)})
+			return
+		}
+		tenant := tenantID(c)
+		conv, ok := conversations.Get(tenant, c.Param("id"))
+		if !ok {
+			c.JSON(http.StatusNotFound, gin.H{"error": fmt.Sprintf("conversation %q not found or expired", c.Param("id"))})
+			return
+		}
+		turn, err := analyticsService.Ask(c.Request.Context(), conv, req.Question)
+		if err != nil {
+			respondAnalysisError(c, "error answering question", err)
+			return
+		}
+		if conv, ok = conversations.AddTurn(tenant, conv.ID, *turn); !ok {
+			c.JSON(http.StatusNotFound, gin.H{"error": fmt.Sprintf("conversation %q expired", c.Param("id"))})
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{"turn": turn, "expires_at": conv.ExpiresAt})
+	})
+
+	router.DELETE("/conversations/:id", func(c *gin.Context) {
+		if !conversations.Delete(tenantID(c), c.Param("id")) {
+			c.JSON(http.StatusNotFound, gin.H{"error": fmt.Sprintf("conversation %q not found or expired", c.Param("id"))})
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{"deleted": c.Param("id")})
+	})
+
+	// Semantic search endpoints: log message templates and the findings of
+	// stored analyses, embedded with Gemini and searched by meaning
+	router.POST("/search/index", applyTenantLimits, func(c *gin.Context) {
+		logs, ok := decodeLogs(c)
+		if !ok {
+			return
+		}
+		summary, err := analyticsService.IndexLogs(c.Request.Context(), semanticIndex, tenantID(c), logs)
+		if err != nil {
+			respondAnalysisError(c, "error indexing logs", err)
+			return
+		}
+		c.JSON(http.StatusOK, summary)
+	})
+
+	router.POST("/search/semantic", applyTenantLimits, func(c *gin.Context) {
+		var q analytics.SemanticQuery
+		if err := c.BindJSON(&q); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("invalid request body: %v", err)})
+			return
+		}
+		matches, err := analyticsService.SemanticSearch(c.Request.Context(), semanticIndex, tenantID(c), q)
+		if err != nil {
+			respondAnalysisError(c, "error searching", err)
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{"query": q.Query, "matches": matches})
+	})
+
+	router.PUT("/search/issues/:id/resolution", func(c *gin.Context) {
+		var req struct {
+			Resolution string `json:"resolution"`
+		}
+		if err := c.BindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("invalid request body: %v", err)})
+			return
+		}
+		doc, ok, err := semanticIndex.Resolve(tenantID(c), c.Param("id"), req.Resolution)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": fmt.Sprintf("error recording resolution: %v", err)})
+			return
+		}
+		if !ok {
+			c.JSON(http.StatusNotFound, gin.H{"error": fmt.Sprintf("issue %q not found", c.Param("id"))})
+			return
+		}
+		c.JSON(http.StatusOK, doc)
+	})
+}
@@ -0,0 +1,194 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+
+	"analyticsai/ai-service/analytics"
+	"analyticsai/ai-service/analytics/aggregator"
+	"analyticsai/ai-service/analytics/parser"
+	"analyticsai/ai-service/export"
+
+	"github.com/gin-gonic/gin"
+)
+
+// registerConvertRoutes registers the /convert endpoints, which export logs
+// to other formats and import them from CSV.
+func registerConvertRoutes(router *gin.Engine) {
+	// CSV conversion endpoint
+	router.POST("/convert/to-csv", func(c *gin.Context) {
+		var logs []analytics.LogEntry
+		if err := c.BindJSON(&logs); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("invalid request body: %v", err)})
+			return
+		}
+
+		// Only filtering applies here; the CSV keeps paths as logged.
+		filters, err := parseFilters(c.Request.URL.Query())
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		if logs, _, err = analytics.Preprocess(logs, analytics.PreprocessOptions{Filters: filters}); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		var opts export.CSVOptions
+		if opts.Columns, err = parser.ParseFields(c.Query("columns")); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		// metadata_columns predates columns and names the metadata keys to
+		// add after the standard fields.
+		if raw := c.Query("metadata_columns"); raw != "" && len(opts.Columns) == 0 {
+			opts.Columns = []string{"timestamp", "level", "message", "path", "method", "duration", "status"}
+			for _, key := range strings.Split(raw, ",") {
+				opts.Columns = append(opts.Columns, aggregator.MetadataColumn(key))
+			}
+		}
+		if opts.Delimiter, err = parser.ParseDelimiter(c.Query("delimiter")); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		csvData, err := export.CSV(logs, opts)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": fmt.Sprintf("error converting to CSV: %v", err)})
+			return
+		}
+
+		c.Header("Content-Disposition", "attachment; filename=analytics.csv")
+		c.Data(http.StatusOK, "text/csv", csvData)
+	})
+
+	// CSV import endpoint, the reverse of /convert/to-csv. The CSV is the
+	// request body or a multipart "file".
+	router.POST("/convert/from-csv", func(c *gin.Context) {
+		var delimiter rune // detected when not given
+		var err error
+		if raw := c.Query("delimiter"); raw != "" {
+			if delimiter, err = parser.ParseDelimiter(raw); err != nil {
+				c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+				return
+			}
+		}
+
+		var data []byte
+		if file, ferr := c.FormFile("file"); ferr == nil {
+			data, err = readFormFile(file)
+		} else {
+			data, err = c.GetRawData()
+		}
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("invalid request body: %v", err)})
+			return
+		}
+
+		logs, err := parser.ParseCSV(data, delimiter)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("error parsing CSV: %v", err)})
+			return
+		}
+		c.JSON(http.StatusOK, logs)
+	})
+
+	// Excel conversion endpoint. Unless ai=false the logs are also analysed
+	// for the Insights sheet.
+	router.POST("/convert/to-xlsx", applyTenantLimits, func(c *gin.Context) {
+		logs, opts, ok := bindLogs(c)
+		if !ok {
+			return
+		}
+
+		var metadataColumns []string
+		if raw := c.Query("metadata_columns"); raw != "" {
+			metadataColumns = strings.Split(raw, ",")
+		}
+
+		var analysis *analytics.AnalysisResult
+		var err error
+		if c.Query("ai") != "false" {
+			analysis, err = analyticsService.AnalyzeLogs(c.Request.Context(), logs, opts)
+			if err != nil {
+				respondAnalysisError(c, "error generating analysis", err)
+				return
+			}
+		}
+
+		data, err := export.XLSX(logs, metadataColumns, analysis)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": fmt.Sprintf("error converting to XLSX: %v", err)})
+			return
+		}
+
+		c.Header("Content-Disposition", "attachment; filename=analytics.xlsx")
+		c.Data(http.StatusOK, "application/vnd.openxmlformats-officedocument.spreadsheetml.sheet", data)
+	})
+
+	// Parquet conversion endpoint. Metadata keys become columns: those in
+	// metadata_columns, or every key found in the logs.
+	router.POST("/convert/to-parquet", func(c *gin.Context) {
+		var logs []analytics.LogEntry
+		if err := c.BindJSON(&logs); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("invalid request body: %v", err)})
+			return
+		}
+
+		filters, err := parseFilters(c.Request.URL.Query())
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		if logs, _, err = analytics.Preprocess(logs, analytics.PreprocessOptions{Filters: filters}); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		metadataColumns := aggregator.MetadataKeys(logs)
+		if raw := c.Query("metadata_columns"); raw != "" {
+			metadataColumns = strings.Split(raw, ",")
+		}
+
+		data, err := export.Parquet(logs, metadataColumns)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": fmt.Sprintf("error converting to Parquet: %v", err)})
+			return
+		}
+
+		c.Header("Content-Disposition", "attachment; filename=analytics.parquet")
+		c.Data(http.StatusOK, "application/vnd.apache.parquet", data)
+	})
+
+	// NDJSON conversion endpoint. The body, a JSON array or NDJSON, is read
+	// and written back one entry at a time rather than held in memory.
+	router.POST("/convert/to-ndjson", func(c *gin.Context) {
+		filters, err := parseFilters(c.Request.URL.Query())
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		fields, err := parser.ParseFields(c.Query("fields"))
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		c.Header("Content-Type", "application/x-ndjson")
+		written, err := analyticsService.StreamNDJSON(c.Request.Body, c.Writer, filters, fields)
+		if err == nil {
+			return
+		}
+		if written == 0 && !c.Writer.Written() {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		// The status line is already out; end the stream with the error.
+		log.Printf("Error streaming NDJSON after %d entries: %v", written, err)
+		line, _ := json.Marshal(gin.H{"error": err.Error()})
+		c.Writer.Write(append(line, '\n'))
+	})
+}
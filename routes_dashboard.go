@@ -0,0 +1,140 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"time"
+
+	"analyticsai/ai-service/analytics"
+	"analyticsai/ai-service/dashboard"
+	"analyticsai/ai-service/storage"
+
+	"github.com/gin-gonic/gin"
+)
+
+// registerDashboardRoutes registers the built-in dashboard and the
+// WebSocket it runs analyses over.
+func registerDashboardRoutes(router *gin.Engine) {
+	// Built-in dashboard, for using the service without a separate frontend
+	router.GET("/dashboard", func(c *gin.Context) {
+		c.Redirect(http.StatusMovedPermanently, "/dashboard/")
+	})
+
+	router.GET("/dashboard/*filepath", gin.WrapH(http.StripPrefix("/dashboard", dashboard.Handler())))
+
+	// Analysis over a WebSocket, for the dashboard: the client sends an
+	// analysis request and then the file, and the service pushes progress
+	// until it sends the result. Browsers cannot set headers on WebSocket
+	// handshakes, so the API key comes with the request message.
+	router.GET("/ws/analyze", func(c *gin.Context) {
+		// Recorded for the audit log unless the handshake fails, in which
+		// case Upgrade has answered with its status.
+		c.Status(http.StatusSwitchingProtocols)
+		conn, err := dashboard.Upgrade(c.Writer, c.Request)
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		sendError := func(status int, format string, args ...interface{}) {
+			conn.WriteJSON(gin.H{"type": "error", "status": status, "error": fmt.Sprintf(format, args...)})
+		}
+
+		var start struct {
+			APIKey   string `json:"api_key"`
+			Tenant   string `json:"tenant"`
+			Kind     string `json:"kind"`
+			Filename string `json:"filename"`
+			Query    string `json:"query"`
+		}
+		// Until the client has authenticated, it gets a few seconds to send
+		// a small request. Messages over the read limit close the connection
+		// with status 1009.
+		conn.SetReadLimit(maxDashboardRequest)
+		conn.SetReadDeadline(time.Now().Add(dashboardRequestWait))
+		messageType, data, err := conn.ReadMessage()
+		if err != nil {
+			return
+		}
+		if messageType != dashboard.TextMessage || json.Unmarshal(data, &start) != nil {
+			sendError(http.StatusBadRequest, "first message must be a JSON analysis request")
+			return
+		}
+		if start.Kind == "" {
+			start.Kind = "logs"
+		}
+		if !isAnalysisKind(start.Kind) {
+			sendError(http.StatusBadRequest, "invalid kind %q", start.Kind)
+			return
+		}
+		query, err := url.ParseQuery(start.Query)
+		if err != nil {
+			sendError(http.StatusBadRequest, "invalid query: %v", err)
+			return
+		}
+		// Authenticate as authenticateTenant would, before the file is
+		// uploaded.
+		tenant := analytics.DefaultTenant
+		if tenantRegistry != nil {
+			var ok bool
+			if tenant, ok = tenantRegistry.Authenticate(start.APIKey); !ok {
+				sendError(http.StatusUnauthorized, "missing or invalid API key")
+				return
+			}
+			if start.Tenant != "" && start.Tenant != tenant {
+				sendError(http.StatusForbidden, "API key does not belong to tenant %q", start.Tenant)
+				return
+			}
+		}
+
+		conn.SetReadLimit(maxDashboardUpload)
+		conn.SetReadDeadline(time.Now().Add(dashboardUploadWait))
+		_, data, err = conn.ReadMessage()
+		if err != nil {
+			return
+		}
+		conn.WriteJSON(gin.H{"type": "progress", "stage": "received", "detail": fmt.Sprintf("%d bytes", len(data))})
+
+		// Stop the analysis if the client goes away. Anything else it sends
+		// is ignored.
+		conn.SetReadLimit(maxDashboardRequest)
+		conn.SetReadDeadline(time.Time{})
+		ctx, cancel := context.WithCancel(c.Request.Context())
+		defer cancel()
+		go func() {
+			for {
+				if _, _, err := conn.ReadMessage(); err != nil {
+					cancel()
+					return
+				}
+			}
+		}()
+		ctx = analytics.WithProgress(ctx, func(stage, detail string) {
+			conn.WriteJSON(gin.H{"type": "progress", "stage": stage, "detail": detail})
+		})
+
+		mapping, err := requestFieldMapping(query)
+		if err != nil {
+			sendError(http.StatusBadRequest, "%v", err)
+			return
+		}
+		logs, err := parseLogData(query, data, mapping, start.Filename)
+		if err != nil {
+			sendError(http.StatusBadRequest, "invalid file: %v", err)
+			return
+		}
+
+		status, resp := runAnalysis(ctx, tenant, logs, pipelineOptions{
+			Kind:   start.Kind,
+			Query:  query,
+			Source: storage.AnalysisSource{Type: "request", Filename: start.Filename},
+		})
+		if status != http.StatusOK {
+			sendError(status, "%v", resp["error"])
+			return
+		}
+		conn.WriteJSON(gin.H{"type": "result", "status": status, "result": resp})
+	})
+}
@@ -0,0 +1,119 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"net/http"
+
+	"analyticsai/ai-service/analytics"
+	"analyticsai/ai-service/storage"
+
+	"github.com/gin-gonic/gin"
+)
+
+// registerIngestRoutes registers real-time ingestion into named buffers and
+// the analysis of a buffer's window.
+func registerIngestRoutes(router *gin.Engine) {
+	// Real-time ingestion: entries sent one at a time or in small batches
+	// accumulate in a named buffer, analyzed with buffer=<name>.
+	router.POST("/ingest", applyTenantLimits, func(c *gin.Context) {
+		tenant, name := tenantID(c), c.DefaultQuery("buffer", "default")
+		if !analytics.ValidBufferName(name) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("invalid buffer name %q", name)})
+			return
+		}
+		if name == kafkaBufferName {
+			c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("buffer %q is reserved for the Kafka consumer", name)})
+			return
+		}
+
+		mapping, err := requestFieldMapping(c.Request.URL.Query())
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		body, err := c.GetRawData()
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("invalid request body: %v", err)})
+			return
+		}
+		var logs []analytics.LogEntry
+		if c.Query("log_format") == "" {
+			logs, err = decodeEntries(body, mapping)
+		} else {
+			logs, err = parseLogData(c.Request.URL.Query(), body, mapping, "")
+		}
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("invalid request body: %v", err)})
+			return
+		}
+		if len(logs) == 0 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "no log entries in request body"})
+			return
+		}
+		if err := analytics.CheckEntryLimit(c.Request.Context(), len(logs)); err != nil {
+			respondAnalysisError(c, "error ingesting logs", err)
+			return
+		}
+
+		if logBuffers.Get(tenant, name) == nil && logBuffers.Count(tenant) >= maxBuffersPerTenant {
+			c.JSON(http.StatusConflict, gin.H{"error": fmt.Sprintf("tenant already has %d log buffers; delete one first", maxBuffersPerTenant)})
+			return
+		}
+		buffer := logBuffers.GetOrCreate(tenant, name, func() *analytics.LogBuffer {
+			return newIngestBuffer(tenant, name)
+		})
+		resp := gin.H{"buffer": name, "accepted": len(logs)}
+		// The entries are buffered even if the journal can't be written, so
+		// the request isn't failed and retried into duplicates.
+		if err := buffer.Append(logs); err != nil {
+			log.Printf("Error persisting log buffer %q of tenant %q: %v", name, tenant, err)
+			resp["persist_error"] = err.Error()
+		}
+		resp["stats"] = buffer.Stats()
+		c.JSON(http.StatusAccepted, resp)
+	})
+
+	router.GET("/buffers", func(c *gin.Context) {
+		c.JSON(http.StatusOK, gin.H{"buffers": logBuffers.List(tenantID(c))})
+	})
+
+	router.DELETE("/buffers/:name", func(c *gin.Context) {
+		tenant, name := tenantID(c), c.Param("name")
+		if !logBuffers.Delete(tenant, name) {
+			c.JSON(http.StatusNotFound, gin.H{"error": fmt.Sprintf("log buffer %q not found", name)})
+			return
+		}
+		if bufferStore != nil {
+			if err := bufferStore.Delete(tenant, name); err != nil {
+				c.JSON(http.StatusInternalServerError, gin.H{"error": fmt.Sprintf("error deleting buffer journal: %v", err)})
+				return
+			}
+		}
+		c.JSON(http.StatusOK, gin.H{"deleted": name})
+	})
+
+	// Analysis of a buffer's current window: runs the /analyze/<kind>
+	// analysis (logs by default) on the buffer's entries.
+	router.POST("/analyze/buffer/:name", func(c *gin.Context) {
+		name, kind := c.Param("name"), c.DefaultQuery("kind", "logs")
+		if !isAnalysisKind(kind) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("invalid kind %q", kind)})
+			return
+		}
+		tenant := tenantID(c)
+		buffer := logBuffers.Get(tenant, name)
+		if buffer == nil {
+			c.JSON(http.StatusNotFound, gin.H{"error": fmt.Sprintf("log buffer %q not found", name)})
+			return
+		}
+		query := c.Request.URL.Query()
+		query.Del("kind")
+		query.Set("buffer", name)
+		c.JSON(runAnalysis(c.Request.Context(), tenant, buffer.Entries(), pipelineOptions{
+			Kind:   kind,
+			Query:  query,
+			Source: storage.AnalysisSource{Type: "request"},
+		}))
+	})
+}
@@ -0,0 +1,310 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"analyticsai/ai-service/analytics"
+	"analyticsai/ai-service/analytics/aggregator"
+	"analyticsai/ai-service/grafana"
+	"analyticsai/ai-service/report"
+	"analyticsai/ai-service/storage"
+
+	"github.com/gin-gonic/gin"
+)
+
+// registerReportRoutes registers the endpoints that present analyses to
+// people and other tools: reports, the Prometheus and Grafana views and the
+// usage of the tenant.
+func registerReportRoutes(router *gin.Engine) {
+	// Report endpoints: analyse the posted logs, or render a stored logs
+	// analysis, as a document
+	router.POST("/reports/pdf", applyTenantLimits, func(c *gin.Context) {
+		r, ok := analyzeForReport(c)
+		if !ok {
+			return
+		}
+		writePDFReport(c, r)
+	})
+
+	router.GET("/reports/pdf/:id", requireAnalysisStore, func(c *gin.Context) {
+		r, ok := storedReport(c)
+		if !ok {
+			return
+		}
+		writePDFReport(c, r)
+	})
+
+	router.POST("/reports/html", applyTenantLimits, func(c *gin.Context) {
+		r, ok := analyzeForReport(c)
+		if !ok {
+			return
+		}
+		writeHTMLReport(c, r)
+	})
+
+	router.GET("/reports/html/:id", requireAnalysisStore, func(c *gin.Context) {
+		r, ok := storedReport(c)
+		if !ok {
+			return
+		}
+		writeHTMLReport(c, r)
+	})
+
+	// Availability report: uptime overall and per endpoint, with downtime
+	// windows, for SLA reporting
+	router.POST("/reports/availability", applyTenantLimits, func(c *gin.Context) {
+		logs, opts, ok := bindLogs(c)
+		if !ok {
+			return
+		}
+		if err := analytics.CheckEntryLimit(c.Request.Context(), len(logs)); err != nil {
+			respondAnalysisError(c, "error computing availability", err)
+			return
+		}
+
+		availability := aggregator.AvailabilityOptions{Interval: opts.Interval}
+		timeout, err := parseOptionalInt(c.Query("timeout_ms"))
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("invalid timeout_ms: %v", err)})
+			return
+		}
+		availability.TimeoutMs = timeout
+		for name, target := range map[string]*float64{"down_threshold": &availability.DownThreshold, "target": &availability.Target} {
+			if raw := c.Query(name); raw != "" {
+				v, err := strconv.ParseFloat(raw, 64)
+				if err != nil {
+					c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("invalid %s %q: must be a number", name, raw)})
+					return
+				}
+				*target = v
+			}
+		}
+
+		report, err := aggregator.ComputeAvailability(logs, availability)
+		if err != nil {
+			respondAnalysisError(c, "error computing availability", err)
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{"availability": report})
+	})
+
+	// Error budget roll-up: each service's budget consumption, for logs
+	// collected from several services
+	router.POST("/reports/error-budget", applyTenantLimits, func(c *gin.Context) {
+		var req struct {
+			aggregator.SLOTarget
+			ServiceTargets map[string]float64   `json:"service_targets"`
+			Logs           []analytics.LogEntry `json:"logs"`
+		}
+		if err := c.BindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("invalid request body: %v", err)})
+			return
+		}
+
+		buffer, ok := requestBuffer(c)
+		if !ok {
+			return
+		}
+		if buffer != nil {
+			req.Logs = buffer.Entries()
+		}
+		if req.Logs, _, ok = prepareLogs(c, req.Logs); !ok {
+			return
+		}
+		if err := analytics.CheckEntryLimit(c.Request.Context(), len(req.Logs)); err != nil {
+			respondAnalysisError(c, "error computing error budgets", err)
+			return
+		}
+
+		report, err := aggregator.ComputeErrorBudgets(req.Logs, req.SLOTarget, req.ServiceTargets)
+		if err != nil {
+			respondAnalysisError(c, "error computing error budgets", err)
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{"error_budget": report})
+	})
+
+	// Prometheus exposition of the calling tenant's most recently analyzed
+	// logs, for alerting on the analyzed traffic itself.
+	router.GET("/metrics/logs", func(c *gin.Context) {
+		c.Header("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+		window := logWindows.Get(tenantID(c))
+		if window == nil {
+			c.Status(http.StatusOK)
+			return
+		}
+		if err := window.WritePrometheus(c.Writer); err != nil {
+			log.Printf("Error writing log metrics: %v", err)
+		}
+	})
+
+	// Grafana JSON datasource over the metrics of the tenant's stored
+	// analyses. Grafana sends the API key configured on the datasource.
+	grafanaAPI := router.Group("/grafana", requireAnalysisStore)
+
+	grafanaAPI.GET("/", func(c *gin.Context) {
+		c.Status(http.StatusOK)
+	})
+
+	grafanaSearch := func(c *gin.Context) ([]string, bool) {
+		var req struct {
+			Target string `json:"target"`
+		}
+		// The body is optional.
+		c.ShouldBindJSON(&req)
+		samples, err := loadGrafanaSamples(tenantID(c), time.Time{}, time.Time{}, grafanaSearchAnalyses)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": fmt.Sprintf("error reading analyses: %v", err)})
+			return nil, false
+		}
+		return grafana.Search(samples, req.Target), true
+	}
+
+	grafanaAPI.POST("/search", func(c *gin.Context) {
+		if targets, ok := grafanaSearch(c); ok {
+			c.JSON(http.StatusOK, targets)
+		}
+	})
+
+	grafanaAPI.POST("/metrics", func(c *gin.Context) {
+		targets, ok := grafanaSearch(c)
+		if !ok {
+			return
+		}
+		options := make([]gin.H, len(targets))
+		for i, t := range targets {
+			options[i] = gin.H{"label": t, "value": t}
+		}
+		c.JSON(http.StatusOK, options)
+	})
+
+	grafanaAPI.POST("/query", func(c *gin.Context) {
+		var req grafana.QueryRequest
+		if err := c.BindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("invalid request body: %v", err)})
+			return
+		}
+		samples, err := loadGrafanaSamples(tenantID(c), req.Range.From, req.Range.To, 0)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": fmt.Sprintf("error reading analyses: %v", err)})
+			return
+		}
+		results, err := grafana.Query(req, samples)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusOK, results)
+	})
+
+	// Usage of the calling tenant, for chargeback
+	router.GET("/usage", requireAuditLog, func(c *gin.Context) {
+		from, to, ok := parseUsagePeriod(c)
+		if !ok {
+			return
+		}
+		tenant := tenantID(c)
+		usage, err := usageReports(storage.AuditQuery{From: from, To: to, Tenant: tenant})
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": fmt.Sprintf("error reporting usage: %v", err)})
+			return
+		}
+		report := usageReport{TenantUsage: storage.NewTenantUsage(tenant)}
+		if len(usage) > 0 {
+			report = usage[0]
+		} else if report.Storage, err = storageUsage(tenant); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": fmt.Sprintf("error reporting usage: %v", err)})
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{"from": from, "to": to, "usage": report})
+	})
+}
+
+// analyzeForReport runs a log analysis of the request body for a report.
+// Without an interval parameter the time series is bucketed automatically
+// so the report has charts.
+func analyzeForReport(c *gin.Context) (report.Report, bool) {
+	logs, opts, ok := bindLogs(c)
+	if !ok {
+		return report.Report{}, false
+	}
+	if opts.Interval == 0 {
+		opts.Interval = aggregator.AutoInterval(logs)
+	}
+	analysis, err := analyticsService.AnalyzeLogs(c.Request.Context(), logs, opts)
+	if err != nil {
+		respondAnalysisError(c, "error generating analysis", err)
+		return report.Report{}, false
+	}
+	return report.Report{
+		Title:       c.Query("title"),
+		Tenant:      tenantID(c),
+		GeneratedAt: time.Now(),
+		Analysis:    analysis,
+		Metrics:     aggregator.Snapshot(logs, len(analysis.PotentialIssues)),
+	}, true
+}
+
+// storedReport loads the calling tenant's stored logs analysis :id for a
+// report.
+func storedReport(c *gin.Context) (report.Report, bool) {
+	stored, err := analysisStore.Get(tenantID(c), c.Param("id"))
+	if errors.Is(err, storage.ErrNotFound) {
+		c.JSON(http.StatusNotFound, gin.H{"error": fmt.Sprintf("analysis %q not found", c.Param("id"))})
+		return report.Report{}, false
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": fmt.Sprintf("error reading analysis: %v", err)})
+		return report.Report{}, false
+	}
+	if stored.Kind != "logs" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "reports are only available for logs analyses"})
+		return report.Report{}, false
+	}
+	var analysis analytics.AnalysisResult
+	if err := json.Unmarshal(stored.Result, &analysis); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": fmt.Sprintf("error reading analysis: %v", err)})
+		return report.Report{}, false
+	}
+	metrics, _ := storedMetrics(stored)
+	title := c.Query("title")
+	if title == "" && stored.Source.Name != "" {
+		title = "Log Analysis Report: " + stored.Source.Name
+	}
+	return report.Report{
+		Title:       title,
+		Tenant:      stored.Tenant,
+		AnalysisID:  stored.ID,
+		GeneratedAt: stored.CreatedAt,
+		Analysis:    &analysis,
+		Metrics:     metrics,
+	}, true
+}
+
+func writePDFReport(c *gin.Context, r report.Report) {
+	data, err := report.RenderPDF(r)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": fmt.Sprintf("error rendering report: %v", err)})
+		return
+	}
+	c.Header("Content-Disposition", "attachment; filename=analysis-report.pdf")
+	c.Data(http.StatusOK, "application/pdf", data)
+}
+
+func writeHTMLReport(c *gin.Context, r report.Report) {
+	data, err := report.RenderHTML(r)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": fmt.Sprintf("error rendering report: %v", err)})
+		return
+	}
+	c.Header("Content-Disposition", "attachment; filename=analysis-report.html")
+	c.Data(http.StatusOK, "text/html; charset=utf-8", data)
+}
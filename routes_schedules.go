@@ -0,0 +1,132 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+
+	"analyticsai/ai-service/alerts"
+	"analyticsai/ai-service/scheduler"
+
+	"github.com/gin-gonic/gin"
+)
+
+// registerScheduleRoutes registers the scheduled analysis and alert rule
+// endpoints.
+func registerScheduleRoutes(router *gin.Engine) {
+	// Scheduled analysis endpoints, scoped to the calling tenant
+	router.POST("/schedules", func(c *gin.Context) {
+		var job scheduler.Job
+		if err := c.BindJSON(&job); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("invalid request body: %v", err)})
+			return
+		}
+		job.Tenant = tenantID(c)
+		if job.Source.Type == scheduler.SourceUpload && cloudRunMode {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "uploads are not stored in Cloud Run mode; use a url or gcs source"})
+			return
+		}
+
+		job, err := schedules.Add(job)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("invalid schedule: %v", err)})
+			return
+		}
+		c.JSON(http.StatusCreated, gin.H{"schedule": job})
+	})
+
+	router.GET("/schedules", func(c *gin.Context) {
+		c.JSON(http.StatusOK, gin.H{"schedules": schedules.List(tenantID(c))})
+	})
+
+	router.GET("/schedules/:id", func(c *gin.Context) {
+		job, err := schedules.Get(tenantID(c), c.Param("id"))
+		if err != nil {
+			c.JSON(http.StatusNotFound, gin.H{"error": fmt.Sprintf("schedule %q not found", c.Param("id"))})
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{"schedule": job})
+	})
+
+	router.DELETE("/schedules/:id", func(c *gin.Context) {
+		err := schedules.Delete(tenantID(c), c.Param("id"))
+		if errors.Is(err, scheduler.ErrNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": fmt.Sprintf("schedule %q not found", c.Param("id"))})
+			return
+		}
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": fmt.Sprintf("error deleting schedule: %v", err)})
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{"deleted": c.Param("id")})
+	})
+
+	router.POST("/schedules/:id/run", func(c *gin.Context) {
+		job, err := schedules.RunNow(c.Request.Context(), tenantID(c), c.Param("id"))
+		if err != nil {
+			c.JSON(http.StatusNotFound, gin.H{"error": fmt.Sprintf("schedule %q not found", c.Param("id"))})
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{"schedule": job})
+	})
+
+	// Alert rules, evaluated against every analysis of the tenant
+	router.POST("/alert-rules", func(c *gin.Context) {
+		var rule alerts.Rule
+		if err := c.BindJSON(&rule); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("invalid request body: %v", err)})
+			return
+		}
+		rule.Tenant = tenantID(c)
+		rule, err := alertRules.Add(rule)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusCreated, gin.H{"rule": rule})
+	})
+
+	router.GET("/alert-rules", func(c *gin.Context) {
+		c.JSON(http.StatusOK, gin.H{"rules": alertRules.List(tenantID(c))})
+	})
+
+	router.GET("/alert-rules/:id", func(c *gin.Context) {
+		rule, err := alertRules.Get(tenantID(c), c.Param("id"))
+		if err != nil {
+			c.JSON(http.StatusNotFound, gin.H{"error": fmt.Sprintf("alert rule %q not found", c.Param("id"))})
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{"rule": rule})
+	})
+
+	router.PUT("/alert-rules/:id", func(c *gin.Context) {
+		var rule alerts.Rule
+		if err := c.BindJSON(&rule); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("invalid request body: %v", err)})
+			return
+		}
+		rule, err := alertRules.Update(tenantID(c), c.Param("id"), rule)
+		if errors.Is(err, alerts.ErrNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": fmt.Sprintf("alert rule %q not found", c.Param("id"))})
+			return
+		}
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{"rule": rule})
+	})
+
+	router.DELETE("/alert-rules/:id", func(c *gin.Context) {
+		err := alertRules.Delete(tenantID(c), c.Param("id"))
+		if errors.Is(err, alerts.ErrNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": fmt.Sprintf("alert rule %q not found", c.Param("id"))})
+			return
+		}
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": fmt.Sprintf("error deleting alert rule: %v", err)})
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{"deleted": c.Param("id")})
+	})
+}
@@ -0,0 +1,309 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"analyticsai/ai-service/analytics"
+	"analyticsai/ai-service/analytics/aggregator"
+	"analyticsai/ai-service/storage"
+
+	"github.com/gin-gonic/gin"
+)
+
+// registerStorageRoutes registers the endpoints managing what a tenant has
+// stored: uploads, analyses, baselines and feedback on analyses.
+func registerStorageRoutes(router *gin.Engine) {
+	// File upload endpoint
+	router.POST("/upload", applyTenantLimits, func(c *gin.Context) {
+		file, err := c.FormFile("file")
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("get form err: %v", err)})
+			return
+		}
+
+		data, err := readFormFile(file)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": fmt.Sprintf("read file err: %v", err)})
+			return
+		}
+
+		// The local filesystem is in-memory on Cloud Run, so uploads are
+		// only kept under uploads/ elsewhere.
+		var uploadID string
+		if !cloudRunMode {
+			upload, err := uploadStore.Save(tenantID(c), file.Filename, data)
+			if err != nil {
+				c.JSON(http.StatusInternalServerError, gin.H{"error": fmt.Sprintf("upload file err: %v", err)})
+				return
+			}
+			uploadID = upload.ID
+		}
+
+		mapping, err := requestFieldMapping(c.Request.URL.Query())
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		logs, err := parseLogData(c.Request.URL.Query(), data, mapping, file.Filename)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("parse json err: %v", err)})
+			return
+		}
+
+		logs, opts, ok := prepareLogs(c, logs)
+		if !ok {
+			return
+		}
+
+		// Analyze the logs
+		run := newAnalysisRun(c, "logs", logs, opts)
+		run.Source = storage.AnalysisSource{Type: "upload", UploadID: uploadID, Filename: file.Filename}
+		resp, err := runLogsAnalysis(c.Request.Context(), run)
+		if err != nil {
+			respondAnalysisError(c, "analysis err", err)
+			return
+		}
+
+		resp["message"] = "File successfully uploaded and analyzed"
+		resp["upload_id"] = uploadID
+		c.JSON(http.StatusOK, resp)
+	})
+
+	// Upload management endpoints, scoped to the calling tenant
+	router.GET("/uploads", func(c *gin.Context) {
+		uploads, err := uploadStore.List(tenantID(c))
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": fmt.Sprintf("error listing uploads: %v", err)})
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{"uploads": uploads})
+	})
+
+	router.DELETE("/uploads/:id", func(c *gin.Context) {
+		deleteUpload(c, tenantID(c), c.Param("id"))
+	})
+
+	// Stored analysis endpoints, scoped to the calling tenant
+	router.GET("/analyses", requireAnalysisStore, func(c *gin.Context) {
+		offset, limit, ok := parsePagination(c)
+		if !ok {
+			return
+		}
+
+		analyses, err := analysisStore.List(tenantID(c), c.Query("kind"))
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": fmt.Sprintf("error listing analyses: %v", err)})
+			return
+		}
+		resp := gin.H{}
+		start, end := paginate(resp, len(analyses), offset, limit)
+		resp["analyses"] = analyses[start:end]
+		c.JSON(http.StatusOK, resp)
+	})
+
+	router.GET("/analyses/trends", requireAnalysisStore, applyTenantLimits, func(c *gin.Context) {
+		source := c.Query("source")
+		if source == "" {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "source is required"})
+			return
+		}
+		kind := c.DefaultQuery("kind", "logs")
+		n := defaultTrendAnalyses
+		if raw := c.Query("n"); raw != "" {
+			v, err := strconv.Atoi(raw)
+			if err != nil || v < 2 || v > maxTrendAnalyses {
+				c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("n must be between 2 and %d", maxTrendAnalyses)})
+				return
+			}
+			n = v
+		}
+
+		points, err := loadTrendPoints(tenantID(c), source, kind, n)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": fmt.Sprintf("error reading analyses: %v", err)})
+			return
+		}
+		report, err := analyticsService.AnalyzeTrends(c.Request.Context(), source, kind, points)
+		if err != nil {
+			respondAnalysisError(c, "error analyzing trends", err)
+			return
+		}
+		c.JSON(http.StatusOK, report)
+	})
+
+	router.GET("/analyses/:id", requireAnalysisStore, func(c *gin.Context) {
+		view, fields, err := parseResultView(c)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		analysis, err := analysisStore.Get(tenantID(c), c.Param("id"))
+		if errors.Is(err, storage.ErrNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": fmt.Sprintf("analysis %q not found", c.Param("id"))})
+			return
+		}
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": fmt.Sprintf("error reading analysis: %v", err)})
+			return
+		}
+		var pages map[string]analytics.FindingsPage
+		if analysis.Result, pages, err = analytics.ViewResult(analysis.Result, view); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": fmt.Sprintf("error filtering analysis: %v", err)})
+			return
+		}
+		if len(fields) == 0 && len(pages) == 0 {
+			c.JSON(http.StatusOK, analysis)
+			return
+		}
+
+		data, err := json.Marshal(analysis)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": fmt.Sprintf("error encoding analysis: %v", err)})
+			return
+		}
+		var doc map[string]json.RawMessage
+		json.Unmarshal(data, &doc)
+		if len(fields) > 0 {
+			for key := range doc {
+				if !containsField(fields, key) {
+					delete(doc, key)
+				}
+			}
+		}
+		if len(pages) > 0 {
+			doc["pagination"], _ = json.Marshal(pages)
+		}
+		c.JSON(http.StatusOK, doc)
+	})
+
+	// Baseline endpoints, scoped to the calling tenant
+	router.GET("/baselines", requireAnalysisStore, func(c *gin.Context) {
+		baselines, err := analysisStore.Baselines(tenantID(c))
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": fmt.Sprintf("error listing baselines: %v", err)})
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{"baselines": baselines})
+	})
+
+	router.PUT("/baselines/:name", requireAnalysisStore, func(c *gin.Context) {
+		var req struct {
+			AnalysisID string                          `json:"analysis_id"`
+			Thresholds aggregator.RegressionThresholds `json:"thresholds"`
+		}
+		if err := c.BindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("invalid request body: %v", err)})
+			return
+		}
+		if err := req.Thresholds.Validate(); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		tenant := tenantID(c)
+		analysis, err := analysisStore.Get(tenant, req.AnalysisID)
+		if errors.Is(err, storage.ErrNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": fmt.Sprintf("analysis %q not found", req.AnalysisID)})
+			return
+		}
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": fmt.Sprintf("error reading analysis: %v", err)})
+			return
+		}
+		if _, ok := storedMetrics(analysis); !ok {
+			c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("analysis %q has no stored metrics", req.AnalysisID)})
+			return
+		}
+
+		baseline := storage.Baseline{
+			Name:               c.Param("name"),
+			AnalysisID:         analysis.ID,
+			Kind:               analysis.Kind,
+			Source:             analysis.Source.Name,
+			ErrorRateThreshold: req.Thresholds.ErrorRate,
+			LatencyThreshold:   req.Thresholds.Latency,
+			CreatedAt:          time.Now().UTC(),
+		}
+		if err := analysisStore.SetBaseline(tenant, baseline); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": fmt.Sprintf("error saving baseline: %v", err)})
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{"baseline": baseline})
+	})
+
+	router.DELETE("/baselines/:name", requireAnalysisStore, func(c *gin.Context) {
+		err := analysisStore.DeleteBaseline(tenantID(c), c.Param("name"))
+		if errors.Is(err, storage.ErrNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": fmt.Sprintf("baseline %q not found", c.Param("name"))})
+			return
+		}
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": fmt.Sprintf("error deleting baseline: %v", err)})
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{"deleted": c.Param("name")})
+	})
+
+	// Feedback endpoints: ratings of the insights and issues of stored logs
+	// analyses, given to later analyses of the tenant as guidance
+	router.POST("/feedback", requireAnalysisStore, func(c *gin.Context) {
+		var req struct {
+			AnalysisID string `json:"analysis_id"`
+			Kind       string `json:"kind"`
+			Index      int    `json:"index"`
+			Rating     string `json:"rating"`
+			Comment    string `json:"comment"`
+		}
+		if err := c.BindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("invalid request body: %v", err)})
+			return
+		}
+		tenant := tenantID(c)
+		stored, err := analysisStore.Get(tenant, req.AnalysisID)
+		if errors.Is(err, storage.ErrNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": fmt.Sprintf("analysis %q not found", req.AnalysisID)})
+			return
+		}
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": fmt.Sprintf("error reading analysis: %v", err)})
+			return
+		}
+		if stored.Kind != "logs" {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "feedback can only be given on logs analyses"})
+			return
+		}
+		var result analytics.AnalysisResult
+		if err := json.Unmarshal(stored.Result, &result); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": fmt.Sprintf("error reading analysis: %v", err)})
+			return
+		}
+		text, err := analytics.FeedbackItem(&result, req.Kind, req.Index)
+		if err != nil {
+			respondAnalysisError(c, "invalid feedback", err)
+			return
+		}
+		f, err := feedback.Add(analytics.Feedback{
+			Tenant:     tenant,
+			AnalysisID: stored.ID,
+			Kind:       req.Kind,
+			Index:      req.Index,
+			Text:       text,
+			Rating:     req.Rating,
+			Comment:    req.Comment,
+		})
+		if err != nil {
+			respondAnalysisError(c, "error storing feedback", err)
+			return
+		}
+		c.JSON(http.StatusCreated, f)
+	})
+
+	router.GET("/feedback", func(c *gin.Context) {
+		c.JSON(http.StatusOK, gin.H{"feedback": feedback.List(tenantID(c), c.Query("analysis_id"))})
+	})
+}
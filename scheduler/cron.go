@@ -0,0 +1,210 @@
+package scheduler
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// maxCronSearch bounds how far ahead Next looks for a matching time, so
+// expressions that never match (such as February 30) terminate.
+const maxCronSearch = 5 * 366 * 24 * time.Hour
+
+var cronShortcuts = map[string]string{
+	"@hourly":   "0 * * * *",
+	"@daily":    "0 0 * * *",
+	"@midnight": "0 0 * * *",
+	"@weekly":   "0 0 * * 0",
+	"@monthly":  "0 0 1 * *",
+	"@yearly":   "0 0 1 1 *",
+	"@annually": "0 0 1 1 *",
+}
+
+// Cron is a parsed five-field cron expression: minute, hour, day of month,
+// month and day of week (0 or 7 is Sunday). Fields accept *, numbers,
+// ranges (1-5), lists (1,15) and steps (*/10, 0-30/5).
+type Cron struct {
+	minute, hour, dom, month, dow uint64
+	// domAny and dowAny record unrestricted day fields: when both day fields
+	// are restricted, a day matching either one matches, as in Vixie cron.
+	domAny, dowAny bool
+	// hourAny records an hour field starting with *, whose runs follow the
+	// clock through DST changes rather than happening once per wall time.
+	hourAny bool
+}
+
+// ParseCron parses a cron expression or one of the shortcuts @hourly,
+// @daily, @weekly, @monthly and @yearly.
+func ParseCron(expr string) (*Cron, error) {
+	expr = strings.TrimSpace(expr)
+	if shortcut, ok := cronShortcuts[expr]; ok {
+		expr = shortcut
+	}
+	fields := strings.Fields(expr)
+	if len(fields) != 5 {
+		return nil, fmt.Errorf("cron expression %q must have 5 fields", expr)
+	}
+
+	var c Cron
+	var err error
+	if c.minute, err = parseCronField(fields[0], 0, 59); err != nil {
+		return nil, fmt.Errorf("invalid minute field: %v", err)
+	}
+	if c.hour, err = parseCronField(fields[1], 0, 23); err != nil {
+		return nil, fmt.Errorf("invalid hour field: %v", err)
+	}
+	if c.dom, err = parseCronField(fields[2], 1, 31); err != nil {
+		return nil, fmt.Errorf("invalid day-of-month field: %v", err)
+	}
+	if c.month, err = parseCronField(fields[3], 1, 12); err != nil {
+		return nil, fmt.Errorf("invalid month field: %v", err)
+	}
+	if c.dow, err = parseCronField(fields[4], 0, 7); err != nil {
+		return nil, fmt.Errorf("invalid day-of-week field: %v", err)
+	}
+	if c.dow&(1<<7) != 0 {
+		c.dow |= 1
+	}
+	c.domAny = fields[2] == "*"
+	c.dowAny = fields[4] == "*"
+	c.hourAny = strings.HasPrefix(fields[1], "*")
+	return &c, nil
+}
+
+// parseCronField returns a bit set of the values field selects.
+func parseCronField(field string, min, max int) (uint64, error) {
+	var bits uint64
+	for _, part := range strings.Split(field, ",") {
+		rangePart, stepPart, hasStep := strings.Cut(part, "/")
+		step := 1
+		if hasStep {
+			n, err := strconv.Atoi(stepPart)
+			if err != nil || n <= 0 {
+				return 0, fmt.Errorf("invalid step %q", stepPart)
+			}
+			step = n
+		}
+
+		lo, hi := min, max
+		if rangePart != "*" {
+			loPart, hiPart, isRange := strings.Cut(rangePart, "-")
+			var err error
+			if lo, err = strconv.Atoi(loPart); err != nil {
+				return 0, fmt.Errorf("invalid value %q", loPart)
+			}
+			hi = lo
+			if isRange {
+				if hi, err = strconv.Atoi(hiPart); err != nil {
+					return 0, fmt.Errorf("invalid value %q", hiPart)
+				}
+			} else if hasStep {
+				hi = max
+			}
+		}
+		if lo < min || hi > max || lo > hi {
+			return 0, fmt.Errorf("%q is outside %d-%d", part, min, max)
+		}
+		for v := lo; v <= hi; v += step {
+			bits |= 1 << uint(v)
+		}
+	}
+	return bits, nil
+}
+
+func (c *Cron) dayMatches(t time.Time) bool {
+	dom := c.dom&(1<<uint(t.Day())) != 0
+	dow := c.dow&(1<<uint(t.Weekday())) != 0
+	if c.domAny || c.dowAny {
+		return dom && dow
+	}
+	return dom || dow
+}
+
+func (c *Cron) matches(t time.Time) bool {
+	return c.month&(1<<uint(t.Month())) != 0 && c.dayMatches(t) &&
+		c.hour&(1<<uint(t.Hour())) != 0 && c.minute&(1<<uint(t.Minute())) != 0
+}
+
+// Next returns the first time after after that matches c, in after's
+// location, or the zero time if there is none within five years.
+//
+// Across DST changes it behaves like Vixie cron: a run whose wall clock
+// time is skipped when the clocks go forward happens right after the
+// change, and one whose wall clock time repeats when they go back happens
+// once, unless the hour field is a wildcard.
+func (c *Cron) Next(after time.Time) time.Time {
+	loc := after.Location()
+	t := after.Truncate(time.Minute).Add(time.Minute)
+	limit := after.Add(maxCronSearch)
+	for t.Before(limit) {
+		var next time.Time
+		switch {
+		case c.month&(1<<uint(t.Month())) == 0:
+			next = wallTime(t.Year(), t.Month()+1, 1, 0, loc)
+		case !c.dayMatches(t):
+			next = wallTime(t.Year(), t.Month(), t.Day()+1, 0, loc)
+		case c.hour&(1<<uint(t.Hour())) == 0:
+			next = wallTime(t.Year(), t.Month(), t.Day(), t.Hour()+1, loc)
+		case c.minute&(1<<uint(t.Minute())) == 0 || (!c.hourAny && repeated(t)):
+			next = t.Add(time.Minute)
+		default:
+			return t
+		}
+		if change, ok := c.skippedBetween(t, next); ok {
+			return change
+		}
+		t = next
+	}
+	return time.Time{}
+}
+
+// skippedBetween returns the time the clocks went forward between from and
+// to if a wall clock time matching c was skipped by it.
+func (c *Cron) skippedBetween(from, to time.Time) (time.Time, bool) {
+	change, _ := to.ZoneBounds()
+	if !change.After(from) {
+		return time.Time{}, false
+	}
+	_, before := change.Add(-time.Second).Zone()
+	_, offset := change.Zone()
+	end := wallClock(change)
+	for w := end.Add(-time.Duration(offset-before) * time.Second); w.Before(end); w = w.Add(time.Minute) {
+		if c.matches(w) {
+			return change, true
+		}
+	}
+	return time.Time{}, false
+}
+
+// wallTime returns the first instant in loc whose wall clock reads hour:00
+// on the given day, normalized like time.Date. An hour the clocks skipped
+// yields the end of the gap.
+func wallTime(year int, month time.Month, day, hour int, loc *time.Location) time.Time {
+	t := time.Date(year, month, day, hour, 0, 0, 0, loc)
+	if repeated(t) {
+		start, _ := t.ZoneBounds()
+		_, before := start.Add(-time.Second).Zone()
+		_, offset := t.Zone()
+		t = t.Add(-time.Duration(before-offset) * time.Second)
+	}
+	return t
+}
+
+// repeated reports whether t's wall clock time already occurred earlier
+// because the clocks went back.
+func repeated(t time.Time) bool {
+	start, _ := t.ZoneBounds()
+	if start.IsZero() {
+		return false
+	}
+	_, before := start.Add(-time.Second).Zone()
+	_, offset := t.Zone()
+	return before > offset && t.Sub(start) < time.Duration(before-offset)*time.Second
+}
+
+// wallClock returns t's wall clock time as a UTC time, for arithmetic that
+// ignores DST.
+func wallClock(t time.Time) time.Time {
+	return time.Date(t.Year(), t.Month(), t.Day(), t.Hour(), t.Minute(), 0, 0, time.UTC)
+}
@@ -0,0 +1,152 @@
+package scheduler
+
+import (
+	"testing"
+	"time"
+)
+
+func mustLocation(t *testing.T, name string) *time.Location {
+	t.Helper()
+	loc, err := time.LoadLocation(name)
+	if err != nil {
+		t.Skipf("time zone %s unavailable: %v", name, err)
+	}
+	return loc
+}
+
+func utc(s string) time.Time {
+	v, err := time.Parse(time.RFC3339, s)
+	if err != nil {
+		panic(err)
+	}
+	return v
+}
+
+func TestParseCronErrors(t *testing.T) {
+	for _, expr := range []string{
+		"",
+		"* * * *",
+		"60 * * * *",
+		"* 24 * * *",
+		"* * 0 * *",
+		"* * * 13 *",
+		"* * * * 8",
+		"*/0 * * * *",
+		"5-1 * * * *",
+		"a * * * *",
+	} {
+		if _, err := ParseCron(expr); err == nil {
+			t.Errorf("ParseCron(%q) succeeded, want an error", expr)
+		}
+	}
+}
+
+func TestCronNext(t *testing.T) {
+	tests := []struct {
+		name  string
+		expr  string
+		after time.Time
+		want  time.Time
+	}{
+		{"every 15 minutes", "*/15 * * * *", utc("2026-01-05T10:07:30Z"), utc("2026-01-05T10:15:00Z")},
+		{"exact minute is after", "0 * * * *", utc("2026-01-05T10:00:00Z"), utc("2026-01-05T11:00:00Z")},
+		{"weekdays skip the weekend", "0 9 * * 1-5", utc("2026-01-09T10:00:00Z"), utc("2026-01-12T09:00:00Z")},
+		{"sunday as 7", "0 0 * * 7", utc("2026-01-05T00:00:00Z"), utc("2026-01-11T00:00:00Z")},
+		{"day of month or week", "0 0 1 * 1", utc("2026-01-06T00:00:00Z"), utc("2026-01-12T00:00:00Z")},
+		{"month rollover", "@monthly", utc("2026-12-15T00:00:00Z"), utc("2027-01-01T00:00:00Z")},
+		{"leap day", "0 0 29 2 *", utc("2026-03-01T00:00:00Z"), utc("2028-02-29T00:00:00Z")},
+		{"never matches", "0 0 30 2 *", utc("2026-01-01T00:00:00Z"), time.Time{}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cron, err := ParseCron(tt.expr)
+			if err != nil {
+				t.Fatalf("ParseCron(%q): %v", tt.expr, err)
+			}
+			if got := cron.Next(tt.after); !got.Equal(tt.want) {
+				t.Errorf("Next(%v) = %v, want %v", tt.after, got, tt.want)
+			}
+		})
+	}
+}
+
+// TestCronNextDST checks runs across the 2026 DST changes: Berlin skips
+// 02:00-03:00 on March 29 and repeats 02:00-03:00 on October 25, New York
+// repeats 01:00-02:00 on November 1.
+func TestCronNextDST(t *testing.T) {
+	berlin := mustLocation(t, "Europe/Berlin")
+	newYork := mustLocation(t, "America/New_York")
+	tests := []struct {
+		name  string
+		expr  string
+		loc   *time.Location
+		after time.Time
+		want  []time.Time // successive runs
+	}{
+		{
+			name:  "skipped time runs after the change",
+			expr:  "30 2 * * *",
+			loc:   berlin,
+			after: utc("2026-03-28T12:00:00Z"),
+			want:  []time.Time{utc("2026-03-29T01:00:00Z"), utc("2026-03-30T00:30:00Z")},
+		},
+		{
+			name:  "time after the gap is unaffected",
+			expr:  "0 3 * * *",
+			loc:   berlin,
+			after: utc("2026-03-28T12:00:00Z"),
+			want:  []time.Time{utc("2026-03-29T01:00:00Z"), utc("2026-03-30T01:00:00Z")},
+		},
+		{
+			name:  "hourly continues after the gap",
+			expr:  "0 * * * *",
+			loc:   berlin,
+			after: utc("2026-03-29T00:00:00Z"),
+			want:  []time.Time{utc("2026-03-29T01:00:00Z"), utc("2026-03-29T02:00:00Z")},
+		},
+		{
+			name:  "repeated time runs once",
+			expr:  "30 2 * * *",
+			loc:   berlin,
+			after: utc("2026-10-24T12:00:00Z"),
+			want:  []time.Time{utc("2026-10-25T00:30:00Z"), utc("2026-10-26T01:30:00Z")},
+		},
+		{
+			name:  "repeated hour start runs once",
+			expr:  "0 2 * * *",
+			loc:   berlin,
+			after: utc("2026-10-24T12:00:00Z"),
+			want:  []time.Time{utc("2026-10-25T00:00:00Z"), utc("2026-10-26T01:00:00Z")},
+		},
+		{
+			name:  "wildcard hour runs in both hours",
+			expr:  "0 * * * *",
+			loc:   berlin,
+			after: utc("2026-10-24T23:30:00Z"),
+			want:  []time.Time{utc("2026-10-25T00:00:00Z"), utc("2026-10-25T01:00:00Z"), utc("2026-10-25T02:00:00Z")},
+		},
+		{
+			name:  "repeated time runs once in the western hemisphere",
+			expr:  "30 1 * * *",
+			loc:   newYork,
+			after: utc("2026-10-31T12:00:00Z"),
+			want:  []time.Time{utc("2026-11-01T05:30:00Z"), utc("2026-11-02T06:30:00Z")},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cron, err := ParseCron(tt.expr)
+			if err != nil {
+				t.Fatalf("ParseCron(%q): %v", tt.expr, err)
+			}
+			after := tt.after.In(tt.loc)
+			for _, want := range tt.want {
+				got := cron.Next(after)
+				if !got.Equal(want) {
+					t.Fatalf("Next(%v) = %v, want %v", after, got, want.In(tt.loc))
+				}
+				after = got
+			}
+		})
+	}
+}
@@ -0,0 +1,371 @@
+// Package scheduler runs analyses on a cron schedule and notifies the
+// configured channels of their results.
+package scheduler
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/url"
+	"os"
+	"sort"
+	"sync"
+	"time"
+
+	"analyticsai/ai-service/notify"
+)
+
+// ErrNotFound is returned for schedules that don't exist for the tenant.
+var ErrNotFound = errors.New("not found")
+
+// Run statuses.
+const (
+	StatusSucceeded = "succeeded"
+	StatusFailed    = "failed"
+)
+
+// Job is a recurring analysis.
+type Job struct {
+	ID            string           `json:"id"`
+	Tenant        string           `json:"tenant"`
+	Name          string           `json:"name"`
+	Cron          string           `json:"cron"`
+	Timezone      string           `json:"timezone,omitempty"` // IANA zone the cron expression is evaluated in, default UTC
+	Kind          string           `json:"kind"`               // "logs" or "performance"
+	Source        Source           `json:"source"`
+	Query         string           `json:"query,omitempty"` // query string passed to the analysis endpoint, e.g. "interval=5m"
+	Notifications []notify.Channel `json:"notifications,omitempty"`
+	CreatedAt     time.Time        `json:"created_at"`
+	NextRun       time.Time        `json:"next_run"`
+	LastRun       *time.Time       `json:"last_run,omitempty"`
+	LastStatus    string           `json:"last_status,omitempty"`
+	LastError     string           `json:"last_error,omitempty"`
+	LastAnalysis  string           `json:"last_analysis_id,omitempty"`
+}
+
+// Result is the outcome of running a job's analysis.
+type Result struct {
+	AnalysisID string
+	Regressed  bool
+	Response   json.RawMessage // the analysis endpoint's response
+}
+
+// RunFunc runs the analysis of job.
+type RunFunc func(ctx context.Context, job Job) (Result, error)
+
+// Config configures a Scheduler.
+type Config struct {
+	// Path is the JSON file jobs are loaded from and written back to. An
+	// empty path keeps them in memory only.
+	Path    string
+	Run     RunFunc
+	Timeout time.Duration // limit of each run
+	Sources SourceConfig
+	// Notifier checks and delivers the jobs' notifications.
+	Notifier *notify.Notifier
+}
+
+// Scheduler holds jobs, optionally backed by a JSON file, and runs them
+// when they are due.
+type Scheduler struct {
+	mu       sync.Mutex
+	path     string
+	jobs     map[string]*Job
+	running  map[string]bool
+	run      RunFunc
+	timeout  time.Duration
+	sources  *sources
+	notifier *notify.Notifier
+}
+
+// New loads jobs from cfg.Path. An empty path or a missing file yields an
+// empty scheduler.
+func New(cfg Config) (*Scheduler, error) {
+	s := &Scheduler{
+		path:     cfg.Path,
+		jobs:     make(map[string]*Job),
+		running:  make(map[string]bool),
+		run:      cfg.Run,
+		timeout:  cfg.Timeout,
+		sources:  newSources(cfg.Sources),
+		notifier: cfg.Notifier,
+	}
+	if s.path == "" {
+		return s, nil
+	}
+
+	data, err := os.ReadFile(s.path)
+	if os.IsNotExist(err) {
+		return s, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("error reading schedules file: %v", err)
+	}
+	var jobs []*Job
+	if err := json.Unmarshal(data, &jobs); err != nil {
+		return nil, fmt.Errorf("error parsing schedules file: %v", err)
+	}
+	for _, job := range jobs {
+		s.jobs[job.ID] = job
+	}
+	return s, nil
+}
+
+func (s *Scheduler) save() error {
+	if s.path == "" {
+		return nil
+	}
+	jobs := make([]*Job, 0, len(s.jobs))
+	for _, job := range s.jobs {
+		jobs = append(jobs, job)
+	}
+	sort.Slice(jobs, func(i, j int) bool { return jobs[i].ID < jobs[j].ID })
+	data, err := json.MarshalIndent(jobs, "", "  ")
+	if err != nil {
+		return fmt.Errorf("error marshaling schedules: %v", err)
+	}
+	if err := os.WriteFile(s.path, data, 0644); err != nil {
+		return fmt.Errorf("error writing schedules file: %v", err)
+	}
+	return nil
+}
+
+func newID() (string, error) {
+	b := make([]byte, 8)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
+
+// next returns the job's first run time after t.
+func (job *Job) next(t time.Time) (time.Time, error) {
+	cron, err := ParseCron(job.Cron)
+	if err != nil {
+		return time.Time{}, err
+	}
+	loc := time.UTC
+	if job.Timezone != "" {
+		if loc, err = time.LoadLocation(job.Timezone); err != nil {
+			return time.Time{}, fmt.Errorf("unknown timezone %q", job.Timezone)
+		}
+	}
+	next := cron.Next(t.In(loc))
+	if next.IsZero() {
+		return time.Time{}, fmt.Errorf("cron expression %q never matches", job.Cron)
+	}
+	return next.UTC(), nil
+}
+
+// validate checks the user-supplied fields of job.
+func (s *Scheduler) validate(job *Job) error {
+	if job.Name == "" {
+		return fmt.Errorf("name is required")
+	}
+	if job.Kind != "logs" && job.Kind != "performance" {
+		return fmt.Errorf("kind must be logs or performance")
+	}
+	if _, err := url.ParseQuery(job.Query); err != nil {
+		return fmt.Errorf("invalid query: %v", err)
+	}
+	if err := job.Source.Validate(); err != nil {
+		return err
+	}
+	if job.Source.Type == SourceGCS {
+		if err := s.sources.checkGCSAccess(job.Tenant, job.Source.URL); err != nil {
+			return err
+		}
+	}
+	for _, ch := range job.Notifications {
+		if err := s.notifier.Check(ch, job.Tenant); err != nil {
+			return err
+		}
+	}
+	_, err := job.next(time.Now())
+	return err
+}
+
+// Add validates job, assigns its ID and first run time and stores it.
+func (s *Scheduler) Add(job Job) (Job, error) {
+	if job.Kind == "" {
+		job.Kind = "logs"
+	}
+	if err := s.validate(&job); err != nil {
+		return Job{}, err
+	}
+	id, err := newID()
+	if err != nil {
+		return Job{}, fmt.Errorf("error generating schedule id: %v", err)
+	}
+	now := time.Now().UTC()
+	job.ID = id
+	job.CreatedAt = now
+	job.NextRun, _ = job.next(now)
+	job.LastRun, job.LastStatus, job.LastError, job.LastAnalysis = nil, "", "", ""
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.jobs[id] = &job
+	if err := s.save(); err != nil {
+		delete(s.jobs, id)
+		return Job{}, err
+	}
+	return job, nil
+}
+
+// List returns the tenant's jobs ordered by name.
+func (s *Scheduler) List(tenant string) []Job {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	jobs := []Job{}
+	for _, job := range s.jobs {
+		if job.Tenant == tenant {
+			jobs = append(jobs, *job)
+		}
+	}
+	sort.Slice(jobs, func(i, j int) bool {
+		if jobs[i].Name != jobs[j].Name {
+			return jobs[i].Name < jobs[j].Name
+		}
+		return jobs[i].ID < jobs[j].ID
+	})
+	return jobs
+}
+
+// Get returns the tenant's job id.
+func (s *Scheduler) Get(tenant, id string) (Job, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	job, ok := s.jobs[id]
+	if !ok || job.Tenant != tenant {
+		return Job{}, ErrNotFound
+	}
+	return *job, nil
+}
+
+// Delete removes the tenant's job id.
+func (s *Scheduler) Delete(tenant, id string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	job, ok := s.jobs[id]
+	if !ok || job.Tenant != tenant {
+		return ErrNotFound
+	}
+	delete(s.jobs, id)
+	return s.save()
+}
+
+// DeleteTenant removes every job of tenant and returns their IDs.
+func (s *Scheduler) DeleteTenant(tenant string) ([]string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	ids := []string{}
+	for id, job := range s.jobs {
+		if job.Tenant == tenant {
+			ids = append(ids, id)
+			delete(s.jobs, id)
+		}
+	}
+	sort.Strings(ids)
+	return ids, s.save()
+}
+
+// RunNow runs the tenant's job id immediately, without changing when it
+// next runs on schedule, and returns the updated job.
+func (s *Scheduler) RunNow(ctx context.Context, tenant, id string) (Job, error) {
+	if _, err := s.Get(tenant, id); err != nil {
+		return Job{}, err
+	}
+	s.execute(ctx, id, false)
+	return s.Get(tenant, id)
+}
+
+// RunDue runs every job whose next run time has passed and returns how many
+// ran. Jobs run one after another.
+func (s *Scheduler) RunDue(ctx context.Context) int {
+	now := time.Now()
+	s.mu.Lock()
+	var due []string
+	for id, job := range s.jobs {
+		if !job.NextRun.IsZero() && !job.NextRun.After(now) {
+			due = append(due, id)
+		}
+	}
+	s.mu.Unlock()
+	sort.Strings(due)
+
+	ran := 0
+	for _, id := range due {
+		if s.execute(ctx, id, true) {
+			ran++
+		}
+	}
+	return ran
+}
+
+// execute runs job id unless it is already running, records the outcome,
+// advances its next run time if reschedule is set and sends notifications.
+func (s *Scheduler) execute(ctx context.Context, id string, reschedule bool) bool {
+	s.mu.Lock()
+	job, ok := s.jobs[id]
+	if !ok || s.running[id] {
+		s.mu.Unlock()
+		return false
+	}
+	s.running[id] = true
+	snapshot := *job
+	s.mu.Unlock()
+
+	runCtx, cancel := context.WithTimeout(ctx, s.timeout)
+	result, err := s.run(runCtx, snapshot)
+	cancel()
+
+	now := time.Now().UTC()
+	s.mu.Lock()
+	delete(s.running, id)
+	job, ok = s.jobs[id]
+	if ok {
+		job.LastRun = &now
+		job.LastAnalysis = result.AnalysisID
+		job.LastStatus, job.LastError = StatusSucceeded, ""
+		if err != nil {
+			job.LastStatus, job.LastError = StatusFailed, err.Error()
+		}
+		if reschedule {
+			job.NextRun, _ = job.next(now)
+		}
+		if saveErr := s.save(); saveErr != nil {
+			log.Printf("Error saving schedules: %v", saveErr)
+		}
+		snapshot = *job
+	}
+	s.mu.Unlock()
+	if !ok {
+		return true
+	}
+
+	msg := notify.Message{
+		Event:      notify.EventAnalysisCompleted,
+		Tenant:     snapshot.Tenant,
+		ScheduleID: snapshot.ID,
+		Schedule:   snapshot.Name,
+		AnalysisID: result.AnalysisID,
+		Regressed:  result.Regressed,
+		Time:       now,
+		Result:     result.Response,
+	}
+	if err != nil {
+		msg.Event, msg.Error = notify.EventAnalysisFailed, err.Error()
+		log.Printf("Scheduled analysis %s (%s) failed: %v", snapshot.ID, snapshot.Name, err)
+	}
+	for _, ch := range snapshot.Notifications {
+		if err := s.notifier.Send(ctx, ch, msg); err != nil {
+			log.Printf("Notification for schedule %s failed: %v", snapshot.ID, err)
+		}
+	}
+	return true
+}
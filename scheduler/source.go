@@ -0,0 +1,234 @@
+package scheduler
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"analyticsai/ai-service/netguard"
+)
+
+// MaxSourceBytes caps how much a scheduled analysis reads from its source.
+const MaxSourceBytes = 100 << 20
+
+const metadataTokenURL = "http://metadata.google.internal/computeMetadata/v1/instance/service-accounts/default/token"
+
+// Source types.
+const (
+	SourceURL    = "url"
+	SourceGCS    = "gcs"
+	SourceUpload = "upload"
+	SourceBuffer = "buffer"
+)
+
+// Source is where a scheduled analysis reads its logs from: an http(s) URL,
+// a Cloud Storage object ("gs://bucket/object"), a stored upload or the
+// current window of an ingestion buffer.
+type Source struct {
+	Type     string `json:"type"`
+	URL      string `json:"url,omitempty"`
+	UploadID string `json:"upload_id,omitempty"`
+	Buffer   string `json:"buffer,omitempty"`
+}
+
+// UploadLoader returns the contents of a tenant's stored upload.
+type UploadLoader func(tenant, id string) ([]byte, error)
+
+// SourceConfig configures how a Scheduler reads its jobs' sources.
+type SourceConfig struct {
+	// AllowPrivateURLs lets url sources point at loopback, private and
+	// link-local addresses. It is off by default so that tenants can't use
+	// schedules to reach internal services such as the metadata server.
+	AllowPrivateURLs bool
+	// GCSPrefixes returns the Cloud Storage locations a tenant's gcs
+	// sources may read, each a bucket ("my-logs") or a bucket and object
+	// prefix ("my-logs/checkout"). gcs sources are read with the service
+	// account's credentials, so a tenant without locations can't use them,
+	// and one can't read objects the service account reaches for others.
+	GCSPrefixes func(tenant string) []string
+	// Uploads reads upload sources.
+	Uploads UploadLoader
+}
+
+// sources reads sources as configured.
+type sources struct {
+	cfg SourceConfig
+	// client refuses connections to private addresses, unless
+	// AllowPrivateURLs is set.
+	client *http.Client
+}
+
+func newSources(cfg SourceConfig) *sources {
+	s := &sources{cfg: cfg}
+	s.client = netguard.NewClient(5*time.Minute, &s.cfg.AllowPrivateURLs)
+	return s
+}
+
+// checkGCSAccess returns an error unless tenant may read the gs:// URL raw.
+func (s *sources) checkGCSAccess(tenant, raw string) error {
+	bucket, object, err := parseGCSURL(raw)
+	if err != nil {
+		return err
+	}
+	var prefixes []string
+	if s.cfg.GCSPrefixes != nil {
+		prefixes = s.cfg.GCSPrefixes(tenant)
+	}
+	for _, prefix := range prefixes {
+		allowedBucket, objectPrefix, _ := strings.Cut(strings.TrimPrefix(prefix, "gs://"), "/")
+		if allowedBucket == bucket && inGCSPrefix(object, objectPrefix) {
+			return nil
+		}
+	}
+	return fmt.Errorf("gs://%s/%s is not in a Cloud Storage location allowed for tenant %q", bucket, object, tenant)
+}
+
+// inGCSPrefix reports whether object lies under prefix, matching whole path
+// segments: "logs/checkout" allows "logs/checkout" and "logs/checkout/a" but
+// not "logs/checkout-secrets".
+func inGCSPrefix(object, prefix string) bool {
+	switch {
+	case prefix == "":
+		return true
+	case strings.HasSuffix(prefix, "/"):
+		return strings.HasPrefix(object, prefix)
+	}
+	return object == prefix || strings.HasPrefix(object, prefix+"/")
+}
+
+// gcsClient talks to the metadata server and Cloud Storage, which are
+// trusted endpoints.
+var gcsClient = &http.Client{Timeout: 5 * time.Minute}
+
+// Validate checks that the source is well formed.
+func (s Source) Validate() error {
+	switch s.Type {
+	case SourceURL:
+		u, err := url.Parse(s.URL)
+		if err != nil || (u.Scheme != "https" && u.Scheme != "http") || u.Host == "" {
+			return fmt.Errorf("url source must be an http or https URL")
+		}
+	case SourceGCS:
+		if _, _, err := parseGCSURL(s.URL); err != nil {
+			return err
+		}
+	case SourceUpload:
+		if s.UploadID == "" {
+			return fmt.Errorf("upload source needs an upload_id")
+		}
+	case SourceBuffer:
+		if s.Buffer == "" {
+			return fmt.Errorf("buffer source needs a buffer name")
+		}
+	default:
+		return fmt.Errorf("unknown source type %q", s.Type)
+	}
+	return nil
+}
+
+func parseGCSURL(raw string) (bucket, object string, err error) {
+	rest, ok := strings.CutPrefix(raw, "gs://")
+	if ok {
+		bucket, object, ok = strings.Cut(rest, "/")
+	}
+	if !ok || bucket == "" || object == "" {
+		return "", "", fmt.Errorf("gcs source must be a gs://bucket/object URL")
+	}
+	return bucket, object, nil
+}
+
+// Fetch reads the logs of job's source. Buffers hold decoded entries
+// rather than raw logs, so the caller reads buffer sources itself.
+func (s *Scheduler) Fetch(ctx context.Context, job Job) ([]byte, error) {
+	return s.sources.fetch(ctx, job.Tenant, job.Source)
+}
+
+func (s *sources) fetch(ctx context.Context, tenant string, src Source) ([]byte, error) {
+	switch src.Type {
+	case SourceURL:
+		req, err := http.NewRequestWithContext(ctx, http.MethodGet, src.URL, nil)
+		if err != nil {
+			return nil, err
+		}
+		return readResponse(s.client, req)
+	case SourceGCS:
+		if err := s.checkGCSAccess(tenant, src.URL); err != nil {
+			return nil, err
+		}
+		return fetchGCS(ctx, src.URL)
+	case SourceUpload:
+		if s.cfg.Uploads == nil {
+			return nil, fmt.Errorf("upload sources are not available")
+		}
+		return s.cfg.Uploads(tenant, src.UploadID)
+	case SourceBuffer:
+		return nil, fmt.Errorf("buffer sources are not fetched")
+	}
+	return nil, fmt.Errorf("unknown source type %q", src.Type)
+}
+
+// fetchGCS downloads an object through the Cloud Storage JSON API, using the
+// service account's token from the metadata server when one is available.
+func fetchGCS(ctx context.Context, raw string) ([]byte, error) {
+	bucket, object, err := parseGCSURL(raw)
+	if err != nil {
+		return nil, err
+	}
+	target := fmt.Sprintf("https://storage.googleapis.com/storage/v1/b/%s/o/%s?alt=media",
+		url.PathEscape(bucket), url.PathEscape(object))
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, target, nil)
+	if err != nil {
+		return nil, err
+	}
+	if token, err := metadataToken(ctx); err == nil {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+	return readResponse(gcsClient, req)
+}
+
+func metadataToken(ctx context.Context) (string, error) {
+	ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, metadataTokenURL, nil)
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("Metadata-Flavor", "Google")
+	data, err := readResponse(gcsClient, req)
+	if err != nil {
+		return "", err
+	}
+	var token struct {
+		AccessToken string `json:"access_token"`
+	}
+	if err := json.Unmarshal(data, &token); err != nil || token.AccessToken == "" {
+		return "", fmt.Errorf("invalid metadata token response")
+	}
+	return token.AccessToken, nil
+}
+
+// readResponse performs req and returns the body of a 200 response, up to
+// MaxSourceBytes.
+func readResponse(client *http.Client, req *http.Request) ([]byte, error) {
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("error fetching source: %v", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("fetching source returned status %d", resp.StatusCode)
+	}
+	data, err := io.ReadAll(io.LimitReader(resp.Body, MaxSourceBytes+1))
+	if err != nil {
+		return nil, fmt.Errorf("error reading source: %v", err)
+	}
+	if len(data) > MaxSourceBytes {
+		return nil, fmt.Errorf("source is larger than %d bytes", MaxSourceBytes)
+	}
+	return data, nil
+}
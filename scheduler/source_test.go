@@ -0,0 +1,37 @@
+package scheduler
+
+import "testing"
+
+func TestCheckGCSAccess(t *testing.T) {
+	s := newSources(SourceConfig{
+		GCSPrefixes: func(tenant string) []string {
+			if tenant != "team-a" {
+				return nil
+			}
+			return []string{"whole-bucket", "gs://my-logs/checkout", "my-logs/payments/"}
+		},
+	})
+
+	tests := []struct {
+		tenant, url string
+		allowed     bool
+	}{
+		{"team-a", "gs://whole-bucket/any/object.json", true},
+		{"team-a", "gs://whole-bucket-2/object.json", false},
+		{"team-a", "gs://my-logs/checkout", true},
+		{"team-a", "gs://my-logs/checkout/latest.json", true},
+		{"team-a", "gs://my-logs/checkout-secrets/key.json", false},
+		{"team-a", "gs://my-logs/checkoutlatest.json", false},
+		{"team-a", "gs://my-logs/payments/latest.json", true},
+		{"team-a", "gs://my-logs/payments", false},
+		{"team-a", "gs://my-logs/other/latest.json", false},
+		{"team-b", "gs://whole-bucket/any/object.json", false},
+		{"team-a", "gs://whole-bucket", false},
+	}
+	for _, tt := range tests {
+		err := s.checkGCSAccess(tt.tenant, tt.url)
+		if (err == nil) != tt.allowed {
+			t.Errorf("checkGCSAccess(%q, %q) = %v, want allowed %v", tt.tenant, tt.url, err, tt.allowed)
+		}
+	}
+}
@@ -0,0 +1,387 @@
+package storage
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// AnalysisSource describes the logs an analysis was run on.
+type AnalysisSource struct {
+	Name     string `json:"name,omitempty"` // caller-chosen label analyses are compared by
+	Type     string `json:"type"`           // "request" or "upload"
+	UploadID string `json:"upload_id,omitempty"`
+	Filename string `json:"filename,omitempty"`
+	Entries  int    `json:"entries"`
+	Query    string `json:"query,omitempty"` // raw query string of the request
+}
+
+// Analysis is a stored analysis result. Result holds the JSON-encoded
+// AnalysisResult or PerformanceAnalysis and Metrics a snapshot of
+// deterministic metrics; both are omitted in listings.
+type Analysis struct {
+	ID        string          `json:"id"`
+	Tenant    string          `json:"tenant"`
+	Kind      string          `json:"kind"` // "logs" or "performance"
+	CreatedAt time.Time       `json:"created_at"`
+	Size      int64           `json:"size,omitempty"` // bytes stored; set in listings
+	Source    AnalysisSource  `json:"source"`
+	Metrics   json.RawMessage `json:"metrics,omitempty"`
+	Result    json.RawMessage `json:"result,omitempty"`
+}
+
+// analysesIndexFile holds the metadata and metrics of a tenant's analyses,
+// so that listing them doesn't read every analysis.
+const analysesIndexFile = "index.json"
+
+// AnalysisStore keeps analysis results under dir as one JSON file per
+// analysis, in one directory per tenant, along with an index of the
+// tenant's analyses and its baselines.
+type AnalysisStore struct {
+	dir    string
+	sealer *sealer
+	mu     sync.Mutex // serializes index and baseline updates
+}
+
+func NewAnalysisStore(dir string) *AnalysisStore {
+	return &AnalysisStore{dir: dir}
+}
+
+// SetKey encrypts analyses written from now on with AES-256-GCM under key.
+// Those stored unencrypted can only be read with allowPlaintext, which is
+// meant for migrating them.
+func (s *AnalysisStore) SetKey(key []byte, allowPlaintext bool) error {
+	sealer, err := newSealer(key, allowPlaintext)
+	if err != nil {
+		return err
+	}
+	s.sealer = sealer
+	return nil
+}
+
+func (s *AnalysisStore) path(tenant, id string) string {
+	return filepath.Join(tenantDir(s.dir, tenant), id+".json")
+}
+
+// aad is the additional authenticated data for the file name of a tenant.
+func (s *AnalysisStore) aad(tenant, name string) string {
+	return tenant + "/analyses/" + name
+}
+
+// Save stores result and its metrics snapshot as a new analysis of kind for
+// tenant.
+func (s *AnalysisStore) Save(tenant, kind string, source AnalysisSource, metrics, result interface{}) (Analysis, error) {
+	id, err := newID()
+	if err != nil {
+		return Analysis{}, fmt.Errorf("error generating analysis id: %v", err)
+	}
+	raw, err := json.Marshal(result)
+	if err != nil {
+		return Analysis{}, fmt.Errorf("error encoding analysis: %v", err)
+	}
+	rawMetrics, err := json.Marshal(metrics)
+	if err != nil {
+		return Analysis{}, fmt.Errorf("error encoding analysis metrics: %v", err)
+	}
+	analysis := Analysis{
+		ID:        id,
+		Tenant:    tenant,
+		Kind:      kind,
+		CreatedAt: time.Now().UTC(),
+		Source:    source,
+		Metrics:   rawMetrics,
+		Result:    raw,
+	}
+
+	data, err := json.Marshal(analysis)
+	if err != nil {
+		return Analysis{}, fmt.Errorf("error encoding analysis: %v", err)
+	}
+	if s.sealer != nil {
+		if data, err = s.sealer.seal(data, s.aad(tenant, id)); err != nil {
+			return Analysis{}, fmt.Errorf("error encrypting analysis: %v", err)
+		}
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	index, err := s.readIndex(tenant)
+	if err != nil {
+		return Analysis{}, fmt.Errorf("error reading analyses index: %v", err)
+	}
+	if err := os.MkdirAll(tenantDir(s.dir, tenant), 0755); err != nil {
+		return Analysis{}, fmt.Errorf("failed to create analyses directory: %v", err)
+	}
+	if err := os.WriteFile(s.path(tenant, id), data, 0600); err != nil {
+		return Analysis{}, fmt.Errorf("error writing analysis: %v", err)
+	}
+	entry := analysis
+	entry.Size = int64(len(data))
+	entry.Result = nil
+	if err := s.writeIndex(tenant, append(index, entry)); err != nil {
+		os.Remove(s.path(tenant, id))
+		return Analysis{}, fmt.Errorf("error updating analyses index: %v", err)
+	}
+	return analysis, nil
+}
+
+func (s *AnalysisStore) indexPath(tenant string) string {
+	return filepath.Join(tenantDir(s.dir, tenant), analysesIndexFile)
+}
+
+// readIndex returns the tenant's index, oldest analysis first. Tenants
+// whose analyses were stored without an index get one built from the
+// analysis files. Callers hold s.mu.
+func (s *AnalysisStore) readIndex(tenant string) ([]Analysis, error) {
+	data, err := os.ReadFile(s.indexPath(tenant))
+	if os.IsNotExist(err) {
+		return s.rebuildIndex(tenant)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if data, err = s.sealer.open(data, s.aad(tenant, analysesIndexFile)); err != nil {
+		return nil, err
+	}
+	var index []Analysis
+	if err := json.Unmarshal(data, &index); err != nil {
+		return nil, fmt.Errorf("error decoding analyses index: %v", err)
+	}
+	return index, nil
+}
+
+func (s *AnalysisStore) rebuildIndex(tenant string) ([]Analysis, error) {
+	ids, err := s.ids(tenant)
+	if err != nil || len(ids) == 0 {
+		return nil, err
+	}
+	index := make([]Analysis, 0, len(ids))
+	for _, id := range ids {
+		analysis, size, err := s.load(tenant, id)
+		if err != nil {
+			return nil, err
+		}
+		analysis.Size = size
+		analysis.Result = nil
+		index = append(index, analysis)
+	}
+	sort.Slice(index, func(i, j int) bool {
+		return index[i].CreatedAt.Before(index[j].CreatedAt)
+	})
+	if err := s.writeIndex(tenant, index); err != nil {
+		return nil, err
+	}
+	return index, nil
+}
+
+// writeIndex replaces the tenant's index. Callers hold s.mu.
+func (s *AnalysisStore) writeIndex(tenant string, index []Analysis) error {
+	data, err := json.Marshal(index)
+	if err != nil {
+		return err
+	}
+	if s.sealer != nil {
+		if data, err = s.sealer.seal(data, s.aad(tenant, analysesIndexFile)); err != nil {
+			return fmt.Errorf("error encrypting analyses index: %v", err)
+		}
+	}
+	if err := os.MkdirAll(tenantDir(s.dir, tenant), 0755); err != nil {
+		return fmt.Errorf("failed to create analyses directory: %v", err)
+	}
+	path := s.indexPath(tenant)
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0600); err != nil {
+		return err
+	}
+	return os.Rename(tmp, path)
+}
+
+// Get returns the tenant's analysis id, including its result.
+func (s *AnalysisStore) Get(tenant, id string) (Analysis, error) {
+	analysis, _, err := s.load(tenant, id)
+	return analysis, err
+}
+
+// load returns the tenant's analysis id and the size of its file.
+func (s *AnalysisStore) load(tenant, id string) (Analysis, int64, error) {
+	if !idPattern.MatchString(id) {
+		return Analysis{}, 0, ErrNotFound
+	}
+	data, err := os.ReadFile(s.path(tenant, id))
+	if os.IsNotExist(err) {
+		return Analysis{}, 0, ErrNotFound
+	}
+	if err != nil {
+		return Analysis{}, 0, err
+	}
+	size := int64(len(data))
+	if data, err = s.sealer.open(data, s.aad(tenant, id)); err != nil {
+		return Analysis{}, 0, err
+	}
+
+	var analysis Analysis
+	if err := json.Unmarshal(data, &analysis); err != nil {
+		return Analysis{}, 0, fmt.Errorf("error decoding analysis %s: %v", id, err)
+	}
+	return analysis, size, nil
+}
+
+// List returns the tenant's analyses of kind, or of every kind if kind is
+// empty, newest first and without their results and metrics.
+func (s *AnalysisStore) List(tenant, kind string) ([]Analysis, error) {
+	analyses, err := s.History(tenant, kind)
+	if err != nil {
+		return nil, err
+	}
+	for i := range analyses {
+		analyses[i].Metrics = nil
+	}
+	return analyses, nil
+}
+
+// History is List with the metrics snapshot of each analysis, read from
+// the tenant's index rather than the analyses themselves.
+func (s *AnalysisStore) History(tenant, kind string) ([]Analysis, error) {
+	s.mu.Lock()
+	index, err := s.readIndex(tenant)
+	s.mu.Unlock()
+	if err != nil {
+		return nil, err
+	}
+
+	analyses := make([]Analysis, 0, len(index))
+	for i := len(index) - 1; i >= 0; i-- {
+		if kind == "" || index[i].Kind == kind {
+			analyses = append(analyses, index[i])
+		}
+	}
+	return analyses, nil
+}
+
+func (s *AnalysisStore) ids(tenant string) ([]string, error) {
+	entries, err := os.ReadDir(tenantDir(s.dir, tenant))
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var ids []string
+	for _, entry := range entries {
+		id, ok := strings.CutSuffix(entry.Name(), ".json")
+		if !entry.IsDir() && ok && idPattern.MatchString(id) {
+			ids = append(ids, id)
+		}
+	}
+	return ids, nil
+}
+
+// Tenants returns the tenants with analyses or baselines.
+func (s *AnalysisStore) Tenants() ([]string, error) {
+	return listTenants(s.dir)
+}
+
+// Delete removes the tenant's analysis id. An index entry whose file is
+// already gone is dropped, and ErrNotFound is still returned.
+func (s *AnalysisStore) Delete(tenant, id string) error {
+	if !idPattern.MatchString(id) {
+		return ErrNotFound
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	index, err := s.readIndex(tenant)
+	if err != nil {
+		return err
+	}
+	removeErr := os.Remove(s.path(tenant, id))
+	if removeErr != nil && !os.IsNotExist(removeErr) {
+		return removeErr
+	}
+	kept := index[:0]
+	for _, analysis := range index {
+		if analysis.ID != id {
+			kept = append(kept, analysis)
+		}
+	}
+	if len(kept) < len(index) {
+		if err := s.writeIndex(tenant, kept); err != nil {
+			return err
+		}
+	}
+	if removeErr != nil {
+		return ErrNotFound
+	}
+	return nil
+}
+
+// Cleanup removes analyses of every tenant stored more than maxAge ago and
+// returns how many were deleted. Baselines are kept.
+func (s *AnalysisStore) Cleanup(maxAge time.Duration) (int, error) {
+	tenants, err := s.Tenants()
+	if err != nil {
+		return 0, err
+	}
+	cutoff := time.Now().Add(-maxAge)
+	removed := 0
+	for _, tenant := range tenants {
+		n, err := s.cleanupTenant(tenant, cutoff)
+		removed += n
+		if err != nil {
+			return removed, err
+		}
+	}
+	return removed, nil
+}
+
+func (s *AnalysisStore) cleanupTenant(tenant string, cutoff time.Time) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	index, err := s.readIndex(tenant)
+	if err != nil || len(index) == 0 || !index[0].CreatedAt.Before(cutoff) {
+		return 0, err
+	}
+	kept := index[:0]
+	removed := 0
+	var removeErr error
+	for _, analysis := range index {
+		if !analysis.CreatedAt.Before(cutoff) {
+			kept = append(kept, analysis)
+			continue
+		}
+		if err := os.Remove(s.path(tenant, analysis.ID)); err != nil && !os.IsNotExist(err) {
+			if removeErr == nil {
+				removeErr = err
+			}
+			kept = append(kept, analysis)
+			continue
+		}
+		removed++
+	}
+	if err := s.writeIndex(tenant, kept); err != nil {
+		return removed, err
+	}
+	return removed, removeErr
+}
+
+// DeleteTenant removes every analysis and baseline of tenant and returns the
+// analysis IDs.
+func (s *AnalysisStore) DeleteTenant(tenant string) ([]string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	ids, err := s.ids(tenant)
+	if err != nil {
+		return nil, err
+	}
+	if err := os.RemoveAll(tenantDir(s.dir, tenant)); err != nil {
+		return nil, err
+	}
+	if ids == nil {
+		ids = []string{}
+	}
+	return ids, nil
+}
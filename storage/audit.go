@@ -0,0 +1,182 @@
+package storage
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"analyticsai/ai-service/analytics"
+)
+
+const auditDayLayout = "2006-01-02"
+
+// AuditRecord is one API request in the audit log.
+type AuditRecord struct {
+	Time          time.Time `json:"time"`
+	Tenant        string    `json:"tenant,omitempty"`
+	Credential    string    `json:"credential,omitempty"` // fingerprint of the API key or token presented
+	ClientIP      string    `json:"client_ip"`
+	UserAgent     string    `json:"user_agent,omitempty"`
+	Method        string    `json:"method"`
+	Path          string    `json:"path"`
+	Query         string    `json:"query,omitempty"`
+	Status        int       `json:"status"`
+	RequestBytes  int64     `json:"request_bytes"`
+	ResponseBytes int64     `json:"response_bytes"`
+	DurationMS    int64     `json:"duration_ms"`
+	Internal      bool      `json:"internal,omitempty"` // made by the service itself, e.g. a scheduled analysis
+	// Models are the model calls made for the request, by model.
+	Models map[string]analytics.ModelUsage `json:"models,omitempty"`
+	// Limit names the tenant limit that rejected the request, if any.
+	Limit string `json:"limit,omitempty"`
+}
+
+// AuditQuery selects audit records. From is required; other zero fields
+// match every record.
+type AuditQuery struct {
+	From, To   time.Time
+	Tenant     string
+	PathPrefix string
+	Status     int
+}
+
+func (q AuditQuery) matches(r AuditRecord) bool {
+	return !r.Time.Before(q.From) && (q.To.IsZero() || r.Time.Before(q.To)) &&
+		(q.Tenant == "" || r.Tenant == q.Tenant) &&
+		strings.HasPrefix(r.Path, q.PathPrefix) &&
+		(q.Status == 0 || r.Status == q.Status)
+}
+
+// AuditLog appends audit records to one JSON Lines file per UTC day under
+// dir. Files are only ever appended to; nothing in the service rewrites or
+// deletes them.
+type AuditLog struct {
+	dir string
+	mu  sync.Mutex
+	f   *os.File // file of the day being written
+	day string
+}
+
+func NewAuditLog(dir string) *AuditLog {
+	return &AuditLog{dir: dir}
+}
+
+func (l *AuditLog) path(day string) string {
+	return filepath.Join(l.dir, "audit-"+day+".jsonl")
+}
+
+// Append adds r to the file of its day.
+func (l *AuditLog) Append(r AuditRecord) error {
+	line, err := json.Marshal(r)
+	if err != nil {
+		return fmt.Errorf("error encoding audit record: %v", err)
+	}
+	day := r.Time.UTC().Format(auditDayLayout)
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.f == nil || l.day != day {
+		if l.f != nil {
+			l.f.Close()
+			l.f = nil
+		}
+		if err := os.MkdirAll(l.dir, 0755); err != nil {
+			return fmt.Errorf("failed to create audit directory: %v", err)
+		}
+		f, err := os.OpenFile(l.path(day), os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0600)
+		if err != nil {
+			return err
+		}
+		l.f, l.day = f, day
+	}
+	_, err = l.f.Write(append(line, '\n'))
+	return err
+}
+
+// Bounds of audit queries, so that no query can hold the service up reading
+// years of records or hold them all in memory.
+const (
+	MaxAuditQueryRange = 93 * 24 * time.Hour // a quarter
+	MaxAuditRecords    = 10000
+)
+
+// ErrAuditQueryRange is returned for queries spanning more than
+// MaxAuditQueryRange.
+var ErrAuditQueryRange = fmt.Errorf("audit queries may span at most %d days", MaxAuditQueryRange/(24*time.Hour))
+
+// Scan calls fn with the records matching q, day by day from the oldest.
+// Lines that can't be decoded, such as one cut short by a crash, are
+// skipped. Scan doesn't hold up Append: the files are only appended to,
+// and a line still being written reads as one cut short.
+func (l *AuditLog) Scan(q AuditQuery, fn func(AuditRecord)) error {
+	if q.From.IsZero() {
+		return fmt.Errorf("audit query needs a start time")
+	}
+	to := q.To
+	if to.IsZero() {
+		to = time.Now()
+	}
+	if to.Sub(q.From) > MaxAuditQueryRange {
+		return ErrAuditQueryRange
+	}
+	for day := q.From.UTC().Truncate(24 * time.Hour); day.Before(to); day = day.AddDate(0, 0, 1) {
+		f, err := os.Open(l.path(day.Format(auditDayLayout)))
+		if os.IsNotExist(err) {
+			continue
+		}
+		if err != nil {
+			return err
+		}
+		scanner := bufio.NewScanner(f)
+		scanner.Buffer(nil, 1<<20)
+		for scanner.Scan() {
+			var r AuditRecord
+			if json.Unmarshal(scanner.Bytes(), &r) == nil && q.matches(r) {
+				fn(r)
+			}
+		}
+		err = scanner.Err()
+		f.Close()
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Query returns the newest MaxAuditRecords records matching q, newest
+// first, and whether older ones were left out.
+func (l *AuditLog) Query(q AuditQuery) ([]AuditRecord, bool, error) {
+	records := []AuditRecord{}
+	truncated := false
+	err := l.Scan(q, func(r AuditRecord) {
+		records = append(records, r)
+		// Records come roughly oldest first; drop the oldest in chunks
+		// rather than on every append.
+		if len(records) == 2*MaxAuditRecords {
+			sortNewestFirst(records)
+			records = append(records[:0], records[:MaxAuditRecords]...)
+			truncated = true
+		}
+	})
+	if err != nil {
+		return nil, false, err
+	}
+	sortNewestFirst(records)
+	if len(records) > MaxAuditRecords {
+		records, truncated = records[:MaxAuditRecords], true
+	}
+	return records, truncated, nil
+}
+
+func sortNewestFirst(records []AuditRecord) {
+	sort.SliceStable(records, func(i, j int) bool {
+		return records[i].Time.After(records[j].Time)
+	})
+}
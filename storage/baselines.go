@@ -0,0 +1,105 @@
+package storage
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+)
+
+const baselinesFile = "baselines.json"
+
+// Baseline names a stored analysis that later analyses of the same source
+// and kind are compared against.
+type Baseline struct {
+	Name               string    `json:"name"`
+	AnalysisID         string    `json:"analysis_id"`
+	Kind               string    `json:"kind"`
+	Source             string    `json:"source,omitempty"`
+	ErrorRateThreshold float64   `json:"error_rate_threshold,omitempty"` // percentage points
+	LatencyThreshold   float64   `json:"latency_threshold,omitempty"`    // percent of p95
+	CreatedAt          time.Time `json:"created_at"`
+}
+
+func (s *AnalysisStore) baselinesPath(tenant string) string {
+	return filepath.Join(tenantDir(s.dir, tenant), baselinesFile)
+}
+
+func (s *AnalysisStore) readBaselines(tenant string) (map[string]Baseline, error) {
+	baselines := make(map[string]Baseline)
+	data, err := os.ReadFile(s.baselinesPath(tenant))
+	if os.IsNotExist(err) {
+		return baselines, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if data, err = s.sealer.open(data, s.aad(tenant, baselinesFile)); err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(data, &baselines); err != nil {
+		return nil, fmt.Errorf("error decoding baselines: %v", err)
+	}
+	return baselines, nil
+}
+
+func (s *AnalysisStore) writeBaselines(tenant string, baselines map[string]Baseline) error {
+	data, err := json.Marshal(baselines)
+	if err != nil {
+		return err
+	}
+	if s.sealer != nil {
+		if data, err = s.sealer.seal(data, s.aad(tenant, baselinesFile)); err != nil {
+			return fmt.Errorf("error encrypting baselines: %v", err)
+		}
+	}
+	if err := os.MkdirAll(tenantDir(s.dir, tenant), 0755); err != nil {
+		return fmt.Errorf("failed to create analyses directory: %v", err)
+	}
+	return os.WriteFile(s.baselinesPath(tenant), data, 0600)
+}
+
+// Baselines returns the tenant's baselines ordered by name.
+func (s *AnalysisStore) Baselines(tenant string) ([]Baseline, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	byName, err := s.readBaselines(tenant)
+	if err != nil {
+		return nil, err
+	}
+	baselines := make([]Baseline, 0, len(byName))
+	for _, b := range byName {
+		baselines = append(baselines, b)
+	}
+	sort.Slice(baselines, func(i, j int) bool { return baselines[i].Name < baselines[j].Name })
+	return baselines, nil
+}
+
+// SetBaseline creates or replaces the tenant's baseline b.Name.
+func (s *AnalysisStore) SetBaseline(tenant string, b Baseline) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	baselines, err := s.readBaselines(tenant)
+	if err != nil {
+		return err
+	}
+	baselines[b.Name] = b
+	return s.writeBaselines(tenant, baselines)
+}
+
+// DeleteBaseline removes the tenant's baseline name.
+func (s *AnalysisStore) DeleteBaseline(tenant, name string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	baselines, err := s.readBaselines(tenant)
+	if err != nil {
+		return err
+	}
+	if _, ok := baselines[name]; !ok {
+		return ErrNotFound
+	}
+	delete(baselines, name)
+	return s.writeBaselines(tenant, baselines)
+}
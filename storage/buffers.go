@@ -0,0 +1,241 @@
+package storage
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+)
+
+const journalExt = ".jsonl"
+
+// StoredBuffer names a log buffer with a journal on disk.
+type StoredBuffer struct {
+	Tenant string
+	Name   string
+}
+
+// BufferStore keeps the journals of log buffers under dir, one directory
+// per tenant and one file per buffer. Each line of a journal is a JSON
+// record; with a key set, records are encrypted and base64-encoded.
+type BufferStore struct {
+	dir    string
+	sealer *sealer
+	mu     sync.Mutex
+}
+
+func NewBufferStore(dir string) *BufferStore {
+	return &BufferStore{dir: dir}
+}
+
+// SetKey encrypts records written from now on with AES-256-GCM under key.
+// Those stored unencrypted can only be read with allowPlaintext, which is
+// meant for migrating them.
+func (s *BufferStore) SetKey(key []byte, allowPlaintext bool) error {
+	sealer, err := newSealer(key, allowPlaintext)
+	if err != nil {
+		return err
+	}
+	s.sealer = sealer
+	return nil
+}
+
+// path returns the journal of the tenant's buffer name. Buffer names are
+// validated by the caller, but must not leave the tenant's directory.
+func (s *BufferStore) path(tenant, name string) (string, error) {
+	if name == "" || name != filepath.Base(name) || strings.HasPrefix(name, ".") {
+		return "", fmt.Errorf("invalid buffer name %q", name)
+	}
+	return filepath.Join(tenantDir(s.dir, tenant), name+journalExt), nil
+}
+
+func (s *BufferStore) aad(tenant, name string) string {
+	return tenant + "/" + name + journalExt
+}
+
+// encode returns record as a journal line.
+func (s *BufferStore) encode(tenant, name string, record []byte) ([]byte, error) {
+	if s.sealer == nil {
+		return append(bytes.TrimSpace(record), '\n'), nil
+	}
+	sealed, err := s.sealer.seal(record, s.aad(tenant, name))
+	if err != nil {
+		return nil, fmt.Errorf("error encrypting buffer record: %v", err)
+	}
+	return append([]byte(base64.StdEncoding.EncodeToString(sealed)), '\n'), nil
+}
+
+// Append adds record to the journal of the tenant's buffer name.
+func (s *BufferStore) Append(tenant, name string, record []byte) error {
+	path, err := s.path(tenant, name)
+	if err != nil {
+		return err
+	}
+	line, err := s.encode(tenant, name, record)
+	if err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return fmt.Errorf("failed to create buffers directory: %v", err)
+	}
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0600)
+	if err != nil {
+		return err
+	}
+	if _, err := f.Write(line); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// Rewrite replaces the journal of the tenant's buffer name with records.
+func (s *BufferStore) Rewrite(tenant, name string, records [][]byte) error {
+	path, err := s.path(tenant, name)
+	if err != nil {
+		return err
+	}
+	var data []byte
+	for _, record := range records {
+		line, err := s.encode(tenant, name, record)
+		if err != nil {
+			return err
+		}
+		data = append(data, line...)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return fmt.Errorf("failed to create buffers directory: %v", err)
+	}
+	// Write a new file and rename it over the journal, so a crash leaves
+	// either the old journal or the new one.
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0600); err != nil {
+		return err
+	}
+	return os.Rename(tmp, path)
+}
+
+// Load returns the records of the journal of the tenant's buffer name,
+// decrypted if needed.
+func (s *BufferStore) Load(tenant, name string) ([][]byte, error) {
+	path, err := s.path(tenant, name)
+	if err != nil {
+		return nil, err
+	}
+	s.mu.Lock()
+	data, err := os.ReadFile(path)
+	s.mu.Unlock()
+	if os.IsNotExist(err) {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var records [][]byte
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	scanner.Buffer(nil, len(data)+1)
+	for line := 1; scanner.Scan(); line++ {
+		text := bytes.TrimSpace(scanner.Bytes())
+		if len(text) == 0 {
+			continue
+		}
+		// Records written without a key are plain JSON, which the sealer
+		// passes through unless plaintext reads are disallowed.
+		sealed := append([]byte(nil), text...)
+		if text[0] != '{' {
+			if sealed, err = base64.StdEncoding.DecodeString(string(text)); err != nil {
+				return nil, fmt.Errorf("%s line %d: invalid record", filepath.Base(path), line)
+			}
+		}
+		record, err := s.sealer.open(sealed, s.aad(tenant, name))
+		if err != nil {
+			return nil, fmt.Errorf("%s line %d: %v", filepath.Base(path), line, err)
+		}
+		records = append(records, record)
+	}
+	return records, scanner.Err()
+}
+
+// List returns every buffer with a journal.
+func (s *BufferStore) List() ([]StoredBuffer, error) {
+	tenants, err := os.ReadDir(s.dir)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var buffers []StoredBuffer
+	for _, t := range tenants {
+		tenant, err := hex.DecodeString(t.Name())
+		if !t.IsDir() || err != nil {
+			continue
+		}
+		files, err := os.ReadDir(filepath.Join(s.dir, t.Name()))
+		if err != nil {
+			return nil, err
+		}
+		for _, f := range files {
+			if name, ok := strings.CutSuffix(f.Name(), journalExt); ok && !f.IsDir() {
+				buffers = append(buffers, StoredBuffer{Tenant: string(tenant), Name: name})
+			}
+		}
+	}
+	return buffers, nil
+}
+
+// Delete removes the journal of the tenant's buffer name, if any.
+func (s *BufferStore) Delete(tenant, name string) error {
+	path, err := s.path(tenant, name)
+	if err != nil {
+		return err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	return nil
+}
+
+// Size returns the bytes taken by the journals of the tenant's buffers.
+func (s *BufferStore) Size(tenant string) (int64, error) {
+	entries, err := os.ReadDir(tenantDir(s.dir, tenant))
+	if os.IsNotExist(err) {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, err
+	}
+	var size int64
+	for _, entry := range entries {
+		if entry.IsDir() || !strings.HasSuffix(entry.Name(), journalExt) {
+			continue
+		}
+		info, err := entry.Info()
+		if err != nil {
+			return 0, err
+		}
+		size += info.Size()
+	}
+	return size, nil
+}
+
+// DeleteTenant removes the journals of every buffer of tenant.
+func (s *BufferStore) DeleteTenant(tenant string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return os.RemoveAll(tenantDir(s.dir, tenant))
+}
@@ -0,0 +1,114 @@
+package storage
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+)
+
+// encryptedMagic prefixes files written with encryption enabled, so that
+// files stored before it was turned on can still be read.
+var encryptedMagic = []byte("AIENC1\n")
+
+// ErrNoKey is returned when reading an encrypted file without a key.
+var ErrNoKey = errors.New("file is encrypted but no encryption key is configured")
+
+// ErrNotEncrypted is returned when reading a file stored without
+// encryption while a key is set, unless plaintext reads are allowed for
+// migrating such files.
+var ErrNotEncrypted = errors.New("file is not encrypted and plaintext reads are not allowed")
+
+// ParseKey decodes a base64-encoded AES-256 key.
+func ParseKey(encoded string) ([]byte, error) {
+	key, err := base64.StdEncoding.DecodeString(strings.TrimSpace(encoded))
+	if err != nil {
+		return nil, fmt.Errorf("encryption key is not valid base64: %v", err)
+	}
+	if len(key) != 32 {
+		return nil, fmt.Errorf("encryption key must be 32 bytes, got %d", len(key))
+	}
+	return key, nil
+}
+
+// LoadKey reads the encryption key from the environment: the base64 value
+// of envVar, or the contents of the file named by envVar+"_FILE" (for keys
+// mounted from a secret manager). It returns nil when neither is set.
+func LoadKey(envVar string) ([]byte, error) {
+	if encoded := os.Getenv(envVar); encoded != "" {
+		return ParseKey(encoded)
+	}
+	if path := os.Getenv(envVar + "_FILE"); path != "" {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return nil, fmt.Errorf("error reading encryption key file: %v", err)
+		}
+		return ParseKey(string(data))
+	}
+	return nil, nil
+}
+
+// sealer encrypts files with AES-256-GCM. The additional data binds each
+// file to its name, so ciphertexts can't be swapped between tenants or
+// uploads. Unless allowPlaintext is set, it refuses to read files that
+// aren't encrypted, so that a file planted or left in the clear can't pass
+// for one the service wrote.
+type sealer struct {
+	aead           cipher.AEAD
+	allowPlaintext bool
+}
+
+func newSealer(key []byte, allowPlaintext bool) (*sealer, error) {
+	if len(key) != 32 {
+		return nil, fmt.Errorf("encryption key must be 32 bytes, got %d", len(key))
+	}
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	aead, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, err
+	}
+	return &sealer{aead: aead, allowPlaintext: allowPlaintext}, nil
+}
+
+func (s *sealer) seal(plaintext []byte, name string) ([]byte, error) {
+	nonce := make([]byte, s.aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, err
+	}
+	out := append([]byte{}, encryptedMagic...)
+	out = append(out, nonce...)
+	return s.aead.Seal(out, nonce, plaintext, []byte(name)), nil
+}
+
+// open decrypts data written by seal. Other data is returned unchanged if
+// s is nil or allows plaintext, and rejected with ErrNotEncrypted
+// otherwise.
+func (s *sealer) open(data []byte, name string) ([]byte, error) {
+	if !bytes.HasPrefix(data, encryptedMagic) {
+		if s != nil && !s.allowPlaintext {
+			return nil, ErrNotEncrypted
+		}
+		return data, nil
+	}
+	if s == nil {
+		return nil, ErrNoKey
+	}
+	data = data[len(encryptedMagic):]
+	if len(data) < s.aead.NonceSize() {
+		return nil, fmt.Errorf("encrypted file is truncated")
+	}
+	nonce, ciphertext := data[:s.aead.NonceSize()], data[s.aead.NonceSize():]
+	plaintext, err := s.aead.Open(nil, nonce, ciphertext, []byte(name))
+	if err != nil {
+		return nil, fmt.Errorf("error decrypting file: %v", err)
+	}
+	return plaintext, nil
+}
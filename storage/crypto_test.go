@@ -0,0 +1,152 @@
+package storage
+
+import (
+	"bytes"
+	"encoding/base64"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func testKey(b byte) []byte {
+	return bytes.Repeat([]byte{b}, 32)
+}
+
+func TestSealOpen(t *testing.T) {
+	s, err := newSealer(testKey(1), false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	plaintext := []byte(`[{"path":"/checkout","status":500}]`)
+
+	sealed, err := s.seal(plaintext, "team-a/upload.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.HasPrefix(sealed, encryptedMagic) || bytes.Contains(sealed, plaintext) {
+		t.Fatalf("sealed data isn't marked or still holds the plaintext: %q", sealed)
+	}
+	again, _ := s.seal(plaintext, "team-a/upload.json")
+	if bytes.Equal(sealed, again) {
+		t.Error("sealing twice gave the same ciphertext; nonces must differ")
+	}
+	got, err := s.open(sealed, "team-a/upload.json")
+	if err != nil || !bytes.Equal(got, plaintext) {
+		t.Fatalf("open = %q, %v; want the plaintext", got, err)
+	}
+
+	other, _ := newSealer(testKey(2), false)
+	tampered := func(i int) []byte {
+		b := append([]byte{}, sealed...)
+		b[i] ^= 0x01
+		return b
+	}
+	rejected := []struct {
+		name string
+		s    *sealer
+		data []byte
+		aad  string
+	}{
+		{"other name", s, sealed, "team-b/upload.json"},
+		{"other key", other, sealed, "team-a/upload.json"},
+		{"flipped nonce", s, tampered(len(encryptedMagic)), "team-a/upload.json"},
+		{"flipped ciphertext", s, tampered(len(sealed) - 20), "team-a/upload.json"},
+		{"flipped tag", s, tampered(len(sealed) - 1), "team-a/upload.json"},
+		{"truncated", s, sealed[:len(sealed)-1], "team-a/upload.json"},
+		{"nonce only", s, sealed[:len(encryptedMagic)+5], "team-a/upload.json"},
+	}
+	for _, tt := range rejected {
+		if got, err := tt.s.open(tt.data, tt.aad); err == nil {
+			t.Errorf("%s: opened as %q, want an error", tt.name, got)
+		}
+	}
+
+	var none *sealer
+	if _, err := none.open(sealed, "team-a/upload.json"); !errors.Is(err, ErrNoKey) {
+		t.Errorf("open without key: err = %v, want ErrNoKey", err)
+	}
+	// Files written before encryption was enabled are refused with a key,
+	// unless they are being migrated, and pass through without one.
+	if got, err := s.open(plaintext, "team-a/upload.json"); !errors.Is(err, ErrNotEncrypted) {
+		t.Errorf("strict open of unencrypted data = %q, %v; want ErrNotEncrypted", got, err)
+	}
+	migrating, _ := newSealer(testKey(1), true)
+	for _, s := range []*sealer{migrating, none} {
+		if got, err := s.open(plaintext, "team-a/upload.json"); err != nil || !bytes.Equal(got, plaintext) {
+			t.Errorf("open of unencrypted data = %q, %v; want it unchanged", got, err)
+		}
+	}
+	if got, err := migrating.open(sealed, "team-a/upload.json"); err != nil || !bytes.Equal(got, plaintext) {
+		t.Errorf("migrating open = %q, %v; want the plaintext", got, err)
+	}
+}
+
+func TestUploadStoreEncryption(t *testing.T) {
+	dir := t.TempDir()
+	store := NewUploadStore(dir)
+	plain, err := store.Save("team-a", "before.json", []byte("written in the clear"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := store.SetKey(testKey(7), true); err != nil {
+		t.Fatal(err)
+	}
+	upload, err := store.Save("team-a", "logs.json", []byte("secret log lines"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	path, _ := store.path("team-a", upload.ID)
+	raw, _ := os.ReadFile(path)
+	if bytes.Contains(raw, []byte("secret log lines")) {
+		t.Error("upload is stored in the clear")
+	}
+	if got, err := store.Load("team-a", upload.ID); err != nil || string(got) != "secret log lines" {
+		t.Errorf("Load = %q, %v", got, err)
+	}
+	if got, err := store.Load("team-a", plain.ID); err != nil || string(got) != "written in the clear" {
+		t.Errorf("Load of an upload stored before encryption = %q, %v", got, err)
+	}
+	strict := NewUploadStore(dir)
+	if err := strict.SetKey(testKey(7), false); err != nil {
+		t.Fatal(err)
+	}
+	if got, err := strict.Load("team-a", plain.ID); !errors.Is(err, ErrNotEncrypted) {
+		t.Errorf("strict Load of an upload stored before encryption = %q, %v; want ErrNotEncrypted", got, err)
+	}
+	if got, err := strict.Load("team-a", upload.ID); err != nil || string(got) != "secret log lines" {
+		t.Errorf("strict Load = %q, %v", got, err)
+	}
+
+	// A ciphertext moved into another tenant's directory doesn't open
+	// there, as its name is bound into the additional data.
+	moved := filepath.Join(store.tenantDir("team-b"), filepath.Base(path))
+	os.MkdirAll(filepath.Dir(moved), 0755)
+	os.WriteFile(moved, raw, 0600)
+	if got, err := store.Load("team-b", upload.ID); err == nil {
+		t.Errorf("upload moved to another tenant opened as %q", got)
+	}
+
+	raw[len(raw)-1] ^= 0x80
+	os.WriteFile(path, raw, 0600)
+	if got, err := store.Load("team-a", upload.ID); err == nil {
+		t.Errorf("tampered upload opened as %q", got)
+	}
+
+	if err := NewUploadStore(dir).SetKey(testKey(7)[:16], false); err == nil {
+		t.Error("SetKey accepted a 16-byte key")
+	}
+}
+
+func TestParseKey(t *testing.T) {
+	valid := base64.StdEncoding.EncodeToString(testKey(3))
+	if key, err := ParseKey(" " + valid + "\n"); err != nil || !bytes.Equal(key, testKey(3)) {
+		t.Errorf("ParseKey(valid) = %x, %v", key, err)
+	}
+	for _, encoded := range []string{"", "not base64!", base64.StdEncoding.EncodeToString(testKey(3)[:16])} {
+		if _, err := ParseKey(encoded); err == nil {
+			t.Errorf("ParseKey(%q) accepted an invalid key", encoded)
+		}
+	}
+}
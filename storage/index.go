@@ -0,0 +1,96 @@
+package storage
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+)
+
+const indexFile = "semantic-index.json"
+
+// IndexStore keeps the semantic index of each tenant under dir, as one file
+// in the tenant's directory. It implements analytics.IndexStore.
+type IndexStore struct {
+	dir    string
+	sealer *sealer
+}
+
+func NewIndexStore(dir string) *IndexStore {
+	return &IndexStore{dir: dir}
+}
+
+// SetKey encrypts indexes written from now on with AES-256-GCM under key.
+// Those stored unencrypted can only be read with allowPlaintext, which is
+// meant for migrating them.
+func (s *IndexStore) SetKey(key []byte, allowPlaintext bool) error {
+	sealer, err := newSealer(key, allowPlaintext)
+	if err != nil {
+		return err
+	}
+	s.sealer = sealer
+	return nil
+}
+
+func (s *IndexStore) path(tenant string) string {
+	return filepath.Join(tenantDir(s.dir, tenant), indexFile)
+}
+
+// aad binds an index to its tenant.
+func (s *IndexStore) aad(tenant string) string {
+	return tenant + "/" + indexFile
+}
+
+// Tenants returns the tenants with a stored index.
+func (s *IndexStore) Tenants() ([]string, error) {
+	all, err := listTenants(s.dir)
+	if err != nil {
+		return nil, err
+	}
+	tenants := all[:0]
+	for _, tenant := range all {
+		if _, err := os.Stat(s.path(tenant)); err == nil {
+			tenants = append(tenants, tenant)
+		}
+	}
+	return tenants, nil
+}
+
+// Load returns the tenant's index, decrypted if needed.
+func (s *IndexStore) Load(tenant string) ([]byte, error) {
+	data, err := os.ReadFile(s.path(tenant))
+	if err != nil {
+		return nil, err
+	}
+	return s.sealer.open(data, s.aad(tenant))
+}
+
+// Save replaces the tenant's index with data.
+func (s *IndexStore) Save(tenant string, data []byte) error {
+	if s.sealer != nil {
+		sealed, err := s.sealer.seal(data, s.aad(tenant))
+		if err != nil {
+			return fmt.Errorf("error encrypting semantic index: %v", err)
+		}
+		data = sealed
+	}
+	path := s.path(tenant)
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return fmt.Errorf("failed to create index directory: %v", err)
+	}
+	// Write a new file and rename it over the index, so a crash leaves
+	// either the old index or the new one.
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0600); err != nil {
+		return err
+	}
+	return os.Rename(tmp, path)
+}
+
+// Delete removes the tenant's index, if any.
+func (s *IndexStore) Delete(tenant string) error {
+	err := os.Remove(s.path(tenant))
+	if os.IsNotExist(err) {
+		return nil
+	}
+	return err
+}
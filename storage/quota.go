@@ -0,0 +1,72 @@
+package storage
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+const (
+	quotaFileExt = ".quota.json"
+
+	// quotaFileExpiry is how long the counts of an instance that stopped
+	// saving are kept: longer than the monthly quota period they count in.
+	quotaFileExpiry = 32 * 24 * time.Hour
+)
+
+// QuotaStore keeps the model call counts of each instance as one file under
+// dir. It implements analytics.QuotaStore.
+type QuotaStore struct {
+	dir string
+}
+
+func NewQuotaStore(dir string) *QuotaStore {
+	return &QuotaStore{dir: dir}
+}
+
+// Save replaces the counts of instance with data.
+func (s *QuotaStore) Save(instance string, data []byte) error {
+	if err := os.MkdirAll(s.dir, 0755); err != nil {
+		return err
+	}
+	path := filepath.Join(s.dir, filepath.Base(instance)+quotaFileExt)
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0600); err != nil {
+		return err
+	}
+	return os.Rename(tmp, path)
+}
+
+// Load returns the counts of every instance, by instance. Files of
+// instances that haven't saved for quotaFileExpiry are removed instead.
+func (s *QuotaStore) Load() (map[string][]byte, error) {
+	entries, err := os.ReadDir(s.dir)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	counts := make(map[string][]byte)
+	for _, e := range entries {
+		instance, ok := strings.CutSuffix(e.Name(), quotaFileExt)
+		if !ok || e.IsDir() {
+			continue
+		}
+		path := filepath.Join(s.dir, e.Name())
+		if info, err := e.Info(); err == nil && time.Since(info.ModTime()) > quotaFileExpiry {
+			os.Remove(path)
+			continue
+		}
+		data, err := os.ReadFile(path)
+		if os.IsNotExist(err) {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		counts[instance] = data
+	}
+	return counts, nil
+}
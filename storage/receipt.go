@@ -0,0 +1,36 @@
+package storage
+
+import "time"
+
+// DeletionReceipt records what a deletion request removed, for the
+// requester's compliance records.
+type DeletionReceipt struct {
+	ReceiptID  string    `json:"receipt_id"`
+	Tenant     string    `json:"tenant"`
+	Scope      string    `json:"scope"` // "upload", "analysis" or "tenant"
+	DeletedAt  time.Time `json:"deleted_at"`
+	Uploads    []string  `json:"uploads"`     // IDs of deleted uploads
+	Analyses   []string  `json:"analyses"`    // IDs of deleted analyses
+	Schedules  []string  `json:"schedules"`   // IDs of deleted schedules
+	AlertRules []string  `json:"alert_rules"` // IDs of deleted alert rules
+	Buffers    []string  `json:"buffers"`     // names of deleted log buffers
+}
+
+// NewDeletionReceipt starts a receipt for a deletion in scope.
+func NewDeletionReceipt(tenant, scope string) (*DeletionReceipt, error) {
+	id, err := newID()
+	if err != nil {
+		return nil, err
+	}
+	return &DeletionReceipt{
+		ReceiptID:  id,
+		Tenant:     tenant,
+		Scope:      scope,
+		DeletedAt:  time.Now().UTC(),
+		Uploads:    []string{},
+		Analyses:   []string{},
+		Schedules:  []string{},
+		AlertRules: []string{},
+		Buffers:    []string{},
+	}, nil
+}
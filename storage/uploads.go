@@ -0,0 +1,231 @@
+// Package storage keeps uploaded log files and other per-tenant data on
+// local disk.
+package storage
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"time"
+)
+
+// ErrNotFound is returned for uploads and analyses that don't exist for the
+// tenant.
+var ErrNotFound = errors.New("not found")
+
+// idPattern matches the IDs generated by newID.
+var idPattern = regexp.MustCompile(`^[0-9a-f]{16}$`)
+
+// Upload describes a stored upload.
+type Upload struct {
+	ID        string    `json:"id"`
+	Tenant    string    `json:"tenant"`
+	Filename  string    `json:"filename"`
+	Size      int64     `json:"size"` // bytes stored, including encryption overhead
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// UploadStore keeps uploads under dir, one directory per tenant. Files are
+// named "<id>_<original name>".
+type UploadStore struct {
+	dir    string
+	sealer *sealer
+}
+
+func NewUploadStore(dir string) *UploadStore {
+	return &UploadStore{dir: dir}
+}
+
+// SetKey encrypts uploads written from now on with AES-256-GCM under key.
+// Those stored unencrypted can only be read with allowPlaintext, which is
+// meant for migrating them.
+func (s *UploadStore) SetKey(key []byte, allowPlaintext bool) error {
+	sealer, err := newSealer(key, allowPlaintext)
+	if err != nil {
+		return err
+	}
+	s.sealer = sealer
+	return nil
+}
+
+func (s *UploadStore) tenantDir(tenant string) string {
+	return tenantDir(s.dir, tenant)
+}
+
+// tenantDir returns the tenant's directory under root. Tenant IDs are
+// hex-encoded rather than trusted as path elements.
+func tenantDir(root, tenant string) string {
+	return filepath.Join(root, hex.EncodeToString([]byte(tenant)))
+}
+
+// listTenants returns the tenants with a directory under root.
+func listTenants(root string) ([]string, error) {
+	entries, err := os.ReadDir(root)
+	if os.IsNotExist(err) {
+		return []string{}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	tenants := make([]string, 0, len(entries))
+	for _, entry := range entries {
+		tenant, err := hex.DecodeString(entry.Name())
+		if entry.IsDir() && err == nil {
+			tenants = append(tenants, string(tenant))
+		}
+	}
+	return tenants, nil
+}
+
+func newID() (string, error) {
+	b := make([]byte, 8)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
+
+// Save stores data for tenant and returns the new upload.
+func (s *UploadStore) Save(tenant, filename string, data []byte) (Upload, error) {
+	id, err := newID()
+	if err != nil {
+		return Upload{}, fmt.Errorf("error generating upload id: %v", err)
+	}
+	dir := s.tenantDir(tenant)
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return Upload{}, fmt.Errorf("failed to create uploads directory: %v", err)
+	}
+
+	filename = filepath.Base(filename)
+	name := id + "_" + filename
+	if s.sealer != nil {
+		if data, err = s.sealer.seal(data, s.aad(tenant, name)); err != nil {
+			return Upload{}, fmt.Errorf("error encrypting upload: %v", err)
+		}
+	}
+	if err := os.WriteFile(filepath.Join(dir, name), data, 0600); err != nil {
+		return Upload{}, fmt.Errorf("error writing upload: %v", err)
+	}
+	return Upload{ID: id, Tenant: tenant, Filename: filename, Size: int64(len(data)), CreatedAt: time.Now().UTC()}, nil
+}
+
+// path finds the file holding the tenant's upload id.
+func (s *UploadStore) path(tenant, id string) (string, error) {
+	if !idPattern.MatchString(id) {
+		return "", ErrNotFound
+	}
+	matches, err := filepath.Glob(filepath.Join(s.tenantDir(tenant), id+"_*"))
+	if err != nil {
+		return "", err
+	}
+	if len(matches) == 0 {
+		return "", ErrNotFound
+	}
+	return matches[0], nil
+}
+
+// aad is the additional authenticated data for an upload file.
+func (s *UploadStore) aad(tenant, name string) string {
+	return tenant + "/" + name
+}
+
+// Load returns the contents of the tenant's upload id, decrypted if needed.
+func (s *UploadStore) Load(tenant, id string) ([]byte, error) {
+	path, err := s.path(tenant, id)
+	if err != nil {
+		return nil, err
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	return s.sealer.open(data, s.aad(tenant, filepath.Base(path)))
+}
+
+// List returns the tenant's uploads.
+func (s *UploadStore) List(tenant string) ([]Upload, error) {
+	entries, err := os.ReadDir(s.tenantDir(tenant))
+	if os.IsNotExist(err) {
+		return []Upload{}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	uploads := make([]Upload, 0, len(entries))
+	for _, entry := range entries {
+		id, filename, ok := strings.Cut(entry.Name(), "_")
+		if entry.IsDir() || !ok || !idPattern.MatchString(id) {
+			continue
+		}
+		info, err := entry.Info()
+		if err != nil {
+			return nil, err
+		}
+		uploads = append(uploads, Upload{ID: id, Tenant: tenant, Filename: filename, Size: info.Size(), CreatedAt: info.ModTime().UTC()})
+	}
+	return uploads, nil
+}
+
+// Tenants returns the tenants with uploads.
+func (s *UploadStore) Tenants() ([]string, error) {
+	return listTenants(s.dir)
+}
+
+// Delete removes the tenant's upload id.
+func (s *UploadStore) Delete(tenant, id string) error {
+	path, err := s.path(tenant, id)
+	if err != nil {
+		return err
+	}
+	return os.Remove(path)
+}
+
+// DeleteTenant removes every upload of tenant and returns their IDs.
+func (s *UploadStore) DeleteTenant(tenant string) ([]string, error) {
+	uploads, err := s.List(tenant)
+	if err != nil {
+		return nil, err
+	}
+	ids := make([]string, 0, len(uploads))
+	for _, u := range uploads {
+		ids = append(ids, u.ID)
+	}
+	if err := os.RemoveAll(s.tenantDir(tenant)); err != nil {
+		return nil, err
+	}
+	return ids, nil
+}
+
+// Cleanup removes the uploads in tenant directories that are older than
+// maxAge and returns how many were deleted. Other files under dir are left
+// alone.
+func (s *UploadStore) Cleanup(maxAge time.Duration) (int, error) {
+	tenants, err := s.Tenants()
+	if err != nil {
+		return 0, err
+	}
+	cutoff := time.Now().Add(-maxAge)
+	removed := 0
+	for _, tenant := range tenants {
+		uploads, err := s.List(tenant)
+		if err != nil {
+			return removed, err
+		}
+		for _, u := range uploads {
+			if !u.CreatedAt.Before(cutoff) {
+				continue
+			}
+			if err := s.Delete(tenant, u.ID); err != nil && !os.IsNotExist(err) {
+				return removed, err
+			}
+			removed++
+		}
+	}
+	return removed, nil
+}
@@ -0,0 +1,85 @@
+package storage
+
+import (
+	"sort"
+
+	"analyticsai/ai-service/analytics"
+)
+
+// TenantUsage is a tenant's use of the service over a period, summarized
+// from the audit log.
+type TenantUsage struct {
+	Tenant             string                          `json:"tenant"`
+	Requests           int                             `json:"requests"`
+	Analyses           int                             `json:"analyses"` // successful analysis requests
+	AnalysesByEndpoint map[string]int                  `json:"analyses_by_endpoint"`
+	Models             map[string]analytics.ModelUsage `json:"models"`
+	LLMCalls           int                             `json:"llm_calls"`
+	InputTokens        int                             `json:"input_tokens"`
+	OutputTokens       int                             `json:"output_tokens"`
+	RateLimitHits      int                             `json:"rate_limit_hits"` // requests rejected by a tenant limit
+	LimitHits          map[string]int                  `json:"limit_hits"`      // by limit
+}
+
+// UsageSummary sums audit records into per-tenant usage as they are
+// scanned, without holding the records.
+type UsageSummary struct {
+	isAnalysis func(AuditRecord) bool
+	byTenant   map[string]*TenantUsage
+}
+
+// NewUsageSummary returns an empty summary. isAnalysis tells which requests
+// are analyses.
+func NewUsageSummary(isAnalysis func(AuditRecord) bool) *UsageSummary {
+	return &UsageSummary{isAnalysis: isAnalysis, byTenant: make(map[string]*TenantUsage)}
+}
+
+// Add counts r towards its tenant's usage. Records of no tenant, such as
+// admin requests, are left out.
+func (s *UsageSummary) Add(r AuditRecord) {
+	if r.Tenant == "" {
+		return
+	}
+	u, ok := s.byTenant[r.Tenant]
+	if !ok {
+		u = NewTenantUsage(r.Tenant)
+		s.byTenant[r.Tenant] = u
+	}
+	u.Requests++
+	if r.Status >= 200 && r.Status < 300 && s.isAnalysis(r) {
+		u.Analyses++
+		u.AnalysesByEndpoint[r.Path]++
+	}
+	for model, m := range r.Models {
+		u.Models[model] = u.Models[model].Add(m)
+		u.LLMCalls += m.Calls
+		u.InputTokens += m.InputTokens
+		u.OutputTokens += m.OutputTokens
+	}
+	if r.Limit != "" {
+		u.RateLimitHits++
+		u.LimitHits[r.Limit]++
+	}
+}
+
+// Tenants returns the usage of every tenant seen, in tenant order.
+func (s *UsageSummary) Tenants() []*TenantUsage {
+	usage := make([]*TenantUsage, 0, len(s.byTenant))
+	for _, u := range s.byTenant {
+		usage = append(usage, u)
+	}
+	sort.Slice(usage, func(i, j int) bool {
+		return usage[i].Tenant < usage[j].Tenant
+	})
+	return usage
+}
+
+// NewTenantUsage returns the usage of a tenant that made no requests.
+func NewTenantUsage(tenant string) *TenantUsage {
+	return &TenantUsage{
+		Tenant:             tenant,
+		AnalysesByEndpoint: make(map[string]int),
+		Models:             make(map[string]analytics.ModelUsage),
+		LimitHits:          make(map[string]int),
+	}
+}
@@ -0,0 +1,152 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"sort"
+	"strings"
+
+	"analyticsai/ai-service/analytics"
+	"analyticsai/ai-service/storage"
+
+	"github.com/gin-gonic/gin"
+)
+
+// deleteTenantData removes everything stored for tenant and returns the
+// receipt.
+func deleteTenantData(tenant string) (*storage.DeletionReceipt, error) {
+	receipt, err := storage.NewDeletionReceipt(tenant, "tenant")
+	if err != nil {
+		return nil, err
+	}
+	if receipt.Uploads, err = uploadStore.DeleteTenant(tenant); err != nil {
+		return nil, err
+	}
+	if analysisStore != nil {
+		if receipt.Analyses, err = analysisStore.DeleteTenant(tenant); err != nil {
+			return nil, err
+		}
+	}
+	if receipt.Schedules, err = schedules.DeleteTenant(tenant); err != nil {
+		return nil, err
+	}
+	if receipt.AlertRules, err = alertRules.DeleteTenant(tenant); err != nil {
+		return nil, err
+	}
+	logWindows.DeleteTenant(tenant)
+	for name := range logBuffers.List(tenant) {
+		receipt.Buffers = append(receipt.Buffers, name)
+	}
+	sort.Strings(receipt.Buffers)
+	logBuffers.DeleteTenant(tenant)
+	if bufferStore != nil {
+		if err := bufferStore.DeleteTenant(tenant); err != nil {
+			return nil, err
+		}
+	}
+	conversations.DeleteTenant(tenant)
+	if _, err := semanticIndex.DeleteTenant(tenant); err != nil {
+		return nil, err
+	}
+	if _, err := feedback.DeleteTenant(tenant); err != nil {
+		return nil, err
+	}
+	log.Printf("Deletion %s: tenant %q, %d upload(s), %d analysis result(s), %d schedule(s), %d alert rule(s), %d log buffer(s)",
+		receipt.ReceiptID, tenant, len(receipt.Uploads), len(receipt.Analyses), len(receipt.Schedules), len(receipt.AlertRules), len(receipt.Buffers))
+	return receipt, nil
+}
+
+// deleteUpload deletes the tenant's upload id and responds with a deletion
+// receipt.
+func deleteUpload(c *gin.Context, tenant, id string) {
+	err := uploadStore.Delete(tenant, id)
+	if errors.Is(err, storage.ErrNotFound) {
+		c.JSON(http.StatusNotFound, gin.H{"error": fmt.Sprintf("upload %q not found", id)})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": fmt.Sprintf("error deleting upload: %v", err)})
+		return
+	}
+
+	receipt, err := storage.NewDeletionReceipt(tenant, "upload")
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": fmt.Sprintf("error creating receipt: %v", err)})
+		return
+	}
+	receipt.Uploads = append(receipt.Uploads, id)
+	log.Printf("Deletion %s: tenant %q upload %s", receipt.ReceiptID, tenant, id)
+	c.JSON(http.StatusOK, gin.H{"receipt": receipt})
+}
+
+// usageReport is a tenant's usage over a period, with its estimated model
+// cost and the storage it currently uses.
+type usageReport struct {
+	*storage.TenantUsage
+	EstimatedCostUSD float64          `json:"estimated_cost_usd"`
+	UnpricedModels   []string         `json:"unpriced_models,omitempty"` // models left out of the estimate
+	Storage          map[string]int64 `json:"storage_bytes"`
+}
+
+// usageReports summarizes the audit records matching q by tenant.
+func usageReports(q storage.AuditQuery) ([]usageReport, error) {
+	summary := storage.NewUsageSummary(isAnalysisRequest)
+	err := auditLog.Scan(q, summary.Add)
+	if err != nil {
+		return nil, err
+	}
+	var reports []usageReport
+	for _, u := range summary.Tenants() {
+		report := usageReport{TenantUsage: u}
+		report.EstimatedCostUSD, report.UnpricedModels = analytics.EstimateCost(u.Models, modelPrices)
+		if report.Storage, err = storageUsage(u.Tenant); err != nil {
+			return nil, err
+		}
+		reports = append(reports, report)
+	}
+	if reports == nil {
+		reports = []usageReport{}
+	}
+	return reports, nil
+}
+
+// isAnalysisRequest reports whether an audited request ran an analysis.
+// /analyze/batch and /analyze/buffer run their analyses with runAnalysis,
+// which audits each of them itself.
+func isAnalysisRequest(r storage.AuditRecord) bool {
+	if r.Method != http.MethodPost || r.Path == "/analyze/batch" || strings.HasPrefix(r.Path, "/analyze/buffer/") {
+		return false
+	}
+	return strings.HasPrefix(r.Path, "/analyze/") || strings.HasPrefix(r.Path, "/reports/") ||
+		r.Path == "/upload" || r.Path == "/forecast"
+}
+
+// storageUsage returns the bytes the tenant's uploads, stored analyses and
+// log buffer journals take now.
+func storageUsage(tenant string) (map[string]int64, error) {
+	usage := map[string]int64{"uploads": 0, "analyses": 0, "buffers": 0}
+	uploads, err := uploadStore.List(tenant)
+	if err != nil {
+		return nil, err
+	}
+	for _, u := range uploads {
+		usage["uploads"] += u.Size
+	}
+	if analysisStore != nil {
+		analyses, err := analysisStore.List(tenant, "")
+		if err != nil {
+			return nil, err
+		}
+		for _, a := range analyses {
+			usage["analyses"] += a.Size
+		}
+	}
+	if bufferStore != nil {
+		if usage["buffers"], err = bufferStore.Size(tenant); err != nil {
+			return nil, err
+		}
+	}
+	return usage, nil
+}
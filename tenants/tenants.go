@@ -0,0 +1,126 @@
+// Package tenants maps API keys to the tenants they belong to, for
+// deployments shared by several teams.
+package tenants
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+)
+
+const digestPrefix = "sha256:"
+
+// Tenant is the configuration of one tenant.
+type Tenant struct {
+	// APIKeys authenticate the tenant's requests. Each is either the key
+	// itself or "sha256:<hex digest>" of it, so the file need not hold
+	// usable keys.
+	APIKeys []string `json:"api_keys"`
+	// GeminiAPIKey, if set, is used for the tenant's model calls instead of
+	// the service's GEMINI_API_KEY, so usage is billed to the tenant.
+	GeminiAPIKey string `json:"gemini_api_key,omitempty"`
+	// GCSPrefixes are the Cloud Storage buckets, or bucket/prefix
+	// locations, the tenant's scheduled analyses may read.
+	GCSPrefixes []string `json:"gcs_prefixes,omitempty"`
+	// EmailDomains are the domains the tenant's email reports and alerts
+	// may be sent to.
+	EmailDomains []string `json:"email_domains,omitempty"`
+}
+
+// Registry holds the tenants of a tenants file, a JSON object mapping
+// tenant IDs to Tenant.
+type Registry struct {
+	tenants map[string]Tenant
+	keys    map[[sha256.Size]byte]string // key digest -> tenant ID
+}
+
+// Load reads the tenants file at path.
+func Load(path string) (*Registry, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("error reading tenants file: %v", err)
+	}
+	var tenants map[string]Tenant
+	if err := json.Unmarshal(data, &tenants); err != nil {
+		return nil, fmt.Errorf("error parsing tenants file: %v", err)
+	}
+	return New(tenants)
+}
+
+// New returns a registry of tenants, keyed by tenant ID.
+func New(tenants map[string]Tenant) (*Registry, error) {
+	r := &Registry{tenants: tenants, keys: make(map[[sha256.Size]byte]string)}
+	for id, tenant := range tenants {
+		if strings.TrimSpace(id) == "" {
+			return nil, fmt.Errorf("tenant ID must not be empty")
+		}
+		for _, key := range tenant.APIKeys {
+			digest, err := parseKey(key)
+			if err != nil {
+				return nil, fmt.Errorf("tenant %q: %v", id, err)
+			}
+			if other, ok := r.keys[digest]; ok {
+				return nil, fmt.Errorf("tenants %q and %q share an API key", other, id)
+			}
+			r.keys[digest] = id
+		}
+	}
+	return r, nil
+}
+
+// parseKey returns the digest of a configured API key.
+func parseKey(key string) ([sha256.Size]byte, error) {
+	var digest [sha256.Size]byte
+	hexDigest, ok := strings.CutPrefix(key, digestPrefix)
+	if !ok {
+		if key == "" {
+			return digest, fmt.Errorf("API key must not be empty")
+		}
+		return sha256.Sum256([]byte(key)), nil
+	}
+	b, err := hex.DecodeString(hexDigest)
+	if err != nil || len(b) != sha256.Size {
+		return digest, fmt.Errorf("invalid API key digest %q", key)
+	}
+	copy(digest[:], b)
+	return digest, nil
+}
+
+// Authenticate returns the tenant an API key belongs to. Keys are looked
+// up by digest, so the lookup takes the same time whichever key matches.
+func (r *Registry) Authenticate(key string) (string, bool) {
+	if key == "" {
+		return "", false
+	}
+	tenant, ok := r.keys[sha256.Sum256([]byte(key))]
+	return tenant, ok
+}
+
+// GeminiKey returns the tenant's own Gemini API key, if it has one.
+func (r *Registry) GeminiKey(tenant string) string {
+	return r.tenants[tenant].GeminiAPIKey
+}
+
+// GCSPrefixes returns the Cloud Storage locations the tenant may read.
+func (r *Registry) GCSPrefixes(tenant string) []string {
+	return r.tenants[tenant].GCSPrefixes
+}
+
+// EmailDomains returns the domains the tenant may email.
+func (r *Registry) EmailDomains(tenant string) []string {
+	return r.tenants[tenant].EmailDomains
+}
+
+// IDs returns the configured tenant IDs in order.
+func (r *Registry) IDs() []string {
+	ids := make([]string, 0, len(r.tenants))
+	for id := range r.tenants {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+	return ids
+}